@@ -74,6 +74,12 @@ spec:
             {{- with .Values.node.volumeAttachLimit }}
             - --volume-attach-limit={{ . }}
             {{- end }}
+            {{- if .Values.node.reconcileCSINodeAllocatable }}
+            - --reconcile-csinode-allocatable
+            {{- end }}
+            {{- if .Values.node.enableInstanceTopology }}
+            - --enable-instance-topology
+            {{- end }}
             {{- with .Values.node.loggingFormat }}
             - --logging-format={{ . }}
             {{- end }}
@@ -20,7 +20,9 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/kubernetes-sigs/aws-ebs-csi-driver/cmd/hooks"
@@ -51,7 +53,6 @@ func main() {
 		toStderr = fs.Bool("logtostderr", false, "log to standard error instead of files. DEPRECATED: will be removed in a future release.")
 		args     = os.Args[1:]
 		cmd      = string(driver.AllMode)
-		options  = driver.Options{}
 	)
 
 	c := logsapi.NewLoggingConfiguration()
@@ -79,16 +80,20 @@ func main() {
 			}
 		}
 		klog.FlushAndExit(klog.ExitFlushTimeout, 0)
+	case "modify-volume-dry-run":
+		if err = modifyVolumeDryRun(args); err != nil {
+			klog.ErrorS(err, "failed to run volume modification dry run")
+			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+		}
+		klog.FlushAndExit(klog.ExitFlushTimeout, 0)
 	case string(driver.ControllerMode), string(driver.NodeMode), string(driver.AllMode):
-		options.Mode = driver.Mode(cmd)
 	default:
-		klog.Errorf("Unknown driver mode %s: Expected %s, %s, %s, or pre-stop-hook", cmd, driver.ControllerMode, driver.NodeMode, driver.AllMode)
+		klog.Errorf("Unknown driver mode %s: Expected %s, %s, %s, pre-stop-hook, or modify-volume-dry-run", cmd, driver.ControllerMode, driver.NodeMode, driver.AllMode)
 		klog.FlushAndExit(klog.ExitFlushTimeout, 0)
 	}
 
-	options.AddFlags(fs)
-
-	if err = fs.Parse(args); err != nil {
+	options, err := driver.NewOptions(driver.Mode(cmd), fs, args)
+	if err != nil {
 		klog.ErrorS(err, "Failed to parse options")
 		klog.FlushAndExit(klog.ExitFlushTimeout, 0)
 	}
@@ -133,14 +138,25 @@ func main() {
 		}()
 	}
 
+	// ctx is done once the driver is asked to terminate
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	// The recorder must be initialized before the handler is started, otherwise no metrics would be served
 	if options.HttpEndpoint != "" {
 		r := metrics.InitializeRecorder()
-		r.InitializeMetricsHandler(options.HttpEndpoint, "/metrics", options.MetricsCertFile, options.MetricsKeyFile)
+		r.SetNamespace(options.MetricsNamespace)
+		if err = r.InitializeMetricsHandler(ctx, options.HttpEndpoint, "/metrics", options.MetricsCertFile, options.MetricsKeyFile, options.MetricsShutdownTimeout); err != nil {
+			klog.ErrorS(err, "Metrics were requested via --http-endpoint but the metrics server could not be started")
+			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+		}
 	}
 
 	cfg := metadata.MetadataServiceConfig{
 		EC2MetadataClient: metadata.DefaultEC2MetadataClient,
 		K8sAPIClient:      metadata.DefaultKubernetesAPIClient,
+		MetadataFile:      options.MetadataFile,
+		MetadataSources:   options.MetadataSources,
 	}
 
 	region := os.Getenv("AWS_REGION")
@@ -168,13 +184,15 @@ func main() {
 		region = md.GetRegion()
 	}
 
-	cloud, err := cloud.NewCloud(region, options.AwsSdkDebugLog, options.UserAgentExtra, options.Batching)
+	cloud, err := cloud.NewCloud(region, options.AwsSdkDebugLog, options.UserAgentExtra, options.Batching, options.DescribeVolumeCacheTTL)
 	if err != nil {
 		klog.ErrorS(err, "failed to create cloud service")
 		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
 	}
 
-	m, err := mounter.NewNodeMounter(options.WindowsHostProcess)
+	// The mode was validated along with the other options
+	dirMode, _ := options.MountDirMode()
+	m, err := mounter.NewNodeMounter(options.WindowsHostProcess, dirMode, options.ChmodExistingMountDirs)
 	if err != nil {
 		klog.ErrorS(err, "failed to create node mounter")
 		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
@@ -185,11 +203,16 @@ func main() {
 		klog.V(2).InfoS("Failed to setup k8s client", "err", err)
 	}
 
-	drv, err := driver.NewDriver(cloud, &options, m, md, k8sClient)
+	drv, err := driver.NewDriver(cloud, options, m, md, k8sClient)
 	if err != nil {
 		klog.ErrorS(err, "failed to create driver")
 		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
 	}
+	go func() {
+		<-ctx.Done()
+		klog.InfoS("Received termination signal, stopping driver")
+		drv.Stop()
+	}()
 	if err := drv.Run(); err != nil {
 		klog.ErrorS(err, "failed to run driver")
 		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
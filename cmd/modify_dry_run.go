@@ -0,0 +1,77 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud/metadata"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/driver"
+	flag "github.com/spf13/pflag"
+	cliflag "k8s.io/component-base/cli/flag"
+)
+
+// modifyVolumeDryRun prints whether EC2 is expected to accept the modifications a VolumeAttributesClass with the
+// given parameters would make to the volumes of the matching PersistentVolumes, without modifying any volume
+func modifyVolumeDryRun(args []string) error {
+	var (
+		fs         = flag.NewFlagSet("modify-volume-dry-run", flag.ExitOnError)
+		parameters = map[string]string{}
+		selector   = fs.String("selector", "", "Label selector of the PersistentVolumes to check. The default is empty string, which selects all PersistentVolumes provisioned by the driver.")
+		timeout    = fs.Duration("timeout", 10*time.Minute, "Maximum time to spend checking volumes.")
+	)
+	fs.Var(cliflag.NewMapStringString(&parameters), "parameters", "Parameters of the VolumeAttributesClass to check. It is a comma separated list of key value pairs like 'type=gp3,iops=4000,throughput=250'")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(parameters) == 0 {
+		return fmt.Errorf("--parameters must be specified")
+	}
+
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		md, err := metadata.NewMetadataService(metadata.MetadataServiceConfig{
+			EC2MetadataClient: metadata.DefaultEC2MetadataClient,
+			K8sAPIClient:      metadata.DefaultKubernetesAPIClient,
+		}, region)
+		if err != nil {
+			return fmt.Errorf("failed to determine region, it can be supplied via the AWS_REGION environment variable: %w", err)
+		}
+		region = md.GetRegion()
+	}
+
+	c, err := cloud.NewCloud(region, false, "", false, 0)
+	if err != nil {
+		return fmt.Errorf("failed to create cloud service: %w", err)
+	}
+	k, err := metadata.DefaultKubernetesAPIClient()
+	if err != nil {
+		return fmt.Errorf("unable to communicate with k8s API: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	results, err := driver.ModifyVolumeDryRun(ctx, c, k, parameters, *selector)
+	if err != nil {
+		return err
+	}
+	return driver.WriteModifyVolumeDryRunReport(os.Stdout, results)
+}
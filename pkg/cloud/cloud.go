@@ -23,11 +23,14 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
@@ -37,6 +40,7 @@ import (
 	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/util"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
 )
 
 // AWS volume types
@@ -74,8 +78,17 @@ const (
 	gp3MaxTotalIOPS             = 16000
 	gp3MinTotalIOPS             = 3000
 	gp3MaxIOPSPerGB             = 500
+	gp3DefaultIOPS              = 3000
+	gp3MinThroughput            = 125
+	gp3MaxThroughput            = 1000
+	gp3MaxIOPSPerThroughput     = 4
+	hddMinSizeGiB               = 125
 )
 
+// volumeModificationCooldown is the minimum time EC2 requires between the start of two modifications of a volume.
+// Source: https://docs.aws.amazon.com/ebs/latest/userguide/modify-volume-requirements.html
+const volumeModificationCooldown = 6 * time.Hour
+
 var (
 	ValidVolumeTypes = []string{
 		VolumeTypeIO1,
@@ -91,6 +104,9 @@ var (
 const (
 	volumeDetachedState = "detached"
 	volumeAttachedState = "attached"
+
+	// volumeStatusIOEnabledFailed is the status of the io-enabled volume status check of volumes with IO suspended
+	volumeStatusIOEnabledFailed = "failed"
 )
 
 // AWS provisioning limits.
@@ -106,6 +122,10 @@ const (
 	MaxTagKeyLength = 128
 	// MaxTagValueLength represents the maximum value length for a tag.
 	MaxTagValueLength = 256
+	// MinVolumeInitializationRate is the minimum initialization rate in MiB/s of volumes created from snapshots.
+	MinVolumeInitializationRate = 100
+	// MaxVolumeInitializationRate is the maximum initialization rate in MiB/s of volumes created from snapshots.
+	MaxVolumeInitializationRate = 300
 )
 
 // Defaults
@@ -126,6 +146,8 @@ const (
 	AWSTagKeyPrefix = "aws:"
 	//AwsEbsDriverTagKey is the tag to identify if a volume/snapshot is managed by ebs csi driver
 	AwsEbsDriverTagKey = "ebs.csi.aws.com/cluster"
+	// SourceSnapshotIDTagKey is the key value that refers to the ID of the snapshot a snapshot copy was copied from.
+	SourceSnapshotIDTagKey = "ebs.csi.aws.com/source-snapshot-id"
 )
 
 // Batcher
@@ -138,6 +160,9 @@ const (
 
 	batchDescribeTimeout = 30 * time.Second
 	batchMaxDelay        = 500 * time.Millisecond // Minimizes RPC latency and EC2 API calls. Tuned via scalability tests.
+
+	// maxDescribeVolumesResults is the largest MaxResults accepted by DescribeVolumes
+	maxDescribeVolumesResults = 500
 )
 
 var (
@@ -165,6 +190,9 @@ var (
 	// ErrInvalidMaxResults is returned when a MaxResults pagination parameter is between 1 and 4
 	ErrInvalidMaxResults = errors.New("MaxResults parameter must be 0 or greater than or equal to 5")
 
+	// ErrInvalidNextToken is returned when a NextToken pagination parameter is rejected by EC2
+	ErrInvalidNextToken = errors.New("invalid NextToken parameter")
+
 	// VolumeNotBeingModified is returned if volume being described is not being modified
 	VolumeNotBeingModified = fmt.Errorf("volume is not being modified")
 
@@ -173,6 +201,15 @@ var (
 
 	// ErrInvalidRequest is returned if parameters were rejected by driver
 	ErrInvalidRequest = errors.New("invalid request")
+
+	// ErrInvalidVolumeTypeTransition is returned if a volume cannot be modified to the requested volume type
+	ErrInvalidVolumeTypeTransition = errors.New("invalid volume type transition")
+
+	// ErrInvalidPerformanceRatio is returned if the requested IOPS or throughput are out of range for the volume
+	ErrInvalidPerformanceRatio = errors.New("invalid performance ratio")
+
+	// ErrInvalidKMSKeyID is returned if a KMS key ID is not a key ID, key ARN, alias name, or alias ARN
+	ErrInvalidKMSKeyID = errors.New("invalid KMS key ID")
 )
 
 // Set during build time via -ldflags
@@ -196,7 +233,28 @@ type Disk struct {
 	AvailabilityZone string
 	SnapshotID       string
 	OutpostArn       string
-	Attachments      []string
+	// Attachments are the IDs of the instances the volume is attached to
+	Attachments []string
+	// State is the EC2 state of the volume, such as available, in-use or error. It is only set by GetDiskByID and GetCachedDiskByID.
+	State string
+	// Tags of the volume, nil when it has none. They are only set by GetDiskByID, GetCachedDiskByID and ListDisks.
+	Tags map[string]string
+	// VolumeType, IOPS, Throughput, Encrypted and CreationTime are the settings the volume was created with, as returned
+	// by EC2. They are only set by CreateDisk.
+	VolumeType   string
+	IOPS         int32
+	Throughput   int32
+	Encrypted    bool
+	CreationTime time.Time
+}
+
+// DiskParameters represents the performance settings of an EBS volume along with its tags
+type DiskParameters struct {
+	VolumeID   string
+	VolumeType string
+	IOPS       int32
+	Throughput int32
+	Tags       map[string]string
 }
 
 // DiskOptions represents parameters to create an EBS volume
@@ -208,15 +266,20 @@ type DiskOptions struct {
 	AllowIOPSPerGBIncrease bool
 	IOPS                   int32
 	Throughput             int32
-	AvailabilityZone       string
-	OutpostArn             string
-	Encrypted              bool
-	BlockExpress           bool
-	MultiAttachEnabled     bool
+	// ThroughputPerGiB is the throughput in MiB/s per GiB of capacity, only supported for gp3 volumes
+	ThroughputPerGiB   int32
+	AvailabilityZone   string
+	OutpostArn         string
+	Encrypted          bool
+	BlockExpress       bool
+	MultiAttachEnabled bool
 	// KmsKeyID represents a fully qualified resource name to the key to use for encryption.
 	// example: arn:aws:kms:us-east-1:012345678910:key/abcd1234-a123-456a-a12b-a123b4cd56ef
 	KmsKeyID   string
 	SnapshotID string
+	// VolumeInitializationRate is the rate in MiB/s at which a volume created from SnapshotID is initialized, the
+	// default rate of EBS is used when it is 0. It is ignored when SnapshotID is empty.
+	VolumeInitializationRate int32
 }
 
 // ModifyDiskOptions represents parameters to modify an EBS volume
@@ -226,6 +289,39 @@ type ModifyDiskOptions struct {
 	Throughput int32
 }
 
+// ModifyTagsOptions represents the tags to add to and delete from an EBS volume
+type ModifyTagsOptions struct {
+	TagsToAdd    map[string]string
+	TagsToDelete []string
+}
+
+// ModifyDiskVerdict is the expected outcome of a volume modification
+type ModifyDiskVerdict string
+
+const (
+	// ModifyDiskVerdictOK means the modification is expected to be accepted
+	ModifyDiskVerdictOK ModifyDiskVerdict = "ok"
+	// ModifyDiskVerdictNoChange means the volume already matches the requested parameters
+	ModifyDiskVerdictNoChange ModifyDiskVerdict = "no-change"
+	// ModifyDiskVerdictInProgress means an earlier modification of the volume has not finished
+	ModifyDiskVerdictInProgress ModifyDiskVerdict = "in-progress"
+	// ModifyDiskVerdictCooldown means the volume was modified too recently to be modified again
+	ModifyDiskVerdictCooldown ModifyDiskVerdict = "cooldown"
+	// ModifyDiskVerdictInvalidType means the volume cannot be modified to the requested volume type
+	ModifyDiskVerdictInvalidType ModifyDiskVerdict = "invalid-type"
+	// ModifyDiskVerdictInvalidRatio means the requested IOPS or throughput are out of range for the volume
+	ModifyDiskVerdictInvalidRatio ModifyDiskVerdict = "invalid-ratio"
+	// ModifyDiskVerdictError means the outcome could not be determined
+	ModifyDiskVerdictError ModifyDiskVerdict = "error"
+)
+
+// ModifyDiskDryRun represents the expected outcome of a volume modification that was not performed
+type ModifyDiskDryRun struct {
+	Verdict ModifyDiskVerdict
+	// Reason explains any verdict other than ModifyDiskVerdictOK and ModifyDiskVerdictNoChange
+	Reason string
+}
+
 // Snapshot represents an EBS volume snapshot
 type Snapshot struct {
 	SnapshotID     string
@@ -233,6 +329,15 @@ type Snapshot struct {
 	Size           int32
 	CreationTime   time.Time
 	ReadyToUse     bool
+	Tags           map[string]string
+}
+
+// InstanceTypeInfo represents the properties of an instance type that affect its volume attach limit
+type InstanceTypeInfo struct {
+	// Nitro is true if the instance type is built on the Nitro System
+	Nitro bool
+	// NVMeInstanceStoreVolumes is the number of NVMe instance store volumes of the instance type
+	NVMeInstanceStoreVolumes int
 }
 
 // ListSnapshotsResponse is the container for our snapshots along with a pagination token to pass back to the caller
@@ -241,9 +346,17 @@ type ListSnapshotsResponse struct {
 	NextToken string
 }
 
+// ListDisksResponse is a page of volumes, NextToken is empty on the last page
+type ListDisksResponse struct {
+	Disks     []*Disk
+	NextToken string
+}
+
 // SnapshotOptions represents parameters to create an EBS volume
 type SnapshotOptions struct {
 	Tags map[string]string
+	// Description of the snapshot, a description naming the volume when empty
+	Description string
 }
 
 // ec2ListSnapshotsResponse is a helper struct returned from the AWS API calling function to the main ListSnapshots function
@@ -316,18 +429,26 @@ type cloud struct {
 	bm     *batcherManager
 	rm     *retryManager
 	vwp    volumeWaitParameters
+
+	// volumeCache caches the volumes of GetCachedDiskByID, it is nil when --describe-volume-cache-ttl is not set
+	volumeCache *volumeCache
+
+	// regionalEC2 holds the clients of the regions snapshots are copied to, created by newRegionalEC2 when first used
+	regionalEC2    map[string]EC2API
+	regionalEC2Mux sync.Mutex
+	newRegionalEC2 func(region string) EC2API
 }
 
 var _ Cloud = &cloud{}
 
 // NewCloud returns a new instance of AWS cloud
 // It panics if session is invalid
-func NewCloud(region string, awsSdkDebugLog bool, userAgentExtra string, batching bool) (Cloud, error) {
-	c := newEC2Cloud(region, awsSdkDebugLog, userAgentExtra, batching)
+func NewCloud(region string, awsSdkDebugLog bool, userAgentExtra string, batching bool, describeVolumeCacheTTL time.Duration) (Cloud, error) {
+	c := newEC2Cloud(region, awsSdkDebugLog, userAgentExtra, batching, describeVolumeCacheTTL)
 	return c, nil
 }
 
-func newEC2Cloud(region string, awsSdkDebugLog bool, userAgentExtra string, batchingEnabled bool) Cloud {
+func newEC2Cloud(region string, awsSdkDebugLog bool, userAgentExtra string, batchingEnabled bool, describeVolumeCacheTTL time.Duration) Cloud {
 	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(region))
 	if err != nil {
 		panic(err)
@@ -344,18 +465,23 @@ func newEC2Cloud(region string, awsSdkDebugLog bool, userAgentExtra string, batc
 		os.Setenv("AWS_EXECUTION_ENV", "aws-ebs-csi-driver-"+driverVersion)
 	}
 
-	svc := ec2.NewFromConfig(cfg, func(o *ec2.Options) {
-		o.APIOptions = append(o.APIOptions,
-			RecordRequestsMiddleware(),
-		)
+	newClient := func(clientRegion string) EC2API {
+		return ec2.NewFromConfig(cfg, func(o *ec2.Options) {
+			o.APIOptions = append(o.APIOptions,
+				RecordRequestsMiddleware(),
+			)
 
-		endpoint := os.Getenv("AWS_EC2_ENDPOINT")
-		if endpoint != "" {
-			o.BaseEndpoint = &endpoint
-		}
+			o.Region = clientRegion
+			// The endpoint override is specific to the region of the driver
+			endpoint := os.Getenv("AWS_EC2_ENDPOINT")
+			if endpoint != "" && clientRegion == region {
+				o.BaseEndpoint = &endpoint
+			}
 
-		o.RetryMaxAttempts = retryMaxAttempt
-	})
+			o.RetryMaxAttempts = retryMaxAttempt
+		})
+	}
+	svc := newClient(region)
 
 	var bm *batcherManager
 	if batchingEnabled {
@@ -364,12 +490,15 @@ func newEC2Cloud(region string, awsSdkDebugLog bool, userAgentExtra string, batc
 	}
 
 	return &cloud{
-		region: region,
-		dm:     dm.NewDeviceManager(),
-		ec2:    svc,
-		bm:     bm,
-		rm:     newRetryManager(),
-		vwp:    vwp,
+		region:         region,
+		dm:             dm.NewDeviceManager(),
+		ec2:            svc,
+		regionalEC2:    map[string]EC2API{},
+		newRegionalEC2: newClient,
+		bm:             bm,
+		rm:             newRetryManager(),
+		vwp:            vwp,
+		volumeCache:    newVolumeCache(describeVolumeCacheTTL, clock.RealClock{}),
 	}
 }
 
@@ -525,6 +654,15 @@ func (c *cloud) CreateDisk(ctx context.Context, volumeName string, diskOptions *
 	if diskOptions.IOPS > 0 && diskOptions.IOPSPerGB > 0 {
 		return nil, fmt.Errorf("invalid StorageClass parameters; specify either IOPS or IOPSPerGb, not both")
 	}
+	if diskOptions.Throughput > 0 && diskOptions.ThroughputPerGiB > 0 {
+		return nil, fmt.Errorf("invalid StorageClass parameters; specify either throughput or throughputPerGiB, not both")
+	}
+
+	if len(diskOptions.KmsKeyID) > 0 {
+		if err := ValidateKMSKeyID(diskOptions.KmsKeyID); err != nil {
+			return nil, err
+		}
+	}
 
 	createType = diskOptions.VolumeType
 	// If no volume type is specified, GP3 is used as default for newly created volumes.
@@ -558,6 +696,9 @@ func (c *cloud) CreateDisk(ctx context.Context, volumeName string, diskOptions *
 	if diskOptions.MultiAttachEnabled && createType != VolumeTypeIO2 {
 		return nil, fmt.Errorf("CreateDisk: multi-attach is only supported for io2 volumes")
 	}
+	if diskOptions.ThroughputPerGiB > 0 && createType != VolumeTypeGP3 {
+		return nil, fmt.Errorf("invalid StorageClass parameters; throughputPerGiB is only supported for gp3 volumes")
+	}
 
 	if maxIops > 0 {
 		if diskOptions.IOPS > 0 {
@@ -565,7 +706,20 @@ func (c *cloud) CreateDisk(ctx context.Context, volumeName string, diskOptions *
 		} else if diskOptions.IOPSPerGB > 0 {
 			requestedIops = diskOptions.IOPSPerGB * capacityGiB
 		}
-		iops = capIOPS(createType, capacityGiB, requestedIops, minIops, maxIops, maxIopsPerGb, diskOptions.AllowIOPSPerGBIncrease)
+		if createType == VolumeTypeGP3 && diskOptions.IOPSPerGB > 0 {
+			iops, err = capGP3IOPS(capacityGiB, diskOptions.IOPSPerGB, diskOptions.AllowIOPSPerGBIncrease)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			iops = capIOPS(createType, capacityGiB, requestedIops, minIops, maxIops, maxIopsPerGb, diskOptions.AllowIOPSPerGBIncrease)
+		}
+	}
+	if diskOptions.ThroughputPerGiB > 0 {
+		throughput, err = capGP3Throughput(capacityGiB, diskOptions.ThroughputPerGiB, iops, diskOptions.AllowIOPSPerGBIncrease)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	var tags []types.Tag
@@ -618,13 +772,17 @@ func (c *cloud) CreateDisk(ctx context.Context, volumeName string, diskOptions *
 		requestInput.Throughput = aws.Int32(throughput)
 	}
 	snapshotID := diskOptions.SnapshotID
+	optFns := []func(*ec2.Options){func(o *ec2.Options) {
+		o.Retryer = c.rm.createVolumeRetryer
+	}}
 	if len(snapshotID) > 0 {
 		requestInput.SnapshotId = aws.String(snapshotID)
+		if diskOptions.VolumeInitializationRate > 0 {
+			requestInput.VolumeInitializationRate = aws.Int32(diskOptions.VolumeInitializationRate)
+		}
 	}
 
-	response, err := c.ec2.CreateVolume(ctx, requestInput, func(o *ec2.Options) {
-		o.Retryer = c.rm.createVolumeRetryer
-	})
+	response, err := c.ec2.CreateVolume(ctx, requestInput, optFns...)
 	if err != nil {
 		if isAWSErrorSnapshotNotFound(err) {
 			return nil, ErrNotFound
@@ -668,7 +826,50 @@ func (c *cloud) CreateDisk(ctx context.Context, volumeName string, diskOptions *
 			return nil, fmt.Errorf("could not attach tags to volume: %v. %w", volumeID, err)
 		}
 	}
-	return &Disk{CapacityGiB: size, VolumeID: volumeID, AvailabilityZone: zone, SnapshotID: snapshotID, OutpostArn: outpostArn}, nil
+	return &Disk{
+		CapacityGiB:      size,
+		VolumeID:         volumeID,
+		AvailabilityZone: zone,
+		SnapshotID:       snapshotID,
+		OutpostArn:       outpostArn,
+		VolumeType:       string(response.VolumeType),
+		IOPS:             aws.ToInt32(response.Iops),
+		Throughput:       aws.ToInt32(response.Throughput),
+		Encrypted:        aws.ToBool(response.Encrypted),
+		CreationTime:     aws.ToTime(response.CreateTime),
+	}, nil
+}
+
+// kmsKeyIDRegex matches the ID of a single-Region or multi-Region KMS key
+var kmsKeyIDRegex = regexp.MustCompile(`^(mrk-[0-9a-f]{32}|[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})$`)
+
+// ValidateKMSKeyID checks that keyID is in one of the formats EC2 accepts for the KMS key of a volume:
+// a key ID, a key ARN, an alias name prefixed with "alias/", or an alias ARN
+func ValidateKMSKeyID(keyID string) error {
+	if strings.HasPrefix(keyID, "arn:") {
+		parsed, err := arn.Parse(keyID)
+		if err != nil {
+			return fmt.Errorf("%w: %q is not a valid ARN: %w", ErrInvalidKMSKeyID, keyID, err)
+		}
+		if parsed.Service != "kms" {
+			return fmt.Errorf("%w: ARN %q is not a KMS ARN", ErrInvalidKMSKeyID, keyID)
+		}
+		resourceType, resourceID, _ := strings.Cut(parsed.Resource, "/")
+		if (resourceType != "key" && resourceType != "alias") || resourceID == "" {
+			return fmt.Errorf("%w: ARN %q is not the ARN of a KMS key or alias", ErrInvalidKMSKeyID, keyID)
+		}
+		return nil
+	}
+	if alias, ok := strings.CutPrefix(keyID, "alias/"); ok {
+		if alias == "" {
+			return fmt.Errorf("%w: alias %q has no name", ErrInvalidKMSKeyID, keyID)
+		}
+		return nil
+	}
+	if !kmsKeyIDRegex.MatchString(keyID) {
+		return fmt.Errorf("%w: %q must be a key ID, key ARN, alias name prefixed with \"alias/\", or alias ARN", ErrInvalidKMSKeyID, keyID)
+	}
+	return nil
 }
 
 // execBatchDescribeVolumesModifications executes a batched DescribeVolumesModifications API call
@@ -725,6 +926,8 @@ func (c *cloud) batchDescribeVolumesModifications(request *ec2.DescribeVolumesMo
 // The resizing operation is performed only when newSizeBytes != 0.
 // It returns the volume size after this call or an error if the size couldn't be determined or the volume couldn't be modified.
 func (c *cloud) ResizeOrModifyDisk(ctx context.Context, volumeID string, newSizeBytes int64, options *ModifyDiskOptions) (int32, error) {
+	defer c.volumeCache.invalidate(volumeID)
+
 	if newSizeBytes != 0 {
 		klog.V(4).InfoS("Received Resize and/or Modify Disk request", "volumeID", volumeID, "newSizeBytes", newSizeBytes, "options", options)
 	} else {
@@ -778,7 +981,307 @@ func (c *cloud) ResizeOrModifyDisk(ctx context.Context, volumeID string, newSize
 	return c.checkDesiredState(ctx, volumeID, int32(newSizeGiB), options)
 }
 
+// CountNonCSIVolumeAttachments returns the number of EBS volumes attached to the instance, including its root volume,
+// that were not attached by the driver. Volumes carrying the tags the driver adds on creation, or attached at a device
+// name the driver allocates first, are considered attached by the driver.
+func (c *cloud) CountNonCSIVolumeAttachments(ctx context.Context, instanceID string) (int, error) {
+	volumes, err := describeVolumes(ctx, c.ec2, &ec2.DescribeVolumesInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("attachment.instance-id"),
+				Values: []string{instanceID},
+			},
+		},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error describing volumes attached to instance %q: %w", instanceID, err)
+	}
+
+	count := 0
+	for _, volume := range volumes {
+		if isDriverVolume(volume, instanceID) {
+			klog.V(5).InfoS("[Debug] Not counting volume attached by the driver", "volumeID", aws.ToString(volume.VolumeId))
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
+// ListDiskParameters returns the performance settings and tags of all volumes carrying the tag key, and the tags if any
+func (c *cloud) ListDiskParameters(ctx context.Context, tagKey string, tags map[string]string) ([]*DiskParameters, error) {
+	request := &ec2.DescribeVolumesInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("tag-key"),
+				Values: []string{tagKey},
+			},
+		},
+	}
+	for key, value := range tags {
+		request.Filters = append(request.Filters, types.Filter{Name: aws.String("tag:" + key), Values: []string{value}})
+	}
+	volumes, err := describeVolumes(ctx, c.ec2, request)
+	if err != nil {
+		return nil, fmt.Errorf("error describing volumes tagged with %q: %w", tagKey, err)
+	}
+
+	disks := make([]*DiskParameters, 0, len(volumes))
+	for _, volume := range volumes {
+		tags := make(map[string]string, len(volume.Tags))
+		for _, tag := range volume.Tags {
+			tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+		disks = append(disks, &DiskParameters{
+			VolumeID:   aws.ToString(volume.VolumeId),
+			VolumeType: string(volume.VolumeType),
+			IOPS:       aws.ToInt32(volume.Iops),
+			Throughput: aws.ToInt32(volume.Throughput),
+			Tags:       tags,
+		})
+	}
+	return disks, nil
+}
+
+// TagDisk adds the tags to the volume, replacing the values of tags that already exist
+func (c *cloud) TagDisk(ctx context.Context, volumeID string, tags map[string]string) error {
+	defer c.volumeCache.invalidate(volumeID)
+	input := &ec2.CreateTagsInput{
+		Resources: []string{volumeID},
+	}
+	for key, value := range tags {
+		input.Tags = append(input.Tags, types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	if _, err := c.ec2.CreateTags(ctx, input); err != nil {
+		return fmt.Errorf("could not tag volume %s: %w", volumeID, err)
+	}
+	return nil
+}
+
+// ModifyTags adds and deletes the tags of a volume, without modifying the volume itself
+func (c *cloud) ModifyTags(ctx context.Context, volumeID string, tagOptions ModifyTagsOptions) error {
+	defer c.volumeCache.invalidate(volumeID)
+	if len(tagOptions.TagsToAdd) > 0 {
+		if err := c.TagDisk(ctx, volumeID, tagOptions.TagsToAdd); err != nil {
+			return err
+		}
+	}
+	if len(tagOptions.TagsToDelete) > 0 {
+		input := &ec2.DeleteTagsInput{
+			Resources: []string{volumeID},
+		}
+		for _, key := range tagOptions.TagsToDelete {
+			input.Tags = append(input.Tags, types.Tag{Key: aws.String(key)})
+		}
+		if _, err := c.ec2.DeleteTags(ctx, input); err != nil {
+			return fmt.Errorf("could not delete tags of volume %s: %w", volumeID, err)
+		}
+	}
+	return nil
+}
+
+// ListIOSuspendedDisks returns the IDs of the volumes of the region whose IO was suspended by EBS, because their data
+// is potentially inconsistent, until it is enabled with EnableDiskIO
+func (c *cloud) ListIOSuspendedDisks(ctx context.Context) ([]string, error) {
+	request := &ec2.DescribeVolumeStatusInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("volume-status.details-name"),
+				Values: []string{string(types.VolumeStatusNameIoEnabled)},
+			},
+			{
+				Name:   aws.String("volume-status.details-status"),
+				Values: []string{volumeStatusIOEnabledFailed},
+			},
+		},
+	}
+
+	var volumeIDs []string
+	for {
+		response, err := c.ec2.DescribeVolumeStatus(ctx, request)
+		if err != nil {
+			return nil, fmt.Errorf("error describing volume status: %w", err)
+		}
+		for _, status := range response.VolumeStatuses {
+			if isIOSuspended(status) {
+				volumeIDs = append(volumeIDs, aws.ToString(status.VolumeId))
+			}
+		}
+		if aws.ToString(response.NextToken) == "" {
+			return volumeIDs, nil
+		}
+		request.NextToken = response.NextToken
+	}
+}
+
+// isIOSuspended reports whether the io-enabled check of the volume failed. The filters of DescribeVolumeStatus match
+// details independently, so a volume with another failed check is returned along with the volumes with IO suspended.
+func isIOSuspended(status types.VolumeStatusItem) bool {
+	if status.VolumeStatus == nil {
+		return false
+	}
+	for _, detail := range status.VolumeStatus.Details {
+		if detail.Name == types.VolumeStatusNameIoEnabled && aws.ToString(detail.Status) == volumeStatusIOEnabledFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// EnableDiskIO enables IO on a volume whose IO was suspended by EBS
+func (c *cloud) EnableDiskIO(ctx context.Context, volumeID string) error {
+	defer c.volumeCache.invalidate(volumeID)
+	if _, err := c.ec2.EnableVolumeIO(ctx, &ec2.EnableVolumeIOInput{VolumeId: aws.String(volumeID)}); err != nil {
+		if isAWSErrorVolumeNotFound(err) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("could not enable IO on volume %s: %w", volumeID, err)
+	}
+	return nil
+}
+
+// isDriverVolume reports whether a volume attached to the instance was created or attached by the driver
+func isDriverVolume(volume types.Volume, instanceID string) bool {
+	for _, tag := range volume.Tags {
+		if key := aws.ToString(tag.Key); key == AwsEbsDriverTagKey || key == VolumeNameTagKey {
+			return true
+		}
+	}
+	for _, attachment := range volume.Attachments {
+		if aws.ToString(attachment.InstanceId) == instanceID && dm.IsLikelyDriverDeviceName(aws.ToString(attachment.Device)) {
+			return true
+		}
+	}
+	return false
+}
+
+// DryRunModifyDisk reports whether EC2 is expected to accept modifying the volume with options, without modifying it
+func (c *cloud) DryRunModifyDisk(ctx context.Context, volumeID string, options *ModifyDiskOptions) (*ModifyDiskDryRun, error) {
+	volume, err := c.getVolume(ctx, &ec2.DescribeVolumesInput{
+		VolumeIds: []string{volumeID},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if volume.Size == nil {
+		return nil, fmt.Errorf("volume %q has no size", volumeID)
+	}
+
+	if !needsVolumeModification(*volume, 0, options) {
+		return &ModifyDiskDryRun{Verdict: ModifyDiskVerdictNoChange}, nil
+	}
+	if err = ValidateModifyDiskOptions(*volume, options); err != nil {
+		verdict := ModifyDiskVerdictInvalidRatio
+		if errors.Is(err, ErrInvalidVolumeTypeTransition) {
+			verdict = ModifyDiskVerdictInvalidType
+		}
+		return &ModifyDiskDryRun{Verdict: verdict, Reason: err.Error()}, nil
+	}
+
+	// This call must NOT be batched because a missing volume modification will return client error
+	latestMod, err := c.getLatestVolumeModification(ctx, volumeID, false)
+	if err != nil && !errors.Is(err, VolumeNotBeingModified) {
+		return nil, fmt.Errorf("error fetching volume modifications for %q: %w", volumeID, err)
+	}
+	if latestMod != nil {
+		// Like ResizeOrModifyDisk, volumes that are still optimizing are not modified
+		if state := latestMod.ModificationState; state == types.VolumeModificationStateModifying || state == types.VolumeModificationStateOptimizing {
+			return &ModifyDiskDryRun{Verdict: ModifyDiskVerdictInProgress, Reason: fmt.Sprintf("volume %q is in %s state", volumeID, state)}, nil
+		}
+		if latestMod.StartTime != nil {
+			if next := latestMod.StartTime.Add(volumeModificationCooldown); time.Now().Before(next) {
+				return &ModifyDiskDryRun{Verdict: ModifyDiskVerdictCooldown, Reason: fmt.Sprintf("volume %q cannot be modified again until %s", volumeID, next.Format(time.RFC3339))}, nil
+			}
+		}
+	}
+
+	return &ModifyDiskDryRun{Verdict: ModifyDiskVerdictOK}, nil
+}
+
+// ValidateModifyDiskOptions checks the parts of a volume modification that EC2 would reject regardless of the
+// volume's modification history: unsupported volume type transitions and IOPS or throughput out of range
+// for the resulting volume type and size
+func ValidateModifyDiskOptions(volume types.Volume, options *ModifyDiskOptions) error {
+	currentType := strings.ToLower(string(volume.VolumeType))
+	targetType := currentType
+	if options.VolumeType != "" {
+		targetType = strings.ToLower(options.VolumeType)
+	}
+	sizeGiB := aws.ToInt32(volume.Size)
+
+	if targetType != currentType {
+		if !slices.Contains(ValidVolumeTypes, targetType) {
+			return fmt.Errorf("%w: unknown volume type %q", ErrInvalidVolumeTypeTransition, targetType)
+		}
+		if currentType == VolumeTypeStandard || targetType == VolumeTypeStandard {
+			return fmt.Errorf("%w: previous generation %s volumes cannot be modified", ErrInvalidVolumeTypeTransition, VolumeTypeStandard)
+		}
+		if aws.ToBool(volume.MultiAttachEnabled) {
+			return fmt.Errorf("%w: the volume type of Multi-Attach enabled volumes cannot be changed", ErrInvalidVolumeTypeTransition)
+		}
+		if (targetType == VolumeTypeSC1 || targetType == VolumeTypeST1) && sizeGiB < hddMinSizeGiB {
+			return fmt.Errorf("%w: %s volumes must be at least %d GiB, volume is %d GiB", ErrInvalidVolumeTypeTransition, targetType, hddMinSizeGiB, sizeGiB)
+		}
+	}
+
+	// Parameters that are not requested keep their current value, unless the volume type changes
+	iops := options.IOPS
+	if iops == 0 && targetType == currentType {
+		iops = aws.ToInt32(volume.Iops)
+	}
+	throughput := options.Throughput
+	if throughput == 0 && targetType == currentType {
+		throughput = aws.ToInt32(volume.Throughput)
+	}
+
+	switch targetType {
+	case VolumeTypeIO1:
+		return validatePerformance(targetType, sizeGiB, iops, io1MinTotalIOPS, io1MaxTotalIOPS, io1MaxIOPSPerGB)
+	case VolumeTypeIO2:
+		return validatePerformance(targetType, sizeGiB, iops, io2MinTotalIOPS, io2BlockExpressMaxTotalIOPS, io2MaxIOPSPerGB)
+	case VolumeTypeGP3:
+		if iops == 0 {
+			iops = gp3DefaultIOPS
+		}
+		// The baseline IOPS of gp3 volumes is available at any size
+		if iops > gp3DefaultIOPS {
+			if err := validatePerformance(targetType, sizeGiB, iops, gp3MinTotalIOPS, gp3MaxTotalIOPS, gp3MaxIOPSPerGB); err != nil {
+				return err
+			}
+		}
+		if throughput > gp3MaxThroughput {
+			return fmt.Errorf("%w: %s throughput must be at most %d MiB/s, requested %d MiB/s", ErrInvalidPerformanceRatio, targetType, gp3MaxThroughput, throughput)
+		}
+		if throughput*gp3MaxIOPSPerThroughput > iops {
+			return fmt.Errorf("%w: %s throughput of %d MiB/s requires at least %d IOPS, volume has %d IOPS", ErrInvalidPerformanceRatio, targetType, throughput, throughput*gp3MaxIOPSPerThroughput, iops)
+		}
+	default:
+		if options.IOPS != 0 {
+			return fmt.Errorf("%w: %s volumes do not support provisioned IOPS", ErrInvalidPerformanceRatio, targetType)
+		}
+		if options.Throughput != 0 {
+			return fmt.Errorf("%w: %s volumes do not support provisioned throughput", ErrInvalidPerformanceRatio, targetType)
+		}
+	}
+	return nil
+}
+
+// validatePerformance checks that iops, if set, is within the total and per GiB limits of a volume type
+func validatePerformance(volumeType string, sizeGiB, iops, minTotalIOPS, maxTotalIOPS, maxIOPSPerGB int32) error {
+	if iops == 0 {
+		return nil
+	}
+	if iops < minTotalIOPS || iops > maxTotalIOPS {
+		return fmt.Errorf("%w: %s IOPS must be between %d and %d, requested %d", ErrInvalidPerformanceRatio, volumeType, minTotalIOPS, maxTotalIOPS, iops)
+	}
+	if int64(iops) > int64(maxIOPSPerGB)*int64(sizeGiB) {
+		return fmt.Errorf("%w: %s volumes support at most %d IOPS per GiB, requested %d IOPS for %d GiB", ErrInvalidPerformanceRatio, volumeType, maxIOPSPerGB, iops, sizeGiB)
+	}
+	return nil
+}
+
 func (c *cloud) DeleteDisk(ctx context.Context, volumeID string) (bool, error) {
+	defer c.volumeCache.invalidate(volumeID)
 	request := &ec2.DeleteVolumeInput{VolumeId: &volumeID}
 	if _, err := c.ec2.DeleteVolume(ctx, request, func(o *ec2.Options) {
 		o.Retryer = c.rm.deleteVolumeRetryer
@@ -861,6 +1364,8 @@ var cacheMutex sync.Mutex
 var nodeDeviceCache map[string]cachedNode = map[string]cachedNode{}
 
 func (c *cloud) AttachDisk(ctx context.Context, volumeID, nodeID string) (string, error) {
+	defer c.volumeCache.invalidate(volumeID)
+
 	instance, err := c.getInstance(ctx, nodeID)
 	if err != nil {
 		return "", err
@@ -941,6 +1446,8 @@ func (c *cloud) AttachDisk(ctx context.Context, volumeID, nodeID string) (string
 }
 
 func (c *cloud) DetachDisk(ctx context.Context, volumeID, nodeID string) error {
+	defer c.volumeCache.invalidate(volumeID)
+
 	instance, err := c.getInstance(ctx, nodeID)
 	if err != nil {
 		return err
@@ -1116,18 +1623,70 @@ func (c *cloud) GetDiskByID(ctx context.Context, volumeID string) (*Disk, error)
 		return nil, err
 	}
 
+	return newDisk(*volume), nil
+}
+
+// ListDisks returns a page of at most maxResults volumes tagged with tagKey, starting at nextToken
+// maxResults of 0 returns a page of the default size of EC2, values above the maximum of EC2 are lowered to it
+func (c *cloud) ListDisks(ctx context.Context, tagKey string, maxResults int32, nextToken string) (*ListDisksResponse, error) {
+	if maxResults > 0 && maxResults < 5 {
+		return nil, ErrInvalidMaxResults
+	}
+
+	request := &ec2.DescribeVolumesInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("tag-key"),
+				Values: []string{tagKey},
+			},
+		},
+	}
+	if maxResults > 0 {
+		request.MaxResults = aws.Int32(min(maxResults, maxDescribeVolumesResults))
+	}
+	if len(nextToken) != 0 {
+		request.NextToken = aws.String(nextToken)
+	}
+
+	response, err := c.ec2.DescribeVolumes(ctx, request)
+	if err != nil {
+		if len(nextToken) != 0 && (isAWSError(err, "InvalidNextToken") || isAWSErrorInvalidParameter(err)) {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidNextToken, err)
+		}
+		return nil, fmt.Errorf("error describing volumes tagged with %q: %w", tagKey, err)
+	}
+
+	disks := make([]*Disk, 0, len(response.Volumes))
+	for _, volume := range response.Volumes {
+		disks = append(disks, newDisk(volume))
+	}
+	return &ListDisksResponse{
+		Disks:     disks,
+		NextToken: aws.ToString(response.NextToken),
+	}, nil
+}
+
+// newDisk converts an EC2 volume to a Disk
+func newDisk(volume types.Volume) *Disk {
 	disk := &Disk{
 		VolumeID:         aws.ToString(volume.VolumeId),
 		AvailabilityZone: aws.ToString(volume.AvailabilityZone),
 		OutpostArn:       aws.ToString(volume.OutpostArn),
-		Attachments:      getVolumeAttachmentsList(*volume),
+		Attachments:      getVolumeAttachmentsList(volume),
+		State:            string(volume.State),
 	}
 
 	if volume.Size != nil {
 		disk.CapacityGiB = *volume.Size
 	}
+	if len(volume.Tags) > 0 {
+		disk.Tags = make(map[string]string, len(volume.Tags))
+		for _, tag := range volume.Tags {
+			disk.Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+	}
 
-	return disk, nil
+	return disk
 }
 
 // execBatchDescribeSnapshots executes a batched DescribeSnapshots API call depending on the type of batcher.
@@ -1241,6 +1800,9 @@ func extractSnapshotKey(s *types.Snapshot, batcher snapshotBatcherType) (string,
 
 func (c *cloud) CreateSnapshot(ctx context.Context, volumeID string, snapshotOptions *SnapshotOptions) (snapshot *Snapshot, err error) {
 	descriptions := "Created by AWS EBS CSI driver for volume " + volumeID
+	if snapshotOptions.Description != "" {
+		descriptions = snapshotOptions.Description
+	}
 
 	var tags []types.Tag
 	for key, value := range snapshotOptions.Tags {
@@ -1372,6 +1934,10 @@ func (c *cloud) ec2SnapshotResponseToStruct(ec2Snapshot types.Snapshot) *Snapsho
 		SourceVolumeID: aws.ToString(ec2Snapshot.VolumeId),
 		Size:           snapshotSize,
 		CreationTime:   *ec2Snapshot.StartTime,
+		Tags:           make(map[string]string, len(ec2Snapshot.Tags)),
+	}
+	for _, tag := range ec2Snapshot.Tags {
+		snapshot.Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
 	}
 	if ec2Snapshot.State == types.SnapshotStateCompleted {
 		snapshot.ReadyToUse = true
@@ -1382,6 +1948,139 @@ func (c *cloud) ec2SnapshotResponseToStruct(ec2Snapshot types.Snapshot) *Snapsho
 	return snapshot
 }
 
+// CopySnapshotToRegion copies a snapshot of the region of the driver to another region, tagging the copy with
+// SourceSnapshotIDTagKey. The copy is looked up by that tag first, so that the snapshot is copied only once.
+func (c *cloud) CopySnapshotToRegion(ctx context.Context, snapshotID, region string, tags map[string]string) (*Snapshot, error) {
+	svc, err := c.ec2ForRegion(region)
+	if err != nil {
+		return nil, err
+	}
+
+	copies, err := describeSnapshots(ctx, svc, snapshotCopiesRequest(snapshotID))
+	if err != nil {
+		return nil, fmt.Errorf("error looking up copies of snapshot %s in region %s: %w", snapshotID, region, err)
+	}
+	if len(copies) > 1 {
+		return nil, ErrMultiSnapshots
+	}
+	if len(copies) == 1 {
+		return c.ec2SnapshotResponseToStruct(copies[0]), nil
+	}
+
+	copyTags := []types.Tag{{Key: aws.String(SourceSnapshotIDTagKey), Value: aws.String(snapshotID)}}
+	for key, value := range tags {
+		if key != SourceSnapshotIDTagKey {
+			copyTags = append(copyTags, types.Tag{Key: aws.String(key), Value: aws.String(value)})
+		}
+	}
+	request := &ec2.CopySnapshotInput{
+		SourceRegion:     aws.String(c.region),
+		SourceSnapshotId: aws.String(snapshotID),
+		Description:      aws.String("Copied by AWS EBS CSI driver from snapshot " + snapshotID + " of region " + c.region),
+		TagSpecifications: []types.TagSpecification{{
+			ResourceType: types.ResourceTypeSnapshot,
+			Tags:         copyTags,
+		}},
+	}
+	res, err := svc.CopySnapshot(ctx, request)
+	if err != nil {
+		if isAWSErrorSnapshotNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("error copying snapshot %s to region %s: %w", snapshotID, region, err)
+	}
+	return &Snapshot{SnapshotID: aws.ToString(res.SnapshotId)}, nil
+}
+
+// DeleteSnapshotCopies deletes the copies made by CopySnapshotToRegion of a snapshot in a region
+func (c *cloud) DeleteSnapshotCopies(ctx context.Context, snapshotID, region string) error {
+	svc, err := c.ec2ForRegion(region)
+	if err != nil {
+		return err
+	}
+
+	copies, err := describeSnapshots(ctx, svc, snapshotCopiesRequest(snapshotID))
+	if err != nil {
+		return fmt.Errorf("error looking up copies of snapshot %s in region %s: %w", snapshotID, region, err)
+	}
+	for _, snapshotCopy := range copies {
+		copyID := aws.ToString(snapshotCopy.SnapshotId)
+		if _, err := svc.DeleteSnapshot(ctx, &ec2.DeleteSnapshotInput{SnapshotId: aws.String(copyID)}); err != nil && !isAWSErrorSnapshotNotFound(err) {
+			return fmt.Errorf("could not delete copy %s of snapshot %s in region %s: %w", copyID, snapshotID, region, err)
+		}
+	}
+	return nil
+}
+
+// ListSnapshotsByTag returns the snapshots owned by the account carrying the tag key
+func (c *cloud) ListSnapshotsByTag(ctx context.Context, tagKey string) ([]*Snapshot, error) {
+	ec2Snapshots, err := describeSnapshots(ctx, c.ec2, &ec2.DescribeSnapshotsInput{
+		OwnerIds: []string{"self"},
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("tag-key"),
+				Values: []string{tagKey},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error describing snapshots tagged with %q: %w", tagKey, err)
+	}
+
+	snapshots := make([]*Snapshot, 0, len(ec2Snapshots))
+	for _, ec2Snapshot := range ec2Snapshots {
+		snapshots = append(snapshots, c.ec2SnapshotResponseToStruct(ec2Snapshot))
+	}
+	return snapshots, nil
+}
+
+// TagSnapshot adds the tags to the snapshot, replacing the values of tags that already exist
+func (c *cloud) TagSnapshot(ctx context.Context, snapshotID string, tags map[string]string) error {
+	input := &ec2.CreateTagsInput{
+		Resources: []string{snapshotID},
+	}
+	for key, value := range tags {
+		input.Tags = append(input.Tags, types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	if _, err := c.ec2.CreateTags(ctx, input); err != nil {
+		return fmt.Errorf("could not tag snapshot %s: %w", snapshotID, err)
+	}
+	return nil
+}
+
+func snapshotCopiesRequest(snapshotID string) *ec2.DescribeSnapshotsInput {
+	return &ec2.DescribeSnapshotsInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("tag:" + SourceSnapshotIDTagKey),
+				Values: []string{snapshotID},
+			},
+		},
+	}
+}
+
+// ec2ForRegion returns the client of a region, creating it when first used
+func (c *cloud) ec2ForRegion(region string) (EC2API, error) {
+	if region == c.region {
+		return c.ec2, nil
+	}
+
+	c.regionalEC2Mux.Lock()
+	defer c.regionalEC2Mux.Unlock()
+	if svc, ok := c.regionalEC2[region]; ok {
+		return svc, nil
+	}
+	if c.newRegionalEC2 == nil {
+		return nil, fmt.Errorf("no EC2 client for region %s", region)
+	}
+	if c.regionalEC2 == nil {
+		c.regionalEC2 = map[string]EC2API{}
+	}
+	svc := c.newRegionalEC2(region)
+	c.regionalEC2[region] = svc
+	return svc, nil
+}
+
 func (c *cloud) EnableFastSnapshotRestores(ctx context.Context, availabilityZones []string, snapshotID string) (*ec2.EnableFastSnapshotRestoresOutput, error) {
 	request := &ec2.EnableFastSnapshotRestoresInput{
 		AvailabilityZones: availabilityZones,
@@ -1400,6 +2099,36 @@ func (c *cloud) EnableFastSnapshotRestores(ctx context.Context, availabilityZone
 	return response, nil
 }
 
+// FastSnapshotRestoreZones returns the availability zones in which fast snapshot restores of the snapshot are enabled
+// or being enabled
+func (c *cloud) FastSnapshotRestoreZones(ctx context.Context, snapshotID string) ([]string, error) {
+	request := &ec2.DescribeFastSnapshotRestoresInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("snapshot-id"),
+				Values: []string{snapshotID},
+			},
+		},
+	}
+	var zones []string
+	for {
+		response, err := c.ec2.DescribeFastSnapshotRestores(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		for _, fsr := range response.FastSnapshotRestores {
+			switch fsr.State {
+			case types.FastSnapshotRestoreStateCodeEnabling, types.FastSnapshotRestoreStateCodeOptimizing, types.FastSnapshotRestoreStateCodeEnabled:
+				zones = append(zones, aws.ToString(fsr.AvailabilityZone))
+			}
+		}
+		if aws.ToString(response.NextToken) == "" {
+			return zones, nil
+		}
+		request.NextToken = response.NextToken
+	}
+}
+
 func describeVolumes(ctx context.Context, svc EC2API, request *ec2.DescribeVolumesInput) ([]types.Volume, error) {
 	var volumes []types.Volume
 	var nextToken *string
@@ -1648,6 +2377,12 @@ func isAWSErrorInvalidParameter(err error) bool {
 	return false
 }
 
+// IsAttachmentLimitExceeded returns a boolean indicating whether the given error is
+// caused by the instance having reached its limit of volume attachments.
+func IsAttachmentLimitExceeded(err error) bool {
+	return isAWSError(err, "AttachmentLimitExceeded")
+}
+
 // Checks for desired size on volume by also verifying volume size by describing volume.
 // This is to get around potential eventual consistency problems with describing volume modifications
 // objects and ensuring that we read two different objects to verify volume state.
@@ -1785,6 +2520,31 @@ func (c *cloud) AvailabilityZones(ctx context.Context) (map[string]struct{}, err
 	return zones, nil
 }
 
+// GetInstanceTypeInfo describes the given instance type using the EC2 API
+func (c *cloud) GetInstanceTypeInfo(ctx context.Context, instanceType string) (*InstanceTypeInfo, error) {
+	response, err := c.ec2.DescribeInstanceTypes(ctx, &ec2.DescribeInstanceTypesInput{
+		InstanceTypes: []types.InstanceType{types.InstanceType(instanceType)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error describing instance type %q: %w", instanceType, err)
+	}
+	if len(response.InstanceTypes) != 1 {
+		return nil, fmt.Errorf("expected 1 instance type for %q, got %d", instanceType, len(response.InstanceTypes))
+	}
+
+	info := response.InstanceTypes[0]
+	instanceTypeInfo := &InstanceTypeInfo{
+		// Bare metal instances report no hypervisor, but are built on the Nitro System
+		Nitro: info.Hypervisor == types.InstanceTypeHypervisorNitro || aws.ToBool(info.BareMetal),
+	}
+	if storage := info.InstanceStorageInfo; storage != nil && storage.NvmeSupport != types.EphemeralNvmeSupportUnsupported {
+		for _, disk := range storage.Disks {
+			instanceTypeInfo.NVMeInstanceStoreVolumes += int(aws.ToInt32(disk.Count))
+		}
+	}
+	return instanceTypeInfo, nil
+}
+
 func needsVolumeModification(volume types.Volume, newSizeGiB int32, options *ModifyDiskOptions) bool {
 	oldSizeGiB := *volume.Size
 	needsModification := false
@@ -1882,6 +2642,52 @@ func getVolumeAttachmentsList(volume types.Volume) []string {
 	return volumeAttachmentList
 }
 
+// capGP3IOPS returns the IOPS of a gp3 volume provisioned with iopsPerGB
+// IOPS above the gp3 limits are capped like the IOPS of other volume types, and IOPS below them are increased when
+// allowIncrease is set and rejected otherwise. Volumes too small for the baseline at the IOPS per GiB limit may still
+// use the baseline.
+func capGP3IOPS(capacityGiB, iopsPerGB int32, allowIncrease bool) (int32, error) {
+	requested := int64(iopsPerGB) * int64(capacityGiB)
+	maxIOPS := min(int64(gp3MaxTotalIOPS), max(int64(gp3MaxIOPSPerGB)*int64(capacityGiB), gp3MinTotalIOPS))
+
+	switch {
+	case requested < gp3MinTotalIOPS:
+		if !allowIncrease {
+			return 0, fmt.Errorf("%w: iopsPerGB of %d gives %d IOPS for %d GiB, gp3 volumes require at least %d IOPS", ErrInvalidPerformanceRatio, iopsPerGB, requested, capacityGiB, gp3MinTotalIOPS)
+		}
+		klog.V(5).InfoS("[Debug] Increased gp3 IOPS to the min supported limit", "requestedCapacityGiB", capacityGiB, "iopsPerGB", iopsPerGB, "limit", gp3MinTotalIOPS)
+		return gp3MinTotalIOPS, nil
+	case requested > maxIOPS:
+		klog.V(5).InfoS("[Debug] Capped gp3 IOPS at the max supported limit", "requestedCapacityGiB", capacityGiB, "iopsPerGB", iopsPerGB, "limit", maxIOPS)
+		return int32(maxIOPS), nil
+	}
+	return int32(requested), nil
+}
+
+// capGP3Throughput returns the throughput of a gp3 volume provisioned with throughputPerGiB and iops, 0 for the baseline
+// Throughput above the gp3 limits, including the maximum throughput per IOPS, is capped, and throughput below them is
+// increased when allowIncrease is set and rejected otherwise.
+func capGP3Throughput(capacityGiB, throughputPerGiB, iops int32, allowIncrease bool) (int32, error) {
+	if iops == 0 {
+		iops = gp3DefaultIOPS
+	}
+	requested := int64(throughputPerGiB) * int64(capacityGiB)
+	maxThroughput := min(int64(gp3MaxThroughput), int64(iops/gp3MaxIOPSPerThroughput))
+
+	switch {
+	case requested < gp3MinThroughput:
+		if !allowIncrease {
+			return 0, fmt.Errorf("%w: throughputPerGiB of %d gives %d MiB/s for %d GiB, gp3 volumes require at least %d MiB/s", ErrInvalidPerformanceRatio, throughputPerGiB, requested, capacityGiB, gp3MinThroughput)
+		}
+		klog.V(5).InfoS("[Debug] Increased gp3 throughput to the min supported limit", "requestedCapacityGiB", capacityGiB, "throughputPerGiB", throughputPerGiB, "limit", gp3MinThroughput)
+		return gp3MinThroughput, nil
+	case requested > maxThroughput:
+		klog.V(5).InfoS("[Debug] Capped gp3 throughput at the max supported limit", "requestedCapacityGiB", capacityGiB, "throughputPerGiB", throughputPerGiB, "iops", iops, "limit", maxThroughput)
+		return int32(maxThroughput), nil
+	}
+	return int32(requested), nil
+}
+
 // Calculate actual IOPS for a volume and cap it at supported AWS limits.
 func capIOPS(volumeType string, requestedCapacityGiB int32, requestedIops int32, minTotalIOPS, maxTotalIOPS, maxIOPSPerGB int32, allowIncrease bool) int32 {
 	// If requestedIops is zero the user did not request a specific amount, and the default will be used instead
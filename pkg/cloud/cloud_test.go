@@ -801,6 +801,62 @@ func TestCreateDisk(t *testing.T) {
 			},
 			expErr: nil,
 		},
+		{
+			name:       "success: gp3 with iopsPerGB and throughputPerGiB",
+			volumeName: "vol-test-name",
+			diskOptions: &DiskOptions{
+				CapacityBytes:    util.GiBToBytes(400),
+				Tags:             map[string]string{VolumeNameTagKey: "vol-test", AwsEbsDriverTagKey: "true"},
+				VolumeType:       VolumeTypeGP3,
+				IOPSPerGB:        10,
+				ThroughputPerGiB: 1,
+			},
+			expDisk: &Disk{
+				VolumeID:         "vol-test",
+				CapacityGiB:      400,
+				AvailabilityZone: defaultZone,
+			},
+			expCreateVolumeInput: &ec2.CreateVolumeInput{
+				Iops:       aws.Int32(4000),
+				Throughput: aws.Int32(400),
+			},
+			expErr: nil,
+		},
+		{
+			name:       "fail: gp3 with throughput and throughputPerGiB",
+			volumeName: "vol-test-name",
+			diskOptions: &DiskOptions{
+				CapacityBytes:    util.GiBToBytes(400),
+				Tags:             map[string]string{VolumeNameTagKey: "vol-test", AwsEbsDriverTagKey: "true"},
+				VolumeType:       VolumeTypeGP3,
+				Throughput:       125,
+				ThroughputPerGiB: 1,
+			},
+			expErr: fmt.Errorf("invalid StorageClass parameters; specify either throughput or throughputPerGiB, not both"),
+		},
+		{
+			name:       "fail: io2 with throughputPerGiB",
+			volumeName: "vol-test-name",
+			diskOptions: &DiskOptions{
+				CapacityBytes:    util.GiBToBytes(400),
+				Tags:             map[string]string{VolumeNameTagKey: "vol-test", AwsEbsDriverTagKey: "true"},
+				VolumeType:       VolumeTypeIO2,
+				IOPS:             3000,
+				ThroughputPerGiB: 1,
+			},
+			expErr: fmt.Errorf("invalid StorageClass parameters; throughputPerGiB is only supported for gp3 volumes"),
+		},
+		{
+			name:       "fail: gp3 with iopsPerGB below the minimum",
+			volumeName: "vol-test-name",
+			diskOptions: &DiskOptions{
+				CapacityBytes: util.GiBToBytes(400),
+				Tags:          map[string]string{VolumeNameTagKey: "vol-test", AwsEbsDriverTagKey: "true"},
+				VolumeType:    VolumeTypeGP3,
+				IOPSPerGB:     5,
+			},
+			expErr: fmt.Errorf("%w: iopsPerGB of 5 gives 2000 IOPS for 400 GiB, gp3 volumes require at least 3000 IOPS", ErrInvalidPerformanceRatio),
+		},
 		{
 			name:       "success: normal with provided zone",
 			volumeName: "vol-test-name",
@@ -1280,6 +1336,221 @@ func TestCreateDisk(t *testing.T) {
 	}
 }
 
+func TestCreateDiskVolumeInitializationRate(t *testing.T) {
+	testCases := []struct {
+		name       string
+		snapshotID string
+		expRate    *int32
+	}{
+		{
+			name:       "rate sent for volumes created from snapshots",
+			snapshotID: "snap-test",
+			expRate:    aws.Int32(200),
+		},
+		{
+			name: "rate ignored without a snapshot",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockEC2 := NewMockEC2API(mockCtrl)
+			c := newCloud(mockEC2)
+
+			mockEC2.EXPECT().CreateVolume(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, input *ec2.CreateVolumeInput, _ ...func(*ec2.Options)) (*ec2.CreateVolumeOutput, error) {
+				if !reflect.DeepEqual(input.VolumeInitializationRate, tc.expRate) {
+					t.Errorf("unexpected VolumeInitializationRate: got %v, want %v", aws.ToInt32(input.VolumeInitializationRate), aws.ToInt32(tc.expRate))
+				}
+				return &ec2.CreateVolumeOutput{VolumeId: aws.String("vol-test"), Size: aws.Int32(1)}, nil
+			})
+			mockEC2.EXPECT().DescribeVolumes(gomock.Any(), gomock.Any()).Return(&ec2.DescribeVolumesOutput{
+				Volumes: []types.Volume{{VolumeId: aws.String("vol-test"), Size: aws.Int32(1), State: types.VolumeStateAvailable}},
+			}, nil).AnyTimes()
+			mockEC2.EXPECT().DescribeSnapshots(gomock.Any(), gomock.Any()).Return(&ec2.DescribeSnapshotsOutput{
+				Snapshots: []types.Snapshot{{SnapshotId: aws.String(tc.snapshotID), State: types.SnapshotStateCompleted}},
+			}, nil).AnyTimes()
+
+			ctx, ctxCancel := context.WithDeadline(context.Background(), time.Now().Add(defaultCreateDiskDeadline))
+			defer ctxCancel()
+			_, err := c.CreateDisk(ctx, "vol-test-name", &DiskOptions{
+				CapacityBytes:            util.GiBToBytes(1),
+				AvailabilityZone:         defaultZone,
+				SnapshotID:               tc.snapshotID,
+				VolumeInitializationRate: 200,
+			})
+			if err != nil {
+				t.Fatalf("CreateDisk() failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestCreateDiskCreationSettings(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockEC2 := NewMockEC2API(mockCtrl)
+	c := newCloud(mockEC2)
+
+	createTime := time.Date(2024, 6, 1, 12, 30, 0, 0, time.UTC)
+	mockEC2.EXPECT().CreateVolume(gomock.Any(), gomock.Any(), gomock.Any()).Return(&ec2.CreateVolumeOutput{
+		VolumeId:   aws.String("vol-test"),
+		Size:       aws.Int32(1),
+		VolumeType: types.VolumeTypeGp3,
+		Iops:       aws.Int32(3000),
+		Throughput: aws.Int32(125),
+		Encrypted:  aws.Bool(true),
+		CreateTime: aws.Time(createTime),
+	}, nil)
+	mockEC2.EXPECT().DescribeVolumes(gomock.Any(), gomock.Any()).Return(&ec2.DescribeVolumesOutput{
+		Volumes: []types.Volume{{VolumeId: aws.String("vol-test"), Size: aws.Int32(1), State: types.VolumeStateAvailable}},
+	}, nil).AnyTimes()
+
+	ctx, ctxCancel := context.WithDeadline(context.Background(), time.Now().Add(defaultCreateDiskDeadline))
+	defer ctxCancel()
+	disk, err := c.CreateDisk(ctx, "vol-test-name", &DiskOptions{
+		CapacityBytes:    util.GiBToBytes(1),
+		AvailabilityZone: defaultZone,
+		VolumeType:       VolumeTypeGP3,
+		Encrypted:        true,
+	})
+	if err != nil {
+		t.Fatalf("CreateDisk() failed: %v", err)
+	}
+	if disk.VolumeType != VolumeTypeGP3 || disk.IOPS != 3000 || disk.Throughput != 125 || !disk.Encrypted || !disk.CreationTime.Equal(createTime) {
+		t.Errorf("CreateDisk() returned unexpected creation settings: %+v", disk)
+	}
+}
+
+func TestCapGP3IOPS(t *testing.T) {
+	testCases := []struct {
+		name          string
+		capacityGiB   int32
+		iopsPerGB     int32
+		allowIncrease bool
+		expIOPS       int32
+		expErr        bool
+	}{
+		{
+			name:        "within limits",
+			capacityGiB: 400,
+			iopsPerGB:   10,
+			expIOPS:     4000,
+		},
+		{
+			name:        "below minimum rejected",
+			capacityGiB: 100,
+			iopsPerGB:   10,
+			expErr:      true,
+		},
+		{
+			name:          "below minimum increased",
+			capacityGiB:   100,
+			iopsPerGB:     10,
+			allowIncrease: true,
+			expIOPS:       3000,
+		},
+		{
+			name:        "above total maximum capped",
+			capacityGiB: 1000,
+			iopsPerGB:   20,
+			expIOPS:     16000,
+		},
+		{
+			name:        "above IOPS per GiB ratio capped",
+			capacityGiB: 10,
+			iopsPerGB:   1000,
+			expIOPS:     5000,
+		},
+		{
+			name:        "baseline allowed for small volumes",
+			capacityGiB: 4,
+			iopsPerGB:   750,
+			expIOPS:     3000,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			iops, err := capGP3IOPS(tc.capacityGiB, tc.iopsPerGB, tc.allowIncrease)
+			if tc.expErr {
+				if !errors.Is(err, ErrInvalidPerformanceRatio) {
+					t.Fatalf("expected ErrInvalidPerformanceRatio, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if iops != tc.expIOPS {
+				t.Errorf("unexpected IOPS: got %d, want %d", iops, tc.expIOPS)
+			}
+		})
+	}
+}
+
+func TestCapGP3Throughput(t *testing.T) {
+	testCases := []struct {
+		name             string
+		capacityGiB      int32
+		throughputPerGiB int32
+		iops             int32
+		allowIncrease    bool
+		expThroughput    int32
+		expErr           bool
+	}{
+		{
+			name:             "within limits",
+			capacityGiB:      400,
+			throughputPerGiB: 1,
+			iops:             4000,
+			expThroughput:    400,
+		},
+		{
+			name:             "below minimum rejected",
+			capacityGiB:      100,
+			throughputPerGiB: 1,
+			expErr:           true,
+		},
+		{
+			name:             "below minimum increased",
+			capacityGiB:      100,
+			throughputPerGiB: 1,
+			allowIncrease:    true,
+			expThroughput:    125,
+		},
+		{
+			name:             "above throughput per IOPS of the baseline capped",
+			capacityGiB:      1000,
+			throughputPerGiB: 1,
+			expThroughput:    750,
+		},
+		{
+			name:             "above maximum capped",
+			capacityGiB:      2000,
+			throughputPerGiB: 1,
+			iops:             16000,
+			expThroughput:    1000,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			throughput, err := capGP3Throughput(tc.capacityGiB, tc.throughputPerGiB, tc.iops, tc.allowIncrease)
+			if tc.expErr {
+				if !errors.Is(err, ErrInvalidPerformanceRatio) {
+					t.Fatalf("expected ErrInvalidPerformanceRatio, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if throughput != tc.expThroughput {
+				t.Errorf("unexpected throughput: got %d, want %d", throughput, tc.expThroughput)
+			}
+		})
+	}
+}
+
 func TestDeleteDisk(t *testing.T) {
 	testCases := []struct {
 		name     string
@@ -1727,6 +1998,8 @@ func TestGetDiskByID(t *testing.T) {
 		availabilityZone string
 		outpostArn       string
 		attachments      []types.VolumeAttachment
+		state            types.VolumeState
+		tags             []types.Tag
 		expDisk          *Disk
 		expErr           error
 	}{
@@ -1741,6 +2014,30 @@ func TestGetDiskByID(t *testing.T) {
 			},
 			expErr: nil,
 		},
+		{
+			name:             "success: volume in error state",
+			volumeID:         "vol-test-1234",
+			availabilityZone: expZone,
+			state:            types.VolumeStateError,
+			expDisk: &Disk{
+				VolumeID:         "vol-test-1234",
+				AvailabilityZone: expZone,
+				State:            "error",
+			},
+			expErr: nil,
+		},
+		{
+			name:             "success: tags",
+			volumeID:         "vol-test-1234",
+			availabilityZone: expZone,
+			tags:             []types.Tag{{Key: aws.String("ebs.csi.aws.com/snapshot-on-delete"), Value: aws.String("true")}},
+			expDisk: &Disk{
+				VolumeID:         "vol-test-1234",
+				AvailabilityZone: expZone,
+				Tags:             map[string]string{"ebs.csi.aws.com/snapshot-on-delete": "true"},
+			},
+			expErr: nil,
+		},
 		{
 			name:             "success: outpost volume",
 			volumeID:         "vol-test-1234",
@@ -1796,6 +2093,8 @@ func TestGetDiskByID(t *testing.T) {
 							AvailabilityZone: aws.String(tc.availabilityZone),
 							OutpostArn:       aws.String(tc.outpostArn),
 							Attachments:      tc.attachments,
+							State:            tc.state,
+							Tags:             tc.tags,
 						},
 					},
 				},
@@ -1826,6 +2125,12 @@ func TestGetDiskByID(t *testing.T) {
 				if len(disk.Attachments) != len(tc.expDisk.Attachments) {
 					t.Fatalf("GetDiskByID() failed: expected attachments length %d, got %d", len(tc.expDisk.Attachments), len(disk.Attachments))
 				}
+				if disk.State != tc.expDisk.State {
+					t.Fatalf("GetDiskByID() failed: expected state %q, got %q", tc.expDisk.State, disk.State)
+				}
+				if !reflect.DeepEqual(disk.Tags, tc.expDisk.Tags) {
+					t.Fatalf("GetDiskByID() failed: expected tags %v, got %v", tc.expDisk.Tags, disk.Tags)
+				}
 			}
 
 			mockCtrl.Finish()
@@ -1859,6 +2164,23 @@ func TestCreateSnapshot(t *testing.T) {
 			},
 			expErr: nil,
 		},
+		{
+			name:         "success: description",
+			snapshotName: "snap-test-name",
+			snapshotOptions: &SnapshotOptions{
+				Tags: map[string]string{
+					AwsEbsDriverTagKey: "true",
+				},
+				Description: "pre-expand-snap-test-volume",
+			},
+			expSnapshot: &Snapshot{
+				SnapshotID:     "snap-test-name",
+				SourceVolumeID: "snap-test-volume",
+				Size:           10,
+				ReadyToUse:     true,
+			},
+			expErr: nil,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -1868,14 +2190,18 @@ func TestCreateSnapshot(t *testing.T) {
 			c := newCloud(mockEC2)
 
 			ctx := context.Background()
+			expDescription := tc.snapshotOptions.Description
+			if expDescription == "" {
+				expDescription = "Created by AWS EBS CSI driver for volume " + tc.expSnapshot.SourceVolumeID
+			}
 
 			mockEC2.EXPECT().CreateSnapshot(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
 				func(ctx context.Context, input *ec2.CreateSnapshotInput, optFns ...func(*ec2.Options)) (*ec2.CreateSnapshotOutput, error) {
 					if input.VolumeId == nil || *input.VolumeId != tc.expSnapshot.SourceVolumeID {
 						t.Errorf("Unexpected VolumeId. Expected: %s, Actual: %s", tc.expSnapshot.SourceVolumeID, aws.ToString(input.VolumeId))
 					}
-					if input.Description == nil || *input.Description != "Created by AWS EBS CSI driver for volume "+tc.expSnapshot.SourceVolumeID {
-						t.Errorf("Unexpected Description. Expected: %s, Actual: %s", "Created by AWS EBS CSI driver for volume "+tc.expSnapshot.SourceVolumeID, aws.ToString(input.Description))
+					if input.Description == nil || *input.Description != expDescription {
+						t.Errorf("Unexpected Description. Expected: %s, Actual: %s", expDescription, aws.ToString(input.Description))
 					}
 					if len(input.TagSpecifications) != 1 {
 						t.Errorf("Unexpected number of TagSpecifications. Expected: 1, Actual: %d", len(input.TagSpecifications))
@@ -1969,6 +2295,32 @@ func TestEnableFastSnapshotRestores(t *testing.T) {
 			},
 			expErr: fmt.Errorf("failed to create fast snapshot restores for snapshot"),
 		},
+		{
+			name:              "fail: partial success",
+			snapshotID:        "snap-test-id",
+			availabilityZones: []string{"us-west-2a", "us-west-2b"},
+			expOutput: &ec2.EnableFastSnapshotRestoresOutput{
+				Successful: []types.EnableFastSnapshotRestoreSuccessItem{{
+					AvailabilityZone: aws.String("us-west-2a"),
+					SnapshotId:       aws.String("snap-test-id")}},
+				Unsuccessful: []types.EnableFastSnapshotRestoreErrorItem{{
+					SnapshotId: aws.String("snap-test-id"),
+					FastSnapshotRestoreStateErrors: []types.EnableFastSnapshotRestoreStateErrorItem{
+						{AvailabilityZone: aws.String("us-west-2b"),
+							Error: &types.EnableFastSnapshotRestoreStateError{
+								Message: aws.String("failed to create fast snapshot restore")}},
+					},
+				}},
+			},
+			expErr: fmt.Errorf("failed to create fast snapshot restores for snapshot"),
+		},
+		{
+			name:              "fail: quota error",
+			snapshotID:        "snap-test-id",
+			availabilityZones: []string{"us-west-2a"},
+			expOutput:         nil,
+			expErr:            fmt.Errorf("ConcurrentSnapshotLimitExceeded: fast snapshot restore quota reached"),
+		},
 		{
 			name:              "fail: error",
 			snapshotID:        "",
@@ -2017,80 +2369,339 @@ func TestEnableFastSnapshotRestores(t *testing.T) {
 	}
 }
 
-func TestAvailabilityZones(t *testing.T) {
+func TestFastSnapshotRestoreZones(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockEC2 := NewMockEC2API(mockCtrl)
+	c := newCloud(mockEC2)
+
+	fsr := func(zone string, state types.FastSnapshotRestoreStateCode) types.DescribeFastSnapshotRestoreSuccessItem {
+		return types.DescribeFastSnapshotRestoreSuccessItem{SnapshotId: aws.String("snap-test-id"), AvailabilityZone: aws.String(zone), State: state}
+	}
+	gomock.InOrder(
+		mockEC2.EXPECT().DescribeFastSnapshotRestores(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, input *ec2.DescribeFastSnapshotRestoresInput, _ ...func(*ec2.Options)) (*ec2.DescribeFastSnapshotRestoresOutput, error) {
+				if len(input.Filters) != 1 || aws.ToString(input.Filters[0].Name) != "snapshot-id" || !reflect.DeepEqual(input.Filters[0].Values, []string{"snap-test-id"}) {
+					t.Errorf("unexpected filters %+v", input.Filters)
+				}
+				return &ec2.DescribeFastSnapshotRestoresOutput{
+					FastSnapshotRestores: []types.DescribeFastSnapshotRestoreSuccessItem{
+						fsr("us-west-2a", types.FastSnapshotRestoreStateCodeEnabled),
+						fsr("us-west-2b", types.FastSnapshotRestoreStateCodeDisabling),
+					},
+					NextToken: aws.String("token"),
+				}, nil
+			}),
+		mockEC2.EXPECT().DescribeFastSnapshotRestores(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, input *ec2.DescribeFastSnapshotRestoresInput, _ ...func(*ec2.Options)) (*ec2.DescribeFastSnapshotRestoresOutput, error) {
+				if aws.ToString(input.NextToken) != "token" {
+					t.Errorf("expected the next page to be requested, got token %q", aws.ToString(input.NextToken))
+				}
+				return &ec2.DescribeFastSnapshotRestoresOutput{
+					FastSnapshotRestores: []types.DescribeFastSnapshotRestoreSuccessItem{
+						fsr("us-west-2c", types.FastSnapshotRestoreStateCodeEnabling),
+						fsr("us-west-2d", types.FastSnapshotRestoreStateCodeOptimizing),
+						fsr("us-west-2e", types.FastSnapshotRestoreStateCodeDisabled),
+					},
+				}, nil
+			}),
+	)
+
+	zones, err := c.FastSnapshotRestoreZones(context.Background(), "snap-test-id")
+	if err != nil {
+		t.Fatalf("FastSnapshotRestoreZones() failed: %v", err)
+	}
+	if expected := []string{"us-west-2a", "us-west-2c", "us-west-2d"}; !reflect.DeepEqual(zones, expected) {
+		t.Fatalf("FastSnapshotRestoreZones() = %v, want %v", zones, expected)
+	}
+}
+
+func TestCopySnapshotToRegion(t *testing.T) {
+	existingCopy := types.Snapshot{
+		SnapshotId: aws.String("snap-copy"),
+		VolumeId:   aws.String("vol-ffffffff"),
+		VolumeSize: aws.Int32(1),
+		StartTime:  aws.Time(time.Now()),
+		State:      types.SnapshotStateCompleted,
+	}
+
 	testCases := []struct {
-		name             string
-		availabilityZone string
-		expOutput        *ec2.DescribeAvailabilityZonesOutput
-		expErr           error
+		name           string
+		existingCopies []types.Snapshot
+		copyErr        error
+		expectCopy     bool
+		expSnapshot    *Snapshot
+		expErr         error
 	}{
 		{
-			name:             "success: normal",
-			availabilityZone: expZone,
-			expOutput: &ec2.DescribeAvailabilityZonesOutput{
-				AvailabilityZones: []types.AvailabilityZone{
-					{ZoneName: aws.String(expZone)},
-				}},
-			expErr: nil,
+			name:        "success: copied",
+			expectCopy:  true,
+			expSnapshot: &Snapshot{SnapshotID: "snap-new"},
 		},
 		{
-			name:             "fail: error",
-			availabilityZone: "",
-			expOutput:        nil,
-			expErr:           fmt.Errorf("TestAvailabilityZones error"),
+			name:           "success: already copied",
+			existingCopies: []types.Snapshot{existingCopy},
+			expSnapshot:    &Snapshot{SnapshotID: "snap-copy", SourceVolumeID: "vol-ffffffff", Size: 1, ReadyToUse: true},
+		},
+		{
+			name:       "fail: source snapshot not found",
+			expectCopy: true,
+			copyErr:    &smithy.GenericAPIError{Code: "InvalidSnapshot.NotFound"},
+			expErr:     ErrNotFound,
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			// The snapshot is only looked up and copied with the client of the target region
 			mockEC2 := NewMockEC2API(mockCtrl)
-			c := newCloud(mockEC2)
-
-			ctx := context.Background()
-			mockEC2.EXPECT().DescribeAvailabilityZones(gomock.Any(), gomock.Any()).Return(tc.expOutput, tc.expErr).AnyTimes()
-
-			az, err := c.AvailabilityZones(ctx)
-			if err != nil {
-				if tc.expErr == nil {
-					t.Fatalf("AvailabilityZones() failed: expected no error, got: %v", err)
-				}
-			} else {
-				if tc.expErr != nil {
-					t.Fatalf("AvailabilityZones() failed: expected error, got nothing")
+			regionalEC2 := NewMockEC2API(mockCtrl)
+			c := newCloud(mockEC2).(*cloud)
+			c.newRegionalEC2 = func(region string) EC2API {
+				if region != "us-east-1" {
+					t.Errorf("Unexpected client for region %s", region)
 				}
-				if val, ok := az[tc.availabilityZone]; !ok {
-					t.Fatalf("AvailabilityZones() failed: expected to find %s, got %v", tc.availabilityZone, val)
+				return regionalEC2
+			}
+
+			regionalEC2.EXPECT().DescribeSnapshots(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, input *ec2.DescribeSnapshotsInput, _ ...func(*ec2.Options)) (*ec2.DescribeSnapshotsOutput, error) {
+				if !reflect.DeepEqual(input.Filters[0].Values, []string{"snap-test"}) || aws.ToString(input.Filters[0].Name) != "tag:"+SourceSnapshotIDTagKey {
+					t.Errorf("Unexpected DescribeSnapshots input: %+v", input)
 				}
+				return &ec2.DescribeSnapshotsOutput{Snapshots: tc.existingCopies}, nil
+			})
+			if tc.expectCopy {
+				regionalEC2.EXPECT().CopySnapshot(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, input *ec2.CopySnapshotInput, _ ...func(*ec2.Options)) (*ec2.CopySnapshotOutput, error) {
+					if aws.ToString(input.SourceRegion) != "test-region" || aws.ToString(input.SourceSnapshotId) != "snap-test" {
+						t.Errorf("Unexpected CopySnapshot input: %+v", input)
+					}
+					expectedTags := []types.Tag{
+						{Key: aws.String(SourceSnapshotIDTagKey), Value: aws.String("snap-test")},
+						{Key: aws.String("extra"), Value: aws.String("tag")},
+					}
+					if !reflect.DeepEqual(input.TagSpecifications[0].Tags, expectedTags) {
+						t.Errorf("Unexpected copy tags: %+v", input.TagSpecifications[0].Tags)
+					}
+					if tc.copyErr != nil {
+						return nil, tc.copyErr
+					}
+					return &ec2.CopySnapshotOutput{SnapshotId: aws.String("snap-new")}, nil
+				})
 			}
 
-			mockCtrl.Finish()
+			snapshot, err := c.CopySnapshotToRegion(context.Background(), "snap-test", "us-east-1", map[string]string{"extra": "tag"})
+			if !errors.Is(err, tc.expErr) {
+				t.Fatalf("CopySnapshotToRegion() failed: expected error %v, got: %v", tc.expErr, err)
+			}
+			if snapshot != nil {
+				snapshot.CreationTime = time.Time{}
+				snapshot.Tags = nil
+			}
+			if !reflect.DeepEqual(snapshot, tc.expSnapshot) {
+				t.Fatalf("Expected snapshot %+v, got %+v", tc.expSnapshot, snapshot)
+			}
 		})
 	}
 }
 
-func TestDeleteSnapshot(t *testing.T) {
+func TestDeleteSnapshotCopies(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockEC2 := NewMockEC2API(mockCtrl)
+	regionalEC2 := NewMockEC2API(mockCtrl)
+	c := newCloud(mockEC2).(*cloud)
+	c.regionalEC2 = map[string]EC2API{"us-east-1": regionalEC2}
+
+	regionalEC2.EXPECT().DescribeSnapshots(gomock.Any(), gomock.Any()).Return(&ec2.DescribeSnapshotsOutput{
+		Snapshots: []types.Snapshot{{SnapshotId: aws.String("snap-copy-1")}, {SnapshotId: aws.String("snap-copy-2")}},
+	}, nil)
+	regionalEC2.EXPECT().DeleteSnapshot(gomock.Any(), &ec2.DeleteSnapshotInput{SnapshotId: aws.String("snap-copy-1")}).Return(&ec2.DeleteSnapshotOutput{}, nil)
+	// A copy deleted meanwhile is ignored
+	regionalEC2.EXPECT().DeleteSnapshot(gomock.Any(), &ec2.DeleteSnapshotInput{SnapshotId: aws.String("snap-copy-2")}).Return(nil, &smithy.GenericAPIError{Code: "InvalidSnapshot.NotFound"})
+
+	if err := c.DeleteSnapshotCopies(context.Background(), "snap-test", "us-east-1"); err != nil {
+		t.Fatalf("DeleteSnapshotCopies() failed: %v", err)
+	}
+}
+
+func TestGetInstanceTypeInfo(t *testing.T) {
 	testCases := []struct {
 		name         string
-		snapshotName string
+		expOutput    *ec2.DescribeInstanceTypesOutput
 		expErr       error
+		expectedInfo *InstanceTypeInfo
 	}{
 		{
-			name:         "success: normal",
-			snapshotName: "snap-test-name",
-			expErr:       nil,
+			name: "success: nitro with nvme instance store",
+			expOutput: &ec2.DescribeInstanceTypesOutput{
+				InstanceTypes: []types.InstanceTypeInfo{
+					{
+						Hypervisor: types.InstanceTypeHypervisorNitro,
+						InstanceStorageInfo: &types.InstanceStorageInfo{
+							NvmeSupport: types.EphemeralNvmeSupportRequired,
+							Disks:       []types.DiskInfo{{Count: aws.Int32(2)}},
+						},
+					},
+				},
+			},
+			expectedInfo: &InstanceTypeInfo{Nitro: true, NVMeInstanceStoreVolumes: 2},
 		},
 		{
-			name:         "fail: delete snapshot return generic error",
-			snapshotName: "snap-test-name",
-			expErr:       fmt.Errorf("DeleteSnapshot generic error"),
+			name: "success: xen with non-nvme instance store",
+			expOutput: &ec2.DescribeInstanceTypesOutput{
+				InstanceTypes: []types.InstanceTypeInfo{
+					{
+						Hypervisor: types.InstanceTypeHypervisorXen,
+						InstanceStorageInfo: &types.InstanceStorageInfo{
+							NvmeSupport: types.EphemeralNvmeSupportUnsupported,
+							Disks:       []types.DiskInfo{{Count: aws.Int32(2)}},
+						},
+					},
+				},
+			},
+			expectedInfo: &InstanceTypeInfo{Nitro: false},
 		},
 		{
-			name:         "fail: delete snapshot return not found error",
-			snapshotName: "snap-test-name",
-			expErr: &smithy.GenericAPIError{
-				Code:    "InvalidSnapshot.NotFound",
-				Message: "",
+			name: "success: bare metal",
+			expOutput: &ec2.DescribeInstanceTypesOutput{
+				InstanceTypes: []types.InstanceTypeInfo{
+					{BareMetal: aws.Bool(true)},
+				},
+			},
+			expectedInfo: &InstanceTypeInfo{Nitro: true},
+		},
+		{
+			name:      "fail: instance type not found",
+			expOutput: &ec2.DescribeInstanceTypesOutput{},
+		},
+		{
+			name:   "fail: error",
+			expErr: fmt.Errorf("TestGetInstanceTypeInfo error"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockEC2 := NewMockEC2API(mockCtrl)
+			c := newCloud(mockEC2)
+
+			mockEC2.EXPECT().DescribeInstanceTypes(gomock.Any(), &ec2.DescribeInstanceTypesInput{
+				InstanceTypes: []types.InstanceType{"m8gd.large"},
+			}).Return(tc.expOutput, tc.expErr)
+
+			info, err := c.GetInstanceTypeInfo(context.Background(), "m8gd.large")
+			if tc.expectedInfo == nil {
+				if err == nil {
+					t.Fatalf("GetInstanceTypeInfo() failed: expected error, got nothing")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("GetInstanceTypeInfo() failed: expected no error, got: %v", err)
+				}
+				if !reflect.DeepEqual(info, tc.expectedInfo) {
+					t.Fatalf("GetInstanceTypeInfo() failed: expected %+v, got %+v", tc.expectedInfo, info)
+				}
+			}
+
+			mockCtrl.Finish()
+		})
+	}
+}
+
+func TestIsKnownInstanceType(t *testing.T) {
+	testCases := map[string]bool{
+		"t2.medium":     true,  // non-Nitro family
+		"m7i.large":     true,  // dedicated volume limit family
+		"m5d.large":     true,  // NVMe instance store family
+		"m5.large":      true,  // EBS-only counterpart of an NVMe instance store family
+		"u-12tb1.metal": true,  // high memory instance
+		"m8g.large":     false, // family not covered by the tables
+	}
+
+	for instanceType, expected := range testCases {
+		if known := IsKnownInstanceType(instanceType); known != expected {
+			t.Errorf("IsKnownInstanceType(%q) = %v, want %v", instanceType, known, expected)
+		}
+	}
+}
+
+func TestAvailabilityZones(t *testing.T) {
+	testCases := []struct {
+		name             string
+		availabilityZone string
+		expOutput        *ec2.DescribeAvailabilityZonesOutput
+		expErr           error
+	}{
+		{
+			name:             "success: normal",
+			availabilityZone: expZone,
+			expOutput: &ec2.DescribeAvailabilityZonesOutput{
+				AvailabilityZones: []types.AvailabilityZone{
+					{ZoneName: aws.String(expZone)},
+				}},
+			expErr: nil,
+		},
+		{
+			name:             "fail: error",
+			availabilityZone: "",
+			expOutput:        nil,
+			expErr:           fmt.Errorf("TestAvailabilityZones error"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockEC2 := NewMockEC2API(mockCtrl)
+			c := newCloud(mockEC2)
+
+			ctx := context.Background()
+			mockEC2.EXPECT().DescribeAvailabilityZones(gomock.Any(), gomock.Any()).Return(tc.expOutput, tc.expErr).AnyTimes()
+
+			az, err := c.AvailabilityZones(ctx)
+			if err != nil {
+				if tc.expErr == nil {
+					t.Fatalf("AvailabilityZones() failed: expected no error, got: %v", err)
+				}
+			} else {
+				if tc.expErr != nil {
+					t.Fatalf("AvailabilityZones() failed: expected error, got nothing")
+				}
+				if val, ok := az[tc.availabilityZone]; !ok {
+					t.Fatalf("AvailabilityZones() failed: expected to find %s, got %v", tc.availabilityZone, val)
+				}
+			}
+
+			mockCtrl.Finish()
+		})
+	}
+}
+
+func TestDeleteSnapshot(t *testing.T) {
+	testCases := []struct {
+		name         string
+		snapshotName string
+		expErr       error
+	}{
+		{
+			name:         "success: normal",
+			snapshotName: "snap-test-name",
+			expErr:       nil,
+		},
+		{
+			name:         "fail: delete snapshot return generic error",
+			snapshotName: "snap-test-name",
+			expErr:       fmt.Errorf("DeleteSnapshot generic error"),
+		},
+		{
+			name:         "fail: delete snapshot return not found error",
+			snapshotName: "snap-test-name",
+			expErr: &smithy.GenericAPIError{
+				Code:    "InvalidSnapshot.NotFound",
+				Message: "",
 			},
 		},
 	}
@@ -2459,6 +3070,783 @@ func TestResizeOrModifyDisk(t *testing.T) {
 	}
 }
 
+func TestCountNonCSIVolumeAttachments(t *testing.T) {
+	attachedAt := func(device string) []types.VolumeAttachment {
+		return []types.VolumeAttachment{{InstanceId: aws.String("i-test"), Device: aws.String(device), State: types.VolumeAttachmentStateAttached}}
+	}
+	testCases := []struct {
+		name          string
+		volumes       []types.Volume
+		describeErr   error
+		expectedCount int
+		expErr        bool
+	}{
+		{
+			name: "success: root volume only",
+			volumes: []types.Volume{
+				{VolumeId: aws.String("vol-root"), Attachments: attachedAt("/dev/xvda")},
+			},
+			expectedCount: 1,
+		},
+		{
+			name: "success: launch template data volumes",
+			volumes: []types.Volume{
+				{VolumeId: aws.String("vol-root"), Attachments: attachedAt("/dev/xvda")},
+				{VolumeId: aws.String("vol-data1"), Attachments: attachedAt("/dev/xvdb")},
+				{VolumeId: aws.String("vol-data2"), Attachments: attachedAt("/dev/sdf")},
+			},
+			expectedCount: 3,
+		},
+		{
+			name: "success: dynamically provisioned volumes excluded by tag",
+			volumes: []types.Volume{
+				{VolumeId: aws.String("vol-root"), Attachments: attachedAt("/dev/xvda")},
+				{VolumeId: aws.String("vol-csi1"), Attachments: attachedAt("/dev/xvdaa"), Tags: []types.Tag{{Key: aws.String(VolumeNameTagKey), Value: aws.String("pvc-1")}}},
+				{VolumeId: aws.String("vol-csi2"), Attachments: attachedAt("/dev/sdf"), Tags: []types.Tag{{Key: aws.String(AwsEbsDriverTagKey), Value: aws.String("true")}}},
+			},
+			expectedCount: 1,
+		},
+		{
+			name: "success: statically provisioned volume excluded by device name",
+			volumes: []types.Volume{
+				{VolumeId: aws.String("vol-root"), Attachments: attachedAt("/dev/xvda")},
+				{VolumeId: aws.String("vol-static"), Attachments: attachedAt("/dev/xvdba")},
+			},
+			expectedCount: 1,
+		},
+		{
+			name:        "fail: DescribeVolumes error",
+			describeErr: errors.New("UnauthorizedOperation"),
+			expErr:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockEC2 := NewMockEC2API(mockCtrl)
+			c := newCloud(mockEC2)
+
+			mockEC2.EXPECT().DescribeVolumes(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, input *ec2.DescribeVolumesInput, _ ...func(*ec2.Options)) (*ec2.DescribeVolumesOutput, error) {
+				if len(input.Filters) != 1 || aws.ToString(input.Filters[0].Name) != "attachment.instance-id" || !reflect.DeepEqual(input.Filters[0].Values, []string{"i-test"}) {
+					t.Errorf("Unexpected DescribeVolumes filters: %+v", input.Filters)
+				}
+				if tc.describeErr != nil {
+					return nil, tc.describeErr
+				}
+				return &ec2.DescribeVolumesOutput{Volumes: tc.volumes}, nil
+			})
+
+			count, err := c.CountNonCSIVolumeAttachments(context.Background(), "i-test")
+			if (err != nil) != tc.expErr {
+				t.Fatalf("CountNonCSIVolumeAttachments() failed: expected error %v, got: %v", tc.expErr, err)
+			}
+			if count != tc.expectedCount {
+				t.Fatalf("CountNonCSIVolumeAttachments() failed: expected count %d, got %d", tc.expectedCount, count)
+			}
+
+			mockCtrl.Finish()
+		})
+	}
+}
+
+func TestListDiskParameters(t *testing.T) {
+	testCases := []struct {
+		name          string
+		tags          map[string]string
+		volumes       []types.Volume
+		describeErr   error
+		expectedDisks []*DiskParameters
+		expErr        bool
+	}{
+		{
+			name: "success: settings and tags",
+			volumes: []types.Volume{
+				{
+					VolumeId:   aws.String("vol-test"),
+					VolumeType: types.VolumeTypeGp3,
+					Iops:       aws.Int32(4000),
+					Throughput: aws.Int32(250),
+					Tags:       []types.Tag{{Key: aws.String("provisioned-type"), Value: aws.String("gp3")}},
+				},
+				{
+					VolumeId:   aws.String("vol-gp2"),
+					VolumeType: types.VolumeTypeGp2,
+					Iops:       aws.Int32(300),
+					Tags:       []types.Tag{{Key: aws.String("provisioned-type"), Value: aws.String("gp2")}},
+				},
+			},
+			expectedDisks: []*DiskParameters{
+				{VolumeID: "vol-test", VolumeType: VolumeTypeGP3, IOPS: 4000, Throughput: 250, Tags: map[string]string{"provisioned-type": "gp3"}},
+				{VolumeID: "vol-gp2", VolumeType: VolumeTypeGP2, IOPS: 300, Tags: map[string]string{"provisioned-type": "gp2"}},
+			},
+		},
+		{
+			name:          "success: filtered by tags",
+			tags:          map[string]string{"kubernetes.io/cluster/test": "owned"},
+			expectedDisks: []*DiskParameters{},
+		},
+		{
+			name:          "success: no volumes",
+			expectedDisks: []*DiskParameters{},
+		},
+		{
+			name:        "fail: DescribeVolumes error",
+			describeErr: errors.New("UnauthorizedOperation"),
+			expErr:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockEC2 := NewMockEC2API(mockCtrl)
+			c := newCloud(mockEC2)
+
+			mockEC2.EXPECT().DescribeVolumes(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, input *ec2.DescribeVolumesInput, _ ...func(*ec2.Options)) (*ec2.DescribeVolumesOutput, error) {
+				if len(input.Filters) != 1+len(tc.tags) || aws.ToString(input.Filters[0].Name) != "tag-key" || !reflect.DeepEqual(input.Filters[0].Values, []string{"provisioned-type"}) {
+					t.Errorf("Unexpected DescribeVolumes filters: %+v", input.Filters)
+				}
+				for _, filter := range input.Filters[1:] {
+					key := strings.TrimPrefix(aws.ToString(filter.Name), "tag:")
+					if value, ok := tc.tags[key]; !ok || !reflect.DeepEqual(filter.Values, []string{value}) {
+						t.Errorf("Unexpected DescribeVolumes tag filter: %+v", filter)
+					}
+				}
+				if tc.describeErr != nil {
+					return nil, tc.describeErr
+				}
+				return &ec2.DescribeVolumesOutput{Volumes: tc.volumes}, nil
+			})
+
+			disks, err := c.ListDiskParameters(context.Background(), "provisioned-type", tc.tags)
+			if (err != nil) != tc.expErr {
+				t.Fatalf("ListDiskParameters() failed: expected error %v, got: %v", tc.expErr, err)
+			}
+			if !tc.expErr && !reflect.DeepEqual(disks, tc.expectedDisks) {
+				t.Fatalf("ListDiskParameters() failed: expected disks %+v, got %+v", tc.expectedDisks, disks)
+			}
+
+			mockCtrl.Finish()
+		})
+	}
+}
+
+func TestListSnapshotsByTag(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockEC2 := NewMockEC2API(mockCtrl)
+	c := newCloud(mockEC2)
+
+	mockEC2.EXPECT().DescribeSnapshots(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, input *ec2.DescribeSnapshotsInput, _ ...func(*ec2.Options)) (*ec2.DescribeSnapshotsOutput, error) {
+		if !reflect.DeepEqual(input.OwnerIds, []string{"self"}) || len(input.Filters) != 1 || aws.ToString(input.Filters[0].Name) != "tag-key" || !reflect.DeepEqual(input.Filters[0].Values, []string{"copy-to-regions"}) {
+			t.Errorf("Unexpected DescribeSnapshots input: %+v", input)
+		}
+		return &ec2.DescribeSnapshotsOutput{Snapshots: []types.Snapshot{{
+			SnapshotId: aws.String("snap-test"),
+			VolumeId:   aws.String("vol-test"),
+			VolumeSize: aws.Int32(10),
+			StartTime:  aws.Time(time.Now()),
+			State:      types.SnapshotStateCompleted,
+			Tags:       []types.Tag{{Key: aws.String("copy-to-regions"), Value: aws.String("us-east-1")}},
+		}}}, nil
+	})
+
+	snapshots, err := c.ListSnapshotsByTag(context.Background(), "copy-to-regions")
+	if err != nil {
+		t.Fatalf("ListSnapshotsByTag() failed: %v", err)
+	}
+	if len(snapshots) != 1 || snapshots[0].SnapshotID != "snap-test" || !snapshots[0].ReadyToUse || snapshots[0].Tags["copy-to-regions"] != "us-east-1" {
+		t.Fatalf("ListSnapshotsByTag() returned unexpected snapshots %+v", snapshots)
+	}
+}
+
+func TestListDisks(t *testing.T) {
+	invalidTokenErr := &smithy.GenericAPIError{Code: "InvalidParameterValue", Message: "Invalid value 'bad' for nextToken"}
+	testCases := []struct {
+		name              string
+		maxResults        int32
+		nextToken         string
+		volumes           []types.Volume
+		responseToken     string
+		describeErr       error
+		expectDescribe    bool
+		expectedMaxResult *int32
+		expectedResponse  *ListDisksResponse
+		expectedErr       error
+	}{
+		{
+			name:       "success: first page",
+			maxResults: 5,
+			volumes: []types.Volume{
+				{
+					VolumeId: aws.String("vol-attached"),
+					Size:     aws.Int32(10),
+					State:    types.VolumeStateInUse,
+					Attachments: []types.VolumeAttachment{
+						{InstanceId: aws.String("i-attached"), State: types.VolumeAttachmentStateAttached},
+						{InstanceId: aws.String("i-detaching"), State: types.VolumeAttachmentStateDetaching},
+					},
+				},
+				{VolumeId: aws.String("vol-available"), Size: aws.Int32(20), State: types.VolumeStateAvailable},
+			},
+			responseToken:     "token-2",
+			expectDescribe:    true,
+			expectedMaxResult: aws.Int32(5),
+			expectedResponse: &ListDisksResponse{
+				Disks: []*Disk{
+					{VolumeID: "vol-attached", CapacityGiB: 10, State: "in-use", Attachments: []string{"i-attached"}},
+					{VolumeID: "vol-available", CapacityGiB: 20, State: "available"},
+				},
+				NextToken: "token-2",
+			},
+		},
+		{
+			name:             "success: last page without MaxResults",
+			nextToken:        "token-2",
+			expectDescribe:   true,
+			expectedResponse: &ListDisksResponse{Disks: []*Disk{}},
+		},
+		{
+			name:              "success: MaxResults lowered to the EC2 maximum",
+			maxResults:        1000,
+			expectDescribe:    true,
+			expectedMaxResult: aws.Int32(500),
+			expectedResponse:  &ListDisksResponse{Disks: []*Disk{}},
+		},
+		{
+			name:        "fail: MaxResults below the EC2 minimum",
+			maxResults:  4,
+			expectedErr: ErrInvalidMaxResults,
+		},
+		{
+			name:           "fail: invalid NextToken",
+			nextToken:      "bad",
+			describeErr:    invalidTokenErr,
+			expectDescribe: true,
+			expectedErr:    ErrInvalidNextToken,
+		},
+		{
+			name:           "fail: DescribeVolumes error",
+			describeErr:    invalidTokenErr,
+			expectDescribe: true,
+			expectedErr:    invalidTokenErr,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockEC2 := NewMockEC2API(mockCtrl)
+			c := newCloud(mockEC2)
+
+			if tc.expectDescribe {
+				mockEC2.EXPECT().DescribeVolumes(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, input *ec2.DescribeVolumesInput, _ ...func(*ec2.Options)) (*ec2.DescribeVolumesOutput, error) {
+					if len(input.Filters) != 1 || aws.ToString(input.Filters[0].Name) != "tag-key" || !reflect.DeepEqual(input.Filters[0].Values, []string{AwsEbsDriverTagKey}) {
+						t.Errorf("Unexpected DescribeVolumes filters: %+v", input.Filters)
+					}
+					if !reflect.DeepEqual(input.MaxResults, tc.expectedMaxResult) {
+						t.Errorf("Unexpected MaxResults: got %v, want %v", aws.ToInt32(input.MaxResults), aws.ToInt32(tc.expectedMaxResult))
+					}
+					if aws.ToString(input.NextToken) != tc.nextToken {
+						t.Errorf("Unexpected NextToken: got %q, want %q", aws.ToString(input.NextToken), tc.nextToken)
+					}
+					if tc.describeErr != nil {
+						return nil, tc.describeErr
+					}
+					return &ec2.DescribeVolumesOutput{Volumes: tc.volumes, NextToken: aws.String(tc.responseToken)}, nil
+				})
+			}
+
+			response, err := c.ListDisks(context.Background(), AwsEbsDriverTagKey, tc.maxResults, tc.nextToken)
+			if tc.expectedErr != nil {
+				if !errors.Is(err, tc.expectedErr) {
+					t.Fatalf("ListDisks() failed: expected error %v, got: %v", tc.expectedErr, err)
+				}
+				if tc.nextToken == "" && errors.Is(err, ErrInvalidNextToken) {
+					t.Fatalf("ListDisks() failed: error without NextToken reported as invalid NextToken: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ListDisks() failed: unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(response, tc.expectedResponse) {
+				t.Fatalf("ListDisks() failed: expected %+v, got %+v", tc.expectedResponse, response)
+			}
+		})
+	}
+}
+
+func TestTagDisk(t *testing.T) {
+	testCases := []struct {
+		name      string
+		createErr error
+		expErr    bool
+	}{
+		{
+			name: "success",
+		},
+		{
+			name:      "fail: CreateTags error",
+			createErr: errors.New("UnauthorizedOperation"),
+			expErr:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockEC2 := NewMockEC2API(mockCtrl)
+			c := newCloud(mockEC2)
+
+			mockEC2.EXPECT().CreateTags(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, input *ec2.CreateTagsInput, _ ...func(*ec2.Options)) (*ec2.CreateTagsOutput, error) {
+				expectedTags := []types.Tag{{Key: aws.String("provisioned-iops"), Value: aws.String("3000")}}
+				if !reflect.DeepEqual(input.Resources, []string{"vol-test"}) || !reflect.DeepEqual(input.Tags, expectedTags) {
+					t.Errorf("Unexpected CreateTags input: %+v", input)
+				}
+				return &ec2.CreateTagsOutput{}, tc.createErr
+			})
+
+			err := c.TagDisk(context.Background(), "vol-test", map[string]string{"provisioned-iops": "3000"})
+			if (err != nil) != tc.expErr {
+				t.Fatalf("TagDisk() failed: expected error %v, got: %v", tc.expErr, err)
+			}
+
+			mockCtrl.Finish()
+		})
+	}
+}
+
+func TestModifyTags(t *testing.T) {
+	testCases := []struct {
+		name       string
+		tagOptions ModifyTagsOptions
+		createErr  error
+		deleteErr  error
+		expCreate  bool
+		expDelete  bool
+		expErr     bool
+	}{
+		{
+			name:       "success: add and delete",
+			tagOptions: ModifyTagsOptions{TagsToAdd: map[string]string{"billing": "team-a"}, TagsToDelete: []string{"owner"}},
+			expCreate:  true,
+			expDelete:  true,
+		},
+		{
+			name:       "success: delete only",
+			tagOptions: ModifyTagsOptions{TagsToDelete: []string{"owner"}},
+			expDelete:  true,
+		},
+		{
+			name:       "fail: CreateTags error",
+			tagOptions: ModifyTagsOptions{TagsToAdd: map[string]string{"billing": "team-a"}, TagsToDelete: []string{"owner"}},
+			createErr:  errors.New("UnauthorizedOperation"),
+			expCreate:  true,
+			expErr:     true,
+		},
+		{
+			name:       "fail: DeleteTags error",
+			tagOptions: ModifyTagsOptions{TagsToDelete: []string{"owner"}},
+			deleteErr:  errors.New("UnauthorizedOperation"),
+			expDelete:  true,
+			expErr:     true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockEC2 := NewMockEC2API(mockCtrl)
+			c := newCloud(mockEC2)
+
+			if tc.expCreate {
+				mockEC2.EXPECT().CreateTags(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, input *ec2.CreateTagsInput, _ ...func(*ec2.Options)) (*ec2.CreateTagsOutput, error) {
+					expectedTags := []types.Tag{{Key: aws.String("billing"), Value: aws.String("team-a")}}
+					if !reflect.DeepEqual(input.Resources, []string{"vol-test"}) || !reflect.DeepEqual(input.Tags, expectedTags) {
+						t.Errorf("Unexpected CreateTags input: %+v", input)
+					}
+					return &ec2.CreateTagsOutput{}, tc.createErr
+				})
+			}
+			if tc.expDelete {
+				mockEC2.EXPECT().DeleteTags(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, input *ec2.DeleteTagsInput, _ ...func(*ec2.Options)) (*ec2.DeleteTagsOutput, error) {
+					expectedTags := []types.Tag{{Key: aws.String("owner")}}
+					if !reflect.DeepEqual(input.Resources, []string{"vol-test"}) || !reflect.DeepEqual(input.Tags, expectedTags) {
+						t.Errorf("Unexpected DeleteTags input: %+v", input)
+					}
+					return &ec2.DeleteTagsOutput{}, tc.deleteErr
+				})
+			}
+
+			err := c.ModifyTags(context.Background(), "vol-test", tc.tagOptions)
+			if (err != nil) != tc.expErr {
+				t.Fatalf("ModifyTags() failed: expected error %v, got: %v", tc.expErr, err)
+			}
+
+			mockCtrl.Finish()
+		})
+	}
+}
+
+func TestListIOSuspendedDisks(t *testing.T) {
+	ioStatus := func(volumeID, name, status string) types.VolumeStatusItem {
+		return types.VolumeStatusItem{
+			VolumeId: aws.String(volumeID),
+			VolumeStatus: &types.VolumeStatusInfo{
+				Details: []types.VolumeStatusDetails{{Name: types.VolumeStatusName(name), Status: aws.String(status)}},
+			},
+		}
+	}
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockEC2 := NewMockEC2API(mockCtrl)
+	c := newCloud(mockEC2)
+
+	gomock.InOrder(
+		mockEC2.EXPECT().DescribeVolumeStatus(gomock.Any(), gomock.Any()).Return(&ec2.DescribeVolumeStatusOutput{
+			VolumeStatuses: []types.VolumeStatusItem{ioStatus("vol-1", "io-enabled", "failed")},
+			NextToken:      aws.String("next"),
+		}, nil),
+		mockEC2.EXPECT().DescribeVolumeStatus(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, input *ec2.DescribeVolumeStatusInput, _ ...func(*ec2.Options)) (*ec2.DescribeVolumeStatusOutput, error) {
+			if aws.ToString(input.NextToken) != "next" {
+				t.Errorf("Expected the next page to be requested, got token %q", aws.ToString(input.NextToken))
+			}
+			return &ec2.DescribeVolumeStatusOutput{
+				VolumeStatuses: []types.VolumeStatusItem{
+					ioStatus("vol-2", "io-enabled", "failed"),
+					// Matched by the filters through another failed check
+					ioStatus("vol-3", "io-performance", "failed"),
+				},
+			}, nil
+		}),
+	)
+
+	volumeIDs, err := c.ListIOSuspendedDisks(context.Background())
+	if err != nil {
+		t.Fatalf("ListIOSuspendedDisks() failed: %v", err)
+	}
+	if !reflect.DeepEqual(volumeIDs, []string{"vol-1", "vol-2"}) {
+		t.Fatalf("Expected volumes [vol-1 vol-2], got %v", volumeIDs)
+	}
+}
+
+func TestEnableDiskIO(t *testing.T) {
+	testCases := []struct {
+		name      string
+		enableErr error
+		expErr    error
+	}{
+		{
+			name: "success",
+		},
+		{
+			name:      "fail: volume not found",
+			enableErr: &smithy.GenericAPIError{Code: "InvalidVolume.NotFound"},
+			expErr:    ErrNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockEC2 := NewMockEC2API(mockCtrl)
+			c := newCloud(mockEC2)
+
+			mockEC2.EXPECT().EnableVolumeIO(gomock.Any(), &ec2.EnableVolumeIOInput{VolumeId: aws.String("vol-test")}).Return(&ec2.EnableVolumeIOOutput{}, tc.enableErr)
+
+			if err := c.EnableDiskIO(context.Background(), "vol-test"); !errors.Is(err, tc.expErr) {
+				t.Fatalf("EnableDiskIO() failed: expected error %v, got: %v", tc.expErr, err)
+			}
+		})
+	}
+}
+
+func TestDryRunModifyDisk(t *testing.T) {
+	testCases := []struct {
+		name              string
+		existingVolume    types.Volume
+		descModVolume     *ec2.DescribeVolumesModificationsOutput
+		modifyDiskOptions *ModifyDiskOptions
+		expVerdict        ModifyDiskVerdict
+	}{
+		{
+			name: "ok: never modified",
+			existingVolume: types.Volume{
+				VolumeId:   aws.String("vol-test"),
+				Size:       aws.Int32(100),
+				VolumeType: types.VolumeTypeGp2,
+			},
+			modifyDiskOptions: &ModifyDiskOptions{VolumeType: VolumeTypeGP3},
+			expVerdict:        ModifyDiskVerdictOK,
+		},
+		{
+			name: "ok: modified before cooldown",
+			existingVolume: types.Volume{
+				VolumeId:   aws.String("vol-test"),
+				Size:       aws.Int32(100),
+				VolumeType: types.VolumeTypeGp3,
+				Iops:       aws.Int32(3000),
+			},
+			descModVolume: &ec2.DescribeVolumesModificationsOutput{
+				VolumesModifications: []types.VolumeModification{
+					{
+						VolumeId:          aws.String("vol-test"),
+						ModificationState: types.VolumeModificationStateCompleted,
+						StartTime:         aws.Time(time.Now().Add(-7 * time.Hour)),
+					},
+				},
+			},
+			modifyDiskOptions: &ModifyDiskOptions{IOPS: 4000},
+			expVerdict:        ModifyDiskVerdictOK,
+		},
+		{
+			name: "no-change: matching parameters",
+			existingVolume: types.Volume{
+				VolumeId:   aws.String("vol-test"),
+				Size:       aws.Int32(100),
+				VolumeType: types.VolumeTypeGp3,
+				Iops:       aws.Int32(3000),
+			},
+			modifyDiskOptions: &ModifyDiskOptions{VolumeType: VolumeTypeGP3, IOPS: 3000},
+			expVerdict:        ModifyDiskVerdictNoChange,
+		},
+		{
+			name: "in-progress: optimizing",
+			existingVolume: types.Volume{
+				VolumeId:   aws.String("vol-test"),
+				Size:       aws.Int32(100),
+				VolumeType: types.VolumeTypeGp2,
+			},
+			descModVolume: &ec2.DescribeVolumesModificationsOutput{
+				VolumesModifications: []types.VolumeModification{
+					{
+						VolumeId:          aws.String("vol-test"),
+						ModificationState: types.VolumeModificationStateOptimizing,
+						StartTime:         aws.Time(time.Now().Add(-time.Hour)),
+					},
+				},
+			},
+			modifyDiskOptions: &ModifyDiskOptions{VolumeType: VolumeTypeGP3},
+			expVerdict:        ModifyDiskVerdictInProgress,
+		},
+		{
+			name: "cooldown: modified recently",
+			existingVolume: types.Volume{
+				VolumeId:   aws.String("vol-test"),
+				Size:       aws.Int32(100),
+				VolumeType: types.VolumeTypeGp2,
+			},
+			descModVolume: &ec2.DescribeVolumesModificationsOutput{
+				VolumesModifications: []types.VolumeModification{
+					{
+						VolumeId:          aws.String("vol-test"),
+						ModificationState: types.VolumeModificationStateCompleted,
+						StartTime:         aws.Time(time.Now().Add(-time.Hour)),
+					},
+				},
+			},
+			modifyDiskOptions: &ModifyDiskOptions{VolumeType: VolumeTypeGP3},
+			expVerdict:        ModifyDiskVerdictCooldown,
+		},
+		{
+			name: "invalid-type: hdd too small",
+			existingVolume: types.Volume{
+				VolumeId:   aws.String("vol-test"),
+				Size:       aws.Int32(100),
+				VolumeType: types.VolumeTypeGp2,
+			},
+			modifyDiskOptions: &ModifyDiskOptions{VolumeType: VolumeTypeST1},
+			expVerdict:        ModifyDiskVerdictInvalidType,
+		},
+		{
+			name: "invalid-ratio: io1 iops per GiB",
+			existingVolume: types.Volume{
+				VolumeId:   aws.String("vol-test"),
+				Size:       aws.Int32(100),
+				VolumeType: types.VolumeTypeIo1,
+				Iops:       aws.Int32(1000),
+			},
+			modifyDiskOptions: &ModifyDiskOptions{IOPS: 10000},
+			expVerdict:        ModifyDiskVerdictInvalidRatio,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockEC2 := NewMockEC2API(mockCtrl)
+			c := newCloud(mockEC2)
+
+			mockEC2.EXPECT().DescribeVolumes(gomock.Any(), gomock.Any()).Return(&ec2.DescribeVolumesOutput{Volumes: []types.Volume{tc.existingVolume}}, nil)
+			descModVolume := tc.descModVolume
+			if descModVolume == nil {
+				descModVolume = &ec2.DescribeVolumesModificationsOutput{}
+			}
+			mockEC2.EXPECT().DescribeVolumesModifications(gomock.Any(), gomock.Any(), gomock.Any()).Return(descModVolume, nil).AnyTimes()
+
+			dryRun, err := c.DryRunModifyDisk(context.Background(), "vol-test", tc.modifyDiskOptions)
+			if err != nil {
+				t.Fatalf("DryRunModifyDisk() failed: expected no error, got: %v", err)
+			}
+			if dryRun.Verdict != tc.expVerdict {
+				t.Fatalf("DryRunModifyDisk() failed: expected verdict %q, got %q (%s)", tc.expVerdict, dryRun.Verdict, dryRun.Reason)
+			}
+
+			mockCtrl.Finish()
+		})
+	}
+}
+
+func TestValidateModifyDiskOptions(t *testing.T) {
+	testCases := []struct {
+		name    string
+		volume  types.Volume
+		options *ModifyDiskOptions
+		expErr  error
+	}{
+		{
+			name:    "success: gp2 to gp3 with default performance",
+			volume:  types.Volume{Size: aws.Int32(10), VolumeType: types.VolumeTypeGp2},
+			options: &ModifyDiskOptions{VolumeType: VolumeTypeGP3},
+		},
+		{
+			name:    "success: gp3 throughput within ratio",
+			volume:  types.Volume{Size: aws.Int32(100), VolumeType: types.VolumeTypeGp3, Iops: aws.Int32(3000)},
+			options: &ModifyDiskOptions{Throughput: 750},
+		},
+		{
+			name:    "success: io2 iops within ratio",
+			volume:  types.Volume{Size: aws.Int32(100), VolumeType: types.VolumeTypeIo2, Iops: aws.Int32(1000)},
+			options: &ModifyDiskOptions{IOPS: 50000},
+		},
+		{
+			name:    "fail: unknown volume type",
+			volume:  types.Volume{Size: aws.Int32(100), VolumeType: types.VolumeTypeGp2},
+			options: &ModifyDiskOptions{VolumeType: "gp9"},
+			expErr:  ErrInvalidVolumeTypeTransition,
+		},
+		{
+			name:    "fail: from standard",
+			volume:  types.Volume{Size: aws.Int32(100), VolumeType: types.VolumeTypeStandard},
+			options: &ModifyDiskOptions{VolumeType: VolumeTypeGP3},
+			expErr:  ErrInvalidVolumeTypeTransition,
+		},
+		{
+			name:    "fail: multi-attach type change",
+			volume:  types.Volume{Size: aws.Int32(100), VolumeType: types.VolumeTypeIo2, Iops: aws.Int32(1000), MultiAttachEnabled: aws.Bool(true)},
+			options: &ModifyDiskOptions{VolumeType: VolumeTypeGP3},
+			expErr:  ErrInvalidVolumeTypeTransition,
+		},
+		{
+			name:    "fail: gp3 iops per GiB",
+			volume:  types.Volume{Size: aws.Int32(10), VolumeType: types.VolumeTypeGp3, Iops: aws.Int32(3000)},
+			options: &ModifyDiskOptions{IOPS: 6000},
+			expErr:  ErrInvalidPerformanceRatio,
+		},
+		{
+			name:    "fail: gp3 throughput per iops",
+			volume:  types.Volume{Size: aws.Int32(100), VolumeType: types.VolumeTypeGp3, Iops: aws.Int32(3000)},
+			options: &ModifyDiskOptions{Throughput: 1000},
+			expErr:  ErrInvalidPerformanceRatio,
+		},
+		{
+			name:    "fail: iops on gp2",
+			volume:  types.Volume{Size: aws.Int32(100), VolumeType: types.VolumeTypeGp2},
+			options: &ModifyDiskOptions{IOPS: 3000},
+			expErr:  ErrInvalidPerformanceRatio,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateModifyDiskOptions(tc.volume, tc.options)
+			if tc.expErr == nil {
+				if err != nil {
+					t.Fatalf("ValidateModifyDiskOptions() failed: expected no error, got: %v", err)
+				}
+			} else if !errors.Is(err, tc.expErr) {
+				t.Fatalf("ValidateModifyDiskOptions() failed: expected %v, got: %v", tc.expErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateKMSKeyID(t *testing.T) {
+	testCases := []struct {
+		name   string
+		keyID  string
+		expErr error
+	}{
+		{
+			name:  "success: key ARN",
+			keyID: "arn:aws:kms:us-east-1:012345678910:key/abcd1234-a123-456a-a12b-a123b4cd56ef",
+		},
+		{
+			name:  "success: key ARN in another partition",
+			keyID: "arn:aws-us-gov:kms:us-gov-west-1:012345678910:key/abcd1234-a123-456a-a12b-a123b4cd56ef",
+		},
+		{
+			name:  "success: alias ARN",
+			keyID: "arn:aws:kms:us-east-1:012345678910:alias/ebs",
+		},
+		{
+			name:  "success: alias name",
+			keyID: "alias/ebs",
+		},
+		{
+			name:  "success: key ID",
+			keyID: "abcd1234-a123-456a-a12b-a123b4cd56ef",
+		},
+		{
+			name:  "success: multi-Region key ID",
+			keyID: "mrk-1234abcd12ab34cd56ef1234567890ab",
+		},
+		{
+			name:   "fail: garbage",
+			keyID:  "not-a-key",
+			expErr: ErrInvalidKMSKeyID,
+		},
+		{
+			name:   "fail: malformed ARN",
+			keyID:  "arn:aws:kms:us-east-1",
+			expErr: ErrInvalidKMSKeyID,
+		},
+		{
+			name:   "fail: ARN of another service",
+			keyID:  "arn:aws:iam::012345678910:role/ebs",
+			expErr: ErrInvalidKMSKeyID,
+		},
+		{
+			name:   "fail: KMS ARN without key",
+			keyID:  "arn:aws:kms:us-east-1:012345678910:key/",
+			expErr: ErrInvalidKMSKeyID,
+		},
+		{
+			name:   "fail: empty alias",
+			keyID:  "alias/",
+			expErr: ErrInvalidKMSKeyID,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateKMSKeyID(tc.keyID)
+			if tc.expErr == nil {
+				if err != nil {
+					t.Fatalf("ValidateKMSKeyID() failed: expected no error, got: %v", err)
+				}
+			} else if !errors.Is(err, tc.expErr) {
+				t.Fatalf("ValidateKMSKeyID() failed: expected %v, got: %v", tc.expErr, err)
+			}
+		})
+	}
+}
+
 func TestGetSnapshotByName(t *testing.T) {
 	testCases := []struct {
 		name            string
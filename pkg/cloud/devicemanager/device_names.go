@@ -16,6 +16,8 @@ limitations under the License.
 
 package devicemanager
 
+import "strings"
+
 // EC2 allowed EBS device names, discovered by trial and error
 // Notable (undocumented) restrictions include:
 // /dev/xvda is broken on Windows (despite the API allowing it)
@@ -158,3 +160,14 @@ var deviceNames = []string{
 	"/dev/sdz",
 	"/dev/sda2",
 }
+
+// IsLikelyDriverDeviceName reports whether name is in the /dev/xvd{a-z}{a-z} series, which the driver allocates
+// before any other device name. Volumes attached outside of the driver rarely use these names.
+func IsLikelyDriverDeviceName(name string) bool {
+	suffix, ok := strings.CutPrefix(name, "/dev/xvd")
+	return ok && len(suffix) == 2 && isLowerLetter(suffix[0]) && isLowerLetter(suffix[1])
+}
+
+func isLowerLetter(c byte) bool {
+	return c >= 'a' && c <= 'z'
+}
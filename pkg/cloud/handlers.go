@@ -19,17 +19,72 @@ package cloud
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
 	"github.com/aws/smithy-go"
 	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/metrics"
 	"k8s.io/klog/v2"
 )
 
 const requestLimitExceededErrorCode = "RequestLimitExceeded"
 
+// ClockSkewError is returned for AWS requests whose signature was rejected because the local clock is too far from the
+// clock of AWS, which usually means NTP is not working on the host
+type ClockSkewError struct {
+	Err error
+	// LocalTime is the time of the host when the error was received
+	LocalTime time.Time
+	// ServerTime is the Date header of the response, empty if AWS did not send one
+	ServerTime string
+}
+
+func (e *ClockSkewError) Error() string {
+	serverTime := e.ServerTime
+	if serverTime == "" {
+		serverTime = "unknown"
+	}
+	return fmt.Sprintf("request signature rejected because the clock of this host may be skewed, check NTP (local time: %s, AWS time: %s): %v", e.LocalTime.UTC().Format(time.RFC1123), serverTime, e.Err)
+}
+
+func (e *ClockSkewError) Unwrap() error {
+	return e.Err
+}
+
+// IsClockSkewError checks if err is an AWS error rejecting the signature of a request because of its timestamp
+func IsClockSkewError(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.ErrorCode() {
+	case "RequestExpired", "RequestTimeTooSkewed", "RequestInTheFuture":
+		return true
+	case "SignatureDoesNotMatch", "InvalidSignatureException", "AuthFailure":
+		// These codes are also returned for invalid credentials, only the message tells skew apart
+		message := apiErr.ErrorMessage()
+		return strings.Contains(message, "Signature expired") || strings.Contains(message, "Signature not yet current")
+	}
+	return false
+}
+
+// newClockSkewError wraps err in a ClockSkewError if it is a clock skew error, and returns nil otherwise
+func newClockSkewError(err error, now time.Time) *ClockSkewError {
+	if !IsClockSkewError(err) {
+		return nil
+	}
+	skewErr := &ClockSkewError{Err: err, LocalTime: now}
+	var respErr *smithyhttp.ResponseError
+	if errors.As(err, &respErr) && respErr.Response != nil {
+		skewErr.ServerTime = respErr.Response.Header.Get("Date")
+	}
+	return skewErr
+}
+
 // RecordRequestsHandler is added to the Complete chain; called after any request
 func RecordRequestsMiddleware() func(*middleware.Stack) error {
 	return func(stack *middleware.Stack) error {
@@ -51,6 +106,14 @@ func RecordRequestsMiddleware() func(*middleware.Stack) error {
 						metrics.Recorder().IncreaseCount("cloudprovider_aws_api_request_errors", labels)
 					}
 				}
+				if skewErr := newClockSkewError(err, time.Now()); skewErr != nil {
+					operationName := awsmiddleware.GetOperationName(ctx)
+					metrics.Recorder().IncreaseCount("cloudprovider_aws_api_clock_skew_errors_total", map[string]string{
+						"operation_name": operationName,
+					})
+					klog.ErrorS(skewErr, "AWS request failed because of clock skew", "request", operationName)
+					err = skewErr
+				}
 			} else {
 				duration := time.Since(start).Seconds()
 				metrics.Recorder().ObserveHistogram("cloudprovider_aws_api_request_duration_seconds", duration, labels, nil)
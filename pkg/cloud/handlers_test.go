@@ -0,0 +1,180 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/metrics"
+)
+
+// newResponseError wraps apiErr like the SDK does for an error response with the given Date header
+func newResponseError(apiErr error, date string) error {
+	header := http.Header{}
+	if date != "" {
+		header.Set("Date", date)
+	}
+	return &awshttp.ResponseError{
+		ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusBadRequest, Header: header}},
+			Err:      apiErr,
+		},
+		RequestID: "request-id",
+	}
+}
+
+func TestNewClockSkewError(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	serverTime := "Fri, 01 Mar 2024 12:20:00 GMT"
+
+	testCases := []struct {
+		name               string
+		err                error
+		expectSkew         bool
+		expectedServerTime string
+	}{
+		{
+			name:               "request expired",
+			err:                newResponseError(&smithy.GenericAPIError{Code: "RequestExpired", Message: "Request has expired."}, serverTime),
+			expectSkew:         true,
+			expectedServerTime: serverTime,
+		},
+		{
+			name:               "signature expired",
+			err:                newResponseError(&smithy.GenericAPIError{Code: "SignatureDoesNotMatch", Message: "Signature expired: 20240301T120000Z is now earlier than 20240301T121500Z"}, serverTime),
+			expectSkew:         true,
+			expectedServerTime: serverTime,
+		},
+		{
+			name:       "request expired without a response",
+			err:        &smithy.GenericAPIError{Code: "RequestExpired", Message: "Request has expired."},
+			expectSkew: true,
+		},
+		{
+			name: "invalid credentials",
+			err:  newResponseError(&smithy.GenericAPIError{Code: "SignatureDoesNotMatch", Message: "The request signature we calculated does not match the signature you provided."}, serverTime),
+		},
+		{
+			name: "volume error",
+			err:  newResponseError(&smithy.GenericAPIError{Code: "InvalidVolume.NotFound", Message: "The volume 'vol-test' does not exist."}, serverTime),
+		},
+		{
+			name: "not an API error",
+			err:  errors.New("connection reset by peer"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			skewErr := newClockSkewError(tc.err, now)
+			if !tc.expectSkew {
+				if skewErr != nil {
+					t.Fatalf("Expected no clock skew error, got %v", skewErr)
+				}
+				return
+			}
+			if skewErr == nil {
+				t.Fatalf("Expected a clock skew error for %v", tc.err)
+			}
+			if skewErr.ServerTime != tc.expectedServerTime {
+				t.Errorf("Unexpected server time: got %q, want %q", skewErr.ServerTime, tc.expectedServerTime)
+			}
+			if !errors.Is(skewErr, tc.err) {
+				t.Errorf("Expected clock skew error to wrap %v", tc.err)
+			}
+			if !strings.Contains(skewErr.Error(), "local time: Fri, 01 Mar 2024 12:00:00 UTC") {
+				t.Errorf("Expected error to contain the local time, got %q", skewErr.Error())
+			}
+		})
+	}
+}
+
+func TestRecordRequestsMiddlewareClockSkew(t *testing.T) {
+	recorder := metrics.InitializeRecorder()
+	// skewErrors returns the number of clock skew errors recorded
+	skewErrors := func() float64 {
+		families, err := recorder.Gatherer().Gather()
+		if err != nil {
+			t.Fatalf("failed to gather metrics: %v", err)
+		}
+		var count float64
+		for _, family := range families {
+			if family.GetName() != "cloudprovider_aws_api_clock_skew_errors_total" {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				count += metric.GetCounter().GetValue()
+			}
+		}
+		return count
+	}
+
+	testCases := []struct {
+		name       string
+		err        error
+		expectSkew bool
+	}{
+		{
+			name:       "clock skew",
+			err:        newResponseError(&smithy.GenericAPIError{Code: "RequestExpired", Message: "Request has expired."}, "Fri, 01 Mar 2024 12:20:00 GMT"),
+			expectSkew: true,
+		},
+		{
+			name: "other error",
+			err:  newResponseError(&smithy.GenericAPIError{Code: "InvalidVolume.NotFound", Message: "The volume 'vol-test' does not exist."}, ""),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stack := middleware.NewStack("test", smithyhttp.NewStackRequest)
+			if err := RecordRequestsMiddleware()(stack); err != nil {
+				t.Fatalf("failed to add middleware: %v", err)
+			}
+			handler := middleware.DecorateHandler(middleware.HandlerFunc(func(context.Context, interface{}) (interface{}, middleware.Metadata, error) {
+				return nil, middleware.Metadata{}, tc.err
+			}), stack)
+
+			before := skewErrors()
+			_, _, err := handler.Handle(context.Background(), struct{}{})
+
+			var skewErr *ClockSkewError
+			if errors.As(err, &skewErr) != tc.expectSkew {
+				t.Errorf("Unexpected error classification: %v", err)
+			}
+			if !errors.Is(err, tc.err) {
+				t.Errorf("Expected returned error to wrap %v, got %v", tc.err, err)
+			}
+			expected := before
+			if tc.expectSkew {
+				expected++
+			}
+			if got := skewErrors(); got != expected {
+				t.Errorf("Unexpected clock skew error count: got %v, want %v", got, expected)
+			}
+		})
+	}
+}
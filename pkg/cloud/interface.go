@@ -27,14 +27,29 @@ type Cloud interface {
 	AttachDisk(ctx context.Context, volumeID string, nodeID string) (devicePath string, err error)
 	DetachDisk(ctx context.Context, volumeID string, nodeID string) (err error)
 	ResizeOrModifyDisk(ctx context.Context, volumeID string, newSizeBytes int64, options *ModifyDiskOptions) (newSize int32, err error)
+	DryRunModifyDisk(ctx context.Context, volumeID string, options *ModifyDiskOptions) (*ModifyDiskDryRun, error)
 	WaitForAttachmentState(ctx context.Context, volumeID, expectedState string, expectedInstance string, expectedDevice string, alreadyAssigned bool) (*types.VolumeAttachment, error)
 	GetDiskByName(ctx context.Context, name string, capacityBytes int64) (disk *Disk, err error)
 	GetDiskByID(ctx context.Context, volumeID string) (disk *Disk, err error)
+	GetCachedDiskByID(ctx context.Context, volumeID string) (disk *Disk, err error)
 	CreateSnapshot(ctx context.Context, volumeID string, snapshotOptions *SnapshotOptions) (snapshot *Snapshot, err error)
 	DeleteSnapshot(ctx context.Context, snapshotID string) (success bool, err error)
 	GetSnapshotByName(ctx context.Context, name string) (snapshot *Snapshot, err error)
 	GetSnapshotByID(ctx context.Context, snapshotID string) (snapshot *Snapshot, err error)
 	ListSnapshots(ctx context.Context, volumeID string, maxResults int32, nextToken string) (listSnapshotsResponse *ListSnapshotsResponse, err error)
+	CopySnapshotToRegion(ctx context.Context, snapshotID, region string, tags map[string]string) (*Snapshot, error)
+	DeleteSnapshotCopies(ctx context.Context, snapshotID, region string) error
+	ListSnapshotsByTag(ctx context.Context, tagKey string) ([]*Snapshot, error)
+	TagSnapshot(ctx context.Context, snapshotID string, tags map[string]string) error
 	EnableFastSnapshotRestores(ctx context.Context, availabilityZones []string, snapshotID string) (*ec2.EnableFastSnapshotRestoresOutput, error)
+	FastSnapshotRestoreZones(ctx context.Context, snapshotID string) ([]string, error)
 	AvailabilityZones(ctx context.Context) (map[string]struct{}, error)
+	GetInstanceTypeInfo(ctx context.Context, instanceType string) (*InstanceTypeInfo, error)
+	CountNonCSIVolumeAttachments(ctx context.Context, instanceID string) (int, error)
+	ListDiskParameters(ctx context.Context, tagKey string, tags map[string]string) ([]*DiskParameters, error)
+	ListDisks(ctx context.Context, tagKey string, maxResults int32, nextToken string) (*ListDisksResponse, error)
+	TagDisk(ctx context.Context, volumeID string, tags map[string]string) error
+	ModifyTags(ctx context.Context, volumeID string, tagOptions ModifyTagsOptions) error
+	ListIOSuspendedDisks(ctx context.Context) ([]string, error)
+	EnableDiskIO(ctx context.Context, volumeID string) error
 }
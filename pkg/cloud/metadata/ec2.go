@@ -16,6 +16,7 @@ package metadata
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"strings"
@@ -36,6 +37,14 @@ const (
 
 	// blockDevicesEndpoint is the ec2 instance metadata endpoint to query the number of attached block devices
 	BlockDevicesEndpoint string = "block-device-mapping"
+
+	// InstanceTagsEndpoint is the ec2 instance metadata endpoint to query the value of an instance tag
+	// Only available when access to tags in instance metadata is enabled on the instance
+	InstanceTagsEndpoint string = "tags/instance"
+
+	// InstanceActionEndpoint is the ec2 instance metadata endpoint to query for a pending stop or termination of a spot instance
+	// Returns 404 while no interruption is scheduled
+	InstanceActionEndpoint string = "spot/instance-action"
 )
 
 type EC2MetadataClient func() (EC2Metadata, error)
@@ -111,6 +120,7 @@ func EC2MetadataInstanceInfo(svc EC2Metadata, regionFromSession string) (*Metada
 		AvailabilityZone:       doc.AvailabilityZone,
 		NumAttachedENIs:        attachedENIs,
 		NumBlockDeviceMappings: blockDevMappings,
+		imdsClient:             svc,
 	}
 
 	outpostArnOutput, err := svc.GetMetadata(context.Background(), &imds.GetMetadataInput{Path: OutpostArnEndpoint})
@@ -139,3 +149,47 @@ func EC2MetadataInstanceInfo(svc EC2Metadata, regionFromSession string) (*Metada
 
 	return &instanceInfo, nil
 }
+
+// getInstanceTags queries IMDS for the value of each of the given instance tags
+// Tags that are not set on the instance are omitted from the result
+func getInstanceTags(svc EC2Metadata, keys []string) (map[string]string, error) {
+	tags := make(map[string]string, len(keys))
+	for _, key := range keys {
+		output, err := svc.GetMetadata(context.Background(), &imds.GetMetadataInput{Path: InstanceTagsEndpoint + "/" + key})
+		if err != nil {
+			// IMDS returns 404 for tags that are not set on the instance
+			if strings.Contains(err.Error(), "404") {
+				klog.V(4).InfoS("Instance tag not found in metadata", "key", key)
+				continue
+			}
+			return nil, fmt.Errorf("could not get metadata for instance tag %q: %w", key, err)
+		}
+		value, err := io.ReadAll(output.Content)
+		if err != nil {
+			return nil, fmt.Errorf("could not read instance tag %q metadata content: %w", key, err)
+		}
+		tags[key] = strings.TrimSpace(string(value))
+	}
+	return tags, nil
+}
+
+// getInterruptionNotice queries IMDS for a pending stop or termination of the instance
+// nil is returned while no interruption is scheduled
+func getInterruptionNotice(svc EC2Metadata) (*InterruptionNotice, error) {
+	output, err := svc.GetMetadata(context.Background(), &imds.GetMetadataInput{Path: InstanceActionEndpoint})
+	if err != nil {
+		if strings.Contains(err.Error(), "404") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get instance action metadata: %w", err)
+	}
+	content, err := io.ReadAll(output.Content)
+	if err != nil {
+		return nil, fmt.Errorf("could not read instance action metadata content: %w", err)
+	}
+	notice := &InterruptionNotice{}
+	if err := json.Unmarshal(content, notice); err != nil {
+		return nil, fmt.Errorf("could not parse instance action metadata %q: %w", string(content), err)
+	}
+	return notice, nil
+}
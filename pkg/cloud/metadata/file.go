@@ -0,0 +1,83 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+)
+
+// instanceIdentityFile is the JSON document read by FileInstanceInfo
+type instanceIdentityFile struct {
+	InstanceID             string `json:"instanceID"`
+	InstanceType           string `json:"instanceType"`
+	Region                 string `json:"region"`
+	AvailabilityZone       string `json:"availabilityZone"`
+	NumAttachedENIs        *int   `json:"numAttachedENIs"`
+	NumBlockDeviceMappings int    `json:"numBlockDeviceMappings"`
+	OutpostArn             string `json:"outpostArn"`
+}
+
+// FileInstanceInfo reads the instance identity from a JSON file, for environments where neither IMDS nor the
+// Kubernetes API can describe the instance, for example:
+//
+//	{"instanceID": "i-1234567890abcdef0", "instanceType": "m5.large", "region": "us-west-2", "availabilityZone": "us-west-2a"}
+func FileInstanceInfo(path string) (*Metadata, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata file: %w", err)
+	}
+
+	var doc instanceIdentityFile
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse metadata file %q: %w", path, err)
+	}
+
+	switch {
+	case doc.InstanceID == "":
+		return nil, fmt.Errorf("metadata file %q does not set instanceID", path)
+	case doc.Region == "":
+		return nil, fmt.Errorf("metadata file %q does not set region", path)
+	case doc.AvailabilityZone == "":
+		return nil, fmt.Errorf("metadata file %q does not set availabilityZone", path)
+	}
+
+	instanceInfo := Metadata{
+		InstanceID:             doc.InstanceID,
+		InstanceType:           doc.InstanceType,
+		Region:                 doc.Region,
+		AvailabilityZone:       doc.AvailabilityZone,
+		NumAttachedENIs:        1, // All nodes have at least 1 attached ENI, so we'll use that unless the file says otherwise
+		NumBlockDeviceMappings: doc.NumBlockDeviceMappings,
+	}
+	if doc.NumAttachedENIs != nil {
+		instanceInfo.NumAttachedENIs = *doc.NumAttachedENIs
+	}
+	if doc.OutpostArn != "" {
+		if instanceInfo.OutpostArn, err = arn.Parse(doc.OutpostArn); err != nil {
+			return nil, fmt.Errorf("metadata file %q has an invalid outpostArn: %w", path, err)
+		}
+	}
+
+	return &instanceInfo, nil
+}
@@ -26,10 +26,13 @@ type MetadataService interface {
 	GetInstanceID() string
 	GetInstanceType() string
 	GetRegion() string
+	GetPartition() string
 	GetAvailabilityZone() string
 	GetNumAttachedENIs() int
 	GetNumBlockDeviceMappings() int
 	GetOutpostArn() arn.ARN
+	GetInstanceTags(keys []string) (map[string]string, error)
+	GetInterruptionNotice() (*InterruptionNotice, error)
 }
 
 type EC2Metadata interface {
@@ -17,13 +17,40 @@ limitations under the License.
 package metadata
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/metrics"
 	"k8s.io/klog/v2"
 )
 
+// MetadataUpdateDurationMetric is the histogram recording how long it takes to retrieve instance metadata.
+const MetadataUpdateDurationMetric = "metadata_update_duration_seconds"
+
+// MetadataSourceUsedMetric counts the sources instance metadata was retrieved from, labeled by source.
+const MetadataSourceUsedMetric = "metadata_source_used_total"
+
+// Sources of instance metadata, see MetadataServiceConfig.MetadataSources
+const (
+	// SourceIMDS is the EC2 instance metadata service
+	SourceIMDS = "imds"
+	// SourceK8s is the labels and provider ID of the Kubernetes node
+	SourceK8s = "kubernetes"
+	// SourceFile is the JSON instance identity document of MetadataServiceConfig.MetadataFile, see FileInstanceInfo
+	SourceFile = "file"
+)
+
+var (
+	// DefaultMetadataSources are the sources tried when MetadataServiceConfig.MetadataSources is empty
+	DefaultMetadataSources = []string{SourceIMDS, SourceK8s}
+	// ValidMetadataSources are all the sources of instance metadata
+	ValidMetadataSources = []string{SourceIMDS, SourceK8s, SourceFile}
+)
+
 // Metadata is info about the ec2 instance on which the driver is running
 type Metadata struct {
 	InstanceID             string
@@ -33,31 +60,73 @@ type Metadata struct {
 	NumAttachedENIs        int
 	NumBlockDeviceMappings int
 	OutpostArn             arn.ARN
+	// Partition is the partition of Region, detected once the region is known, see PartitionForRegion
+	Partition string
+
+	// imdsClient is retained to serve lookups that are not captured at startup, nil when metadata came from Kubernetes or a file
+	imdsClient EC2Metadata
+}
+
+// InterruptionNotice is a pending stop or termination of the instance, as served by IMDS
+type InterruptionNotice struct {
+	// Action is either "stop" or "terminate"
+	Action string `json:"action"`
+	// Time is when the instance will be stopped or terminated
+	Time time.Time `json:"time"`
 }
 
 type MetadataServiceConfig struct {
 	EC2MetadataClient EC2MetadataClient
 	K8sAPIClient      KubernetesAPIClient
+	// MetadataFile is the path of the JSON instance identity document read by SourceFile, see FileInstanceInfo
+	MetadataFile string
+	// MetadataSources are the sources of metadata, tried in order until one succeeds. When empty, metadata is only read
+	// from SourceFile if MetadataFile is set, and from DefaultMetadataSources otherwise.
+	MetadataSources []string
 }
 
 var _ MetadataService = &Metadata{}
 
 func NewMetadataService(cfg MetadataServiceConfig, region string) (MetadataService, error) {
-	metadata, err := retrieveEC2Metadata(cfg.EC2MetadataClient, region)
-	if err == nil {
-		klog.InfoS("Retrieved metadata from IMDS")
-		return metadata.overrideRegion(region), nil
+	start := time.Now()
+	defer func() {
+		metrics.Recorder().ObserveHistogram(MetadataUpdateDurationMetric, time.Since(start).Seconds(), nil, nil)
+	}()
+
+	sources := cfg.MetadataSources
+	if len(sources) == 0 {
+		sources = DefaultMetadataSources
+		if cfg.MetadataFile != "" {
+			sources = []string{SourceFile}
+		}
 	}
-	klog.ErrorS(err, "Retrieving IMDS metadata failed, falling back to Kubernetes metadata")
-
-	metadata, err = retrieveK8sMetadata(cfg.K8sAPIClient)
-	if err == nil {
-		klog.InfoS("Retrieved metadata from Kubernetes")
-		return metadata.overrideRegion(region), nil
+	for _, source := range sources {
+		metadata, err := cfg.retrieveMetadata(source, region)
+		if err == nil {
+			klog.InfoS("Retrieved metadata", "source", source)
+			metrics.Recorder().IncreaseCount(MetadataSourceUsedMetric, map[string]string{"source": source})
+			return metadata.overrideRegion(region), nil
+		}
+		klog.ErrorS(err, "Retrieving metadata failed", "source", source)
 	}
-	klog.ErrorS(err, "Retrieving Kubernetes metadata failed")
 
-	return nil, fmt.Errorf("IMDS metadata and Kubernetes metadata are both unavailable")
+	return nil, fmt.Errorf("metadata is unavailable from all sources: %s", strings.Join(sources, ", "))
+}
+
+func (cfg MetadataServiceConfig) retrieveMetadata(source, region string) (*Metadata, error) {
+	switch source {
+	case SourceIMDS:
+		return retrieveEC2Metadata(cfg.EC2MetadataClient, region)
+	case SourceK8s:
+		return retrieveK8sMetadata(cfg.K8sAPIClient)
+	case SourceFile:
+		if cfg.MetadataFile == "" {
+			return nil, errors.New("metadata file not set")
+		}
+		return FileInstanceInfo(cfg.MetadataFile)
+	default:
+		return nil, fmt.Errorf("unknown metadata source %q", source)
+	}
 }
 
 func retrieveEC2Metadata(ec2MetadataClient EC2MetadataClient, region string) (*Metadata, error) {
@@ -83,11 +152,12 @@ func retrieveK8sMetadata(k8sAPIClient KubernetesAPIClient) (*Metadata, error) {
 	return KubernetesAPIInstanceInfo(clientset)
 }
 
-// Override the region on a Metadata object if it is non-empty
+// Override the region on a Metadata object if it is non-empty, then detect the partition of the resulting region
 func (m *Metadata) overrideRegion(region string) *Metadata {
 	if region != "" {
 		m.Region = region
 	}
+	m.Partition = PartitionForRegion(m.Region)
 	return m
 }
 
@@ -106,6 +176,14 @@ func (m *Metadata) GetRegion() string {
 	return m.Region
 }
 
+// GetPartition returns the partition which the instance is in.
+func (m *Metadata) GetPartition() string {
+	if m.Partition == "" {
+		return PartitionForRegion(m.Region)
+	}
+	return m.Partition
+}
+
 // GetAvailabilityZone returns the Availability Zone which the instance is in.
 func (m *Metadata) GetAvailabilityZone() string {
 	return m.AvailabilityZone
@@ -125,3 +203,21 @@ func (m *Metadata) GetNumBlockDeviceMappings() int {
 func (m *Metadata) GetOutpostArn() arn.ARN {
 	return m.OutpostArn
 }
+
+// GetInstanceTags returns the values of the given instance tags, omitting tags that are not set on the instance.
+// Instance tags are only available when metadata is retrieved from IMDS.
+func (m *Metadata) GetInstanceTags(keys []string) (map[string]string, error) {
+	if m.imdsClient == nil {
+		return nil, fmt.Errorf("instance tags are only available from IMDS")
+	}
+	return getInstanceTags(m.imdsClient, keys)
+}
+
+// GetInterruptionNotice returns the pending stop or termination of the instance, or nil if none is scheduled.
+// Interruption notices are only available when metadata is retrieved from IMDS.
+func (m *Metadata) GetInterruptionNotice() (*InterruptionNotice, error) {
+	if m.imdsClient == nil {
+		return nil, fmt.Errorf("interruption notices are only available from IMDS")
+	}
+	return getInterruptionNotice(m.imdsClient)
+}
@@ -20,18 +20,22 @@ import (
 	"errors"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws/arn"
 	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
 	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/metrics"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/component-base/metrics/testutil"
 )
 
 func TestNewMetadataService(t *testing.T) {
@@ -56,6 +60,7 @@ func TestNewMetadataService(t *testing.T) {
 				AvailabilityZone:       "us-west-2a",
 				NumAttachedENIs:        1,
 				NumBlockDeviceMappings: 2,
+				Partition:              "aws",
 			},
 		},
 		{
@@ -69,6 +74,7 @@ func TestNewMetadataService(t *testing.T) {
 				AvailabilityZone:       "us-west-2a",
 				NumAttachedENIs:        1,
 				NumBlockDeviceMappings: 0,
+				Partition:              "aws",
 			},
 		},
 		{
@@ -76,7 +82,7 @@ func TestNewMetadataService(t *testing.T) {
 			region:           "us-west-2",
 			ec2MetadataError: errors.New("EC2 metadata error"),
 			k8sAPIError:      errors.New("K8s API error"),
-			expectedError:    errors.New("IMDS metadata and Kubernetes metadata are both unavailable"),
+			expectedError:    errors.New("metadata is unavailable from all sources: imds, kubernetes"),
 		},
 	}
 
@@ -139,12 +145,96 @@ func TestNewMetadataService(t *testing.T) {
 				require.EqualError(t, err, tc.expectedError.Error())
 			} else {
 				require.NoError(t, err)
+				if tc.ec2MetadataError == nil {
+					tc.expectedMetadata.imdsClient = mockEC2Metadata
+				}
 				require.Equal(t, tc.expectedMetadata, metadata)
 			}
 		})
 	}
 }
 
+func TestNewMetadataServiceRecordsDuration(t *testing.T) {
+	r := metrics.InitializeRecorder()
+
+	sampleCount := func() uint64 {
+		vec, err := testutil.GetHistogramVecFromGatherer(r.Gatherer(), MetadataUpdateDurationMetric, nil)
+		if err != nil {
+			return 0
+		}
+		return vec.GetAggregatedSampleCount()
+	}
+	before := sampleCount()
+
+	os.Setenv("CSI_NODE_NAME", "test-node")
+	cfg := MetadataServiceConfig{
+		EC2MetadataClient: func() (EC2Metadata, error) {
+			return nil, errors.New("EC2 metadata error")
+		},
+		K8sAPIClient: func() (kubernetes.Interface, error) {
+			return nil, errors.New("K8s API error")
+		},
+	}
+
+	_, err := NewMetadataService(cfg, "us-west-2")
+	require.Error(t, err)
+	assert.Equal(t, before+1, sampleCount())
+}
+
+func TestNewMetadataServiceRecordsSource(t *testing.T) {
+	r := metrics.InitializeRecorder()
+
+	// sourceCounts returns the number of times each source was used
+	sourceCounts := func() map[string]float64 {
+		families, err := r.Gatherer().Gather()
+		require.NoError(t, err)
+		counts := map[string]float64{}
+		for _, family := range families {
+			if family.GetName() != MetadataSourceUsedMetric {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				for _, label := range metric.GetLabel() {
+					if label.GetName() == "source" {
+						counts[label.GetValue()] += metric.GetCounter().GetValue()
+					}
+				}
+			}
+		}
+		return counts
+	}
+	before := sourceCounts()
+
+	os.Setenv("CSI_NODE_NAME", "test-node")
+	cfg := MetadataServiceConfig{
+		EC2MetadataClient: func() (EC2Metadata, error) {
+			return nil, errors.New("EC2 metadata error")
+		},
+		K8sAPIClient: func() (kubernetes.Interface, error) {
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test-node",
+					Labels: map[string]string{
+						corev1.LabelInstanceTypeStable: "c5.xlarge",
+						corev1.LabelTopologyRegion:     "us-west-2",
+						corev1.LabelTopologyZone:       "us-west-2a",
+					},
+				},
+				Spec: corev1.NodeSpec{
+					ProviderID: "aws:///us-west-2a/i-1234567890abcdef0",
+				},
+			}
+			return fake.NewSimpleClientset(node), nil
+		},
+	}
+
+	_, err := NewMetadataService(cfg, "us-west-2")
+	require.NoError(t, err)
+	after := sourceCounts()
+	assert.Equal(t, before[SourceK8s]+1, after[SourceK8s])
+	assert.Equal(t, before[SourceIMDS], after[SourceIMDS])
+}
+
 func TestEC2MetadataInstanceInfo(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -393,6 +483,7 @@ func TestEC2MetadataInstanceInfo(t *testing.T) {
 				require.Nil(t, metadata)
 			} else {
 				require.NoError(t, err)
+				tc.expectedMetadata.imdsClient = mockEC2Metadata
 				require.Equal(t, tc.expectedMetadata, metadata)
 			}
 		})
@@ -546,6 +637,137 @@ func TestKubernetesAPIInstanceInfo(t *testing.T) {
 	}
 }
 
+func TestFileInstanceInfo(t *testing.T) {
+	testCases := []struct {
+		name             string
+		content          string
+		expectedError    string
+		expectedMetadata *Metadata
+	}{
+		{
+			name:    "TestFileInstanceInfo: Required fields",
+			content: `{"instanceID": "i-1234567890abcdef0", "region": "us-west-2", "availabilityZone": "us-west-2a"}`,
+			expectedMetadata: &Metadata{
+				InstanceID:       "i-1234567890abcdef0",
+				Region:           "us-west-2",
+				AvailabilityZone: "us-west-2a",
+				NumAttachedENIs:  1,
+			},
+		},
+		{
+			name: "TestFileInstanceInfo: All fields",
+			content: `{
+				"instanceID": "i-1234567890abcdef0",
+				"instanceType": "m5.large",
+				"region": "us-west-2",
+				"availabilityZone": "us-west-2a",
+				"numAttachedENIs": 2,
+				"numBlockDeviceMappings": 1,
+				"outpostArn": "arn:aws:outposts:us-west-2:123456789012:outpost/op-1234567890abcdef0"
+			}`,
+			expectedMetadata: &Metadata{
+				InstanceID:             "i-1234567890abcdef0",
+				InstanceType:           "m5.large",
+				Region:                 "us-west-2",
+				AvailabilityZone:       "us-west-2a",
+				NumAttachedENIs:        2,
+				NumBlockDeviceMappings: 1,
+				OutpostArn: arn.ARN{
+					Partition: "aws",
+					Service:   "outposts",
+					Region:    "us-west-2",
+					AccountID: "123456789012",
+					Resource:  "outpost/op-1234567890abcdef0",
+				},
+			},
+		},
+		{
+			name:          "TestFileInstanceInfo: Malformed JSON",
+			content:       `{"instanceID": "i-1234567890abcdef0",`,
+			expectedError: "failed to parse metadata file",
+		},
+		{
+			name:          "TestFileInstanceInfo: Unknown field",
+			content:       `{"instanceID": "i-1234567890abcdef0", "region": "us-west-2", "zone": "us-west-2a"}`,
+			expectedError: `json: unknown field "zone"`,
+		},
+		{
+			name:          "TestFileInstanceInfo: Missing availability zone",
+			content:       `{"instanceID": "i-1234567890abcdef0", "region": "us-west-2"}`,
+			expectedError: "does not set availabilityZone",
+		},
+		{
+			name:          "TestFileInstanceInfo: Invalid outpost ARN",
+			content:       `{"instanceID": "i-1234567890abcdef0", "region": "us-west-2", "availabilityZone": "us-west-2a", "outpostArn": "op-1234567890abcdef0"}`,
+			expectedError: "has an invalid outpostArn",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "metadata.json")
+			require.NoError(t, os.WriteFile(path, []byte(tc.content), 0600))
+
+			metadata, err := FileInstanceInfo(path)
+			if tc.expectedError != "" {
+				require.ErrorContains(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedMetadata, metadata)
+		})
+	}
+}
+
+func TestNewMetadataServiceFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metadata.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"instanceID": "i-1234567890abcdef0", "instanceType": "m5.large", "region": "us-west-2", "availabilityZone": "us-west-2a"}`), 0600))
+
+	unavailable := func() (EC2Metadata, error) {
+		t.Fatal("IMDS must not be used when a metadata file is configured")
+		return nil, nil
+	}
+	md, err := NewMetadataService(MetadataServiceConfig{EC2MetadataClient: unavailable, MetadataFile: path}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "i-1234567890abcdef0", md.GetInstanceID())
+	assert.Equal(t, "us-west-2", md.GetRegion())
+	assert.Equal(t, "aws", md.GetPartition())
+	assert.Equal(t, "us-west-2a", md.GetAvailabilityZone())
+
+	_, err = NewMetadataService(MetadataServiceConfig{EC2MetadataClient: unavailable, MetadataFile: filepath.Join(t.TempDir(), "missing.json")}, "")
+	require.EqualError(t, err, "metadata is unavailable from all sources: file")
+}
+
+func TestNewMetadataServiceSources(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metadata.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"instanceID": "i-1234567890abcdef0", "region": "us-west-2", "availabilityZone": "us-west-2a"}`), 0600))
+
+	imdsUnavailable := func() (EC2Metadata, error) {
+		return nil, errors.New("IMDS disabled")
+	}
+	k8sUnused := func() (kubernetes.Interface, error) {
+		t.Fatal("Kubernetes must not be used when it is not a metadata source")
+		return nil, nil
+	}
+
+	md, err := NewMetadataService(MetadataServiceConfig{
+		EC2MetadataClient: imdsUnavailable,
+		K8sAPIClient:      k8sUnused,
+		MetadataSources:   []string{SourceIMDS, SourceFile},
+		MetadataFile:      path,
+	}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "i-1234567890abcdef0", md.GetInstanceID())
+	assert.Equal(t, "us-west-2a", md.GetAvailabilityZone())
+
+	_, err = NewMetadataService(MetadataServiceConfig{
+		EC2MetadataClient: imdsUnavailable,
+		K8sAPIClient:      k8sUnused,
+		MetadataSources:   []string{SourceIMDS, SourceFile},
+	}, "")
+	require.EqualError(t, err, "metadata is unavailable from all sources: imds, file")
+}
+
 func TestGetInstanceID(t *testing.T) {
 	metadata := &Metadata{
 		InstanceID: "i-1234567890abcdef0",
@@ -567,6 +789,53 @@ func TestGetRegion(t *testing.T) {
 	assert.Equal(t, "us-west-2", metadata.GetRegion())
 }
 
+func TestGetPartition(t *testing.T) {
+	testCases := []struct {
+		name              string
+		metadata          *Metadata
+		expectedPartition string
+	}{
+		{
+			name:              "detected partition",
+			metadata:          &Metadata{Region: "cn-north-1", Partition: "aws-cn"},
+			expectedPartition: "aws-cn",
+		},
+		{
+			name:              "partition detected from region when not set",
+			metadata:          &Metadata{Region: "us-gov-west-1"},
+			expectedPartition: "aws-us-gov",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedPartition, tc.metadata.GetPartition())
+		})
+	}
+}
+
+func TestPartitionForRegion(t *testing.T) {
+	testCases := []struct {
+		region            string
+		expectedPartition string
+	}{
+		{region: "us-west-2", expectedPartition: "aws"},
+		{region: "eu-central-1", expectedPartition: "aws"},
+		{region: "cn-north-1", expectedPartition: "aws-cn"},
+		{region: "cn-northwest-1", expectedPartition: "aws-cn"},
+		{region: "us-gov-west-1", expectedPartition: "aws-us-gov"},
+		{region: "us-gov-east-1", expectedPartition: "aws-us-gov"},
+		{region: "us-iso-east-1", expectedPartition: "aws-iso"},
+		{region: "us-isob-east-1", expectedPartition: "aws-iso-b"},
+		{region: "snow", expectedPartition: "aws"},
+		{region: "", expectedPartition: "aws"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.region, func(t *testing.T) {
+			assert.Equal(t, tc.expectedPartition, PartitionForRegion(tc.region))
+		})
+	}
+}
+
 func TestGetAvailabilityZone(t *testing.T) {
 	metadata := &Metadata{
 		AvailabilityZone: "us-west-2a",
@@ -602,8 +871,162 @@ func TestGetOutpostArn(t *testing.T) {
 	assert.Equal(t, outpostArn, metadata.GetOutpostArn())
 }
 
+func TestGetInstanceTags(t *testing.T) {
+	testCases := []struct {
+		name            string
+		keys            []string
+		mockEC2Metadata func(m *MockEC2Metadata)
+		noIMDS          bool
+		expectedTags    map[string]string
+		expectedError   string
+	}{
+		{
+			name: "TestGetInstanceTags: All tags found",
+			keys: []string{"team", "rack"},
+			mockEC2Metadata: func(m *MockEC2Metadata) {
+				m.EXPECT().GetMetadata(gomock.Any(), &imds.GetMetadataInput{Path: InstanceTagsEndpoint + "/team"}).Return(&imds.GetMetadataOutput{
+					Content: io.NopCloser(strings.NewReader("storage")),
+				}, nil)
+				m.EXPECT().GetMetadata(gomock.Any(), &imds.GetMetadataInput{Path: InstanceTagsEndpoint + "/rack"}).Return(&imds.GetMetadataOutput{
+					Content: io.NopCloser(strings.NewReader("r42\n")),
+				}, nil)
+			},
+			expectedTags: map[string]string{"team": "storage", "rack": "r42"},
+		},
+		{
+			name: "TestGetInstanceTags: Missing tag is omitted",
+			keys: []string{"team", "datacenter"},
+			mockEC2Metadata: func(m *MockEC2Metadata) {
+				m.EXPECT().GetMetadata(gomock.Any(), &imds.GetMetadataInput{Path: InstanceTagsEndpoint + "/team"}).Return(&imds.GetMetadataOutput{
+					Content: io.NopCloser(strings.NewReader("storage")),
+				}, nil)
+				m.EXPECT().GetMetadata(gomock.Any(), &imds.GetMetadataInput{Path: InstanceTagsEndpoint + "/datacenter"}).Return(nil, errors.New("404 - Not Found"))
+			},
+			expectedTags: map[string]string{"team": "storage"},
+		},
+		{
+			name: "TestGetInstanceTags: Error getting tag",
+			keys: []string{"team"},
+			mockEC2Metadata: func(m *MockEC2Metadata) {
+				m.EXPECT().GetMetadata(gomock.Any(), &imds.GetMetadataInput{Path: InstanceTagsEndpoint + "/team"}).Return(nil, errors.New("500 - Internal Server Error"))
+			},
+			expectedError: "could not get metadata for instance tag \"team\": 500 - Internal Server Error",
+		},
+		{
+			name: "TestGetInstanceTags: Error reading tag",
+			keys: []string{"team"},
+			mockEC2Metadata: func(m *MockEC2Metadata) {
+				m.EXPECT().GetMetadata(gomock.Any(), &imds.GetMetadataInput{Path: InstanceTagsEndpoint + "/team"}).Return(&imds.GetMetadataOutput{
+					Content: io.NopCloser(errReader{}),
+				}, nil)
+			},
+			expectedError: "could not read instance tag \"team\" metadata content: failed to read",
+		},
+		{
+			name:          "TestGetInstanceTags: Metadata not from IMDS",
+			keys:          []string{"team"},
+			noIMDS:        true,
+			expectedError: "instance tags are only available from IMDS",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			metadata := &Metadata{}
+			if !tc.noIMDS {
+				mockEC2Metadata := NewMockEC2Metadata(mockCtrl)
+				tc.mockEC2Metadata(mockEC2Metadata)
+				metadata.imdsClient = mockEC2Metadata
+			}
+
+			tags, err := metadata.GetInstanceTags(tc.keys)
+
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				require.Nil(t, tags)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tc.expectedTags, tags)
+			}
+		})
+	}
+}
+
 type errReader struct{}
 
 func (e errReader) Read(p []byte) (n int, err error) {
 	return 0, errors.New("failed to read")
 }
+
+func TestGetInterruptionNotice(t *testing.T) {
+	testCases := []struct {
+		name            string
+		mockEC2Metadata func(m *MockEC2Metadata)
+		noIMDS          bool
+		expectedNotice  *InterruptionNotice
+		expectedError   string
+	}{
+		{
+			name: "TestGetInterruptionNotice: Notice found",
+			mockEC2Metadata: func(m *MockEC2Metadata) {
+				m.EXPECT().GetMetadata(gomock.Any(), &imds.GetMetadataInput{Path: InstanceActionEndpoint}).Return(&imds.GetMetadataOutput{
+					Content: io.NopCloser(strings.NewReader(`{"action": "terminate", "time": "2024-06-01T12:00:00Z"}`)),
+				}, nil)
+			},
+			expectedNotice: &InterruptionNotice{Action: "terminate", Time: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)},
+		},
+		{
+			name: "TestGetInterruptionNotice: No notice",
+			mockEC2Metadata: func(m *MockEC2Metadata) {
+				m.EXPECT().GetMetadata(gomock.Any(), &imds.GetMetadataInput{Path: InstanceActionEndpoint}).Return(nil, errors.New("404 - Not Found"))
+			},
+		},
+		{
+			name: "TestGetInterruptionNotice: Error getting notice",
+			mockEC2Metadata: func(m *MockEC2Metadata) {
+				m.EXPECT().GetMetadata(gomock.Any(), &imds.GetMetadataInput{Path: InstanceActionEndpoint}).Return(nil, errors.New("500 - Internal Server Error"))
+			},
+			expectedError: "could not get instance action metadata: 500 - Internal Server Error",
+		},
+		{
+			name: "TestGetInterruptionNotice: Malformed notice",
+			mockEC2Metadata: func(m *MockEC2Metadata) {
+				m.EXPECT().GetMetadata(gomock.Any(), &imds.GetMetadataInput{Path: InstanceActionEndpoint}).Return(&imds.GetMetadataOutput{
+					Content: io.NopCloser(strings.NewReader("terminate")),
+				}, nil)
+			},
+			expectedError: "could not parse instance action metadata \"terminate\": invalid character 'e' in literal true (expecting 'r')",
+		},
+		{
+			name:          "TestGetInterruptionNotice: Metadata not from IMDS",
+			noIMDS:        true,
+			expectedError: "interruption notices are only available from IMDS",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			metadata := &Metadata{}
+			if !tc.noIMDS {
+				mockEC2Metadata := NewMockEC2Metadata(mockCtrl)
+				tc.mockEC2Metadata(mockEC2Metadata)
+				metadata.imdsClient = mockEC2Metadata
+			}
+
+			notice, err := metadata.GetInterruptionNotice()
+
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tc.expectedNotice, notice)
+		})
+	}
+}
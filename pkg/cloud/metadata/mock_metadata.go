@@ -78,6 +78,21 @@ func (mr *MockMetadataServiceMockRecorder) GetInstanceID() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInstanceID", reflect.TypeOf((*MockMetadataService)(nil).GetInstanceID))
 }
 
+// GetInstanceTags mocks base method.
+func (m *MockMetadataService) GetInstanceTags(keys []string) (map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetInstanceTags", keys)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetInstanceTags indicates an expected call of GetInstanceTags.
+func (mr *MockMetadataServiceMockRecorder) GetInstanceTags(keys interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInstanceTags", reflect.TypeOf((*MockMetadataService)(nil).GetInstanceTags), keys)
+}
+
 // GetInstanceType mocks base method.
 func (m *MockMetadataService) GetInstanceType() string {
 	m.ctrl.T.Helper()
@@ -92,6 +107,21 @@ func (mr *MockMetadataServiceMockRecorder) GetInstanceType() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInstanceType", reflect.TypeOf((*MockMetadataService)(nil).GetInstanceType))
 }
 
+// GetInterruptionNotice mocks base method.
+func (m *MockMetadataService) GetInterruptionNotice() (*InterruptionNotice, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetInterruptionNotice")
+	ret0, _ := ret[0].(*InterruptionNotice)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetInterruptionNotice indicates an expected call of GetInterruptionNotice.
+func (mr *MockMetadataServiceMockRecorder) GetInterruptionNotice() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInterruptionNotice", reflect.TypeOf((*MockMetadataService)(nil).GetInterruptionNotice))
+}
+
 // GetNumAttachedENIs mocks base method.
 func (m *MockMetadataService) GetNumAttachedENIs() int {
 	m.ctrl.T.Helper()
@@ -134,6 +164,20 @@ func (mr *MockMetadataServiceMockRecorder) GetOutpostArn() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOutpostArn", reflect.TypeOf((*MockMetadataService)(nil).GetOutpostArn))
 }
 
+// GetPartition mocks base method.
+func (m *MockMetadataService) GetPartition() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPartition")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// GetPartition indicates an expected call of GetPartition.
+func (mr *MockMetadataServiceMockRecorder) GetPartition() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPartition", reflect.TypeOf((*MockMetadataService)(nil).GetPartition))
+}
+
 // GetRegion mocks base method.
 func (m *MockMetadataService) GetRegion() string {
 	m.ctrl.T.Helper()
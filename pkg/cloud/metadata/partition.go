@@ -0,0 +1,47 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import "regexp"
+
+// DefaultPartition is the partition of regions that match no other partition
+const DefaultPartition = "aws"
+
+// partitions are the non-default partitions and the regions in them, following the regionRegex of each partition in
+// the AWS SDK endpoints metadata. The SDK only exposes its table through an internal package.
+var partitions = []struct {
+	id          string
+	regionRegex *regexp.Regexp
+}{
+	{id: "aws-cn", regionRegex: regexp.MustCompile(`^cn\-\w+\-\d+$`)},
+	{id: "aws-us-gov", regionRegex: regexp.MustCompile(`^us\-gov\-\w+\-\d+$`)},
+	{id: "aws-iso", regionRegex: regexp.MustCompile(`^us\-iso\-\w+\-\d+$`)},
+	{id: "aws-iso-b", regionRegex: regexp.MustCompile(`^us\-isob\-\w+\-\d+$`)},
+	{id: "aws-iso-e", regionRegex: regexp.MustCompile(`^eu\-isoe\-\w+\-\d+$`)},
+	{id: "aws-iso-f", regionRegex: regexp.MustCompile(`^us\-isof\-\w+\-\d+$`)},
+	{id: "aws-eusc", regionRegex: regexp.MustCompile(`^eusc\-(de)\-\w+\-\d+$`)},
+}
+
+// PartitionForRegion returns the partition the region is in, DefaultPartition for regions that are unknown or empty
+func PartitionForRegion(region string) string {
+	for _, p := range partitions {
+		if p.regionRegex.MatchString(region) {
+			return p.id
+		}
+	}
+	return DefaultPartition
+}
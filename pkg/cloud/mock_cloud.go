@@ -80,6 +80,36 @@ func (mr *MockCloudMockRecorder) AvailabilityZones(ctx interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AvailabilityZones", reflect.TypeOf((*MockCloud)(nil).AvailabilityZones), ctx)
 }
 
+// CopySnapshotToRegion mocks base method.
+func (m *MockCloud) CopySnapshotToRegion(ctx context.Context, snapshotID, region string, tags map[string]string) (*Snapshot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CopySnapshotToRegion", ctx, snapshotID, region, tags)
+	ret0, _ := ret[0].(*Snapshot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CopySnapshotToRegion indicates an expected call of CopySnapshotToRegion.
+func (mr *MockCloudMockRecorder) CopySnapshotToRegion(ctx, snapshotID, region, tags interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CopySnapshotToRegion", reflect.TypeOf((*MockCloud)(nil).CopySnapshotToRegion), ctx, snapshotID, region, tags)
+}
+
+// CountNonCSIVolumeAttachments mocks base method.
+func (m *MockCloud) CountNonCSIVolumeAttachments(ctx context.Context, instanceID string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountNonCSIVolumeAttachments", ctx, instanceID)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountNonCSIVolumeAttachments indicates an expected call of CountNonCSIVolumeAttachments.
+func (mr *MockCloudMockRecorder) CountNonCSIVolumeAttachments(ctx, instanceID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountNonCSIVolumeAttachments", reflect.TypeOf((*MockCloud)(nil).CountNonCSIVolumeAttachments), ctx, instanceID)
+}
+
 // CreateDisk mocks base method.
 func (m *MockCloud) CreateDisk(ctx context.Context, volumeName string, diskOptions *DiskOptions) (*Disk, error) {
 	m.ctrl.T.Helper()
@@ -140,6 +170,20 @@ func (mr *MockCloudMockRecorder) DeleteSnapshot(ctx, snapshotID interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSnapshot", reflect.TypeOf((*MockCloud)(nil).DeleteSnapshot), ctx, snapshotID)
 }
 
+// DeleteSnapshotCopies mocks base method.
+func (m *MockCloud) DeleteSnapshotCopies(ctx context.Context, snapshotID, region string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteSnapshotCopies", ctx, snapshotID, region)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteSnapshotCopies indicates an expected call of DeleteSnapshotCopies.
+func (mr *MockCloudMockRecorder) DeleteSnapshotCopies(ctx, snapshotID, region interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSnapshotCopies", reflect.TypeOf((*MockCloud)(nil).DeleteSnapshotCopies), ctx, snapshotID, region)
+}
+
 // DetachDisk mocks base method.
 func (m *MockCloud) DetachDisk(ctx context.Context, volumeID, nodeID string) error {
 	m.ctrl.T.Helper()
@@ -154,6 +198,35 @@ func (mr *MockCloudMockRecorder) DetachDisk(ctx, volumeID, nodeID interface{}) *
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DetachDisk", reflect.TypeOf((*MockCloud)(nil).DetachDisk), ctx, volumeID, nodeID)
 }
 
+// DryRunModifyDisk mocks base method.
+func (m *MockCloud) DryRunModifyDisk(ctx context.Context, volumeID string, options *ModifyDiskOptions) (*ModifyDiskDryRun, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DryRunModifyDisk", ctx, volumeID, options)
+	ret0, _ := ret[0].(*ModifyDiskDryRun)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DryRunModifyDisk indicates an expected call of DryRunModifyDisk.
+func (mr *MockCloudMockRecorder) DryRunModifyDisk(ctx, volumeID, options interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DryRunModifyDisk", reflect.TypeOf((*MockCloud)(nil).DryRunModifyDisk), ctx, volumeID, options)
+}
+
+// EnableDiskIO mocks base method.
+func (m *MockCloud) EnableDiskIO(ctx context.Context, volumeID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnableDiskIO", ctx, volumeID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnableDiskIO indicates an expected call of EnableDiskIO.
+func (mr *MockCloudMockRecorder) EnableDiskIO(ctx, volumeID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnableDiskIO", reflect.TypeOf((*MockCloud)(nil).EnableDiskIO), ctx, volumeID)
+}
+
 // EnableFastSnapshotRestores mocks base method.
 func (m *MockCloud) EnableFastSnapshotRestores(ctx context.Context, availabilityZones []string, snapshotID string) (*ec2.EnableFastSnapshotRestoresOutput, error) {
 	m.ctrl.T.Helper()
@@ -169,6 +242,36 @@ func (mr *MockCloudMockRecorder) EnableFastSnapshotRestores(ctx, availabilityZon
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnableFastSnapshotRestores", reflect.TypeOf((*MockCloud)(nil).EnableFastSnapshotRestores), ctx, availabilityZones, snapshotID)
 }
 
+// FastSnapshotRestoreZones mocks base method.
+func (m *MockCloud) FastSnapshotRestoreZones(ctx context.Context, snapshotID string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FastSnapshotRestoreZones", ctx, snapshotID)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FastSnapshotRestoreZones indicates an expected call of FastSnapshotRestoreZones.
+func (mr *MockCloudMockRecorder) FastSnapshotRestoreZones(ctx, snapshotID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FastSnapshotRestoreZones", reflect.TypeOf((*MockCloud)(nil).FastSnapshotRestoreZones), ctx, snapshotID)
+}
+
+// GetCachedDiskByID mocks base method.
+func (m *MockCloud) GetCachedDiskByID(ctx context.Context, volumeID string) (*Disk, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCachedDiskByID", ctx, volumeID)
+	ret0, _ := ret[0].(*Disk)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCachedDiskByID indicates an expected call of GetCachedDiskByID.
+func (mr *MockCloudMockRecorder) GetCachedDiskByID(ctx, volumeID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCachedDiskByID", reflect.TypeOf((*MockCloud)(nil).GetCachedDiskByID), ctx, volumeID)
+}
+
 // GetDiskByID mocks base method.
 func (m *MockCloud) GetDiskByID(ctx context.Context, volumeID string) (*Disk, error) {
 	m.ctrl.T.Helper()
@@ -199,6 +302,21 @@ func (mr *MockCloudMockRecorder) GetDiskByName(ctx, name, capacityBytes interfac
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDiskByName", reflect.TypeOf((*MockCloud)(nil).GetDiskByName), ctx, name, capacityBytes)
 }
 
+// GetInstanceTypeInfo mocks base method.
+func (m *MockCloud) GetInstanceTypeInfo(ctx context.Context, instanceType string) (*InstanceTypeInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetInstanceTypeInfo", ctx, instanceType)
+	ret0, _ := ret[0].(*InstanceTypeInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetInstanceTypeInfo indicates an expected call of GetInstanceTypeInfo.
+func (mr *MockCloudMockRecorder) GetInstanceTypeInfo(ctx, instanceType interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInstanceTypeInfo", reflect.TypeOf((*MockCloud)(nil).GetInstanceTypeInfo), ctx, instanceType)
+}
+
 // GetSnapshotByID mocks base method.
 func (m *MockCloud) GetSnapshotByID(ctx context.Context, snapshotID string) (*Snapshot, error) {
 	m.ctrl.T.Helper()
@@ -229,6 +347,51 @@ func (mr *MockCloudMockRecorder) GetSnapshotByName(ctx, name interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSnapshotByName", reflect.TypeOf((*MockCloud)(nil).GetSnapshotByName), ctx, name)
 }
 
+// ListDiskParameters mocks base method.
+func (m *MockCloud) ListDiskParameters(ctx context.Context, tagKey string, tags map[string]string) ([]*DiskParameters, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListDiskParameters", ctx, tagKey, tags)
+	ret0, _ := ret[0].([]*DiskParameters)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListDiskParameters indicates an expected call of ListDiskParameters.
+func (mr *MockCloudMockRecorder) ListDiskParameters(ctx, tagKey, tags interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListDiskParameters", reflect.TypeOf((*MockCloud)(nil).ListDiskParameters), ctx, tagKey, tags)
+}
+
+// ListDisks mocks base method.
+func (m *MockCloud) ListDisks(ctx context.Context, tagKey string, maxResults int32, nextToken string) (*ListDisksResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListDisks", ctx, tagKey, maxResults, nextToken)
+	ret0, _ := ret[0].(*ListDisksResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListDisks indicates an expected call of ListDisks.
+func (mr *MockCloudMockRecorder) ListDisks(ctx, tagKey, maxResults, nextToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListDisks", reflect.TypeOf((*MockCloud)(nil).ListDisks), ctx, tagKey, maxResults, nextToken)
+}
+
+// ListIOSuspendedDisks mocks base method.
+func (m *MockCloud) ListIOSuspendedDisks(ctx context.Context) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListIOSuspendedDisks", ctx)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListIOSuspendedDisks indicates an expected call of ListIOSuspendedDisks.
+func (mr *MockCloudMockRecorder) ListIOSuspendedDisks(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListIOSuspendedDisks", reflect.TypeOf((*MockCloud)(nil).ListIOSuspendedDisks), ctx)
+}
+
 // ListSnapshots mocks base method.
 func (m *MockCloud) ListSnapshots(ctx context.Context, volumeID string, maxResults int32, nextToken string) (*ListSnapshotsResponse, error) {
 	m.ctrl.T.Helper()
@@ -244,6 +407,35 @@ func (mr *MockCloudMockRecorder) ListSnapshots(ctx, volumeID, maxResults, nextTo
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListSnapshots", reflect.TypeOf((*MockCloud)(nil).ListSnapshots), ctx, volumeID, maxResults, nextToken)
 }
 
+// ListSnapshotsByTag mocks base method.
+func (m *MockCloud) ListSnapshotsByTag(ctx context.Context, tagKey string) ([]*Snapshot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListSnapshotsByTag", ctx, tagKey)
+	ret0, _ := ret[0].([]*Snapshot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListSnapshotsByTag indicates an expected call of ListSnapshotsByTag.
+func (mr *MockCloudMockRecorder) ListSnapshotsByTag(ctx, tagKey interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListSnapshotsByTag", reflect.TypeOf((*MockCloud)(nil).ListSnapshotsByTag), ctx, tagKey)
+}
+
+// ModifyTags mocks base method.
+func (m *MockCloud) ModifyTags(ctx context.Context, volumeID string, tagOptions ModifyTagsOptions) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ModifyTags", ctx, volumeID, tagOptions)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ModifyTags indicates an expected call of ModifyTags.
+func (mr *MockCloudMockRecorder) ModifyTags(ctx, volumeID, tagOptions interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ModifyTags", reflect.TypeOf((*MockCloud)(nil).ModifyTags), ctx, volumeID, tagOptions)
+}
+
 // ResizeOrModifyDisk mocks base method.
 func (m *MockCloud) ResizeOrModifyDisk(ctx context.Context, volumeID string, newSizeBytes int64, options *ModifyDiskOptions) (int32, error) {
 	m.ctrl.T.Helper()
@@ -259,6 +451,34 @@ func (mr *MockCloudMockRecorder) ResizeOrModifyDisk(ctx, volumeID, newSizeBytes,
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResizeOrModifyDisk", reflect.TypeOf((*MockCloud)(nil).ResizeOrModifyDisk), ctx, volumeID, newSizeBytes, options)
 }
 
+// TagDisk mocks base method.
+func (m *MockCloud) TagDisk(ctx context.Context, volumeID string, tags map[string]string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TagDisk", ctx, volumeID, tags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TagDisk indicates an expected call of TagDisk.
+func (mr *MockCloudMockRecorder) TagDisk(ctx, volumeID, tags interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TagDisk", reflect.TypeOf((*MockCloud)(nil).TagDisk), ctx, volumeID, tags)
+}
+
+// TagSnapshot mocks base method.
+func (m *MockCloud) TagSnapshot(ctx context.Context, snapshotID string, tags map[string]string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TagSnapshot", ctx, snapshotID, tags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TagSnapshot indicates an expected call of TagSnapshot.
+func (mr *MockCloudMockRecorder) TagSnapshot(ctx, snapshotID, tags interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TagSnapshot", reflect.TypeOf((*MockCloud)(nil).TagSnapshot), ctx, snapshotID, tags)
+}
+
 // WaitForAttachmentState mocks base method.
 func (m *MockCloud) WaitForAttachmentState(ctx context.Context, volumeID, expectedState, expectedInstance, expectedDevice string, alreadyAssigned bool) (*types.VolumeAttachment, error) {
 	m.ctrl.T.Helper()
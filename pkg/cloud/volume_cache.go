@@ -0,0 +1,169 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/metrics"
+	"k8s.io/utils/clock"
+)
+
+const (
+	volumeCacheMetric = "cloudprovider_aws_describe_volume_cache_requests_total"
+	volumeCacheHit    = "hit"
+	volumeCacheMiss   = "miss"
+)
+
+// cachedDisk is a Disk described by DescribeVolumes, valid until expires
+type cachedDisk struct {
+	disk    Disk
+	expires time.Time
+}
+
+// volumeLookup tracks the DescribeVolumes calls of GetCachedDiskByID in flight for a volume
+type volumeLookup struct {
+	// generation counts the invalidations of the volume while it is described, so that a volume described before it
+	// was modified is not cached once DescribeVolumes returns
+	generation uint64
+	count      int
+}
+
+// volumeCache caches the volumes of GetCachedDiskByID for --describe-volume-cache-ttl.
+// A nil volumeCache caches nothing.
+type volumeCache struct {
+	mux   sync.Mutex
+	clock clock.Clock
+	ttl   time.Duration
+	disks map[string]cachedDisk
+	// lookups are only kept while volumes are described, so that they do not grow with the volumes ever described
+	lookups map[string]*volumeLookup
+	// nextSweep is when the expired volumes that were not looked up again are next dropped
+	nextSweep time.Time
+}
+
+func newVolumeCache(ttl time.Duration, c clock.Clock) *volumeCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &volumeCache{
+		clock:     c,
+		ttl:       ttl,
+		disks:     map[string]cachedDisk{},
+		lookups:   map[string]*volumeLookup{},
+		nextSweep: c.Now().Add(ttl),
+	}
+}
+
+// get returns a copy of the cached volume. When it is not cached, it returns false along with the generation to pass to
+// release once the volume is described.
+func (vc *volumeCache) get(volumeID string) (*Disk, uint64, bool) {
+	vc.mux.Lock()
+	defer vc.mux.Unlock()
+	cached, ok := vc.disks[volumeID]
+	if ok && vc.clock.Now().Before(cached.expires) {
+		return copyDisk(&cached.disk), 0, true
+	}
+	delete(vc.disks, volumeID)
+	lookup, ok := vc.lookups[volumeID]
+	if !ok {
+		lookup = &volumeLookup{}
+		vc.lookups[volumeID] = lookup
+	}
+	lookup.count++
+	return nil, lookup.generation, false
+}
+
+// release ends a lookup started by get, and caches disk unless it is nil or the volume was invalidated since get
+// returned generation
+func (vc *volumeCache) release(volumeID string, disk *Disk, generation uint64) {
+	vc.mux.Lock()
+	defer vc.mux.Unlock()
+	lookup := vc.lookups[volumeID]
+	if lookup == nil {
+		return
+	}
+	lookup.count--
+	if lookup.count == 0 {
+		delete(vc.lookups, volumeID)
+	}
+	if disk == nil || lookup.generation != generation {
+		return
+	}
+	now := vc.clock.Now()
+	if !now.Before(vc.nextSweep) {
+		for id, cached := range vc.disks {
+			if !now.Before(cached.expires) {
+				delete(vc.disks, id)
+			}
+		}
+		vc.nextSweep = now.Add(vc.ttl)
+	}
+	vc.disks[volumeID] = cachedDisk{disk: *copyDisk(disk), expires: now.Add(vc.ttl)}
+}
+
+// invalidate drops the cached volume, it must be called by every call that modifies the volume
+func (vc *volumeCache) invalidate(volumeID string) {
+	if vc == nil {
+		return
+	}
+	vc.mux.Lock()
+	defer vc.mux.Unlock()
+	delete(vc.disks, volumeID)
+	if lookup, ok := vc.lookups[volumeID]; ok {
+		lookup.generation++
+	}
+}
+
+// copyDisk copies the disk so that callers of GetCachedDiskByID cannot modify the cache
+func copyDisk(disk *Disk) *Disk {
+	c := *disk
+	if disk.Attachments != nil {
+		c.Attachments = append([]string(nil), disk.Attachments...)
+	}
+	if disk.Tags != nil {
+		c.Tags = make(map[string]string, len(disk.Tags))
+		for k, v := range disk.Tags {
+			c.Tags[k] = v
+		}
+	}
+	return &c
+}
+
+// GetCachedDiskByID returns the volume like GetDiskByID, but caches it for --describe-volume-cache-ttl.
+// It must only be used by callers that can act on a volume which changed within the TTL, the waiters and the calls
+// modifying volumes use GetDiskByID and getVolume which always describe the volume.
+func (c *cloud) GetCachedDiskByID(ctx context.Context, volumeID string) (*Disk, error) {
+	if c.volumeCache == nil {
+		return c.GetDiskByID(ctx, volumeID)
+	}
+	disk, generation, ok := c.volumeCache.get(volumeID)
+	if ok {
+		metrics.Recorder().IncreaseCount(volumeCacheMetric, map[string]string{"result": volumeCacheHit})
+		return disk, nil
+	}
+	metrics.Recorder().IncreaseCount(volumeCacheMetric, map[string]string{"result": volumeCacheMiss})
+
+	disk, err := c.GetDiskByID(ctx, volumeID)
+	c.volumeCache.release(volumeID, disk, generation)
+	if err != nil {
+		return nil, err
+	}
+	return disk, nil
+}
@@ -0,0 +1,240 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/metrics"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/util"
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+// newCachedCloud returns a cloud caching volumes for a minute, along with the clock of the cache and a function returning
+// the number of DescribeVolumes calls. DescribeVolumes returns the volume with the size *sizeGiB.
+func newCachedCloud(t *testing.T, sizeGiB *int32) (*cloud, *MockEC2API, *testingclock.FakeClock, func() int) {
+	t.Helper()
+	mockCtrl := gomock.NewController(t)
+	t.Cleanup(mockCtrl.Finish)
+	mockEC2 := NewMockEC2API(mockCtrl)
+	fakeClock := testingclock.NewFakeClock(time.Now())
+
+	c := newCloud(mockEC2).(*cloud)
+	c.volumeCache = newVolumeCache(time.Minute, fakeClock)
+
+	describes := 0
+	mockEC2.EXPECT().DescribeVolumes(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ *ec2.DescribeVolumesInput, _ ...func(*ec2.Options)) (*ec2.DescribeVolumesOutput, error) {
+			describes++
+			return &ec2.DescribeVolumesOutput{Volumes: []types.Volume{{
+				VolumeId:         aws.String("vol-test"),
+				Size:             aws.Int32(*sizeGiB),
+				AvailabilityZone: aws.String(defaultZone),
+			}}}, nil
+		}).AnyTimes()
+	return c, mockEC2, fakeClock, func() int { return describes }
+}
+
+func TestGetCachedDiskByID(t *testing.T) {
+	recorder := metrics.InitializeRecorder()
+	// cacheRequests returns the number of requests recorded by result
+	cacheRequests := func() map[string]float64 {
+		families, err := recorder.Gatherer().Gather()
+		if err != nil {
+			t.Fatalf("failed to gather metrics: %v", err)
+		}
+		counts := map[string]float64{}
+		for _, family := range families {
+			if family.GetName() != volumeCacheMetric {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				for _, label := range metric.GetLabel() {
+					if label.GetName() == "result" {
+						counts[label.GetValue()] += metric.GetCounter().GetValue()
+					}
+				}
+			}
+		}
+		return counts
+	}
+
+	sizeGiB := int32(1)
+	c, _, fakeClock, describes := newCachedCloud(t, &sizeGiB)
+	ctx := context.Background()
+	before := cacheRequests()
+
+	for range 2 {
+		disk, err := c.GetCachedDiskByID(ctx, "vol-test")
+		if err != nil {
+			t.Fatalf("GetCachedDiskByID() failed: %v", err)
+		}
+		if disk.CapacityGiB != 1 {
+			t.Fatalf("Expected capacity 1, got %d", disk.CapacityGiB)
+		}
+		// Callers may modify the disk without modifying the cache
+		disk.CapacityGiB = 100
+	}
+	if describes() != 1 {
+		t.Fatalf("Expected 1 DescribeVolumes call within the TTL, got %d", describes())
+	}
+
+	// The volume is described again once the TTL expired
+	sizeGiB = 2
+	fakeClock.Step(time.Minute)
+	disk, err := c.GetCachedDiskByID(ctx, "vol-test")
+	if err != nil {
+		t.Fatalf("GetCachedDiskByID() failed: %v", err)
+	}
+	if disk.CapacityGiB != 2 || describes() != 2 {
+		t.Fatalf("Expected the volume to be described again after the TTL, got capacity %d after %d DescribeVolumes calls", disk.CapacityGiB, describes())
+	}
+
+	after := cacheRequests()
+	if after[volumeCacheHit]-before[volumeCacheHit] != 1 || after[volumeCacheMiss]-before[volumeCacheMiss] != 2 {
+		t.Errorf("Expected 1 hit and 2 misses, got %v hits and %v misses", after[volumeCacheHit]-before[volumeCacheHit], after[volumeCacheMiss]-before[volumeCacheMiss])
+	}
+}
+
+func TestGetCachedDiskByIDErrorNotCached(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockEC2 := NewMockEC2API(mockCtrl)
+	c := newCloud(mockEC2).(*cloud)
+	c.volumeCache = newVolumeCache(time.Minute, testingclock.NewFakeClock(time.Now()))
+
+	gomock.InOrder(
+		mockEC2.EXPECT().DescribeVolumes(gomock.Any(), gomock.Any()).Return(nil, errors.New("RequestLimitExceeded")),
+		mockEC2.EXPECT().DescribeVolumes(gomock.Any(), gomock.Any()).Return(&ec2.DescribeVolumesOutput{Volumes: []types.Volume{{VolumeId: aws.String("vol-test")}}}, nil),
+	)
+
+	if _, err := c.GetCachedDiskByID(context.Background(), "vol-test"); err == nil {
+		t.Fatal("GetCachedDiskByID() failed: expected error, got nothing")
+	}
+	if _, err := c.GetCachedDiskByID(context.Background(), "vol-test"); err != nil {
+		t.Fatalf("GetCachedDiskByID() failed: %v", err)
+	}
+}
+
+func TestGetCachedDiskByIDDisabled(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockEC2 := NewMockEC2API(mockCtrl)
+	c := newCloud(mockEC2)
+
+	mockEC2.EXPECT().DescribeVolumes(gomock.Any(), gomock.Any()).Return(&ec2.DescribeVolumesOutput{Volumes: []types.Volume{{VolumeId: aws.String("vol-test")}}}, nil).Times(2)
+	for range 2 {
+		if _, err := c.GetCachedDiskByID(context.Background(), "vol-test"); err != nil {
+			t.Fatalf("GetCachedDiskByID() failed: %v", err)
+		}
+	}
+}
+
+func TestVolumeCacheBypassedByWaiters(t *testing.T) {
+	sizeGiB := int32(1)
+	c, _, _, describes := newCachedCloud(t, &sizeGiB)
+	ctx := context.Background()
+
+	if _, err := c.GetCachedDiskByID(ctx, "vol-test"); err != nil {
+		t.Fatalf("GetCachedDiskByID() failed: %v", err)
+	}
+	if _, err := c.WaitForAttachmentState(ctx, "vol-test", volumeDetachedState, "i-test", "", false); err != nil {
+		t.Fatalf("WaitForAttachmentState() failed: %v", err)
+	}
+	if _, err := c.GetDiskByID(ctx, "vol-test"); err != nil {
+		t.Fatalf("GetDiskByID() failed: %v", err)
+	}
+	if describes() != 3 {
+		t.Fatalf("Expected the waiter and GetDiskByID to describe the cached volume, got %d DescribeVolumes calls", describes())
+	}
+}
+
+func TestVolumeCacheInvalidatedOnModify(t *testing.T) {
+	sizeGiB := int32(1)
+	c, mockEC2, _, _ := newCachedCloud(t, &sizeGiB)
+	ctx := context.Background()
+	mockEC2.EXPECT().ModifyVolume(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, input *ec2.ModifyVolumeInput, _ ...func(*ec2.Options)) (*ec2.ModifyVolumeOutput, error) {
+			sizeGiB = *input.Size
+			return &ec2.ModifyVolumeOutput{VolumeModification: &types.VolumeModification{
+				VolumeId:          aws.String("vol-test"),
+				TargetSize:        input.Size,
+				ModificationState: types.VolumeModificationStateCompleted,
+			}}, nil
+		})
+	mockEC2.EXPECT().DescribeVolumesModifications(gomock.Any(), gomock.Any(), gomock.Any()).Return(&ec2.DescribeVolumesModificationsOutput{}, nil).AnyTimes()
+
+	if _, err := c.GetCachedDiskByID(ctx, "vol-test"); err != nil {
+		t.Fatalf("GetCachedDiskByID() failed: %v", err)
+	}
+	if _, err := c.ResizeOrModifyDisk(ctx, "vol-test", util.GiBToBytes(2), &ModifyDiskOptions{}); err != nil {
+		t.Fatalf("ResizeOrModifyDisk() failed: %v", err)
+	}
+	disk, err := c.GetCachedDiskByID(ctx, "vol-test")
+	if err != nil {
+		t.Fatalf("GetCachedDiskByID() failed: %v", err)
+	}
+	if disk.CapacityGiB != 2 {
+		t.Fatalf("Expected the modified volume with capacity 2, got %d", disk.CapacityGiB)
+	}
+}
+
+func TestVolumeCacheInvalidatedWhileDescribing(t *testing.T) {
+	vc := newVolumeCache(time.Minute, testingclock.NewFakeClock(time.Now()))
+
+	_, generation, ok := vc.get("vol-test")
+	if ok {
+		t.Fatal("Expected an empty cache")
+	}
+	// The volume is modified while it is described, the stale description must not be cached
+	vc.invalidate("vol-test")
+	vc.release("vol-test", &Disk{VolumeID: "vol-test"}, generation)
+	if _, _, ok := vc.get("vol-test"); ok {
+		t.Fatal("Expected the volume described before its invalidation not to be cached")
+	}
+}
+
+func TestVolumeCacheBounded(t *testing.T) {
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	vc := newVolumeCache(time.Minute, fakeClock)
+
+	for _, volumeID := range []string{"vol-1", "vol-2"} {
+		_, generation, _ := vc.get(volumeID)
+		vc.release(volumeID, &Disk{VolumeID: volumeID}, generation)
+	}
+	_, generation, _ := vc.get("vol-3")
+	vc.release("vol-3", nil, generation)
+	vc.invalidate("vol-1")
+	if len(vc.lookups) != 0 {
+		t.Fatalf("Expected no lookups once the volumes are described, got %d", len(vc.lookups))
+	}
+
+	// vol-2 expires without being looked up again, it is dropped when another volume is cached
+	fakeClock.Step(time.Minute)
+	_, generation, _ = vc.get("vol-3")
+	vc.release("vol-3", &Disk{VolumeID: "vol-3"}, generation)
+	if _, ok := vc.disks["vol-2"]; ok || len(vc.disks) != 1 {
+		t.Fatalf("Expected only vol-3 to be cached, got %v", vc.disks)
+	}
+}
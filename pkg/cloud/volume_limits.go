@@ -47,6 +47,33 @@ func init() {
 		dedicatedVolumeLimits[family+".32xlarge"] = 88
 		dedicatedVolumeLimits[family+".48xlarge"] = 128
 	}
+
+	for family := range nonNitroInstanceFamilies {
+		knownInstanceFamilies[family] = struct{}{}
+	}
+	for _, table := range []map[string]int{dedicatedVolumeLimits, maxVolumeLimits, nvmeInstanceStoreVolumes} {
+		for it := range table {
+			family := strings.Split(it, ".")[0]
+			knownInstanceFamilies[family] = struct{}{}
+			// Families with instance store volumes (for example m5d or c6gd) imply their EBS-only counterpart (m5, c6g)
+			if i := strings.IndexAny(family, "0123456789"); i >= 0 && strings.Contains(family[i:], "d") {
+				knownInstanceFamilies[family[:i]+strings.Replace(family[i:], "d", "", 1)] = struct{}{}
+			}
+		}
+	}
+}
+
+// knownInstanceFamilies is the set of instance families covered by the tables in this file
+var knownInstanceFamilies = map[string]struct{}{}
+
+// IsKnownInstanceType reports whether the tables in this file cover the family of the instance type.
+// The volume attach limit of instance types from unknown (usually newly released) families may be inaccurate.
+func IsKnownInstanceType(it string) bool {
+	if _, ok := GetEBSLimitForInstanceType(it); ok {
+		return true
+	}
+	_, ok := knownInstanceFamilies[strings.Split(it, ".")[0]]
+	return ok
 }
 
 var dedicatedVolumeLimits = map[string]int{}
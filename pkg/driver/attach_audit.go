@@ -0,0 +1,159 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+)
+
+// attachAuditTagTimeout is the timeout of the deferred updates of the attach audit tags
+var attachAuditTagTimeout = 30 * time.Second
+
+// attachAuditLimiter limits the updates of the attach audit tags of each volume to one per interval
+// Updates within the interval are deferred to its end rather than dropped, so the tags end up recording the last
+// attachment or detachment of the volume.
+type attachAuditLimiter struct {
+	mux      sync.Mutex
+	clock    clock.WithDelayedExecution
+	interval time.Duration
+	// lastTagged is when the tags of each volume were last updated, volumes updated more than interval ago are dropped
+	lastTagged map[string]time.Time
+	// pending holds the tags of the volumes whose update is deferred to the end of their interval
+	pending map[string]map[string]string
+}
+
+func newAttachAuditLimiter(c clock.WithDelayedExecution, interval time.Duration) *attachAuditLimiter {
+	return &attachAuditLimiter{clock: c, interval: interval, lastTagged: make(map[string]time.Time), pending: make(map[string]map[string]string)}
+}
+
+// allow checks if the tags of the volume may be updated now, and if so records the update
+// Otherwise the tags are merged into the update pending for the volume, which is passed to apply once the interval of
+// the volume ends.
+func (l *attachAuditLimiter) allow(volumeID string, tags map[string]string, apply func(map[string]string)) bool {
+	// The clock is read before taking the lock, as the fake clock of tests calls flush with its own lock held
+	now := l.clock.Now()
+	l.mux.Lock()
+	for id, last := range l.lastTagged {
+		if _, pending := l.pending[id]; !pending && now.Sub(last) >= l.interval {
+			delete(l.lastTagged, id)
+		}
+	}
+	last, ok := l.lastTagged[volumeID]
+	if !ok {
+		l.lastTagged[volumeID] = now
+		l.mux.Unlock()
+		return true
+	}
+	pending, scheduled := l.pending[volumeID]
+	if !scheduled {
+		pending = make(map[string]string, len(tags))
+		l.pending[volumeID] = pending
+	}
+	maps.Copy(pending, tags)
+	l.mux.Unlock()
+
+	if !scheduled {
+		deadline := last.Add(l.interval)
+		l.clock.AfterFunc(deadline.Sub(now), func() { l.flush(volumeID, deadline, apply) })
+	}
+	return false
+}
+
+// flush passes the tags pending for the volume to apply, recording the update at the given time
+func (l *attachAuditLimiter) flush(volumeID string, at time.Time, apply func(map[string]string)) {
+	l.mux.Lock()
+	tags := l.pending[volumeID]
+	delete(l.pending, volumeID)
+	l.lastTagged[volumeID] = at
+	l.mux.Unlock()
+	apply(tags)
+}
+
+// tagAttachAudit records the namespace of the PVC of the volume and the node it was attached to, or the time it was
+// detached, in the tags of the volume. Failures are logged, auditing never fails the attachment.
+func (d *ControllerService) tagAttachAudit(ctx context.Context, volumeID, nodeID string, attached bool) {
+	if d.attachAudit == nil {
+		return
+	}
+
+	now := d.attachAudit.clock.Now().UTC().Format(time.RFC3339)
+	tags := map[string]string{AttachAuditDetachedTimeTag: now}
+	if attached {
+		namespace, nodeName, err := d.attachmentConsumer(ctx, volumeID, nodeID)
+		if err != nil {
+			klog.ErrorS(err, "Failed to look up the consumer of the volume, attach audit tags are not updated", "volumeID", volumeID, "nodeID", nodeID)
+			return
+		}
+		tags = map[string]string{AttachAuditNodeTag: nodeName, AttachAuditAttachedTimeTag: now}
+		if namespace != "" {
+			tags[AttachAuditNamespaceTag] = namespace
+		}
+	}
+
+	deferred := func(tags map[string]string) {
+		ctx, cancel := context.WithTimeout(context.Background(), attachAuditTagTimeout)
+		defer cancel()
+		d.applyAttachAuditTags(ctx, volumeID, tags)
+	}
+	if !d.attachAudit.allow(volumeID, tags, deferred) {
+		klog.V(4).InfoS("Attach audit tags were updated recently, deferring the update", "volumeID", volumeID, "interval", d.attachAudit.interval)
+		return
+	}
+	d.applyAttachAuditTags(ctx, volumeID, tags)
+}
+
+func (d *ControllerService) applyAttachAuditTags(ctx context.Context, volumeID string, tags map[string]string) {
+	if err := d.cloud.TagDisk(ctx, volumeID, tags); err != nil {
+		klog.ErrorS(err, "Failed to update attach audit tags", "volumeID", volumeID)
+	}
+}
+
+// attachmentConsumer returns the namespace of the PVC bound to the volume and the name of the node it is attached to,
+// from the VolumeAttachment of the volume to the node with nodeID. The namespace is empty when the PV is not bound.
+func (d *ControllerService) attachmentConsumer(ctx context.Context, volumeID, nodeID string) (string, string, error) {
+	nodeName, err := d.nodeName(ctx, nodeID)
+	if err != nil {
+		return "", "", err
+	}
+	// VolumeAttachments only reference the PV, but are named after the volume handle and the node
+	vaName := volumeAttachmentName(volumeID, nodeName)
+	va, err := d.k8sClient.StorageV1().VolumeAttachments().Get(ctx, vaName, metav1.GetOptions{})
+	if err != nil {
+		return "", "", fmt.Errorf("could not get VolumeAttachment %q of volume %s to node %s: %w", vaName, volumeID, nodeName, err)
+	}
+	if va.Spec.Source.PersistentVolumeName == nil {
+		return "", "", fmt.Errorf("VolumeAttachment %q has no PersistentVolume", vaName)
+	}
+
+	pv, err := d.k8sClient.CoreV1().PersistentVolumes().Get(ctx, *va.Spec.Source.PersistentVolumeName, metav1.GetOptions{})
+	if err != nil {
+		return "", "", fmt.Errorf("could not get PersistentVolume %q: %w", *va.Spec.Source.PersistentVolumeName, err)
+	}
+	namespace := ""
+	if pv.Spec.ClaimRef != nil {
+		namespace = pv.Spec.ClaimRef.Namespace
+	}
+	return namespace, nodeName, nil
+}
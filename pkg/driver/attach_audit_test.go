@@ -0,0 +1,165 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+var attachAuditTime = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestPersistentVolume(name, volumeID, namespace string) *v1.PersistentVolume {
+	return &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeSource: v1.PersistentVolumeSource{CSI: &v1.CSIPersistentVolumeSource{Driver: DriverName, VolumeHandle: volumeID}},
+			ClaimRef:               &v1.ObjectReference{Namespace: namespace, Name: "claim"},
+		},
+	}
+}
+
+func newTestPVVolumeAttachment(volumeID, pvName, nodeName string) runtime.Object {
+	va := newTestVolumeAttachment(volumeID, nodeName, false)
+	va.Spec.Source.PersistentVolumeName = &pvName
+	return va
+}
+
+func newAttachAuditController(t *testing.T, objects ...runtime.Object) (ControllerService, *gomock.Controller, *cloud.MockCloud, *testingclock.FakeClock) {
+	t.Helper()
+	awsDriver, mockCtl, mockCloud := createControllerService(t)
+	awsDriver.k8sClient = fake.NewSimpleClientset(objects...)
+	fakeClock := testingclock.NewFakeClock(attachAuditTime)
+	awsDriver.attachAudit = newAttachAuditLimiter(fakeClock, time.Minute)
+	return awsDriver, mockCtl, mockCloud, fakeClock
+}
+
+func publishRequest(nodeID string) *csi.ControllerPublishVolumeRequest {
+	return &csi.ControllerPublishVolumeRequest{
+		VolumeId: "vol-test",
+		NodeId:   nodeID,
+		VolumeCapability: &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+			AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+		},
+	}
+}
+
+func TestAttachAuditTags(t *testing.T) {
+	awsDriver, mockCtl, mockCloud, fakeClock := newAttachAuditController(t,
+		newTestPersistentVolume("pv-test", "vol-test", "team-a"),
+		newTestPVVolumeAttachment("vol-test", "pv-test", "node-1"),
+		newTestPVVolumeAttachment("vol-test", "pv-test", "node-2"),
+		newTestCSINode("node-1", "i-1"),
+		newTestCSINode("node-2", "i-2"),
+	)
+	defer mockCtl.Finish()
+	ctx := context.Background()
+
+	// Tagging on publish
+	mockCloud.EXPECT().AttachDisk(gomock.Any(), "vol-test", "i-1").Return("/dev/xvdba", nil)
+	mockCloud.EXPECT().TagDisk(gomock.Any(), "vol-test", map[string]string{
+		AttachAuditNamespaceTag:    "team-a",
+		AttachAuditNodeTag:         "node-1",
+		AttachAuditAttachedTimeTag: "2024-06-01T12:00:00Z",
+	}).Return(nil)
+	if _, err := awsDriver.ControllerPublishVolume(ctx, publishRequest("i-1")); err != nil {
+		t.Fatalf("ControllerPublishVolume failed: %v", err)
+	}
+
+	// Rate limiting: a publish elsewhere within the interval is deferred to its end
+	fakeClock.Step(30 * time.Second)
+	mockCloud.EXPECT().AttachDisk(gomock.Any(), "vol-test", "i-2").Return("/dev/xvdba", nil)
+	if _, err := awsDriver.ControllerPublishVolume(ctx, publishRequest("i-2")); err != nil {
+		t.Fatalf("ControllerPublishVolume failed: %v", err)
+	}
+	mockCloud.EXPECT().TagDisk(gomock.Any(), "vol-test", map[string]string{
+		AttachAuditNamespaceTag:    "team-a",
+		AttachAuditNodeTag:         "node-2",
+		AttachAuditAttachedTimeTag: "2024-06-01T12:00:30Z",
+	}).Return(nil)
+	fakeClock.Step(30 * time.Second)
+
+	// Update on unpublish
+	fakeClock.Step(time.Minute)
+	mockCloud.EXPECT().DetachDisk(gomock.Any(), "vol-test", "i-2").Return(nil)
+	mockCloud.EXPECT().TagDisk(gomock.Any(), "vol-test", map[string]string{AttachAuditDetachedTimeTag: "2024-06-01T12:02:00Z"}).Return(nil)
+	if _, err := awsDriver.ControllerUnpublishVolume(ctx, &csi.ControllerUnpublishVolumeRequest{VolumeId: "vol-test", NodeId: "i-2"}); err != nil {
+		t.Fatalf("ControllerUnpublishVolume failed: %v", err)
+	}
+}
+
+func TestAttachAuditTagsUnresolved(t *testing.T) {
+	// Without a VolumeAttachment the consumer is unknown, the volume is attached without tagging it
+	awsDriver, mockCtl, mockCloud, _ := newAttachAuditController(t, newTestCSINode("node-1", "i-1"))
+	defer mockCtl.Finish()
+
+	mockCloud.EXPECT().AttachDisk(gomock.Any(), "vol-test", "i-1").Return("/dev/xvdba", nil)
+	if _, err := awsDriver.ControllerPublishVolume(context.Background(), publishRequest("i-1")); err != nil {
+		t.Fatalf("ControllerPublishVolume failed: %v", err)
+	}
+}
+
+func TestAttachAuditLimiter(t *testing.T) {
+	fakeClock := testingclock.NewFakeClock(attachAuditTime)
+	limiter := newAttachAuditLimiter(fakeClock, time.Minute)
+	var applied []map[string]string
+	apply := func(tags map[string]string) { applied = append(applied, tags) }
+
+	if !limiter.allow("vol-1", map[string]string{"a": "1"}, apply) || !limiter.allow("vol-2", map[string]string{"a": "1"}, apply) {
+		t.Fatal("Expected the first updates of the volumes to be allowed")
+	}
+	fakeClock.Step(20 * time.Second)
+	if limiter.allow("vol-1", map[string]string{"a": "2", "b": "2"}, apply) {
+		t.Fatal("Expected a second update within the interval to be deferred")
+	}
+	fakeClock.Step(20 * time.Second)
+	if limiter.allow("vol-1", map[string]string{"a": "3"}, apply) {
+		t.Fatal("Expected a third update within the interval to be deferred")
+	}
+	if len(applied) != 0 {
+		t.Fatalf("Expected no update before the end of the interval, got %v", applied)
+	}
+
+	fakeClock.Step(20 * time.Second)
+	expected := []map[string]string{{"a": "3", "b": "2"}}
+	if !reflect.DeepEqual(applied, expected) {
+		t.Fatalf("Expected the deferred updates to be merged and applied once, got %v", applied)
+	}
+	if len(limiter.lastTagged) != 2 {
+		t.Fatalf("Expected the deferred update to be recorded, got %v", limiter.lastTagged)
+	}
+
+	fakeClock.Step(time.Minute)
+	if !limiter.allow("vol-1", map[string]string{"a": "4"}, apply) {
+		t.Fatal("Expected an update after the interval to be allowed")
+	}
+	if len(limiter.lastTagged) != 1 {
+		t.Fatalf("Expected expired volumes to be dropped, got %v", limiter.lastTagged)
+	}
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+// AuditRequestIDMetadataKey is the gRPC metadata key of the request ID recorded in audit entries
+const AuditRequestIDMetadataKey = "x-request-id"
+
+// AuditEntry is the record of a node operation on a volume
+type AuditEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	// Operation is the name of the node RPC, such as NodePublishVolume
+	Operation string `json:"operation"`
+	VolumeID  string `json:"volumeID"`
+	NodeName  string `json:"nodeName"`
+	// TargetPath is the target, staging or volume path of the request, depending on the operation
+	TargetPath string `json:"targetPath,omitempty"`
+	// RequestID is the AuditRequestIDMetadataKey metadata of the request, empty when the caller did not set it
+	RequestID string `json:"requestID,omitempty"`
+	// Outcome is the gRPC status code of the response, OK when the operation succeeded
+	Outcome string `json:"outcome"`
+}
+
+// AuditLogger records node operations on volumes
+type AuditLogger interface {
+	Log(entry AuditEntry)
+}
+
+// NoopAuditLogger discards audit entries, it is used when --audit-log-file is not set
+type NoopAuditLogger struct{}
+
+func (NoopAuditLogger) Log(AuditEntry) {}
+
+// FileAuditLogger appends audit entries to a file, one JSON object per line
+type FileAuditLogger struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// NewFileAuditLogger opens the audit log at path for appending, creating it if it does not exist
+func NewFileAuditLogger(path string) (*FileAuditLogger, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("could not open audit log %q: %w", path, err)
+	}
+	return &FileAuditLogger{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+func (l *FileAuditLogger) Log(entry AuditEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.encoder.Encode(entry); err != nil {
+		klog.ErrorS(err, "Failed to write audit entry", "path", l.file.Name(), "operation", entry.Operation, "volumeID", entry.VolumeID)
+	}
+}
+
+// Close closes the audit log
+func (l *FileAuditLogger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// auditInterceptor records the node RPCs on volumes with the audit logger of the node service
+// RPCs that do not refer to a volume, such as NodeGetInfo, are not recorded
+func (d *NodeService) auditInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	method := path.Base(info.FullMethod)
+	volumeReq, ok := req.(interface{ GetVolumeId() string })
+	if !nodeMethods.Has(method) || !ok {
+		return handler(ctx, req)
+	}
+
+	resp, err := handler(ctx, req)
+	d.auditLogger.Log(AuditEntry{
+		Timestamp:  d.clock.Now().UTC(),
+		Operation:  method,
+		VolumeID:   volumeReq.GetVolumeId(),
+		NodeName:   os.Getenv("CSI_NODE_NAME"),
+		TargetPath: auditTargetPath(req),
+		RequestID:  auditRequestID(ctx),
+		Outcome:    status.Code(err).String(),
+	})
+	return resp, err
+}
+
+// auditTargetPath returns the path a node request operates on: the target path of publish requests, the staging
+// path of stage requests and the volume path of expand and stats requests
+func auditTargetPath(req interface{}) string {
+	if r, ok := req.(interface{ GetTargetPath() string }); ok && r.GetTargetPath() != "" {
+		return r.GetTargetPath()
+	}
+	if r, ok := req.(interface{ GetStagingTargetPath() string }); ok && r.GetStagingTargetPath() != "" {
+		return r.GetStagingTargetPath()
+	}
+	if r, ok := req.(interface{ GetVolumePath() string }); ok {
+		return r.GetVolumePath()
+	}
+	return ""
+}
+
+// auditRequestID returns the request ID set by the caller in the gRPC metadata of the request
+func auditRequestID(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.Get(AuditRequestIDMetadataKey); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+// recordingAuditLogger keeps the entries it is given
+type recordingAuditLogger struct {
+	entries []AuditEntry
+}
+
+func (l *recordingAuditLogger) Log(entry AuditEntry) {
+	l.entries = append(l.entries, entry)
+}
+
+func TestFileAuditLogger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	if err := os.WriteFile(path, []byte("{\"operation\":\"NodeStageVolume\"}\n"), 0600); err != nil {
+		t.Fatalf("Failed to create existing audit log: %v", err)
+	}
+
+	logger, err := NewFileAuditLogger(path)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	entry := AuditEntry{
+		Timestamp:  time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		Operation:  "NodePublishVolume",
+		VolumeID:   "vol-test",
+		NodeName:   "node-1",
+		TargetPath: "/target/path",
+		RequestID:  "req-1",
+		Outcome:    "OK",
+	}
+	logger.Log(entry)
+	logger.Log(AuditEntry{Timestamp: entry.Timestamp, Operation: "NodeUnpublishVolume", VolumeID: "vol-test", NodeName: "node-1", Outcome: "NotFound"})
+	if err = logger.Close(); err != nil {
+		t.Fatalf("Failed to close audit log: %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer file.Close()
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	expected := []string{
+		`{"operation":"NodeStageVolume"}`,
+		`{"timestamp":"2024-03-01T12:00:00Z","operation":"NodePublishVolume","volumeID":"vol-test","nodeName":"node-1","targetPath":"/target/path","requestID":"req-1","outcome":"OK"}`,
+		`{"timestamp":"2024-03-01T12:00:00Z","operation":"NodeUnpublishVolume","volumeID":"vol-test","nodeName":"node-1","outcome":"NotFound"}`,
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("Unexpected audit log:\n%v\nwant:\n%v", lines, expected)
+	}
+	var decoded AuditEntry
+	if err = json.Unmarshal([]byte(lines[1]), &decoded); err != nil {
+		t.Fatalf("Failed to decode audit entry: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, entry) {
+		t.Errorf("Decoded entry %+v, want %+v", decoded, entry)
+	}
+}
+
+func TestAuditInterceptor(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name          string
+		method        string
+		req           interface{}
+		requestID     string
+		err           error
+		expectedEntry *AuditEntry
+	}{
+		{
+			name:      "publish recorded with request ID",
+			method:    "/csi.v1.Node/NodePublishVolume",
+			req:       &csi.NodePublishVolumeRequest{VolumeId: "vol-test", StagingTargetPath: "/staging/path", TargetPath: "/target/path"},
+			requestID: "req-1",
+			expectedEntry: &AuditEntry{
+				Timestamp:  now,
+				Operation:  "NodePublishVolume",
+				VolumeID:   "vol-test",
+				NodeName:   "node-1",
+				TargetPath: "/target/path",
+				RequestID:  "req-1",
+				Outcome:    "OK",
+			},
+		},
+		{
+			name:   "failed unstage recorded with its status code",
+			method: "/csi.v1.Node/NodeUnstageVolume",
+			req:    &csi.NodeUnstageVolumeRequest{VolumeId: "vol-test", StagingTargetPath: "/staging/path"},
+			err:    status.Error(codes.Internal, "unmount failed"),
+			expectedEntry: &AuditEntry{
+				Timestamp:  now,
+				Operation:  "NodeUnstageVolume",
+				VolumeID:   "vol-test",
+				NodeName:   "node-1",
+				TargetPath: "/staging/path",
+				Outcome:    "Internal",
+			},
+		},
+		{
+			name:   "expand recorded with the volume path",
+			method: "/csi.v1.Node/NodeExpandVolume",
+			req:    &csi.NodeExpandVolumeRequest{VolumeId: "vol-test", VolumePath: "/target/path"},
+			expectedEntry: &AuditEntry{
+				Timestamp:  now,
+				Operation:  "NodeExpandVolume",
+				VolumeID:   "vol-test",
+				NodeName:   "node-1",
+				TargetPath: "/target/path",
+				Outcome:    "OK",
+			},
+		},
+		{
+			name:   "RPC without a volume not recorded",
+			method: "/csi.v1.Node/NodeGetInfo",
+			req:    &csi.NodeGetInfoRequest{},
+		},
+		{
+			name:   "controller RPC not recorded",
+			method: "/csi.v1.Controller/ControllerPublishVolume",
+			req:    &csi.ControllerPublishVolumeRequest{VolumeId: "vol-test"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("CSI_NODE_NAME", "node-1")
+			logger := &recordingAuditLogger{}
+			d := &NodeService{
+				auditLogger: logger,
+				clock:       testingclock.NewFakeClock(now),
+			}
+			ctx := context.Background()
+			if tc.requestID != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(AuditRequestIDMetadataKey, tc.requestID))
+			}
+
+			_, err := d.auditInterceptor(ctx, tc.req, &grpc.UnaryServerInfo{FullMethod: tc.method}, func(context.Context, interface{}) (interface{}, error) {
+				return nil, tc.err
+			})
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("Expected error %v, got %v", tc.err, err)
+			}
+
+			if tc.expectedEntry == nil {
+				if len(logger.entries) != 0 {
+					t.Fatalf("Expected no audit entry, got %+v", logger.entries)
+				}
+				return
+			}
+			if len(logger.entries) != 1 || !reflect.DeepEqual(logger.entries[0], *tc.expectedEntry) {
+				t.Fatalf("Expected audit entry %+v, got %+v", *tc.expectedEntry, logger.entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog/v2"
+)
+
+// backgroundLeaseName is the Lease the controller replicas elect the replica running the background tasks with
+const backgroundLeaseName = "ebs-csi-controller-background-tasks"
+
+var (
+	backgroundLeaseDuration = 15 * time.Second
+	backgroundRenewDeadline = 10 * time.Second
+	backgroundRetryPeriod   = 2 * time.Second
+	// namespaceFile holds the namespace of the pod, where the Lease is created
+	namespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// backgroundTasks runs the periodic tasks of the controller, such as the parameter drift check, on the replica holding
+// the backgroundLeaseName Lease only, so that the replicas do not all call EC2 and record events for the same volumes.
+// The tasks are stopped when the replica loses the Lease, and by stop.
+type backgroundTasks struct {
+	tasks []func(ctx context.Context)
+	// ctx is canceled by stop, it also bounds the goroutines of the controller that run on every replica
+	ctx    context.Context
+	cancel context.CancelFunc
+	// running tracks the tasks started, mux orders their start before waiting for them
+	mux     sync.Mutex
+	running sync.WaitGroup
+	// done is closed once the replica no longer runs for the Lease
+	done chan struct{}
+}
+
+func newBackgroundTasks() *backgroundTasks {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &backgroundTasks{ctx: ctx, cancel: cancel, done: make(chan struct{})}
+}
+
+// add registers a task, which must return once its context is canceled
+func (b *backgroundTasks) add(task func(ctx context.Context)) {
+	b.tasks = append(b.tasks, task)
+}
+
+// start runs the tasks whenever the replica holds the Lease, until stop is called
+// Without a Kubernetes client no leader can be elected, and the replica runs the tasks itself.
+func (b *backgroundTasks) start(k kubernetes.Interface) {
+	if len(b.tasks) == 0 {
+		close(b.done)
+		return
+	}
+
+	go func() {
+		defer close(b.done)
+		if k == nil {
+			klog.InfoS("No Kubernetes client, running the background tasks without leader election")
+			b.run(b.ctx)
+			return
+		}
+
+		lock, err := newBackgroundLeaseLock(k)
+		if err != nil {
+			klog.ErrorS(err, "Failed to create the Lease lock, the background tasks are not run")
+			return
+		}
+		// The replica runs for the Lease again after losing it, once its tasks stopped
+		for b.ctx.Err() == nil {
+			leaderelection.RunOrDie(b.ctx, leaderelection.LeaderElectionConfig{
+				Lock:            lock,
+				LeaseDuration:   backgroundLeaseDuration,
+				RenewDeadline:   backgroundRenewDeadline,
+				RetryPeriod:     backgroundRetryPeriod,
+				ReleaseOnCancel: true,
+				Name:            backgroundLeaseName,
+				Callbacks: leaderelection.LeaderCallbacks{
+					OnStartedLeading: b.run,
+					OnStoppedLeading: func() {
+						klog.InfoS("Lost or released the background tasks Lease, stopping the background tasks", "lease", backgroundLeaseName)
+					},
+				},
+			})
+			b.wait()
+		}
+	}()
+}
+
+// run starts the tasks, which run until ctx is canceled
+func (b *backgroundTasks) run(ctx context.Context) {
+	klog.InfoS("Starting the background tasks", "count", len(b.tasks))
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	for _, task := range b.tasks {
+		b.running.Add(1)
+		go func() {
+			defer b.running.Done()
+			task(ctx)
+		}()
+	}
+}
+
+// wait waits for the tasks started to return
+func (b *backgroundTasks) wait() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.running.Wait()
+}
+
+// stop stops the tasks and releases the Lease
+func (b *backgroundTasks) stop() {
+	if b == nil {
+		return
+	}
+	b.cancel()
+	<-b.done
+	b.wait()
+}
+
+// newBackgroundLeaseLock returns the lock of the Lease in the namespace of the pod, identified by its host name
+func newBackgroundLeaseLock(k kubernetes.Interface) (resourcelock.Interface, error) {
+	namespace := "kube-system"
+	if ns, err := os.ReadFile(namespaceFile); err == nil && len(strings.TrimSpace(string(ns))) > 0 {
+		namespace = strings.TrimSpace(string(ns))
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	identity := hostname + "_" + string(uuid.NewUUID())
+	return resourcelock.New(resourcelock.LeasesResourceLock, namespace, backgroundLeaseName, k.CoreV1(), k.CoordinationV1(), resourcelock.ResourceLockConfig{Identity: identity})
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestBackgroundTasks(t *testing.T) {
+	testCases := []struct {
+		name      string
+		clientset kubernetes.Interface
+	}{
+		{
+			name:      "leader elected",
+			clientset: fake.NewSimpleClientset(),
+		},
+		{
+			name: "no Kubernetes client",
+		},
+	}
+
+	defaultNamespaceFile := namespaceFile
+	namespaceFile = filepath.Join(t.TempDir(), "namespace")
+	defer func() { namespaceFile = defaultNamespaceFile }()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			started := make(chan struct{})
+			stopped := make(chan struct{})
+			background := newBackgroundTasks()
+			background.add(func(ctx context.Context) {
+				close(started)
+				<-ctx.Done()
+				close(stopped)
+			})
+			background.start(tc.clientset)
+
+			select {
+			case <-started:
+			case <-time.After(10 * time.Second):
+				t.Fatal("Background task was not started")
+			}
+			if tc.clientset != nil {
+				lease, err := tc.clientset.CoordinationV1().Leases("kube-system").Get(context.Background(), backgroundLeaseName, metav1.GetOptions{})
+				if err != nil || lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == "" {
+					t.Fatalf("Expected the Lease to be held, got %v, %v", lease, err)
+				}
+			}
+
+			background.stop()
+			select {
+			case <-stopped:
+			default:
+				t.Fatal("Expected the background task to be stopped")
+			}
+			if tc.clientset != nil {
+				lease, err := tc.clientset.CoordinationV1().Leases("kube-system").Get(context.Background(), backgroundLeaseName, metav1.GetOptions{})
+				if err != nil || (lease.Spec.HolderIdentity != nil && *lease.Spec.HolderIdentity != "") {
+					t.Fatalf("Expected the Lease to be released, got %v, %v", lease, err)
+				}
+			}
+		})
+	}
+}
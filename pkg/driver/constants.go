@@ -30,6 +30,10 @@ const (
 	// VolumeAttributePartition represents key for partition config in VolumeContext
 	// this represents the partition number on a device used to mount
 	VolumeAttributePartition = "partition"
+
+	// VolumeAttributePartitionLabel represents key for the GPT partition label of the partition on a device used to
+	// mount, mutually exclusive with VolumeAttributePartition
+	VolumeAttributePartitionLabel = "partitionLabel"
 )
 
 // constants of keys in volume parameters
@@ -49,6 +53,12 @@ const (
 	// ThroughputKey represents key for throughput
 	ThroughputKey = "throughput"
 
+	// ThroughputPerGiBKey represents key for throughput per GiB of gp3 volumes
+	ThroughputPerGiBKey = "throughputpergib"
+
+	// VolumeInitializationRateKey represents key for the initialization rate in MiB/s of volumes created from snapshots
+	VolumeInitializationRateKey = "volumeinitializationrate"
+
 	// EncryptedKey represents key for whether filesystem is encrypted
 	EncryptedKey = "encrypted"
 
@@ -99,6 +109,64 @@ const (
 	// Ext4ClusterSizeKey configures the cluster size when formatting an ext4 volume with the bigalloc option enabled
 	Ext4ClusterSizeKey = "ext4clustersize"
 
+	// Ext4StrideKey configures the RAID stride, in filesystem blocks, when formatting an ext4 volume
+	Ext4StrideKey = "ext4stride"
+
+	// Ext4StripeWidthKey configures the RAID stripe width, in filesystem blocks, when formatting an ext4 volume
+	Ext4StripeWidthKey = "ext4stripewidth"
+
+	// Ext4LazyInitKey enables or disables lazy inode table and journal initialization when formatting an ext4 volume
+	Ext4LazyInitKey = "ext4lazyinit"
+
+	// SnapshotOnDeleteKey tags the volume with SnapshotOnDeleteTag, so that DeleteVolume snapshots it before deleting it
+	SnapshotOnDeleteKey = "snapshotondelete"
+
+	// NTFSAllocationUnitSizeKey is the volume context key of the allocation unit size in bytes to format an ntfs volume with
+	NTFSAllocationUnitSizeKey = "ebs.csi.aws.com/ntfsAllocationUnitSize"
+
+	// VolumeLabelKey is the volume context key of the label to format an ntfs volume with
+	VolumeLabelKey = "ebs.csi.aws.com/volumeLabel"
+
+	// XFSProjectQuotaKey is the volume context key enabling project quotas (the pquota mount option) on an xfs volume
+	XFSProjectQuotaKey = "xfsprojectquota"
+
+	// XFSProjectIDKey is the volume context key of the project ID the root of an xfs volume is assigned to when published
+	XFSProjectIDKey = "xfsprojectid"
+
+	// XFSReflinkKey, XFSBigtimeKey and XFSInobtcountKey are the volume context keys enabling or disabling the reflink,
+	// bigtime and inobtcount metadata features (the -m option of mkfs.xfs) of an xfs volume when it is formatted, as
+	// the kernels older than 5.10 of some nodes cannot mount filesystems with the features recent mkfs.xfs enables
+	XFSReflinkKey    = "xfsreflink"
+	XFSBigtimeKey    = "xfsbigtime"
+	XFSInobtcountKey = "xfsinobtcount"
+
+	// Ext4JournalChecksumKey is the volume context key enabling journal checksums (the journal_checksum mount option)
+	// on an ext4 volume
+	Ext4JournalChecksumKey = "ext4journalchecksum"
+
+	// Ext4AsyncCommitKey is the volume context key enabling asynchronous journal commits (the data=journal and
+	// journal_async_commit mount options) on an ext4 volume. It requires Ext4JournalChecksumKey.
+	Ext4AsyncCommitKey = "ext4asynccommit"
+
+	// ExternalFsManagementKey is the volume context key handing the filesystem of a volume over to an operator running
+	// in the pod, which resizes it itself. NodeStageVolume and NodeExpandVolume then never resize the filesystem.
+	ExternalFsManagementKey = "ebs.csi.aws.com/externalFsManagement"
+
+	// EphemeralKey is the volume context key set to true by kubelet for CSI ephemeral inline volumes, which are published
+	// as a tmpfs without being staged. Kubelet only sets it when the CSIDriver has podInfoOnMount enabled.
+	EphemeralKey = "csi.storage.k8s.io/ephemeral"
+
+	// EphemeralSizeKey is the volume attribute of a CSI ephemeral inline volume holding the size limit of its tmpfs,
+	// as a resource quantity such as 64Mi
+	EphemeralSizeKey = "size"
+
+	// LuksPassphraseSecretKey is the volume context key naming the NodeStageSecrets entry that holds the LUKS passphrase
+	// of a volume whose EncryptedKey volume context is true, DefaultLuksPassphraseSecretKey when unset
+	LuksPassphraseSecretKey = "ebs.csi.aws.com/luksPassphraseSecretKey"
+
+	// DefaultLuksPassphraseSecretKey is the NodeStageSecrets entry holding the LUKS passphrase by default
+	DefaultLuksPassphraseSecretKey = "passphrase"
+
 	// TagKeyPrefix contains the prefix of a volume parameter that designates it as
 	// a tag to be attached to the resource
 	TagKeyPrefix = "tagSpecification"
@@ -108,6 +176,15 @@ const (
 const (
 	// FastSnapShotRestoreAvailabilityZones represents key for fast snapshot restore availability zones
 	FastSnapshotRestoreAvailabilityZones = "fastsnapshotrestoreavailabilityzones"
+
+	// CopyToRegionsKey represents key for the comma separated regions the snapshot is copied to once it completes
+	CopyToRegionsKey = "copytoregions"
+
+	// CopyCompleteTimeoutKey represents key for how long the driver waits for the snapshot to complete and be copied
+	CopyCompleteTimeoutKey = "copycompletetimeout"
+
+	// DeleteCopiesKey represents key for whether DeleteSnapshot deletes the copies of the snapshot along with it
+	DeleteCopiesKey = "deletecopies"
 )
 
 // constants for volume tags and their values
@@ -148,12 +225,70 @@ const (
 	// the external provisioner sidecar is started with --extra-create-metadata=true and
 	// thus provides such metadata to the CSI driver.
 	PVNameTag = "kubernetes.io/created-for/pv/name"
+
+	// ProvisionedVolumeTypeTag, ProvisionedIOPSTag and ProvisionedThroughputTag record the volume type, IOPS and
+	// throughput a volume was created or last modified with by the driver. They are applied only when
+	// --parameter-drift-check-interval is set, and IOPS and throughput only when they were requested explicitly.
+	ProvisionedVolumeTypeTag = "ebs.csi.aws.com/provisioned-type"
+	ProvisionedIOPSTag       = "ebs.csi.aws.com/provisioned-iops"
+	ProvisionedThroughputTag = "ebs.csi.aws.com/provisioned-throughput"
+
+	// CreatedByTag is applied to the snapshots the node takes of a volume before expanding its filesystem when
+	// --snapshot-before-expand is set, with the value CreatedByPreExpand
+	CreatedByTag       = "ebs.csi.aws.com/created-by"
+	CreatedByPreExpand = "pre-expand"
+	// CreatedByPreDelete is the value of CreatedByTag of the final snapshots taken of volumes with SnapshotOnDeleteTag
+	CreatedByPreDelete = "pre-delete"
+
+	// SnapshotOnDeleteTag marks a volume to be snapshotted by DeleteVolume before it is deleted, when
+	// --enable-snapshot-on-delete is set. VolumeDeletionTimeTag records when the final snapshot was taken.
+	SnapshotOnDeleteTag   = "ebs.csi.aws.com/snapshot-on-delete"
+	VolumeDeletionTimeTag = "ebs.csi.aws.com/volume-deletion-time"
+
+	// SnapshotCopyRegionsTag records the regions a snapshot is copied to with CopyToRegionsKey, and
+	// SnapshotDeleteCopiesTag that DeleteSnapshot deletes the copies along with it with DeleteCopiesKey.
+	SnapshotCopyRegionsTag  = "ebs.csi.aws.com/copy-to-regions"
+	SnapshotDeleteCopiesTag = "ebs.csi.aws.com/delete-copies"
+	// SnapshotCopyTimeoutTag records the CopyCompleteTimeoutKey of a snapshot copied to other regions, so that its copy
+	// can be resumed after a restart, and SnapshotCopyStateTag whether the copy completed or failed.
+	SnapshotCopyTimeoutTag = "ebs.csi.aws.com/copy-complete-timeout"
+	SnapshotCopyStateTag   = "ebs.csi.aws.com/copy-state"
+
+	// SnapshotCopyStateCompleted and SnapshotCopyStateFailed are the values of SnapshotCopyStateTag
+	SnapshotCopyStateCompleted = "completed"
+	SnapshotCopyStateFailed    = "failed"
+
+	// AttachAuditNamespaceTag, AttachAuditNodeTag, AttachAuditAttachedTimeTag and AttachAuditDetachedTimeTag record the
+	// namespace of the PVC and the node a volume was last attached to, when, and when it was last detached. They are
+	// applied only when --attach-audit-tags is set.
+	AttachAuditNamespaceTag    = "ebs.csi.aws.com/last-attached-namespace"
+	AttachAuditNodeTag         = "ebs.csi.aws.com/last-attached-node"
+	AttachAuditAttachedTimeTag = "ebs.csi.aws.com/last-attached-time"
+	AttachAuditDetachedTimeTag = "ebs.csi.aws.com/last-detached-time"
+
+	// DriverTagKeyPrefix is the prefix of the tags managed by the driver, which a VolumeAttributesClass cannot modify
+	DriverTagKeyPrefix = "ebs.csi.aws.com/"
+)
+
+// constants for --heal-parameter-drift
+const (
+	// HealParameterDriftTags updates the provisioned parameter tags of a volume to match the volume
+	HealParameterDriftTags = "tags"
 )
 
 // constants for default command line flag values
 const (
 	DefaultCSIEndpoint                       = "unix://tmp/csi.sock"
 	DefaultModifyVolumeRequestHandlerTimeout = 2 * time.Second
+	DefaultDeviceDiscoveryPollInterval       = 1 * time.Second
+	DefaultDeviceDiscoveryRetries            = 5
+	DefaultDeviceDiscoveryInterval           = 1 * time.Second
+	DefaultMetricsShutdownTimeout            = 5 * time.Second
+	DefaultFormatTimeout                     = 10 * time.Minute
+	DefaultDrainTimeout                      = 20 * time.Second
+	DefaultCapacityCacheTTL                  = 5 * time.Minute
+	DefaultAttachAuditTagsInterval           = 1 * time.Minute
+	DefaultProbeTimeout                      = 3 * time.Second
 )
 
 // constants for fstypes
@@ -174,6 +309,83 @@ const (
 const (
 	// AgentNotReadyNodeTaintKey contains the key of taints to be removed on driver startup
 	AgentNotReadyNodeTaintKey = "ebs.csi.aws.com/agent-not-ready"
+	// DriverReadyEventReason is the reason of the node event recorded after the not-ready taint is removed
+	DriverReadyEventReason = "EBSCSIDriverReady"
+	// InterruptionNoticeEventReason is the reason of the node event recorded when a pending stop or termination of the instance is found
+	InterruptionNoticeEventReason = "EBSCSIInterruptionNotice"
+)
+
+// constants for controller k8s API use
+const (
+	// ParameterDriftEventReason is the reason of the PVC event recorded when the type, IOPS or throughput of a volume
+	// no longer match its provisioned parameter tags
+	ParameterDriftEventReason = "EBSCSIParameterDrift"
+	// VolumeIOSuspendedEventReason is the reason of the PVC event recorded when EBS suspended IO on a volume
+	VolumeIOSuspendedEventReason = "EBSCSIVolumeIOSuspended"
+
+	// AutoEnableVolumeIOAnnotation opts a PV out of --auto-enable-volume-io when set to "false"
+	AutoEnableVolumeIOAnnotation = "ebs.csi.aws.com/auto-enable-volume-io"
+
+	// CreatedAtAnnotation and the initial annotations record, on the PVs of the volumes created by the driver when
+	// --annotate-pv-on-create is set, when the volume was created and the settings EC2 created it with
+	CreatedAtAnnotation               = "ebs.csi.aws.com/created-at"
+	InitialVolumeTypeAnnotation       = "ebs.csi.aws.com/initial-type"
+	InitialIOPSAnnotation             = "ebs.csi.aws.com/initial-iops"
+	InitialThroughputAnnotation       = "ebs.csi.aws.com/initial-throughput"
+	InitialEncryptedAnnotation        = "ebs.csi.aws.com/initial-encrypted"
+	InitialAvailabilityZoneAnnotation = "ebs.csi.aws.com/initial-availability-zone"
+)
+
+// constants for controller metrics
+const (
+	// ExcludedZoneMetric counts CreateVolume calls whose picked Availability Zone was excluded by --excluded-zones,
+	// labeled with the zone and whether another zone was used or the call failed
+	ExcludedZoneMetric = "controller_excluded_zone_total"
+
+	// ExcludedZoneOutcomeSkipped and ExcludedZoneOutcomeRejected are the values of the outcome label of ExcludedZoneMetric
+	ExcludedZoneOutcomeSkipped  = "skipped"
+	ExcludedZoneOutcomeRejected = "rejected"
+
+	// ParameterDriftMetric counts the volumes found by each parameter drift check whose type, IOPS or throughput no
+	// longer match their provisioned parameter tags, labeled with the parameter
+	ParameterDriftMetric = "controller_volume_parameter_drift_total"
+
+	// VolumeIOSuspendedMetric counts the volumes found by the volume status check with IO suspended by EBS, labeled with
+	// the action taken
+	VolumeIOSuspendedMetric = "controller_volume_io_suspended_total"
+
+	// VolumeIOSuspendedActionReported, VolumeIOSuspendedActionOptedOut, VolumeIOSuspendedActionEnabled and
+	// VolumeIOSuspendedActionEnableFailed are the values of the action label of VolumeIOSuspendedMetric
+	VolumeIOSuspendedActionReported     = "reported"
+	VolumeIOSuspendedActionOptedOut     = "opted_out"
+	VolumeIOSuspendedActionEnabled      = "enabled"
+	VolumeIOSuspendedActionEnableFailed = "enable_failed"
+
+	// SnapshotCopyFailedMetric counts the snapshots that were not copied to all the regions of CopyToRegionsKey
+	// within their CopyCompleteTimeoutKey
+	SnapshotCopyFailedMetric = "controller_snapshot_copy_failed_total"
+
+	// CreateVolumeQueueDepthMetric is the gauge of CreateVolume calls waiting in the fair queue, labeled with the class
+	// of their StorageClass
+	CreateVolumeQueueDepthMetric = "controller_create_volume_queue_depth"
+)
+
+// constants for node metrics
+const (
+	// NodeUnstageMultiRefMetric counts NodeUnstageVolume calls that found more than one mount reference to the staged
+	// device, which usually signals a leaked bind mount
+	NodeUnstageMultiRefMetric = "node_unstage_multiref_total"
+	// NodeRPCDurationMetric is the histogram of node RPC durations, labeled with the method and the result of the call
+	NodeRPCDurationMetric = "node_rpc_duration_seconds"
+	// AttachedVolumesMetric is the gauge of volumes staged on the node, labeled with the node name and instance type
+	AttachedVolumesMetric = "attached_volumes_total"
+	// FsTypeMismatchMetric counts NodeStageVolume calls refused because the device already contains a filesystem
+	// incompatible with the requested fstype, labeled with both types
+	FsTypeMismatchMetric = "node_stage_fstype_mismatch_total"
+
+	// NodeRPCResultSuccess and NodeRPCResultError are the values of the result label of NodeRPCDurationMetric
+	NodeRPCResultSuccess = "success"
+	NodeRPCResultError   = "error"
 )
 
 type fileSystemConfig struct {
@@ -189,35 +401,84 @@ var (
 	FileSystemConfigs = map[string]fileSystemConfig{
 		FSTypeExt2: {
 			NotSupportedParams: map[string]struct{}{
-				Ext4BigAllocKey:    {},
-				Ext4ClusterSizeKey: {},
+				Ext4BigAllocKey:           {},
+				Ext4ClusterSizeKey:        {},
+				Ext4StrideKey:             {},
+				Ext4StripeWidthKey:        {},
+				Ext4LazyInitKey:           {},
+				NTFSAllocationUnitSizeKey: {},
+				VolumeLabelKey:            {},
+				XFSProjectQuotaKey:        {},
+				XFSProjectIDKey:           {},
+				XFSReflinkKey:             {},
+				XFSBigtimeKey:             {},
+				XFSInobtcountKey:          {},
+				Ext4JournalChecksumKey:    {},
+				Ext4AsyncCommitKey:        {},
 			},
 		},
 		FSTypeExt3: {
 			NotSupportedParams: map[string]struct{}{
-				Ext4BigAllocKey:    {},
-				Ext4ClusterSizeKey: {},
+				Ext4BigAllocKey:           {},
+				Ext4ClusterSizeKey:        {},
+				Ext4StrideKey:             {},
+				Ext4StripeWidthKey:        {},
+				Ext4LazyInitKey:           {},
+				NTFSAllocationUnitSizeKey: {},
+				VolumeLabelKey:            {},
+				XFSProjectQuotaKey:        {},
+				XFSProjectIDKey:           {},
+				XFSReflinkKey:             {},
+				XFSBigtimeKey:             {},
+				XFSInobtcountKey:          {},
+				Ext4JournalChecksumKey:    {},
+				Ext4AsyncCommitKey:        {},
 			},
 		},
 		FSTypeExt4: {
-			NotSupportedParams: map[string]struct{}{},
+			NotSupportedParams: map[string]struct{}{
+				NTFSAllocationUnitSizeKey: {},
+				VolumeLabelKey:            {},
+				XFSProjectQuotaKey:        {},
+				XFSProjectIDKey:           {},
+				XFSReflinkKey:             {},
+				XFSBigtimeKey:             {},
+				XFSInobtcountKey:          {},
+			},
 		},
 		FSTypeXfs: {
 			NotSupportedParams: map[string]struct{}{
-				BytesPerInodeKey:   {},
-				NumberOfInodesKey:  {},
-				Ext4BigAllocKey:    {},
-				Ext4ClusterSizeKey: {},
+				BytesPerInodeKey:          {},
+				NumberOfInodesKey:         {},
+				Ext4BigAllocKey:           {},
+				Ext4ClusterSizeKey:        {},
+				Ext4StrideKey:             {},
+				Ext4StripeWidthKey:        {},
+				Ext4LazyInitKey:           {},
+				NTFSAllocationUnitSizeKey: {},
+				VolumeLabelKey:            {},
+				Ext4JournalChecksumKey:    {},
+				Ext4AsyncCommitKey:        {},
 			},
 		},
 		FSTypeNtfs: {
 			NotSupportedParams: map[string]struct{}{
-				BlockSizeKey:       {},
-				InodeSizeKey:       {},
-				BytesPerInodeKey:   {},
-				NumberOfInodesKey:  {},
-				Ext4BigAllocKey:    {},
-				Ext4ClusterSizeKey: {},
+				BlockSizeKey:           {},
+				InodeSizeKey:           {},
+				BytesPerInodeKey:       {},
+				NumberOfInodesKey:      {},
+				Ext4BigAllocKey:        {},
+				Ext4ClusterSizeKey:     {},
+				Ext4StrideKey:          {},
+				Ext4StripeWidthKey:     {},
+				Ext4LazyInitKey:        {},
+				XFSProjectQuotaKey:     {},
+				XFSProjectIDKey:        {},
+				XFSReflinkKey:          {},
+				XFSBigtimeKey:          {},
+				XFSInobtcountKey:       {},
+				Ext4JournalChecksumKey: {},
+				Ext4AsyncCommitKey:     {},
 			},
 		},
 	}
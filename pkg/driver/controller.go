@@ -18,23 +18,31 @@ package driver
 
 import (
 	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/aws/aws-sdk-go-v2/aws/arn"
 	"github.com/awslabs/volume-modifier-for-k8s/pkg/rpc"
 	csi "github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud/metadata"
 	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/coalescer"
 	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/driver/internal"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/metrics"
 	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/util"
 	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/util/template"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
 )
 
 // Supported access modes
@@ -43,6 +51,15 @@ const (
 	MultiNodeMultiWriter = csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER
 )
 
+// ErrorReasonIOPSRatioExceeded, ErrorReasonZoneExcluded, ErrorReasonKMSKeyInvalid and ErrorReasonAttachLimit are the
+// ErrorInfo reasons attached to the corresponding controller operation failures, see controllerError
+const (
+	ErrorReasonIOPSRatioExceeded = "IOPS_RATIO_EXCEEDED"
+	ErrorReasonZoneExcluded      = "ZONE_EXCLUDED"
+	ErrorReasonKMSKeyInvalid     = "KMS_KEY_INVALID"
+	ErrorReasonAttachLimit       = "ATTACH_LIMIT"
+)
+
 var (
 	// controllerCaps represents the capability of controller service
 	controllerCaps = []csi.ControllerServiceCapability_RPC_Type{
@@ -50,8 +67,14 @@ var (
 		csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME,
 		csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
 		csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
+		// LIST_VOLUMES_PUBLISHED_NODES is not advertised: ListVolumes only covers the volumes tagged by the driver, and
+		// the csi-attacher would detach the statically provisioned volumes missing from it
+		csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
 		csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
 		csi.ControllerServiceCapability_RPC_MODIFY_VOLUME,
+		csi.ControllerServiceCapability_RPC_GET_VOLUME,
+		csi.ControllerServiceCapability_RPC_VOLUME_CONDITION,
+		csi.ControllerServiceCapability_RPC_GET_CAPACITY,
 	}
 )
 
@@ -62,18 +85,106 @@ type ControllerService struct {
 	cloud                 cloud.Cloud
 	inFlight              *internal.InFlight
 	options               *Options
+	tags                  *TagManager
 	modifyVolumeCoalescer coalescer.Coalescer[modifyVolumeRequest, int32]
+	// k8sClient is used to look up the Kubernetes objects of volumes, nil when the driver does not run in Kubernetes
+	k8sClient kubernetes.Interface
+	// attachments caches the VolumeAttachments compared with the attachments of volumes, nil without k8sClient
+	attachments *attachmentListers
+	// eventRecorder records the events of the controller, nil when the driver does not run in Kubernetes
+	eventRecorder record.EventRecorder
+	// createVolumeQueue queues CreateVolume calls by StorageClass, nil when --create-volume-fair-queue-threshold is 0
+	createVolumeQueue *internal.FairQueue
+	// capacity caches the storage used by the volumes of the cluster for GetCapacity
+	capacity *capacityCache
+	// attachAudit limits the updates of the attach audit tags of volumes, nil when --attach-audit-tags is not set
+	attachAudit *attachAuditLimiter
+	// nodeNames caches the names of the nodes by node ID, to look up their VolumeAttachments
+	nodeNames *nodeNameCache
+	// background runs the periodic tasks of the controller on the elected replica
+	background *backgroundTasks
+	// ioSuspendedVolumes are the volumes with IO suspended already reported by the volume status check, and whether
+	// they were handled, false while enabling their IO is retried
+	ioSuspendedVolumes map[string]bool
+	// snapshotCopies are the IDs of the snapshots being copied to other regions in the background
+	snapshotCopies *sync.Map
+	// pvAnnotations are the names of the PVs waiting to be annotated by --annotate-pv-on-create in the background
+	pvAnnotations *sync.Map
 	rpc.UnimplementedModifyServer
 }
 
 // NewControllerService creates a new controller service
-func NewControllerService(c cloud.Cloud, o *Options) *ControllerService {
-	return &ControllerService{
+func NewControllerService(c cloud.Cloud, o *Options, k kubernetes.Interface) *ControllerService {
+	controllerService := &ControllerService{
 		cloud:                 c,
 		options:               o,
 		inFlight:              internal.NewInFlight(),
+		tags:                  NewTagManager(o),
 		modifyVolumeCoalescer: newModifyVolumeCoalescer(c, o),
+		k8sClient:             k,
+		eventRecorder:         newEventRecorder(k, ""),
+		capacity:              newCapacityCache(clock.RealClock{}),
+		nodeNames:             newNodeNameCache(),
+		background:            newBackgroundTasks(),
+		snapshotCopies:        &sync.Map{},
+		pvAnnotations:         &sync.Map{},
+	}
+
+	if k != nil {
+		controllerService.attachments = newAttachmentListers(controllerService.background.ctx, k)
+	}
+
+	if o.AttachAuditTags {
+		controllerService.attachAudit = newAttachAuditLimiter(clock.RealClock{}, o.AttachAuditTagsInterval)
+	}
+
+	if o.CreateVolumeFairQueueThreshold > 0 {
+		controllerService.createVolumeQueue = internal.NewFairQueue(o.CreateVolumeFairQueueThreshold, o.CreateVolumeClassInFlight, recordCreateVolumeQueueDepth)
+	}
+
+	if o.ExtraTagsFile != "" {
+		if err := controllerService.tags.Reload(); err != nil {
+			klog.ErrorS(err, "Failed to load extra tags file, using --extra-tags only", "path", o.ExtraTagsFile)
+		}
+		// The watch lasts as long as the controller, it is stopped along with the background tasks
+		if err := controllerService.tags.Watch(controllerService.background.ctx); err != nil {
+			klog.ErrorS(err, "Failed to watch extra tags file, changes are not reloaded", "path", o.ExtraTagsFile)
+		}
+	}
+
+	controllerService.background.add(controllerService.resumeSnapshotCopies)
+	if o.ParameterDriftCheckInterval > 0 {
+		controllerService.background.add(func(ctx context.Context) { controllerService.watchParameterDrift(ctx, k) })
+	}
+
+	if o.VolumeStatusCheckInterval > 0 {
+		controllerService.ioSuspendedVolumes = make(map[string]bool)
+		controllerService.background.add(func(ctx context.Context) { controllerService.watchVolumeStatus(ctx, k) })
+	}
+	controllerService.background.start(k)
+
+	return controllerService
+}
+
+// extraTags returns the tags of --extra-tags and --extra-tags-file attached to each dynamically provisioned resource
+func (d *ControllerService) extraTags() map[string]string {
+	if d.tags == nil {
+		return d.options.ExtraTags
 	}
+	return d.tags.Tags()
+}
+
+// renderExtraTags interpolates the values of the extra tags with props, such as team={{ .PVCNamespace }}, and validates
+// the rendered tags, whose values may only exceed the length limit of AWS once rendered
+func (d *ControllerService) renderExtraTags(props template.ExtraTagProps) (map[string]string, error) {
+	tags, err := template.EvaluateTags(d.extraTags(), props, d.options.WarnOnInvalidTag)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Error interpolating the extra tag value: %v", err)
+	}
+	if err = validateExtraTags(tags, d.options.WarnOnInvalidTag); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid extra tag value: %v", err)
+	}
+	return tags, nil
 }
 
 func (d *ControllerService) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
@@ -103,12 +214,22 @@ func (d *ControllerService) CreateVolume(ctx context.Context, req *csi.CreateVol
 	}
 	defer d.inFlight.Delete(volName)
 
+	if d.createVolumeQueue != nil {
+		release, err := d.createVolumeQueue.Acquire(ctx, createVolumeClass(req.GetParameters()))
+		if err != nil {
+			return nil, status.Errorf(codes.Aborted, "Create volume request for %s was not started while waiting in the queue: %v", volName, err)
+		}
+		defer release()
+	}
+
 	var (
 		volumeType             string
 		iopsPerGB              int32
 		allowIOPSPerGBIncrease bool
 		iops                   int32
 		throughput             int32
+		throughputPerGiB       int32
+		initializationRate     int32
 		isEncrypted            bool
 		blockExpress           bool
 		kmsKeyID               string
@@ -123,6 +244,9 @@ func (d *ControllerService) CreateVolume(ctx context.Context, req *csi.CreateVol
 		numberOfInodes  string
 		ext4BigAlloc    bool
 		ext4ClusterSize string
+		ext4Stride      string
+		ext4StripeWidth string
+		ext4LazyInit    string
 	)
 
 	tProps := new(template.PVProps)
@@ -153,6 +277,18 @@ func (d *ControllerService) CreateVolume(ctx context.Context, req *csi.CreateVol
 				return nil, status.Errorf(codes.InvalidArgument, "Could not parse invalid throughput: %v", err)
 			}
 			throughput = int32(parseThroughput)
+		case ThroughputPerGiBKey:
+			parseThroughputPerGiB, parseThroughputPerGiBErr := strconv.ParseInt(value, 10, 32)
+			if parseThroughputPerGiBErr != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "Could not parse invalid throughputPerGiB: %v", parseThroughputPerGiBErr)
+			}
+			throughputPerGiB = int32(parseThroughputPerGiB)
+		case VolumeInitializationRateKey:
+			parseInitializationRate, parseInitializationRateErr := strconv.ParseInt(value, 10, 32)
+			if parseInitializationRateErr != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "Could not parse invalid volumeInitializationRate: %v", parseInitializationRateErr)
+			}
+			initializationRate = int32(parseInitializationRate)
 		case EncryptedKey:
 			if value == "true" {
 				isEncrypted = true
@@ -201,6 +337,33 @@ func (d *ControllerService) CreateVolume(ctx context.Context, req *csi.CreateVol
 				return nil, status.Errorf(codes.InvalidArgument, "Could not parse ext4ClusterSize (%s): %v", value, err)
 			}
 			ext4ClusterSize = value
+		case Ext4StrideKey:
+			if isAlphanumeric := util.StringIsAlphanumeric(value); !isAlphanumeric {
+				return nil, status.Errorf(codes.InvalidArgument, "Could not parse ext4Stride (%s): %v", value, err)
+			}
+			ext4Stride = value
+		case Ext4StripeWidthKey:
+			if isAlphanumeric := util.StringIsAlphanumeric(value); !isAlphanumeric {
+				return nil, status.Errorf(codes.InvalidArgument, "Could not parse ext4StripeWidth (%s): %v", value, err)
+			}
+			ext4StripeWidth = value
+		case Ext4LazyInitKey:
+			lazyInit, parseErr := strconv.ParseBool(value)
+			if parseErr != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "Could not parse ext4LazyInit (%s): %v", value, parseErr)
+			}
+			ext4LazyInit = strconv.FormatBool(lazyInit)
+		case SnapshotOnDeleteKey:
+			snapshotOnDelete, parseErr := strconv.ParseBool(value)
+			if parseErr != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "Could not parse snapshotOnDelete (%s): %v", value, parseErr)
+			}
+			if snapshotOnDelete {
+				if !d.options.EnableSnapshotOnDelete {
+					return nil, status.Error(codes.InvalidArgument, "snapshotOnDelete requires the controller to be started with --enable-snapshot-on-delete")
+				}
+				volumeTags[SnapshotOnDeleteTag] = "true"
+			}
 		default:
 			if strings.HasPrefix(key, TagKeyPrefix) {
 				scTags = append(scTags, value)
@@ -210,10 +373,11 @@ func (d *ControllerService) CreateVolume(ctx context.Context, req *csi.CreateVol
 		}
 	}
 
-	modifyOptions, err := parseModifyVolumeParameters(req.GetMutableParameters())
+	modifyRequest, err := parseModifyVolumeParameters(req.GetMutableParameters())
 	if err != nil {
 		return nil, status.Errorf(codes.InvalidArgument, "Invalid mutable parameter: %v", err)
 	}
+	modifyOptions := modifyRequest.modifyDiskOptions
 
 	// "Values specified in mutable_parameters MUST take precedence over the values from parameters."
 	// https://github.com/container-storage-interface/spec/blob/master/spec.md#createvolume
@@ -222,9 +386,17 @@ func (d *ControllerService) CreateVolume(ctx context.Context, req *csi.CreateVol
 	}
 	if modifyOptions.IOPS != 0 {
 		iops = modifyOptions.IOPS
+		iopsPerGB = 0
 	}
 	if modifyOptions.Throughput != 0 {
 		throughput = modifyOptions.Throughput
+		throughputPerGiB = 0
+	}
+	if iops > 0 && iopsPerGB > 0 {
+		return nil, status.Error(codes.InvalidArgument, "Invalid parameters: specify either iops or iopsPerGB, not both")
+	}
+	if throughput > 0 && throughputPerGiB > 0 {
+		return nil, status.Error(codes.InvalidArgument, "Invalid parameters: specify either throughput or throughputPerGiB, not both")
 	}
 
 	responseCtx := map[string]string{}
@@ -266,6 +438,28 @@ func (d *ControllerService) CreateVolume(ctx context.Context, req *csi.CreateVol
 		}
 	}
 
+	if len(ext4Stride) > 0 {
+		responseCtx[Ext4StrideKey] = ext4Stride
+		if err = validateFormattingOption(volCap, Ext4StrideKey, FileSystemConfigs); err != nil {
+			return nil, err
+		}
+	}
+	if len(ext4StripeWidth) > 0 {
+		responseCtx[Ext4StripeWidthKey] = ext4StripeWidth
+		if err = validateFormattingOption(volCap, Ext4StripeWidthKey, FileSystemConfigs); err != nil {
+			return nil, err
+		}
+	}
+	if err = validateExt4StripeOptions(ext4Stride, ext4StripeWidth); err != nil {
+		return nil, err
+	}
+	if len(ext4LazyInit) > 0 {
+		responseCtx[Ext4LazyInitKey] = ext4LazyInit
+		if err = validateFormattingOption(volCap, Ext4LazyInitKey, FileSystemConfigs); err != nil {
+			return nil, err
+		}
+	}
+
 	if !ext4BigAlloc && len(ext4ClusterSize) > 0 {
 		return nil, status.Errorf(codes.InvalidArgument, "Cannot set ext4BigAllocClusterSize when ext4BigAlloc is false")
 	}
@@ -274,6 +468,18 @@ func (d *ControllerService) CreateVolume(ctx context.Context, req *csi.CreateVol
 		return nil, status.Errorf(codes.InvalidArgument, "Block Express is only supported on io2 volumes")
 	}
 
+	// Explicit kmsKeyId always wins, otherwise fall back to the default key configured for the volume type
+	if isEncrypted && kmsKeyID == "" {
+		keyVolumeType := volumeType
+		if keyVolumeType == "" {
+			keyVolumeType = cloud.VolumeTypeGP3
+		}
+		if key, ok := d.options.KmsKeyByVolumeType[keyVolumeType]; ok {
+			klog.V(4).InfoS("CreateVolume: using default KMS key for volume type", "volumeType", keyVolumeType, "kmsKeyID", key)
+			kmsKeyID = key
+		}
+	}
+
 	snapshotID := ""
 	volumeSource := req.GetVolumeContentSource()
 	if volumeSource != nil {
@@ -286,9 +492,20 @@ func (d *ControllerService) CreateVolume(ctx context.Context, req *csi.CreateVol
 		}
 		snapshotID = sourceSnapshot.GetSnapshotId()
 	}
+	if initializationRate != 0 {
+		if snapshotID == "" {
+			return nil, status.Error(codes.InvalidArgument, "Invalid parameters: volumeInitializationRate requires a snapshot volume content source")
+		}
+		if initializationRate < cloud.MinVolumeInitializationRate || initializationRate > cloud.MaxVolumeInitializationRate {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid volumeInitializationRate %d: must be between %d and %d MiB/s", initializationRate, cloud.MinVolumeInitializationRate, cloud.MaxVolumeInitializationRate)
+		}
+	}
 
 	// create a new volume
-	zone := pickAvailabilityZone(req.GetAccessibilityRequirements())
+	zone, err := pickAllowedAvailabilityZone(req.GetAccessibilityRequirements(), d.options.ExcludedZones)
+	if err != nil {
+		return nil, err
+	}
 	outpostArn := getOutpostArn(req.GetAccessibilityRequirements())
 
 	// fill volume tags
@@ -298,7 +515,11 @@ func (d *ControllerService) CreateVolume(ctx context.Context, req *csi.CreateVol
 		volumeTags[NameTag] = d.options.KubernetesClusterID + "-dynamic-" + volName
 		volumeTags[KubernetesClusterTag] = d.options.KubernetesClusterID
 	}
-	for k, v := range d.options.ExtraTags {
+	extraTags, err := d.renderExtraTags(template.ExtraTagProps{PVProps: *tProps})
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range extraTags {
 		volumeTags[k] = v
 	}
 
@@ -314,22 +535,43 @@ func (d *ControllerService) CreateVolume(ctx context.Context, req *csi.CreateVol
 	for k, v := range addTags {
 		volumeTags[k] = v
 	}
+	// Tags of the mutable parameters take precedence over the tags of the parameters, like the other mutable parameters
+	for _, k := range modifyRequest.modifyTagsOptions.TagsToDelete {
+		delete(volumeTags, k)
+	}
+	for k, v := range modifyRequest.modifyTagsOptions.TagsToAdd {
+		volumeTags[k] = v
+	}
+	if d.options.ParameterDriftCheckInterval > 0 {
+		provisionedType := volumeType
+		if provisionedType == "" {
+			provisionedType = cloud.VolumeTypeGP3
+		}
+		for k, v := range provisionedParameterTags(provisionedType, iops, throughput) {
+			volumeTags[k] = v
+		}
+	}
+	if err = validateTagLimit(volumeTags); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid tags: %v", err)
+	}
 
 	opts := &cloud.DiskOptions{
-		CapacityBytes:          volSizeBytes,
-		Tags:                   volumeTags,
-		VolumeType:             volumeType,
-		IOPSPerGB:              iopsPerGB,
-		AllowIOPSPerGBIncrease: allowIOPSPerGBIncrease,
-		IOPS:                   iops,
-		Throughput:             throughput,
-		AvailabilityZone:       zone,
-		OutpostArn:             outpostArn,
-		Encrypted:              isEncrypted,
-		BlockExpress:           blockExpress,
-		KmsKeyID:               kmsKeyID,
-		SnapshotID:             snapshotID,
-		MultiAttachEnabled:     multiAttach,
+		CapacityBytes:            volSizeBytes,
+		Tags:                     volumeTags,
+		VolumeType:               volumeType,
+		IOPSPerGB:                iopsPerGB,
+		AllowIOPSPerGBIncrease:   allowIOPSPerGBIncrease,
+		IOPS:                     iops,
+		Throughput:               throughput,
+		ThroughputPerGiB:         throughputPerGiB,
+		AvailabilityZone:         zone,
+		OutpostArn:               outpostArn,
+		Encrypted:                isEncrypted,
+		BlockExpress:             blockExpress,
+		KmsKeyID:                 kmsKeyID,
+		SnapshotID:               snapshotID,
+		VolumeInitializationRate: initializationRate,
+		MultiAttachEnabled:       multiAttach,
 	}
 
 	disk, err := d.cloud.CreateDisk(ctx, volName, opts)
@@ -340,14 +582,42 @@ func (d *ControllerService) CreateVolume(ctx context.Context, req *csi.CreateVol
 			errCode = codes.NotFound
 		case errors.Is(err, cloud.ErrIdempotentParameterMismatch), errors.Is(err, cloud.ErrAlreadyExists):
 			errCode = codes.AlreadyExists
+		case errors.Is(err, cloud.ErrInvalidKMSKeyID), errors.Is(err, cloud.ErrInvalidPerformanceRatio):
+			errCode = codes.InvalidArgument
 		default:
 			errCode = codes.Internal
 		}
-		return nil, status.Errorf(errCode, "Could not create volume %q: %v", volName, err)
+		return nil, controllerError(errCode, "CreateVolume", volName, fmt.Sprintf("Could not create volume %q: %v", volName, err), err)
+	}
+	if d.options.AnnotatePVOnCreate && d.k8sClient != nil {
+		d.annotatePVInBackground(volName, disk)
 	}
 	return newCreateVolumeResponse(disk, responseCtx), nil
 }
 
+// createVolumeClass returns the class CreateVolume calls are fairly queued by. Calls do not carry the name of their
+// StorageClass, so a class is identified by a hash of the StorageClass parameters, without the PVC and PV names added
+// by the external-provisioner. StorageClasses with identical parameters share a class.
+func createVolumeClass(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		if key != PVCNameKey && key != PVCNamespaceKey && key != PVNameKey {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	h := sha256.New()
+	for _, key := range keys {
+		fmt.Fprintf(h, "%s=%s\n", key, params[key])
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))[:12]
+}
+
+// recordCreateVolumeQueueDepth sets CreateVolumeQueueDepthMetric to the number of CreateVolume calls of class waiting
+func recordCreateVolumeQueueDepth(class string, depth int) {
+	metrics.Recorder().SetGauge(CreateVolumeQueueDepthMetric, float64(depth), map[string]string{"class": class})
+}
+
 func validateCreateVolumeRequest(req *csi.CreateVolumeRequest) error {
 	volName := req.GetName()
 	if len(volName) == 0 {
@@ -379,6 +649,16 @@ func (d *ControllerService) DeleteVolume(ctx context.Context, req *csi.DeleteVol
 	}
 	defer d.inFlight.Delete(volumeID)
 
+	if d.options.EnableSnapshotOnDelete {
+		if err := d.snapshotOnDelete(ctx, volumeID); err != nil {
+			if errors.Is(err, cloud.ErrNotFound) {
+				klog.V(4).InfoS("DeleteVolume: volume not found, returning with success")
+				return &csi.DeleteVolumeResponse{}, nil
+			}
+			return nil, status.Errorf(codes.Internal, "Could not snapshot volume ID %q before deleting it: %v", volumeID, err)
+		}
+	}
+
 	if _, err := d.cloud.DeleteDisk(ctx, volumeID); err != nil {
 		if errors.Is(err, cloud.ErrNotFound) {
 			klog.V(4).InfoS("DeleteVolume: volume not found, returning with success")
@@ -418,9 +698,10 @@ func (d *ControllerService) ControllerPublishVolume(ctx context.Context, req *cs
 			klog.InfoS("ControllerPublishVolume: volume not found", "volumeID", volumeID, "nodeID", nodeID)
 			return nil, status.Errorf(codes.NotFound, "Volume %q not found", volumeID)
 		}
-		return nil, status.Errorf(codes.Internal, "Could not attach volume %q to node %q: %v", volumeID, nodeID, err)
+		return nil, controllerError(codes.Internal, "ControllerPublishVolume", volumeID, fmt.Sprintf("Could not attach volume %q to node %q: %v", volumeID, nodeID, err), err)
 	}
 	klog.InfoS("ControllerPublishVolume: attached", "volumeID", volumeID, "nodeID", nodeID, "devicePath", devicePath)
+	d.tagAttachAudit(ctx, volumeID, nodeID, true)
 
 	pvInfo := map[string]string{DevicePathKey: devicePath}
 	return &csi.ControllerPublishVolumeResponse{PublishContext: pvInfo}, nil
@@ -470,6 +751,7 @@ func (d *ControllerService) ControllerUnpublishVolume(ctx context.Context, req *
 		return nil, status.Errorf(codes.Internal, "Could not detach volume %q from node %q: %v", volumeID, nodeID, err)
 	}
 	klog.InfoS("ControllerUnpublishVolume: detached", "volumeID", volumeID, "nodeID", nodeID)
+	d.tagAttachAudit(ctx, volumeID, nodeID, false)
 
 	return &csi.ControllerUnpublishVolumeResponse{}, nil
 }
@@ -490,6 +772,9 @@ func (d *ControllerService) ControllerGetCapabilities(ctx context.Context, req *
 	klog.V(4).InfoS("ControllerGetCapabilities: called", "args", *req)
 	var caps []*csi.ControllerServiceCapability
 	for _, cap := range controllerCaps {
+		if cap == csi.ControllerServiceCapability_RPC_GET_CAPACITY && d.options.CapacityZoneQuotaGiB == 0 {
+			continue
+		}
 		c := &csi.ControllerServiceCapability{
 			Type: &csi.ControllerServiceCapability_Rpc{
 				Rpc: &csi.ControllerServiceCapability_RPC{
@@ -502,14 +787,36 @@ func (d *ControllerService) ControllerGetCapabilities(ctx context.Context, req *
 	return &csi.ControllerGetCapabilitiesResponse{Capabilities: caps}, nil
 }
 
-func (d *ControllerService) GetCapacity(ctx context.Context, req *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
-	klog.V(4).InfoS("GetCapacity: called", "args", *req)
-	return nil, status.Error(codes.Unimplemented, "")
+// ListVolumes lists the volumes of the cluster, tagged with the resource lifecycle tag of --k8s-tag-cluster-id when it is
+// set or with the tag of the driver otherwise, along with the instances they are attached to. The attachments are
+// informational, the LIST_VOLUMES_PUBLISHED_NODES capability is not advertised.
+func (d *ControllerService) ListVolumes(ctx context.Context, req *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
+	klog.V(4).InfoS("ListVolumes: called", "args", util.SanitizeRequest(req))
+	if req.GetMaxEntries() < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "MaxEntries must not be negative, got %d", req.GetMaxEntries())
+	}
+
+	cloudDisks, err := d.cloud.ListDisks(ctx, d.clusterTagKey(), req.GetMaxEntries(), req.GetStartingToken())
+	if err != nil {
+		if errors.Is(err, cloud.ErrInvalidNextToken) {
+			return nil, status.Errorf(codes.Aborted, "Invalid StartingToken %q: %v", req.GetStartingToken(), err)
+		}
+		if errors.Is(err, cloud.ErrInvalidMaxResults) {
+			return nil, status.Errorf(codes.InvalidArgument, "Error mapping MaxEntries to AWS MaxResults: %v", err)
+		}
+		return nil, status.Errorf(codes.Internal, "Could not list volumes: %v", err)
+	}
+
+	return newListVolumesResponse(cloudDisks), nil
 }
 
-func (d *ControllerService) ListVolumes(ctx context.Context, req *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
-	klog.V(4).InfoS("ListVolumes: called", "args", *req)
-	return nil, status.Error(codes.Unimplemented, "")
+// clusterTagKey returns the tag key of the volumes of the cluster: the resource lifecycle tag of --k8s-tag-cluster-id
+// when it is set, or the tag of the driver otherwise
+func (d *ControllerService) clusterTagKey() string {
+	if d.options.KubernetesClusterID != "" {
+		return ResourceLifecycleTagPrefix + d.options.KubernetesClusterID
+	}
+	return cloud.AwsEbsDriverTagKey
 }
 
 func (d *ControllerService) ValidateVolumeCapabilities(ctx context.Context, req *csi.ValidateVolumeCapabilitiesRequest) (*csi.ValidateVolumeCapabilitiesResponse, error) {
@@ -524,7 +831,7 @@ func (d *ControllerService) ValidateVolumeCapabilities(ctx context.Context, req
 		return nil, status.Error(codes.InvalidArgument, "Volume capabilities not provided")
 	}
 
-	if _, err := d.cloud.GetDiskByID(ctx, volumeID); err != nil {
+	if _, err := d.cloud.GetCachedDiskByID(ctx, volumeID); err != nil {
 		if errors.Is(err, cloud.ErrNotFound) {
 			return nil, status.Error(codes.NotFound, "Volume not found")
 		}
@@ -586,14 +893,12 @@ func (d *ControllerService) ControllerModifyVolume(ctx context.Context, req *csi
 		return nil, status.Error(codes.InvalidArgument, "Volume ID not provided")
 	}
 
-	options, err := parseModifyVolumeParameters(req.GetMutableParameters())
+	modifyRequest, err := parseModifyVolumeParameters(req.GetMutableParameters())
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = d.modifyVolumeCoalescer.Coalesce(volumeID, modifyVolumeRequest{
-		modifyDiskOptions: *options,
-	})
+	_, err = d.modifyVolumeCoalescer.Coalesce(volumeID, *modifyRequest)
 	if err != nil {
 		return nil, err
 	}
@@ -601,11 +906,6 @@ func (d *ControllerService) ControllerModifyVolume(ctx context.Context, req *csi
 	return &csi.ControllerModifyVolumeResponse{}, nil
 }
 
-func (d *ControllerService) ControllerGetVolume(ctx context.Context, req *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) {
-	klog.V(4).InfoS("ControllerGetVolume: called", "args", *req)
-	return nil, status.Error(codes.Unimplemented, "")
-}
-
 func isValidVolumeCapabilities(v []*csi.VolumeCapability) bool {
 	for _, c := range v {
 		if !isValidCapability(c) {
@@ -675,6 +975,15 @@ func (d *ControllerService) CreateSnapshot(ctx context.Context, req *csi.CreateS
 	}
 	defer d.inFlight.Delete(snapshotName)
 
+	copyParams, err := parseSnapshotCopyParameters(req.GetParameters())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid snapshot copy parameters: %v", err)
+	}
+	fsrAvailabilityZones, err := parseFastSnapshotRestoreZones(req.GetParameters())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid fast snapshot restore parameters: %v", err)
+	}
+
 	snapshot, err := d.cloud.GetSnapshotByName(ctx, snapshotName)
 	if err != nil && !errors.Is(err, cloud.ErrNotFound) {
 		klog.ErrorS(err, "Error looking for the snapshot", "snapshotName", snapshotName)
@@ -685,6 +994,14 @@ func (d *ControllerService) CreateSnapshot(ctx context.Context, req *csi.CreateS
 			return nil, status.Errorf(codes.AlreadyExists, "Snapshot %s already exists for different volume (%s)", snapshotName, snapshot.SourceVolumeID)
 		}
 		klog.V(4).InfoS("Snapshot of volume already exists; nothing to do", "snapshotName", snapshotName, "volumeId", volumeID)
+		if len(fsrAvailabilityZones) > 0 {
+			if err = d.enableMissingFastSnapshotRestores(ctx, snapshot.SnapshotID, fsrAvailabilityZones); err != nil {
+				return nil, status.Errorf(codes.Internal, "Failed to create Fast Snapshot Restores for snapshot ID %q: %v", snapshotName, err)
+			}
+		}
+		if copyParams != nil && snapshot.Tags[SnapshotCopyStateTag] != SnapshotCopyStateCompleted {
+			d.copySnapshotInBackground(snapshot.SnapshotID, copyParams)
+		}
 		return newCreateSnapshotResponse(snapshot)
 	}
 
@@ -694,7 +1011,6 @@ func (d *ControllerService) CreateSnapshot(ctx context.Context, req *csi.CreateS
 	}
 
 	var vscTags []string
-	var fsrAvailabilityZones []string
 	vsProps := new(template.VolumeSnapshotProps)
 	for key, value := range req.GetParameters() {
 		switch strings.ToLower(key) {
@@ -705,8 +1021,9 @@ func (d *ControllerService) CreateSnapshot(ctx context.Context, req *csi.CreateS
 		case VolumeSnapshotContentNameKey:
 			vsProps.VolumeSnapshotContentName = value
 		case FastSnapshotRestoreAvailabilityZones:
-			f := strings.ReplaceAll(value, " ", "")
-			fsrAvailabilityZones = strings.Split(f, ",")
+			// Parsed by parseFastSnapshotRestoreZones
+		case CopyToRegionsKey, CopyCompleteTimeoutKey, DeleteCopiesKey:
+			// Parsed by parseSnapshotCopyParameters
 		default:
 			if strings.HasPrefix(key, TagKeyPrefix) {
 				vscTags = append(vscTags, value)
@@ -730,13 +1047,27 @@ func (d *ControllerService) CreateSnapshot(ctx context.Context, req *csi.CreateS
 		snapshotTags[resourceLifecycleTag] = ResourceLifecycleOwned
 		snapshotTags[NameTag] = d.options.KubernetesClusterID + "-dynamic-" + snapshotName
 	}
-	for k, v := range d.options.ExtraTags {
+	extraTags, err := d.renderExtraTags(template.ExtraTagProps{VolumeSnapshotProps: *vsProps})
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range extraTags {
 		snapshotTags[k] = v
 	}
 
 	for k, v := range addTags {
 		snapshotTags[k] = v
 	}
+	if copyParams != nil {
+		snapshotTags[SnapshotCopyRegionsTag] = strings.Join(copyParams.regions, ",")
+		snapshotTags[SnapshotCopyTimeoutTag] = copyParams.timeout.String()
+		if copyParams.deleteCopies {
+			snapshotTags[SnapshotDeleteCopiesTag] = "true"
+		}
+	}
+	if err = validateTagLimit(snapshotTags); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid tags: %v", err)
+	}
 
 	opts := &cloud.SnapshotOptions{
 		Tags: snapshotTags,
@@ -774,9 +1105,54 @@ func (d *ControllerService) CreateSnapshot(ctx context.Context, req *csi.CreateS
 			return nil, status.Errorf(codes.Internal, "Failed to create Fast Snapshot Restores for snapshot ID %q: %v", snapshotName, err)
 		}
 	}
+	if copyParams != nil {
+		d.copySnapshotInBackground(snapshot.SnapshotID, copyParams)
+	}
 	return newCreateSnapshotResponse(snapshot)
 }
 
+// parseFastSnapshotRestoreZones returns the availability zones of the fastSnapshotRestoreAvailabilityZones parameter
+func parseFastSnapshotRestoreZones(parameters map[string]string) ([]string, error) {
+	for key, value := range parameters {
+		if strings.ToLower(key) != FastSnapshotRestoreAvailabilityZones {
+			continue
+		}
+		var zones []string
+		for _, zone := range strings.Split(value, ",") {
+			zone = strings.TrimSpace(zone)
+			if zone == "" {
+				return nil, fmt.Errorf("empty availability zone in %q", value)
+			}
+			if !slices.Contains(zones, zone) {
+				zones = append(zones, zone)
+			}
+		}
+		return zones, nil
+	}
+	return nil, nil
+}
+
+// enableMissingFastSnapshotRestores enables fast snapshot restores of an existing snapshot in the zones where they are
+// not enabled or being enabled yet, so that a retried CreateSnapshot does not return a snapshot without them
+func (d *ControllerService) enableMissingFastSnapshotRestores(ctx context.Context, snapshotID string, zones []string) error {
+	enabled, err := d.cloud.FastSnapshotRestoreZones(ctx, snapshotID)
+	if err != nil {
+		return fmt.Errorf("could not describe fast snapshot restores: %w", err)
+	}
+	var missing []string
+	for _, zone := range zones {
+		if !slices.Contains(enabled, zone) {
+			missing = append(missing, zone)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	klog.V(4).InfoS("Enabling missing fast snapshot restores of existing snapshot", "snapshotID", snapshotID, "availabilityZones", missing)
+	_, err = d.cloud.EnableFastSnapshotRestores(ctx, missing, snapshotID)
+	return err
+}
+
 func validateCreateSnapshotRequest(req *csi.CreateSnapshotRequest) error {
 	if len(req.GetName()) == 0 {
 		return status.Error(codes.InvalidArgument, "Snapshot name not provided")
@@ -803,6 +1179,10 @@ func (d *ControllerService) DeleteSnapshot(ctx context.Context, req *csi.DeleteS
 	}
 	defer d.inFlight.Delete(snapshotID)
 
+	if err := d.deleteSnapshotCopies(ctx, snapshotID); err != nil {
+		return nil, status.Errorf(codes.Internal, "Could not delete copies of snapshot ID %q: %v", snapshotID, err)
+	}
+
 	if _, err := d.cloud.DeleteSnapshot(ctx, snapshotID); err != nil {
 		if errors.Is(err, cloud.ErrNotFound) {
 			klog.V(4).InfoS("DeleteSnapshot: snapshot not found, returning with success")
@@ -892,6 +1272,30 @@ func pickAvailabilityZone(requirement *csi.TopologyRequirement) string {
 	return ""
 }
 
+// pickAllowedAvailabilityZone picks a zone like pickAvailabilityZone, skipping excluded zones
+// If the picked zone is excluded, the first other zone in the preferred and then the requisite topologies is used.
+// A requirement that allows no other zone fails with FailedPrecondition.
+func pickAllowedAvailabilityZone(requirement *csi.TopologyRequirement, excludedZones []string) (string, error) {
+	zone := pickAvailabilityZone(requirement)
+	if zone == "" || !slices.Contains(excludedZones, zone) {
+		return zone, nil
+	}
+
+	for _, topology := range slices.Concat(requirement.GetPreferred(), requirement.GetRequisite()) {
+		for _, key := range []string{WellKnownZoneTopologyKey, ZoneTopologyKey} {
+			candidate, exists := topology.GetSegments()[key]
+			if exists && candidate != "" && !slices.Contains(excludedZones, candidate) {
+				klog.V(4).InfoS("CreateVolume: skipping excluded zone", "excludedZone", zone, "zone", candidate)
+				metrics.Recorder().IncreaseCount(ExcludedZoneMetric, map[string]string{"zone": zone, "outcome": ExcludedZoneOutcomeSkipped})
+				return candidate, nil
+			}
+		}
+	}
+
+	metrics.Recorder().IncreaseCount(ExcludedZoneMetric, map[string]string{"zone": zone, "outcome": ExcludedZoneOutcomeRejected})
+	return "", newErrorWithInfo(codes.FailedPrecondition, ErrorReasonZoneExcluded, "CreateVolume", "", fmt.Sprintf("Availability Zone %s is excluded by --excluded-zones and the topology requirement allows no other zone", zone))
+}
+
 func getOutpostArn(requirement *csi.TopologyRequirement) string {
 	if requirement == nil {
 		return ""
@@ -964,6 +1368,25 @@ func newCreateSnapshotResponse(snapshot *cloud.Snapshot) (*csi.CreateSnapshotRes
 	}, nil
 }
 
+func newListVolumesResponse(cloudResponse *cloud.ListDisksResponse) *csi.ListVolumesResponse {
+	entries := make([]*csi.ListVolumesResponse_Entry, 0, len(cloudResponse.Disks))
+	for _, disk := range cloudResponse.Disks {
+		entries = append(entries, &csi.ListVolumesResponse_Entry{
+			Volume: &csi.Volume{
+				VolumeId:      disk.VolumeID,
+				CapacityBytes: util.GiBToBytes(disk.CapacityGiB),
+			},
+			Status: &csi.ListVolumesResponse_VolumeStatus{
+				PublishedNodeIds: disk.Attachments,
+			},
+		})
+	}
+	return &csi.ListVolumesResponse{
+		Entries:   entries,
+		NextToken: cloudResponse.NextToken,
+	}
+}
+
 func newListSnapshotsResponse(cloudResponse *cloud.ListSnapshotsResponse) *csi.ListSnapshotsResponse {
 
 	var entries []*csi.ListSnapshotsResponse_Entry
@@ -1007,12 +1430,8 @@ func getVolSizeBytes(req *csi.CreateVolumeRequest) (int64, error) {
 }
 
 // BuildOutpostArn returns the string representation of the outpost ARN from the given csi.TopologyRequirement.segments
+// The partition is detected from the region when the segments do not include it
 func BuildOutpostArn(segments map[string]string) string {
-
-	if len(segments[AwsPartitionKey]) <= 0 {
-		return ""
-	}
-
 	if len(segments[AwsRegionKey]) <= 0 {
 		return ""
 	}
@@ -1023,14 +1442,40 @@ func BuildOutpostArn(segments map[string]string) string {
 		return ""
 	}
 
+	partition := segments[AwsPartitionKey]
+	if len(partition) <= 0 {
+		partition = metadata.PartitionForRegion(segments[AwsRegionKey])
+	}
+
 	return fmt.Sprintf("arn:%s:outposts:%s:%s:outpost/%s",
-		segments[AwsPartitionKey],
+		partition,
 		segments[AwsRegionKey],
 		segments[AwsAccountIDKey],
 		segments[AwsOutpostIDKey],
 	)
 }
 
+// validateExt4StripeOptions checks that the ext4 stride and stripe width are positive numbers of filesystem blocks
+// and that the stripe width is a whole number of strides. Either value may be empty when not set.
+func validateExt4StripeOptions(stride, stripeWidth string) error {
+	var strideBlocks, stripeWidthBlocks int
+	var err error
+	if len(stride) > 0 {
+		if strideBlocks, err = strconv.Atoi(stride); err != nil || strideBlocks <= 0 {
+			return status.Errorf(codes.InvalidArgument, "Invalid %s (%s): must be a positive integer", Ext4StrideKey, stride)
+		}
+	}
+	if len(stripeWidth) > 0 {
+		if stripeWidthBlocks, err = strconv.Atoi(stripeWidth); err != nil || stripeWidthBlocks <= 0 {
+			return status.Errorf(codes.InvalidArgument, "Invalid %s (%s): must be a positive integer", Ext4StripeWidthKey, stripeWidth)
+		}
+	}
+	if strideBlocks > 0 && stripeWidthBlocks > 0 && stripeWidthBlocks%strideBlocks != 0 {
+		return status.Errorf(codes.InvalidArgument, "%s (%d) must be a multiple of %s (%d)", Ext4StripeWidthKey, stripeWidthBlocks, Ext4StrideKey, strideBlocks)
+	}
+	return nil
+}
+
 func validateFormattingOption(volumeCapabilities []*csi.VolumeCapability, paramName string, fsConfigs map[string]fileSystemConfig) error {
 	for _, volCap := range volumeCapabilities {
 		switch volCap.GetAccessType().(type) {
@@ -1051,3 +1496,20 @@ func validateFormattingOption(volumeCapabilities []*csi.VolumeCapability, paramN
 
 	return nil
 }
+
+// controllerError returns a gRPC status error with the given code and message, carrying an ErrorInfo detail whose
+// reason identifies the cause of err when it is one callers are expected to handle, see the ErrorReason constants
+func controllerError(c codes.Code, operation, volumeID, msg string, err error) error {
+	var reason string
+	switch {
+	case errors.Is(err, cloud.ErrInvalidPerformanceRatio):
+		reason = ErrorReasonIOPSRatioExceeded
+	case errors.Is(err, cloud.ErrInvalidKMSKeyID):
+		reason = ErrorReasonKMSKeyInvalid
+	case cloud.IsAttachmentLimitExceeded(err):
+		reason = ErrorReasonAttachLimit
+	default:
+		return status.Error(c, msg)
+	}
+	return newErrorWithInfo(c, reason, operation, volumeID, msg)
+}
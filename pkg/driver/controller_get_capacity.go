@@ -0,0 +1,143 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	csi "github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/util"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+)
+
+// capacityUsage is the storage used by the volumes of the cluster in each Availability Zone of the region
+type capacityUsage struct {
+	zones   map[string]struct{}
+	usedGiB map[string]int64
+}
+
+// capacityCache caches the capacityUsage of GetCapacity for --capacity-cache-ttl
+type capacityCache struct {
+	mux     sync.Mutex
+	clock   clock.Clock
+	usage   *capacityUsage
+	fetched time.Time
+}
+
+func newCapacityCache(c clock.Clock) *capacityCache {
+	return &capacityCache{clock: c}
+}
+
+// GetCapacity returns the storage left in --capacity-zone-quota-gib once the storage of the volumes of the cluster in the
+// Availability Zone of the requested topology is subtracted. Without topology, the storage left in all the zones of the
+// region is returned. Topologies outside of the zones of the region, such as Outposts, have no capacity.
+// The budget covers the volumes of all types, so the parameters of the request, such as the volume type, are ignored.
+func (d *ControllerService) GetCapacity(ctx context.Context, req *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
+	klog.V(4).InfoS("GetCapacity: called", "args", *req)
+	if d.options.CapacityZoneQuotaGiB == 0 {
+		return nil, status.Error(codes.Unimplemented, "GetCapacity requires --capacity-zone-quota-gib")
+	}
+
+	usage, err := d.getCapacityUsage(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "Could not get the storage used by volumes: %v", err)
+	}
+
+	var zones []string
+	if segments := req.GetAccessibleTopology().GetSegments(); len(segments) > 0 {
+		zone, ok := capacityZone(segments)
+		if _, inRegion := usage.zones[zone]; !ok || !inRegion {
+			klog.V(4).InfoS("GetCapacity: unsupported topology", "segments", segments)
+			return &csi.GetCapacityResponse{AvailableCapacity: 0}, nil
+		}
+		zones = []string{zone}
+	} else {
+		for zone := range usage.zones {
+			zones = append(zones, zone)
+		}
+	}
+
+	var availableGiB int64
+	for _, zone := range zones {
+		availableGiB += max(d.options.CapacityZoneQuotaGiB-usage.usedGiB[zone], 0)
+	}
+	return &csi.GetCapacityResponse{AvailableCapacity: availableGiB * util.GiB}, nil
+}
+
+// capacityZone returns the Availability Zone of the topology segments, which must not refer to an Outpost
+func capacityZone(segments map[string]string) (string, bool) {
+	if _, ok := segments[AwsOutpostIDKey]; ok {
+		return "", false
+	}
+	for _, key := range []string{WellKnownZoneTopologyKey, ZoneTopologyKey} {
+		if zone, ok := segments[key]; ok {
+			return zone, true
+		}
+	}
+	return "", false
+}
+
+// getCapacityUsage returns the storage used by the volumes of the cluster, cached for --capacity-cache-ttl.
+// When it cannot be refreshed, the expired usage is returned if there is one.
+func (d *ControllerService) getCapacityUsage(ctx context.Context) (*capacityUsage, error) {
+	d.capacity.mux.Lock()
+	defer d.capacity.mux.Unlock()
+	if d.capacity.usage != nil && d.capacity.clock.Since(d.capacity.fetched) < d.options.CapacityCacheTTL {
+		return d.capacity.usage, nil
+	}
+
+	usage, err := d.fetchCapacityUsage(ctx)
+	if err != nil {
+		if d.capacity.usage != nil {
+			klog.ErrorS(err, "GetCapacity: failed to refresh the storage used by volumes, using the storage from the last refresh", "fetched", d.capacity.fetched)
+			return d.capacity.usage, nil
+		}
+		return nil, err
+	}
+	d.capacity.usage = usage
+	d.capacity.fetched = d.capacity.clock.Now()
+	return usage, nil
+}
+
+// fetchCapacityUsage lists the Availability Zones of the region and sums the size of the volumes of the cluster in each
+func (d *ControllerService) fetchCapacityUsage(ctx context.Context) (*capacityUsage, error) {
+	zones, err := d.cloud.AvailabilityZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &capacityUsage{zones: zones, usedGiB: make(map[string]int64)}
+	nextToken := ""
+	for {
+		page, err := d.cloud.ListDisks(ctx, d.clusterTagKey(), 0, nextToken)
+		if err != nil {
+			return nil, err
+		}
+		for _, disk := range page.Disks {
+			usage.usedGiB[disk.AvailabilityZone] += int64(disk.CapacityGiB)
+		}
+		if page.NextToken == "" {
+			return usage, nil
+		}
+		nextToken = page.NextToken
+	}
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+var capacityZones = map[string]struct{}{"us-west-2a": {}, "us-west-2b": {}}
+
+func expectCapacityUsage(mockCloud *cloud.MockCloud, disks ...*cloud.Disk) {
+	mockCloud.EXPECT().AvailabilityZones(gomock.Any()).Return(capacityZones, nil)
+	mockCloud.EXPECT().ListDisks(gomock.Any(), cloud.AwsEbsDriverTagKey, int32(0), "").Return(&cloud.ListDisksResponse{Disks: disks[:1], NextToken: "token"}, nil)
+	mockCloud.EXPECT().ListDisks(gomock.Any(), cloud.AwsEbsDriverTagKey, int32(0), "token").Return(&cloud.ListDisksResponse{Disks: disks[1:]}, nil)
+}
+
+func zoneCapacityRequest(segments map[string]string) *csi.GetCapacityRequest {
+	return &csi.GetCapacityRequest{AccessibleTopology: &csi.Topology{Segments: segments}}
+}
+
+func TestGetCapacity(t *testing.T) {
+	disks := []*cloud.Disk{
+		{VolumeID: "vol-1", AvailabilityZone: "us-west-2a", CapacityGiB: 100},
+		{VolumeID: "vol-2", AvailabilityZone: "us-west-2a", CapacityGiB: 50},
+		{VolumeID: "vol-3", AvailabilityZone: "us-west-2b", CapacityGiB: 2000},
+	}
+
+	testCases := []struct {
+		name             string
+		req              *csi.GetCapacityRequest
+		expectedCapacity int64
+	}{
+		{
+			name:             "zone",
+			req:              zoneCapacityRequest(map[string]string{WellKnownZoneTopologyKey: "us-west-2a"}),
+			expectedCapacity: util.GiBToBytes(850),
+		},
+		{
+			name:             "deprecated zone key",
+			req:              zoneCapacityRequest(map[string]string{ZoneTopologyKey: "us-west-2a"}),
+			expectedCapacity: util.GiBToBytes(850),
+		},
+		{
+			name:             "zone over quota",
+			req:              zoneCapacityRequest(map[string]string{WellKnownZoneTopologyKey: "us-west-2b"}),
+			expectedCapacity: 0,
+		},
+		{
+			name:             "no topology",
+			req:              &csi.GetCapacityRequest{},
+			expectedCapacity: util.GiBToBytes(850),
+		},
+		{
+			name:             "zone of another region",
+			req:              zoneCapacityRequest(map[string]string{WellKnownZoneTopologyKey: "us-east-1a"}),
+			expectedCapacity: 0,
+		},
+		{
+			name:             "topology without zone",
+			req:              zoneCapacityRequest(map[string]string{AwsRegionKey: "us-west-2"}),
+			expectedCapacity: 0,
+		},
+		{
+			name:             "outpost",
+			req:              zoneCapacityRequest(map[string]string{WellKnownZoneTopologyKey: "us-west-2a", AwsOutpostIDKey: "op-1234567890abcdef0"}),
+			expectedCapacity: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			awsDriver, mockCtl, mockCloud := createControllerService(t)
+			defer mockCtl.Finish()
+			awsDriver.options.CapacityZoneQuotaGiB = 1000
+			awsDriver.capacity = newCapacityCache(testingclock.NewFakeClock(time.Now()))
+			expectCapacityUsage(mockCloud, disks...)
+
+			resp, err := awsDriver.GetCapacity(context.Background(), tc.req)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			assert.Equal(t, tc.expectedCapacity, resp.GetAvailableCapacity())
+		})
+	}
+}
+
+func TestGetCapacityCache(t *testing.T) {
+	req := zoneCapacityRequest(map[string]string{WellKnownZoneTopologyKey: "us-west-2a"})
+	awsDriver, mockCtl, mockCloud := createControllerService(t)
+	defer mockCtl.Finish()
+	awsDriver.options.CapacityZoneQuotaGiB = 1000
+	awsDriver.options.CapacityCacheTTL = time.Minute
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	awsDriver.capacity = newCapacityCache(fakeClock)
+
+	getCapacity := func() int64 {
+		t.Helper()
+		resp, err := awsDriver.GetCapacity(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return resp.GetAvailableCapacity()
+	}
+
+	// Cache hit: the usage is only fetched once within the TTL
+	expectCapacityUsage(mockCloud, &cloud.Disk{AvailabilityZone: "us-west-2a", CapacityGiB: 100}, &cloud.Disk{AvailabilityZone: "us-west-2b", CapacityGiB: 100})
+	assert.Equal(t, util.GiBToBytes(900), getCapacity())
+	fakeClock.Step(30 * time.Second)
+	assert.Equal(t, util.GiBToBytes(900), getCapacity())
+
+	// Refresh once the TTL expires
+	fakeClock.Step(30 * time.Second)
+	expectCapacityUsage(mockCloud, &cloud.Disk{AvailabilityZone: "us-west-2a", CapacityGiB: 300}, &cloud.Disk{AvailabilityZone: "us-west-2b", CapacityGiB: 100})
+	assert.Equal(t, util.GiBToBytes(700), getCapacity())
+
+	// A failed refresh falls back to the expired usage
+	fakeClock.Step(time.Minute)
+	mockCloud.EXPECT().AvailabilityZones(gomock.Any()).Return(capacityZones, nil)
+	mockCloud.EXPECT().ListDisks(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("RequestLimitExceeded"))
+	assert.Equal(t, util.GiBToBytes(700), getCapacity())
+}
+
+func TestGetCapacityErrors(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		awsDriver, mockCtl, _ := createControllerService(t)
+		defer mockCtl.Finish()
+
+		_, err := awsDriver.GetCapacity(context.Background(), &csi.GetCapacityRequest{})
+		checkExpectedErrorCode(t, err, codes.Unimplemented)
+	})
+
+	t.Run("failure without cached usage", func(t *testing.T) {
+		awsDriver, mockCtl, mockCloud := createControllerService(t)
+		defer mockCtl.Finish()
+		awsDriver.options.CapacityZoneQuotaGiB = 1000
+		awsDriver.capacity = newCapacityCache(testingclock.NewFakeClock(time.Now()))
+		mockCloud.EXPECT().AvailabilityZones(gomock.Any()).Return(nil, errors.New("UnauthorizedOperation"))
+
+		_, err := awsDriver.GetCapacity(context.Background(), &csi.GetCapacityRequest{})
+		checkExpectedErrorCode(t, err, codes.Unavailable)
+	})
+}
+
+func TestControllerGetCapabilitiesGetCapacity(t *testing.T) {
+	for _, quota := range []int64{0, 1000} {
+		awsDriver := ControllerService{options: &Options{CapacityZoneQuotaGiB: quota}}
+		resp, err := awsDriver.ControllerGetCapabilities(context.Background(), &csi.ControllerGetCapabilitiesRequest{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		advertised := false
+		for _, c := range resp.GetCapabilities() {
+			if c.GetRpc().GetType() == csi.ControllerServiceCapability_RPC_GET_CAPACITY {
+				advertised = true
+			}
+		}
+		if advertised != (quota > 0) {
+			t.Errorf("GET_CAPACITY advertised = %v with --capacity-zone-quota-gib=%d", advertised, quota)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	csi "github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/util"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	storagelisters "k8s.io/client-go/listers/storage/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// volumeStateError is the EC2 state of a volume whose underlying hardware has failed
+const volumeStateError = "error"
+
+// ControllerGetVolume returns the instances the volume is attached to and its condition, which is abnormal when the
+// volume is in the error state or its EC2 attachments disagree with the VolumeAttachments of Kubernetes, for example
+// when it was detached out of band
+func (d *ControllerService) ControllerGetVolume(ctx context.Context, req *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) {
+	klog.V(4).InfoS("ControllerGetVolume: called", "args", *req)
+	volumeID := req.GetVolumeId()
+	if len(volumeID) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Volume ID not provided")
+	}
+
+	disk, err := d.cloud.GetCachedDiskByID(ctx, volumeID)
+	if err != nil {
+		if errors.Is(err, cloud.ErrNotFound) {
+			return nil, status.Errorf(codes.NotFound, "Volume %q not found", volumeID)
+		}
+		return nil, controllerError(codes.Internal, "ControllerGetVolume", volumeID, fmt.Sprintf("Could not get volume %q: %v", volumeID, err), err)
+	}
+
+	var problems []string
+	if disk.State == volumeStateError {
+		problems = append(problems, "volume is in the error state, its underlying hardware has failed")
+	}
+	if d.attachments != nil {
+		coNodeIDs, err := d.coPublishedNodeIDs(volumeID)
+		if err != nil {
+			klog.ErrorS(err, "ControllerGetVolume: failed to get VolumeAttachments, attachments are not checked", "volumeID", volumeID)
+		} else {
+			problems = append(problems, attachmentProblems(disk.Attachments, coNodeIDs)...)
+		}
+	}
+
+	condition := &csi.VolumeCondition{Message: "volume is healthy"}
+	if len(problems) > 0 {
+		condition = &csi.VolumeCondition{Abnormal: true, Message: strings.Join(problems, "; ")}
+	}
+	return &csi.ControllerGetVolumeResponse{
+		Volume: &csi.Volume{
+			VolumeId:      disk.VolumeID,
+			CapacityBytes: util.GiBToBytes(disk.CapacityGiB),
+		},
+		Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
+			PublishedNodeIds: disk.Attachments,
+			VolumeCondition:  condition,
+		},
+	}, nil
+}
+
+// attachmentListers lists the VolumeAttachments and CSINodes ControllerGetVolume compares the attachments of volumes
+// with from informer caches, so that the calls of the external-health-monitor for each volume do not list them
+type attachmentListers struct {
+	volumeAttachments storagelisters.VolumeAttachmentLister
+	csiNodes          storagelisters.CSINodeLister
+	synced            []cache.InformerSynced
+}
+
+// newAttachmentListers starts the informers of the VolumeAttachments and CSINodes, which run until ctx is canceled
+func newAttachmentListers(ctx context.Context, k kubernetes.Interface) *attachmentListers {
+	factory := informers.NewSharedInformerFactory(k, 0)
+	vaInformer := factory.Storage().V1().VolumeAttachments()
+	csiNodeInformer := factory.Storage().V1().CSINodes()
+	listers := &attachmentListers{
+		volumeAttachments: vaInformer.Lister(),
+		csiNodes:          csiNodeInformer.Lister(),
+		synced:            []cache.InformerSynced{vaInformer.Informer().HasSynced, csiNodeInformer.Informer().HasSynced},
+	}
+	factory.Start(ctx.Done())
+	return listers
+}
+
+// coPublishedNodeIDs returns the IDs of the nodes Kubernetes has the volume attached to, according to the
+// VolumeAttachments of the driver and the node IDs registered in CSINode objects
+func (d *ControllerService) coPublishedNodeIDs(volumeID string) ([]string, error) {
+	for _, synced := range d.attachments.synced {
+		if !synced() {
+			return nil, errors.New("the VolumeAttachment and CSINode caches are not synced yet")
+		}
+	}
+	attachments, err := d.attachments.volumeAttachments.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	var nodeIDs []string
+	for _, va := range attachments {
+		// VolumeAttachments only reference the PV, but are named after the volume handle and the node
+		if va.Spec.Attacher != DriverName || !va.Status.Attached || va.Name != volumeAttachmentName(volumeID, va.Spec.NodeName) {
+			continue
+		}
+		csiNode, err := d.attachments.csiNodes.Get(va.Spec.NodeName)
+		if err != nil {
+			return nil, fmt.Errorf("could not get CSINode %q: %w", va.Spec.NodeName, err)
+		}
+		for _, driver := range csiNode.Spec.Drivers {
+			if driver.Name == DriverName {
+				nodeIDs = append(nodeIDs, driver.NodeID)
+			}
+		}
+	}
+	return nodeIDs, nil
+}
+
+// volumeAttachmentName returns the name Kubernetes gives to the VolumeAttachment of the volume to the node
+func volumeAttachmentName(volumeID, nodeName string) string {
+	return fmt.Sprintf("csi-%x", sha256.Sum256([]byte(volumeID+DriverName+nodeName)))
+}
+
+// attachmentProblems describes the disagreements between the instances the volume is attached to in EC2 and the
+// nodes Kubernetes believes it is attached to
+func attachmentProblems(ec2NodeIDs, coNodeIDs []string) []string {
+	var problems []string
+	for _, nodeID := range coNodeIDs {
+		if !slices.Contains(ec2NodeIDs, nodeID) {
+			problems = append(problems, fmt.Sprintf("volume is attached to node %s in Kubernetes but not in EC2", nodeID))
+		}
+	}
+	for _, nodeID := range ec2NodeIDs {
+		if !slices.Contains(coNodeIDs, nodeID) {
+			problems = append(problems, fmt.Sprintf("volume is attached to instance %s in EC2 but not in Kubernetes", nodeID))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newTestVolumeAttachment(volumeID, nodeName string, attached bool) *storagev1.VolumeAttachment {
+	return &storagev1.VolumeAttachment{
+		ObjectMeta: metav1.ObjectMeta{Name: volumeAttachmentName(volumeID, nodeName)},
+		Spec:       storagev1.VolumeAttachmentSpec{Attacher: DriverName, NodeName: nodeName},
+		Status:     storagev1.VolumeAttachmentStatus{Attached: attached},
+	}
+}
+
+func newTestCSINode(nodeName, nodeID string) *storagev1.CSINode {
+	return &storagev1.CSINode{
+		ObjectMeta: metav1.ObjectMeta{Name: nodeName},
+		Spec: storagev1.CSINodeSpec{
+			Drivers: []storagev1.CSINodeDriver{{Name: DriverName, NodeID: nodeID}},
+		},
+	}
+}
+
+func TestControllerGetVolume(t *testing.T) {
+	testCases := []struct {
+		name              string
+		volumeID          string
+		disk              *cloud.Disk
+		cloudErr          error
+		k8sObjects        []runtime.Object
+		expectedCode      codes.Code
+		expectedAbnormal  bool
+		expectedMessage   string
+		expectedPublished []string
+	}{
+		{
+			name:     "healthy volume attached in EC2 and Kubernetes",
+			volumeID: "vol-test",
+			disk:     &cloud.Disk{VolumeID: "vol-test", CapacityGiB: 10, State: "in-use", Attachments: []string{expInstanceID}},
+			k8sObjects: []runtime.Object{
+				newTestVolumeAttachment("vol-test", "node-1", true),
+				newTestVolumeAttachment("vol-other", "node-1", true),
+				newTestCSINode("node-1", expInstanceID),
+			},
+			expectedMessage:   "volume is healthy",
+			expectedPublished: []string{expInstanceID},
+		},
+		{
+			name:            "healthy volume without attachments",
+			volumeID:        "vol-test",
+			disk:            &cloud.Disk{VolumeID: "vol-test", CapacityGiB: 10, State: "available"},
+			k8sObjects:      []runtime.Object{newTestVolumeAttachment("vol-test", "node-1", false)},
+			expectedMessage: "volume is healthy",
+		},
+		{
+			name:         "volume missing",
+			volumeID:     "vol-test",
+			cloudErr:     cloud.ErrNotFound,
+			expectedCode: codes.NotFound,
+		},
+		{
+			name:         "DescribeVolumes failure",
+			volumeID:     "vol-test",
+			cloudErr:     errors.New("DescribeVolumes generic error"),
+			expectedCode: codes.Internal,
+		},
+		{
+			name:         "volume ID not provided",
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:              "volume in the error state",
+			volumeID:          "vol-test",
+			disk:              &cloud.Disk{VolumeID: "vol-test", CapacityGiB: 10, State: "error", Attachments: []string{expInstanceID}},
+			k8sObjects:        []runtime.Object{newTestVolumeAttachment("vol-test", "node-1", true), newTestCSINode("node-1", expInstanceID)},
+			expectedAbnormal:  true,
+			expectedMessage:   "volume is in the error state, its underlying hardware has failed",
+			expectedPublished: []string{expInstanceID},
+		},
+		{
+			name:             "volume detached out of band",
+			volumeID:         "vol-test",
+			disk:             &cloud.Disk{VolumeID: "vol-test", CapacityGiB: 10, State: "available"},
+			k8sObjects:       []runtime.Object{newTestVolumeAttachment("vol-test", "node-1", true), newTestCSINode("node-1", expInstanceID)},
+			expectedAbnormal: true,
+			expectedMessage:  "volume is attached to node " + expInstanceID + " in Kubernetes but not in EC2",
+		},
+		{
+			name:              "volume attached out of band",
+			volumeID:          "vol-test",
+			disk:              &cloud.Disk{VolumeID: "vol-test", CapacityGiB: 10, State: "in-use", Attachments: []string{expInstanceID}},
+			expectedAbnormal:  true,
+			expectedMessage:   "volume is attached to instance " + expInstanceID + " in EC2 but not in Kubernetes",
+			expectedPublished: []string{expInstanceID},
+		},
+		{
+			name:              "attachments not checked when the CSINode is missing",
+			volumeID:          "vol-test",
+			disk:              &cloud.Disk{VolumeID: "vol-test", CapacityGiB: 10, State: "in-use", Attachments: []string{expInstanceID}},
+			k8sObjects:        []runtime.Object{newTestVolumeAttachment("vol-test", "node-1", true)},
+			expectedMessage:   "volume is healthy",
+			expectedPublished: []string{expInstanceID},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			awsDriver, mockCtl, mockCloud := createControllerService(t)
+			defer mockCtl.Finish()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			awsDriver.attachments = newAttachmentListers(ctx, fake.NewSimpleClientset(tc.k8sObjects...))
+			if !cache.WaitForCacheSync(ctx.Done(), awsDriver.attachments.synced...) {
+				t.Fatal("Timed out waiting for the informer caches")
+			}
+			if tc.volumeID != "" {
+				mockCloud.EXPECT().GetCachedDiskByID(gomock.Any(), tc.volumeID).Return(tc.disk, tc.cloudErr)
+			}
+
+			resp, err := awsDriver.ControllerGetVolume(context.Background(), &csi.ControllerGetVolumeRequest{VolumeId: tc.volumeID})
+			if tc.expectedCode != codes.OK {
+				checkExpectedErrorCode(t, err, tc.expectedCode)
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			assert.Equal(t, tc.volumeID, resp.GetVolume().GetVolumeId())
+			assert.Equal(t, util.GiBToBytes(tc.disk.CapacityGiB), resp.GetVolume().GetCapacityBytes())
+			assert.Equal(t, tc.expectedPublished, resp.GetStatus().GetPublishedNodeIds())
+			assert.Equal(t, tc.expectedAbnormal, resp.GetStatus().GetVolumeCondition().GetAbnormal())
+			assert.Equal(t, tc.expectedMessage, resp.GetStatus().GetVolumeCondition().GetMessage())
+		})
+	}
+}
@@ -20,7 +20,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/awslabs/volume-modifier-for-k8s/pkg/rpc"
@@ -39,11 +42,18 @@ const (
 	ModificationKeyIOPS = "iops"
 
 	ModificationKeyThroughput = "throughput"
+
+	// ModificationAddTag is the prefix of the keys whose key=value is a tag to add to the volume, like the
+	// TagKeyPrefix parameters of CreateVolume
+	ModificationAddTag = TagKeyPrefix
+	// ModificationDeleteTag is the prefix of the keys whose value is the key of a tag to delete from the volume
+	ModificationDeleteTag = "tagDeletion"
 )
 
 type modifyVolumeRequest struct {
 	newSize           int64
 	modifyDiskOptions cloud.ModifyDiskOptions
+	modifyTagsOptions cloud.ModifyTagsOptions
 }
 
 func (d *ControllerService) GetCSIDriverModificationCapability(
@@ -63,14 +73,12 @@ func (d *ControllerService) ModifyVolumeProperties(
 		return nil, status.Error(codes.InvalidArgument, "Volume name not provided")
 	}
 
-	options, err := parseModifyVolumeParameters(req.GetParameters())
+	modifyRequest, err := parseModifyVolumeParameters(req.GetParameters())
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = d.modifyVolumeCoalescer.Coalesce(name, modifyVolumeRequest{
-		modifyDiskOptions: *options,
-	})
+	_, err = d.modifyVolumeCoalescer.Coalesce(name, *modifyRequest)
 	if err != nil {
 		return nil, err
 	}
@@ -79,7 +87,7 @@ func (d *ControllerService) ModifyVolumeProperties(
 }
 
 func newModifyVolumeCoalescer(c cloud.Cloud, o *Options) coalescer.Coalescer[modifyVolumeRequest, int32] {
-	return coalescer.New[modifyVolumeRequest, int32](o.ModifyVolumeRequestHandlerTimeout, mergeModifyVolumeRequest, executeModifyVolumeRequest(c))
+	return coalescer.New[modifyVolumeRequest, int32](o.ModifyVolumeRequestHandlerTimeout, mergeModifyVolumeRequest, executeModifyVolumeRequest(c, o))
 }
 
 func mergeModifyVolumeRequest(input modifyVolumeRequest, existing modifyVolumeRequest) (modifyVolumeRequest, error) {
@@ -107,29 +115,72 @@ func mergeModifyVolumeRequest(input modifyVolumeRequest, existing modifyVolumeRe
 		}
 		existing.modifyDiskOptions.VolumeType = input.modifyDiskOptions.VolumeType
 	}
+	for key, value := range input.modifyTagsOptions.TagsToAdd {
+		if existingValue, ok := existing.modifyTagsOptions.TagsToAdd[key]; ok && existingValue != value {
+			return existing, fmt.Errorf("Different value of tag %s was requested by a previous request. Current: %s, Requested: %s", key, existingValue, value)
+		}
+		if slices.Contains(existing.modifyTagsOptions.TagsToDelete, key) {
+			return existing, fmt.Errorf("Tag %s was deleted by a previous request", key)
+		}
+	}
+	for _, key := range input.modifyTagsOptions.TagsToDelete {
+		if _, ok := existing.modifyTagsOptions.TagsToAdd[key]; ok {
+			return existing, fmt.Errorf("Tag %s was added by a previous request", key)
+		}
+	}
+	if len(input.modifyTagsOptions.TagsToAdd) > 0 && existing.modifyTagsOptions.TagsToAdd == nil {
+		existing.modifyTagsOptions.TagsToAdd = make(map[string]string, len(input.modifyTagsOptions.TagsToAdd))
+	}
+	maps.Copy(existing.modifyTagsOptions.TagsToAdd, input.modifyTagsOptions.TagsToAdd)
+	for _, key := range input.modifyTagsOptions.TagsToDelete {
+		if !slices.Contains(existing.modifyTagsOptions.TagsToDelete, key) {
+			existing.modifyTagsOptions.TagsToDelete = append(existing.modifyTagsOptions.TagsToDelete, key)
+		}
+	}
 
 	return existing, nil
 }
 
-func executeModifyVolumeRequest(c cloud.Cloud) func(string, modifyVolumeRequest) (int32, error) {
+func executeModifyVolumeRequest(c cloud.Cloud, o *Options) func(string, modifyVolumeRequest) (int32, error) {
 	return func(volumeID string, req modifyVolumeRequest) (int32, error) {
 		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 		defer cancel()
-		actualSizeGiB, err := c.ResizeOrModifyDisk(ctx, volumeID, req.newSize, &req.modifyDiskOptions)
-		if err != nil {
-			// Kubernetes sidecars treats "Invalid Argument" errors as infeasible and retries less aggressively
-			if errors.Is(err, cloud.ErrInvalidArgument) {
-				return 0, status.Errorf(codes.InvalidArgument, "Could not modify volume (invalid argument) %q: %v", volumeID, err)
+		var actualSizeGiB int32
+		// EC2 ModifyVolume is only called when the volume itself is modified, not for tags alone
+		if req.newSize != 0 || req.modifyDiskOptions != (cloud.ModifyDiskOptions{}) {
+			var err error
+			actualSizeGiB, err = c.ResizeOrModifyDisk(ctx, volumeID, req.newSize, &req.modifyDiskOptions)
+			if err != nil {
+				// Kubernetes sidecars treats "Invalid Argument" errors as infeasible and retries less aggressively
+				if errors.Is(err, cloud.ErrInvalidArgument) {
+					return 0, controllerError(codes.InvalidArgument, "ModifyVolume", volumeID, fmt.Sprintf("Could not modify volume (invalid argument) %q: %v", volumeID, err), err)
+				}
+				return 0, controllerError(codes.Internal, "ModifyVolume", volumeID, fmt.Sprintf("Could not modify volume %q: %v", volumeID, err), err)
+			}
+			// Record the new settings so the parameter drift check does not report them
+			if o.ParameterDriftCheckInterval > 0 {
+				tags := provisionedParameterTags(req.modifyDiskOptions.VolumeType, req.modifyDiskOptions.IOPS, req.modifyDiskOptions.Throughput)
+				if len(tags) > 0 {
+					if err = c.TagDisk(ctx, volumeID, tags); err != nil {
+						klog.ErrorS(err, "Failed to update the provisioned parameter tags of the modified volume", "volumeID", volumeID)
+					}
+				}
+			}
+		}
+		if len(req.modifyTagsOptions.TagsToAdd) > 0 || len(req.modifyTagsOptions.TagsToDelete) > 0 {
+			if err := c.ModifyTags(ctx, volumeID, req.modifyTagsOptions); err != nil {
+				return 0, controllerError(codes.Internal, "ModifyVolume", volumeID, fmt.Sprintf("Could not modify tags of volume %q: %v", volumeID, err), err)
 			}
-			return 0, status.Errorf(codes.Internal, "Could not modify volume %q: %v", volumeID, err)
-		} else {
-			return actualSizeGiB, nil
 		}
+		return actualSizeGiB, nil
 	}
 }
 
-func parseModifyVolumeParameters(params map[string]string) (*cloud.ModifyDiskOptions, error) {
+// parseModifyVolumeParameters returns the modification of the volume and its tags requested by the mutable
+// parameters of a VolumeAttributesClass
+func parseModifyVolumeParameters(params map[string]string) (*modifyVolumeRequest, error) {
 	options := cloud.ModifyDiskOptions{}
+	tagOptions := cloud.ModifyTagsOptions{}
 
 	for key, value := range params {
 		switch key {
@@ -154,8 +205,54 @@ func parseModifyVolumeParameters(params map[string]string) (*cloud.ModifyDiskOpt
 			options.VolumeType = value
 		case ModificationKeyVolumeType:
 			options.VolumeType = value
+		default:
+			switch {
+			case strings.HasPrefix(key, ModificationAddTag):
+				tagKey, tagValue, ok := strings.Cut(value, "=")
+				if !ok {
+					return nil, status.Errorf(codes.InvalidArgument, "Invalid %s %q: must be key=value", key, value)
+				}
+				if tagOptions.TagsToAdd == nil {
+					tagOptions.TagsToAdd = map[string]string{}
+				}
+				tagOptions.TagsToAdd[tagKey] = tagValue
+			case strings.HasPrefix(key, ModificationDeleteTag):
+				tagOptions.TagsToDelete = append(tagOptions.TagsToDelete, value)
+			}
 		}
 	}
 
-	return &options, nil
+	if err := validateModifyVolumeTags(tagOptions); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid tag modification: %v", err)
+	}
+	slices.Sort(tagOptions.TagsToDelete)
+	return &modifyVolumeRequest{
+		modifyDiskOptions: options,
+		modifyTagsOptions: tagOptions,
+	}, nil
+}
+
+// validateModifyVolumeTags rejects the tags that cannot be added, or are added and deleted by the same modification
+// The tags managed by the driver, including the tags with DriverTagKeyPrefix, cannot be added nor deleted.
+func validateModifyVolumeTags(tagOptions cloud.ModifyTagsOptions) error {
+	if err := validateExtraTags(tagOptions.TagsToAdd, false); err != nil {
+		return err
+	}
+	for key := range tagOptions.TagsToAdd {
+		if strings.HasPrefix(key, DriverTagKeyPrefix) {
+			return fmt.Errorf("Tag key prefix '%s' is reserved", DriverTagKeyPrefix)
+		}
+	}
+	for _, key := range tagOptions.TagsToDelete {
+		if err := validateTag(key, ""); err != nil {
+			return err
+		}
+		if strings.HasPrefix(key, DriverTagKeyPrefix) {
+			return fmt.Errorf("Tag key prefix '%s' is reserved", DriverTagKeyPrefix)
+		}
+		if _, ok := tagOptions.TagsToAdd[key]; ok {
+			return fmt.Errorf("Tag %s cannot be both added and deleted", key)
+		}
+	}
+	return nil
 }
@@ -38,13 +38,13 @@ func TestParseModifyVolumeParameters(t *testing.T) {
 	testCases := []struct {
 		name            string
 		params          map[string]string
-		expectedOptions *cloud.ModifyDiskOptions
+		expectedOptions *modifyVolumeRequest
 		expectError     bool
 	}{
 		{
 			name:            "blank params",
 			params:          map[string]string{},
-			expectedOptions: &cloud.ModifyDiskOptions{},
+			expectedOptions: &modifyVolumeRequest{},
 		},
 		{
 			name: "basic params",
@@ -53,10 +53,12 @@ func TestParseModifyVolumeParameters(t *testing.T) {
 				ModificationKeyIOPS:       validIops,
 				ModificationKeyThroughput: validThroughput,
 			},
-			expectedOptions: &cloud.ModifyDiskOptions{
-				VolumeType: validType,
-				IOPS:       validIopsInt,
-				Throughput: validThroughputInt,
+			expectedOptions: &modifyVolumeRequest{
+				modifyDiskOptions: cloud.ModifyDiskOptions{
+					VolumeType: validType,
+					IOPS:       validIopsInt,
+					Throughput: validThroughputInt,
+				},
 			},
 		},
 		{
@@ -65,10 +67,67 @@ func TestParseModifyVolumeParameters(t *testing.T) {
 				ModificationKeyVolumeType:           validType,
 				DeprecatedModificationKeyVolumeType: "deprecated" + validType,
 			},
-			expectedOptions: &cloud.ModifyDiskOptions{
-				VolumeType: validType,
+			expectedOptions: &modifyVolumeRequest{
+				modifyDiskOptions: cloud.ModifyDiskOptions{
+					VolumeType: validType,
+				},
 			},
 		},
+		{
+			name: "tags",
+			params: map[string]string{
+				ModificationKeyIOPS:          validIops,
+				ModificationAddTag + "_1":    "billing=team-a",
+				ModificationAddTag + "_2":    "empty=",
+				ModificationDeleteTag + "_2": "owner",
+				ModificationDeleteTag + "_1": "cost-center",
+			},
+			expectedOptions: &modifyVolumeRequest{
+				modifyDiskOptions: cloud.ModifyDiskOptions{
+					IOPS: validIopsInt,
+				},
+				modifyTagsOptions: cloud.ModifyTagsOptions{
+					TagsToAdd:    map[string]string{"billing": "team-a", "empty": ""},
+					TagsToDelete: []string{"cost-center", "owner"},
+				},
+			},
+		},
+		{
+			name: "tag without value",
+			params: map[string]string{
+				ModificationAddTag + "_1": "billing",
+			},
+			expectError: true,
+		},
+		{
+			name: "reserved tag added",
+			params: map[string]string{
+				ModificationAddTag + "_1": ProvisionedIOPSTag + "=3000",
+			},
+			expectError: true,
+		},
+		{
+			name: "reserved tag deleted",
+			params: map[string]string{
+				ModificationDeleteTag + "_1": cloud.AwsEbsDriverTagKey,
+			},
+			expectError: true,
+		},
+		{
+			name: "volume name tag deleted",
+			params: map[string]string{
+				ModificationDeleteTag + "_1": cloud.VolumeNameTagKey,
+			},
+			expectError: true,
+		},
+		{
+			name: "tag added and deleted",
+			params: map[string]string{
+				ModificationAddTag + "_1":    "billing=team-a",
+				ModificationDeleteTag + "_1": "billing",
+			},
+			expectError: true,
+		},
 		{
 			name: "invalid iops",
 			params: map[string]string{
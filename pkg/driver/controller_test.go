@@ -20,9 +20,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -30,13 +34,16 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws/arn"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/golang/mock/gomock"
 	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud"
 	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/driver/internal"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/metrics"
 	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/util"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -371,6 +378,37 @@ func TestCreateVolume(t *testing.T) {
 				checkExpectedErrorCode(t, err, codes.AlreadyExists)
 			},
 		},
+		{
+			name: "Fail with invalid KMS key ID",
+			testFunc: func(t *testing.T) {
+				req := &csi.CreateVolumeRequest{
+					Name:               "vol-test",
+					CapacityRange:      stdCapRange,
+					VolumeCapabilities: stdVolCap,
+					Parameters: map[string]string{
+						EncryptedKey: "true",
+						KmsKeyIDKey:  "not-a-key",
+					},
+				}
+
+				ctx := context.Background()
+
+				mockCtl := gomock.NewController(t)
+				defer mockCtl.Finish()
+
+				mockCloud := cloud.NewMockCloud(mockCtl)
+				mockCloud.EXPECT().CreateDisk(gomock.Eq(ctx), gomock.Eq(req.GetName()), gomock.Any()).Return(nil, fmt.Errorf("%w: %q is not a key", cloud.ErrInvalidKMSKeyID, "not-a-key"))
+
+				awsDriver := ControllerService{
+					cloud:    mockCloud,
+					inFlight: internal.NewInFlight(),
+					options:  &Options{},
+				}
+
+				_, err := awsDriver.CreateVolume(ctx, req)
+				checkExpectedErrorCode(t, err, codes.InvalidArgument)
+			},
+		},
 		{
 			name: "fail no name",
 			testFunc: func(t *testing.T) {
@@ -1034,7 +1072,406 @@ func TestCreateVolume(t *testing.T) {
 				defer mockCtl.Finish()
 
 				mockCloud := cloud.NewMockCloud(mockCtl)
-				mockCloud.EXPECT().CreateDisk(gomock.Eq(ctx), gomock.Eq(req.GetName()), gomock.Any()).Return(mockDisk, nil)
+				mockCloud.EXPECT().CreateDisk(gomock.Eq(ctx), gomock.Eq(req.GetName()), gomock.Any()).Return(mockDisk, nil)
+
+				awsDriver := ControllerService{
+					cloud:    mockCloud,
+					inFlight: internal.NewInFlight(),
+					options:  &Options{},
+				}
+
+				if _, err := awsDriver.CreateVolume(ctx, req); err != nil {
+					srvErr, ok := status.FromError(err)
+					if !ok {
+						t.Fatalf("Could not get error status code from error: %v", srvErr)
+					}
+					t.Fatalf("Unexpected error: %v", srvErr.Code())
+				}
+			},
+		},
+		{
+			name: "success with mutable parameters",
+			testFunc: func(t *testing.T) {
+				volSize := int64(20 * 1024 * 1024 * 1024)
+				capRange := &csi.CapacityRange{RequiredBytes: volSize}
+				req := &csi.CreateVolumeRequest{
+					Name:               "vol-test",
+					CapacityRange:      capRange,
+					VolumeCapabilities: stdVolCap,
+					Parameters: map[string]string{
+						VolumeTypeKey: cloud.VolumeTypeGP3,
+						IopsKey:       "5000",
+					},
+					MutableParameters: map[string]string{
+						IopsKey:                   "4000",
+						ModificationAddTag + "_1": "team=storage",
+					},
+				}
+
+				ctx := context.Background()
+
+				mockDisk := &cloud.Disk{
+					VolumeID:         req.GetName(),
+					AvailabilityZone: expZone,
+					CapacityGiB:      util.BytesToGiB(volSize),
+				}
+
+				mockCtl := gomock.NewController(t)
+				defer mockCtl.Finish()
+
+				mockCloud := cloud.NewMockCloud(mockCtl)
+				mockCloud.EXPECT().CreateDisk(gomock.Eq(ctx), gomock.Eq(req.GetName()), gomock.Any()).DoAndReturn(func(_ context.Context, _ string, diskOptions *cloud.DiskOptions) (*cloud.Disk, error) {
+					assert.Equal(t, int32(4000), diskOptions.IOPS)
+					assert.Equal(t, "storage", diskOptions.Tags["team"])
+					return mockDisk, nil
+				})
+				awsDriver := ControllerService{
+					cloud:    mockCloud,
+					inFlight: internal.NewInFlight(),
+					options:  &Options{},
+				}
+
+				if _, err := awsDriver.CreateVolume(ctx, req); err != nil {
+					srvErr, ok := status.FromError(err)
+					if !ok {
+						t.Fatalf("Could not get error status code from error: %v", srvErr)
+					}
+					t.Fatalf("Unexpected error: %v", srvErr.Code())
+				}
+			},
+		},
+		{
+			name: "fail with invalid volume parameter",
+			testFunc: func(t *testing.T) {
+				req := &csi.CreateVolumeRequest{
+					Name:               "vol-test",
+					CapacityRange:      stdCapRange,
+					VolumeCapabilities: stdVolCap,
+					Parameters: map[string]string{
+						VolumeTypeKey: cloud.VolumeTypeIO1,
+						IopsPerGBKey:  "5",
+						"unknownKey":  "unknownValue",
+					},
+				}
+
+				ctx := context.Background()
+
+				mockCtl := gomock.NewController(t)
+				defer mockCtl.Finish()
+
+				mockCloud := cloud.NewMockCloud(mockCtl)
+
+				awsDriver := ControllerService{
+					cloud:    mockCloud,
+					inFlight: internal.NewInFlight(),
+					options:  &Options{},
+				}
+
+				_, err := awsDriver.CreateVolume(ctx, req)
+				if err == nil {
+					t.Fatalf("Expected CreateVolume to fail but got no error")
+				}
+
+				srvErr, ok := status.FromError(err)
+				if !ok {
+					t.Fatalf("Could not get error status code from error: %v", srvErr)
+				}
+				if srvErr.Code() != codes.InvalidArgument {
+					t.Fatalf("Expect InvalidArgument but got: %s", srvErr.Code())
+				}
+			},
+		},
+		{
+			name: "fail with invalid iops parameter",
+			testFunc: func(t *testing.T) {
+				req := &csi.CreateVolumeRequest{
+					Name:               "vol-test",
+					CapacityRange:      stdCapRange,
+					VolumeCapabilities: stdVolCap,
+					Parameters: map[string]string{
+						VolumeTypeKey: cloud.VolumeTypeGP3,
+						IopsKey:       "aaa",
+					},
+				}
+
+				ctx := context.Background()
+
+				mockCtl := gomock.NewController(t)
+				defer mockCtl.Finish()
+
+				mockCloud := cloud.NewMockCloud(mockCtl)
+
+				awsDriver := ControllerService{
+					cloud:    mockCloud,
+					inFlight: internal.NewInFlight(),
+					options:  &Options{},
+				}
+
+				_, err := awsDriver.CreateVolume(ctx, req)
+				if err == nil {
+					t.Fatalf("Expected CreateVolume to fail but got no error")
+				}
+
+				srvErr, ok := status.FromError(err)
+				if !ok {
+					t.Fatalf("Could not get error status code from error: %v", srvErr)
+				}
+				if srvErr.Code() != codes.InvalidArgument {
+					t.Fatalf("Expect InvalidArgument but got: %s", srvErr.Code())
+				}
+			},
+		},
+		{
+			name: "success with volume type gp3 using iopsPerGB and throughputPerGiB",
+			testFunc: func(t *testing.T) {
+				req := &csi.CreateVolumeRequest{
+					Name:               "vol-test",
+					CapacityRange:      stdCapRange,
+					VolumeCapabilities: stdVolCap,
+					Parameters: map[string]string{
+						VolumeTypeKey:                 cloud.VolumeTypeGP3,
+						IopsPerGBKey:                  "10",
+						"throughputPerGiB":            "1",
+						AllowAutoIOPSPerGBIncreaseKey: "true",
+					},
+				}
+
+				ctx := context.Background()
+
+				mockDisk := &cloud.Disk{
+					VolumeID:         req.GetName(),
+					AvailabilityZone: expZone,
+					CapacityGiB:      util.BytesToGiB(stdVolSize),
+				}
+
+				mockCtl := gomock.NewController(t)
+				defer mockCtl.Finish()
+
+				mockCloud := cloud.NewMockCloud(mockCtl)
+				mockCloud.EXPECT().CreateDisk(gomock.Eq(ctx), gomock.Eq(req.GetName()), gomock.Any()).DoAndReturn(func(_ context.Context, _ string, opts *cloud.DiskOptions) (*cloud.Disk, error) {
+					if opts.IOPSPerGB != 10 || opts.ThroughputPerGiB != 1 || !opts.AllowIOPSPerGBIncrease {
+						t.Errorf("Unexpected disk options: %+v", opts)
+					}
+					return mockDisk, nil
+				})
+
+				awsDriver := ControllerService{
+					cloud:    mockCloud,
+					inFlight: internal.NewInFlight(),
+					options:  &Options{},
+				}
+
+				if _, err := awsDriver.CreateVolume(ctx, req); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			},
+		},
+		{
+			name: "fail with gp3 throughputPerGiB out of range",
+			testFunc: func(t *testing.T) {
+				req := &csi.CreateVolumeRequest{
+					Name:               "vol-test",
+					CapacityRange:      stdCapRange,
+					VolumeCapabilities: stdVolCap,
+					Parameters: map[string]string{
+						VolumeTypeKey:       cloud.VolumeTypeGP3,
+						ThroughputPerGiBKey: "1",
+					},
+				}
+
+				ctx := context.Background()
+
+				mockCtl := gomock.NewController(t)
+				defer mockCtl.Finish()
+
+				mockCloud := cloud.NewMockCloud(mockCtl)
+				mockCloud.EXPECT().CreateDisk(gomock.Eq(ctx), gomock.Eq(req.GetName()), gomock.Any()).Return(nil, fmt.Errorf("%w: throughputPerGiB of 1 gives 5 MiB/s for 5 GiB, gp3 volumes require at least 125 MiB/s", cloud.ErrInvalidPerformanceRatio))
+
+				awsDriver := ControllerService{
+					cloud:    mockCloud,
+					inFlight: internal.NewInFlight(),
+					options:  &Options{},
+				}
+
+				_, err := awsDriver.CreateVolume(ctx, req)
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("Expect InvalidArgument but got: %v", err)
+				}
+			},
+		},
+		{
+			name: "fail with iops and iopsPerGB",
+			testFunc: func(t *testing.T) {
+				req := &csi.CreateVolumeRequest{
+					Name:               "vol-test",
+					CapacityRange:      stdCapRange,
+					VolumeCapabilities: stdVolCap,
+					Parameters: map[string]string{
+						VolumeTypeKey: cloud.VolumeTypeGP3,
+						IopsKey:       "4000",
+						IopsPerGBKey:  "10",
+					},
+				}
+
+				ctx := context.Background()
+
+				mockCtl := gomock.NewController(t)
+				defer mockCtl.Finish()
+
+				mockCloud := cloud.NewMockCloud(mockCtl)
+
+				awsDriver := ControllerService{
+					cloud:    mockCloud,
+					inFlight: internal.NewInFlight(),
+					options:  &Options{},
+				}
+
+				_, err := awsDriver.CreateVolume(ctx, req)
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("Expect InvalidArgument but got: %v", err)
+				}
+			},
+		},
+		{
+			name: "fail with throughput and throughputPerGiB",
+			testFunc: func(t *testing.T) {
+				req := &csi.CreateVolumeRequest{
+					Name:               "vol-test",
+					CapacityRange:      stdCapRange,
+					VolumeCapabilities: stdVolCap,
+					Parameters: map[string]string{
+						VolumeTypeKey:       cloud.VolumeTypeGP3,
+						ThroughputKey:       "250",
+						ThroughputPerGiBKey: "1",
+					},
+				}
+
+				ctx := context.Background()
+
+				mockCtl := gomock.NewController(t)
+				defer mockCtl.Finish()
+
+				mockCloud := cloud.NewMockCloud(mockCtl)
+
+				awsDriver := ControllerService{
+					cloud:    mockCloud,
+					inFlight: internal.NewInFlight(),
+					options:  &Options{},
+				}
+
+				_, err := awsDriver.CreateVolume(ctx, req)
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("Expect InvalidArgument but got: %v", err)
+				}
+			},
+		},
+		{
+			name: "fail with invalid throughputPerGiB parameter",
+			testFunc: func(t *testing.T) {
+				req := &csi.CreateVolumeRequest{
+					Name:               "vol-test",
+					CapacityRange:      stdCapRange,
+					VolumeCapabilities: stdVolCap,
+					Parameters: map[string]string{
+						VolumeTypeKey:       cloud.VolumeTypeGP3,
+						ThroughputPerGiBKey: "aaa",
+					},
+				}
+
+				ctx := context.Background()
+
+				mockCtl := gomock.NewController(t)
+				defer mockCtl.Finish()
+
+				mockCloud := cloud.NewMockCloud(mockCtl)
+
+				awsDriver := ControllerService{
+					cloud:    mockCloud,
+					inFlight: internal.NewInFlight(),
+					options:  &Options{},
+				}
+
+				_, err := awsDriver.CreateVolume(ctx, req)
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("Expect InvalidArgument but got: %v", err)
+				}
+			},
+		},
+		{
+			name: "success with volumeInitializationRate and a snapshot source",
+			testFunc: func(t *testing.T) {
+				req := &csi.CreateVolumeRequest{
+					Name:               "vol-test",
+					CapacityRange:      stdCapRange,
+					VolumeCapabilities: stdVolCap,
+					Parameters: map[string]string{
+						"volumeInitializationRate": "200",
+					},
+					VolumeContentSource: &csi.VolumeContentSource{
+						Type: &csi.VolumeContentSource_Snapshot{
+							Snapshot: &csi.VolumeContentSource_SnapshotSource{
+								SnapshotId: "snapshot-id",
+							},
+						},
+					},
+				}
+
+				ctx := context.Background()
+
+				mockDisk := &cloud.Disk{
+					VolumeID:         req.GetName(),
+					AvailabilityZone: expZone,
+					CapacityGiB:      util.BytesToGiB(stdVolSize),
+					SnapshotID:       "snapshot-id",
+				}
+
+				mockCtl := gomock.NewController(t)
+				defer mockCtl.Finish()
+
+				mockCloud := cloud.NewMockCloud(mockCtl)
+				mockCloud.EXPECT().CreateDisk(gomock.Eq(ctx), gomock.Eq(req.GetName()), gomock.Any()).DoAndReturn(func(_ context.Context, _ string, opts *cloud.DiskOptions) (*cloud.Disk, error) {
+					if opts.VolumeInitializationRate != 200 || opts.SnapshotID != "snapshot-id" {
+						t.Errorf("Unexpected disk options: %+v", opts)
+					}
+					return mockDisk, nil
+				})
+
+				awsDriver := ControllerService{
+					cloud:    mockCloud,
+					inFlight: internal.NewInFlight(),
+					options:  &Options{},
+				}
+
+				if _, err := awsDriver.CreateVolume(ctx, req); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			},
+		},
+		{
+			name: "fail with volumeInitializationRate below the range",
+			testFunc: func(t *testing.T) {
+				req := &csi.CreateVolumeRequest{
+					Name:               "vol-test",
+					CapacityRange:      stdCapRange,
+					VolumeCapabilities: stdVolCap,
+					Parameters: map[string]string{
+						VolumeInitializationRateKey: "50",
+					},
+					VolumeContentSource: &csi.VolumeContentSource{
+						Type: &csi.VolumeContentSource_Snapshot{
+							Snapshot: &csi.VolumeContentSource_SnapshotSource{
+								SnapshotId: "snapshot-id",
+							},
+						},
+					},
+				}
+
+				ctx := context.Background()
+
+				mockCtl := gomock.NewController(t)
+				defer mockCtl.Finish()
+
+				mockCloud := cloud.NewMockCloud(mockCtl)
 
 				awsDriver := ControllerService{
 					cloud:    mockCloud,
@@ -1042,75 +1479,59 @@ func TestCreateVolume(t *testing.T) {
 					options:  &Options{},
 				}
 
-				if _, err := awsDriver.CreateVolume(ctx, req); err != nil {
-					srvErr, ok := status.FromError(err)
-					if !ok {
-						t.Fatalf("Could not get error status code from error: %v", srvErr)
-					}
-					t.Fatalf("Unexpected error: %v", srvErr.Code())
+				_, err := awsDriver.CreateVolume(ctx, req)
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("Expect InvalidArgument but got: %v", err)
 				}
 			},
 		},
 		{
-			name: "success with mutable parameters",
+			name: "fail with volumeInitializationRate above the range",
 			testFunc: func(t *testing.T) {
-				volSize := int64(20 * 1024 * 1024 * 1024)
-				capRange := &csi.CapacityRange{RequiredBytes: volSize}
 				req := &csi.CreateVolumeRequest{
 					Name:               "vol-test",
-					CapacityRange:      capRange,
+					CapacityRange:      stdCapRange,
 					VolumeCapabilities: stdVolCap,
 					Parameters: map[string]string{
-						VolumeTypeKey: cloud.VolumeTypeGP3,
-						IopsKey:       "5000",
+						VolumeInitializationRateKey: "400",
 					},
-					MutableParameters: map[string]string{
-						IopsKey: "4000",
+					VolumeContentSource: &csi.VolumeContentSource{
+						Type: &csi.VolumeContentSource_Snapshot{
+							Snapshot: &csi.VolumeContentSource_SnapshotSource{
+								SnapshotId: "snapshot-id",
+							},
+						},
 					},
 				}
 
 				ctx := context.Background()
 
-				mockDisk := &cloud.Disk{
-					VolumeID:         req.GetName(),
-					AvailabilityZone: expZone,
-					CapacityGiB:      util.BytesToGiB(volSize),
-				}
-
 				mockCtl := gomock.NewController(t)
 				defer mockCtl.Finish()
 
 				mockCloud := cloud.NewMockCloud(mockCtl)
-				mockCloud.EXPECT().CreateDisk(gomock.Eq(ctx), gomock.Eq(req.GetName()), gomock.Any()).DoAndReturn(func(_ context.Context, _ string, diskOptions *cloud.DiskOptions) (*cloud.Disk, error) {
-					assert.Equal(t, int32(4000), diskOptions.IOPS)
-					return mockDisk, nil
-				})
+
 				awsDriver := ControllerService{
 					cloud:    mockCloud,
 					inFlight: internal.NewInFlight(),
 					options:  &Options{},
 				}
 
-				if _, err := awsDriver.CreateVolume(ctx, req); err != nil {
-					srvErr, ok := status.FromError(err)
-					if !ok {
-						t.Fatalf("Could not get error status code from error: %v", srvErr)
-					}
-					t.Fatalf("Unexpected error: %v", srvErr.Code())
+				_, err := awsDriver.CreateVolume(ctx, req)
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("Expect InvalidArgument but got: %v", err)
 				}
 			},
 		},
 		{
-			name: "fail with invalid volume parameter",
+			name: "fail with volumeInitializationRate without a snapshot source",
 			testFunc: func(t *testing.T) {
 				req := &csi.CreateVolumeRequest{
 					Name:               "vol-test",
 					CapacityRange:      stdCapRange,
 					VolumeCapabilities: stdVolCap,
 					Parameters: map[string]string{
-						VolumeTypeKey: cloud.VolumeTypeIO1,
-						IopsPerGBKey:  "5",
-						"unknownKey":  "unknownValue",
+						VolumeInitializationRateKey: "200",
 					},
 				}
 
@@ -1128,29 +1549,27 @@ func TestCreateVolume(t *testing.T) {
 				}
 
 				_, err := awsDriver.CreateVolume(ctx, req)
-				if err == nil {
-					t.Fatalf("Expected CreateVolume to fail but got no error")
-				}
-
-				srvErr, ok := status.FromError(err)
-				if !ok {
-					t.Fatalf("Could not get error status code from error: %v", srvErr)
-				}
-				if srvErr.Code() != codes.InvalidArgument {
-					t.Fatalf("Expect InvalidArgument but got: %s", srvErr.Code())
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("Expect InvalidArgument but got: %v", err)
 				}
 			},
 		},
 		{
-			name: "fail with invalid iops parameter",
+			name: "fail with invalid volumeInitializationRate parameter",
 			testFunc: func(t *testing.T) {
 				req := &csi.CreateVolumeRequest{
 					Name:               "vol-test",
 					CapacityRange:      stdCapRange,
 					VolumeCapabilities: stdVolCap,
 					Parameters: map[string]string{
-						VolumeTypeKey: cloud.VolumeTypeGP3,
-						IopsKey:       "aaa",
+						VolumeInitializationRateKey: "fast",
+					},
+					VolumeContentSource: &csi.VolumeContentSource{
+						Type: &csi.VolumeContentSource_Snapshot{
+							Snapshot: &csi.VolumeContentSource_SnapshotSource{
+								SnapshotId: "snapshot-id",
+							},
+						},
 					},
 				}
 
@@ -1168,16 +1587,8 @@ func TestCreateVolume(t *testing.T) {
 				}
 
 				_, err := awsDriver.CreateVolume(ctx, req)
-				if err == nil {
-					t.Fatalf("Expected CreateVolume to fail but got no error")
-				}
-
-				srvErr, ok := status.FromError(err)
-				if !ok {
-					t.Fatalf("Could not get error status code from error: %v", srvErr)
-				}
-				if srvErr.Code() != codes.InvalidArgument {
-					t.Fatalf("Expect InvalidArgument but got: %s", srvErr.Code())
+				if status.Code(err) != codes.InvalidArgument {
+					t.Fatalf("Expect InvalidArgument but got: %v", err)
 				}
 			},
 		},
@@ -1376,6 +1787,70 @@ func TestCreateVolume(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "success with reloaded extra tags",
+			testFunc: func(t *testing.T) {
+				const volumeName = "random-vol-name"
+				req := &csi.CreateVolumeRequest{
+					Name:               volumeName,
+					CapacityRange:      stdCapRange,
+					VolumeCapabilities: stdVolCap,
+					Parameters:         nil,
+				}
+
+				ctx := context.Background()
+
+				mockDisk := &cloud.Disk{
+					VolumeID:         req.GetName(),
+					AvailabilityZone: expZone,
+					CapacityGiB:      util.BytesToGiB(stdVolSize),
+				}
+
+				path := filepath.Join(t.TempDir(), "extra-tags.json")
+				if err := os.WriteFile(path, []byte(`{"cost-center": "1234"}`), 0600); err != nil {
+					t.Fatalf("failed to write extra tags file: %v", err)
+				}
+				options := &Options{
+					ExtraTags:     map[string]string{"team": "storage"},
+					ExtraTagsFile: path,
+				}
+				tags := NewTagManager(options)
+
+				mockCtl := gomock.NewController(t)
+				defer mockCtl.Finish()
+
+				mockCloud := cloud.NewMockCloud(mockCtl)
+				awsDriver := ControllerService{
+					cloud:    mockCloud,
+					inFlight: internal.NewInFlight(),
+					options:  options,
+					tags:     tags,
+				}
+
+				// Each CreateVolume uses the tags current at the time of the call
+				for _, expected := range []map[string]string{
+					{"team": "storage"},
+					{"team": "storage", "cost-center": "1234"},
+				} {
+					diskOptions := &cloud.DiskOptions{
+						CapacityBytes: stdVolSize,
+						Tags: map[string]string{
+							cloud.VolumeNameTagKey:   volumeName,
+							cloud.AwsEbsDriverTagKey: "true",
+						},
+					}
+					maps.Copy(diskOptions.Tags, expected)
+					mockCloud.EXPECT().CreateDisk(gomock.Eq(ctx), gomock.Eq(req.GetName()), gomock.Eq(diskOptions)).Return(mockDisk, nil)
+
+					if _, err := awsDriver.CreateVolume(ctx, req); err != nil {
+						t.Fatalf("Unexpected error: %v", err)
+					}
+					if err := tags.Reload(); err != nil {
+						t.Fatalf("Unexpected error reloading tags: %v", err)
+					}
+				}
+			},
+		},
 		{
 			name: "success with cluster-id",
 			testFunc: func(t *testing.T) {
@@ -1745,6 +2220,21 @@ func TestCreateVolumeWithFormattingParameters(t *testing.T) {
 			},
 			errExpected: false,
 		},
+		{
+			name: "success with ext4 stride and stripe width",
+			formattingOptionParameters: map[string]string{
+				Ext4StrideKey:      "16",
+				Ext4StripeWidthKey: "64",
+			},
+			errExpected: false,
+		},
+		{
+			name: "success with ext4 lazy init",
+			formattingOptionParameters: map[string]string{
+				Ext4LazyInitKey: "false",
+			},
+			errExpected: false,
+		},
 		{
 			name: "failure with block size",
 			formattingOptionParameters: map[string]string{
@@ -1781,6 +2271,28 @@ func TestCreateVolumeWithFormattingParameters(t *testing.T) {
 			},
 			errExpected: true,
 		},
+		{
+			name: "failure with ext4 stride",
+			formattingOptionParameters: map[string]string{
+				Ext4StrideKey: "wrong_value",
+			},
+			errExpected: true,
+		},
+		{
+			name: "failure with ext4 lazy init",
+			formattingOptionParameters: map[string]string{
+				Ext4LazyInitKey: "wrong_value",
+			},
+			errExpected: true,
+		},
+		{
+			name: "failure with ext4 stripe width not a multiple of stride",
+			formattingOptionParameters: map[string]string{
+				Ext4StrideKey:      "16",
+				Ext4StripeWidthKey: "40",
+			},
+			errExpected: true,
+		},
 		{
 			name: "failure with ext4 bigalloc option and cluster size mismatch",
 			formattingOptionParameters: map[string]string{
@@ -1848,6 +2360,116 @@ func TestCreateVolumeWithFormattingParameters(t *testing.T) {
 	}
 }
 
+func TestCreateVolumeWithKmsKeyByVolumeType(t *testing.T) {
+	stdVolCap := []*csi.VolumeCapability{
+		{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			},
+		},
+	}
+	stdVolSize := int64(5 * 1024 * 1024 * 1024)
+	stdCapRange := &csi.CapacityRange{RequiredBytes: stdVolSize}
+
+	io2Key := "arn:aws:kms:us-east-1:012345678910:key/abcd1234-a123-456a-a12b-a123b4cd56ef"
+	gp3Key := "alias/dev"
+	kmsKeyByVolumeType := map[string]string{
+		cloud.VolumeTypeIO2: io2Key,
+		cloud.VolumeTypeGP3: gp3Key,
+	}
+
+	testCases := []struct {
+		name          string
+		parameters    map[string]string
+		expectedKmsID string
+	}{
+		{
+			name: "mapping hit",
+			parameters: map[string]string{
+				VolumeTypeKey: cloud.VolumeTypeIO2,
+				IopsKey:       "3000",
+				EncryptedKey:  "true",
+			},
+			expectedKmsID: io2Key,
+		},
+		{
+			name: "mapping hit for default volume type",
+			parameters: map[string]string{
+				EncryptedKey: "true",
+			},
+			expectedKmsID: gp3Key,
+		},
+		{
+			name: "mapping miss uses default key",
+			parameters: map[string]string{
+				VolumeTypeKey: cloud.VolumeTypeST1,
+				EncryptedKey:  "true",
+			},
+			expectedKmsID: "",
+		},
+		{
+			name: "explicit key overrides mapping",
+			parameters: map[string]string{
+				VolumeTypeKey: cloud.VolumeTypeIO2,
+				IopsKey:       "3000",
+				EncryptedKey:  "true",
+				KmsKeyIDKey:   "alias/explicit",
+			},
+			expectedKmsID: "alias/explicit",
+		},
+		{
+			name: "mapping ignored without encryption",
+			parameters: map[string]string{
+				VolumeTypeKey: cloud.VolumeTypeIO2,
+				IopsKey:       "3000",
+			},
+			expectedKmsID: "",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := &csi.CreateVolumeRequest{
+				Name:               "random-vol-name",
+				CapacityRange:      stdCapRange,
+				VolumeCapabilities: stdVolCap,
+				Parameters:         tc.parameters,
+			}
+
+			ctx := context.Background()
+
+			mockDisk := &cloud.Disk{
+				VolumeID:         req.GetName(),
+				AvailabilityZone: expZone,
+				CapacityGiB:      util.BytesToGiB(stdVolSize),
+			}
+
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+
+			mockCloud := cloud.NewMockCloud(mockCtl)
+			mockCloud.EXPECT().CreateDisk(gomock.Eq(ctx), gomock.Eq(req.GetName()), gomock.Any()).DoAndReturn(
+				func(_ context.Context, _ string, diskOptions *cloud.DiskOptions) (*cloud.Disk, error) {
+					assert.Equal(t, tc.expectedKmsID, diskOptions.KmsKeyID)
+					return mockDisk, nil
+				})
+
+			awsDriver := ControllerService{
+				cloud:    mockCloud,
+				inFlight: internal.NewInFlight(),
+				options: &Options{
+					KmsKeyByVolumeType: kmsKeyByVolumeType,
+				},
+			}
+
+			_, err := awsDriver.CreateVolume(ctx, req)
+			require.NoError(t, err)
+		})
+	}
+}
+
 func TestDeleteVolume(t *testing.T) {
 	testCases := []struct {
 		name     string
@@ -2035,36 +2657,154 @@ func TestPickAvailabilityZone(t *testing.T) {
 			expZone: expZone,
 		},
 		{
-			name: "Pick from requisite",
+			name: "Pick from requisite",
+			requirement: &csi.TopologyRequirement{
+				Requisite: []*csi.Topology{
+					{
+						Segments: map[string]string{ZoneTopologyKey: expZone},
+					},
+				},
+			},
+			expZone: expZone,
+		},
+		{
+			name: "Pick from empty topology",
+			requirement: &csi.TopologyRequirement{
+				Preferred: []*csi.Topology{{}},
+				Requisite: []*csi.Topology{{}},
+			},
+			expZone: "",
+		},
+		{
+			name:        "Topology Requirement is nil",
+			requirement: nil,
+			expZone:     "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := pickAvailabilityZone(tc.requirement)
+			if actual != tc.expZone {
+				t.Fatalf("Expected zone %v, got zone: %v", tc.expZone, actual)
+			}
+		})
+	}
+}
+
+func TestPickAllowedAvailabilityZone(t *testing.T) {
+	testCases := []struct {
+		name          string
+		requirement   *csi.TopologyRequirement
+		excludedZones []string
+		expZone       string
+		expErr        error
+		expOutcome    string
+	}{
+		{
+			name: "No excluded zones",
+			requirement: &csi.TopologyRequirement{
+				Requisite: []*csi.Topology{
+					{Segments: map[string]string{WellKnownZoneTopologyKey: "us-east-1c"}},
+				},
+			},
+			expZone: "us-east-1c",
+		},
+		{
+			name: "Excluded zone is not picked",
+			requirement: &csi.TopologyRequirement{
+				Requisite: []*csi.Topology{
+					{Segments: map[string]string{WellKnownZoneTopologyKey: "us-east-1a"}},
+					{Segments: map[string]string{WellKnownZoneTopologyKey: "us-east-1c"}},
+				},
+				Preferred: []*csi.Topology{
+					{Segments: map[string]string{WellKnownZoneTopologyKey: "us-east-1a"}},
+				},
+			},
+			excludedZones: []string{"us-east-1c"},
+			expZone:       "us-east-1a",
+		},
+		{
+			name: "Skip excluded zone with an alternative in requisite",
 			requirement: &csi.TopologyRequirement{
 				Requisite: []*csi.Topology{
-					{
-						Segments: map[string]string{ZoneTopologyKey: expZone},
-					},
+					{Segments: map[string]string{WellKnownZoneTopologyKey: "us-east-1c"}},
+					{Segments: map[string]string{ZoneTopologyKey: "us-east-1b"}},
+				},
+				Preferred: []*csi.Topology{
+					{Segments: map[string]string{WellKnownZoneTopologyKey: "us-east-1c"}},
 				},
 			},
-			expZone: expZone,
+			excludedZones: []string{"us-east-1c"},
+			expZone:       "us-east-1b",
+			expOutcome:    ExcludedZoneOutcomeSkipped,
 		},
 		{
-			name: "Pick from empty topology",
+			name: "Fail when the only requisite zone is excluded",
 			requirement: &csi.TopologyRequirement{
-				Preferred: []*csi.Topology{{}},
-				Requisite: []*csi.Topology{{}},
+				Requisite: []*csi.Topology{
+					{Segments: map[string]string{WellKnownZoneTopologyKey: "us-east-1c"}},
+				},
+				Preferred: []*csi.Topology{
+					{Segments: map[string]string{WellKnownZoneTopologyKey: "us-east-1c"}},
+				},
 			},
-			expZone: "",
+			excludedZones: []string{"us-east-1a", "us-east-1c"},
+			expErr:        status.Error(codes.FailedPrecondition, "Availability Zone us-east-1c is excluded by --excluded-zones and the topology requirement allows no other zone"),
+			expOutcome:    ExcludedZoneOutcomeRejected,
 		},
 		{
-			name:        "Topology Requirement is nil",
-			requirement: nil,
-			expZone:     "",
+			name:          "Topology Requirement is nil",
+			excludedZones: []string{"us-east-1c"},
 		},
 	}
 
+	recorder := metrics.InitializeRecorder()
+	// exclusionCounts returns the number of exclusions recorded in ExcludedZoneMetric by outcome
+	exclusionCounts := func() map[string]float64 {
+		families, err := recorder.Gatherer().Gather()
+		if err != nil {
+			t.Fatalf("failed to gather metrics: %v", err)
+		}
+		counts := map[string]float64{}
+		for _, family := range families {
+			if family.GetName() != ExcludedZoneMetric {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				for _, label := range metric.GetLabel() {
+					if label.GetName() == "outcome" {
+						counts[label.GetValue()] += metric.GetCounter().GetValue()
+					}
+				}
+			}
+		}
+		return counts
+	}
+
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			actual := pickAvailabilityZone(tc.requirement)
-			if actual != tc.expZone {
-				t.Fatalf("Expected zone %v, got zone: %v", tc.expZone, actual)
+			before := exclusionCounts()
+
+			zone, err := pickAllowedAvailabilityZone(tc.requirement, tc.excludedZones)
+			if tc.expErr != nil {
+				expectStatusErr(t, tc.expErr, err)
+			} else if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if zone != tc.expZone {
+				t.Fatalf("Expected zone %v, got zone: %v", tc.expZone, zone)
+			}
+
+			after := exclusionCounts()
+			for _, outcome := range []string{ExcludedZoneOutcomeSkipped, ExcludedZoneOutcomeRejected} {
+				expected := before[outcome]
+				if outcome == tc.expOutcome {
+					expected++
+				}
+				if after[outcome] != expected {
+					t.Errorf("Expected %v exclusions with outcome %q, got %v", expected, outcome, after[outcome])
+				}
 			}
 		})
 	}
@@ -2170,7 +2910,14 @@ func TestBuildOutpostArn(t *testing.T) {
 			awsRegion:    "us-west-2",
 			awsOutpostID: "op-0aaa000a0aaaa00a0",
 			awsAccountID: "111111111111",
-			expectedArn:  "",
+			expectedArn:  expRawOutpostArn,
+		},
+		{
+			name:         "partition is detected from the region when missing",
+			awsRegion:    "us-gov-west-1",
+			awsOutpostID: "op-0aaa000a0aaaa00a0",
+			awsAccountID: "111111111111",
+			expectedArn:  "arn:aws-us-gov:outposts:us-gov-west-1:111111111111:outpost/op-0aaa000a0aaaa00a0",
 		},
 		{
 			name:         "region is missing",
@@ -2373,6 +3120,44 @@ func TestCreateSnapshot(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "fail too many tags once class tags are merged",
+			testFunc: func(t *testing.T) {
+				parameters := map[string]string{}
+				for i := 0; i < 9; i++ {
+					parameters[fmt.Sprintf("%s_%d", TagKeyPrefix, i)] = fmt.Sprintf("class-tag-%d=value", i)
+				}
+				req := &csi.CreateSnapshotRequest{
+					Name:           "test-snapshot",
+					Parameters:     parameters,
+					SourceVolumeId: "vol-test",
+				}
+
+				mockCtl := gomock.NewController(t)
+				defer mockCtl.Finish()
+
+				mockCloud := cloud.NewMockCloud(mockCtl)
+				mockCloud.EXPECT().GetSnapshotByName(gomock.Any(), gomock.Eq(req.GetName())).Return(nil, cloud.ErrNotFound)
+
+				// 40 extra tags and 2 automatic tags fit, the 9 class tags do not
+				extraTags := map[string]string{}
+				for i := 0; i < 40; i++ {
+					extraTags[fmt.Sprintf("extra-tag-%d", i)] = "value"
+				}
+				awsDriver := ControllerService{
+					cloud:    mockCloud,
+					inFlight: internal.NewInFlight(),
+					options: &Options{
+						ExtraTags: extraTags,
+					},
+				}
+				_, err := awsDriver.CreateSnapshot(context.Background(), req)
+				checkExpectedErrorCode(t, err, codes.InvalidArgument)
+				if err != nil && !strings.Contains(err.Error(), "actual: 51, limit: 50") {
+					t.Fatalf("Expected error to report the number of tags, got: %v", err)
+				}
+			},
+		},
 		{
 			name: "fail no name",
 			testFunc: func(t *testing.T) {
@@ -2956,6 +3741,145 @@ func TestCreateSnapshot(t *testing.T) {
 	}
 }
 
+func TestCreateSnapshotFastSnapshotRestores(t *testing.T) {
+	const snapshotName = "test-snapshot"
+	zones := []string{"us-east-1a", "us-east-1f"}
+	snapshot := &cloud.Snapshot{SnapshotID: "snap-test", SourceVolumeID: "vol-test", Size: 1, CreationTime: time.Now()}
+	quotaErr := &smithy.GenericAPIError{Code: "ConcurrentSnapshotLimitExceeded", Message: "fast snapshot restore quota reached"}
+	// partialOutput is the response of EC2 when fast snapshot restores are enabled in only one of the zones
+	partialOutput := &ec2.EnableFastSnapshotRestoresOutput{
+		Successful: []types.EnableFastSnapshotRestoreSuccessItem{{AvailabilityZone: aws.String("us-east-1a"), SnapshotId: aws.String("snap-test")}},
+		Unsuccessful: []types.EnableFastSnapshotRestoreErrorItem{{
+			SnapshotId: aws.String("snap-test"),
+			FastSnapshotRestoreStateErrors: []types.EnableFastSnapshotRestoreStateErrorItem{{
+				AvailabilityZone: aws.String("us-east-1f"),
+				Error:            &types.EnableFastSnapshotRestoreStateError{Code: aws.String("ConcurrentSnapshotLimitExceeded")},
+			}},
+		}},
+	}
+
+	expectCreate := func(mockCloud *cloud.MockCloud) {
+		mockCloud.EXPECT().GetSnapshotByName(gomock.Any(), snapshotName).Return(nil, cloud.ErrNotFound)
+		mockCloud.EXPECT().AvailabilityZones(gomock.Any()).Return(map[string]struct{}{"us-east-1a": {}, "us-east-1f": {}}, nil)
+		mockCloud.EXPECT().CreateSnapshot(gomock.Any(), "vol-test", gomock.Any()).Return(snapshot, nil)
+	}
+
+	testCases := []struct {
+		name         string
+		zones        string
+		setup        func(mockCloud *cloud.MockCloud)
+		expectedCode codes.Code
+	}{
+		{
+			name:  "quota error deletes the snapshot",
+			zones: "us-east-1a, us-east-1f",
+			setup: func(mockCloud *cloud.MockCloud) {
+				expectCreate(mockCloud)
+				mockCloud.EXPECT().EnableFastSnapshotRestores(gomock.Any(), zones, "snap-test").Return(nil, quotaErr)
+				mockCloud.EXPECT().DeleteSnapshot(gomock.Any(), "snap-test").Return(true, nil)
+			},
+			expectedCode: codes.Internal,
+		},
+		{
+			name:  "partial success deletes the snapshot",
+			zones: "us-east-1a, us-east-1f",
+			setup: func(mockCloud *cloud.MockCloud) {
+				expectCreate(mockCloud)
+				mockCloud.EXPECT().EnableFastSnapshotRestores(gomock.Any(), zones, "snap-test").Return(partialOutput, errors.New("failed to create fast snapshot restores"))
+				mockCloud.EXPECT().DeleteSnapshot(gomock.Any(), "snap-test").Return(true, nil)
+			},
+			expectedCode: codes.Internal,
+		},
+		{
+			name:  "failure to delete the snapshot",
+			zones: "us-east-1a, us-east-1f",
+			setup: func(mockCloud *cloud.MockCloud) {
+				expectCreate(mockCloud)
+				mockCloud.EXPECT().EnableFastSnapshotRestores(gomock.Any(), zones, "snap-test").Return(nil, quotaErr)
+				mockCloud.EXPECT().DeleteSnapshot(gomock.Any(), "snap-test").Return(false, errors.New("RequestLimitExceeded"))
+			},
+			expectedCode: codes.Internal,
+		},
+		{
+			name:  "repeated zones are enabled once",
+			zones: "us-east-1a,us-east-1f,us-east-1a",
+			setup: func(mockCloud *cloud.MockCloud) {
+				expectCreate(mockCloud)
+				mockCloud.EXPECT().EnableFastSnapshotRestores(gomock.Any(), zones, "snap-test").Return(&ec2.EnableFastSnapshotRestoresOutput{}, nil)
+			},
+		},
+		{
+			name:         "empty zone",
+			zones:        "us-east-1a,,us-east-1f",
+			setup:        func(mockCloud *cloud.MockCloud) {},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:  "existing snapshot with fast snapshot restores enabled",
+			zones: "us-east-1a, us-east-1f",
+			setup: func(mockCloud *cloud.MockCloud) {
+				mockCloud.EXPECT().GetSnapshotByName(gomock.Any(), snapshotName).Return(snapshot, nil)
+				mockCloud.EXPECT().FastSnapshotRestoreZones(gomock.Any(), "snap-test").Return([]string{"us-east-1f", "us-east-1a"}, nil)
+			},
+		},
+		{
+			name:  "existing snapshot enables the missing zones",
+			zones: "us-east-1a, us-east-1f",
+			setup: func(mockCloud *cloud.MockCloud) {
+				mockCloud.EXPECT().GetSnapshotByName(gomock.Any(), snapshotName).Return(snapshot, nil)
+				mockCloud.EXPECT().FastSnapshotRestoreZones(gomock.Any(), "snap-test").Return([]string{"us-east-1a"}, nil)
+				mockCloud.EXPECT().EnableFastSnapshotRestores(gomock.Any(), []string{"us-east-1f"}, "snap-test").Return(&ec2.EnableFastSnapshotRestoresOutput{}, nil)
+			},
+		},
+		{
+			name:  "existing snapshot is kept when enabling fails",
+			zones: "us-east-1a, us-east-1f",
+			setup: func(mockCloud *cloud.MockCloud) {
+				mockCloud.EXPECT().GetSnapshotByName(gomock.Any(), snapshotName).Return(snapshot, nil)
+				mockCloud.EXPECT().FastSnapshotRestoreZones(gomock.Any(), "snap-test").Return(nil, nil)
+				mockCloud.EXPECT().EnableFastSnapshotRestores(gomock.Any(), zones, "snap-test").Return(nil, quotaErr)
+			},
+			expectedCode: codes.Internal,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			awsDriver, mockCtl, mockCloud := createControllerService(t)
+			defer mockCtl.Finish()
+			tc.setup(mockCloud)
+
+			resp, err := awsDriver.CreateSnapshot(context.Background(), &csi.CreateSnapshotRequest{
+				Name:           snapshotName,
+				SourceVolumeId: "vol-test",
+				Parameters:     map[string]string{"fastSnapshotRestoreAvailabilityZones": tc.zones},
+			})
+			if tc.expectedCode == codes.OK {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if resp.GetSnapshot().GetSnapshotId() != "snap-test" {
+					t.Fatalf("Expected snapshot snap-test, got %v", resp.GetSnapshot())
+				}
+				return
+			}
+			checkExpectedErrorCode(t, err, tc.expectedCode)
+		})
+	}
+
+	t.Run("delete while enabling", func(t *testing.T) {
+		awsDriver, mockCtl, mockCloud := createControllerService(t)
+		defer mockCtl.Finish()
+		// EC2 disables the fast snapshot restores of a deleted snapshot, whatever their state
+		mockCloud.EXPECT().GetSnapshotByID(gomock.Any(), "snap-test").Return(snapshot, nil)
+		mockCloud.EXPECT().DeleteSnapshot(gomock.Any(), "snap-test").Return(true, nil)
+
+		if _, err := awsDriver.DeleteSnapshot(context.Background(), &csi.DeleteSnapshotRequest{SnapshotId: "snap-test"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	})
+}
+
 func TestDeleteSnapshot(t *testing.T) {
 	testCases := []struct {
 		name     string
@@ -2980,6 +3904,7 @@ func TestDeleteSnapshot(t *testing.T) {
 					SnapshotId: "xxx",
 				}
 
+				mockCloud.EXPECT().GetSnapshotByID(gomock.Eq(ctx), gomock.Eq("xxx")).Return(&cloud.Snapshot{SnapshotID: "xxx"}, nil)
 				mockCloud.EXPECT().DeleteSnapshot(gomock.Eq(ctx), gomock.Eq("xxx")).Return(true, nil)
 				if _, err := awsDriver.DeleteSnapshot(ctx, req); err != nil {
 					t.Fatalf("Unexpected error: %v", err)
@@ -3005,6 +3930,7 @@ func TestDeleteSnapshot(t *testing.T) {
 					SnapshotId: "xxx",
 				}
 
+				mockCloud.EXPECT().GetSnapshotByID(gomock.Eq(ctx), gomock.Eq("xxx")).Return(nil, cloud.ErrNotFound)
 				mockCloud.EXPECT().DeleteSnapshot(gomock.Eq(ctx), gomock.Eq("xxx")).Return(false, cloud.ErrNotFound)
 				if _, err := awsDriver.DeleteSnapshot(ctx, req); err != nil {
 					t.Fatalf("Unexpected error: %v", err)
@@ -3046,6 +3972,132 @@ func TestDeleteSnapshot(t *testing.T) {
 	}
 }
 
+func TestControllerGetCapabilitiesListVolumes(t *testing.T) {
+	awsDriver := ControllerService{options: &Options{}}
+	resp, err := awsDriver.ControllerGetCapabilities(context.Background(), &csi.ControllerGetCapabilitiesRequest{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The csi-attacher reconciles VolumeAttachments against ListVolumes when LIST_VOLUMES_PUBLISHED_NODES is advertised
+	for _, c := range resp.GetCapabilities() {
+		if c.GetRpc().GetType() == csi.ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES {
+			t.Fatal("Expected LIST_VOLUMES_PUBLISHED_NODES not to be advertised")
+		}
+	}
+}
+
+func TestListVolumes(t *testing.T) {
+	firstPage := &cloud.ListDisksResponse{
+		Disks: []*cloud.Disk{
+			{VolumeID: "vol-1", CapacityGiB: 10, Attachments: []string{expInstanceID}},
+			{VolumeID: "vol-2", CapacityGiB: 20},
+		},
+		NextToken: "token-2",
+	}
+	lastPage := &cloud.ListDisksResponse{
+		Disks: []*cloud.Disk{{VolumeID: "vol-3", CapacityGiB: 30, Attachments: []string{"i-1", "i-2"}}},
+	}
+
+	testCases := []struct {
+		name          string
+		clusterID     string
+		req           *csi.ListVolumesRequest
+		expectedTag   string
+		cloudResponse *cloud.ListDisksResponse
+		cloudErr      error
+		expectedResp  *csi.ListVolumesResponse
+		expectedCode  codes.Code
+	}{
+		{
+			name:          "first page",
+			req:           &csi.ListVolumesRequest{MaxEntries: 2},
+			expectedTag:   cloud.AwsEbsDriverTagKey,
+			cloudResponse: firstPage,
+			expectedResp: &csi.ListVolumesResponse{
+				Entries: []*csi.ListVolumesResponse_Entry{
+					{
+						Volume: &csi.Volume{VolumeId: "vol-1", CapacityBytes: 10 * util.GiB},
+						Status: &csi.ListVolumesResponse_VolumeStatus{PublishedNodeIds: []string{expInstanceID}},
+					},
+					{
+						Volume: &csi.Volume{VolumeId: "vol-2", CapacityBytes: 20 * util.GiB},
+						Status: &csi.ListVolumesResponse_VolumeStatus{},
+					},
+				},
+				NextToken: "token-2",
+			},
+		},
+		{
+			name:          "last page of the cluster volumes",
+			clusterID:     "cluster-1",
+			req:           &csi.ListVolumesRequest{MaxEntries: 2, StartingToken: "token-2"},
+			expectedTag:   ResourceLifecycleTagPrefix + "cluster-1",
+			cloudResponse: lastPage,
+			expectedResp: &csi.ListVolumesResponse{
+				Entries: []*csi.ListVolumesResponse_Entry{
+					{
+						Volume: &csi.Volume{VolumeId: "vol-3", CapacityBytes: 30 * util.GiB},
+						Status: &csi.ListVolumesResponse_VolumeStatus{PublishedNodeIds: []string{"i-1", "i-2"}},
+					},
+				},
+			},
+		},
+		{
+			name:          "no volumes",
+			req:           &csi.ListVolumesRequest{},
+			expectedTag:   cloud.AwsEbsDriverTagKey,
+			cloudResponse: &cloud.ListDisksResponse{},
+			expectedResp:  &csi.ListVolumesResponse{Entries: []*csi.ListVolumesResponse_Entry{}},
+		},
+		{
+			name:         "invalid starting token",
+			req:          &csi.ListVolumesRequest{StartingToken: "bad"},
+			expectedTag:  cloud.AwsEbsDriverTagKey,
+			cloudErr:     fmt.Errorf("%w: InvalidParameterValue", cloud.ErrInvalidNextToken),
+			expectedCode: codes.Aborted,
+		},
+		{
+			name:         "invalid max entries",
+			req:          &csi.ListVolumesRequest{MaxEntries: 4},
+			expectedTag:  cloud.AwsEbsDriverTagKey,
+			cloudErr:     cloud.ErrInvalidMaxResults,
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "negative max entries",
+			req:          &csi.ListVolumesRequest{MaxEntries: -1},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "DescribeVolumes failure",
+			req:          &csi.ListVolumesRequest{},
+			expectedTag:  cloud.AwsEbsDriverTagKey,
+			cloudErr:     errors.New("UnauthorizedOperation"),
+			expectedCode: codes.Internal,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			awsDriver, mockCtl, mockCloud := createControllerService(t)
+			defer mockCtl.Finish()
+			awsDriver.options.KubernetesClusterID = tc.clusterID
+			if tc.expectedTag != "" {
+				mockCloud.EXPECT().ListDisks(gomock.Any(), tc.expectedTag, tc.req.GetMaxEntries(), tc.req.GetStartingToken()).Return(tc.cloudResponse, tc.cloudErr)
+			}
+
+			resp, err := awsDriver.ListVolumes(context.Background(), tc.req)
+			if tc.expectedCode != codes.OK {
+				checkExpectedErrorCode(t, err, tc.expectedCode)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedResp, resp)
+		})
+	}
+}
+
 func TestListSnapshots(t *testing.T) {
 	testCases := []struct {
 		name     string
@@ -3616,9 +4668,294 @@ func createControllerService(t *testing.T) (ControllerService, *gomock.Controlle
 	mockCtl := gomock.NewController(t)
 	mockCloud := cloud.NewMockCloud(mockCtl)
 	awsDriver := ControllerService{
-		cloud:    mockCloud,
-		inFlight: internal.NewInFlight(),
-		options:  &Options{},
+		cloud:          mockCloud,
+		inFlight:       internal.NewInFlight(),
+		options:        &Options{},
+		snapshotCopies: &sync.Map{},
+		pvAnnotations:  &sync.Map{},
 	}
 	return awsDriver, mockCtl, mockCloud
 }
+
+func TestControllerErrorDetails(t *testing.T) {
+	volCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+	}
+	attachLimitErr := &smithy.GenericAPIError{Code: "AttachmentLimitExceeded", Message: "attachment limit reached"}
+	kmsErr := fmt.Errorf("%w: %q is not a valid ARN", cloud.ErrInvalidKMSKeyID, "arn:bad")
+	ratioErr := fmt.Errorf("%w: %w: io1 volumes support at most 50 IOPS per GiB", cloud.ErrInvalidArgument, cloud.ErrInvalidPerformanceRatio)
+
+	testCases := []struct {
+		name              string
+		call              func(d *ControllerService, mockCloud *cloud.MockCloud) error
+		expectedErr       error
+		expectedReason    string
+		expectedOperation string
+		expectedVolumeID  string
+	}{
+		{
+			name: "zone excluded",
+			call: func(d *ControllerService, mockCloud *cloud.MockCloud) error {
+				d.options.ExcludedZones = []string{"us-east-1c"}
+				_, err := d.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+					Name:               "pvc-test",
+					VolumeCapabilities: []*csi.VolumeCapability{volCap},
+					AccessibilityRequirements: &csi.TopologyRequirement{
+						Requisite: []*csi.Topology{{Segments: map[string]string{WellKnownZoneTopologyKey: "us-east-1c"}}},
+					},
+				})
+				return err
+			},
+			expectedErr:       status.Error(codes.FailedPrecondition, "Availability Zone us-east-1c is excluded by --excluded-zones and the topology requirement allows no other zone"),
+			expectedReason:    ErrorReasonZoneExcluded,
+			expectedOperation: "CreateVolume",
+		},
+		{
+			name: "KMS key invalid",
+			call: func(d *ControllerService, mockCloud *cloud.MockCloud) error {
+				mockCloud.EXPECT().CreateDisk(gomock.Any(), gomock.Eq("pvc-test"), gomock.Any()).Return(nil, kmsErr)
+				_, err := d.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+					Name:               "pvc-test",
+					VolumeCapabilities: []*csi.VolumeCapability{volCap},
+				})
+				return err
+			},
+			expectedErr:       status.Errorf(codes.InvalidArgument, "Could not create volume %q: %v", "pvc-test", kmsErr),
+			expectedReason:    ErrorReasonKMSKeyInvalid,
+			expectedOperation: "CreateVolume",
+			expectedVolumeID:  "pvc-test",
+		},
+		{
+			name: "attach limit",
+			call: func(d *ControllerService, mockCloud *cloud.MockCloud) error {
+				mockCloud.EXPECT().AttachDisk(gomock.Any(), gomock.Eq("vol-test"), gomock.Eq(expInstanceID)).Return("", attachLimitErr)
+				_, err := d.ControllerPublishVolume(context.Background(), &csi.ControllerPublishVolumeRequest{
+					VolumeId:         "vol-test",
+					NodeId:           expInstanceID,
+					VolumeCapability: volCap,
+				})
+				return err
+			},
+			expectedErr:       status.Errorf(codes.Internal, "Could not attach volume %q to node %q: %v", "vol-test", expInstanceID, attachLimitErr),
+			expectedReason:    ErrorReasonAttachLimit,
+			expectedOperation: "ControllerPublishVolume",
+			expectedVolumeID:  "vol-test",
+		},
+		{
+			name: "IOPS ratio exceeded",
+			call: func(d *ControllerService, mockCloud *cloud.MockCloud) error {
+				mockCloud.EXPECT().ResizeOrModifyDisk(gomock.Any(), gomock.Eq("vol-test"), gomock.Any(), gomock.Any()).Return(int32(0), ratioErr)
+				_, err := executeModifyVolumeRequest(mockCloud, d.options)("vol-test", modifyVolumeRequest{
+					modifyDiskOptions: cloud.ModifyDiskOptions{VolumeType: "io1", IOPS: 10000},
+				})
+				return err
+			},
+			expectedErr:       status.Errorf(codes.InvalidArgument, "Could not modify volume (invalid argument) %q: %v", "vol-test", ratioErr),
+			expectedReason:    ErrorReasonIOPSRatioExceeded,
+			expectedOperation: "ModifyVolume",
+			expectedVolumeID:  "vol-test",
+		},
+		{
+			name: "no reason for other errors",
+			call: func(d *ControllerService, mockCloud *cloud.MockCloud) error {
+				mockCloud.EXPECT().AttachDisk(gomock.Any(), gomock.Eq("vol-test"), gomock.Eq(expInstanceID)).Return("", errors.New("internal error"))
+				_, err := d.ControllerPublishVolume(context.Background(), &csi.ControllerPublishVolumeRequest{
+					VolumeId:         "vol-test",
+					NodeId:           expInstanceID,
+					VolumeCapability: volCap,
+				})
+				return err
+			},
+			expectedErr: status.Errorf(codes.Internal, "Could not attach volume %q to node %q: %v", "vol-test", expInstanceID, errors.New("internal error")),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+
+			mockCloud := cloud.NewMockCloud(mockCtl)
+			d := &ControllerService{
+				cloud:    mockCloud,
+				inFlight: internal.NewInFlight(),
+				options:  &Options{},
+			}
+
+			err := tc.call(d, mockCloud)
+			// The message is the same as without details
+			expectStatusErr(t, tc.expectedErr, err)
+
+			details := status.Convert(err).Details()
+			if tc.expectedReason == "" {
+				if len(details) != 0 {
+					t.Fatalf("Expected no error details, got %v", details)
+				}
+				return
+			}
+			if len(details) != 1 {
+				t.Fatalf("Expected 1 error detail, got %d", len(details))
+			}
+			info, ok := details[0].(*errdetails.ErrorInfo)
+			if !ok {
+				t.Fatalf("Expected ErrorInfo detail, got %T", details[0])
+			}
+			if info.GetReason() != tc.expectedReason || info.GetDomain() != DriverName {
+				t.Fatalf("Unexpected reason/domain %q/%q", info.GetReason(), info.GetDomain())
+			}
+			if info.GetMetadata()[ErrorInfoOperationKey] != tc.expectedOperation || info.GetMetadata()[ErrorInfoVolumeIDKey] != tc.expectedVolumeID {
+				t.Fatalf("Unexpected metadata %v", info.GetMetadata())
+			}
+		})
+	}
+}
+
+func TestCreateVolumeClass(t *testing.T) {
+	params := map[string]string{VolumeTypeKey: "gp3", IopsKey: "4000"}
+	withMetadata := map[string]string{VolumeTypeKey: "gp3", IopsKey: "4000", PVCNameKey: "data-0", PVCNamespaceKey: "batch", PVNameKey: "pvc-1"}
+	otherClass := map[string]string{VolumeTypeKey: "gp3", IopsKey: "6000"}
+
+	if createVolumeClass(params) != createVolumeClass(withMetadata) {
+		t.Errorf("Expected the PVC and PV names not to change the class")
+	}
+	if createVolumeClass(params) == createVolumeClass(otherClass) {
+		t.Errorf("Expected different parameters to give different classes")
+	}
+}
+
+func TestCreateVolumeFairQueue(t *testing.T) {
+	awsDriver, mockCtl, _ := createControllerService(t)
+	defer mockCtl.Finish()
+	awsDriver.createVolumeQueue = internal.NewFairQueue(1, 0, nil)
+
+	// The only slot is taken, so the call waits in the queue until its context expires without reaching the cloud
+	release, err := awsDriver.createVolumeQueue.Acquire(context.Background(), "batch")
+	require.NoError(t, err)
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = awsDriver.CreateVolume(ctx, &csi.CreateVolumeRequest{
+		Name:               "random-vol-name",
+		CapacityRange:      &csi.CapacityRange{RequiredBytes: util.GiB},
+		VolumeCapabilities: []*csi.VolumeCapability{{AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}}, AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER}}},
+		Parameters:         map[string]string{VolumeTypeKey: "gp3"},
+	})
+	checkExpectedErrorCode(t, err, codes.Aborted)
+	if !awsDriver.inFlight.Insert("random-vol-name") {
+		t.Errorf("Expected the in-flight entry of the volume to be released")
+	}
+}
+
+func TestCreateVolumeExtraTagsTemplate(t *testing.T) {
+	pvcParameters := map[string]string{PVCNameKey: "data-0", PVCNamespaceKey: "team-a", PVNameKey: "pvc-1"}
+
+	testCases := []struct {
+		name         string
+		extraTags    map[string]string
+		warnOnly     bool
+		expectedTags map[string]string
+		// skippedTag is the tag expected not to be added
+		skippedTag   string
+		expectedCode codes.Code
+	}{
+		{
+			name:         "rendered",
+			extraTags:    map[string]string{"team": "{{ .PVCNamespace }}", "claim": "{{ .PVCNamespace }}/{{ .PVCName }}", "static": "value"},
+			expectedTags: map[string]string{"team": "team-a", "claim": "team-a/data-0", "static": "value"},
+		},
+		{
+			name:         "unknown variable",
+			extraTags:    map[string]string{"team": "{{ .Namespace }}"},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "unknown variable warn only",
+			extraTags:    map[string]string{"team": "{{ .Namespace }}", "static": "value"},
+			warnOnly:     true,
+			expectedTags: map[string]string{"static": "value"},
+			skippedTag:   "team",
+		},
+		{
+			name:         "rendered value too long",
+			extraTags:    map[string]string{"claim": strings.Repeat("{{ .PVCName }}", 64)},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "rendered value too long warn only",
+			extraTags:    map[string]string{"claim": strings.Repeat("{{ .PVCName }}", 64), "static": "value"},
+			warnOnly:     true,
+			expectedTags: map[string]string{"static": "value"},
+			skippedTag:   "claim",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			awsDriver, mockCtl, mockCloud := createControllerService(t)
+			defer mockCtl.Finish()
+			awsDriver.options.ExtraTags = tc.extraTags
+			awsDriver.options.WarnOnInvalidTag = tc.warnOnly
+
+			if tc.expectedCode == codes.OK {
+				mockCloud.EXPECT().CreateDisk(gomock.Any(), "vol-name", gomock.Any()).DoAndReturn(
+					func(_ context.Context, _ string, opts *cloud.DiskOptions) (*cloud.Disk, error) {
+						for k, v := range tc.expectedTags {
+							if opts.Tags[k] != v {
+								t.Errorf("Expected tag %s=%q, got %q", k, v, opts.Tags[k])
+							}
+						}
+						if _, ok := opts.Tags[tc.skippedTag]; ok {
+							t.Errorf("Expected tag %s to be skipped, got %v", tc.skippedTag, opts.Tags)
+						}
+						return &cloud.Disk{VolumeID: "vol-test", CapacityGiB: 1, AvailabilityZone: expZone}, nil
+					})
+			}
+
+			_, err := awsDriver.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+				Name:          "vol-name",
+				CapacityRange: &csi.CapacityRange{RequiredBytes: 1 << 30},
+				VolumeCapabilities: []*csi.VolumeCapability{{
+					AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+					AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+				}},
+				Parameters: pvcParameters,
+			})
+			if tc.expectedCode == codes.OK {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+			checkExpectedErrorCode(t, err, tc.expectedCode)
+		})
+	}
+}
+
+func TestCreateSnapshotExtraTagsTemplate(t *testing.T) {
+	awsDriver, mockCtl, mockCloud := createControllerService(t)
+	defer mockCtl.Finish()
+	awsDriver.options.ExtraTags = map[string]string{"team": "{{ .VolumeSnapshotNamespace }}", "snapshot": "{{ .VolumeSnapshotName }}", "claim": "{{ .PVCName }}"}
+
+	mockCloud.EXPECT().GetSnapshotByName(gomock.Any(), "snap-name").Return(nil, cloud.ErrNotFound)
+	mockCloud.EXPECT().CreateSnapshot(gomock.Any(), "vol-test", gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ string, opts *cloud.SnapshotOptions) (*cloud.Snapshot, error) {
+			// The variables of volumes are empty for snapshots
+			for k, v := range map[string]string{"team": "team-a", "snapshot": "backup-0", "claim": ""} {
+				if tag, ok := opts.Tags[k]; !ok || tag != v {
+					t.Errorf("Expected tag %s=%q, got %v", k, v, opts.Tags)
+				}
+			}
+			return &cloud.Snapshot{SnapshotID: "snap-test", SourceVolumeID: "vol-test", CreationTime: time.Now()}, nil
+		})
+
+	_, err := awsDriver.CreateSnapshot(context.Background(), &csi.CreateSnapshotRequest{
+		Name:           "snap-name",
+		SourceVolumeId: "vol-test",
+		Parameters:     map[string]string{VolumeSnapshotNameKey: "backup-0", VolumeSnapshotNamespaceKey: "team-a"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
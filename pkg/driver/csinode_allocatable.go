@@ -0,0 +1,107 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// reconcileCSINodeAllocatable patches the allocatable count of the driver in the CSINode of the local node when it
+// differs from limit. Kubelet only updates the CSINode when the driver registers, so after the limit changes, for
+// example with --volume-attach-limit, the CSINode can report a stale limit until the node object churns.
+// A missing CSINode or driver is not an error, kubelet reports the current limit when the driver registers.
+// The API server only accepts the patch with the MutableCSINodeAllocatableCount feature gate, the allocatable count of
+// a registered driver is immutable otherwise.
+func (d *NodeService) reconcileCSINodeAllocatable(k kubernetes.Interface, limit int64) error {
+	nodeName := os.Getenv("CSI_NODE_NAME")
+	if nodeName == "" {
+		klog.V(4).InfoS("CSI_NODE_NAME missing, skipping CSINode allocatable reconciliation")
+		return nil
+	}
+
+	d.allocatableMux.Lock()
+	defer d.allocatableMux.Unlock()
+	if d.reconciledAllocatable != nil && *d.reconciledAllocatable == limit {
+		return nil
+	}
+
+	csiNode, err := k.StorageV1().CSINodes().Get(context.Background(), nodeName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		klog.V(4).InfoS("CSINode not found, skipping allocatable reconciliation", "nodeName", nodeName)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get CSINode for %s: %w", nodeName, err)
+	}
+
+	for i, driver := range csiNode.Spec.Drivers {
+		if driver.Name != DriverName {
+			continue
+		}
+
+		oldCount := "unset"
+		if driver.Allocatable != nil && driver.Allocatable.Count != nil {
+			if int64(*driver.Allocatable.Count) == limit {
+				d.reconciledAllocatable = &limit
+				return nil
+			}
+			oldCount = strconv.Itoa(int(*driver.Allocatable.Count))
+		}
+
+		count := int32(limit)
+		patch, err := json.Marshal([]JSONPatch{
+			{
+				OP:    "test",
+				Path:  fmt.Sprintf("/spec/drivers/%d/name", i),
+				Value: DriverName,
+			},
+			{
+				OP:    "add",
+				Path:  fmt.Sprintf("/spec/drivers/%d/allocatable", i),
+				Value: storagev1.VolumeNodeResources{Count: &count},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := k.StorageV1().CSINodes().Patch(context.Background(), nodeName, k8stypes.JSONPatchType, patch, metav1.PatchOptions{}); err != nil {
+			if apierrors.IsInvalid(err) {
+				// Retrying cannot succeed until the feature gate is enabled, the limit is only retried once it changes
+				d.reconciledAllocatable = &limit
+				return fmt.Errorf("failed to patch CSINode allocatable for %s, the API server must enable the MutableCSINodeAllocatableCount feature gate: %w", nodeName, err)
+			}
+			return fmt.Errorf("failed to patch CSINode allocatable for %s: %w", nodeName, err)
+		}
+		klog.InfoS("Updated stale CSINode allocatable count", "nodeName", nodeName, "old", oldCount, "new", limit)
+		d.reconciledAllocatable = &limit
+		return nil
+	}
+
+	klog.V(4).InfoS("Driver not registered in CSINode, skipping allocatable reconciliation", "nodeName", nodeName)
+	return nil
+}
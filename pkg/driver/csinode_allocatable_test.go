@@ -0,0 +1,198 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newAllocatableCSINode(nodeName string, count *int32) *storagev1.CSINode {
+	var allocatable *storagev1.VolumeNodeResources
+	if count != nil {
+		allocatable = &storagev1.VolumeNodeResources{Count: count}
+	}
+	return &storagev1.CSINode{
+		ObjectMeta: metav1.ObjectMeta{Name: nodeName},
+		Spec: storagev1.CSINodeSpec{
+			Drivers: []storagev1.CSINodeDriver{
+				{Name: "other.csi.k8s.io", NodeID: nodeName},
+				{Name: DriverName, NodeID: "i-1234567890abcdef0", Allocatable: allocatable},
+			},
+		},
+	}
+}
+
+func countPatches(clientset *fake.Clientset) int {
+	patches := 0
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "patch" {
+			patches++
+		}
+	}
+	return patches
+}
+
+func TestReconcileCSINodeAllocatable(t *testing.T) {
+	const nodeName = "test-node"
+	count := func(c int32) *int32 { return &c }
+
+	testCases := []struct {
+		name            string
+		objects         []runtime.Object
+		expectedPatches int
+		// expectedCount is the allocatable count of the driver after reconciliation, nil when not set
+		expectedCount *int32
+		// expectedReconciled is whether the limit is recorded, so that it is not reconciled again
+		expectedReconciled bool
+	}{
+		{
+			name:               "stale",
+			objects:            []runtime.Object{newAllocatableCSINode(nodeName, count(25))},
+			expectedPatches:    1,
+			expectedCount:      count(39),
+			expectedReconciled: true,
+		},
+		{
+			name:               "unset",
+			objects:            []runtime.Object{newAllocatableCSINode(nodeName, nil)},
+			expectedPatches:    1,
+			expectedCount:      count(39),
+			expectedReconciled: true,
+		},
+		{
+			name:               "current",
+			objects:            []runtime.Object{newAllocatableCSINode(nodeName, count(39))},
+			expectedPatches:    0,
+			expectedCount:      count(39),
+			expectedReconciled: true,
+		},
+		{
+			name:               "missing CSINode",
+			expectedPatches:    0,
+			expectedReconciled: false,
+		},
+		{
+			name: "driver not registered",
+			objects: []runtime.Object{&storagev1.CSINode{
+				ObjectMeta: metav1.ObjectMeta{Name: nodeName},
+			}},
+			expectedPatches:    0,
+			expectedReconciled: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("CSI_NODE_NAME", nodeName)
+			clientset := fake.NewSimpleClientset(tc.objects...)
+			d := &NodeService{}
+
+			if err := d.reconcileCSINodeAllocatable(clientset, 39); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if patches := countPatches(clientset); patches != tc.expectedPatches {
+				t.Fatalf("Expected %d patches, got %d", tc.expectedPatches, patches)
+			}
+			if reconciled := d.reconciledAllocatable != nil; reconciled != tc.expectedReconciled {
+				t.Fatalf("Expected reconciled to be %v, got %v", tc.expectedReconciled, reconciled)
+			}
+
+			if tc.expectedCount != nil {
+				csiNode, err := clientset.StorageV1().CSINodes().Get(context.Background(), nodeName, metav1.GetOptions{})
+				if err != nil {
+					t.Fatalf("Failed to get CSINode: %v", err)
+				}
+				driver := csiNode.Spec.Drivers[1]
+				if driver.Allocatable == nil || driver.Allocatable.Count == nil || *driver.Allocatable.Count != *tc.expectedCount {
+					t.Fatalf("Expected allocatable count %d, got %+v", *tc.expectedCount, driver.Allocatable)
+				}
+				if csiNode.Spec.Drivers[0].Allocatable != nil {
+					t.Fatalf("Expected the allocatable count of other drivers to be untouched, got %+v", csiNode.Spec.Drivers[0].Allocatable)
+				}
+			}
+
+			// The CSINode is not looked up again until the limit changes
+			actions := len(clientset.Actions())
+			if err := d.reconcileCSINodeAllocatable(clientset, 39); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tc.expectedReconciled && len(clientset.Actions()) != actions {
+				t.Fatalf("Expected no API call once reconciled, got %v", clientset.Actions()[actions:])
+			}
+		})
+	}
+}
+
+func TestReconcileCSINodeAllocatableLimitChange(t *testing.T) {
+	const nodeName = "test-node"
+	t.Setenv("CSI_NODE_NAME", nodeName)
+	initial := int32(39)
+	clientset := fake.NewSimpleClientset(newAllocatableCSINode(nodeName, &initial))
+	d := &NodeService{}
+
+	for _, limit := range []int64{39, 25} {
+		if err := d.reconcileCSINodeAllocatable(clientset, limit); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if patches := countPatches(clientset); patches != 1 {
+		t.Fatalf("Expected 1 patch, got %d", patches)
+	}
+	csiNode, err := clientset.StorageV1().CSINodes().Get(context.Background(), nodeName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get CSINode: %v", err)
+	}
+	if count := *csiNode.Spec.Drivers[1].Allocatable.Count; count != 25 {
+		t.Fatalf("Expected allocatable count 25, got %d", count)
+	}
+}
+
+func TestReconcileCSINodeAllocatableImmutable(t *testing.T) {
+	const nodeName = "test-node"
+	t.Setenv("CSI_NODE_NAME", nodeName)
+	initial := int32(39)
+	clientset := fake.NewSimpleClientset(newAllocatableCSINode(nodeName, &initial))
+	// Without the MutableCSINodeAllocatableCount feature gate the API server rejects updates of registered drivers
+	clientset.PrependReactor("patch", "csinodes", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewInvalid(schema.GroupKind{Group: "storage.k8s.io", Kind: "CSINode"}, nodeName,
+			field.ErrorList{field.Invalid(field.NewPath("spec", "drivers"), nil, "field is immutable")})
+	})
+	d := &NodeService{}
+
+	err := d.reconcileCSINodeAllocatable(clientset, 25)
+	if err == nil || !strings.Contains(err.Error(), "MutableCSINodeAllocatableCount") {
+		t.Fatalf("Expected an error naming the feature gate, got %v", err)
+	}
+	// The patch is not retried until the limit changes
+	if err = d.reconcileCSINodeAllocatable(clientset, 25); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if patches := countPatches(clientset); patches != 1 {
+		t.Fatalf("Expected 1 patch, got %d", patches)
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/mounter"
+	"k8s.io/klog/v2"
+)
+
+// deviceMatchesVolume checks if a device reports the serial of the volume, overridden in tests
+var deviceMatchesVolume = mounter.DeviceSerialMatches
+
+// devicePathHintFile returns the path of the hint file of the volume under dir
+// Volume IDs that cannot be used as a file name have no hint file
+func devicePathHintFile(dir, volumeID string) (string, bool) {
+	if dir == "" || volumeID == "" || volumeID != filepath.Base(volumeID) {
+		return "", false
+	}
+	return filepath.Join(dir, volumeID), true
+}
+
+// readDevicePathHint returns the device path recorded for the volume by an earlier stage
+// An empty path is returned if there is no hint or the hinted device no longer reports the volume's serial,
+// in which case the stale hint is removed
+func readDevicePathHint(dir, volumeID string) string {
+	hintFile, ok := devicePathHintFile(dir, volumeID)
+	if !ok {
+		return ""
+	}
+	content, err := os.ReadFile(hintFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			klog.V(4).InfoS("Failed to read device path hint", "volumeID", volumeID, "hintFile", hintFile, "err", err)
+		}
+		return ""
+	}
+
+	devicePath := strings.TrimSpace(string(content))
+	matches, err := deviceMatchesVolume(devicePath, volumeID)
+	if err != nil || !matches {
+		klog.V(4).InfoS("Ignoring stale device path hint", "volumeID", volumeID, "devicePath", devicePath, "err", err)
+		removeDevicePathHint(dir, volumeID)
+		return ""
+	}
+	return devicePath
+}
+
+// writeDevicePathHint records the device path the volume resolved to
+// The hint is written to a temporary file first so that readers never see a partial hint
+func writeDevicePathHint(dir, volumeID, devicePath string) error {
+	hintFile, ok := devicePathHintFile(dir, volumeID)
+	if !ok {
+		return fmt.Errorf("volume ID %q cannot be used as a device path hint file name", volumeID)
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return fmt.Errorf("failed to create device path hint directory %q: %w", dir, err)
+	}
+	tmp := hintFile + ".tmp"
+	if err := os.WriteFile(tmp, []byte(devicePath+"\n"), 0640); err != nil {
+		return fmt.Errorf("failed to write device path hint %q: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, hintFile); err != nil {
+		return fmt.Errorf("failed to rename device path hint %q: %w", tmp, err)
+	}
+	return nil
+}
+
+// removeDevicePathHint removes the hint of the volume, if any
+func removeDevicePathHint(dir, volumeID string) {
+	hintFile, ok := devicePathHintFile(dir, volumeID)
+	if !ok {
+		return
+	}
+	if err := os.Remove(hintFile); err != nil && !os.IsNotExist(err) {
+		klog.V(4).InfoS("Failed to remove device path hint", "volumeID", volumeID, "hintFile", hintFile, "err", err)
+	}
+}
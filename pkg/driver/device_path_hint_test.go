@@ -0,0 +1,113 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindDevicePathHint(t *testing.T) {
+	testCases := []struct {
+		name             string
+		hint             string
+		partition        string
+		matches          bool
+		expectedSource   string
+		expectedResolver int
+		expectHintFile   bool
+	}{
+		{
+			name:             "valid hint hit",
+			hint:             "/dev/nvme3n1",
+			matches:          true,
+			expectedSource:   "/dev/nvme3n1",
+			expectedResolver: 0,
+			expectHintFile:   true,
+		},
+		{
+			name:             "stale hint miss",
+			hint:             "/dev/nvme3n1",
+			matches:          false,
+			expectedSource:   "/dev/nvme1n1",
+			expectedResolver: 1,
+			expectHintFile:   false,
+		},
+		{
+			name:             "no hint",
+			expectedSource:   "/dev/nvme1n1",
+			expectedResolver: 1,
+		},
+		{
+			name:             "partition ignores hint",
+			hint:             "/dev/nvme3n1",
+			partition:        "1",
+			matches:          true,
+			expectedSource:   "/dev/nvme1n1",
+			expectedResolver: 1,
+			expectHintFile:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tc.hint != "" {
+				if err := writeDevicePathHint(dir, "vol-test", tc.hint); err != nil {
+					t.Fatalf("Failed to write hint: %v", err)
+				}
+			}
+
+			oldDeviceMatchesVolume := deviceMatchesVolume
+			deviceMatchesVolume = func(devicePath, volumeID string) (bool, error) {
+				return tc.matches && devicePath == tc.hint && volumeID == "vol-test", nil
+			}
+			defer func() { deviceMatchesVolume = oldDeviceMatchesVolume }()
+
+			resolver := &fakeDeviceResolver{source: "/dev/nvme1n1"}
+			driver := &NodeService{
+				deviceResolver: resolver,
+				options:        &Options{DevicePathHintDir: dir},
+			}
+
+			source, err := driver.findDevicePath("/dev/xvdba", "vol-test", tc.partition, "us-west-2")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if source != tc.expectedSource {
+				t.Errorf("Expected source %q, got %q", tc.expectedSource, source)
+			}
+			if len(resolver.calls) != tc.expectedResolver {
+				t.Errorf("Expected %d resolver calls, got %d", tc.expectedResolver, len(resolver.calls))
+			}
+			_, statErr := os.Stat(filepath.Join(dir, "vol-test"))
+			if hintExists := statErr == nil; hintExists != tc.expectHintFile {
+				t.Errorf("Expected hint file to exist: %v, got %v", tc.expectHintFile, hintExists)
+			}
+		})
+	}
+}
+
+func TestDevicePathHintDisabled(t *testing.T) {
+	if hint := readDevicePathHint("", "vol-test"); hint != "" {
+		t.Errorf("Expected no hint when disabled, got %q", hint)
+	}
+	if err := writeDevicePathHint(t.TempDir(), "../vol-test", "/dev/nvme1n1"); err == nil {
+		t.Error("Expected error writing a hint for a volume ID that is not a file name")
+	}
+}
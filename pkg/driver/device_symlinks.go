@@ -0,0 +1,101 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"os"
+	"path/filepath"
+
+	"k8s.io/klog/v2"
+)
+
+// deviceSymlinkDir is the directory of the symlinks created by --create-device-symlinks, overridden in tests
+var deviceSymlinkDir = "/dev/disk/by-id"
+
+// deviceSymlinkPath returns the path of the symlink to the device of the volume
+// Volume IDs that cannot be used as a file name have no symlink
+func deviceSymlinkPath(volumeID string) (string, bool) {
+	if volumeID == "" || volumeID != filepath.Base(volumeID) {
+		return "", false
+	}
+	return filepath.Join(deviceSymlinkDir, "ebs-"+volumeID), true
+}
+
+// createDeviceSymlink points the symlink of the volume at device when --create-device-symlinks is set
+// A symlink already pointing at device is left alone and one pointing elsewhere is replaced. Failures are logged and
+// do not fail NodeStageVolume
+func (d *NodeService) createDeviceSymlink(volumeID, device string) {
+	if !d.options.CreateDeviceSymlinks {
+		return
+	}
+	path, ok := deviceSymlinkPath(volumeID)
+	if !ok {
+		return
+	}
+	if current, err := os.Readlink(path); err == nil && current == device {
+		return
+	}
+
+	if err := os.MkdirAll(deviceSymlinkDir, 0755); err != nil {
+		klog.InfoS("Failed to create device symlink dir", "volumeID", volumeID, "dir", deviceSymlinkDir, "err", err)
+		return
+	}
+	// The symlink is created aside and renamed over the old one so that it never points at a missing device
+	tmp := path + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		klog.InfoS("Failed to remove leftover device symlink", "volumeID", volumeID, "path", tmp, "err", err)
+		return
+	}
+	if err := os.Symlink(device, tmp); err != nil {
+		klog.InfoS("Failed to create device symlink", "volumeID", volumeID, "device", device, "path", path, "err", err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		klog.InfoS("Failed to create device symlink", "volumeID", volumeID, "device", device, "path", path, "err", err)
+		_ = os.Remove(tmp)
+		return
+	}
+	klog.V(4).InfoS("Created device symlink", "volumeID", volumeID, "device", device, "path", path)
+}
+
+// removeDeviceSymlink removes the symlink of the volume when --create-device-symlinks is set
+// Files that are not symlinks are left alone. Failures are logged and do not fail NodeUnstageVolume
+func (d *NodeService) removeDeviceSymlink(volumeID string) {
+	if !d.options.CreateDeviceSymlinks {
+		return
+	}
+	path, ok := deviceSymlinkPath(volumeID)
+	if !ok {
+		return
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			klog.InfoS("Failed to check device symlink", "volumeID", volumeID, "path", path, "err", err)
+		}
+		return
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		klog.InfoS("Not removing device symlink path that is not a symlink", "volumeID", volumeID, "path", path)
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		klog.InfoS("Failed to remove device symlink", "volumeID", volumeID, "path", path, "err", err)
+		return
+	}
+	klog.V(4).InfoS("Removed device symlink", "volumeID", volumeID, "path", path)
+}
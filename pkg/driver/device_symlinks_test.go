@@ -0,0 +1,128 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func setDeviceSymlinkDir(t *testing.T, dir string) {
+	t.Helper()
+	orig := deviceSymlinkDir
+	deviceSymlinkDir = dir
+	t.Cleanup(func() { deviceSymlinkDir = orig })
+}
+
+func TestCreateDeviceSymlink(t *testing.T) {
+	testCases := []struct {
+		name     string
+		existing string
+		disabled bool
+		expected string
+	}{
+		{
+			name:     "symlink created",
+			expected: "/dev/nvme1n1",
+		},
+		{
+			name:     "symlink already exists",
+			existing: "/dev/nvme1n1",
+			expected: "/dev/nvme1n1",
+		},
+		{
+			name:     "stale symlink replaced",
+			existing: "/dev/nvme2n1",
+			expected: "/dev/nvme1n1",
+		},
+		{
+			name:     "disabled",
+			disabled: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "by-id")
+			setDeviceSymlinkDir(t, dir)
+			path := filepath.Join(dir, "ebs-vol-test")
+			if tc.existing != "" {
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					t.Fatalf("failed to create symlink dir: %v", err)
+				}
+				if err := os.Symlink(tc.existing, path); err != nil {
+					t.Fatalf("failed to create existing symlink: %v", err)
+				}
+			}
+
+			driver := &NodeService{options: &Options{CreateDeviceSymlinks: !tc.disabled}}
+			driver.createDeviceSymlink("vol-test", "/dev/nvme1n1")
+
+			target, err := os.Readlink(path)
+			if tc.expected == "" {
+				if !os.IsNotExist(err) {
+					t.Fatalf("expected no symlink, got %q (%v)", target, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to read symlink: %v", err)
+			}
+			if target != tc.expected {
+				t.Errorf("unexpected symlink target: got %q, want %q", target, tc.expected)
+			}
+		})
+	}
+}
+
+func TestCreateDeviceSymlinkFailure(t *testing.T) {
+	// The symlink dir cannot be created under a regular file, which is only logged
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	setDeviceSymlinkDir(t, filepath.Join(file, "by-id"))
+
+	driver := &NodeService{options: &Options{CreateDeviceSymlinks: true}}
+	driver.createDeviceSymlink("vol-test", "/dev/nvme1n1")
+}
+
+func TestRemoveDeviceSymlink(t *testing.T) {
+	dir := t.TempDir()
+	setDeviceSymlinkDir(t, dir)
+	symlink := filepath.Join(dir, "ebs-vol-symlink")
+	if err := os.Symlink("/dev/nvme1n1", symlink); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	file := filepath.Join(dir, "ebs-vol-file")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+
+	driver := &NodeService{options: &Options{CreateDeviceSymlinks: true}}
+	driver.removeDeviceSymlink("vol-symlink")
+	driver.removeDeviceSymlink("vol-file")
+	driver.removeDeviceSymlink("vol-missing")
+
+	if _, err := os.Lstat(symlink); !os.IsNotExist(err) {
+		t.Errorf("expected symlink to be removed, got %v", err)
+	}
+	if _, err := os.Lstat(file); err != nil {
+		t.Errorf("expected file that is not a symlink to be left, got %v", err)
+	}
+}
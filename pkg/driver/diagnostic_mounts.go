@@ -0,0 +1,116 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"os"
+	"path/filepath"
+
+	"k8s.io/klog/v2"
+)
+
+// diagnosticMountPath returns the path under dir at which the staging path of the volume is bind mounted
+// Volume IDs that cannot be used as a directory name have no diagnostic mount
+func diagnosticMountPath(dir, volumeID string) (string, bool) {
+	if dir == "" || volumeID == "" || volumeID != filepath.Base(volumeID) {
+		return "", false
+	}
+	return filepath.Join(dir, volumeID), true
+}
+
+// mountDiagnostic bind mounts the staging path of the volume read-only under --diagnostic-mounts-dir
+// Failures are logged and do not fail NodeStageVolume
+func (d *NodeService) mountDiagnostic(volumeID, stagingPath string) {
+	path, ok := diagnosticMountPath(d.options.DiagnosticMountsDir, volumeID)
+	if !ok {
+		return
+	}
+	if err := d.mounter.MakeDir(path); err != nil {
+		klog.InfoS("Failed to create diagnostic mount dir", "volumeID", volumeID, "path", path, "err", err)
+		return
+	}
+	notMnt, err := d.mounter.IsLikelyNotMountPoint(path)
+	if err != nil {
+		klog.InfoS("Failed to check if diagnostic mount exists", "volumeID", volumeID, "path", path, "err", err)
+		return
+	}
+	if !notMnt {
+		return
+	}
+	if err := d.mounter.Mount(stagingPath, path, "", []string{"bind", "ro"}); err != nil {
+		klog.InfoS("Failed to create diagnostic mount", "volumeID", volumeID, "stagingPath", stagingPath, "path", path, "err", err)
+		return
+	}
+	klog.V(4).InfoS("Created diagnostic mount", "volumeID", volumeID, "stagingPath", stagingPath, "path", path)
+}
+
+// unmountDiagnostic removes the diagnostic mount of the volume
+// It falls back to a forced unmount so that the diagnostic mount never keeps the volume's filesystem mounted after
+// NodeUnstageVolume, and failures are logged without failing NodeUnstageVolume
+func (d *NodeService) unmountDiagnostic(volumeID string) {
+	path, ok := diagnosticMountPath(d.options.DiagnosticMountsDir, volumeID)
+	if !ok {
+		return
+	}
+	d.removeDiagnosticMount(path)
+}
+
+func (d *NodeService) removeDiagnosticMount(path string) {
+	err := d.mounter.Unstage(path)
+	if err == nil {
+		return
+	}
+	klog.InfoS("Failed to unmount diagnostic mount, forcing it", "path", path, "err", err)
+	if err = d.mounter.ForceUnmount(path); err != nil {
+		klog.ErrorS(err, "Failed to force diagnostic mount removal", "path", path)
+	}
+}
+
+// cleanupDiagnosticMounts removes the leftovers in --diagnostic-mounts-dir, such as those of volumes unstaged while
+// the driver was not running: directories that are not mount points and mounts whose filesystem is not mounted
+// anywhere else, meaning the staging path they were bound from is gone
+func (d *NodeService) cleanupDiagnosticMounts() {
+	dir := d.options.DiagnosticMountsDir
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			klog.InfoS("Failed to list diagnostic mounts", "dir", dir, "err", err)
+		}
+		return
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		notMnt, err := d.mounter.IsLikelyNotMountPoint(path)
+		if err != nil {
+			klog.InfoS("Failed to check diagnostic mount, leaving it", "path", path, "err", err)
+			continue
+		}
+		if !notMnt {
+			refs, err := d.mounter.GetMountRefs(path)
+			if err != nil {
+				klog.InfoS("Failed to look up the mounts of diagnostic mount, leaving it", "path", path, "err", err)
+				continue
+			}
+			if len(refs) > 0 {
+				continue
+			}
+		}
+		klog.InfoS("Removing leftover diagnostic mount", "path", path)
+		d.removeDiagnosticMount(path)
+	}
+}
@@ -0,0 +1,232 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud/metadata"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/driver/internal"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/mounter"
+	"k8s.io/utils/clock"
+)
+
+func TestNodeStageVolumeDiagnosticMount(t *testing.T) {
+	testCases := []struct {
+		name        string
+		block       bool
+		notMnt      bool
+		mountErr    error
+		expectMount bool
+	}{
+		{
+			name:        "diagnostic mount created",
+			notMnt:      true,
+			expectMount: true,
+		},
+		{
+			name: "diagnostic mount already exists",
+		},
+		{
+			name:        "diagnostic mount failure does not fail stage",
+			notMnt:      true,
+			mountErr:    errors.New("permission denied"),
+			expectMount: true,
+		},
+		{
+			name:  "block volume skipped",
+			block: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockMounter := mounter.NewMockMounter(ctrl)
+			mockMetadata := metadata.NewMockMetadataService(ctrl)
+			volCap := &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Block{
+					Block: &csi.VolumeCapability_BlockVolume{},
+				},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			}
+			if !tc.block {
+				volCap.AccessType = &csi.VolumeCapability_Mount{
+					Mount: &csi.VolumeCapability_MountVolume{
+						FsType: FSTypeExt4,
+					},
+				}
+				mockMetadata.EXPECT().GetRegion().Return("us-west-2")
+				mockMounter.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
+				mockMounter.EXPECT().PathExists(gomock.Eq("/staging/path")).Return(true, nil)
+				mockMounter.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("", 0, nil)
+				mockMounter.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				mockMounter.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path"), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				mockMounter.EXPECT().NeedResize(gomock.Any(), gomock.Any()).Return(false, nil)
+				mockMounter.EXPECT().MakeDir(gomock.Eq("/diag/vol-test")).Return(nil)
+				mockMounter.EXPECT().IsLikelyNotMountPoint(gomock.Eq("/diag/vol-test")).Return(tc.notMnt, nil)
+			}
+			if tc.expectMount {
+				mockMounter.EXPECT().Mount(gomock.Eq("/staging/path"), gomock.Eq("/diag/vol-test"), gomock.Eq(""), gomock.Eq([]string{"bind", "ro"})).Return(tc.mountErr)
+			}
+
+			driver := &NodeService{
+				metadata:       mockMetadata,
+				mounter:        mockMounter,
+				deviceResolver: mockMounter,
+				inFlight:       internal.NewInFlight(),
+				staged:         internal.NewStagingRegistry(),
+				options:        &Options{DiagnosticMountsDir: "/diag"},
+				clock:          clock.RealClock{},
+			}
+
+			_, err := driver.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				VolumeCapability:  volCap,
+				PublishContext:    map[string]string{DevicePathKey: "/dev/xvdba"},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestNodeUnstageVolumeDiagnosticMount(t *testing.T) {
+	testCases := []struct {
+		name           string
+		unmountErr     error
+		forceErr       error
+		expectForce    bool
+		stagingRefs    int
+		expectUnstaged bool
+	}{
+		{
+			name:           "diagnostic mount removed before unstaging",
+			stagingRefs:    1,
+			expectUnstaged: true,
+		},
+		{
+			name:           "diagnostic mount forced when unmount fails",
+			unmountErr:     errors.New("target is busy"),
+			expectForce:    true,
+			stagingRefs:    1,
+			expectUnstaged: true,
+		},
+		{
+			name:           "forced removal failure does not fail unstage",
+			unmountErr:     errors.New("target is busy"),
+			forceErr:       errors.New("permission denied"),
+			expectForce:    true,
+			stagingRefs:    1,
+			expectUnstaged: true,
+		},
+		{
+			name: "diagnostic mount removed when volume is not staged",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockMounter := mounter.NewMockMounter(ctrl)
+			calls := []*gomock.Call{
+				mockMounter.EXPECT().Unstage(gomock.Eq("/diag/vol-test")).Return(tc.unmountErr),
+			}
+			if tc.expectForce {
+				calls = append(calls, mockMounter.EXPECT().ForceUnmount(gomock.Eq("/diag/vol-test")).Return(tc.forceErr))
+			}
+			calls = append(calls, mockMounter.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("/dev/xvdba", tc.stagingRefs, nil))
+			if tc.expectUnstaged {
+				calls = append(calls, mockMounter.EXPECT().Unstage(gomock.Eq("/staging/path")).Return(nil))
+			}
+			calls = append(calls, mockMounter.EXPECT().LuksClose(gomock.Eq("ebs-luks-vol-test")).Return(nil))
+			gomock.InOrder(calls...)
+
+			driver := &NodeService{
+				mounter:        mockMounter,
+				deviceResolver: mockMounter,
+				inFlight:       internal.NewInFlight(),
+				staged:         internal.NewStagingRegistry(),
+				options:        &Options{DiagnosticMountsDir: "/diag"},
+			}
+
+			_, err := driver.NodeUnstageVolume(context.Background(), &csi.NodeUnstageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestCleanupDiagnosticMounts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir := t.TempDir()
+	for _, volumeID := range []string{"vol-not-mounted", "vol-leftover", "vol-staged", "vol-unknown"} {
+		if err := os.Mkdir(filepath.Join(dir, volumeID), 0750); err != nil {
+			t.Fatalf("failed to create diagnostic mount dir: %v", err)
+		}
+	}
+
+	mockMounter := mounter.NewMockMounter(ctrl)
+	// vol-not-mounted is an empty directory, vol-leftover is bound from a staging path that is gone, vol-staged is
+	// still staged and vol-unknown cannot be checked
+	mockMounter.EXPECT().IsLikelyNotMountPoint(gomock.Eq(filepath.Join(dir, "vol-not-mounted"))).Return(true, nil)
+	mockMounter.EXPECT().IsLikelyNotMountPoint(gomock.Eq(filepath.Join(dir, "vol-leftover"))).Return(false, nil)
+	mockMounter.EXPECT().IsLikelyNotMountPoint(gomock.Eq(filepath.Join(dir, "vol-staged"))).Return(false, nil)
+	mockMounter.EXPECT().IsLikelyNotMountPoint(gomock.Eq(filepath.Join(dir, "vol-unknown"))).Return(false, errors.New("stale file handle"))
+	mockMounter.EXPECT().GetMountRefs(gomock.Eq(filepath.Join(dir, "vol-leftover"))).Return(nil, nil)
+	mockMounter.EXPECT().GetMountRefs(gomock.Eq(filepath.Join(dir, "vol-staged"))).Return([]string{"/staging/vol-staged"}, nil)
+	mockMounter.EXPECT().Unstage(gomock.Eq(filepath.Join(dir, "vol-not-mounted"))).Return(nil)
+	mockMounter.EXPECT().Unstage(gomock.Eq(filepath.Join(dir, "vol-leftover"))).Return(errors.New("target is busy"))
+	mockMounter.EXPECT().ForceUnmount(gomock.Eq(filepath.Join(dir, "vol-leftover"))).Return(nil)
+
+	driver := &NodeService{
+		mounter: mockMounter,
+		options: &Options{DiagnosticMountsDir: dir},
+	}
+	driver.cleanupDiagnosticMounts()
+}
+
+func TestCleanupDiagnosticMountsMissingDir(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	driver := &NodeService{
+		mounter: mounter.NewMockMounter(ctrl),
+		options: &Options{DiagnosticMountsDir: filepath.Join(t.TempDir(), "missing")},
+	}
+	driver.cleanupDiagnosticMounts()
+}
@@ -18,17 +18,28 @@ package driver
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"path"
+	"reflect"
+	"sync"
+	"time"
 
 	"github.com/awslabs/volume-modifier-for-k8s/pkg/rpc"
 	csi "github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud"
 	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud/metadata"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/driver/internal"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/metrics"
 	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/mounter"
 	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/util"
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
 )
@@ -51,17 +62,24 @@ const (
 	AwsAccountIDKey          = "topology." + DriverName + "/account-id"
 	AwsRegionKey             = "topology." + DriverName + "/region"
 	AwsOutpostIDKey          = "topology." + DriverName + "/outpost-id"
+	InstanceTypeTopologyKey  = "topology." + DriverName + "/instance-type"
 	WellKnownZoneTopologyKey = "topology.kubernetes.io/zone"
 	// DEPRECATED Use the WellKnownZoneTopologyKey instead
 	ZoneTopologyKey = "topology." + DriverName + "/zone"
 	OSTopologyKey   = "kubernetes.io/os"
+	// InstanceTagTopologyKeyPrefix is followed by the EC2 tag key for tags listed in --topology-label-tags
+	InstanceTagTopologyKeyPrefix = "topology." + DriverName + "/tag-"
 )
 
 type Driver struct {
 	controller *ControllerService
 	node       *NodeService
-	srv        *grpc.Server
 	options    *Options
+
+	// mu guards srv and stopped, as Stop may be called while Run is starting the server
+	mu      sync.Mutex
+	srv     *grpc.Server
+	stopped bool
 }
 
 func NewDriver(c cloud.Cloud, o *Options, m mounter.Mounter, md metadata.MetadataService, k kubernetes.Interface) (*Driver, error) {
@@ -77,16 +95,37 @@ func NewDriver(c cloud.Cloud, o *Options, m mounter.Mounter, md metadata.Metadat
 
 	switch o.Mode {
 	case ControllerMode:
-		driver.controller = NewControllerService(c, o)
+		driver.controller = NewControllerService(c, o, k)
 	case NodeMode:
-		driver.node = NewNodeService(o, md, m, k)
+		driver.node = NewNodeService(c, o, md, m, k)
 	case AllMode:
-		driver.controller = NewControllerService(c, o)
-		driver.node = NewNodeService(o, md, m, k)
+		driver.controller = NewControllerService(c, o, k)
+		driver.node = NewNodeService(c, o, md, m, k)
 	default:
 		return nil, fmt.Errorf("unknown mode: %s", o.Mode)
 	}
 
+	if driver.node != nil && o.AuditLogFile != "" {
+		auditLogger, err := NewFileAuditLogger(o.AuditLogFile)
+		if err != nil {
+			return nil, err
+		}
+		driver.node.auditLogger = auditLogger
+	}
+
+	if driver.node != nil && o.FormatDefaultsFile != "" {
+		formatDefaults, err := LoadFormatDefaults(o.FormatDefaultsFile)
+		if err != nil {
+			return nil, err
+		}
+		driver.node.formatDefaults = formatDefaults
+	}
+
+	if driver.node != nil {
+		metrics.Recorder().RegisterHistogram(NodeRPCDurationMetric, "Duration of node RPCs in seconds", []string{"method", "result"}, nodeRPCDurationBuckets)
+	}
+	metrics.Recorder().SetInFlightKeys(internal.InFlightKeys)
+
 	return driver, nil
 }
 
@@ -109,35 +148,141 @@ func (d *Driver) Run() error {
 		return resp, err
 	}
 
+	interceptors := []grpc.UnaryServerInterceptor{logErr, nodeRPCMetricsInterceptor, rpcTimeoutInterceptor(d.options.RpcTimeouts)}
+	if d.node != nil {
+		interceptors = append(interceptors, d.node.auditInterceptor)
+	}
 	opts := []grpc.ServerOption{
-		grpc.UnaryInterceptor(logErr),
+		grpc.ChainUnaryInterceptor(interceptors...),
 	}
 
 	if d.options.EnableOtelTracing {
 		opts = append(opts, grpc.StatsHandler(otelgrpc.NewServerHandler()))
 	}
 
-	d.srv = grpc.NewServer(opts...)
-	csi.RegisterIdentityServer(d.srv, d)
+	srv := grpc.NewServer(opts...)
+	csi.RegisterIdentityServer(srv, d)
 
 	switch d.options.Mode {
 	case ControllerMode:
-		csi.RegisterControllerServer(d.srv, d.controller)
-		rpc.RegisterModifyServer(d.srv, d.controller)
+		csi.RegisterControllerServer(srv, d.controller)
+		rpc.RegisterModifyServer(srv, d.controller)
 	case NodeMode:
-		csi.RegisterNodeServer(d.srv, d.node)
+		csi.RegisterNodeServer(srv, d.node)
 	case AllMode:
-		csi.RegisterControllerServer(d.srv, d.controller)
-		csi.RegisterNodeServer(d.srv, d.node)
-		rpc.RegisterModifyServer(d.srv, d.controller)
+		csi.RegisterControllerServer(srv, d.controller)
+		csi.RegisterNodeServer(srv, d.node)
+		rpc.RegisterModifyServer(srv, d.controller)
 	default:
 		return fmt.Errorf("unknown mode: %s", d.options.Mode)
 	}
 
+	d.mu.Lock()
+	if d.stopped {
+		d.mu.Unlock()
+		listener.Close()
+		return nil
+	}
+	d.srv = srv
+	d.mu.Unlock()
+
 	klog.V(4).InfoS("Listening for connections", "address", listener.Addr())
-	return d.srv.Serve(listener)
+	if err := srv.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		return err
+	}
+	return nil
 }
 
+// Stop stops the gRPC server. When Run has not started serving yet, it returns without serving.
+// The node service is drained first, waiting up to --drain-timeout for the volume operations in flight to finish.
 func (d *Driver) Stop() {
-	d.srv.Stop()
+	if d.node != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), d.options.DrainTimeout)
+		defer cancel()
+		if err := d.node.Drain(ctx); err != nil {
+			klog.ErrorS(err, "Failed to drain node service before stopping")
+		}
+		if closer, ok := d.node.auditLogger.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				klog.ErrorS(err, "Failed to close audit log")
+			}
+		}
+	}
+
+	if d.controller != nil {
+		d.controller.background.stop()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stopped = true
+	if d.srv != nil {
+		d.srv.Stop()
+	}
+}
+
+// controllerMethods is the set of CSI controller RPC method names, which can be used as keys of --rpc-timeouts
+var controllerMethods = func() sets.Set[string] {
+	methods := sets.New[string]()
+	t := reflect.TypeOf((*csi.ControllerServer)(nil)).Elem()
+	for i := 0; i < t.NumMethod(); i++ {
+		methods.Insert(t.Method(i).Name)
+	}
+	return methods
+}()
+
+// nodeMethods is the set of CSI node RPC method names
+var nodeMethods = func() sets.Set[string] {
+	methods := sets.New[string]()
+	t := reflect.TypeOf((*csi.NodeServer)(nil)).Elem()
+	for i := 0; i < t.NumMethod(); i++ {
+		methods.Insert(t.Method(i).Name)
+	}
+	return methods
+}()
+
+// nodeRPCDurationBuckets are the buckets of NodeRPCDurationMetric, which reach minutes to cover formatting large volumes
+var nodeRPCDurationBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// nodeRPCMetricsInterceptor records the duration of node RPCs in NodeRPCDurationMetric, labeled with the method and
+// whether the call succeeded
+func nodeRPCMetricsInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	method := path.Base(info.FullMethod)
+	if !nodeMethods.Has(method) {
+		return handler(ctx, req)
+	}
+
+	start := time.Now()
+	defer func() {
+		result := NodeRPCResultSuccess
+		if err != nil {
+			result = NodeRPCResultError
+		}
+		metrics.Recorder().ObserveHistogram(NodeRPCDurationMetric, time.Since(start).Seconds(), map[string]string{"method": method, "result": result}, nodeRPCDurationBuckets)
+	}()
+	return handler(ctx, req)
+}
+
+// rpcTimeoutInterceptor caps the deadline of the RPCs listed in timeouts, keeping the caller's deadline if it is sooner
+// Calls that fail after the cap has been reached are reported as DeadlineExceeded
+func rpcTimeoutInterceptor(timeouts map[string]time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		method := path.Base(info.FullMethod)
+		timeout, ok := timeouts[method]
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		start := time.Now()
+		callerDeadline, hasCallerDeadline := ctx.Deadline()
+		capped := !hasCallerDeadline || callerDeadline.After(start.Add(timeout))
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		resp, err := handler(ctx, req)
+		if err != nil && capped && errors.Is(ctx.Err(), context.DeadlineExceeded) && status.Code(err) != codes.DeadlineExceeded {
+			return resp, status.Errorf(codes.DeadlineExceeded, "%s did not complete within its timeout of %v (ran for %v): %v", method, timeout, time.Since(start).Round(time.Millisecond), err)
+		}
+		return resp, err
+	}
 }
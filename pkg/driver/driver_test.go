@@ -0,0 +1,313 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud/metadata"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/metrics"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/mounter"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRpcTimeoutInterceptor(t *testing.T) {
+	// slowHandler waits for the request context to be done, or gives up after a long time
+	slowHandler := func(ctx context.Context, _ interface{}) (interface{}, error) {
+		select {
+		case <-ctx.Done():
+			return nil, status.Error(codes.Internal, ctx.Err().Error())
+		case <-time.After(10 * time.Second):
+			return "done", nil
+		}
+	}
+
+	testCases := []struct {
+		name           string
+		method         string
+		timeouts       map[string]time.Duration
+		callerTimeout  time.Duration
+		expectedCode   codes.Code
+		expectedMaxRun time.Duration
+	}{
+		{
+			name:           "cap applies",
+			method:         "/csi.v1.Controller/CreateVolume",
+			timeouts:       map[string]time.Duration{"CreateVolume": 50 * time.Millisecond},
+			callerTimeout:  10 * time.Second,
+			expectedCode:   codes.DeadlineExceeded,
+			expectedMaxRun: 5 * time.Second,
+		},
+		{
+			name:           "cap applies without caller deadline",
+			method:         "/csi.v1.Controller/CreateVolume",
+			timeouts:       map[string]time.Duration{"CreateVolume": 50 * time.Millisecond},
+			expectedCode:   codes.DeadlineExceeded,
+			expectedMaxRun: 5 * time.Second,
+		},
+		{
+			name:           "caller deadline sooner than cap",
+			method:         "/csi.v1.Controller/CreateVolume",
+			timeouts:       map[string]time.Duration{"CreateVolume": 10 * time.Second},
+			callerTimeout:  50 * time.Millisecond,
+			expectedCode:   codes.Internal,
+			expectedMaxRun: 5 * time.Second,
+		},
+		{
+			name:           "method without cap",
+			method:         "/csi.v1.Controller/DeleteVolume",
+			timeouts:       map[string]time.Duration{"CreateVolume": 50 * time.Millisecond},
+			callerTimeout:  100 * time.Millisecond,
+			expectedCode:   codes.Internal,
+			expectedMaxRun: 5 * time.Second,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.callerTimeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.callerTimeout)
+				defer cancel()
+			}
+
+			interceptor := rpcTimeoutInterceptor(tc.timeouts)
+			start := time.Now()
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tc.method}, slowHandler)
+			if elapsed := time.Since(start); elapsed > tc.expectedMaxRun {
+				t.Errorf("handler ran for %v, expected at most %v", elapsed, tc.expectedMaxRun)
+			}
+			if code := status.Code(err); code != tc.expectedCode {
+				t.Errorf("expected code %v, got %v (%v)", tc.expectedCode, code, err)
+			}
+		})
+	}
+}
+
+func TestNodeRPCMetricsInterceptor(t *testing.T) {
+	recorder := metrics.InitializeRecorder()
+	// sampleCounts returns the number of observations of NodeRPCDurationMetric by method and result
+	sampleCounts := func() map[string]map[string]uint64 {
+		families, err := recorder.Gatherer().Gather()
+		if err != nil {
+			t.Fatalf("failed to gather metrics: %v", err)
+		}
+		counts := map[string]map[string]uint64{}
+		for _, family := range families {
+			if family.GetName() != NodeRPCDurationMetric {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				labels := map[string]string{}
+				for _, label := range metric.GetLabel() {
+					labels[label.GetName()] = label.GetValue()
+				}
+				if counts[labels["method"]] == nil {
+					counts[labels["method"]] = map[string]uint64{}
+				}
+				counts[labels["method"]][labels["result"]] += metric.GetHistogram().GetSampleCount()
+			}
+		}
+		return counts
+	}
+
+	successHandler := func(context.Context, interface{}) (interface{}, error) {
+		return "done", nil
+	}
+	errorHandler := func(context.Context, interface{}) (interface{}, error) {
+		return nil, status.Error(codes.Internal, "failed")
+	}
+
+	before := sampleCounts()
+	info := &grpc.UnaryServerInfo{FullMethod: "/csi.v1.Node/NodeStageVolume"}
+	if _, err := nodeRPCMetricsInterceptor(context.Background(), nil, info, successHandler); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := nodeRPCMetricsInterceptor(context.Background(), nil, info, errorHandler); status.Code(err) != codes.Internal {
+		t.Fatalf("expected the handler error to be returned, got %v", err)
+	}
+	if _, err := nodeRPCMetricsInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/csi.v1.Controller/CreateVolume"}, successHandler); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	after := sampleCounts()
+
+	for _, result := range []string{NodeRPCResultSuccess, NodeRPCResultError} {
+		if got := after["NodeStageVolume"][result] - before["NodeStageVolume"][result]; got != 1 {
+			t.Errorf("expected 1 NodeStageVolume observation with result %q, got %d", result, got)
+		}
+	}
+	if _, ok := after["CreateVolume"]; ok {
+		t.Errorf("expected controller RPCs not to be recorded, got %v", after["CreateVolume"])
+	}
+}
+
+func TestDriverStop(t *testing.T) {
+	newDriver := func() *Driver {
+		return &Driver{options: &Options{Mode: NodeMode, Endpoint: "unix://" + filepath.Join(t.TempDir(), "csi.sock")}}
+	}
+
+	t.Run("stop while serving", func(t *testing.T) {
+		d := newDriver()
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- d.Run()
+		}()
+		// Stop until Run has started the server, a Stop before that is covered below
+		for {
+			d.mu.Lock()
+			started := d.srv != nil
+			d.mu.Unlock()
+			if started {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		d.Stop()
+		select {
+		case err := <-errCh:
+			if err != nil {
+				t.Fatalf("unexpected error from Run: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Run did not return after Stop")
+		}
+	})
+
+	t.Run("stop before run", func(t *testing.T) {
+		d := newDriver()
+		d.Stop()
+		if err := d.Run(); err != nil {
+			t.Fatalf("unexpected error from Run: %v", err)
+		}
+		if d.srv != nil {
+			t.Error("expected Run not to start the server after Stop")
+		}
+	})
+}
+
+func TestProbe(t *testing.T) {
+	testCases := []struct {
+		name         string
+		node         bool
+		instanceID   string
+		region       string
+		pathExists   bool
+		pathErr      error
+		pathBlocks   bool
+		expected     bool
+		expectedCode codes.Code
+	}{
+		{
+			name:     "controller only",
+			expected: true,
+		},
+		{
+			name:   "node not ready",
+			node:   true,
+			region: "us-west-2",
+		},
+		{
+			name:       "node healthy",
+			node:       true,
+			instanceID: "i-1234567890abcdef0",
+			region:     "us-west-2",
+			pathExists: true,
+			expected:   true,
+		},
+		{
+			name:         "metadata without region",
+			node:         true,
+			instanceID:   "i-1234567890abcdef0",
+			expectedCode: codes.FailedPrecondition,
+		},
+		{
+			name:         "mounter fails",
+			node:         true,
+			instanceID:   "i-1234567890abcdef0",
+			region:       "us-west-2",
+			pathErr:      errors.New("permission denied"),
+			expectedCode: codes.FailedPrecondition,
+		},
+		{
+			name:         "mounter does not find /proc/mounts",
+			node:         true,
+			instanceID:   "i-1234567890abcdef0",
+			region:       "us-west-2",
+			expectedCode: codes.FailedPrecondition,
+		},
+		{
+			name:         "mounter times out",
+			node:         true,
+			instanceID:   "i-1234567890abcdef0",
+			region:       "us-west-2",
+			pathBlocks:   true,
+			expectedCode: codes.FailedPrecondition,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			d := &Driver{options: &Options{Mode: ControllerMode}}
+			if tc.node {
+				mockMetadata := metadata.NewMockMetadataService(ctrl)
+				mockMetadata.EXPECT().GetInstanceID().Return(tc.instanceID).AnyTimes()
+				mockMetadata.EXPECT().GetRegion().Return(tc.region).AnyTimes()
+				mockMounter := mounter.NewMockMounter(ctrl)
+				unblock := make(chan struct{})
+				defer close(unblock)
+				mockMounter.EXPECT().PathExists(gomock.Any()).DoAndReturn(func(path string) (bool, error) {
+					if tc.pathBlocks {
+						<-unblock
+					}
+					if path == readinessCheckPath {
+						return true, nil
+					}
+					return tc.pathExists, tc.pathErr
+				}).AnyTimes()
+				d.node = &NodeService{metadata: mockMetadata, mounter: mockMounter, options: &Options{ProbeTimeout: 100 * time.Millisecond}}
+				// The node service is ready before its health degrades
+				d.node.ready.Store(tc.instanceID != "")
+			}
+
+			resp, err := d.Probe(context.Background(), &csi.ProbeRequest{})
+			if tc.expectedCode != codes.OK {
+				if status.Code(err) != tc.expectedCode {
+					t.Fatalf("expected error code %v, got %v", tc.expectedCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ready := resp.GetReady().GetValue(); ready != tc.expected {
+				t.Errorf("unexpected Ready: got %t, want %t", ready, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"runtime"
+	"strconv"
+
+	csi "github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/klog/v2"
+)
+
+// parseEphemeral returns whether the volume is a CSI ephemeral inline volume, which kubelet reports with EphemeralKey,
+// along with the size limit in bytes of its tmpfs from EphemeralSizeKey
+func parseEphemeral(volumeContext map[string]string) (bool, int64, error) {
+	value, ok := volumeContext[EphemeralKey]
+	if !ok {
+		return false, 0, nil
+	}
+	ephemeral, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, 0, status.Errorf(codes.InvalidArgument, "Invalid %s (%s): must be true or false", EphemeralKey, value)
+	}
+	if !ephemeral {
+		return false, 0, nil
+	}
+
+	size, ok := volumeContext[EphemeralSizeKey]
+	if !ok {
+		return false, 0, status.Errorf(codes.InvalidArgument, "Ephemeral volumes require the %s volume attribute", EphemeralSizeKey)
+	}
+	quantity, err := resource.ParseQuantity(size)
+	if err != nil || quantity.Value() <= 0 {
+		return false, 0, status.Errorf(codes.InvalidArgument, "Invalid %s (%s): must be a positive quantity such as 64Mi", EphemeralSizeKey, size)
+	}
+	return true, quantity.Value(), nil
+}
+
+// nodePublishEphemeralVolume mounts a tmpfs limited to sizeBytes at the target of a CSI ephemeral inline volume, which
+// has no device nor staging path. NodeUnpublishVolume unmounts it like any other target.
+func (d *NodeService) nodePublishEphemeralVolume(req *csi.NodePublishVolumeRequest, sizeBytes int64) error {
+	if runtime.GOOS == "windows" {
+		return status.Error(codes.InvalidArgument, "Ephemeral volumes are not supported on Windows")
+	}
+	if req.GetVolumeCapability().GetMount() == nil {
+		return status.Error(codes.InvalidArgument, "Ephemeral volumes only support the mount access type")
+	}
+
+	target := req.GetTargetPath()
+	if err := d.mounter.PreparePublishTarget(target); err != nil {
+		return status.Errorf(codes.Internal, err.Error())
+	}
+	mounted, err := d.isMounted("", target)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Could not check if %q is mounted: %v", target, err)
+	}
+	if mounted {
+		return nil
+	}
+
+	mountOptions := []string{"size=" + strconv.FormatInt(sizeBytes, 10)}
+	if req.GetReadonly() {
+		mountOptions = append(mountOptions, "ro")
+	}
+	klog.V(4).InfoS("NodePublishVolume: mounting ephemeral volume", "volumeID", req.GetVolumeId(), "target", target, "mountOptions", mountOptions)
+	if err := d.mounter.Mount("tmpfs", target, "tmpfs", mountOptions); err != nil {
+		return status.Errorf(codes.Internal, "Could not mount tmpfs at %q: %v", target, err)
+	}
+	return nil
+}
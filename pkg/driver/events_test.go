@@ -0,0 +1,69 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+// drainEvents returns the events recorded by the fake recorder so far
+func drainEvents(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestNewEventRecorder(t *testing.T) {
+	if recorder := newEventRecorder(nil, ""); recorder != nil {
+		t.Fatalf("Expected no recorder without a Kubernetes client, got %v", recorder)
+	}
+
+	clientset := fake.NewSimpleClientset()
+	recorder := newEventRecorder(clientset, "test-node")
+	node := &corev1.ObjectReference{Kind: "Node", Name: "test-node"}
+	recorder.Event(node, corev1.EventTypeNormal, DriverReadyEventReason, "test message")
+
+	var event corev1.Event
+	err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 10*time.Second, true, func(ctx context.Context) (bool, error) {
+		events, err := clientset.CoreV1().Events(metav1.NamespaceDefault).List(ctx, metav1.ListOptions{})
+		if err != nil || len(events.Items) == 0 {
+			return false, err
+		}
+		event = events.Items[0]
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("Event was not recorded: %v", err)
+	}
+	if event.Reason != DriverReadyEventReason || event.InvolvedObject.Name != "test-node" || event.Source.Component != DriverName || event.Source.Host != "test-node" {
+		t.Errorf("Unexpected event %+v", event)
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+// parseExternalFsManagement returns whether the volume context hands the filesystem over to an operator running in
+// the pod with ExternalFsManagementKey, in which case the driver never resizes it
+func parseExternalFsManagement(volumeContext map[string]string) (bool, error) {
+	value, ok := volumeContext[ExternalFsManagementKey]
+	if !ok {
+		return false, nil
+	}
+	external, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, status.Errorf(codes.InvalidArgument, "Invalid %s (%s): must be true or false", ExternalFsManagementKey, value)
+	}
+	return external, nil
+}
+
+// externalFsMarkerFile is created next to the staging path of a volume whose filesystem is managed externally, in the
+// directory kubelet creates for the staging path
+const externalFsMarkerFile = "ebs-external-fs-management"
+
+// externalFsMarkerPath returns the path of the marker file of the volume staged at target
+func externalFsMarkerPath(target string) string {
+	return filepath.Join(filepath.Dir(filepath.Clean(target)), externalFsMarkerFile)
+}
+
+// setExternalFsManagement records whether the filesystem of a volume staged at target is managed externally, because
+// NodeExpandVolume is not given the volume context
+// The record is a marker file so that it survives restarts of the node plugin.
+func setExternalFsManagement(target string, external bool) error {
+	marker := externalFsMarkerPath(target)
+	if !external {
+		if err := os.Remove(marker); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove external filesystem management marker %q: %w", marker, err)
+		}
+		return nil
+	}
+	if err := os.WriteFile(marker, nil, 0640); err != nil {
+		return fmt.Errorf("failed to write external filesystem management marker %q: %w", marker, err)
+	}
+	return nil
+}
+
+// isExternalFsManaged reports whether the volume staged at target was staged with ExternalFsManagementKey
+func isExternalFsManaged(target string) bool {
+	if target == "" {
+		return false
+	}
+	_, err := os.Stat(externalFsMarkerPath(target))
+	if err != nil && !os.IsNotExist(err) {
+		klog.V(4).InfoS("Failed to check external filesystem management marker", "target", target, "err", err)
+	}
+	return err == nil
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FormatOptions are the default formatting options of a filesystem type in the --format-defaults-file
+type FormatOptions struct {
+	BlockSize     string `yaml:"blockSize"`
+	InodeSize     string `yaml:"inodeSize"`
+	BytesPerInode string `yaml:"bytesPerInode"`
+}
+
+// FormatDefaults maps a filesystem type to the formatting options of the volumes whose volume context does not set them
+type FormatDefaults map[string]FormatOptions
+
+// LoadFormatDefaults reads and validates the YAML file of default formatting options at path, such as
+// 'ext4: {blockSize: "4096", bytesPerInode: "16384"}'. Unknown keys, filesystem types and options that the
+// filesystem type does not support are rejected.
+func LoadFormatDefaults(path string) (FormatDefaults, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read format defaults file: %w", err)
+	}
+
+	var defaults FormatDefaults
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&defaults); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse format defaults file %q: %w", path, err)
+	}
+
+	normalized := make(FormatDefaults, len(defaults))
+	for fsType, options := range defaults {
+		fsConfig, ok := FileSystemConfigs[strings.ToLower(fsType)]
+		if !ok {
+			return nil, fmt.Errorf("invalid format defaults file %q: unknown fstype %s", path, fsType)
+		}
+		for key, value := range options.byKey() {
+			if value == "" {
+				continue
+			}
+			if !fsConfig.isParameterSupported(key) {
+				return nil, fmt.Errorf("invalid format defaults file %q: %s is not supported with fstype %s", path, key, fsType)
+			}
+			if n, err := strconv.ParseUint(value, 10, 32); err != nil || n == 0 {
+				return nil, fmt.Errorf("invalid format defaults file %q: %s of fstype %s must be a positive number, got %q", path, key, fsType, value)
+			}
+		}
+		normalized[strings.ToLower(fsType)] = options
+	}
+	return normalized, nil
+}
+
+func (o FormatOptions) byKey() map[string]string {
+	return map[string]string{
+		BlockSizeKey:     o.BlockSize,
+		InodeSizeKey:     o.InodeSize,
+		BytesPerInodeKey: o.BytesPerInode,
+	}
+}
+
+// apply returns the volume context with the default formatting options of fsType it does not set. The volume context
+// is returned as is when there are no defaults for fsType.
+func (f FormatDefaults) apply(fsType string, volumeContext map[string]string) map[string]string {
+	options, ok := f[strings.ToLower(fsType)]
+	if !ok {
+		return volumeContext
+	}
+
+	merged := make(map[string]string, len(volumeContext)+3)
+	for key, value := range options.byKey() {
+		if value != "" {
+			merged[key] = value
+		}
+	}
+	for key, value := range volumeContext {
+		merged[key] = value
+	}
+	return merged
+}
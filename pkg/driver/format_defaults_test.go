@@ -0,0 +1,136 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadFormatDefaults(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		expected FormatDefaults
+		expErr   bool
+	}{
+		{
+			name: "valid",
+			content: `
+ext4:
+  blockSize: "4096"
+  bytesPerInode: "16384"
+XFS:
+  inodeSize: "512"
+`,
+			expected: FormatDefaults{
+				FSTypeExt4: {BlockSize: "4096", BytesPerInode: "16384"},
+				FSTypeXfs:  {InodeSize: "512"},
+			},
+		},
+		{
+			name:     "empty",
+			content:  "",
+			expected: FormatDefaults{},
+		},
+		{
+			name:    "malformed",
+			content: "ext4: [blockSize",
+			expErr:  true,
+		},
+		{
+			name:    "unknown option",
+			content: "ext4: {blocksize: \"4096\"}",
+			expErr:  true,
+		},
+		{
+			name:    "unknown fstype",
+			content: "zfs: {blockSize: \"4096\"}",
+			expErr:  true,
+		},
+		{
+			name:    "option not supported by fstype",
+			content: "xfs: {bytesPerInode: \"16384\"}",
+			expErr:  true,
+		},
+		{
+			name:    "invalid value",
+			content: "ext4: {inodeSize: \"256k\"}",
+			expErr:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "format-defaults.yaml")
+			if err := os.WriteFile(path, []byte(tc.content), 0o600); err != nil {
+				t.Fatalf("failed to write format defaults file: %v", err)
+			}
+
+			defaults, err := LoadFormatDefaults(path)
+			if (err != nil) != tc.expErr {
+				t.Fatalf("expected error %v, got %v", tc.expErr, err)
+			}
+			if !tc.expErr && !reflect.DeepEqual(defaults, tc.expected) {
+				t.Fatalf("expected %+v, got %+v", tc.expected, defaults)
+			}
+		})
+	}
+
+	if _, err := LoadFormatDefaults(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Fatalf("expected an error for a missing file")
+	}
+}
+
+func TestFormatDefaultsApply(t *testing.T) {
+	defaults := FormatDefaults{FSTypeExt4: {BlockSize: "4096", BytesPerInode: "16384"}}
+
+	testCases := []struct {
+		name          string
+		fsType        string
+		volumeContext map[string]string
+		expected      map[string]string
+	}{
+		{
+			name:     "defaults apply",
+			fsType:   "EXT4",
+			expected: map[string]string{BlockSizeKey: "4096", BytesPerInodeKey: "16384"},
+		},
+		{
+			name:          "volume context wins",
+			fsType:        FSTypeExt4,
+			volumeContext: map[string]string{BlockSizeKey: "1024", Ext4BigAllocKey: "true"},
+			expected:      map[string]string{BlockSizeKey: "1024", BytesPerInodeKey: "16384", Ext4BigAllocKey: "true"},
+		},
+		{
+			name:          "no defaults for fstype",
+			fsType:        FSTypeXfs,
+			volumeContext: map[string]string{InodeSizeKey: "512"},
+			expected:      map[string]string{InodeSizeKey: "512"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if merged := defaults.apply(tc.fsType, tc.volumeContext); !reflect.DeepEqual(merged, tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, merged)
+			}
+		})
+	}
+}
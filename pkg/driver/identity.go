@@ -20,6 +20,9 @@ import (
 	"context"
 
 	csi "github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 	"k8s.io/klog/v2"
 )
 
@@ -57,7 +60,18 @@ func (d *Driver) GetPluginCapabilities(ctx context.Context, req *csi.GetPluginCa
 	return resp, nil
 }
 
+// Probe reports the node service as not ready until IsReady succeeds. Once ready, the health of the node service is
+// checked at every call, and Probe fails with FailedPrecondition when it is unhealthy.
 func (d *Driver) Probe(ctx context.Context, req *csi.ProbeRequest) (*csi.ProbeResponse, error) {
 	klog.V(6).InfoS("Probe: called", "args", *req)
-	return &csi.ProbeResponse{}, nil
+	if d.node != nil {
+		if !d.node.IsReady() {
+			return &csi.ProbeResponse{Ready: wrapperspb.Bool(false)}, nil
+		}
+		if err := d.node.checkHealth(ctx); err != nil {
+			klog.ErrorS(err, "Probe: node service is unhealthy")
+			return nil, status.Errorf(codes.FailedPrecondition, "Node service is unhealthy: %v", err)
+		}
+	}
+	return &csi.ProbeResponse{Ready: wrapperspb.Bool(true)}, nil
 }
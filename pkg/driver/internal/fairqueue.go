@@ -0,0 +1,191 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// FairQueue admits operations of several classes, such as the volume creations of each StorageClass.
+// Operations are admitted at once until threshold of them are in flight. Past the threshold, they wait and are
+// admitted round-robin across classes as operations finish, so that a class with many waiting operations cannot
+// starve the others. While operations wait, a class with classCap operations in flight is skipped.
+type FairQueue struct {
+	mux           sync.Mutex
+	threshold     int
+	classCap      int
+	inFlight      int
+	classInFlight map[string]int
+	waiting       map[string][]chan struct{}
+	// classes are the classes with waiting operations in round-robin order, next is the index of the one served next
+	classes []string
+	next    int
+	// onDepth is called with the number of waiting operations of a class whenever it changes
+	onDepth func(class string, depth int)
+}
+
+// NewFairQueue returns a FairQueue that queues operations past threshold in flight, with at most classCap in flight
+// per class while operations wait or no per-class limit when classCap is 0. onDepth may be nil.
+func NewFairQueue(threshold, classCap int, onDepth func(class string, depth int)) *FairQueue {
+	return &FairQueue{
+		threshold:     threshold,
+		classCap:      classCap,
+		classInFlight: make(map[string]int),
+		waiting:       make(map[string][]chan struct{}),
+		onDepth:       onDepth,
+	}
+}
+
+// Acquire blocks until an operation of class may run or ctx is done, in which case ctx's error is returned.
+// The returned function must be called once the operation finishes.
+func (q *FairQueue) Acquire(ctx context.Context, class string) (func(), error) {
+	q.mux.Lock()
+	if q.inFlight < q.threshold && len(q.classes) == 0 {
+		q.admit(class)
+		q.mux.Unlock()
+		return q.releaseFunc(class), nil
+	}
+
+	ready := make(chan struct{})
+	if len(q.waiting[class]) == 0 {
+		q.classes = append(q.classes, class)
+	}
+	q.waiting[class] = append(q.waiting[class], ready)
+	q.depthChanged(class)
+	// The classes already waiting may all be at their cap, leaving room for this one
+	q.dispatch()
+	q.mux.Unlock()
+
+	select {
+	case <-ready:
+		return q.releaseFunc(class), nil
+	case <-ctx.Done():
+		q.mux.Lock()
+		defer q.mux.Unlock()
+		select {
+		case <-ready:
+			// Admitted concurrently with ctx being done, so the slot is handed back
+			q.release(class)
+		default:
+			q.remove(class, ready)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// InFlight returns the number of admitted operations that have not finished
+func (q *FairQueue) InFlight() int {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	return q.inFlight
+}
+
+func (q *FairQueue) releaseFunc(class string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			q.mux.Lock()
+			defer q.mux.Unlock()
+			q.release(class)
+		})
+	}
+}
+
+// admit counts an operation of class in flight. q.mux must be held.
+func (q *FairQueue) admit(class string) {
+	q.inFlight++
+	q.classInFlight[class]++
+}
+
+// release counts an operation of class as finished and admits waiting operations in its place. q.mux must be held.
+func (q *FairQueue) release(class string) {
+	q.inFlight--
+	if q.classInFlight[class]--; q.classInFlight[class] == 0 {
+		delete(q.classInFlight, class)
+	}
+	q.dispatch()
+}
+
+// dispatch admits waiting operations round-robin across classes while fewer than threshold are in flight.
+// q.mux must be held.
+func (q *FairQueue) dispatch() {
+	for q.inFlight < q.threshold && len(q.classes) > 0 {
+		idx := -1
+		for i := range q.classes {
+			candidate := (q.next + i) % len(q.classes)
+			if q.classCap == 0 || q.classInFlight[q.classes[candidate]] < q.classCap {
+				idx = candidate
+				break
+			}
+		}
+		if idx < 0 {
+			return
+		}
+
+		class := q.classes[idx]
+		ready := q.waiting[class][0]
+		q.waiting[class] = q.waiting[class][1:]
+		q.admit(class)
+		close(ready)
+		if len(q.waiting[class]) == 0 {
+			// The class after it moves into idx
+			q.dropClass(idx)
+			q.next = idx
+		} else {
+			q.next = idx + 1
+		}
+		if len(q.classes) > 0 {
+			q.next %= len(q.classes)
+		} else {
+			q.next = 0
+		}
+		q.depthChanged(class)
+	}
+}
+
+// remove stops waiting for ready, whose operation gave up. q.mux must be held.
+func (q *FairQueue) remove(class string, ready chan struct{}) {
+	q.waiting[class] = slices.DeleteFunc(q.waiting[class], func(c chan struct{}) bool { return c == ready })
+	if len(q.waiting[class]) == 0 {
+		idx := slices.Index(q.classes, class)
+		q.dropClass(idx)
+		if idx < q.next {
+			q.next--
+		}
+		if len(q.classes) > 0 {
+			q.next %= len(q.classes)
+		} else {
+			q.next = 0
+		}
+	}
+	q.depthChanged(class)
+}
+
+// dropClass removes the class at idx, which has no waiting operations left. q.mux must be held.
+func (q *FairQueue) dropClass(idx int) {
+	delete(q.waiting, q.classes[idx])
+	q.classes = slices.Delete(q.classes, idx, idx+1)
+}
+
+// depthChanged reports the number of waiting operations of class. q.mux must be held.
+func (q *FairQueue) depthChanged(class string) {
+	if q.onDepth != nil {
+		q.onDepth(class, len(q.waiting[class]))
+	}
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// admission is an operation admitted by a FairQueue
+type admission struct {
+	class   string
+	release func()
+}
+
+// fairQueueTest queues operations in a known order and reports them as they are admitted
+type fairQueueTest struct {
+	t        *testing.T
+	queue    *FairQueue
+	admitted chan admission
+	mux      sync.Mutex
+	depths   map[string]int
+}
+
+func newFairQueueTest(t *testing.T, threshold, classCap int) *fairQueueTest {
+	t.Helper()
+	ft := &fairQueueTest{t: t, admitted: make(chan admission, 100), depths: make(map[string]int)}
+	ft.queue = NewFairQueue(threshold, classCap, func(class string, depth int) {
+		ft.mux.Lock()
+		defer ft.mux.Unlock()
+		ft.depths[class] = depth
+	})
+	return ft
+}
+
+func (ft *fairQueueTest) depth(class string) int {
+	ft.mux.Lock()
+	defer ft.mux.Unlock()
+	return ft.depths[class]
+}
+
+// hold acquires a slot for class, which must be admitted without waiting
+func (ft *fairQueueTest) hold(class string) func() {
+	ft.t.Helper()
+	release, err := ft.queue.Acquire(context.Background(), class)
+	if err != nil {
+		ft.t.Fatalf("Acquire failed: %v", err)
+	}
+	return release
+}
+
+// enqueue starts an operation of class and waits until it is queued, so that operations are queued in call order
+func (ft *fairQueueTest) enqueue(class string) {
+	ft.t.Helper()
+	expected := ft.depth(class) + 1
+	go func() {
+		release, err := ft.queue.Acquire(context.Background(), class)
+		if err != nil {
+			ft.t.Errorf("Acquire failed: %v", err)
+			return
+		}
+		ft.admitted <- admission{class: class, release: release}
+	}()
+	ft.waitForDepth(class, expected)
+}
+
+func (ft *fairQueueTest) waitForDepth(class string, expected int) {
+	ft.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for ft.depth(class) != expected {
+		if time.Now().After(deadline) {
+			ft.t.Fatalf("Timed out waiting for %d queued operations of %s, got %d", expected, class, ft.depth(class))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// next returns the next admitted operation
+func (ft *fairQueueTest) next() admission {
+	ft.t.Helper()
+	select {
+	case a := <-ft.admitted:
+		return a
+	case <-time.After(5 * time.Second):
+		ft.t.Fatalf("Timed out waiting for an operation to be admitted")
+		return admission{}
+	}
+}
+
+func (ft *fairQueueTest) expectNoAdmission() {
+	ft.t.Helper()
+	select {
+	case a := <-ft.admitted:
+		ft.t.Fatalf("Unexpected admission of an operation of %s", a.class)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestFairQueueBelowThreshold(t *testing.T) {
+	ft := newFairQueueTest(t, 3, 1)
+
+	// The class cap only applies once operations are queued
+	releases := []func(){ft.hold("batch"), ft.hold("batch"), ft.hold("interactive")}
+	if inFlight := ft.queue.InFlight(); inFlight != 3 {
+		t.Fatalf("Expected 3 operations in flight, got %d", inFlight)
+	}
+	for _, release := range releases {
+		release()
+		// Releasing twice must not free another slot
+		release()
+	}
+	if inFlight := ft.queue.InFlight(); inFlight != 0 {
+		t.Fatalf("Expected no operation in flight, got %d", inFlight)
+	}
+}
+
+func TestFairQueueInterleavesClasses(t *testing.T) {
+	ft := newFairQueueTest(t, 1, 0)
+	release := ft.hold("batch")
+
+	for i := 0; i < 5; i++ {
+		ft.enqueue("batch")
+	}
+	ft.enqueue("interactive")
+	ft.enqueue("interactive")
+	ft.expectNoAdmission()
+
+	var order []string
+	for i := 0; i < 7; i++ {
+		release()
+		a := ft.next()
+		order = append(order, a.class)
+		release = a.release
+	}
+	release()
+
+	expected := []string{"batch", "interactive", "batch", "interactive", "batch", "batch", "batch"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Fatalf("Unexpected admission order %v, want %v", order, expected)
+	}
+	if ft.depth("batch") != 0 || ft.depth("interactive") != 0 {
+		t.Fatalf("Expected empty queues, got %d batch and %d interactive", ft.depth("batch"), ft.depth("interactive"))
+	}
+	if inFlight := ft.queue.InFlight(); inFlight != 0 {
+		t.Fatalf("Expected no operation in flight, got %d", inFlight)
+	}
+}
+
+func TestFairQueueClassCap(t *testing.T) {
+	ft := newFairQueueTest(t, 2, 1)
+	releaseFirst, releaseSecond := ft.hold("batch"), ft.hold("batch")
+
+	ft.enqueue("batch")
+	ft.enqueue("interactive")
+
+	// batch is at its cap, so the slot goes to interactive even though batch queued first
+	releaseFirst()
+	if a := ft.next(); a.class != "interactive" {
+		t.Fatalf("Expected interactive to be admitted, got %s", a.class)
+	} else {
+		defer a.release()
+	}
+	ft.expectNoAdmission()
+
+	releaseSecond()
+	if a := ft.next(); a.class != "batch" {
+		t.Fatalf("Expected batch to be admitted, got %s", a.class)
+	} else {
+		a.release()
+	}
+}
+
+func TestFairQueueCancelled(t *testing.T) {
+	ft := newFairQueueTest(t, 1, 0)
+	release := ft.hold("batch")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		_, err := ft.queue.Acquire(ctx, "interactive")
+		errs <- err
+	}()
+	ft.waitForDepth("interactive", 1)
+	ft.enqueue("batch")
+
+	cancel()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	ft.waitForDepth("interactive", 0)
+
+	release()
+	if a := ft.next(); a.class != "batch" {
+		t.Fatalf("Expected batch to be admitted, got %s", a.class)
+	} else {
+		a.release()
+	}
+	if inFlight := ft.queue.InFlight(); inFlight != 0 {
+		t.Fatalf("Expected no operation in flight, got %d", inFlight)
+	}
+}
@@ -17,8 +17,11 @@ limitations under the License.
 package internal
 
 import (
+	"context"
+	"slices"
 	"sync"
 
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/metrics"
 	"k8s.io/klog/v2"
 )
 
@@ -35,10 +38,50 @@ const (
 	VolumeOperationAlreadyExistsErrorMsg = "An operation with the given Volume %s already exists"
 )
 
+// InFlightOperationsMetric is the gauge of the number of operations in flight across all InFlight instances
+const InFlightOperationsMetric = "inflight_operations"
+
+var (
+	// inFlightKeys counts the operations in flight by key across all InFlight instances, guarded by inFlightKeysMux.
+	// Their total is the value of InFlightOperationsMetric.
+	inFlightKeys       = map[string]int{}
+	inFlightOperations int
+	inFlightKeysMux    sync.Mutex
+)
+
+// addInFlightOperation adds delta to the number of operations in flight on key and records their total
+func addInFlightOperation(key string, delta int) {
+	inFlightKeysMux.Lock()
+	defer inFlightKeysMux.Unlock()
+	inFlightKeys[key] += delta
+	if inFlightKeys[key] <= 0 {
+		delete(inFlightKeys, key)
+	}
+	inFlightOperations += delta
+	metrics.Recorder().SetGauge(InFlightOperationsMetric, float64(inFlightOperations), nil)
+}
+
+// InFlightKeys returns the sorted keys of the operations in flight across all InFlight instances, to find the volumes
+// whose operations are stuck
+func InFlightKeys() []string {
+	inFlightKeysMux.Lock()
+	defer inFlightKeysMux.Unlock()
+	keys := make([]string, 0, len(inFlightKeys))
+	for key := range inFlightKeys {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
 // InFlight is a struct used to manage in flight requests for a unique identifier.
 type InFlight struct {
 	mux      *sync.Mutex
 	inFlight map[string]bool
+	// draining is set once Drain is called, after which no entries are inserted
+	draining bool
+	// drained is closed once draining and no entries are left
+	drained chan struct{}
 }
 
 // NewInFlight instanciates a InFlight structures.
@@ -50,17 +93,21 @@ func NewInFlight() *InFlight {
 }
 
 // Insert inserts the entry to the current list of inflight, request key is a unique identifier.
-// Returns false when the key already exists.
+// Returns false when the key already exists or the InFlight is draining, see Draining.
 func (db *InFlight) Insert(key string) bool {
 	db.mux.Lock()
 	defer db.mux.Unlock()
 
+	if db.draining {
+		return false
+	}
 	_, ok := db.inFlight[key]
 	if ok {
 		return false
 	}
 
 	db.inFlight[key] = true
+	addInFlightOperation(key, 1)
 	return true
 }
 
@@ -70,6 +117,59 @@ func (db *InFlight) Delete(key string) {
 	db.mux.Lock()
 	defer db.mux.Unlock()
 
-	delete(db.inFlight, key)
+	if _, ok := db.inFlight[key]; ok {
+		delete(db.inFlight, key)
+		addInFlightOperation(key, -1)
+	}
 	klog.V(4).InfoS("Node Service: volume operation finished", "key", key)
+	db.closeDrainedIfEmpty()
+}
+
+// Len returns the number of entries in flight.
+func (db *InFlight) Len() int {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	return len(db.inFlight)
+}
+
+// Drain stops inserting new entries and blocks until all entries have been deleted or ctx is done, in which case
+// ctx's error is returned. Entries are never inserted again once Drain has been called.
+func (db *InFlight) Drain(ctx context.Context) error {
+	db.mux.Lock()
+	if !db.draining {
+		db.draining = true
+		db.drained = make(chan struct{})
+		db.closeDrainedIfEmpty()
+	}
+	drained := db.drained
+	db.mux.Unlock()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Draining reports whether Drain has been called, which distinguishes an Insert rejected while draining from one
+// rejected because the key already exists.
+func (db *InFlight) Draining() bool {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	return db.draining
+}
+
+// closeDrainedIfEmpty closes drained once draining and no entries are left. db.mux must be held.
+func (db *InFlight) closeDrainedIfEmpty() {
+	if !db.draining || len(db.inFlight) > 0 {
+		return
+	}
+	select {
+	case <-db.drained:
+	default:
+		close(db.drained)
+	}
 }
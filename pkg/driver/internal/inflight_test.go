@@ -17,7 +17,15 @@ limitations under the License.
 package internal
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/metrics"
 )
 
 type testRequest struct {
@@ -110,3 +118,171 @@ func TestInFlight(t *testing.T) {
 
 	}
 }
+
+func TestInFlightDrain(t *testing.T) {
+	t.Run("empty", func(t *testing.T) {
+		db := NewInFlight()
+		if err := db.Drain(context.Background()); err != nil {
+			t.Fatalf("expected drain of empty inflight to succeed, got %v", err)
+		}
+		if db.Insert("vol-test") {
+			t.Error("expected insert after drain to fail")
+		}
+	})
+
+	t.Run("waits for entries", func(t *testing.T) {
+		db := NewInFlight()
+		db.Insert("vol-test")
+
+		done := make(chan error, 1)
+		go func() {
+			done <- db.Drain(context.Background())
+		}()
+		for !db.Draining() {
+			time.Sleep(time.Millisecond)
+		}
+		if db.Insert("vol-other") {
+			t.Error("expected insert while draining to fail")
+		}
+		select {
+		case err := <-done:
+			t.Fatalf("expected drain to wait for vol-test, returned %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		db.Delete("vol-test")
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("expected drain to succeed, got %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("drain did not return after the last entry was deleted")
+		}
+	})
+
+	t.Run("context done", func(t *testing.T) {
+		db := NewInFlight()
+		db.Insert("vol-test")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := db.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected drain to fail with %v, got %v", context.DeadlineExceeded, err)
+		}
+		// Deleting the entry after the drain gave up must not panic
+		db.Delete("vol-test")
+	})
+}
+
+func currentInFlightOperations() int {
+	inFlightKeysMux.Lock()
+	defer inFlightKeysMux.Unlock()
+	return inFlightOperations
+}
+
+// insertDeleteConcurrently inserts and deletes n entries concurrently, and checks that the number of operations in
+// flight returns to where it started. Other tests may leave entries behind, so it is not necessarily zero.
+func insertDeleteConcurrently(tb testing.TB, n int) {
+	tb.Helper()
+	before := currentInFlightOperations()
+	db := NewInFlight()
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			if !db.Insert(key) {
+				tb.Errorf("expected insert of %s to succeed", key)
+				return
+			}
+			db.Delete(key)
+			// Deleting twice must not decrement the gauge again
+			db.Delete(key)
+		}(fmt.Sprintf("vol-%d", i))
+	}
+	wg.Wait()
+
+	if after := currentInFlightOperations(); after != before {
+		tb.Fatalf("expected %d operations in flight after all entries were deleted, got %d", before, after)
+	}
+}
+
+func TestInFlightOperationsMetric(t *testing.T) {
+	metrics.InitializeRecorder()
+	insertDeleteConcurrently(t, 1000)
+
+	before := currentInFlightOperations()
+	db := NewInFlight()
+	db.Insert("vol-test")
+	if !db.Insert("vol-other") || db.Insert("vol-test") {
+		t.Fatal("unexpected insert result")
+	}
+	if got := currentInFlightOperations(); got != before+2 {
+		t.Fatalf("expected %d operations in flight, got %d", before+2, got)
+	}
+	db.Delete("vol-test")
+	db.Delete("vol-other")
+	if got := currentInFlightOperations(); got != before {
+		t.Fatalf("expected %d operations in flight, got %d", before, got)
+	}
+}
+
+func TestInFlightLen(t *testing.T) {
+	db := NewInFlight()
+	if db.Len() != 0 {
+		t.Fatalf("expected 0 entries, got %d", db.Len())
+	}
+	db.Insert("vol-len-1")
+	db.Insert("vol-len-2")
+	db.Insert("vol-len-2")
+	if db.Len() != 2 {
+		t.Fatalf("expected 2 entries after inserts, got %d", db.Len())
+	}
+	db.Delete("vol-len-1")
+	db.Delete("vol-len-unknown")
+	if db.Len() != 1 {
+		t.Fatalf("expected 1 entry after deletes, got %d", db.Len())
+	}
+	db.Delete("vol-len-2")
+	if db.Len() != 0 {
+		t.Fatalf("expected 0 entries after deleting all, got %d", db.Len())
+	}
+}
+
+func TestInFlightKeys(t *testing.T) {
+	// hasKey reports whether InFlightKeys returns key. Other tests may leave keys behind.
+	hasKey := func(key string) bool {
+		return slices.Contains(InFlightKeys(), key)
+	}
+
+	controller, node := NewInFlight(), NewInFlight()
+	controller.Insert("vol-keys-1")
+	node.Insert("vol-keys-1")
+	node.Insert("vol-keys-2")
+	if !hasKey("vol-keys-1") || !hasKey("vol-keys-2") {
+		t.Fatalf("expected the keys of all InFlight instances, got %v", InFlightKeys())
+	}
+	if keys := InFlightKeys(); !slices.IsSorted(keys) {
+		t.Errorf("expected sorted keys, got %v", keys)
+	}
+
+	// A key is held until every instance deleted it
+	controller.Delete("vol-keys-1")
+	if !hasKey("vol-keys-1") {
+		t.Fatalf("expected vol-keys-1 to be held by the node, got %v", InFlightKeys())
+	}
+	node.Delete("vol-keys-1")
+	node.Delete("vol-keys-2")
+	if hasKey("vol-keys-1") || hasKey("vol-keys-2") {
+		t.Fatalf("expected deleted keys to be gone, got %v", InFlightKeys())
+	}
+}
+
+func BenchmarkInFlightConcurrent(b *testing.B) {
+	metrics.InitializeRecorder()
+	for i := 0; i < b.N; i++ {
+		insertDeleteConcurrently(b, 1000)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"sync"
+)
+
+// StagingRegistry tracks the staging path each volume is currently staged to on this node.
+type StagingRegistry struct {
+	mux   *sync.Mutex
+	paths map[string]string
+}
+
+// NewStagingRegistry instantiates an empty StagingRegistry.
+func NewStagingRegistry() *StagingRegistry {
+	return &StagingRegistry{
+		mux:   &sync.Mutex{},
+		paths: make(map[string]string),
+	}
+}
+
+// Get returns the staging path registered for the volume.
+// Returns false when the volume is not registered.
+func (r *StagingRegistry) Get(volumeID string) (string, bool) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	path, ok := r.paths[volumeID]
+	return path, ok
+}
+
+// Set registers the staging path of the volume, replacing any previous entry.
+func (r *StagingRegistry) Set(volumeID, path string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.paths[volumeID] = path
+}
+
+// Delete removes the entry of the volume if it is registered at the given staging path.
+// It will do nothing if the volume is not registered or is registered at another path.
+func (r *StagingRegistry) Delete(volumeID, path string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if r.paths[volumeID] == path {
+		delete(r.paths, volumeID)
+	}
+}
+
+// Len returns the number of registered volumes.
+func (r *StagingRegistry) Len() int {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	return len(r.paths)
+}
+
+// List returns a copy of the staging path of every registered volume, keyed by volume ID.
+func (r *StagingRegistry) List() map[string]string {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	paths := make(map[string]string, len(r.paths))
+	for volumeID, path := range r.paths {
+		paths[volumeID] = path
+	}
+	return paths
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"testing"
+)
+
+func TestStagingRegistry(t *testing.T) {
+	r := NewStagingRegistry()
+
+	if _, ok := r.Get("vol-1"); ok {
+		t.Fatal("expected empty registry")
+	}
+
+	r.Set("vol-1", "/staging/a")
+	if path, ok := r.Get("vol-1"); !ok || path != "/staging/a" {
+		t.Fatalf("unexpected entry: got %q, %v, want /staging/a, true", path, ok)
+	}
+
+	// Deleting at another path must not clear the entry
+	r.Delete("vol-1", "/staging/b")
+	if path, ok := r.Get("vol-1"); !ok || path != "/staging/a" {
+		t.Fatalf("entry removed by delete at another path: got %q, %v", path, ok)
+	}
+
+	r.Delete("vol-1", "/staging/a")
+	if _, ok := r.Get("vol-1"); ok {
+		t.Fatal("expected entry to be removed")
+	}
+}
+
+func TestStagingRegistryList(t *testing.T) {
+	r := NewStagingRegistry()
+	r.Set("vol-1", "/staging/a")
+	r.Set("vol-2", "/staging/b")
+
+	paths := r.List()
+	if len(paths) != 2 || paths["vol-1"] != "/staging/a" || paths["vol-2"] != "/staging/b" {
+		t.Fatalf("unexpected entries: got %v", paths)
+	}
+
+	// The returned map is a copy
+	delete(paths, "vol-1")
+	if _, ok := r.Get("vol-1"); !ok {
+		t.Fatal("entry removed through the listed copy")
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud/metadata"
+	corev1 "k8s.io/api/core/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+// interruptionNoticePollInterval is the interval between IMDS checks for a pending stop or termination of the instance
+// Spot interruption notices are issued two minutes ahead, so this leaves ample time to react
+var interruptionNoticePollInterval = 5 * time.Second
+
+// watchInterruptionNotices polls IMDS until an interruption notice is found and handles it once, or ctx is done
+func (d *NodeService) watchInterruptionNotices(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.clock.After(interruptionNoticePollInterval):
+			if d.checkInterruptionNotice() {
+				return
+			}
+		}
+	}
+}
+
+// checkInterruptionNotice handles a pending stop or termination of the instance, if any
+// Returns true once a notice was found and handled
+func (d *NodeService) checkInterruptionNotice() bool {
+	notice, err := d.metadata.GetInterruptionNotice()
+	if err != nil {
+		klog.V(4).InfoS("Failed to check for interruption notice", "err", err)
+		return false
+	}
+	if notice == nil {
+		return false
+	}
+
+	d.interruptionTime.Store(&notice.Time)
+
+	// The staging registry is empty after the node plugin restarts, so the staged volumes are listed from the mount table
+	staged, err := d.listStagedVolumes()
+	if err != nil {
+		klog.V(4).InfoS("Could not list staged volumes from mounts, using the staging registry", "err", err)
+		staged = d.staged.List()
+	}
+	klog.InfoS("Instance interruption notice found", "action", notice.Action, "time", notice.Time, "stagedVolumes", staged)
+	if d.eventRecorder != nil {
+		recordInterruptionNoticeEvent(d.eventRecorder, notice, len(staged))
+	}
+
+	if d.options.FlushOnInterruptionNotice {
+		for volumeID, target := range staged {
+			if err := d.mounter.SyncFilesystem(target); err != nil {
+				klog.ErrorS(err, "Failed to flush staged volume", "volumeID", volumeID, "target", target)
+				continue
+			}
+			klog.V(4).InfoS("Flushed staged volume", "volumeID", volumeID, "target", target)
+		}
+	}
+	return true
+}
+
+// imminentInterruption returns when the instance will be stopped or terminated if an interruption notice was found and
+// the instance is due to be interrupted within --spot-interruption-grace
+func (d *NodeService) imminentInterruption() (time.Time, bool) {
+	interruptionTime := d.interruptionTime.Load()
+	if interruptionTime == nil || d.options.SpotInterruptionGrace <= 0 {
+		return time.Time{}, false
+	}
+	if d.clock.Now().Before(interruptionTime.Add(-d.options.SpotInterruptionGrace)) {
+		return time.Time{}, false
+	}
+	return *interruptionTime, true
+}
+
+// recordInterruptionNoticeEvent records a warning event on the local node for a pending stop or termination
+// The node is referenced by name only, as the kubelet does, to avoid looking it up while the instance is going away
+func recordInterruptionNoticeEvent(recorder record.EventRecorder, notice *metadata.InterruptionNotice, stagedVolumes int) {
+	nodeName := os.Getenv("CSI_NODE_NAME")
+	if nodeName == "" {
+		klog.V(4).InfoS("CSI_NODE_NAME missing, skipping interruption notice event")
+		return
+	}
+
+	node := &corev1.ObjectReference{Kind: "Node", Name: nodeName, UID: k8stypes.UID(nodeName)}
+	recorder.Eventf(node, corev1.EventTypeWarning, InterruptionNoticeEventReason, "Instance is scheduled to %s at %s with %d EBS volume(s) still staged", notice.Action, notice.Time.Format(time.RFC3339), stagedVolumes)
+}
@@ -0,0 +1,280 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud/metadata"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/driver/internal"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/mounter"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	mountutils "k8s.io/mount-utils"
+	testingclock "k8s.io/utils/clock/testing"
+	"k8s.io/utils/ptr"
+)
+
+func TestCheckInterruptionNotice(t *testing.T) {
+	notice := &metadata.InterruptionNotice{Action: "terminate", Time: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+
+	testCases := []struct {
+		name           string
+		notice         *metadata.InterruptionNotice
+		noticeErr      error
+		flush          bool
+		flushErr       error
+		listErr        error
+		expectedFlush  []string
+		expectEvent    bool
+		expectedResult bool
+	}{
+		{
+			name: "no notice",
+		},
+		{
+			name:      "error checking for notice",
+			noticeErr: errors.New("500 - Internal Server Error"),
+		},
+		{
+			name:           "notice without flush",
+			notice:         notice,
+			expectEvent:    true,
+			expectedResult: true,
+		},
+		{
+			name:           "notice with flush",
+			notice:         notice,
+			flush:          true,
+			expectedFlush:  []string{"/staging/vol-1", "/staging/vol-2"},
+			expectEvent:    true,
+			expectedResult: true,
+		},
+		{
+			name:           "notice with failing flush",
+			notice:         notice,
+			flush:          true,
+			flushErr:       errors.New("input/output error"),
+			expectedFlush:  []string{"/staging/vol-1", "/staging/vol-2"},
+			expectEvent:    true,
+			expectedResult: true,
+		},
+		{
+			name:           "notice with flush of the staging registry when mounts cannot be listed",
+			notice:         notice,
+			flush:          true,
+			listErr:        errors.New("permission denied"),
+			expectedFlush:  []string{"/registry/vol-1"},
+			expectEvent:    true,
+			expectedResult: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("CSI_NODE_NAME", "test-node")
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+
+			mockMetadata := metadata.NewMockMetadataService(mockCtl)
+			mockMetadata.EXPECT().GetInterruptionNotice().Return(tc.notice, tc.noticeErr)
+
+			// The volumes were staged before the node plugin restarted, so only the mount table and the vol_data.json
+			// of kubelet know them
+			stagingDir := t.TempDir()
+			var mountPoints []mountutils.MountPoint
+			for volumeID, driverName := range map[string]string{"vol-1": DriverName, "vol-2": DriverName, "vol-other": "other.csi.k8s.io"} {
+				if err := os.MkdirAll(filepath.Join(stagingDir, volumeID, stagingPathName), 0750); err != nil {
+					t.Fatalf("failed to create staging path: %v", err)
+				}
+				volData := fmt.Sprintf(`{"driverName":%q,"volumeHandle":%q}`, driverName, volumeID)
+				if err := os.WriteFile(filepath.Join(stagingDir, volumeID, volDataFileName), []byte(volData), 0640); err != nil {
+					t.Fatalf("failed to write vol_data.json: %v", err)
+				}
+				mountPoints = append(mountPoints, mountutils.MountPoint{Device: "/dev/xvdba", Path: filepath.Join(stagingDir, volumeID, stagingPathName)})
+			}
+
+			mockMounter := mounter.NewMockMounter(mockCtl)
+			if tc.notice != nil {
+				mockMounter.EXPECT().List().Return(mountPoints, tc.listErr)
+			}
+			for _, target := range tc.expectedFlush {
+				if tc.listErr == nil {
+					target = filepath.Join(stagingDir, strings.TrimPrefix(target, "/staging/"), stagingPathName)
+				}
+				mockMounter.EXPECT().SyncFilesystem(target).Return(tc.flushErr)
+			}
+
+			recorder := record.NewFakeRecorder(10)
+
+			staged := internal.NewStagingRegistry()
+			staged.Set("vol-1", "/registry/vol-1")
+
+			driver := &NodeService{
+				metadata: mockMetadata,
+				mounter:  mockMounter,
+				staged:   staged,
+				options:  &Options{WatchInterruptionNotices: true, FlushOnInterruptionNotice: tc.flush},
+
+				eventRecorder: recorder,
+			}
+
+			if result := driver.checkInterruptionNotice(); result != tc.expectedResult {
+				t.Errorf("expected checkInterruptionNotice to return %v, got %v", tc.expectedResult, result)
+			}
+			if interruptionTime := driver.interruptionTime.Load(); tc.notice != nil && (interruptionTime == nil || !interruptionTime.Equal(tc.notice.Time)) {
+				t.Errorf("expected interruption time %v, got %v", tc.notice.Time, interruptionTime)
+			} else if tc.notice == nil && interruptionTime != nil {
+				t.Errorf("expected no interruption time, got %v", interruptionTime)
+			}
+			events := drainEvents(recorder)
+			if tc.expectEvent && (len(events) != 1 || !strings.HasPrefix(events[0], corev1.EventTypeWarning+" "+InterruptionNoticeEventReason+" ")) {
+				t.Errorf("expected an interruption notice event, got %v", events)
+			} else if !tc.expectEvent && len(events) != 0 {
+				t.Errorf("expected no events, got %v", events)
+			}
+		})
+	}
+}
+
+func TestWatchInterruptionNotices(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	mockMetadata := metadata.NewMockMetadataService(mockCtl)
+	driver := &NodeService{
+		metadata: mockMetadata,
+		clock:    fakeClock,
+		staged:   internal.NewStagingRegistry(),
+		options:  &Options{WatchInterruptionNotices: true},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		driver.watchInterruptionNotices(ctx)
+		close(done)
+	}()
+
+	// IMDS is polled at every interruptionNoticePollInterval of the clock of the driver
+	polled := make(chan struct{})
+	mockMetadata.EXPECT().GetInterruptionNotice().DoAndReturn(func() (*metadata.InterruptionNotice, error) {
+		polled <- struct{}{}
+		return nil, nil
+	}).Times(2)
+	for range 2 {
+		for !fakeClock.HasWaiters() {
+			time.Sleep(time.Millisecond)
+		}
+		fakeClock.Step(interruptionNoticePollInterval)
+		<-polled
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected watchInterruptionNotices to return once its context is canceled")
+	}
+}
+
+func TestNodeStageVolumeInterruption(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name             string
+		grace            time.Duration
+		interruptionTime *time.Time
+		expectedCode     codes.Code
+	}{
+		{
+			name:  "no interruption notice",
+			grace: 2 * time.Minute,
+		},
+		{
+			name:             "interruption beyond grace",
+			grace:            time.Minute,
+			interruptionTime: ptr.To(now.Add(2 * time.Minute)),
+		},
+		{
+			name:             "interruption within grace",
+			grace:            2 * time.Minute,
+			interruptionTime: ptr.To(now.Add(2 * time.Minute)),
+			expectedCode:     codes.Unavailable,
+		},
+		{
+			name:             "interruption without grace",
+			interruptionTime: ptr.To(now.Add(2 * time.Minute)),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+
+			mockMounter := mounter.NewMockMounter(mockCtl)
+			mockMetadata := metadata.NewMockMetadataService(mockCtl)
+			if tc.expectedCode == codes.OK {
+				mockMetadata.EXPECT().GetRegion().Return("us-west-2")
+				mockMounter.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
+				mockMounter.EXPECT().PathExists(gomock.Eq("/staging/path")).Return(true, nil)
+				mockMounter.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("/dev/xvdba", 1, nil)
+			}
+
+			driver := &NodeService{
+				metadata:       mockMetadata,
+				mounter:        mockMounter,
+				deviceResolver: mockMounter,
+				inFlight:       internal.NewInFlight(),
+				staged:         internal.NewStagingRegistry(),
+				options:        &Options{SpotInterruptionGrace: tc.grace},
+				clock:          testingclock.NewFakeClock(now),
+			}
+			driver.interruptionTime.Store(tc.interruptionTime)
+
+			_, err := driver.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{FsType: FSTypeExt4},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				PublishContext: map[string]string{DevicePathKey: "/dev/xvdba"},
+			})
+			if status.Code(err) != tc.expectedCode {
+				t.Fatalf("expected code %v, got error %v", tc.expectedCode, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+// luksMapperName returns the device-mapper name the LUKS device of the volume is opened as
+func luksMapperName(volumeID string) string {
+	return "ebs-luks-" + volumeID
+}
+
+// parseLuksOptions reports whether the volume context enables LUKS encryption and returns the passphrase read from
+// the NodeStageSecrets entry named by LuksPassphraseSecretKey
+func parseLuksOptions(volumeContext, secrets map[string]string) (bool, string, error) {
+	value, ok := volumeContext[EncryptedKey]
+	if !ok {
+		return false, "", nil
+	}
+	encrypted, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, "", status.Errorf(codes.InvalidArgument, "Invalid %s (%s): must be true or false", EncryptedKey, value)
+	}
+	if !encrypted {
+		return false, "", nil
+	}
+
+	secretKey := volumeContext[LuksPassphraseSecretKey]
+	if secretKey == "" {
+		secretKey = DefaultLuksPassphraseSecretKey
+	}
+	passphrase, ok := secrets[secretKey]
+	if !ok || passphrase == "" {
+		return false, "", status.Errorf(codes.InvalidArgument, "LUKS passphrase not provided in node stage secret %q", secretKey)
+	}
+	return true, passphrase, nil
+}
+
+// openLuksDevice opens the LUKS device of the volume and returns its path, first formatting source with LUKS if it
+// has no LUKS header yet. A device that is already open is reused.
+func (d *NodeService) openLuksDevice(source, volumeID, passphrase string) (string, error) {
+	isLuks, err := d.mounter.IsLuks(source)
+	if err != nil {
+		return "", err
+	}
+	if !isLuks {
+		klog.V(2).InfoS("NodeStageVolume: formatting device with LUKS", "volumeID", volumeID, "source", source)
+		if err = d.mounter.LuksFormat(source, passphrase); err != nil {
+			return "", err
+		}
+	}
+	mapperPath, err := d.mounter.LuksOpen(source, luksMapperName(volumeID), passphrase)
+	if err != nil {
+		return "", err
+	}
+	klog.V(4).InfoS("NodeStageVolume: opened LUKS device", "volumeID", volumeID, "source", source, "mapperPath", mapperPath)
+	return mapperPath, nil
+}
+
+// isLuksDevice reports whether device, the device mounted at the staging path of the volume, is its LUKS device
+func isLuksDevice(volumeID, device string) bool {
+	return filepath.Base(device) == luksMapperName(volumeID)
+}
+
+// closeLuksDevice closes the LUKS device of the volume. It is called on every unstage, including when the staging
+// path is no longer mounted, so that the mapping never outlives the staging of the volume and blocks its detach.
+// Volumes without an open LUKS device are left untouched.
+func (d *NodeService) closeLuksDevice(volumeID string) error {
+	name := luksMapperName(volumeID)
+	if err := d.mounter.LuksClose(name); err != nil {
+		return fmt.Errorf("could not close LUKS device %q: %w", name, err)
+	}
+	klog.V(4).InfoS("NodeUnstageVolume: closed LUKS device", "volumeID", volumeID, "name", name)
+	return nil
+}
@@ -0,0 +1,363 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud/metadata"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/driver/internal"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/mounter"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/utils/clock"
+)
+
+func TestParseLuksOptions(t *testing.T) {
+	testCases := []struct {
+		name               string
+		volumeContext      map[string]string
+		secrets            map[string]string
+		expectedEncrypted  bool
+		expectedPassphrase string
+		expectedCode       codes.Code
+	}{
+		{
+			name: "not encrypted",
+		},
+		{
+			name:          "encrypted false",
+			volumeContext: map[string]string{EncryptedKey: "false"},
+		},
+		{
+			name:               "default passphrase secret",
+			volumeContext:      map[string]string{EncryptedKey: "true"},
+			secrets:            map[string]string{DefaultLuksPassphraseSecretKey: "secret"},
+			expectedEncrypted:  true,
+			expectedPassphrase: "secret",
+		},
+		{
+			name:               "custom passphrase secret",
+			volumeContext:      map[string]string{EncryptedKey: "true", LuksPassphraseSecretKey: "luks-key"},
+			secrets:            map[string]string{DefaultLuksPassphraseSecretKey: "other", "luks-key": "secret"},
+			expectedEncrypted:  true,
+			expectedPassphrase: "secret",
+		},
+		{
+			name:          "invalid encrypted value",
+			volumeContext: map[string]string{EncryptedKey: "yes please"},
+			expectedCode:  codes.InvalidArgument,
+		},
+		{
+			name:          "missing passphrase secret",
+			volumeContext: map[string]string{EncryptedKey: "true", LuksPassphraseSecretKey: "luks-key"},
+			secrets:       map[string]string{DefaultLuksPassphraseSecretKey: "secret"},
+			expectedCode:  codes.InvalidArgument,
+		},
+		{
+			name:          "empty passphrase",
+			volumeContext: map[string]string{EncryptedKey: "true"},
+			secrets:       map[string]string{DefaultLuksPassphraseSecretKey: ""},
+			expectedCode:  codes.InvalidArgument,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			encrypted, passphrase, err := parseLuksOptions(tc.volumeContext, tc.secrets)
+			if tc.expectedCode != codes.OK {
+				if status.Code(err) != tc.expectedCode {
+					t.Fatalf("Expected code %v, got error %v", tc.expectedCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if encrypted != tc.expectedEncrypted || passphrase != tc.expectedPassphrase {
+				t.Errorf("Unexpected result: got (%v, %q), want (%v, %q)", encrypted, passphrase, tc.expectedEncrypted, tc.expectedPassphrase)
+			}
+		})
+	}
+}
+
+func TestNodeStageVolumeLuks(t *testing.T) {
+	const (
+		volumeID    = "vol-test"
+		devicePath  = "/dev/xvdba"
+		mapperPath  = "/dev/mapper/ebs-luks-vol-test"
+		stagingPath = "/staging/path"
+		passphrase  = "secret"
+	)
+	mountCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{
+			Mount: &csi.VolumeCapability_MountVolume{
+				FsType: FSTypeExt4,
+			},
+		},
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		},
+	}
+	blockCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Block{
+			Block: &csi.VolumeCapability_BlockVolume{},
+		},
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		},
+	}
+
+	testCases := []struct {
+		name         string
+		volumeCap    *csi.VolumeCapability
+		secrets      map[string]string
+		setup        func(m *mounter.MockMounter)
+		expectedCode codes.Code
+	}{
+		{
+			name:      "new device formatted with LUKS before the filesystem",
+			volumeCap: mountCap,
+			setup: func(m *mounter.MockMounter) {
+				gomock.InOrder(
+					m.EXPECT().IsLuks(gomock.Eq(devicePath)).Return(false, nil),
+					m.EXPECT().LuksFormat(gomock.Eq(devicePath), gomock.Eq(passphrase)).Return(nil),
+					m.EXPECT().LuksOpen(gomock.Eq(devicePath), gomock.Eq("ebs-luks-vol-test"), gomock.Eq(passphrase)).Return(mapperPath, nil),
+					m.EXPECT().GetDeviceNameFromMount(gomock.Eq(stagingPath)).Return("", 0, nil),
+					m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil),
+					m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Eq(mapperPath), gomock.Eq(stagingPath), gomock.Eq(FSTypeExt4), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
+					m.EXPECT().NeedResize(gomock.Eq(mapperPath), gomock.Eq(stagingPath)).Return(false, nil),
+				)
+			},
+		},
+		{
+			name:      "existing LUKS device opened without formatting",
+			volumeCap: mountCap,
+			setup: func(m *mounter.MockMounter) {
+				m.EXPECT().IsLuks(gomock.Eq(devicePath)).Return(true, nil)
+				m.EXPECT().LuksFormat(gomock.Any(), gomock.Any()).Times(0)
+				m.EXPECT().LuksOpen(gomock.Eq(devicePath), gomock.Eq("ebs-luks-vol-test"), gomock.Eq(passphrase)).Return(mapperPath, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq(stagingPath)).Return("", 0, nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Eq(mapperPath), gomock.Eq(stagingPath), gomock.Eq(FSTypeExt4), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				m.EXPECT().NeedResize(gomock.Eq(mapperPath), gomock.Eq(stagingPath)).Return(false, nil)
+			},
+		},
+		{
+			name:      "already open and staged",
+			volumeCap: mountCap,
+			setup: func(m *mounter.MockMounter) {
+				m.EXPECT().IsLuks(gomock.Eq(devicePath)).Return(true, nil)
+				m.EXPECT().LuksOpen(gomock.Eq(devicePath), gomock.Eq("ebs-luks-vol-test"), gomock.Eq(passphrase)).Return(mapperPath, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq(stagingPath)).Return(mapperPath, 1, nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
+		{
+			name:      "LUKS format failure",
+			volumeCap: mountCap,
+			setup: func(m *mounter.MockMounter) {
+				m.EXPECT().IsLuks(gomock.Eq(devicePath)).Return(false, nil)
+				m.EXPECT().LuksFormat(gomock.Eq(devicePath), gomock.Eq(passphrase)).Return(errors.New("refusing to format /dev/xvdba with LUKS, it already contains ext4"))
+			},
+			expectedCode: codes.Internal,
+		},
+		{
+			name:      "LUKS open failure",
+			volumeCap: mountCap,
+			setup: func(m *mounter.MockMounter) {
+				m.EXPECT().IsLuks(gomock.Eq(devicePath)).Return(true, nil)
+				m.EXPECT().LuksOpen(gomock.Eq(devicePath), gomock.Eq("ebs-luks-vol-test"), gomock.Eq(passphrase)).Return("", errors.New("No key available with this passphrase"))
+			},
+			expectedCode: codes.Internal,
+		},
+		{
+			name:         "missing passphrase",
+			volumeCap:    mountCap,
+			secrets:      map[string]string{},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "block volume rejected",
+			volumeCap:    blockCap,
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockMounter := mounter.NewMockMounter(ctrl)
+			mockMetadata := metadata.NewMockMetadataService(ctrl)
+			mockMetadata.EXPECT().GetRegion().Return("us-west-2").AnyTimes()
+			mockMounter.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(devicePath, nil).AnyTimes()
+			mockMounter.EXPECT().PathExists(gomock.Eq(stagingPath)).Return(true, nil).AnyTimes()
+			if tc.setup != nil {
+				tc.setup(mockMounter)
+			}
+
+			secrets := tc.secrets
+			if secrets == nil {
+				secrets = map[string]string{DefaultLuksPassphraseSecretKey: passphrase}
+			}
+
+			driver := &NodeService{
+				metadata:       mockMetadata,
+				mounter:        mockMounter,
+				deviceResolver: mockMounter,
+				inFlight:       internal.NewInFlight(),
+				staged:         internal.NewStagingRegistry(),
+				options:        &Options{},
+				clock:          clock.RealClock{},
+			}
+
+			_, err := driver.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+				VolumeId:          volumeID,
+				StagingTargetPath: stagingPath,
+				VolumeCapability:  tc.volumeCap,
+				VolumeContext:     map[string]string{EncryptedKey: "true"},
+				PublishContext:    map[string]string{DevicePathKey: devicePath},
+				Secrets:           secrets,
+			})
+			if status.Code(err) != tc.expectedCode {
+				t.Fatalf("Expected code %v, got error %v", tc.expectedCode, err)
+			}
+		})
+	}
+}
+
+func TestNodeUnstageVolumeLuks(t *testing.T) {
+	testCases := []struct {
+		name         string
+		device       string
+		closeErr     error
+		expectedCode codes.Code
+	}{
+		{
+			name:   "LUKS device closed after unmount",
+			device: "/dev/mapper/ebs-luks-vol-test",
+		},
+		{
+			name:   "LUKS device closed when the staging path is not mounted",
+			device: "",
+		},
+		{
+			name:         "close failure",
+			device:       "/dev/mapper/ebs-luks-vol-test",
+			closeErr:     errors.New("Device ebs-luks-vol-test is still in use"),
+			expectedCode: codes.Internal,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockMounter := mounter.NewMockMounter(ctrl)
+			refCount := 0
+			if tc.device != "" {
+				refCount = 1
+			}
+			calls := []*gomock.Call{
+				mockMounter.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return(tc.device, refCount, nil),
+			}
+			if refCount > 0 {
+				calls = append(calls, mockMounter.EXPECT().Unstage(gomock.Eq("/staging/path")).Return(nil))
+			}
+			calls = append(calls, mockMounter.EXPECT().LuksClose(gomock.Eq("ebs-luks-vol-test")).Return(tc.closeErr))
+			gomock.InOrder(calls...)
+
+			driver := &NodeService{
+				mounter:        mockMounter,
+				deviceResolver: mockMounter,
+				inFlight:       internal.NewInFlight(),
+				staged:         internal.NewStagingRegistry(),
+				options:        &Options{},
+			}
+
+			_, err := driver.NodeUnstageVolume(context.Background(), &csi.NodeUnstageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+			})
+			if status.Code(err) != tc.expectedCode {
+				t.Fatalf("Expected code %v, got error %v", tc.expectedCode, err)
+			}
+		})
+	}
+}
+
+func TestNodeExpandVolumeLuks(t *testing.T) {
+	testCases := []struct {
+		name         string
+		resizeErr    error
+		expectedCode codes.Code
+	}{
+		{
+			name: "LUKS device resized before the filesystem",
+		},
+		{
+			name:         "resize failure",
+			resizeErr:    errors.New("Device ebs-luks-vol-test not found"),
+			expectedCode: codes.Internal,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mapperPath := "/dev/mapper/ebs-luks-vol-test"
+			mockMounter := mounter.NewMockMounter(ctrl)
+			calls := []*gomock.Call{
+				mockMounter.EXPECT().IsBlockDevice(gomock.Eq("/volume/path")).Return(false, nil),
+				mockMounter.EXPECT().GetDeviceNameFromMount(gomock.Eq("/volume/path")).Return(mapperPath, 1, nil),
+				mockMounter.EXPECT().LuksResize(gomock.Eq("ebs-luks-vol-test")).Return(tc.resizeErr),
+			}
+			if tc.resizeErr == nil {
+				calls = append(calls,
+					mockMounter.EXPECT().Resize(gomock.Eq(mapperPath), gomock.Eq("/volume/path")).Return(true, nil),
+					mockMounter.EXPECT().GetBlockSizeBytes(gomock.Eq(mapperPath)).Return(int64(1024), nil),
+				)
+			}
+			gomock.InOrder(calls...)
+
+			driver := &NodeService{
+				mounter:        mockMounter,
+				deviceResolver: mockMounter,
+				inFlight:       internal.NewInFlight(),
+				staged:         internal.NewStagingRegistry(),
+				options:        &Options{},
+			}
+
+			_, err := driver.NodeExpandVolume(context.Background(), &csi.NodeExpandVolumeRequest{
+				VolumeId:   "vol-test",
+				VolumePath: "/volume/path",
+			})
+			if status.Code(err) != tc.expectedCode {
+				t.Fatalf("Expected code %v, got error %v", tc.expectedCode, err)
+			}
+		})
+	}
+}
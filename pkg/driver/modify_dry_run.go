@@ -0,0 +1,104 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// ModifyVolumeDryRunResult is the expected outcome of modifying the EBS volume of one PersistentVolume
+type ModifyVolumeDryRunResult struct {
+	PersistentVolume string
+	VolumeID         string
+	Verdict          cloud.ModifyDiskVerdict
+	Reason           string
+}
+
+// ModifyVolumeDryRun reports whether EC2 is expected to accept modifying the volumes of the PersistentVolumes
+// provisioned by the driver that match selector with the parameters of a VolumeAttributesClass.
+// The parameters are parsed like ModifyVolumeProperties does, but no volume is modified.
+func ModifyVolumeDryRun(ctx context.Context, c cloud.Cloud, k kubernetes.Interface, parameters map[string]string, selector string) ([]ModifyVolumeDryRunResult, error) {
+	modifyRequest, err := parseModifyVolumeParameters(parameters)
+	if err != nil {
+		return nil, err
+	}
+	options := &modifyRequest.modifyDiskOptions
+
+	pvs, err := k.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list persistent volumes: %w", err)
+	}
+
+	var results []ModifyVolumeDryRunResult
+	for _, pv := range pvs.Items {
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != DriverName {
+			continue
+		}
+		result := ModifyVolumeDryRunResult{
+			PersistentVolume: pv.Name,
+			VolumeID:         pv.Spec.CSI.VolumeHandle,
+		}
+		dryRun, err := c.DryRunModifyDisk(ctx, result.VolumeID, options)
+		if err != nil {
+			klog.V(4).InfoS("Failed to dry run volume modification", "pv", pv.Name, "volumeID", result.VolumeID, "err", err)
+			result.Verdict, result.Reason = cloud.ModifyDiskVerdictError, err.Error()
+		} else {
+			result.Verdict, result.Reason = dryRun.Verdict, dryRun.Reason
+		}
+		results = append(results, result)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].PersistentVolume < results[j].PersistentVolume
+	})
+	return results, nil
+}
+
+// WriteModifyVolumeDryRunReport writes one line per result, followed by the number of volumes with each verdict
+func WriteModifyVolumeDryRunReport(w io.Writer, results []ModifyVolumeDryRunResult) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PERSISTENTVOLUME\tVOLUMEID\tVERDICT\tREASON")
+	counts := map[cloud.ModifyDiskVerdict]int{}
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.PersistentVolume, r.VolumeID, r.Verdict, r.Reason)
+		counts[r.Verdict]++
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	verdicts := make([]string, 0, len(counts))
+	for verdict := range counts {
+		verdicts = append(verdicts, string(verdict))
+	}
+	sort.Strings(verdicts)
+	fmt.Fprintf(w, "\n%d volumes", len(results))
+	for _, verdict := range verdicts {
+		fmt.Fprintf(w, ", %d %s", counts[cloud.ModifyDiskVerdict(verdict)], verdict)
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
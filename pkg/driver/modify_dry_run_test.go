@@ -0,0 +1,120 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newDryRunPersistentVolume(name, driver, volumeID string, labels map[string]string) *v1.PersistentVolume {
+	return &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				CSI: &v1.CSIPersistentVolumeSource{Driver: driver, VolumeHandle: volumeID},
+			},
+		},
+	}
+}
+
+func TestModifyVolumeDryRun(t *testing.T) {
+	rollout := map[string]string{"rollout": "gp3"}
+	pvs := []*v1.PersistentVolume{
+		newDryRunPersistentVolume("pv-ok", DriverName, "vol-ok", rollout),
+		newDryRunPersistentVolume("pv-no-change", DriverName, "vol-no-change", rollout),
+		newDryRunPersistentVolume("pv-in-progress", DriverName, "vol-in-progress", rollout),
+		newDryRunPersistentVolume("pv-cooldown", DriverName, "vol-cooldown", rollout),
+		newDryRunPersistentVolume("pv-invalid-type", DriverName, "vol-invalid-type", rollout),
+		newDryRunPersistentVolume("pv-invalid-ratio", DriverName, "vol-invalid-ratio", rollout),
+		newDryRunPersistentVolume("pv-error", DriverName, "vol-error", rollout),
+		newDryRunPersistentVolume("pv-other-driver", "other.csi.example.com", "vol-other", rollout),
+		newDryRunPersistentVolume("pv-unselected", DriverName, "vol-unselected", nil),
+	}
+	verdicts := map[string]cloud.ModifyDiskVerdict{
+		"vol-ok":            cloud.ModifyDiskVerdictOK,
+		"vol-no-change":     cloud.ModifyDiskVerdictNoChange,
+		"vol-in-progress":   cloud.ModifyDiskVerdictInProgress,
+		"vol-cooldown":      cloud.ModifyDiskVerdictCooldown,
+		"vol-invalid-type":  cloud.ModifyDiskVerdictInvalidType,
+		"vol-invalid-ratio": cloud.ModifyDiskVerdictInvalidRatio,
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientset := fake.NewSimpleClientset()
+	for _, pv := range pvs {
+		if _, err := clientset.CoreV1().PersistentVolumes().Create(context.Background(), pv, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("Failed to create persistent volume: %v", err)
+		}
+	}
+
+	expectedOptions := &cloud.ModifyDiskOptions{VolumeType: "gp3", IOPS: 4000}
+	mockCloud := cloud.NewMockCloud(ctrl)
+	for volumeID, verdict := range verdicts {
+		mockCloud.EXPECT().DryRunModifyDisk(gomock.Any(), volumeID, gomock.Eq(expectedOptions)).Return(&cloud.ModifyDiskDryRun{Verdict: verdict, Reason: string(verdict) + " reason"}, nil)
+	}
+	mockCloud.EXPECT().DryRunModifyDisk(gomock.Any(), "vol-error", gomock.Eq(expectedOptions)).Return(nil, errors.New("DescribeVolumes failed"))
+
+	results, err := ModifyVolumeDryRun(context.Background(), mockCloud, clientset, map[string]string{ModificationKeyVolumeType: "gp3", ModificationKeyIOPS: "4000"}, "rollout=gp3")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []ModifyVolumeDryRunResult{
+		{PersistentVolume: "pv-cooldown", VolumeID: "vol-cooldown", Verdict: cloud.ModifyDiskVerdictCooldown, Reason: "cooldown reason"},
+		{PersistentVolume: "pv-error", VolumeID: "vol-error", Verdict: cloud.ModifyDiskVerdictError, Reason: "DescribeVolumes failed"},
+		{PersistentVolume: "pv-in-progress", VolumeID: "vol-in-progress", Verdict: cloud.ModifyDiskVerdictInProgress, Reason: "in-progress reason"},
+		{PersistentVolume: "pv-invalid-ratio", VolumeID: "vol-invalid-ratio", Verdict: cloud.ModifyDiskVerdictInvalidRatio, Reason: "invalid-ratio reason"},
+		{PersistentVolume: "pv-invalid-type", VolumeID: "vol-invalid-type", Verdict: cloud.ModifyDiskVerdictInvalidType, Reason: "invalid-type reason"},
+		{PersistentVolume: "pv-no-change", VolumeID: "vol-no-change", Verdict: cloud.ModifyDiskVerdictNoChange, Reason: "no-change reason"},
+		{PersistentVolume: "pv-ok", VolumeID: "vol-ok", Verdict: cloud.ModifyDiskVerdictOK, Reason: "ok reason"},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("Unexpected results:\ngot  %+v\nwant %+v", results, expected)
+	}
+
+	var report bytes.Buffer
+	if err := WriteModifyVolumeDryRunReport(&report, results); err != nil {
+		t.Fatalf("Unexpected error writing report: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(report.String()), "\n")
+	if len(lines) != len(expected)+3 {
+		t.Fatalf("Expected %d report lines, got %d:\n%s", len(expected)+3, len(lines), report.String())
+	}
+	if summary := lines[len(lines)-1]; summary != "7 volumes, 1 cooldown, 1 error, 1 in-progress, 1 invalid-ratio, 1 invalid-type, 1 no-change, 1 ok" {
+		t.Errorf("Unexpected report summary: %q", summary)
+	}
+}
+
+func TestModifyVolumeDryRunInvalidParameters(t *testing.T) {
+	_, err := ModifyVolumeDryRun(context.Background(), nil, fake.NewSimpleClientset(), map[string]string{ModificationKeyIOPS: "many"}, "")
+	if err == nil {
+		t.Fatal("Expected error for unparsable parameters")
+	}
+}
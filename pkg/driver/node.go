@@ -19,39 +19,73 @@ package driver
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	csi "github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud"
 	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud/metadata"
 	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/driver/internal"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/metrics"
 	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/mounter"
 	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/util"
+	"golang.org/x/sync/semaphore"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	"k8s.io/kubernetes/pkg/volume"
+	"k8s.io/utils/clock"
 )
 
 const (
-	// default file system type to be used when it is not provided
+	// default file system type to be used when it is not provided, unless overridden by --default-fstype
 	defaultFsType = FSTypeExt4
 
 	// VolumeOperationAlreadyExists is message fmt returned to CO when there is another in-flight call on the given volumeID
 	VolumeOperationAlreadyExists = "An operation with the given volume=%q is already in progress"
 
+	// ErrorReasonDeviceNotFound, ErrorReasonFormatFailed, ErrorReasonOperationInProgress and ErrorReasonStagingPathConflict
+	// are the ErrorInfo reasons attached to the corresponding node operation failures
+	ErrorReasonDeviceNotFound      = "DEVICE_NOT_FOUND"
+	ErrorReasonFormatFailed        = "FORMAT_FAILED"
+	ErrorReasonOperationInProgress = "OPERATION_IN_PROGRESS"
+	ErrorReasonStagingPathConflict = "STAGING_PATH_CONFLICT"
+	ErrorReasonMemoryBackedTarget  = "MEMORY_BACKED_TARGET"
+	ErrorReasonReadOnlyFilesystem  = "READ_ONLY_FILESYSTEM"
+	ErrorReasonLuksFailed          = "LUKS_FAILED"
+	ErrorReasonInstanceInterrupted = "INSTANCE_INTERRUPTED"
+	ErrorReasonFsTypeMismatch      = "FSTYPE_MISMATCH"
+
+	// ErrorInfoOperationKey and ErrorInfoVolumeIDKey are the ErrorInfo metadata keys for the failing operation and volume ID
+	ErrorInfoOperationKey = "operation"
+	ErrorInfoVolumeIDKey  = "volumeID"
+
 	// sbeDeviceVolumeAttachmentLimit refers to the maximum number of volumes that can be attached to an instance on snow.
 	sbeDeviceVolumeAttachmentLimit = 10
+
+	// stagingPathName and volDataFileName are the last element of the staging paths created by kubelet and the file
+	// in which kubelet records the driver and volume next to them
+	stagingPathName = "globalmount"
+	volDataFileName = "vol_data.json"
 )
 
 var (
@@ -72,6 +106,22 @@ var (
 		csi.NodeServiceCapability_RPC_GET_VOLUME_STATS,
 	}
 
+	// errNodeDraining is returned for new volume operations once the node service is draining, see NodeService.Drain
+	errNodeDraining = status.Error(codes.Unavailable, "Node service is shutting down and does not accept new volume operations")
+
+	// pathIsMemoryBacked checks if a path resides on a tmpfs or ramfs filesystem, overridden in tests
+	pathIsMemoryBacked = mounter.IsMemoryBackedPath
+	// mountIsReadOnly checks if the filesystem mounted at a path is mounted read-only, overridden in tests
+	mountIsReadOnly = mounter.IsMountedReadOnly
+
+	// instanceTypeLookupTimeout is the timeout of the EC2 API lookup of an instance type missing from the volume limit tables
+	instanceTypeLookupTimeout = 30 * time.Second
+	// volumeAttachmentLookupTimeout is the timeout of the EC2 API lookup of the volumes attached to the instance
+	volumeAttachmentLookupTimeout = 30 * time.Second
+	// readinessCheckPath is the directory whose existence the mounter must confirm before the node service is ready
+	readinessCheckPath = string(filepath.Separator)
+	// probeMountsPath is the file the mounter must find at every Probe, the root directory is used on Windows instead
+	probeMountsPath = "/proc/mounts"
 	// taintRemovalInitialDelay is the initial delay for node taint removal
 	taintRemovalInitialDelay = 1 * time.Second
 	// taintRemovalBackoff is the exponential backoff configuration for node taint removal
@@ -82,29 +132,188 @@ var (
 	}
 )
 
+// DeviceResolver resolves the local path of the block device backing a volume attached to the node.
+// The node's Mounter is the default implementation.
+type DeviceResolver interface {
+	FindDevicePath(devicePath, volumeID, partition, region string) (string, error)
+}
+
 // NodeService represents the node service of CSI driver
 type NodeService struct {
-	metadata metadata.MetadataService
-	mounter  mounter.Mounter
-	inFlight *internal.InFlight
-	options  *Options
+	cloud          cloud.Cloud
+	metadata       metadata.MetadataService
+	mounter        mounter.Mounter
+	deviceResolver DeviceResolver
+	formatter      mounter.Formatter
+	inFlight       *internal.InFlight
+	staged         *internal.StagingRegistry
+	options        *Options
+	clock          clock.Clock
+	// attachedVolumesLabels are the labels of AttachedVolumesMetric, nil when the metric is not recorded
+	attachedVolumesLabels map[string]string
+	// auditLogger records the node RPCs on volumes, see auditInterceptor
+	auditLogger AuditLogger
+	// formatSemaphore limits the formats running at once to --max-concurrent-format, nil when unlimited
+	formatSemaphore *semaphore.Weighted
+	// formatDefaults are the default formatting options of each filesystem type read from --format-defaults-file
+	formatDefaults FormatDefaults
+
+	// instanceTypeOnce guards the EC2 API lookup of an instance type missing from the built-in volume limit tables
+	instanceTypeOnce sync.Once
+	instanceTypeInfo *cloud.InstanceTypeInfo
+	// volumeAttachmentsOnce guards the EC2 API lookup of the volumes attached to the instance outside of the driver
+	volumeAttachmentsOnce   sync.Once
+	nonCSIVolumeAttachments int
+
+	// ready is set once IsReady has succeeded, after which the checks are not run again
+	ready atomic.Bool
+	// interruptionTime is when the instance will be stopped or terminated, nil until an interruption notice is found
+	interruptionTime atomic.Pointer[time.Time]
+	// stopInterruptionWatch stops watching interruption notices, nil when they are not watched
+	stopInterruptionWatch context.CancelFunc
+
+	// k8sClient is used to reconcile the CSINode allocatable count, nil without a Kubernetes client
+	k8sClient kubernetes.Interface
+	// eventRecorder records the events of the node, nil without a Kubernetes client
+	eventRecorder record.EventRecorder
+	// allocatableMux guards reconciledAllocatable, the last limit found in or patched into the CSINode
+	allocatableMux        sync.Mutex
+	reconciledAllocatable *int64
 }
 
 // NewNodeService creates a new node service
-func NewNodeService(o *Options, md metadata.MetadataService, m mounter.Mounter, k kubernetes.Interface) *NodeService {
+func NewNodeService(c cloud.Cloud, o *Options, md metadata.MetadataService, m mounter.Mounter, k kubernetes.Interface) *NodeService {
+	eventRecorder := newEventRecorder(k, os.Getenv("CSI_NODE_NAME"))
 	if k != nil {
 		// Remove taint from node to indicate driver startup success
 		// This is done at the last possible moment to prevent race conditions or false positive removals
 		time.AfterFunc(taintRemovalInitialDelay, func() {
-			removeTaintInBackground(k, taintRemovalBackoff, removeNotReadyTaint)
+			removeTaintInBackground(k, taintRemovalBackoff, func(clientset kubernetes.Interface) (bool, error) {
+				return removeNotReadyTaint(clientset, eventRecorder, o.StartupTaintKeys)
+			})
+		})
+	}
+
+	formatter := o.Formatter
+	if formatter == nil {
+		formatter = mounter.NewFormatter(m)
+	}
+
+	nodeService := &NodeService{
+		cloud:          c,
+		metadata:       md,
+		mounter:        m,
+		deviceResolver: m,
+		formatter:      formatter,
+		inFlight:       internal.NewInFlight(),
+		staged:         internal.NewStagingRegistry(),
+		options:        o,
+		clock:          clock.RealClock{},
+		attachedVolumesLabels: map[string]string{
+			"node_name":     os.Getenv("CSI_NODE_NAME"),
+			"instance_type": md.GetInstanceType(),
+		},
+		auditLogger:   NoopAuditLogger{},
+		k8sClient:     k,
+		eventRecorder: eventRecorder,
+	}
+	if o.MaxConcurrentFormat > 0 {
+		nodeService.formatSemaphore = semaphore.NewWeighted(o.MaxConcurrentFormat)
+	}
+
+	if o.DiagnosticMountsDir != "" {
+		nodeService.cleanupDiagnosticMounts()
+	}
+
+	if o.WatchInterruptionNotices || o.SpotInterruptionGrace > 0 {
+		var ctx context.Context
+		ctx, nodeService.stopInterruptionWatch = context.WithCancel(context.Background())
+		go nodeService.watchInterruptionNotices(ctx)
+	}
+
+	if k != nil && o.ReconcileCSINodeAllocatable {
+		time.AfterFunc(taintRemovalInitialDelay, func() {
+			if err := nodeService.reconcileCSINodeAllocatable(k, nodeService.getVolumesLimit()); err != nil {
+				klog.ErrorS(err, "Failed to reconcile CSINode allocatable count")
+			}
 		})
 	}
 
-	return &NodeService{
-		metadata: md,
-		mounter:  m,
-		inFlight: internal.NewInFlight(),
-		options:  o,
+	return nodeService
+}
+
+// Drain stops the node service from accepting new volume operations, which fail with Unavailable, and blocks until
+// the operations in flight have finished or ctx is done. Interruption notices are no longer watched.
+func (d *NodeService) Drain(ctx context.Context) error {
+	klog.InfoS("Draining node service, new volume operations are rejected")
+	if d.stopInterruptionWatch != nil {
+		d.stopInterruptionWatch()
+	}
+	if err := d.inFlight.Drain(ctx); err != nil {
+		return fmt.Errorf("volume operations still in flight: %w", err)
+	}
+	klog.InfoS("Node service drained")
+	return nil
+}
+
+// IsReady reports whether the node service can serve volume operations: the instance metadata has been loaded and
+// the mounter passes a self-test. Once ready, the node service stays ready.
+func (d *NodeService) IsReady() bool {
+	if d.ready.Load() {
+		return true
+	}
+	if d.metadata == nil || d.metadata.GetInstanceID() == "" || d.metadata.GetRegion() == "" {
+		klog.V(4).InfoS("Node service not ready: instance metadata not loaded")
+		return false
+	}
+	exists, err := d.mounter.PathExists(readinessCheckPath)
+	if err != nil || !exists {
+		klog.V(4).InfoS("Node service not ready: mounter self-test failed", "path", readinessCheckPath, "exists", exists, "err", err)
+		return false
+	}
+	if d.ready.CompareAndSwap(false, true) {
+		klog.InfoS("Node service is ready")
+	}
+	return true
+}
+
+// checkHealth verifies at every Probe that the instance metadata returns a region and that the mounter finds
+// probeMountsPath, within --probe-timeout. The checks run in the background, so that a mounter blocked by a hung mount
+// fails the probe instead of blocking it.
+func (d *NodeService) checkHealth(ctx context.Context) error {
+	if d.options.ProbeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.options.ProbeTimeout)
+		defer cancel()
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		if d.metadata.GetRegion() == "" {
+			result <- errors.New("instance metadata returned an empty region")
+			return
+		}
+		path := probeMountsPath
+		if runtime.GOOS == "windows" {
+			path = readinessCheckPath
+		}
+		exists, err := d.mounter.PathExists(path)
+		if err != nil {
+			result <- fmt.Errorf("mounter could not check %s: %w", path, err)
+			return
+		}
+		if !exists {
+			result <- fmt.Errorf("mounter could not find %s", path)
+			return
+		}
+		result <- nil
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("health checks did not finish: %w", ctx.Err())
 	}
 }
 
@@ -134,9 +343,17 @@ func (d *NodeService) NodeStageVolume(ctx context.Context, req *csi.NodeStageVol
 		return nil, status.Error(codes.InvalidArgument, "Volume Attribute is not valid")
 	}
 
+	encrypted, passphrase, err := parseLuksOptions(volumeContext, req.GetSecrets())
+	if err != nil {
+		return nil, err
+	}
+
 	// If the access type is block, do nothing for stage
 	switch volCap.GetAccessType().(type) {
 	case *csi.VolumeCapability_Block:
+		if encrypted {
+			return nil, status.Error(codes.InvalidArgument, "LUKS encryption is only supported for volumes with the mount access type")
+		}
 		return &csi.NodeStageVolumeResponse{}, nil
 	}
 
@@ -147,68 +364,133 @@ func (d *NodeService) NodeStageVolume(ctx context.Context, req *csi.NodeStageVol
 
 	fsType := mountVolume.GetFsType()
 	if len(fsType) == 0 {
-		fsType = defaultFsType
+		fsType = d.defaultFsType()
 	}
 
 	_, ok := ValidFSTypes[strings.ToLower(fsType)]
 	if !ok {
 		return nil, status.Errorf(codes.InvalidArgument, "NodeStageVolume: invalid fstype %s", fsType)
 	}
+	volumeContext = d.formatDefaults.apply(fsType, volumeContext)
 
-	context := req.GetVolumeContext()
-
-	blockSize, err := recheckFormattingOptionParameter(context, BlockSizeKey, FileSystemConfigs, fsType)
+	blockSize, err := recheckFormattingOptionParameter(volumeContext, BlockSizeKey, FileSystemConfigs, fsType)
+	if err != nil {
+		return nil, err
+	}
+	inodeSize, err := recheckFormattingOptionParameter(volumeContext, InodeSizeKey, FileSystemConfigs, fsType)
+	if err != nil {
+		return nil, err
+	}
+	bytesPerInode, err := recheckFormattingOptionParameter(volumeContext, BytesPerInodeKey, FileSystemConfigs, fsType)
 	if err != nil {
 		return nil, err
 	}
-	inodeSize, err := recheckFormattingOptionParameter(context, InodeSizeKey, FileSystemConfigs, fsType)
+	numInodes, err := recheckFormattingOptionParameter(volumeContext, NumberOfInodesKey, FileSystemConfigs, fsType)
 	if err != nil {
 		return nil, err
 	}
-	bytesPerInode, err := recheckFormattingOptionParameter(context, BytesPerInodeKey, FileSystemConfigs, fsType)
+	ext4BigAlloc, err := recheckFormattingOptionParameter(volumeContext, Ext4BigAllocKey, FileSystemConfigs, fsType)
 	if err != nil {
 		return nil, err
 	}
-	numInodes, err := recheckFormattingOptionParameter(context, NumberOfInodesKey, FileSystemConfigs, fsType)
+	ext4ClusterSize, err := recheckFormattingOptionParameter(volumeContext, Ext4ClusterSizeKey, FileSystemConfigs, fsType)
 	if err != nil {
 		return nil, err
 	}
-	ext4BigAlloc, err := recheckFormattingOptionParameter(context, Ext4BigAllocKey, FileSystemConfigs, fsType)
+	ext4Stride, err := recheckFormattingOptionParameter(volumeContext, Ext4StrideKey, FileSystemConfigs, fsType)
 	if err != nil {
 		return nil, err
 	}
-	ext4ClusterSize, err := recheckFormattingOptionParameter(context, Ext4ClusterSizeKey, FileSystemConfigs, fsType)
+	ext4StripeWidth, err := recheckFormattingOptionParameter(volumeContext, Ext4StripeWidthKey, FileSystemConfigs, fsType)
+	if err != nil {
+		return nil, err
+	}
+	if err = validateExt4StripeOptions(ext4Stride, ext4StripeWidth); err != nil {
+		return nil, err
+	}
+	ext4LazyInit, err := recheckFormattingOptionParameter(volumeContext, Ext4LazyInitKey, FileSystemConfigs, fsType)
+	if err != nil {
+		return nil, err
+	}
+	var lazyInit bool
+	if len(ext4LazyInit) > 0 {
+		if lazyInit, err = strconv.ParseBool(ext4LazyInit); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid %s (%s): must be true or false", Ext4LazyInitKey, ext4LazyInit)
+		}
+	}
+	ntfsOptions, err := parseNTFSFormatOptions(volumeContext, fsType)
+	if err != nil {
+		return nil, err
+	}
+	xfsProjectQuota, _, err := parseXFSProjectQuota(volumeContext, fsType)
+	if err != nil {
+		return nil, err
+	}
+	xfsMetadataOptions, err := parseXFSMetadataOptions(volumeContext, fsType)
+	if err != nil {
+		return nil, err
+	}
+	ext4JournalOptions, err := parseExt4JournalOptions(volumeContext, fsType)
+	if err != nil {
+		return nil, err
+	}
+	externalFs, err := parseExternalFsManagement(volumeContext)
 	if err != nil {
 		return nil, err
 	}
 
 	mountOptions := collectMountOptions(fsType, mountVolume.GetMountFlags())
+	// Quota options only take effect when the filesystem is mounted, so pquota is set at stage rather than
+	// on the bind mounts created by NodePublishVolume
+	if xfsProjectQuota && !hasMountOption(mountOptions, "pquota") {
+		mountOptions = append(mountOptions, "pquota")
+	}
+	// The kernel refuses to mount ext4 with journal_async_commit in data=journal mode
+	if hasMountOption(ext4JournalOptions, "journal_async_commit") && hasMountOption(mountOptions, "data=journal") {
+		return nil, status.Errorf(codes.InvalidArgument, "Cannot use %s with the data=journal mount option", Ext4AsyncCommitKey)
+	}
+	for _, opt := range ext4JournalOptions {
+		if !hasMountOption(mountOptions, opt) {
+			mountOptions = append(mountOptions, opt)
+		}
+	}
+
+	if interruptionTime, ok := d.imminentInterruption(); ok {
+		msg := fmt.Sprintf("instance is due to be interrupted at %s, new volumes are not staged", interruptionTime.Format(time.RFC3339))
+		return nil, newNodeError(codes.Unavailable, ErrorReasonInstanceInterrupted, "NodeStageVolume", volumeID, msg)
+	}
 
 	if ok = d.inFlight.Insert(volumeID); !ok {
-		return nil, status.Errorf(codes.Aborted, VolumeOperationAlreadyExists, volumeID)
+		if d.inFlight.Draining() {
+			return nil, errNodeDraining
+		}
+		return nil, newNodeError(codes.Aborted, ErrorReasonOperationInProgress, "NodeStageVolume", volumeID, fmt.Sprintf(VolumeOperationAlreadyExists, volumeID))
 	}
 	defer func() {
 		klog.V(4).InfoS("NodeStageVolume: volume operation finished", "volumeID", volumeID)
 		d.inFlight.Delete(volumeID)
 	}()
 
+	if err = d.checkStagingPathConflict(volumeID, target); err != nil {
+		return nil, err
+	}
+
 	devicePath, ok := req.GetPublishContext()[DevicePathKey]
 	if !ok {
 		return nil, status.Error(codes.InvalidArgument, "Device path not provided")
 	}
 
-	partition := ""
-	if part, ok := volumeContext[VolumeAttributePartition]; ok {
-		if part != "0" {
-			partition = part
-		} else {
-			klog.InfoS("NodeStageVolume: invalid partition config, will ignore.", "partition", part)
-		}
+	partition, err := getPartition("NodeStageVolume", volumeContext)
+	if err != nil {
+		return nil, err
 	}
 
-	source, err := d.mounter.FindDevicePath(devicePath, volumeID, partition, d.metadata.GetRegion())
+	source, waited, err := d.waitForDevicePath(ctx, devicePath, volumeID, partition)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "Failed to find device path %s. %v", devicePath, err)
+		if timeout, _ := d.options.deviceDiscoveryWait(); timeout > 0 {
+			return nil, newNodeError(codes.NotFound, ErrorReasonDeviceNotFound, "NodeStageVolume", volumeID, fmt.Sprintf("Failed to find device path %s after waiting %v. %v", devicePath, waited, err))
+		}
+		return nil, newNodeError(codes.Internal, ErrorReasonDeviceNotFound, "NodeStageVolume", volumeID, fmt.Sprintf("Failed to find device path %s. %v", devicePath, err))
 	}
 
 	klog.V(4).InfoS("NodeStageVolume: find device path", "devicePath", devicePath, "source", source)
@@ -229,6 +511,15 @@ func (d *NodeService) NodeStageVolume(ctx context.Context, req *csi.NodeStageVol
 		}
 	}
 
+	// Encrypted volumes are formatted and mounted through their opened LUKS device rather than the device itself
+	stageSource := source
+	if encrypted {
+		stageSource, err = d.openLuksDevice(source, volumeID, passphrase)
+		if err != nil {
+			return nil, newNodeError(codes.Internal, ErrorReasonLuksFailed, "NodeStageVolume", volumeID, err.Error())
+		}
+	}
+
 	// Check if a device is mounted in target directory
 	device, _, err := d.mounter.GetDeviceNameFromMount(target)
 	if err != nil {
@@ -239,14 +530,22 @@ func (d *NodeService) NodeStageVolume(ctx context.Context, req *csi.NodeStageVol
 	// This operation (NodeStageVolume) MUST be idempotent.
 	// If the volume corresponding to the volume_id is already staged to the staging_target_path,
 	// and is identical to the specified volume_capability the Plugin MUST reply 0 OK.
-	klog.V(4).InfoS("NodeStageVolume: checking if volume is already staged", "device", device, "source", source, "target", target)
-	if device == source {
+	klog.V(4).InfoS("NodeStageVolume: checking if volume is already staged", "device", device, "source", stageSource, "target", target)
+	if d.isStagedDevice(device, stageSource, volumeID) {
 		klog.V(4).InfoS("NodeStageVolume: volume already staged", "volumeID", volumeID)
+		if err = setExternalFsManagement(target, externalFs); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		d.staged.Set(volumeID, target)
+		d.recordAttachedVolumes()
+		d.recordDevicePathHint(volumeID, partition, source)
+		d.mountDiagnostic(volumeID, target)
+		d.createDeviceSymlink(volumeID, source)
 		return &csi.NodeStageVolumeResponse{}, nil
 	}
 
 	// FormatAndMount will format only if needed
-	klog.V(4).InfoS("NodeStageVolume: staging volume", "source", source, "volumeID", volumeID, "target", target, "fstype", fsType)
+	klog.V(4).InfoS("NodeStageVolume: staging volume", "source", stageSource, "volumeID", volumeID, "target", target, "fstype", fsType)
 	formatOptions := []string{}
 	if len(blockSize) > 0 {
 		if fsType == FSTypeXfs {
@@ -273,24 +572,72 @@ func (d *NodeService) NodeStageVolume(ctx context.Context, req *csi.NodeStageVol
 	if len(ext4ClusterSize) > 0 {
 		formatOptions = append(formatOptions, "-C", ext4ClusterSize)
 	}
-	err = d.mounter.FormatAndMountSensitiveWithFormatOptions(source, target, fsType, mountOptions, nil, formatOptions)
-	if err != nil {
-		msg := fmt.Sprintf("could not format %q and mount it at %q: %v", source, target, err)
-		return nil, status.Error(codes.Internal, msg)
+	var extendedOptions []string
+	if len(ext4Stride) > 0 {
+		extendedOptions = append(extendedOptions, "stride="+ext4Stride)
+	}
+	if len(ext4StripeWidth) > 0 {
+		extendedOptions = append(extendedOptions, "stripe-width="+ext4StripeWidth)
+	}
+	if len(ext4LazyInit) > 0 {
+		// Without lazy initialization, mkfs zeroes the inode tables up front instead of in the background after mount
+		if lazyInit {
+			extendedOptions = append(extendedOptions, "lazy_itable_init=1", "lazy_journal_init=1")
+		} else {
+			extendedOptions = append(extendedOptions, "lazy_itable_init=0")
+		}
+	}
+	if len(extendedOptions) > 0 {
+		formatOptions = append(formatOptions, "-E", strings.Join(extendedOptions, ","))
+	}
+	formatOptions = append(formatOptions, xfsMetadataOptions...)
+	formatOptions = append(formatOptions, ntfsOptions.Args()...)
+	if err = d.checkExistingFormat(volumeID, stageSource, fsType); err != nil {
+		return nil, err
+	}
+	if d.formatSemaphore != nil {
+		if err = d.formatSemaphore.Acquire(ctx, 1); err != nil {
+			msg := fmt.Sprintf("gave up waiting for one of the %d formats in progress on the node to finish: %v", d.options.MaxConcurrentFormat, err)
+			return nil, newNodeError(codes.Aborted, ErrorReasonOperationInProgress, "NodeStageVolume", volumeID, msg)
+		}
+	}
+	err = d.format(ctx, stageSource, target, fsType, mountOptions, formatOptions)
+	if d.formatSemaphore != nil {
+		d.formatSemaphore.Release(1)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		msg := fmt.Sprintf("timed out formatting %q and mounting it at %q: %v", stageSource, target, err)
+		return nil, newNodeError(codes.DeadlineExceeded, ErrorReasonFormatFailed, "NodeStageVolume", volumeID, msg)
 	}
-
-	needResize, err := d.mounter.NeedResize(source, target)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "Could not determine if volume %q (%q) need to be resized:  %v", req.GetVolumeId(), source, err)
+		msg := fmt.Sprintf("could not format %q and mount it at %q: %v", stageSource, target, err)
+		return nil, newNodeError(codes.Internal, ErrorReasonFormatFailed, "NodeStageVolume", volumeID, msg)
 	}
 
-	if needResize {
-		klog.V(2).InfoS("Volume needs resizing", "source", source)
-		if _, err := d.mounter.Resize(source, target); err != nil {
-			return nil, status.Errorf(codes.Internal, "Could not resize volume %q (%q):  %v", volumeID, source, err)
+	if externalFs {
+		klog.V(4).InfoS("NodeStageVolume: filesystem is managed externally, not resizing it", "volumeID", volumeID)
+	} else {
+		needResize, err := d.mounter.NeedResize(stageSource, target)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Could not determine if volume %q (%q) need to be resized:  %v", req.GetVolumeId(), stageSource, err)
+		}
+
+		if needResize {
+			klog.V(2).InfoS("Volume needs resizing", "source", stageSource)
+			if _, err := d.mounter.Resize(stageSource, target); err != nil {
+				return nil, status.Errorf(codes.Internal, "Could not resize volume %q (%q):  %v", volumeID, stageSource, err)
+			}
 		}
 	}
-	klog.V(4).InfoS("NodeStageVolume: successfully staged volume", "source", source, "volumeID", volumeID, "target", target, "fstype", fsType)
+	if err = setExternalFsManagement(target, externalFs); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	d.staged.Set(volumeID, target)
+	d.recordAttachedVolumes()
+	d.recordDevicePathHint(volumeID, partition, source)
+	d.mountDiagnostic(volumeID, target)
+	d.createDeviceSymlink(volumeID, source)
+	klog.V(4).InfoS("NodeStageVolume: successfully staged volume", "source", stageSource, "volumeID", volumeID, "target", target, "fstype", fsType)
 	return &csi.NodeStageVolumeResponse{}, nil
 }
 
@@ -307,6 +654,9 @@ func (d *NodeService) NodeUnstageVolume(ctx context.Context, req *csi.NodeUnstag
 	}
 
 	if ok := d.inFlight.Insert(volumeID); !ok {
+		if d.inFlight.Draining() {
+			return nil, errNodeDraining
+		}
 		return nil, status.Errorf(codes.Aborted, VolumeOperationAlreadyExists, volumeID)
 	}
 	defer func() {
@@ -314,6 +664,9 @@ func (d *NodeService) NodeUnstageVolume(ctx context.Context, req *csi.NodeUnstag
 		d.inFlight.Delete(volumeID)
 	}()
 
+	// The diagnostic mount is another reference to the device, remove it first so that it never keeps the device mounted
+	d.unmountDiagnostic(volumeID)
+
 	// Check if target directory is a mount point. GetDeviceNameFromMount
 	// given a mnt point, finds the device from /proc/mounts
 	// returns the device name, reference count, and error code
@@ -328,11 +681,23 @@ func (d *NodeService) NodeUnstageVolume(ctx context.Context, req *csi.NodeUnstag
 	// reply 0 OK.
 	if refCount == 0 {
 		klog.V(5).InfoS("[Debug] NodeUnstageVolume: target not mounted", "target", target)
+		// The LUKS device may still be open, for example when a previous unstage failed after unmounting it
+		if err = d.closeLuksDevice(volumeID); err != nil {
+			return nil, newNodeError(codes.Internal, ErrorReasonLuksFailed, "NodeUnstageVolume", volumeID, err.Error())
+		}
+		if err = setExternalFsManagement(target, false); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		d.staged.Delete(volumeID, target)
+		d.recordAttachedVolumes()
+		removeDevicePathHint(d.options.DevicePathHintDir, volumeID)
+		d.removeDeviceSymlink(volumeID)
 		return &csi.NodeUnstageVolumeResponse{}, nil
 	}
 
 	if refCount > 1 {
 		klog.InfoS("NodeUnstageVolume: found references to device mounted at target path", "refCount", refCount, "device", dev, "target", target)
+		metrics.Recorder().IncreaseCount(NodeUnstageMultiRefMetric, map[string]string{"ref_count": refCountBucket(refCount)})
 	}
 
 	klog.V(4).InfoS("NodeUnstageVolume: unmounting", "target", target)
@@ -340,12 +705,25 @@ func (d *NodeService) NodeUnstageVolume(ctx context.Context, req *csi.NodeUnstag
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "Could not unmount target %q: %v", target, err)
 	}
+	if err = d.closeLuksDevice(volumeID); err != nil {
+		return nil, newNodeError(codes.Internal, ErrorReasonLuksFailed, "NodeUnstageVolume", volumeID, err.Error())
+	}
+	if err = setExternalFsManagement(target, false); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	d.staged.Delete(volumeID, target)
+	d.recordAttachedVolumes()
+	removeDevicePathHint(d.options.DevicePathHintDir, volumeID)
+	d.removeDeviceSymlink(volumeID)
 	klog.V(4).InfoS("NodeUnStageVolume: successfully unstaged volume", "volumeID", volumeID, "target", target)
 	return &csi.NodeUnstageVolumeResponse{}, nil
 }
 
 func (d *NodeService) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandVolumeRequest) (*csi.NodeExpandVolumeResponse, error) {
 	klog.V(4).InfoS("NodeExpandVolume: called", "args", util.SanitizeRequest(req))
+	if d.options.DisableNodeExpansion {
+		return nil, status.Error(codes.Unimplemented, "NodeExpandVolume is disabled by --disable-node-expansion")
+	}
 	volumeID := req.GetVolumeId()
 	if len(volumeID) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "Volume ID not provided")
@@ -355,6 +733,11 @@ func (d *NodeService) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandV
 		return nil, status.Error(codes.InvalidArgument, "volume path must be provided")
 	}
 
+	// CapacityRange is optional, if specified, the required bytes must be positive
+	if capRange := req.GetCapacityRange(); capRange != nil && capRange.GetRequiredBytes() <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid capacity range: required bytes must be positive, got %d", capRange.GetRequiredBytes())
+	}
+
 	volumeCapability := req.GetVolumeCapability()
 	// VolumeCapability is optional, if specified, use that as source of truth
 	if volumeCapability != nil {
@@ -391,9 +774,67 @@ func (d *NodeService) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandV
 		return nil, status.Errorf(codes.Internal, "failed to get device name from mount %s: %v", volumePath, err)
 	}
 
-	devicePath, err := d.mounter.FindDevicePath(deviceName, volumeID, "", d.metadata.GetRegion())
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to find device path for device name %s for mount %s: %v", deviceName, req.GetVolumePath(), err)
+	stagingTarget := req.GetStagingTargetPath()
+	if stagingTarget == "" {
+		stagingTarget, _ = d.staged.Get(volumeID)
+	}
+	if isExternalFsManaged(stagingTarget) {
+		bcap, err := d.mounter.GetBlockSizeBytes(deviceName)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to get block capacity on path %s: %v", deviceName, err)
+		}
+		klog.V(4).InfoS("NodeExpandVolume: filesystem is managed externally, not resizing it", "volumeID", volumeID, "volumePath", volumePath)
+		return &csi.NodeExpandVolumeResponse{CapacityBytes: bcap}, nil
+	}
+
+	// The filesystem of an encrypted volume is on its LUKS device, which the driver opened itself
+	luks := isLuksDevice(volumeID, deviceName)
+	devicePath := deviceName
+	var diskPath, partition string
+	if !luks {
+		// Device-mapper targets (e.g. LVM logical volumes built on top of a raw block PVC) are not managed by the driver,
+		// growing the EBS volume does not grow the logical volume, so resizing the filesystem would be a no-op at best
+		isDeviceMapper, err := d.mounter.IsDeviceMapper(deviceName)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to determine if device %s is a device-mapper target: %v", deviceName, err)
+		}
+		if isDeviceMapper {
+			return nil, status.Errorf(codes.FailedPrecondition, "device %s mounted at %s is a device-mapper target not managed by the driver; grow the underlying physical volume and logical volume (e.g. pvresize and lvextend) before resizing the filesystem", deviceName, volumePath)
+		}
+
+		// A volume staged with a partition has the partition mounted, which is the device to grow and resize
+		diskPath, partition, err = d.mounter.GetPartition(deviceName)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to determine if device %s is a partition: %v", deviceName, err)
+		}
+
+		devicePath, err = d.findDevicePath(deviceName, volumeID, partition, d.metadata.GetRegion())
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to find device path for device name %s for mount %s: %v", deviceName, req.GetVolumePath(), err)
+		}
+	}
+
+	if d.options.SnapshotBeforeExpand {
+		if err = d.snapshotBeforeExpand(ctx, volumeID, devicePath, req.GetCapacityRange().GetRequiredBytes()); err != nil {
+			return nil, status.Errorf(codes.Internal, "Could not snapshot volume %q before expanding it: %v", volumeID, err)
+		}
+	}
+
+	if luks {
+		// The LUKS device keeps the size of the volume it was opened on until it is resized
+		if err = d.mounter.LuksResize(luksMapperName(volumeID)); err != nil {
+			return nil, newNodeError(codes.Internal, ErrorReasonLuksFailed, "NodeExpandVolume", volumeID, err.Error())
+		}
+		klog.V(4).InfoS("NodeExpandVolume: resized LUKS device", "volumeID", volumeID, "devicePath", devicePath)
+	} else {
+		// Partitioned volumes need the partition extended before the filesystem on it can grow
+		grown, err := d.mounter.GrowPartition(diskPath, partition)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Could not grow partition %s of volume %q (%q): %v", partition, volumeID, diskPath, err)
+		}
+		if grown {
+			klog.V(4).InfoS("NodeExpandVolume: grew partition", "volumeID", volumeID, "diskPath", diskPath, "partition", partition)
+		}
 	}
 
 	// TODO: lock per volume ID to have some idempotency
@@ -415,8 +856,14 @@ func (d *NodeService) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 		return nil, status.Error(codes.InvalidArgument, "Volume ID not provided")
 	}
 
+	ephemeral, ephemeralSizeBytes, err := parseEphemeral(req.GetVolumeContext())
+	if err != nil {
+		return nil, err
+	}
+
+	// Ephemeral volumes are not staged
 	source := req.GetStagingTargetPath()
-	if len(source) == 0 {
+	if len(source) == 0 && !ephemeral {
 		return nil, status.Error(codes.InvalidArgument, "Staging target not provided")
 	}
 
@@ -435,13 +882,27 @@ func (d *NodeService) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 	}
 
 	if ok := d.inFlight.Insert(volumeID); !ok {
-		return nil, status.Errorf(codes.Aborted, VolumeOperationAlreadyExists, volumeID)
+		if d.inFlight.Draining() {
+			return nil, errNodeDraining
+		}
+		return nil, newNodeError(codes.Aborted, ErrorReasonOperationInProgress, "NodePublishVolume", volumeID, fmt.Sprintf(VolumeOperationAlreadyExists, volumeID))
 	}
 	defer func() {
 		klog.V(4).InfoS("NodePublishVolume: volume operation finished", "volumeId", volumeID)
 		d.inFlight.Delete(volumeID)
 	}()
 
+	if ephemeral {
+		if err := d.nodePublishEphemeralVolume(req, ephemeralSizeBytes); err != nil {
+			return nil, err
+		}
+		return &csi.NodePublishVolumeResponse{}, nil
+	}
+
+	if err := d.checkPublishTargetFilesystem(volumeID, target); err != nil {
+		return nil, err
+	}
+
 	mountOptions := []string{"bind"}
 	if req.GetReadonly() {
 		mountOptions = append(mountOptions, "ro")
@@ -474,6 +935,9 @@ func (d *NodeService) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpu
 	}
 
 	if ok := d.inFlight.Insert(volumeID); !ok {
+		if d.inFlight.Draining() {
+			return nil, errNodeDraining
+		}
 		return nil, status.Errorf(codes.Aborted, VolumeOperationAlreadyExists, volumeID)
 	}
 
@@ -499,6 +963,9 @@ func (d *NodeService) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVo
 	if len(req.GetVolumePath()) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "NodeGetVolumeStats volume path was empty")
 	}
+	if d.options.CSIMountPointPrefix != "" && !isUnderPathPrefix(req.GetVolumePath(), d.options.CSIMountPointPrefix) {
+		return nil, status.Errorf(codes.InvalidArgument, "NodeGetVolumeStats volume path %q is not under %q", req.GetVolumePath(), d.options.CSIMountPointPrefix)
+	}
 
 	exists, err := d.mounter.PathExists(req.GetVolumePath())
 	if err != nil {
@@ -558,6 +1025,9 @@ func (d *NodeService) NodeGetCapabilities(ctx context.Context, req *csi.NodeGetC
 	klog.V(4).InfoS("NodeGetCapabilities: called", "args", *req)
 	var caps []*csi.NodeServiceCapability
 	for _, cap := range nodeCaps {
+		if cap == csi.NodeServiceCapability_RPC_EXPAND_VOLUME && d.options.DisableNodeExpansion {
+			continue
+		}
 		c := &csi.NodeServiceCapability{
 			Type: &csi.NodeServiceCapability_Rpc{
 				Rpc: &csi.NodeServiceCapability_RPC{
@@ -573,6 +1043,14 @@ func (d *NodeService) NodeGetCapabilities(ctx context.Context, req *csi.NodeGetC
 func (d *NodeService) NodeGetInfo(ctx context.Context, req *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
 	klog.V(4).InfoS("NodeGetInfo: called", "args", *req)
 
+	if os.Getenv("CSI_NODE_NAME") == "" {
+		msg := "CSI_NODE_NAME environment variable is not set, node taints will not be removed and node events will not be recorded: check that the node plugin is deployed with CSI_NODE_NAME set from spec.nodeName"
+		if d.options.FailOnMetadataError {
+			return nil, status.Error(codes.FailedPrecondition, msg)
+		}
+		klog.InfoS("NodeGetInfo: " + msg)
+	}
+
 	zone := d.metadata.GetAvailabilityZone()
 	osType := runtime.GOOS
 
@@ -587,16 +1065,43 @@ func (d *NodeService) NodeGetInfo(ctx context.Context, req *csi.NodeGetInfoReque
 	// to my surprise ARN's string representation is not empty for empty ARN
 	if len(outpostArn.Resource) > 0 {
 		segments[AwsRegionKey] = outpostArn.Region
-		segments[AwsPartitionKey] = outpostArn.Partition
+		segments[AwsPartitionKey] = d.metadata.GetPartition()
 		segments[AwsAccountIDKey] = outpostArn.AccountID
 		segments[AwsOutpostIDKey] = outpostArn.Resource
 	}
 
+	if d.options.EnableInstanceTopology {
+		segments[InstanceTypeTopologyKey] = d.metadata.GetInstanceType()
+	}
+
+	if len(d.options.TopologyLabelTags) > 0 {
+		tags, err := d.metadata.GetInstanceTags(d.options.TopologyLabelTags)
+		if err != nil {
+			klog.ErrorS(err, "NodeGetInfo: failed to get instance tags, topology tag labels will not be advertised", "keys", d.options.TopologyLabelTags)
+		}
+		for key, value := range tags {
+			if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+				klog.InfoS("NodeGetInfo: skipping instance tag whose value is not a valid label value", "key", key, "value", value, "errs", errs)
+				continue
+			}
+			segments[InstanceTagTopologyKeyPrefix+key] = value
+		}
+	}
+
 	topology := &csi.Topology{Segments: segments}
 
+	limit := d.getVolumesLimit()
+	if d.k8sClient != nil && d.options.ReconcileCSINodeAllocatable {
+		go func() {
+			if err := d.reconcileCSINodeAllocatable(d.k8sClient, limit); err != nil {
+				klog.ErrorS(err, "NodeGetInfo: failed to reconcile CSINode allocatable count")
+			}
+		}()
+	}
+
 	return &csi.NodeGetInfoResponse{
 		NodeId:             d.metadata.GetInstanceID(),
-		MaxVolumesPerNode:  d.getVolumesLimit(),
+		MaxVolumesPerNode:  limit,
 		AccessibleTopology: topology,
 	}, nil
 }
@@ -614,18 +1119,14 @@ func (d *NodeService) nodePublishVolumeForBlock(req *csi.NodePublishVolumeReques
 		return status.Error(codes.InvalidArgument, "Volume Attribute is invalid")
 	}
 
-	partition := ""
-	if part, ok := req.GetVolumeContext()[VolumeAttributePartition]; ok {
-		if part != "0" {
-			partition = part
-		} else {
-			klog.InfoS("NodePublishVolume: invalid partition config, will ignore.", "partition", part)
-		}
+	partition, err := getPartition("NodePublishVolume", req.GetVolumeContext())
+	if err != nil {
+		return err
 	}
 
-	source, err := d.mounter.FindDevicePath(devicePath, volumeID, partition, d.metadata.GetRegion())
+	source, err := d.findDevicePath(devicePath, volumeID, partition, d.metadata.GetRegion())
 	if err != nil {
-		return status.Errorf(codes.Internal, "Failed to find device path %s. %v", devicePath, err)
+		return newNodeError(codes.Internal, ErrorReasonDeviceNotFound, "NodePublishVolume", volumeID, fmt.Sprintf("Failed to find device path %s. %v", devicePath, err))
 	}
 
 	klog.V(4).InfoS("NodePublishVolume [block]: find device path", "devicePath", devicePath, "source", source)
@@ -675,6 +1176,289 @@ func (d *NodeService) nodePublishVolumeForBlock(req *csi.NodePublishVolumeReques
 	return nil
 }
 
+// waitForDevicePath looks up the device path of the volume, polling until the device appears or the wait of
+// the device discovery options elapses, see deviceDiscoveryWait. Waiting stops early when ctx is done.
+// It returns how long it waited.
+func (d *NodeService) waitForDevicePath(ctx context.Context, devicePath, volumeID, partition string) (string, time.Duration, error) {
+	timeout, interval := d.options.deviceDiscoveryWait()
+	region := d.metadata.GetRegion()
+	start := d.clock.Now()
+	for {
+		source, err := d.findDevicePath(devicePath, volumeID, partition, region)
+		waited := d.clock.Since(start)
+		if err == nil {
+			return source, waited, nil
+		}
+		if waited >= timeout || ctx.Err() != nil {
+			return "", waited, err
+		}
+
+		klog.V(4).InfoS("Device path not found yet, retrying", "devicePath", devicePath, "volumeID", volumeID, "waited", waited, "err", err)
+		select {
+		case <-ctx.Done():
+			return "", d.clock.Since(start), err
+		case <-d.clock.After(interval):
+		}
+	}
+}
+
+// findDevicePath resolves the device path of the volume, trying the device path hint recorded by an earlier
+// stage before falling back to the DeviceResolver. Hints only cover whole disks, partitions are always resolved.
+func (d *NodeService) findDevicePath(devicePath, volumeID, partition, region string) (string, error) {
+	if partition == "" {
+		if hint := readDevicePathHint(d.options.DevicePathHintDir, volumeID); hint != "" {
+			klog.V(5).InfoS("[Debug] Using device path hint", "volumeID", volumeID, "devicePath", hint)
+			return hint, nil
+		}
+	}
+	return d.deviceResolver.FindDevicePath(devicePath, volumeID, partition, region)
+}
+
+// isStagedDevice checks if device, mounted at the staging path, is source or another name of the same volume
+// The kernel may assign a different device name when a volume is detached and reattached to the node,
+// so a mounted device with a different name is compared by the serial the volume reports
+func (d *NodeService) isStagedDevice(device, source, volumeID string) bool {
+	if device == source {
+		return true
+	}
+	if device == "" {
+		return false
+	}
+	matches, err := deviceMatchesVolume(device, volumeID)
+	if err != nil {
+		klog.V(4).InfoS("Could not check the serial of the device mounted at the staging path", "volumeID", volumeID, "device", device, "err", err)
+		return false
+	}
+	if matches {
+		klog.V(4).InfoS("NodeStageVolume: mounted device has a different name but the same serial as the volume", "volumeID", volumeID, "device", device, "source", source)
+	}
+	return matches
+}
+
+// checkPublishTargetFilesystem rejects publishing a volume into a directory on a tmpfs or ramfs filesystem
+// Bind mounts into such directories appear to succeed, but if the kubelet directory itself is memory-backed the pod's view
+// of the volume does not survive a reboot, which looks like data loss on the volume
+// The check is best-effort: a parent directory that cannot be inspected is assumed to be disk-backed
+func (d *NodeService) checkPublishTargetFilesystem(volumeID, target string) error {
+	if d.options.AllowTmpfsPublishTarget {
+		return nil
+	}
+	parent := filepath.Dir(target)
+	memoryBacked, err := pathIsMemoryBacked(parent)
+	if err != nil {
+		klog.V(4).InfoS("Could not check the filesystem of the publish target parent directory", "volumeID", volumeID, "parent", parent, "err", err)
+		return nil
+	}
+	if memoryBacked {
+		msg := fmt.Sprintf("target path %q is on a memory-backed (tmpfs or ramfs) filesystem, data published there would be lost: check that the kubelet root directory is on disk, or set --allow-tmpfs-publish-target", target)
+		return newNodeError(codes.FailedPrecondition, ErrorReasonMemoryBackedTarget, "NodePublishVolume", volumeID, msg)
+	}
+	return nil
+}
+
+// checkStagingFilesystemWritable fails with FailedPrecondition when the filesystem staged at source is mounted
+// read-only but the volume is published read-write, which happens when the kernel remounts a filesystem read-only
+// after an error. Pods would otherwise start with a volume they cannot write to.
+func (d *NodeService) checkStagingFilesystemWritable(volumeID, source string, mountOptions []string) error {
+	if hasMountOption(mountOptions, "ro") {
+		return nil
+	}
+	readOnly, err := mountIsReadOnly(source)
+	if err != nil {
+		klog.V(4).InfoS("Could not check if the staging path is mounted read-only", "volumeID", volumeID, "source", source, "err", err)
+		return nil
+	}
+	if readOnly {
+		msg := fmt.Sprintf("staging path %q is mounted read-only but the volume is published read-write, the kernel likely remounted the filesystem read-only after an error: check the kernel log of the node and repair the filesystem", source)
+		return newNodeError(codes.FailedPrecondition, ErrorReasonReadOnlyFilesystem, "NodePublishVolume", volumeID, msg)
+	}
+	return nil
+}
+
+// format formats source, if needed, and mounts it at target with the node's Formatter
+// Node services without a Formatter format and mount with their Mounter, like the default Formatter
+// Formatting is abandoned after --format-timeout, in which case the returned error wraps context.DeadlineExceeded
+func (d *NodeService) format(ctx context.Context, source, target, fsType string, mountOptions, formatOptions []string) error {
+	if d.options.FormatTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.options.FormatTimeout)
+		defer cancel()
+	}
+
+	var err error
+	if d.formatter == nil {
+		err = d.mounter.FormatAndMountSensitiveWithFormatOptions(ctx, source, target, fsType, mountOptions, nil, formatOptions)
+	} else {
+		err = d.formatter.Format(ctx, source, target, fsType, mountOptions, formatOptions)
+	}
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %v", context.DeadlineExceeded, err)
+	}
+	return err
+}
+
+// snapshotBeforeExpand takes a snapshot of the volume as a backup before its partition and filesystem are grown
+// The snapshot is named after the volume and the size it is expanded to, so that a retried expansion reuses the snapshot
+// of the first attempt rather than taking another one. The size is the size of the device when the CO does not
+// request one, which EBS already grew to the new size.
+func (d *NodeService) snapshotBeforeExpand(ctx context.Context, volumeID, devicePath string, requiredBytes int64) error {
+	if d.cloud == nil {
+		return errors.New("no EC2 client")
+	}
+	if requiredBytes == 0 {
+		size, err := d.mounter.GetBlockSizeBytes(devicePath)
+		if err != nil {
+			return fmt.Errorf("could not get the size of device %s: %w", devicePath, err)
+		}
+		requiredBytes = size
+	}
+
+	name := fmt.Sprintf("%s-%s-%d", CreatedByPreExpand, volumeID, requiredBytes)
+	snapshot, err := d.cloud.GetSnapshotByName(ctx, name)
+	switch {
+	case err == nil:
+		klog.InfoS("NodeExpandVolume: snapshot before expanding volume already exists", "volumeID", volumeID, "snapshotID", snapshot.SnapshotID)
+		return nil
+	case !errors.Is(err, cloud.ErrNotFound):
+		return fmt.Errorf("could not look up snapshot %s: %w", name, err)
+	}
+
+	snapshot, err = d.cloud.CreateSnapshot(ctx, volumeID, &cloud.SnapshotOptions{
+		Description: fmt.Sprintf("%s-%s", name, d.clock.Now().UTC().Format(time.RFC3339)),
+		Tags:        map[string]string{CreatedByTag: CreatedByPreExpand, cloud.SnapshotNameTagKey: name},
+	})
+	if err != nil {
+		return err
+	}
+	klog.InfoS("NodeExpandVolume: created snapshot before expanding volume", "volumeID", volumeID, "snapshotID", snapshot.SnapshotID)
+	return nil
+}
+
+// checkExistingFormat refuses to stage a device that already contains a filesystem other than fsType, which happens
+// when a volume restored from a snapshot is requested with a different fstype than the one it was formatted with and
+// would otherwise surface as a raw mount failure. Blank devices are left to format, as are devices whose format
+// cannot be read, which fail later with the underlying error. The ext filesystems are compatible with each other,
+// for example ext3 volumes staged with the default ext4 fstype are mounted by the ext4 driver.
+func (d *NodeService) checkExistingFormat(volumeID, source, fsType string) error {
+	existingFormat, err := d.mounter.GetDiskFormat(source)
+	if err != nil {
+		klog.InfoS("NodeStageVolume: could not determine existing format of device", "source", source, "volumeID", volumeID, "err", err)
+		return nil
+	}
+	if existingFormat == "" || strings.EqualFold(existingFormat, fsType) {
+		return nil
+	}
+	if isExtFsType(existingFormat) && isExtFsType(fsType) {
+		klog.V(4).InfoS("NodeStageVolume: mounting ext filesystem with a different ext fstype", "source", source, "volumeID", volumeID, "existing", existingFormat, "fsType", fsType)
+		return nil
+	}
+
+	metrics.Recorder().IncreaseCount(FsTypeMismatchMetric, map[string]string{"requested": fsType, "existing": existingFormat})
+	msg := fmt.Sprintf("device %s is already formatted as %s but fstype %s was requested: "+
+		"set the fstype of the PersistentVolume to %s to keep its data, or recreate the volume to have it formatted with %s",
+		source, existingFormat, fsType, existingFormat, fsType)
+	return newNodeError(codes.FailedPrecondition, ErrorReasonFsTypeMismatch, "NodeStageVolume", volumeID, msg)
+}
+
+// isExtFsType reports whether fsType is one of the ext filesystems
+func isExtFsType(fsType string) bool {
+	switch strings.ToLower(fsType) {
+	case FSTypeExt2, FSTypeExt3, FSTypeExt4:
+		return true
+	}
+	return false
+}
+
+// recordDevicePathHint records the device path a staged volume resolved to if hints are enabled
+func (d *NodeService) recordDevicePathHint(volumeID, partition, source string) {
+	if d.options.DevicePathHintDir == "" || partition != "" {
+		return
+	}
+	if err := writeDevicePathHint(d.options.DevicePathHintDir, volumeID, source); err != nil {
+		klog.InfoS("Failed to record device path hint", "volumeID", volumeID, "devicePath", source, "err", err)
+	}
+}
+
+// defaultFsType returns the filesystem type of volumes whose capability has none, --default-fstype or ext4 when unset.
+func (d *NodeService) defaultFsType() string {
+	if d.options.DefaultFsType != "" {
+		return d.options.DefaultFsType
+	}
+	return defaultFsType
+}
+
+// recordAttachedVolumes sets AttachedVolumesMetric to the number of volumes staged on the node.
+// The volumes are counted from the mount table, so that the gauge includes the volumes staged before the node plugin
+// restarted and stays accurate across idempotent retries. The staging registry is used where mounts cannot be listed.
+func (d *NodeService) recordAttachedVolumes() {
+	if d.attachedVolumesLabels == nil {
+		return
+	}
+	count, err := d.countStagedVolumes()
+	if err != nil {
+		klog.V(4).InfoS("Could not count staged volumes from mounts, using the staging registry", "err", err)
+		count = d.staged.Len()
+	}
+	metrics.Recorder().SetGauge(AttachedVolumesMetric, float64(count), d.attachedVolumesLabels)
+}
+
+// countStagedVolumes returns the number of staging paths of the driver mounted on the node
+func (d *NodeService) countStagedVolumes() (int, error) {
+	staged, err := d.listStagedVolumes()
+	return len(staged), err
+}
+
+// listStagedVolumes returns the staging paths of the driver mounted on the node by volume ID
+// Kubelet records the driver and volume ID of each staging path in a vol_data.json file next to it.
+func (d *NodeService) listStagedVolumes() (map[string]string, error) {
+	mountPoints, err := d.mounter.List()
+	if err != nil {
+		return nil, err
+	}
+	staged := make(map[string]string)
+	for _, mp := range mountPoints {
+		if filepath.Base(mp.Path) != stagingPathName {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(filepath.Dir(mp.Path), volDataFileName))
+		if err != nil {
+			continue
+		}
+		var volData struct {
+			DriverName   string `json:"driverName"`
+			VolumeHandle string `json:"volumeHandle"`
+		}
+		if err := json.Unmarshal(content, &volData); err != nil || volData.DriverName != DriverName || volData.VolumeHandle == "" {
+			continue
+		}
+		staged[volData.VolumeHandle] = mp.Path
+	}
+	return staged, nil
+}
+
+// checkStagingPathConflict fails when the volume is still mounted at a staging path other than target.
+// Entries whose staging path is no longer mounted are stale and get dropped.
+func (d *NodeService) checkStagingPathConflict(volumeID, target string) error {
+	existing, ok := d.staged.Get(volumeID)
+	if !ok || existing == target {
+		return nil
+	}
+
+	_, refCount, err := d.mounter.GetDeviceNameFromMount(existing)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to check if volume %s is still mounted at %q: %v", volumeID, existing, err)
+	}
+	if refCount == 0 {
+		klog.V(4).InfoS("NodeStageVolume: dropping stale staging path", "volumeID", volumeID, "stagingPath", existing)
+		d.staged.Delete(volumeID, existing)
+		d.recordAttachedVolumes()
+		return nil
+	}
+
+	klog.InfoS("NodeStageVolume: volume is already staged at a different path", "volumeID", volumeID, "stagingPath", existing, "target", target)
+	return newNodeError(codes.FailedPrecondition, ErrorReasonStagingPathConflict, "NodeStageVolume", volumeID, fmt.Sprintf("Volume %s is already staged at %q", volumeID, existing))
+}
+
 // isMounted checks if target is mounted. It does NOT return an error if target
 // doesn't exist.
 func (d *NodeService) isMounted(_ string, target string) (bool, error) {
@@ -728,27 +1512,37 @@ func (d *NodeService) nodePublishVolumeForFileSystem(req *csi.NodePublishVolumeR
 		}
 	}
 
-	if err := d.mounter.PreparePublishTarget(target); err != nil {
-		return status.Errorf(codes.Internal, err.Error())
+	fsType := mode.Mount.GetFsType()
+	if len(fsType) == 0 {
+		fsType = d.defaultFsType()
+	}
+	_, xfsProjectID, err := parseXFSProjectQuota(req.GetVolumeContext(), fsType)
+	if err != nil {
+		return err
+	}
+
+	if err := d.checkStagingFilesystemWritable(req.GetVolumeId(), source, mountOptions); err != nil {
+		return err
 	}
 
-	//Checking if the target directory is already mounted with a device.
+	// Checking if the target directory is already mounted with a device.
+	// A mounted target is left as is, preparing it would change the permissions of the root of the volume or, on
+	// Windows, remove it.
 	mounted, err := d.isMounted(source, target)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Could not check if %q is mounted: %v", target, err)
 	}
 
 	if !mounted {
-		fsType := mode.Mount.GetFsType()
-		if len(fsType) == 0 {
-			fsType = defaultFsType
-		}
-
 		_, ok := ValidFSTypes[strings.ToLower(fsType)]
 		if !ok {
 			return status.Errorf(codes.InvalidArgument, "NodePublishVolume: invalid fstype %s", fsType)
 		}
 
+		if err := d.mounter.PreparePublishTarget(target); err != nil {
+			return status.Errorf(codes.Internal, err.Error())
+		}
+
 		mountOptions = collectMountOptions(fsType, mountOptions)
 		klog.V(4).InfoS("NodePublishVolume: mounting", "source", source, "target", target, "mountOptions", mountOptions, "fsType", fsType)
 		if err := d.mounter.Mount(source, target, fsType, mountOptions); err != nil {
@@ -756,6 +1550,15 @@ func (d *NodeService) nodePublishVolumeForFileSystem(req *csi.NodePublishVolumeR
 		}
 	}
 
+	// Assigning the project is idempotent, so it is repeated for targets that are already mounted in case
+	// a previous attempt failed after mounting
+	if xfsProjectID > 0 {
+		klog.V(4).InfoS("NodePublishVolume: setting XFS project", "target", target, "projectID", xfsProjectID)
+		if err := d.mounter.SetXFSProjectQuota(target, xfsProjectID); err != nil {
+			return status.Errorf(codes.Internal, "Could not set XFS project %d on %q: %v", xfsProjectID, target, err)
+		}
+	}
+
 	return nil
 }
 
@@ -766,17 +1569,22 @@ func (d *NodeService) getVolumesLimit() int64 {
 		return d.options.VolumeAttachLimit
 	}
 	if util.IsSBE(d.metadata.GetRegion()) {
-		return sbeDeviceVolumeAttachmentLimit
+		return d.clampVolumesLimit(sbeDeviceVolumeAttachmentLimit)
 	}
 
 	instanceType := d.metadata.GetInstanceType()
 
 	isNitro := cloud.IsNitroInstanceType(instanceType)
+	nvmeInstanceStoreVolumes := cloud.GetNVMeInstanceStoreVolumesForInstanceType(instanceType)
+	if info := d.getInstanceTypeInfo(instanceType); info != nil {
+		isNitro = info.Nitro
+		nvmeInstanceStoreVolumes = info.NVMeInstanceStoreVolumes
+	}
 	availableAttachments := cloud.GetMaxAttachments(isNitro)
 
 	reservedVolumeAttachments := d.options.ReservedVolumeAttachments
 	if reservedVolumeAttachments == -1 {
-		reservedVolumeAttachments = d.metadata.GetNumBlockDeviceMappings() + 1 // +1 for the root device
+		reservedVolumeAttachments = d.getNonCSIVolumeAttachments()
 	}
 
 	dedicatedLimit := cloud.GetDedicatedLimitForInstanceType(instanceType)
@@ -790,7 +1598,6 @@ func (d *NodeService) getVolumesLimit() int64 {
 		availableAttachments = dedicatedLimit
 	} else if isNitro {
 		enis := d.metadata.GetNumAttachedENIs()
-		nvmeInstanceStoreVolumes := cloud.GetNVMeInstanceStoreVolumesForInstanceType(instanceType)
 		availableAttachments = availableAttachments - enis - nvmeInstanceStoreVolumes
 	}
 	availableAttachments = availableAttachments - reservedVolumeAttachments
@@ -798,7 +1605,67 @@ func (d *NodeService) getVolumesLimit() int64 {
 		availableAttachments = 1
 	}
 
-	return int64(availableAttachments)
+	return d.clampVolumesLimit(int64(availableAttachments))
+}
+
+// clampVolumesLimit bounds a computed volume attach limit by the configured minimum and maximum, if any
+func (d *NodeService) clampVolumesLimit(limit int64) int64 {
+	if d.options.MaxVolumeAttachLimit > 0 && limit > d.options.MaxVolumeAttachLimit {
+		klog.V(4).InfoS("Clamping computed volume attach limit to maximum", "limit", limit, "max", d.options.MaxVolumeAttachLimit)
+		limit = d.options.MaxVolumeAttachLimit
+	}
+	if d.options.MinVolumeAttachLimit > 0 && limit < d.options.MinVolumeAttachLimit {
+		klog.V(4).InfoS("Clamping computed volume attach limit to minimum", "limit", limit, "min", d.options.MinVolumeAttachLimit)
+		limit = d.options.MinVolumeAttachLimit
+	}
+	return limit
+}
+
+// getInstanceTypeInfo looks up an instance type missing from the built-in volume limit tables using the EC2 API
+// The lookup is only attempted once and its result, including a failure, is cached for the lifetime of the node service
+// nil is returned when the lookup is disabled, not needed or failed
+func (d *NodeService) getInstanceTypeInfo(instanceType string) *cloud.InstanceTypeInfo {
+	if !d.options.EnableInstanceTypeLookup || d.cloud == nil || cloud.IsKnownInstanceType(instanceType) {
+		return nil
+	}
+
+	d.instanceTypeOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), instanceTypeLookupTimeout)
+		defer cancel()
+		info, err := d.cloud.GetInstanceTypeInfo(ctx, instanceType)
+		if err != nil {
+			klog.InfoS("Failed to look up instance type missing from volume limit tables, volume attach limit may be inaccurate", "instanceType", instanceType, "err", err)
+			return
+		}
+		klog.V(4).InfoS("Looked up instance type missing from volume limit tables", "instanceType", instanceType, "nitro", info.Nitro, "nvmeInstanceStoreVolumes", info.NVMeInstanceStoreVolumes)
+		d.instanceTypeInfo = info
+	})
+	return d.instanceTypeInfo
+}
+
+// getNonCSIVolumeAttachments returns the number of attachment slots used by EBS volumes the driver did not attach
+// The EC2 API is used to count the attached volumes, excluding those attached by the driver so that restarts do not count
+// them. The lookup is only attempted once. When it is disabled or failed, the block device mappings captured in instance
+// metadata at boot are counted instead.
+func (d *NodeService) getNonCSIVolumeAttachments() int {
+	if d.options.EnableVolumeAttachmentLookup && d.cloud != nil {
+		d.volumeAttachmentsOnce.Do(func() {
+			d.nonCSIVolumeAttachments = -1
+			ctx, cancel := context.WithTimeout(context.Background(), volumeAttachmentLookupTimeout)
+			defer cancel()
+			count, err := d.cloud.CountNonCSIVolumeAttachments(ctx, d.metadata.GetInstanceID())
+			if err != nil {
+				klog.InfoS("Failed to look up volumes attached to the instance, falling back to block device mappings from instance metadata", "err", err)
+				return
+			}
+			klog.V(4).InfoS("Looked up volumes attached to the instance outside of the driver", "count", count)
+			d.nonCSIVolumeAttachments = count
+		})
+		if d.nonCSIVolumeAttachments >= 0 {
+			return d.nonCSIVolumeAttachments
+		}
+	}
+	return d.metadata.GetNumBlockDeviceMappings() + 1 // +1 for the root device
 }
 
 func min(x, y int) int {
@@ -849,14 +1716,18 @@ type JSONPatch struct {
 }
 
 // removeTaintInBackground is a goroutine that retries removeNotReadyTaint with exponential backoff
-func removeTaintInBackground(k8sClient kubernetes.Interface, backoff wait.Backoff, removalFunc func(kubernetes.Interface) error) {
+// until it either removes the taint(s) or finds there is nothing to remove
+func removeTaintInBackground(k8sClient kubernetes.Interface, backoff wait.Backoff, removalFunc func(kubernetes.Interface) (bool, error)) {
 	backoffErr := wait.ExponentialBackoff(backoff, func() (bool, error) {
-		err := removalFunc(k8sClient)
+		done, err := removalFunc(k8sClient)
 		if err != nil {
 			klog.ErrorS(err, "Unexpected failure when attempting to remove node taint(s)")
 			return false, nil
 		}
-		return true, nil
+		if !done {
+			klog.V(4).InfoS("Node is not ready for taint removal yet, retrying")
+		}
+		return done, nil
 	})
 
 	if backoffErr != nil {
@@ -864,38 +1735,51 @@ func removeTaintInBackground(k8sClient kubernetes.Interface, backoff wait.Backof
 	}
 }
 
-// removeNotReadyTaint removes the taint ebs.csi.aws.com/agent-not-ready from the local node
+// removeNotReadyTaint removes the taints whose key is in startupTaintKeys, ebs.csi.aws.com/agent-not-ready unless
+// set, from the local node in a single patch
 // This taint can be optionally applied by users to prevent startup race conditions such as
 // https://github.com/kubernetes/kubernetes/issues/95911
-func removeNotReadyTaint(clientset kubernetes.Interface) error {
+// It returns false without an error when the taint(s) should be removed later, once the CSINode of the node exists
+func removeNotReadyTaint(clientset kubernetes.Interface, recorder record.EventRecorder, startupTaintKeys []string) (bool, error) {
 	nodeName := os.Getenv("CSI_NODE_NAME")
 	if nodeName == "" {
 		klog.V(4).InfoS("CSI_NODE_NAME missing, skipping taint removal")
-		return nil
+		return true, nil
 	}
 
 	node, err := clientset.CoreV1().Nodes().Get(context.Background(), nodeName, metav1.GetOptions{})
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	err = checkAllocatable(clientset, nodeName)
-	if err != nil {
-		return err
+	allocatableSet, err := checkAllocatable(clientset, nodeName)
+	if err != nil || !allocatableSet {
+		return false, err
+	}
+
+	if len(startupTaintKeys) == 0 {
+		startupTaintKeys = []string{AgentNotReadyNodeTaintKey}
 	}
+	taintKeysToRemove := sets.New(startupTaintKeys...)
 
 	var taintsToKeep []corev1.Taint
+	var removedTaintKeys []string
+	var taintAdded *metav1.Time
 	for _, taint := range node.Spec.Taints {
-		if taint.Key != AgentNotReadyNodeTaintKey {
+		if !taintKeysToRemove.Has(taint.Key) {
 			taintsToKeep = append(taintsToKeep, taint)
 		} else {
 			klog.V(4).InfoS("Queued taint for removal", "key", taint.Key, "effect", taint.Effect)
+			removedTaintKeys = append(removedTaintKeys, taint.Key)
+			if taint.TimeAdded != nil && (taintAdded == nil || taint.TimeAdded.Before(taintAdded)) {
+				taintAdded = taint.TimeAdded
+			}
 		}
 	}
 
 	if len(taintsToKeep) == len(node.Spec.Taints) {
 		klog.V(4).InfoS("No taints to remove on node, skipping taint removal")
-		return nil
+		return true, nil
 	}
 
 	patchRemoveTaints := []JSONPatch{
@@ -913,34 +1797,54 @@ func removeNotReadyTaint(clientset kubernetes.Interface) error {
 
 	patch, err := json.Marshal(patchRemoveTaints)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	_, err = clientset.CoreV1().Nodes().Patch(context.Background(), nodeName, k8stypes.JSONPatchType, patch, metav1.PatchOptions{})
 	if err != nil {
-		return err
+		return false, err
 	}
 	klog.InfoS("Removed taint(s) from local node", "node", nodeName)
-	return nil
+
+	// TimeAdded is only populated for NoExecute taints, otherwise the taint is assumed to have been
+	// present since the node registered
+	if taintAdded == nil {
+		taintAdded = &node.CreationTimestamp
+	}
+	if recorder != nil {
+		recordDriverReadyEvent(recorder, node, removedTaintKeys, time.Since(taintAdded.Time))
+	}
+	return true, nil
 }
 
-func checkAllocatable(clientset kubernetes.Interface, nodeName string) error {
+// recordDriverReadyEvent records an event on the node once the not-ready taint(s) have been removed
+func recordDriverReadyEvent(recorder record.EventRecorder, node *corev1.Node, removedTaintKeys []string, taintedFor time.Duration) {
+	recorder.Eventf(node, corev1.EventTypeNormal, DriverReadyEventReason, "EBS CSI driver %s is ready, removed taint(s) %s after %v", GetVersion().DriverVersion, strings.Join(removedTaintKeys, ", "), taintedFor.Round(time.Second))
+}
+
+// checkAllocatable checks if the allocatable count of the driver is set in the CSINode of the node. The CSINode does
+// not exist for a short time while the node bootstraps, so a missing CSINode is not an error, only not set yet.
+func checkAllocatable(clientset kubernetes.Interface, nodeName string) (bool, error) {
 	csiNode, err := clientset.StorageV1().CSINodes().Get(context.Background(), nodeName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		klog.V(4).InfoS("CSINode not found yet, allocatable value is not set", "nodeName", nodeName)
+		return false, nil
+	}
 	if err != nil {
-		return fmt.Errorf("isAllocatableSet: failed to get CSINode for %s: %w", nodeName, err)
+		return false, fmt.Errorf("isAllocatableSet: failed to get CSINode for %s: %w", nodeName, err)
 	}
 
 	for _, driver := range csiNode.Spec.Drivers {
 		if driver.Name == DriverName {
 			if driver.Allocatable != nil && driver.Allocatable.Count != nil {
 				klog.InfoS("CSINode Allocatable value is set", "nodeName", nodeName, "count", *driver.Allocatable.Count)
-				return nil
+				return true, nil
 			}
-			return fmt.Errorf("isAllocatableSet: allocatable value not set for driver on node %s", nodeName)
+			return false, fmt.Errorf("isAllocatableSet: allocatable value not set for driver on node %s", nodeName)
 		}
 	}
 
-	return fmt.Errorf("isAllocatableSet: driver not found on node %s", nodeName)
+	return false, fmt.Errorf("isAllocatableSet: driver not found on node %s", nodeName)
 }
 
 func recheckFormattingOptionParameter(context map[string]string, key string, fsConfigs map[string]fileSystemConfig, fsType string) (value string, err error) {
@@ -960,3 +1864,190 @@ func recheckFormattingOptionParameter(context map[string]string, key string, fsC
 	}
 	return v, nil
 }
+
+// parseXFSProjectQuota returns whether project quotas are enabled in the volume context, and the project ID the
+// volume is assigned to, 0 if none is requested. A project ID can only be requested with project quotas enabled.
+func parseXFSProjectQuota(context map[string]string, fsType string) (bool, uint32, error) {
+	for _, key := range []string{XFSProjectQuotaKey, XFSProjectIDKey} {
+		if _, ok := context[key]; ok && !FileSystemConfigs[strings.ToLower(fsType)].isParameterSupported(key) {
+			return false, 0, status.Errorf(codes.InvalidArgument, "Cannot use %s with fstype %s", key, fsType)
+		}
+	}
+
+	var enabled bool
+	if v, ok := context[XFSProjectQuotaKey]; ok {
+		var err error
+		if enabled, err = strconv.ParseBool(v); err != nil {
+			return false, 0, status.Errorf(codes.InvalidArgument, "Invalid %s (%s): must be true or false", XFSProjectQuotaKey, v)
+		}
+	}
+
+	v, ok := context[XFSProjectIDKey]
+	if !ok {
+		return enabled, 0, nil
+	}
+	projectID, err := strconv.ParseUint(v, 10, 32)
+	if err != nil || projectID == 0 {
+		return false, 0, status.Errorf(codes.InvalidArgument, "Invalid %s (%s): must be a number between 1 and %d", XFSProjectIDKey, v, uint32(math.MaxUint32))
+	}
+	if !enabled {
+		return false, 0, status.Errorf(codes.InvalidArgument, "Cannot use %s unless %s is true", XFSProjectIDKey, XFSProjectQuotaKey)
+	}
+	return true, uint32(projectID), nil
+}
+
+// parseXFSMetadataOptions returns the mkfs.xfs -m suboptions enabling or disabling the metadata features requested in
+// the volume context, nil when none is requested so that mkfs.xfs keeps its own defaults
+func parseXFSMetadataOptions(context map[string]string, fsType string) ([]string, error) {
+	var suboptions []string
+	for _, feature := range []struct{ key, name string }{
+		{XFSReflinkKey, "reflink"},
+		{XFSBigtimeKey, "bigtime"},
+		{XFSInobtcountKey, "inobtcount"},
+	} {
+		v, ok := context[feature.key]
+		if !ok {
+			continue
+		}
+		if !FileSystemConfigs[strings.ToLower(fsType)].isParameterSupported(feature.key) {
+			return nil, status.Errorf(codes.InvalidArgument, "Cannot use %s with fstype %s", feature.key, fsType)
+		}
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid %s (%s): must be true or false", feature.key, v)
+		}
+		value := "0"
+		if enabled {
+			value = "1"
+		}
+		suboptions = append(suboptions, feature.name+"="+value)
+	}
+	if len(suboptions) == 0 {
+		return nil, nil
+	}
+	return []string{"-m", strings.Join(suboptions, ",")}, nil
+}
+
+// parseExt4JournalOptions returns the ext4 journal mount options requested in the volume context. Asynchronous
+// journal commits also checksum the journal, and the kernel refuses them in data=journal mode.
+func parseExt4JournalOptions(context map[string]string, fsType string) ([]string, error) {
+	enabled := map[string]bool{}
+	for _, key := range []string{Ext4JournalChecksumKey, Ext4AsyncCommitKey} {
+		v, ok := context[key]
+		if !ok {
+			continue
+		}
+		if !FileSystemConfigs[strings.ToLower(fsType)].isParameterSupported(key) {
+			return nil, status.Errorf(codes.InvalidArgument, "Cannot use %s with fstype %s", key, fsType)
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid %s (%s): must be true or false", key, v)
+		}
+		enabled[key] = b
+	}
+
+	var options []string
+	if enabled[Ext4JournalChecksumKey] {
+		options = append(options, "journal_checksum")
+	}
+	if enabled[Ext4AsyncCommitKey] {
+		options = append(options, "journal_async_commit")
+	}
+	return options, nil
+}
+
+// parseNTFSFormatOptions returns the NTFS format options requested in the volume context
+// The options are rejected for fstypes that do not support them, like the other formatting options
+func parseNTFSFormatOptions(context map[string]string, fsType string) (mounter.NTFSFormatOptions, error) {
+	var o mounter.NTFSFormatOptions
+	for _, key := range []string{NTFSAllocationUnitSizeKey, VolumeLabelKey} {
+		if _, ok := context[key]; ok && !FileSystemConfigs[strings.ToLower(fsType)].isParameterSupported(key) {
+			return o, status.Errorf(codes.InvalidArgument, "Cannot use %s with fstype %s", key, fsType)
+		}
+	}
+	if size, ok := context[NTFSAllocationUnitSizeKey]; ok {
+		var err error
+		if o.AllocationUnitSize, err = mounter.ParseNTFSAllocationUnitSize(size); err != nil {
+			return o, status.Errorf(codes.InvalidArgument, "Invalid %s: %v", NTFSAllocationUnitSizeKey, err)
+		}
+	}
+	if label, ok := context[VolumeLabelKey]; ok {
+		if err := mounter.ValidateNTFSLabel(label); err != nil {
+			return o, status.Errorf(codes.InvalidArgument, "Invalid %s: %v", VolumeLabelKey, err)
+		}
+		o.Label = label
+	}
+	return o, nil
+}
+
+// getPartition returns the partition from the volume context in the form FindDevicePath expects
+// Partition 0 refers to the whole disk, the same as no partition, and is returned as an empty string
+// so the device path is used without a partition suffix (e.g. nvme1n1 rather than nvme1n1p0)
+// A partition label is returned prefixed with mounter.PartitionLabelPrefix
+func getPartition(operation string, volumeContext map[string]string) (string, error) {
+	part, ok := volumeContext[VolumeAttributePartition]
+	if label, hasLabel := volumeContext[VolumeAttributePartitionLabel]; hasLabel {
+		if ok {
+			return "", status.Errorf(codes.InvalidArgument, "Volume attributes %s and %s are mutually exclusive", VolumeAttributePartition, VolumeAttributePartitionLabel)
+		}
+		if label == "" || strings.Contains(label, "/") {
+			return "", status.Errorf(codes.InvalidArgument, "Invalid %s volume attribute %q", VolumeAttributePartitionLabel, label)
+		}
+		return mounter.PartitionLabelPrefix + label, nil
+	}
+	if !ok {
+		return "", nil
+	}
+	n, err := strconv.Atoi(part)
+	if err != nil || n <= 0 {
+		klog.InfoS(operation+": invalid partition config, will ignore.", "partition", part)
+		return "", nil
+	}
+	return strconv.Itoa(n), nil
+}
+
+// isUnderPathPrefix checks if the absolute path is prefix or a path below it once ".." elements are resolved
+func isUnderPathPrefix(path, prefix string) bool {
+	if !filepath.IsAbs(path) {
+		return false
+	}
+	path, prefix = filepath.Clean(path), filepath.Clean(prefix)
+	return path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// refCountBucket buckets the number of mount references of a staging path to keep metric label cardinality low
+func refCountBucket(refCount int) string {
+	if refCount > 3 {
+		return "4+"
+	}
+	return strconv.Itoa(refCount)
+}
+
+// newNodeError returns a gRPC status error with the given message that carries an ErrorInfo detail
+// identifying the failing operation and volume, so that callers can handle failures programmatically
+func newNodeError(c codes.Code, reason, operation, volumeID, msg string) error {
+	return newErrorWithInfo(c, reason, operation, volumeID, msg)
+}
+
+// newErrorWithInfo returns a gRPC status error with the given message that carries an ErrorInfo detail with reason,
+// the failing operation and, if known, the volume ID. The status without details is returned if they cannot be attached.
+func newErrorWithInfo(c codes.Code, reason, operation, volumeID, msg string) error {
+	st := status.New(c, msg)
+	metadata := map[string]string{
+		ErrorInfoOperationKey: operation,
+	}
+	if volumeID != "" {
+		metadata[ErrorInfoVolumeIDKey] = volumeID
+	}
+	detailed, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason:   reason,
+		Domain:   DriverName,
+		Metadata: metadata,
+	})
+	if err != nil {
+		klog.V(4).InfoS("Failed to attach error details", "operation", operation, "volumeID", volumeID, "err", err)
+		return st.Err()
+	}
+	return detailed.Err()
+}
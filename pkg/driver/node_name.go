@@ -0,0 +1,104 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// nodeNameCache caches the names of the nodes whose CSINode registers the driver, by the node ID of the driver
+type nodeNameCache struct {
+	mux   sync.Mutex
+	names map[string]string
+}
+
+func newNodeNameCache() *nodeNameCache {
+	return &nodeNameCache{names: make(map[string]string)}
+}
+
+func (c *nodeNameCache) get(nodeID string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	name, ok := c.names[nodeID]
+	return name, ok
+}
+
+func (c *nodeNameCache) set(names map[string]string) {
+	if c == nil {
+		return
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.names = names
+}
+
+// nodeName returns the name of the node whose CSINode registers the driver with nodeID
+// A cached name is checked against its CSINode, the CSINodes are only listed when nodeID is not cached or its node
+// was replaced.
+func (d *ControllerService) nodeName(ctx context.Context, nodeID string) (string, error) {
+	if d.k8sClient == nil {
+		return "", fmt.Errorf("no Kubernetes client")
+	}
+	if name, ok := d.nodeNames.get(nodeID); ok {
+		csiNode, err := d.k8sClient.StorageV1().CSINodes().Get(ctx, name, metav1.GetOptions{})
+		switch {
+		case err == nil && hasDriverNodeID(csiNode.Spec.Drivers, nodeID):
+			return name, nil
+		case err != nil && !apierrors.IsNotFound(err):
+			return "", fmt.Errorf("could not get CSINode %q: %w", name, err)
+		}
+	}
+
+	csiNodes, err := d.k8sClient.StorageV1().CSINodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("could not list CSINodes: %w", err)
+	}
+	names := make(map[string]string, len(csiNodes.Items))
+	for _, csiNode := range csiNodes.Items {
+		for _, driver := range csiNode.Spec.Drivers {
+			if driver.Name == DriverName {
+				names[driver.NodeID] = csiNode.Name
+			}
+		}
+	}
+	d.nodeNames.set(names)
+
+	name, ok := names[nodeID]
+	if !ok {
+		return "", fmt.Errorf("no CSINode registers node ID %s", nodeID)
+	}
+	return name, nil
+}
+
+// hasDriverNodeID checks if the driver is registered in a CSINode with nodeID
+func hasDriverNodeID(drivers []storagev1.CSINodeDriver, nodeID string) bool {
+	for _, driver := range drivers {
+		if driver.Name == DriverName && driver.NodeID == nodeID {
+			return true
+		}
+	}
+	return false
+}
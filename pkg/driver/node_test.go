@@ -17,29 +17,45 @@ limitations under the License.
 package driver
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"reflect"
 	"runtime"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws/arn"
 	csi "github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud"
 	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud/metadata"
 	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/driver/internal"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/metrics"
 	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/mounter"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/semaphore"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	mountutils "k8s.io/mount-utils"
+	"k8s.io/utils/clock"
+	testingclock "k8s.io/utils/clock/testing"
 )
 
 func TestNewNodeService(t *testing.T) {
@@ -55,7 +71,13 @@ func TestNewNodeService(t *testing.T) {
 
 	options := &Options{}
 
-	nodeService := NewNodeService(options, mockMetadataService, mockMounter, mockKubernetesClient)
+	mockMetadataService.EXPECT().GetInstanceType().Return("m5.large")
+	mockCoreV1 := NewMockCoreV1Interface(ctrl)
+	mockKubernetesClient.EXPECT().CoreV1().Return(mockCoreV1)
+	mockCoreV1.EXPECT().Events("").Return(NewMockEventInterface(ctrl))
+	t.Setenv("CSI_NODE_NAME", "node-1")
+
+	nodeService := NewNodeService(nil, options, mockMetadataService, mockMounter, mockKubernetesClient)
 
 	if nodeService == nil {
 		t.Fatal("Expected NewNodeService to return a non-nil NodeService")
@@ -76,6 +98,11 @@ func TestNewNodeService(t *testing.T) {
 	if nodeService.options != options {
 		t.Error("Expected NodeService.options to be set to the provided options")
 	}
+
+	expectedLabels := map[string]string{"node_name": "node-1", "instance_type": "m5.large"}
+	if !reflect.DeepEqual(nodeService.attachedVolumesLabels, expectedLabels) {
+		t.Errorf("Expected NodeService.attachedVolumesLabels to be %v, got %v", expectedLabels, nodeService.attachedVolumesLabels)
+	}
 }
 
 func TestNodeStageVolume(t *testing.T) {
@@ -86,6 +113,11 @@ func TestNodeStageVolume(t *testing.T) {
 		metadataMock func(ctrl *gomock.Controller) *metadata.MockMetadataService
 		expectedErr  error
 		inflight     bool
+		stagedPath   string
+		// defaultFsType is the --default-fstype of the driver
+		defaultFsType string
+		// formatDefaults are the format options read from the --format-defaults-file of the driver
+		formatDefaults FormatDefaults
 	}{
 		{
 			name: "success",
@@ -109,7 +141,8 @@ func TestNodeStageVolume(t *testing.T) {
 				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
 				m.EXPECT().PathExists(gomock.Any()).Return(true, nil)
 				m.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("", 1, nil)
-				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
 				m.EXPECT().NeedResize(gomock.Any(), gomock.Any()).Return(false, nil)
 				return m
 			},
@@ -266,7 +299,8 @@ func TestNodeStageVolume(t *testing.T) {
 				m.EXPECT().PathExists(gomock.Any()).Return(false, nil)
 				m.EXPECT().MakeDir(gomock.Any()).Return(nil)
 				m.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("", 0, nil)
-				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Any(), defaultFsType, gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Any(), gomock.Any(), defaultFsType, gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
 				m.EXPECT().NeedResize(gomock.Any(), gomock.Any()).Return(false, nil)
 				return m
 			},
@@ -277,6 +311,74 @@ func TestNodeStageVolume(t *testing.T) {
 			},
 			expectedErr: nil,
 		},
+		{
+			name: "configured_default_fstype",
+			req: &csi.NodeStageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				PublishContext: map[string]string{DevicePathKey: "/dev/xvdba"},
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
+				m.EXPECT().PathExists(gomock.Any()).Return(false, nil)
+				m.EXPECT().MakeDir(gomock.Any()).Return(nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("", 0, nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Any(), gomock.Any(), FSTypeXfs, gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				m.EXPECT().NeedResize(gomock.Any(), gomock.Any()).Return(false, nil)
+				return m
+			},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				return m
+			},
+			defaultFsType: FSTypeXfs,
+		},
+		{
+			name: "configured_default_fstype_not_used_with_fstype",
+			req: &csi.NodeStageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: FSTypeExt4,
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				PublishContext: map[string]string{DevicePathKey: "/dev/xvdba"},
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
+				m.EXPECT().PathExists(gomock.Any()).Return(false, nil)
+				m.EXPECT().MakeDir(gomock.Any()).Return(nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("", 0, nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Any(), gomock.Any(), FSTypeExt4, gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				m.EXPECT().NeedResize(gomock.Any(), gomock.Any()).Return(false, nil)
+				return m
+			},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				return m
+			},
+			defaultFsType: FSTypeXfs,
+		},
 		{
 			name: "invalid_fstype",
 			req: &csi.NodeStageVolumeRequest{
@@ -484,7 +586,7 @@ func TestNodeStageVolume(t *testing.T) {
 			expectedErr: status.Error(codes.InvalidArgument, "Invalid ext4clustersize (aborting!): <nil>"),
 		},
 		{
-			name: "device_path_not_provided",
+			name: "invalid_ext4_stripe_width",
 			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
@@ -499,9 +601,12 @@ func TestNodeStageVolume(t *testing.T) {
 					},
 				},
 				VolumeContext: map[string]string{
-					Ext4ClusterSizeKey: "51",
+					Ext4StrideKey:      "16",
+					Ext4StripeWidthKey: "40",
+				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
 				},
-				PublishContext: map[string]string{},
 			},
 			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
 				m := mounter.NewMockMounter(ctrl)
@@ -510,10 +615,10 @@ func TestNodeStageVolume(t *testing.T) {
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
 				return nil
 			},
-			expectedErr: status.Error(codes.InvalidArgument, "Device path not provided"),
+			expectedErr: status.Error(codes.InvalidArgument, "ext4stripewidth (40) must be a multiple of ext4stride (16)"),
 		},
 		{
-			name: "volume_operation_already_exists",
+			name: "invalid_ext4_lazy_init",
 			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
@@ -527,6 +632,9 @@ func TestNodeStageVolume(t *testing.T) {
 						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
 					},
 				},
+				VolumeContext: map[string]string{
+					Ext4LazyInitKey: "sometimes",
+				},
 				PublishContext: map[string]string{
 					DevicePathKey: "/dev/xvdba",
 				},
@@ -538,11 +646,10 @@ func TestNodeStageVolume(t *testing.T) {
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
 				return nil
 			},
-			expectedErr: status.Errorf(codes.Aborted, VolumeOperationAlreadyExists, "vol-test"),
-			inflight:    true,
+			expectedErr: status.Error(codes.InvalidArgument, "Invalid ext4lazyinit (sometimes): must be true or false"),
 		},
 		{
-			name: "valid_partition",
+			name: "ntfs_allocation_unit_size_with_ext4",
 			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
@@ -557,7 +664,7 @@ func TestNodeStageVolume(t *testing.T) {
 					},
 				},
 				VolumeContext: map[string]string{
-					VolumeAttributePartition: "1",
+					NTFSAllocationUnitSizeKey: "65536",
 				},
 				PublishContext: map[string]string{
 					DevicePathKey: "/dev/xvdba",
@@ -565,29 +672,22 @@ func TestNodeStageVolume(t *testing.T) {
 			},
 			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
 				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), "1", gomock.Any()).Return("/dev/xvdba1", nil)
-				m.EXPECT().PathExists(gomock.Any()).Return(true, nil)
-				m.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("", 1, nil)
-				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
-				m.EXPECT().NeedResize(gomock.Any(), gomock.Any()).Return(false, nil)
 				return m
 			},
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
-				m := metadata.NewMockMetadataService(ctrl)
-				m.EXPECT().GetRegion().Return("us-west-2")
-				return m
+				return nil
 			},
-			expectedErr: nil,
+			expectedErr: status.Error(codes.InvalidArgument, "Cannot use ebs.csi.aws.com/ntfsAllocationUnitSize with fstype ext4"),
 		},
 		{
-			name: "invalid_partition",
+			name: "volume_label_with_xfs",
 			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
 				VolumeCapability: &csi.VolumeCapability{
 					AccessType: &csi.VolumeCapability_Mount{
 						Mount: &csi.VolumeCapability_MountVolume{
-							FsType: "ext4",
+							FsType: "xfs",
 						},
 					},
 					AccessMode: &csi.VolumeCapability_AccessMode{
@@ -595,7 +695,7 @@ func TestNodeStageVolume(t *testing.T) {
 					},
 				},
 				VolumeContext: map[string]string{
-					VolumeAttributePartition: "0",
+					VolumeLabelKey: "data",
 				},
 				PublishContext: map[string]string{
 					DevicePathKey: "/dev/xvdba",
@@ -603,66 +703,63 @@ func TestNodeStageVolume(t *testing.T) {
 			},
 			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
 				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), "", gomock.Any()).Return("/dev/xvdba", nil)
-				m.EXPECT().PathExists(gomock.Any()).Return(true, nil)
-				m.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("", 1, nil)
-				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
-				m.EXPECT().NeedResize(gomock.Any(), gomock.Any()).Return(false, nil)
 				return m
 			},
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
-				m := metadata.NewMockMetadataService(ctrl)
-				m.EXPECT().GetRegion().Return("us-west-2")
-				return m
+				return nil
 			},
-			expectedErr: nil,
+			expectedErr: status.Error(codes.InvalidArgument, "Cannot use ebs.csi.aws.com/volumeLabel with fstype xfs"),
 		},
 		{
-			name: "find_device_path_error",
+			name: "invalid_ntfs_allocation_unit_size",
 			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
 				VolumeCapability: &csi.VolumeCapability{
 					AccessType: &csi.VolumeCapability_Mount{
 						Mount: &csi.VolumeCapability_MountVolume{
-							FsType: "ext4",
+							FsType: "ntfs",
 						},
 					},
 					AccessMode: &csi.VolumeCapability_AccessMode{
 						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
 					},
 				},
+				VolumeContext: map[string]string{
+					NTFSAllocationUnitSizeKey: "64K",
+				},
 				PublishContext: map[string]string{
 					DevicePathKey: "/dev/xvdba",
 				},
 			},
 			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
 				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().FindDevicePath(gomock.Eq("/dev/xvdba"), gomock.Eq("vol-test"), gomock.Eq(""), gomock.Eq("us-west-2")).Return("", errors.New("find device path error"))
 				return m
 			},
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
-				m := metadata.NewMockMetadataService(ctrl)
-				m.EXPECT().GetRegion().Return("us-west-2")
-				return m
+				return nil
 			},
-			expectedErr: status.Errorf(codes.Internal, "Failed to find device path %s. %v", "/dev/xvdba", errors.New("find device path error")),
+			expectedErr: status.Error(codes.InvalidArgument, "Invalid ebs.csi.aws.com/ntfsAllocationUnitSize: allocation unit size \"64K\" is not a number of bytes"),
 		},
 		{
-			name: "path_exists_error",
+			name: "xfs_project_quota",
 			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
 				VolumeCapability: &csi.VolumeCapability{
 					AccessType: &csi.VolumeCapability_Mount{
 						Mount: &csi.VolumeCapability_MountVolume{
-							FsType: "ext4",
+							FsType: "xfs",
 						},
 					},
 					AccessMode: &csi.VolumeCapability_AccessMode{
 						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
 					},
 				},
+				VolumeContext: map[string]string{
+					XFSProjectQuotaKey: "true",
+					XFSProjectIDKey:    "42",
+				},
 				PublishContext: map[string]string{
 					DevicePathKey: "/dev/xvdba",
 				},
@@ -670,7 +767,11 @@ func TestNodeStageVolume(t *testing.T) {
 			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
 				m := mounter.NewMockMounter(ctrl)
 				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
-				m.EXPECT().PathExists(gomock.Eq("/staging/path")).Return(false, errors.New("path exists error"))
+				m.EXPECT().PathExists(gomock.Eq("/staging/path")).Return(true, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("", 1, nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path"), gomock.Eq("xfs"), gomock.Eq([]string{"nouuid", "pquota"}), gomock.Any(), gomock.Any()).Return(nil)
+				m.EXPECT().NeedResize(gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path")).Return(false, nil)
 				return m
 			},
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
@@ -678,10 +779,10 @@ func TestNodeStageVolume(t *testing.T) {
 				m.EXPECT().GetRegion().Return("us-west-2")
 				return m
 			},
-			expectedErr: status.Error(codes.Internal, "failed to check if target \"/staging/path\" exists: path exists error"),
+			expectedErr: nil,
 		},
 		{
-			name: "create_target_dir_error",
+			name: "xfs_project_quota_with_ext4",
 			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
@@ -695,26 +796,24 @@ func TestNodeStageVolume(t *testing.T) {
 						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
 					},
 				},
+				VolumeContext: map[string]string{
+					XFSProjectQuotaKey: "true",
+				},
 				PublishContext: map[string]string{
 					DevicePathKey: "/dev/xvdba",
 				},
 			},
 			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
 				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
-				m.EXPECT().PathExists(gomock.Eq("/staging/path")).Return(false, nil)
-				m.EXPECT().MakeDir(gomock.Eq("/staging/path")).Return(errors.New("make dir error"))
 				return m
 			},
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
-				m := metadata.NewMockMetadataService(ctrl)
-				m.EXPECT().GetRegion().Return("us-west-2")
-				return m
+				return nil
 			},
-			expectedErr: status.Error(codes.Internal, "could not create target dir \"/staging/path\": make dir error"),
+			expectedErr: status.Error(codes.InvalidArgument, "Cannot use xfsprojectquota with fstype ext4"),
 		},
 		{
-			name: "get_device_name_from_mount_error",
+			name: "format_defaults",
 			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
@@ -728,15 +827,21 @@ func TestNodeStageVolume(t *testing.T) {
 						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
 					},
 				},
-				PublishContext: map[string]string{
-					DevicePathKey: "/dev/xvdba",
-				},
+				VolumeContext:  nil,
+				PublishContext: map[string]string{DevicePathKey: "/dev/xvdba"},
+			},
+			formatDefaults: FormatDefaults{
+				FSTypeExt4: {BlockSize: "1024", BytesPerInode: "16384"},
+				FSTypeXfs:  {BlockSize: "2048"},
 			},
 			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
 				m := mounter.NewMockMounter(ctrl)
 				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
 				m.EXPECT().PathExists(gomock.Eq("/staging/path")).Return(true, nil)
-				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("", 0, errors.New("get device name error"))
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("", 1, nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path"), gomock.Eq("ext4"), gomock.Any(), gomock.Any(), gomock.Eq([]string{"-b", "1024", "-i", "16384"})).Return(nil)
+				m.EXPECT().NeedResize(gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path")).Return(false, nil)
 				return m
 			},
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
@@ -744,10 +849,10 @@ func TestNodeStageVolume(t *testing.T) {
 				m.EXPECT().GetRegion().Return("us-west-2")
 				return m
 			},
-			expectedErr: status.Error(codes.Internal, "failed to check if volume is already mounted: get device name error"),
+			expectedErr: nil,
 		},
 		{
-			name: "volume_already_staged",
+			name: "format_defaults_overridden",
 			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
@@ -761,15 +866,21 @@ func TestNodeStageVolume(t *testing.T) {
 						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
 					},
 				},
-				PublishContext: map[string]string{
-					DevicePathKey: "/dev/xvdba",
-				},
+				VolumeContext:  map[string]string{BlockSizeKey: "4096"},
+				PublishContext: map[string]string{DevicePathKey: "/dev/xvdba"},
+			},
+			formatDefaults: FormatDefaults{
+				FSTypeExt4: {BlockSize: "1024", BytesPerInode: "16384"},
+				FSTypeXfs:  {BlockSize: "2048"},
 			},
 			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
 				m := mounter.NewMockMounter(ctrl)
 				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
 				m.EXPECT().PathExists(gomock.Eq("/staging/path")).Return(true, nil)
-				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("/dev/xvdba", 1, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("", 1, nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path"), gomock.Eq("ext4"), gomock.Any(), gomock.Any(), gomock.Eq([]string{"-b", "4096", "-i", "16384"})).Return(nil)
+				m.EXPECT().NeedResize(gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path")).Return(false, nil)
 				return m
 			},
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
@@ -780,7 +891,7 @@ func TestNodeStageVolume(t *testing.T) {
 			expectedErr: nil,
 		},
 		{
-			name: "format_and_mount_error",
+			name: "ext4_journal_async_commit",
 			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
@@ -794,6 +905,10 @@ func TestNodeStageVolume(t *testing.T) {
 						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
 					},
 				},
+				VolumeContext: map[string]string{
+					Ext4JournalChecksumKey: "true",
+					Ext4AsyncCommitKey:     "true",
+				},
 				PublishContext: map[string]string{
 					DevicePathKey: "/dev/xvdba",
 				},
@@ -803,7 +918,9 @@ func TestNodeStageVolume(t *testing.T) {
 				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
 				m.EXPECT().PathExists(gomock.Eq("/staging/path")).Return(true, nil)
 				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("", 1, nil)
-				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path"), gomock.Eq("ext4"), gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("format and mount error"))
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path"), gomock.Eq("ext4"), gomock.Eq([]string{"journal_checksum", "journal_async_commit"}), gomock.Any(), gomock.Any()).Return(nil)
+				m.EXPECT().NeedResize(gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path")).Return(false, nil)
 				return m
 			},
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
@@ -811,10 +928,10 @@ func TestNodeStageVolume(t *testing.T) {
 				m.EXPECT().GetRegion().Return("us-west-2")
 				return m
 			},
-			expectedErr: status.Error(codes.Internal, "could not format \"/dev/xvdba\" and mount it at \"/staging/path\": format and mount error"),
+			expectedErr: nil,
 		},
 		{
-			name: "need_resize_error",
+			name: "ext4_journal_async_commit_without_checksum_option",
 			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
@@ -828,6 +945,10 @@ func TestNodeStageVolume(t *testing.T) {
 						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
 					},
 				},
+				VolumeContext: map[string]string{
+					Ext4JournalChecksumKey: "false",
+					Ext4AsyncCommitKey:     "true",
+				},
 				PublishContext: map[string]string{
 					DevicePathKey: "/dev/xvdba",
 				},
@@ -835,10 +956,11 @@ func TestNodeStageVolume(t *testing.T) {
 			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
 				m := mounter.NewMockMounter(ctrl)
 				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
-				m.EXPECT().PathExists(gomock.Any()).Return(true, nil)
-				m.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("", 1, nil)
-				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
-				m.EXPECT().NeedResize(gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path")).Return(false, errors.New("need resize error"))
+				m.EXPECT().PathExists(gomock.Eq("/staging/path")).Return(true, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("", 1, nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path"), gomock.Eq("ext4"), gomock.Eq([]string{"journal_async_commit"}), gomock.Any(), gomock.Any()).Return(nil)
+				m.EXPECT().NeedResize(gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path")).Return(false, nil)
 				return m
 			},
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
@@ -846,53 +968,50 @@ func TestNodeStageVolume(t *testing.T) {
 				m.EXPECT().GetRegion().Return("us-west-2")
 				return m
 			},
-			expectedErr: status.Error(codes.Internal, "Could not determine if volume \"vol-test\" (\"/dev/xvdba\") need to be resized:  need resize error"),
+			expectedErr: nil,
 		},
 		{
-			name: "resize_error",
+			name: "ext4_journal_async_commit_with_data_mode",
 			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
 				VolumeCapability: &csi.VolumeCapability{
 					AccessType: &csi.VolumeCapability_Mount{
 						Mount: &csi.VolumeCapability_MountVolume{
-							FsType: "ext4",
+							FsType:     "ext4",
+							MountFlags: []string{"data=journal"},
 						},
 					},
 					AccessMode: &csi.VolumeCapability_AccessMode{
 						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
 					},
 				},
+				VolumeContext: map[string]string{
+					Ext4JournalChecksumKey: "true",
+					Ext4AsyncCommitKey:     "true",
+				},
 				PublishContext: map[string]string{
 					DevicePathKey: "/dev/xvdba",
 				},
 			},
 			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
 				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
-				m.EXPECT().PathExists(gomock.Any()).Return(true, nil)
-				m.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("", 1, nil)
-				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
-				m.EXPECT().NeedResize(gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path")).Return(true, nil)
-				m.EXPECT().Resize(gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path")).Return(false, errors.New("resize error"))
 				return m
 			},
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
-				m := metadata.NewMockMetadataService(ctrl)
-				m.EXPECT().GetRegion().Return("us-west-2")
-				return m
+				return nil
 			},
-			expectedErr: status.Error(codes.Internal, "Could not resize volume \"vol-test\" (\"/dev/xvdba\"):  resize error"),
+			expectedErr: status.Error(codes.InvalidArgument, "Cannot use ext4asynccommit with the data=journal mount option"),
 		},
 		{
-			name: "format_options_ext4",
+			name: "ext4_journal_checksum_with_xfs",
 			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
 				VolumeCapability: &csi.VolumeCapability{
 					AccessType: &csi.VolumeCapability_Mount{
 						Mount: &csi.VolumeCapability_MountVolume{
-							FsType: "ext4",
+							FsType: "xfs",
 						},
 					},
 					AccessMode: &csi.VolumeCapability_AccessMode{
@@ -900,12 +1019,7 @@ func TestNodeStageVolume(t *testing.T) {
 					},
 				},
 				VolumeContext: map[string]string{
-					BlockSizeKey:       "4096",
-					InodeSizeKey:       "512",
-					BytesPerInodeKey:   "16384",
-					NumberOfInodesKey:  "1000000",
-					Ext4BigAllocKey:    "true",
-					Ext4ClusterSizeKey: "65536",
+					Ext4JournalChecksumKey: "true",
 				},
 				PublishContext: map[string]string{
 					DevicePathKey: "/dev/xvdba",
@@ -913,29 +1027,22 @@ func TestNodeStageVolume(t *testing.T) {
 			},
 			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
 				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
-				m.EXPECT().PathExists(gomock.Eq("/staging/path")).Return(true, nil)
-				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("", 1, nil)
-				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path"), gomock.Eq("ext4"), gomock.Any(), gomock.Any(), gomock.Eq([]string{"-b", "4096", "-I", "512", "-i", "16384", "-N", "1000000", "-O", "bigalloc", "-C", "65536"})).Return(nil)
-				m.EXPECT().NeedResize(gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path")).Return(false, nil)
 				return m
 			},
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
-				m := metadata.NewMockMetadataService(ctrl)
-				m.EXPECT().GetRegion().Return("us-west-2")
-				return m
+				return nil
 			},
-			expectedErr: nil,
+			expectedErr: status.Error(codes.InvalidArgument, "Cannot use ext4journalchecksum with fstype xfs"),
 		},
 		{
-			name: "format_options_xfs",
+			name: "invalid_external_fs_management",
 			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
 				VolumeCapability: &csi.VolumeCapability{
 					AccessType: &csi.VolumeCapability_Mount{
 						Mount: &csi.VolumeCapability_MountVolume{
-							FsType: "xfs",
+							FsType: "ext4",
 						},
 					},
 					AccessMode: &csi.VolumeCapability_AccessMode{
@@ -943,8 +1050,7 @@ func TestNodeStageVolume(t *testing.T) {
 					},
 				},
 				VolumeContext: map[string]string{
-					BlockSizeKey: "4096",
-					InodeSizeKey: "512",
+					ExternalFsManagementKey: "operator",
 				},
 				PublishContext: map[string]string{
 					DevicePathKey: "/dev/xvdba",
@@ -952,301 +1058,296 @@ func TestNodeStageVolume(t *testing.T) {
 			},
 			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
 				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
-				m.EXPECT().PathExists(gomock.Eq("/staging/path")).Return(true, nil)
-				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("", 1, nil)
-				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path"), gomock.Eq("xfs"), gomock.Any(), gomock.Any(), gomock.Eq([]string{"-b", "size=4096", "-i", "size=512"})).Return(nil)
-				m.EXPECT().NeedResize(gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path")).Return(false, nil)
 				return m
 			},
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
-				m := metadata.NewMockMetadataService(ctrl)
-				m.EXPECT().GetRegion().Return("us-west-2")
-				return m
+				return nil
 			},
-			expectedErr: nil,
+			expectedErr: status.Error(codes.InvalidArgument, "Invalid ebs.csi.aws.com/externalFsManagement (operator): must be true or false"),
 		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			ctrl := gomock.NewController(t)
-			defer ctrl.Finish()
-
-			var mounter *mounter.MockMounter
-			if tc.mounterMock != nil {
-				mounter = tc.mounterMock(ctrl)
-			}
-
-			var metadata *metadata.MockMetadataService
-			if tc.metadataMock != nil {
-				metadata = tc.metadataMock(ctrl)
-			}
-
-			driver := &NodeService{
-				metadata: metadata,
-				mounter:  mounter,
-				inFlight: internal.NewInFlight(),
-			}
-
-			if tc.inflight {
-				driver.inFlight.Insert("vol-test")
-			}
-
-			_, err := driver.NodeStageVolume(context.Background(), tc.req)
-			if !reflect.DeepEqual(err, tc.expectedErr) {
-				t.Fatalf("Expected error '%v' but got '%v'", tc.expectedErr, err)
-			}
-		})
-	}
-}
-
-func TestGetVolumesLimit(t *testing.T) {
-	testCases := []struct {
-		name         string
-		expectedErr  error
-		expectedVal  int64
-		options      *Options
-		metadataMock func(ctrl *gomock.Controller) *metadata.MockMetadataService
-	}{
 		{
-			name: "VolumeAttachLimit_specified",
-			options: &Options{
-				VolumeAttachLimit:         10,
-				ReservedVolumeAttachments: -1,
+			name: "device_path_not_provided",
+			req: &csi.NodeStageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				VolumeContext: map[string]string{
+					Ext4ClusterSizeKey: "51",
+				},
+				PublishContext: map[string]string{},
 			},
-			expectedVal: 10,
-		},
-		{
-			name: "sbeDeviceVolumeAttachmentLimit",
-			options: &Options{
-				VolumeAttachLimit: -1,
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				return m
 			},
-			expectedVal: sbeDeviceVolumeAttachmentLimit,
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
-				m := metadata.NewMockMetadataService(ctrl)
-				m.EXPECT().GetRegion().Return("snow")
-				return m
+				return nil
 			},
+			expectedErr: status.Error(codes.InvalidArgument, "Device path not provided"),
 		},
 		{
-			name: "t2.medium_volume_attach_limit",
-			options: &Options{
-				VolumeAttachLimit:         -1,
-				ReservedVolumeAttachments: -1,
+			name: "volume_operation_already_exists",
+			req: &csi.NodeStageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
 			},
-			expectedVal: 38,
-			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
-				m := metadata.NewMockMetadataService(ctrl)
-				m.EXPECT().GetRegion().Return("us-west-2")
-				m.EXPECT().GetNumBlockDeviceMappings().Return(0)
-				m.EXPECT().GetInstanceType().Return("t2.medium")
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
 				return m
 			},
-		},
-		{
-			name: "ReservedVolumeAttachments_specified",
-			options: &Options{
-				VolumeAttachLimit:         -1,
-				ReservedVolumeAttachments: 3,
-			},
-			expectedVal: 36,
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
-				m := metadata.NewMockMetadataService(ctrl)
-				m.EXPECT().GetRegion().Return("us-west-2")
-				m.EXPECT().GetInstanceType().Return("t2.medium")
-				return m
+				return nil
 			},
+			expectedErr: status.Errorf(codes.Aborted, VolumeOperationAlreadyExists, "vol-test"),
+			inflight:    true,
 		},
 		{
-			name: "m5d.large_volume_attach_limit",
-			options: &Options{
-				VolumeAttachLimit:         -1,
-				ReservedVolumeAttachments: -1,
+			name: "valid_partition",
+			req: &csi.NodeStageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				VolumeContext: map[string]string{
+					VolumeAttributePartition: "1",
+				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), "1", gomock.Any()).Return("/dev/xvdba1", nil)
+				m.EXPECT().PathExists(gomock.Any()).Return(true, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("", 1, nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				m.EXPECT().NeedResize(gomock.Any(), gomock.Any()).Return(false, nil)
+				return m
 			},
-			expectedVal: 23,
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
 				m := metadata.NewMockMetadataService(ctrl)
 				m.EXPECT().GetRegion().Return("us-west-2")
-				m.EXPECT().GetInstanceType().Return("m5d.large")
-				m.EXPECT().GetNumBlockDeviceMappings().Return(0)
-				m.EXPECT().GetNumAttachedENIs().Return(3)
 				return m
 			},
+			expectedErr: nil,
 		},
 		{
-			name: "d3en.12xlarge_volume_attach_limit",
-			options: &Options{
-				VolumeAttachLimit:         -1,
-				ReservedVolumeAttachments: -1,
+			name: "invalid_partition",
+			req: &csi.NodeStageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				VolumeContext: map[string]string{
+					VolumeAttributePartition: "0",
+				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), "", gomock.Any()).Return("/dev/xvdba", nil)
+				m.EXPECT().PathExists(gomock.Any()).Return(true, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("", 1, nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				m.EXPECT().NeedResize(gomock.Any(), gomock.Any()).Return(false, nil)
+				return m
 			},
-			expectedVal: 1,
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
 				m := metadata.NewMockMetadataService(ctrl)
 				m.EXPECT().GetRegion().Return("us-west-2")
-				m.EXPECT().GetInstanceType().Return("d3en.12xlarge")
-				m.EXPECT().GetNumBlockDeviceMappings().Return(0)
-				m.EXPECT().GetNumAttachedENIs().Return(1)
 				return m
 			},
+			expectedErr: nil,
 		},
 		{
-			name: "d3.8xlarge_volume_attach_limit",
-			options: &Options{
-				VolumeAttachLimit:         -1,
-				ReservedVolumeAttachments: -1,
+			name: "valid_partition_nvme",
+			req: &csi.NodeStageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				VolumeContext: map[string]string{
+					VolumeAttributePartition: "1",
+				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), "1", gomock.Any()).Return("/dev/nvme1n1p1", nil)
+				m.EXPECT().PathExists(gomock.Any()).Return(true, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("", 1, nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Eq("/dev/nvme1n1p1"), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				m.EXPECT().NeedResize(gomock.Eq("/dev/nvme1n1p1"), gomock.Any()).Return(false, nil)
+				return m
 			},
-			expectedVal: 1,
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
 				m := metadata.NewMockMetadataService(ctrl)
 				m.EXPECT().GetRegion().Return("us-west-2")
-				m.EXPECT().GetInstanceType().Return("d3.8xlarge")
-				m.EXPECT().GetNumBlockDeviceMappings().Return(0)
-				m.EXPECT().GetNumAttachedENIs().Return(1)
 				return m
 			},
+			expectedErr: nil,
 		},
 		{
-			name: "nitro_volume_attach_limit",
-			options: &Options{
-				VolumeAttachLimit:         -1,
-				ReservedVolumeAttachments: -1,
+			name: "valid_partition_nvme_leading_zero",
+			req: &csi.NodeStageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				VolumeContext: map[string]string{
+					VolumeAttributePartition: "01",
+				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), "1", gomock.Any()).Return("/dev/nvme1n1p1", nil)
+				m.EXPECT().PathExists(gomock.Any()).Return(true, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("", 1, nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Eq("/dev/nvme1n1p1"), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				m.EXPECT().NeedResize(gomock.Eq("/dev/nvme1n1p1"), gomock.Any()).Return(false, nil)
+				return m
 			},
-			expectedVal: 127,
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
 				m := metadata.NewMockMetadataService(ctrl)
 				m.EXPECT().GetRegion().Return("us-west-2")
-				m.EXPECT().GetInstanceType().Return("m7i.48xlarge")
-				m.EXPECT().GetNumBlockDeviceMappings().Return(0)
 				return m
 			},
+			expectedErr: nil,
 		},
 		{
-			name: "attached_max_enis",
-			options: &Options{
-				VolumeAttachLimit: -1,
+			name: "invalid_partition_nvme",
+			req: &csi.NodeStageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				VolumeContext: map[string]string{
+					VolumeAttributePartition: "0",
+				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), "", gomock.Any()).Return("/dev/nvme1n1", nil)
+				m.EXPECT().PathExists(gomock.Any()).Return(true, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("", 1, nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Eq("/dev/nvme1n1"), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				m.EXPECT().NeedResize(gomock.Eq("/dev/nvme1n1"), gomock.Any()).Return(false, nil)
+				return m
 			},
-			expectedVal: 1,
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
 				m := metadata.NewMockMetadataService(ctrl)
 				m.EXPECT().GetRegion().Return("us-west-2")
-				m.EXPECT().GetInstanceType().Return("t3.xlarge")
-				m.EXPECT().GetNumAttachedENIs().Return(40)
 				return m
 			},
+			expectedErr: nil,
 		},
 		{
-			name: "inf1.24xlarge_volume_attach_limit",
-			options: &Options{
-				VolumeAttachLimit:         -1,
-				ReservedVolumeAttachments: -1,
-			},
-			expectedVal: 9,
-			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
-				m := metadata.NewMockMetadataService(ctrl)
-				m.EXPECT().GetRegion().Return("us-west-2")
-				m.EXPECT().GetInstanceType().Return("inf1.24xlarge")
-				m.EXPECT().GetNumAttachedENIs().Return(1)
-				m.EXPECT().GetNumBlockDeviceMappings().Return(0)
-				return m
-			},
-		},
-		{
-			name: "mac1.metal_volume_attach_limit",
-			options: &Options{
-				VolumeAttachLimit:         -1,
-				ReservedVolumeAttachments: -1,
-			},
-			expectedVal: 14,
-			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
-				m := metadata.NewMockMetadataService(ctrl)
-				m.EXPECT().GetRegion().Return("us-west-2")
-				m.EXPECT().GetInstanceType().Return("mac1.metal")
-				m.EXPECT().GetNumBlockDeviceMappings().Return(0)
-				m.EXPECT().GetNumAttachedENIs().Return(1)
-				return m
-			},
-		},
-		{
-			name: "u-12tb1.metal_volume_attach_limit",
-			options: &Options{
-				VolumeAttachLimit:         -1,
-				ReservedVolumeAttachments: -1,
-			},
-			expectedVal: 17,
-			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
-				m := metadata.NewMockMetadataService(ctrl)
-				m.EXPECT().GetRegion().Return("us-west-2")
-				m.EXPECT().GetInstanceType().Return("u-12tb1.metal")
-				m.EXPECT().GetNumBlockDeviceMappings().Return(0)
-				m.EXPECT().GetNumAttachedENIs().Return(1)
-				return m
-			},
-		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			ctrl := gomock.NewController(t)
-			defer ctrl.Finish()
-
-			var mounter *mounter.MockMounter
-
-			var metadata *metadata.MockMetadataService
-			if tc.metadataMock != nil {
-				metadata = tc.metadataMock(ctrl)
-			}
-
-			driver := &NodeService{
-				mounter:  mounter,
-				inFlight: internal.NewInFlight(),
-				options:  tc.options,
-				metadata: metadata,
-			}
-
-			value := driver.getVolumesLimit()
-			if value != tc.expectedVal {
-				t.Fatalf("Expected value %v but got %v", tc.expectedVal, value)
-			}
-		})
-	}
-}
-
-func TestNodePublishVolume(t *testing.T) {
-	testCases := []struct {
-		name         string
-		req          *csi.NodePublishVolumeRequest
-		mounterMock  func(ctrl *gomock.Controller) *mounter.MockMounter
-		metadataMock func(ctrl *gomock.Controller) *metadata.MockMetadataService
-		expectedErr  error
-		inflight     bool
-	}{
-		{
-			name: "success_block_device",
-			req: &csi.NodePublishVolumeRequest{
+			name: "invalid_partition_nvme_leading_zero",
+			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
-				TargetPath:        "/target/path",
 				VolumeCapability: &csi.VolumeCapability{
-					AccessType: &csi.VolumeCapability_Block{
-						Block: &csi.VolumeCapability_BlockVolume{},
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
 					},
 					AccessMode: &csi.VolumeCapability_AccessMode{
 						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
 					},
 				},
+				VolumeContext: map[string]string{
+					VolumeAttributePartition: "00",
+				},
 				PublishContext: map[string]string{
 					DevicePathKey: "/dev/xvdba",
 				},
 			},
 			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
 				m := mounter.NewMockMounter(ctrl)
-
-				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), "", gomock.Any()).Return("/dev/nvme1n1", nil)
 				m.EXPECT().PathExists(gomock.Any()).Return(true, nil)
-				m.EXPECT().MakeFile(gomock.Any()).Return(nil)
-				m.EXPECT().IsLikelyNotMountPoint(gomock.Any()).Return(true, nil)
-				m.EXPECT().Mount(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("", 1, nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Eq("/dev/nvme1n1"), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				m.EXPECT().NeedResize(gomock.Eq("/dev/nvme1n1"), gomock.Any()).Return(false, nil)
 				return m
 			},
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
@@ -1254,111 +1355,118 @@ func TestNodePublishVolume(t *testing.T) {
 				m.EXPECT().GetRegion().Return("us-west-2")
 				return m
 			},
+			expectedErr: nil,
 		},
 		{
-			name: "success_fs",
-			req: &csi.NodePublishVolumeRequest{
+			name: "valid_partition_label",
+			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
-				TargetPath:        "/target/path",
 				VolumeCapability: &csi.VolumeCapability{
 					AccessType: &csi.VolumeCapability_Mount{
-						Mount: &csi.VolumeCapability_MountVolume{},
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
 					},
 					AccessMode: &csi.VolumeCapability_AccessMode{
 						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
 					},
 				},
+				VolumeContext: map[string]string{
+					VolumeAttributePartitionLabel: "data",
+				},
 				PublishContext: map[string]string{
 					DevicePathKey: "/dev/xvdba",
 				},
 			},
 			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
 				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().PreparePublishTarget(gomock.Any()).Return(nil)
-				m.EXPECT().IsLikelyNotMountPoint(gomock.Any()).Return(true, nil)
-				m.EXPECT().Mount(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), "partlabel:data", gomock.Any()).Return("/dev/nvme1n1p2", nil)
+				m.EXPECT().PathExists(gomock.Any()).Return(true, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("", 1, nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Eq("/dev/nvme1n1p2"), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				m.EXPECT().NeedResize(gomock.Eq("/dev/nvme1n1p2"), gomock.Any()).Return(false, nil)
 				return m
 			},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				return m
+			},
+			expectedErr: nil,
 		},
 		{
-			name: "volume_id_not_provided",
-			req: &csi.NodePublishVolumeRequest{
+			name: "partition_label_not_found",
+			req: &csi.NodeStageVolumeRequest{
+				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
-				TargetPath:        "/target/path",
 				VolumeCapability: &csi.VolumeCapability{
-					AccessType: &csi.VolumeCapability_Block{
-						Block: &csi.VolumeCapability_BlockVolume{},
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
 					},
 					AccessMode: &csi.VolumeCapability_AccessMode{
 						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
 					},
 				},
-				PublishContext: map[string]string{
-					DevicePathKey: "/dev/xvdba",
-				},
-			},
-			expectedErr: status.Error(codes.InvalidArgument, "Volume ID not provided"),
-		},
-		{
-			name: "staging_target_path_not_provided",
-			req: &csi.NodePublishVolumeRequest{
-				VolumeId:   "vol-test",
-				TargetPath: "/target/path",
-				VolumeCapability: &csi.VolumeCapability{
-					AccessType: &csi.VolumeCapability_Block{
-						Block: &csi.VolumeCapability_BlockVolume{},
-					},
-					AccessMode: &csi.VolumeCapability_AccessMode{
-						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
-					},
+				VolumeContext: map[string]string{
+					VolumeAttributePartitionLabel: "data",
 				},
 				PublishContext: map[string]string{
 					DevicePathKey: "/dev/xvdba",
 				},
 			},
-			expectedErr: status.Error(codes.InvalidArgument, "Staging target not provided"),
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), "partlabel:data", gomock.Any()).Return("", errors.New("partition label \"data\" not found"))
+				return m
+			},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				return m
+			},
+			expectedErr: status.Error(codes.Internal, "Failed to find device path /dev/xvdba. partition label \"data\" not found"),
 		},
 		{
-			name: "target_path_not_provided",
-			req: &csi.NodePublishVolumeRequest{
+			name: "partition_and_partition_label",
+			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
 				VolumeCapability: &csi.VolumeCapability{
-					AccessType: &csi.VolumeCapability_Block{
-						Block: &csi.VolumeCapability_BlockVolume{},
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
 					},
 					AccessMode: &csi.VolumeCapability_AccessMode{
 						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
 					},
 				},
-				PublishContext: map[string]string{
-					DevicePathKey: "/dev/xvdba",
+				VolumeContext: map[string]string{
+					VolumeAttributePartition:      "1",
+					VolumeAttributePartitionLabel: "data",
 				},
-			},
-			expectedErr: status.Error(codes.InvalidArgument, "Target path not provided"),
-		},
-		{
-			name: "capability_not_provided",
-			req: &csi.NodePublishVolumeRequest{
-				VolumeId:          "vol-test",
-				StagingTargetPath: "/staging/path",
-				TargetPath:        "/target/path",
 				PublishContext: map[string]string{
 					DevicePathKey: "/dev/xvdba",
 				},
 			},
-			expectedErr: status.Error(codes.InvalidArgument, "Volume capability not provided"),
+			mounterMock:  nil,
+			metadataMock: nil,
+			expectedErr:  status.Error(codes.InvalidArgument, "Volume attributes partition and partitionLabel are mutually exclusive"),
 		},
 		{
-			name: "success_block_device",
-			req: &csi.NodePublishVolumeRequest{
+			name: "find_device_path_error",
+			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
-				TargetPath:        "/target/path",
 				VolumeCapability: &csi.VolumeCapability{
-					AccessType: &csi.VolumeCapability_Block{
-						Block: &csi.VolumeCapability_BlockVolume{},
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
 					},
 					AccessMode: &csi.VolumeCapability_AccessMode{
 						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
@@ -1368,38 +1476,60 @@ func TestNodePublishVolume(t *testing.T) {
 					DevicePathKey: "/dev/xvdba",
 				},
 			},
-			inflight:    true,
-			expectedErr: status.Errorf(codes.Aborted, VolumeOperationAlreadyExists, "vol-test"),
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().FindDevicePath(gomock.Eq("/dev/xvdba"), gomock.Eq("vol-test"), gomock.Eq(""), gomock.Eq("us-west-2")).Return("", errors.New("find device path error"))
+				return m
+			},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				return m
+			},
+			expectedErr: status.Errorf(codes.Internal, "Failed to find device path %s. %v", "/dev/xvdba", errors.New("find device path error")),
 		},
 		{
-			name: "success_block_device",
-			req: &csi.NodePublishVolumeRequest{
+			name: "path_exists_error",
+			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
-				TargetPath:        "/target/path",
 				VolumeCapability: &csi.VolumeCapability{
-					AccessType: &csi.VolumeCapability_Block{
-						Block: &csi.VolumeCapability_BlockVolume{},
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
 					},
 					AccessMode: &csi.VolumeCapability_AccessMode{
-						Mode: csi.VolumeCapability_AccessMode_Mode(csi.ControllerServiceCapability_RPC_UNKNOWN),
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
 					},
 				},
 				PublishContext: map[string]string{
 					DevicePathKey: "/dev/xvdba",
 				},
 			},
-			expectedErr: status.Errorf(codes.InvalidArgument, "Volume capability not supported"),
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
+				m.EXPECT().PathExists(gomock.Eq("/staging/path")).Return(false, errors.New("path exists error"))
+				return m
+			},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				return m
+			},
+			expectedErr: status.Error(codes.Internal, "failed to check if target \"/staging/path\" exists: path exists error"),
 		},
 		{
-			name: "read_only_enabled",
-			req: &csi.NodePublishVolumeRequest{
+			name: "create_target_dir_error",
+			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
-				TargetPath:        "/target/path",
 				VolumeCapability: &csi.VolumeCapability{
-					AccessType: &csi.VolumeCapability_Block{
-						Block: &csi.VolumeCapability_BlockVolume{},
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
 					},
 					AccessMode: &csi.VolumeCapability_AccessMode{
 						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
@@ -1408,16 +1538,12 @@ func TestNodePublishVolume(t *testing.T) {
 				PublishContext: map[string]string{
 					DevicePathKey: "/dev/xvdba",
 				},
-				Readonly: true,
 			},
 			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
 				m := mounter.NewMockMounter(ctrl)
-
 				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
-				m.EXPECT().PathExists(gomock.Any()).Return(true, nil)
-				m.EXPECT().MakeFile(gomock.Any()).Return(nil)
-				m.EXPECT().IsLikelyNotMountPoint(gomock.Any()).Return(true, nil)
-				m.EXPECT().Mount(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				m.EXPECT().PathExists(gomock.Eq("/staging/path")).Return(false, nil)
+				m.EXPECT().MakeDir(gomock.Eq("/staging/path")).Return(errors.New("make dir error"))
 				return m
 			},
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
@@ -1425,33 +1551,51 @@ func TestNodePublishVolume(t *testing.T) {
 				m.EXPECT().GetRegion().Return("us-west-2")
 				return m
 			},
+			expectedErr: status.Error(codes.Internal, "could not create target dir \"/staging/path\": make dir error"),
 		},
 		{
-			name: "nodePublishVolumeForBlock_error",
-			req: &csi.NodePublishVolumeRequest{
+			name: "get_device_name_from_mount_error",
+			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
-				TargetPath:        "/target/path",
 				VolumeCapability: &csi.VolumeCapability{
-					AccessType: &csi.VolumeCapability_Block{
-						Block: &csi.VolumeCapability_BlockVolume{},
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
 					},
 					AccessMode: &csi.VolumeCapability_AccessMode{
 						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
 					},
 				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
 			},
-			expectedErr: status.Errorf(codes.InvalidArgument, "Device path not provided"),
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
+				m.EXPECT().PathExists(gomock.Eq("/staging/path")).Return(true, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("", 0, errors.New("get device name error"))
+				return m
+			},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				return m
+			},
+			expectedErr: status.Error(codes.Internal, "failed to check if volume is already mounted: get device name error"),
 		},
 		{
-			name: "nodePublishVolumeForBlock_invalid_volume_attribute",
-			req: &csi.NodePublishVolumeRequest{
+			name: "volume_already_staged",
+			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
-				TargetPath:        "/target/path",
 				VolumeCapability: &csi.VolumeCapability{
-					AccessType: &csi.VolumeCapability_Block{
-						Block: &csi.VolumeCapability_BlockVolume{},
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
 					},
 					AccessMode: &csi.VolumeCapability_AccessMode{
 						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
@@ -1460,21 +1604,31 @@ func TestNodePublishVolume(t *testing.T) {
 				PublishContext: map[string]string{
 					DevicePathKey: "/dev/xvdba",
 				},
-				VolumeContext: map[string]string{
-					VolumeAttributePartition: "invalid-partition",
-				},
 			},
-			expectedErr: status.Error(codes.InvalidArgument, "Volume Attribute is invalid"),
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
+				m.EXPECT().PathExists(gomock.Eq("/staging/path")).Return(true, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("/dev/xvdba", 1, nil)
+				return m
+			},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				return m
+			},
+			expectedErr: nil,
 		},
 		{
-			name: "nodePublishVolumeForBlock_invalid_partition",
-			req: &csi.NodePublishVolumeRequest{
+			name: "format_and_mount_error",
+			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
-				TargetPath:        "/target/path",
 				VolumeCapability: &csi.VolumeCapability{
-					AccessType: &csi.VolumeCapability_Block{
-						Block: &csi.VolumeCapability_BlockVolume{},
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
 					},
 					AccessMode: &csi.VolumeCapability_AccessMode{
 						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
@@ -1483,18 +1637,14 @@ func TestNodePublishVolume(t *testing.T) {
 				PublishContext: map[string]string{
 					DevicePathKey: "/dev/xvdba",
 				},
-				VolumeContext: map[string]string{
-					VolumeAttributePartition: "0",
-				},
 			},
 			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
 				m := mounter.NewMockMounter(ctrl)
-
 				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
-				m.EXPECT().PathExists(gomock.Any()).Return(true, nil)
-				m.EXPECT().MakeFile(gomock.Any()).Return(nil)
-				m.EXPECT().IsLikelyNotMountPoint(gomock.Any()).Return(true, nil)
-				m.EXPECT().Mount(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				m.EXPECT().PathExists(gomock.Eq("/staging/path")).Return(true, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("", 1, nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path"), gomock.Eq("ext4"), gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("format and mount error"))
 				return m
 			},
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
@@ -1502,16 +1652,18 @@ func TestNodePublishVolume(t *testing.T) {
 				m.EXPECT().GetRegion().Return("us-west-2")
 				return m
 			},
+			expectedErr: status.Error(codes.Internal, "could not format \"/dev/xvdba\" and mount it at \"/staging/path\": format and mount error"),
 		},
 		{
-			name: "nodePublishVolumeForBlock_valid_partition",
-			req: &csi.NodePublishVolumeRequest{
+			name: "need_resize_error",
+			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
-				TargetPath:        "/target/path",
 				VolumeCapability: &csi.VolumeCapability{
-					AccessType: &csi.VolumeCapability_Block{
-						Block: &csi.VolumeCapability_BlockVolume{},
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
 					},
 					AccessMode: &csi.VolumeCapability_AccessMode{
 						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
@@ -1520,18 +1672,15 @@ func TestNodePublishVolume(t *testing.T) {
 				PublishContext: map[string]string{
 					DevicePathKey: "/dev/xvdba",
 				},
-				VolumeContext: map[string]string{
-					VolumeAttributePartition: "1",
-				},
 			},
 			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
 				m := mounter.NewMockMounter(ctrl)
-
 				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
 				m.EXPECT().PathExists(gomock.Any()).Return(true, nil)
-				m.EXPECT().MakeFile(gomock.Any()).Return(nil)
-				m.EXPECT().IsLikelyNotMountPoint(gomock.Any()).Return(true, nil)
-				m.EXPECT().Mount(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("", 1, nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				m.EXPECT().NeedResize(gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path")).Return(false, errors.New("need resize error"))
 				return m
 			},
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
@@ -1539,16 +1688,18 @@ func TestNodePublishVolume(t *testing.T) {
 				m.EXPECT().GetRegion().Return("us-west-2")
 				return m
 			},
+			expectedErr: status.Error(codes.Internal, "Could not determine if volume \"vol-test\" (\"/dev/xvdba\") need to be resized:  need resize error"),
 		},
 		{
-			name: "nodePublishVolumeForBlock_device_path_failure",
-			req: &csi.NodePublishVolumeRequest{
+			name: "resize_error",
+			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
-				TargetPath:        "/target/path",
 				VolumeCapability: &csi.VolumeCapability{
-					AccessType: &csi.VolumeCapability_Block{
-						Block: &csi.VolumeCapability_BlockVolume{},
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
 					},
 					AccessMode: &csi.VolumeCapability_AccessMode{
 						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
@@ -1560,8 +1711,13 @@ func TestNodePublishVolume(t *testing.T) {
 			},
 			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
 				m := mounter.NewMockMounter(ctrl)
-
-				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("", errors.New("device path error"))
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
+				m.EXPECT().PathExists(gomock.Any()).Return(true, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("", 1, nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				m.EXPECT().NeedResize(gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path")).Return(true, nil)
+				m.EXPECT().Resize(gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path")).Return(false, errors.New("resize error"))
 				return m
 			},
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
@@ -1569,351 +1725,485 @@ func TestNodePublishVolume(t *testing.T) {
 				m.EXPECT().GetRegion().Return("us-west-2")
 				return m
 			},
-			expectedErr: status.Error(codes.Internal, "Failed to find device path /dev/xvdba. device path error"),
+			expectedErr: status.Error(codes.Internal, "Could not resize volume \"vol-test\" (\"/dev/xvdba\"):  resize error"),
 		},
-	}
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			ctrl := gomock.NewController(t)
-			defer ctrl.Finish()
-
-			var mounter *mounter.MockMounter
-			if tc.mounterMock != nil {
-				mounter = tc.mounterMock(ctrl)
-			}
-
-			var metadata *metadata.MockMetadataService
-			if tc.metadataMock != nil {
-				metadata = tc.metadataMock(ctrl)
-			}
-
-			driver := &NodeService{
-				metadata: metadata,
-				mounter:  mounter,
-				inFlight: internal.NewInFlight(),
-			}
-
-			if tc.inflight {
-				driver.inFlight.Insert("vol-test")
-			}
-
-			_, err := driver.NodePublishVolume(context.Background(), tc.req)
-			if !reflect.DeepEqual(err, tc.expectedErr) {
-				t.Fatalf("Expected error '%v' but got '%v'", tc.expectedErr, err)
-			}
-		})
-	}
-}
-
-func TestNodeUnstageVolume(t *testing.T) {
-	testCases := []struct {
-		name        string
-		req         *csi.NodeUnstageVolumeRequest
-		mounterMock func(ctrl *gomock.Controller) *mounter.MockMounter
-		expectedErr error
-		inflight    bool
-	}{
 		{
-			name: "success",
-			req: &csi.NodeUnstageVolumeRequest{
+			name: "format_options_ext4",
+			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				VolumeContext: map[string]string{
+					BlockSizeKey:       "4096",
+					InodeSizeKey:       "512",
+					BytesPerInodeKey:   "16384",
+					NumberOfInodesKey:  "1000000",
+					Ext4BigAllocKey:    "true",
+					Ext4ClusterSizeKey: "65536",
+				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
 			},
 			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
 				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("dev-test", 1, nil)
-				m.EXPECT().Unstage(gomock.Any()).Return(nil)
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
+				m.EXPECT().PathExists(gomock.Eq("/staging/path")).Return(true, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("", 1, nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path"), gomock.Eq("ext4"), gomock.Any(), gomock.Any(), gomock.Eq([]string{"-b", "4096", "-I", "512", "-i", "16384", "-N", "1000000", "-O", "bigalloc", "-C", "65536"})).Return(nil)
+				m.EXPECT().NeedResize(gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path")).Return(false, nil)
 				return m
 			},
-		},
-		{
-			name: "missing_volume_id",
-			req: &csi.NodeUnstageVolumeRequest{
-				StagingTargetPath: "/staging/path",
-			},
-			expectedErr: status.Error(codes.InvalidArgument, "Volume ID not provided"),
-		},
-		{
-			name: "missing_staging_target",
-			req: &csi.NodeUnstageVolumeRequest{
-				VolumeId: "vol-test",
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				return m
 			},
-			expectedErr: status.Error(codes.InvalidArgument, "Staging target not provided"),
+			expectedErr: nil,
 		},
 		{
-			name: "unstage_failed",
-			req: &csi.NodeUnstageVolumeRequest{
+			name: "format_options_ext4_lazy_init",
+			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				VolumeContext: map[string]string{
+					Ext4LazyInitKey: "true",
+				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
 			},
 			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
 				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("", 1, nil)
-				m.EXPECT().Unstage(gomock.Any()).Return(errors.New("unstage failed"))
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
+				m.EXPECT().PathExists(gomock.Eq("/staging/path")).Return(true, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("", 1, nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path"), gomock.Eq("ext4"), gomock.Any(), gomock.Any(), gomock.Eq([]string{"-E", "lazy_itable_init=1,lazy_journal_init=1"})).Return(nil)
+				m.EXPECT().NeedResize(gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path")).Return(false, nil)
+				return m
+			},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
 				return m
 			},
-			expectedErr: status.Errorf(codes.Internal, "Could not unmount target %q: %v", "/staging/path", errors.New("unstage failed")),
+			expectedErr: nil,
 		},
 		{
-			name: "target_not_mounted",
-			req: &csi.NodeUnstageVolumeRequest{
+			name: "format_options_ext4_no_lazy_init",
+			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				VolumeContext: map[string]string{
+					Ext4StrideKey:   "16",
+					Ext4LazyInitKey: "false",
+				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
 			},
 			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
 				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("", 0, nil)
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
+				m.EXPECT().PathExists(gomock.Eq("/staging/path")).Return(true, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("", 1, nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path"), gomock.Eq("ext4"), gomock.Any(), gomock.Any(), gomock.Eq([]string{"-E", "stride=16,lazy_itable_init=0"})).Return(nil)
+				m.EXPECT().NeedResize(gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path")).Return(false, nil)
 				return m
 			},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				return m
+			},
+			expectedErr: nil,
 		},
 		{
-			name: "get_device_name_from_mount_failed",
-			req: &csi.NodeUnstageVolumeRequest{
+			name: "format_options_ntfs",
+			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ntfs",
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				VolumeContext: map[string]string{
+					NTFSAllocationUnitSizeKey: "65536",
+					VolumeLabelKey:            "SQL Data",
+				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
 			},
 			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
 				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("", 0, errors.New("failed to get device name"))
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
+				m.EXPECT().PathExists(gomock.Eq("/staging/path")).Return(true, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("", 1, nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path"), gomock.Eq("ntfs"), gomock.Any(), gomock.Any(), gomock.Eq([]string{"-AllocationUnitSize", "65536", "-NewFileSystemLabel", "SQL Data"})).Return(nil)
+				m.EXPECT().NeedResize(gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path")).Return(false, nil)
 				return m
 			},
-			expectedErr: status.Error(codes.Internal, "failed to check if target \"/staging/path\" is a mount point: failed to get device name"),
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				return m
+			},
+			expectedErr: nil,
 		},
 		{
-			name: "multiple_references",
-			req: &csi.NodeUnstageVolumeRequest{
+			name: "format_options_ext4_stripe",
+			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				VolumeContext: map[string]string{
+					BlockSizeKey:       "4096",
+					Ext4StrideKey:      "16",
+					Ext4StripeWidthKey: "64",
+				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
 			},
 			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
 				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("dev-test", 2, nil)
-				m.EXPECT().Unstage(gomock.Any()).Return(nil)
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
+				m.EXPECT().PathExists(gomock.Eq("/staging/path")).Return(true, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("", 1, nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path"), gomock.Eq("ext4"), gomock.Any(), gomock.Any(), gomock.Eq([]string{"-b", "4096", "-E", "stride=16,stripe-width=64"})).Return(nil)
+				m.EXPECT().NeedResize(gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path")).Return(false, nil)
+				return m
+			},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
 				return m
 			},
+			expectedErr: nil,
 		},
 		{
-			name: "operation_already_exists",
-			req: &csi.NodeUnstageVolumeRequest{
+			name: "format_options_xfs",
+			req: &csi.NodeStageVolumeRequest{
 				VolumeId:          "vol-test",
 				StagingTargetPath: "/staging/path",
-			},
-			expectedErr: status.Error(codes.Aborted, "An operation with the given volume=\"vol-test\" is already in progress"),
-			inflight:    true,
-		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			ctrl := gomock.NewController(t)
-			defer ctrl.Finish()
-
-			var mounter *mounter.MockMounter
-			if tc.mounterMock != nil {
-				mounter = tc.mounterMock(ctrl)
-			}
-
-			driver := &NodeService{
-				mounter:  mounter,
-				inFlight: internal.NewInFlight(),
-			}
-
-			if tc.inflight {
-				driver.inFlight.Insert("vol-test")
-			}
-
-			_, err := driver.NodeUnstageVolume(context.Background(), tc.req)
-			if !reflect.DeepEqual(err, tc.expectedErr) {
-				t.Fatalf("Expected error '%v' but got '%v'", tc.expectedErr, err)
-			}
-		})
-	}
-}
-
-func TestNodeGetCapabilities(t *testing.T) {
-	req := &csi.NodeGetCapabilitiesRequest{}
-	expectedCaps := []*csi.NodeServiceCapability{
-		{
-			Type: &csi.NodeServiceCapability_Rpc{
-				Rpc: &csi.NodeServiceCapability_RPC{
-					Type: csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME,
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "xfs",
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
 				},
-			},
-		},
-		{
-			Type: &csi.NodeServiceCapability_Rpc{
-				Rpc: &csi.NodeServiceCapability_RPC{
-					Type: csi.NodeServiceCapability_RPC_EXPAND_VOLUME,
+				VolumeContext: map[string]string{
+					BlockSizeKey: "4096",
+					InodeSizeKey: "512",
 				},
-			},
-		},
-		{
-			Type: &csi.NodeServiceCapability_Rpc{
-				Rpc: &csi.NodeServiceCapability_RPC{
-					Type: csi.NodeServiceCapability_RPC_GET_VOLUME_STATS,
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
 				},
 			},
-		},
-	}
-
-	driver := &NodeService{}
-
-	resp, err := driver.NodeGetCapabilities(context.Background(), req)
-	if err != nil {
-		t.Fatalf("Unexpected error: %v", err)
-	}
-
-	if len(resp.GetCapabilities()) != len(expectedCaps) {
-		t.Fatalf("Expected %d capabilities, but got %d", len(expectedCaps), len(resp.GetCapabilities()))
-	}
-
-	for i, cap := range resp.GetCapabilities() {
-		if cap.GetRpc().GetType() != expectedCaps[i].GetRpc().GetType() {
-			t.Fatalf("Expected capability %v, but got %v", expectedCaps[i].GetRpc().GetType(), cap.GetRpc().GetType())
-		}
-	}
-}
-
-func TestNodeGetInfo(t *testing.T) {
-	testCases := []struct {
-		name         string
-		metadataMock func(ctrl *gomock.Controller) *metadata.MockMetadataService
-		expectedResp *csi.NodeGetInfoResponse
-	}{
-		{
-			name: "without_outpost_arn",
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
+				m.EXPECT().PathExists(gomock.Eq("/staging/path")).Return(true, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("", 1, nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path"), gomock.Eq("xfs"), gomock.Any(), gomock.Any(), gomock.Eq([]string{"-b", "size=4096", "-i", "size=512"})).Return(nil)
+				m.EXPECT().NeedResize(gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path")).Return(false, nil)
+				return m
+			},
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
 				m := metadata.NewMockMetadataService(ctrl)
-				m.EXPECT().GetInstanceID().Return("i-1234567890abcdef0")
-				m.EXPECT().GetAvailabilityZone().Return("us-west-2a")
-				m.EXPECT().GetOutpostArn().Return(arn.ARN{})
+				m.EXPECT().GetRegion().Return("us-west-2")
 				return m
 			},
-			expectedResp: &csi.NodeGetInfoResponse{
-				NodeId: "i-1234567890abcdef0",
-				AccessibleTopology: &csi.Topology{
-					Segments: map[string]string{
-						ZoneTopologyKey:          "us-west-2a",
-						WellKnownZoneTopologyKey: "us-west-2a",
-						OSTopologyKey:            runtime.GOOS,
+			expectedErr: nil,
+		},
+		{
+			name: "xfs_metadata_features",
+			req: &csi.NodeStageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "xfs",
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
 					},
 				},
+				VolumeContext: map[string]string{
+					BlockSizeKey:     "4096",
+					XFSReflinkKey:    "false",
+					XFSBigtimeKey:    "false",
+					XFSInobtcountKey: "true",
+				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
+				m.EXPECT().PathExists(gomock.Eq("/staging/path")).Return(true, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("", 1, nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path"), gomock.Eq("xfs"), gomock.Any(), gomock.Any(), gomock.Eq([]string{"-b", "size=4096", "-m", "reflink=0,bigtime=0,inobtcount=1"})).Return(nil)
+				m.EXPECT().NeedResize(gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path")).Return(false, nil)
+				return m
 			},
-		},
-		{
-			name: "with_outpost_arn",
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
 				m := metadata.NewMockMetadataService(ctrl)
-				m.EXPECT().GetInstanceID().Return("i-1234567890abcdef0")
-				m.EXPECT().GetAvailabilityZone().Return("us-west-2a")
-				m.EXPECT().GetOutpostArn().Return(arn.ARN{
-					Partition: "aws",
-					Service:   "outposts",
-					Region:    "us-west-2",
-					AccountID: "123456789012",
-					Resource:  "op-1234567890abcdef0",
-				})
+				m.EXPECT().GetRegion().Return("us-west-2")
 				return m
 			},
-			expectedResp: &csi.NodeGetInfoResponse{
-				NodeId: "i-1234567890abcdef0",
-				AccessibleTopology: &csi.Topology{
-					Segments: map[string]string{
-						ZoneTopologyKey:          "us-west-2a",
-						WellKnownZoneTopologyKey: "us-west-2a",
-						OSTopologyKey:            runtime.GOOS,
-						AwsRegionKey:             "us-west-2",
-						AwsPartitionKey:          "aws",
-						AwsAccountIDKey:          "123456789012",
-						AwsOutpostIDKey:          "op-1234567890abcdef0",
+			expectedErr: nil,
+		},
+		{
+			name: "xfs_metadata_feature_enabled",
+			req: &csi.NodeStageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "xfs",
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
 					},
 				},
+				VolumeContext: map[string]string{
+					XFSReflinkKey: "true",
+				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
+				m.EXPECT().PathExists(gomock.Eq("/staging/path")).Return(true, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("", 1, nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path"), gomock.Eq("xfs"), gomock.Any(), gomock.Any(), gomock.Eq([]string{"-m", "reflink=1"})).Return(nil)
+				m.EXPECT().NeedResize(gomock.Eq("/dev/xvdba"), gomock.Eq("/staging/path")).Return(false, nil)
+				return m
+			},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				return m
 			},
+			expectedErr: nil,
 		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			ctrl := gomock.NewController(t)
-			defer ctrl.Finish()
-
-			metadataService := tc.metadataMock(ctrl)
-			mounter := mounter.NewMockMounter(ctrl)
-
-			driver := &NodeService{
-				metadata: metadataService,
-				mounter:  mounter,
-				inFlight: internal.NewInFlight(),
-				options:  &Options{},
-			}
-
-			resp, err := driver.NodeGetInfo(context.Background(), &csi.NodeGetInfoRequest{})
-			if err != nil {
-				t.Fatalf("Unexpected error: %v", err)
-			}
-
-			if !reflect.DeepEqual(resp, tc.expectedResp) {
-				t.Fatalf("Expected response %+v, but got %+v", tc.expectedResp, resp)
-			}
-		})
-	}
-}
-
-func TestNodeUnpublishVolume(t *testing.T) {
-	testCases := []struct {
-		name        string
-		req         *csi.NodeUnpublishVolumeRequest
-		mounterMock func(ctrl *gomock.Controller) *mounter.MockMounter
-		expectedErr error
-		inflight    bool
-	}{
 		{
-			name: "success",
-			req: &csi.NodeUnpublishVolumeRequest{
-				VolumeId:   "vol-test",
-				TargetPath: "/target/path",
+			name: "invalid_xfs_metadata_feature",
+			req: &csi.NodeStageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "xfs",
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				VolumeContext: map[string]string{
+					XFSBigtimeKey: "off",
+				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
 			},
 			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
 				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().Unpublish(gomock.Eq("/target/path")).Return(nil)
 				return m
 			},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				return nil
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "Invalid xfsbigtime (off): must be true or false"),
 		},
 		{
-			name: "missing_volume_id",
-			req: &csi.NodeUnpublishVolumeRequest{
-				TargetPath: "/target/path",
+			name: "xfs_metadata_feature_with_ext4",
+			req: &csi.NodeStageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				VolumeContext: map[string]string{
+					XFSReflinkKey: "false",
+				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
 			},
-			expectedErr: status.Error(codes.InvalidArgument, "Volume ID not provided"),
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				return m
+			},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				return nil
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "Cannot use xfsreflink with fstype ext4"),
 		},
 		{
-			name: "missing_target_path",
-			req: &csi.NodeUnpublishVolumeRequest{
-				VolumeId: "vol-test",
+			name: "staging_path_conflict",
+			req: &csi.NodeStageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				PublishContext: map[string]string{DevicePathKey: "/dev/xvdba"},
 			},
-			expectedErr: status.Error(codes.InvalidArgument, "Target path not provided"),
+			stagedPath: "/other/staging/path",
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/other/staging/path")).Return("/dev/xvdba", 1, nil)
+				return m
+			},
+			expectedErr: status.Error(codes.FailedPrecondition, "Volume vol-test is already staged at \"/other/staging/path\""),
 		},
 		{
-			name: "unpublish_failed",
-			req: &csi.NodeUnpublishVolumeRequest{
-				VolumeId:   "vol-test",
-				TargetPath: "/target/path",
+			name: "stale_staging_path",
+			req: &csi.NodeStageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				PublishContext: map[string]string{DevicePathKey: "/dev/xvdba"},
 			},
+			stagedPath: "/other/staging/path",
 			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
 				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().Unpublish(gomock.Eq("/target/path")).Return(errors.New("unpublish failed"))
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/other/staging/path")).Return("", 0, nil)
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
+				m.EXPECT().PathExists(gomock.Any()).Return(true, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("", 1, nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				m.EXPECT().NeedResize(gomock.Any(), gomock.Any()).Return(false, nil)
+				return m
+			},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
 				return m
 			},
-			expectedErr: status.Errorf(codes.Internal, "Could not unmount %q: %v", "/target/path", errors.New("unpublish failed")),
 		},
 		{
-			name: "operation_already_exists",
-			req: &csi.NodeUnpublishVolumeRequest{
-				VolumeId:   "vol-test",
-				TargetPath: "/target/path",
+			name: "same_staging_path_already_staged",
+			req: &csi.NodeStageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				PublishContext: map[string]string{DevicePathKey: "/dev/xvdba"},
+			},
+			stagedPath: "/staging/path",
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
+				m.EXPECT().PathExists(gomock.Any()).Return(true, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("/dev/xvdba", 1, nil)
+				return m
+			},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				return m
 			},
-			expectedErr: status.Error(codes.Aborted, "An operation with the given volume=\"vol-test\" is already in progress"),
-			inflight:    true,
 		},
 	}
 
@@ -1927,363 +2217,580 @@ func TestNodeUnpublishVolume(t *testing.T) {
 				mounter = tc.mounterMock(ctrl)
 			}
 
+			var metadata *metadata.MockMetadataService
+			if tc.metadataMock != nil {
+				metadata = tc.metadataMock(ctrl)
+			}
+
 			driver := &NodeService{
-				mounter:  mounter,
-				inFlight: internal.NewInFlight(),
+				metadata:       metadata,
+				mounter:        mounter,
+				deviceResolver: mounter,
+				inFlight:       internal.NewInFlight(),
+				staged:         internal.NewStagingRegistry(),
+				options:        &Options{DefaultFsType: tc.defaultFsType},
+				clock:          clock.RealClock{},
+				formatDefaults: tc.formatDefaults,
 			}
 
 			if tc.inflight {
 				driver.inFlight.Insert("vol-test")
 			}
+			if tc.stagedPath != "" {
+				driver.staged.Set("vol-test", tc.stagedPath)
+			}
 
-			_, err := driver.NodeUnpublishVolume(context.Background(), tc.req)
-			if !reflect.DeepEqual(err, tc.expectedErr) {
-				t.Fatalf("Expected error '%v' but got '%v'", tc.expectedErr, err)
+			_, err := driver.NodeStageVolume(context.Background(), tc.req)
+			expectStatusErr(t, tc.expectedErr, err)
+
+			if tc.expectedErr == nil && tc.req.GetVolumeCapability().GetMount() != nil {
+				if path, ok := driver.staged.Get("vol-test"); !ok || path != tc.req.GetStagingTargetPath() {
+					t.Errorf("unexpected staging path registered: got %q, want %q", path, tc.req.GetStagingTargetPath())
+				}
 			}
 		})
 	}
 }
 
-func TestNodeExpandVolume(t *testing.T) {
+func TestWaitForDevicePath(t *testing.T) {
 	testCases := []struct {
-		name         string
-		req          *csi.NodeExpandVolumeRequest
-		mounterMock  func(ctrl *gomock.Controller) *mounter.MockMounter
-		metadataMock func(ctrl *gomock.Controller) *metadata.MockMetadataService
-		expectedResp *csi.NodeExpandVolumeResponse
-		expectedErr  error
+		name          string
+		timeout       time.Duration
+		retries       int
+		cancelled     bool
+		failures      int
+		expectedCalls int
+		expectErr     bool
 	}{
 		{
-			name: "success",
-			req: &csi.NodeExpandVolumeRequest{
-				VolumeId:   "vol-test",
-				VolumePath: "/volume/path",
-			},
-			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
-				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().IsBlockDevice(gomock.Eq("/volume/path")).Return(false, nil)
-				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/volume/path")).Return("device-name", 1, nil)
-				m.EXPECT().FindDevicePath(gomock.Eq("device-name"), gomock.Eq("vol-test"), gomock.Eq(""), gomock.Eq("us-west-2")).Return("/dev/xvdba", nil)
-				m.EXPECT().Resize(gomock.Eq("/dev/xvdba"), gomock.Eq("/volume/path")).Return(true, nil)
-				m.EXPECT().GetBlockSizeBytes(gomock.Eq("/dev/xvdba")).Return(int64(1000), nil)
-				return m
-			},
-			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
-				m := metadata.NewMockMetadataService(ctrl)
-				m.EXPECT().GetRegion().Return("us-west-2")
-				return m
-			},
-			expectedResp: &csi.NodeExpandVolumeResponse{CapacityBytes: int64(1000)},
+			name:          "no_timeout_single_attempt",
+			timeout:       0,
+			failures:      1,
+			expectedCalls: 1,
+			expectErr:     true,
 		},
 		{
-			name: "missing_volume_id",
-			req: &csi.NodeExpandVolumeRequest{
-				VolumePath: "/volume/path",
-			},
-			expectedErr: status.Error(codes.InvalidArgument, "Volume ID not provided"),
+			name:          "eventual_success",
+			timeout:       10 * time.Second,
+			failures:      3,
+			expectedCalls: 4,
 		},
 		{
-			name: "missing_volume_path",
-			req: &csi.NodeExpandVolumeRequest{
-				VolumeId: "vol-test",
-			},
-			expectedErr: status.Error(codes.InvalidArgument, "volume path must be provided"),
+			name:          "timeout",
+			timeout:       5 * time.Second,
+			failures:      100,
+			expectedCalls: 6,
+			expectErr:     true,
 		},
 		{
-			name: "invalid_volume_capability",
-			req: &csi.NodeExpandVolumeRequest{
-				VolumeId:   "vol-test",
-				VolumePath: "/volume/path",
-				VolumeCapability: &csi.VolumeCapability{
-					AccessType: &csi.VolumeCapability_Block{
-						Block: &csi.VolumeCapability_BlockVolume{},
-					},
-					AccessMode: &csi.VolumeCapability_AccessMode{
-						Mode: csi.VolumeCapability_AccessMode_UNKNOWN,
-					},
-				},
-			},
-			expectedErr: status.Error(codes.InvalidArgument, "VolumeCapability is invalid: block:<> access_mode:<> "),
+			name:          "retries_transient_failures",
+			retries:       5,
+			failures:      2,
+			expectedCalls: 3,
 		},
 		{
-			name: "block_device",
-			req: &csi.NodeExpandVolumeRequest{
-				VolumeId:   "vol-test",
-				VolumePath: "/volume/path",
-				VolumeCapability: &csi.VolumeCapability{
-					AccessType: &csi.VolumeCapability_Block{
-						Block: &csi.VolumeCapability_BlockVolume{},
-					},
-					AccessMode: &csi.VolumeCapability_AccessMode{
-						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
-					},
-				},
-			},
-			expectedResp: &csi.NodeExpandVolumeResponse{},
+			name:          "retries_exhausted",
+			retries:       2,
+			failures:      100,
+			expectedCalls: 3,
+			expectErr:     true,
 		},
 		{
-			name: "is_block_device_error",
-			req: &csi.NodeExpandVolumeRequest{
-				VolumeId:   "vol-test",
-				VolumePath: "/volume/path",
-			},
-			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
-				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().IsBlockDevice(gomock.Eq("/volume/path")).Return(false, errors.New("failed to determine if block device"))
-				return m
-			},
-			expectedErr: status.Error(codes.Internal, "failed to determine if volumePath [/volume/path] is a block device: failed to determine if block device"),
+			name:          "context_done",
+			timeout:       5 * time.Second,
+			cancelled:     true,
+			failures:      100,
+			expectedCalls: 1,
+			expectErr:     true,
 		},
-		{
-			name: "get_block_size_bytes_error",
-			req: &csi.NodeExpandVolumeRequest{
-				VolumeId:   "vol-test",
-				VolumePath: "/volume/path",
-			},
-			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
-				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().IsBlockDevice(gomock.Eq("/volume/path")).Return(true, nil)
-				m.EXPECT().GetBlockSizeBytes(gomock.Eq("/volume/path")).Return(int64(0), errors.New("failed to get block size"))
-				return m
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			calls := 0
+			mockMounter := mounter.NewMockMounter(ctrl)
+			mockMounter.EXPECT().FindDevicePath("/dev/xvdba", "vol-test", "", "us-west-2").DoAndReturn(func(_, _, _, _ string) (string, error) {
+				calls++
+				if calls <= tc.failures {
+					return "", errors.New("device not found")
+				}
+				return "/dev/nvme1n1", nil
+			}).AnyTimes()
+
+			mockMetadata := metadata.NewMockMetadataService(ctrl)
+			mockMetadata.EXPECT().GetRegion().Return("us-west-2")
+
+			fakeClock := testingclock.NewFakeClock(time.Now())
+			driver := &NodeService{
+				metadata:       mockMetadata,
+				mounter:        mockMounter,
+				deviceResolver: mockMounter,
+				options: &Options{
+					DeviceDiscoveryTimeout:      tc.timeout,
+					DeviceDiscoveryPollInterval: time.Second,
+					DeviceDiscoveryRetries:      tc.retries,
+					DeviceDiscoveryInterval:     time.Second,
+				},
+				clock: fakeClock,
+			}
+
+			type result struct {
+				source string
+				waited time.Duration
+				err    error
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.cancelled {
+				cancel()
+			}
+
+			done := make(chan result)
+			go func() {
+				source, waited, err := driver.waitForDevicePath(ctx, "/dev/xvdba", "vol-test", "")
+				done <- result{source, waited, err}
+			}()
+
+			var r result
+			for finished := false; !finished; {
+				select {
+				case r = <-done:
+					finished = true
+				default:
+					if fakeClock.HasWaiters() {
+						fakeClock.Step(time.Second)
+					}
+					time.Sleep(time.Millisecond)
+				}
+			}
+
+			if calls != tc.expectedCalls {
+				t.Errorf("Expected %d FindDevicePath calls, got %d", tc.expectedCalls, calls)
+			}
+			if tc.expectErr {
+				if r.err == nil {
+					t.Fatalf("Expected error, got source %q", r.source)
+				}
+				if !tc.cancelled && r.waited < tc.timeout {
+					t.Errorf("Expected to wait at least %v, waited %v", tc.timeout, r.waited)
+				}
+			} else {
+				if r.err != nil {
+					t.Fatalf("Unexpected error: %v", r.err)
+				}
+				if r.source != "/dev/nvme1n1" {
+					t.Errorf("Expected source /dev/nvme1n1, got %q", r.source)
+				}
+			}
+		})
+	}
+}
+
+func TestGetVolumesLimit(t *testing.T) {
+	testCases := []struct {
+		name         string
+		expectedErr  error
+		expectedVal  int64
+		options      *Options
+		metadataMock func(ctrl *gomock.Controller) *metadata.MockMetadataService
+		cloudMock    func(ctrl *gomock.Controller) *cloud.MockCloud
+	}{
+		{
+			name: "VolumeAttachLimit_specified",
+			options: &Options{
+				VolumeAttachLimit:         10,
+				ReservedVolumeAttachments: -1,
 			},
-			expectedErr: status.Error(codes.Internal, "failed to get block capacity on path /volume/path: failed to get block size"),
+			expectedVal: 10,
 		},
 		{
-			name: "block_device_success",
-			req: &csi.NodeExpandVolumeRequest{
-				VolumeId:   "vol-test",
-				VolumePath: "/volume/path",
+			name: "sbeDeviceVolumeAttachmentLimit",
+			options: &Options{
+				VolumeAttachLimit: -1,
 			},
-			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
-				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().IsBlockDevice(gomock.Eq("/volume/path")).Return(true, nil)
-				m.EXPECT().GetBlockSizeBytes(gomock.Eq("/volume/path")).Return(int64(1000), nil)
+			expectedVal: sbeDeviceVolumeAttachmentLimit,
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("snow")
 				return m
 			},
-			expectedResp: &csi.NodeExpandVolumeResponse{CapacityBytes: int64(1000)},
 		},
 		{
-			name: "get_device_name_error",
-			req: &csi.NodeExpandVolumeRequest{
-				VolumeId:   "vol-test",
-				VolumePath: "/volume/path",
-			},
-			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
-				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().IsBlockDevice(gomock.Eq("/volume/path")).Return(false, nil)
-				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/volume/path")).Return("", 0, errors.New("failed to get device name"))
-				return m
+			name: "VolumeAttachLimit_specified_ignores_clamps",
+			options: &Options{
+				VolumeAttachLimit:         10,
+				ReservedVolumeAttachments: -1,
+				MinVolumeAttachLimit:      20,
+				MaxVolumeAttachLimit:      30,
 			},
-			metadataMock: nil,
-			expectedResp: nil,
-			expectedErr:  status.Error(codes.Internal, "failed to get device name from mount /volume/path: failed to get device name"),
+			expectedVal: 10,
 		},
 		{
-			name: "find_device_path_error",
-			req: &csi.NodeExpandVolumeRequest{
-				VolumeId:   "vol-test",
-				VolumePath: "/volume/path",
+			name: "MaxVolumeAttachLimit_clamps_computed_limit",
+			options: &Options{
+				VolumeAttachLimit:         -1,
+				ReservedVolumeAttachments: -1,
+				MaxVolumeAttachLimit:      20,
 			},
-			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
-				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().IsBlockDevice(gomock.Eq("/volume/path")).Return(false, nil)
-				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/volume/path")).Return("device-name", 1, nil)
-				m.EXPECT().FindDevicePath(gomock.Eq("device-name"), gomock.Eq("vol-test"), gomock.Eq(""), gomock.Eq("us-west-2")).Return("", errors.New("failed to find device path"))
+			expectedVal: 20,
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				m.EXPECT().GetNumBlockDeviceMappings().Return(0)
+				m.EXPECT().GetInstanceType().Return("t2.medium")
 				return m
 			},
+		},
+		{
+			name: "MinVolumeAttachLimit_clamps_computed_limit",
+			options: &Options{
+				VolumeAttachLimit:         -1,
+				ReservedVolumeAttachments: -1,
+				MinVolumeAttachLimit:      40,
+				MaxVolumeAttachLimit:      50,
+			},
+			expectedVal: 40,
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
 				m := metadata.NewMockMetadataService(ctrl)
 				m.EXPECT().GetRegion().Return("us-west-2")
+				m.EXPECT().GetNumBlockDeviceMappings().Return(0)
+				m.EXPECT().GetInstanceType().Return("t2.medium")
 				return m
 			},
-			expectedResp: nil,
-			expectedErr:  status.Error(codes.Internal, "failed to find device path for device name device-name for mount /volume/path: failed to find device path"),
 		},
 		{
-			name: "resize_error",
-			req: &csi.NodeExpandVolumeRequest{
-				VolumeId:   "vol-test",
-				VolumePath: "/volume/path",
+			name: "MinVolumeAttachLimit_clamps_sbe_limit",
+			options: &Options{
+				VolumeAttachLimit:    -1,
+				MinVolumeAttachLimit: 15,
 			},
-			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
-				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().IsBlockDevice(gomock.Eq("/volume/path")).Return(false, nil)
-				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/volume/path")).Return("device-name", 1, nil)
-				m.EXPECT().FindDevicePath(gomock.Eq("device-name"), gomock.Eq("vol-test"), gomock.Eq(""), gomock.Eq("us-west-2")).Return("/dev/xvdba", nil)
-				m.EXPECT().Resize(gomock.Eq("/dev/xvdba"), gomock.Eq("/volume/path")).Return(false, errors.New("failed to resize volume"))
+			expectedVal: 15,
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("snow")
 				return m
 			},
+		},
+		{
+			name: "t2.medium_volume_attach_limit",
+			options: &Options{
+				VolumeAttachLimit:         -1,
+				ReservedVolumeAttachments: -1,
+			},
+			expectedVal: 38,
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
 				m := metadata.NewMockMetadataService(ctrl)
 				m.EXPECT().GetRegion().Return("us-west-2")
+				m.EXPECT().GetNumBlockDeviceMappings().Return(0)
+				m.EXPECT().GetInstanceType().Return("t2.medium")
 				return m
 			},
-			expectedResp: nil,
-			expectedErr:  status.Error(codes.Internal, "Could not resize volume \"vol-test\" (\"/dev/xvdba\"): failed to resize volume"),
 		},
 		{
-			name: "get_block_size_bytes_error_after_resize",
-			req: &csi.NodeExpandVolumeRequest{
-				VolumeId:   "vol-test",
-				VolumePath: "/volume/path",
+			name: "ReservedVolumeAttachments_specified",
+			options: &Options{
+				VolumeAttachLimit:         -1,
+				ReservedVolumeAttachments: 3,
 			},
-			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
-				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().IsBlockDevice(gomock.Eq("/volume/path")).Return(false, nil)
-				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/volume/path")).Return("device-name", 1, nil)
-				m.EXPECT().FindDevicePath(gomock.Eq("device-name"), gomock.Eq("vol-test"), gomock.Eq(""), gomock.Eq("us-west-2")).Return("/dev/xvdba", nil)
-				m.EXPECT().Resize(gomock.Eq("/dev/xvdba"), gomock.Eq("/volume/path")).Return(true, nil)
-				m.EXPECT().GetBlockSizeBytes(gomock.Eq("/dev/xvdba")).Return(int64(0), errors.New("failed to get block size"))
+			expectedVal: 36,
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				m.EXPECT().GetInstanceType().Return("t2.medium")
 				return m
 			},
+		},
+		{
+			name: "m5d.large_volume_attach_limit",
+			options: &Options{
+				VolumeAttachLimit:         -1,
+				ReservedVolumeAttachments: -1,
+			},
+			expectedVal: 23,
 			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
 				m := metadata.NewMockMetadataService(ctrl)
 				m.EXPECT().GetRegion().Return("us-west-2")
+				m.EXPECT().GetInstanceType().Return("m5d.large")
+				m.EXPECT().GetNumBlockDeviceMappings().Return(0)
+				m.EXPECT().GetNumAttachedENIs().Return(3)
 				return m
 			},
-			expectedResp: nil,
-			expectedErr:  status.Error(codes.Internal, "failed to get block capacity on path /volume/path: failed to get block size"),
 		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			ctrl := gomock.NewController(t)
-			defer ctrl.Finish()
-
-			var mounter *mounter.MockMounter
-			if tc.mounterMock != nil {
-				mounter = tc.mounterMock(ctrl)
-			}
-
-			var metadata *metadata.MockMetadataService
-			if tc.metadataMock != nil {
-				metadata = tc.metadataMock(ctrl)
-			}
-
-			driver := &NodeService{
-				mounter:  mounter,
-				metadata: metadata,
-			}
-
-			resp, err := driver.NodeExpandVolume(context.Background(), tc.req)
-			if !reflect.DeepEqual(err, tc.expectedErr) {
-				t.Fatalf("Expected error '%v' but got '%v'", tc.expectedErr, err)
-			}
-
-			if !reflect.DeepEqual(resp, tc.expectedResp) {
-				t.Fatalf("Expected response '%v' but got '%v'", tc.expectedResp, resp)
-			}
-		})
-	}
-}
-
-func TestNodeGetVolumeStats(t *testing.T) {
-	testCases := []struct {
-		name           string
-		validVolId     bool
-		validPath      bool
-		metricsStatErr bool
-		mounterMock    func(mockCtl *gomock.Controller, dir string) *mounter.MockMounter
-		expectedErr    func(dir string) error
-	}{
 		{
-			name:       "success normal",
-			validVolId: true,
-			validPath:  true,
-			mounterMock: func(ctrl *gomock.Controller, dir string) *mounter.MockMounter {
-				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().PathExists(dir).Return(true, nil)
-				m.EXPECT().IsBlockDevice(gomock.Eq(dir)).Return(false, nil)
-				return m
+			name: "d3en.12xlarge_volume_attach_limit",
+			options: &Options{
+				VolumeAttachLimit:         -1,
+				ReservedVolumeAttachments: -1,
 			},
-			expectedErr: func(dir string) error {
-				return nil
+			expectedVal: 1,
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				m.EXPECT().GetInstanceType().Return("d3en.12xlarge")
+				m.EXPECT().GetNumBlockDeviceMappings().Return(0)
+				m.EXPECT().GetNumAttachedENIs().Return(1)
+				return m
 			},
 		},
 		{
-			name:       "invalid_volume_id",
-			validVolId: false,
-			expectedErr: func(dir string) error {
-				return status.Error(codes.InvalidArgument, "NodeGetVolumeStats volume ID was empty")
+			name: "d3.8xlarge_volume_attach_limit",
+			options: &Options{
+				VolumeAttachLimit:         -1,
+				ReservedVolumeAttachments: -1,
+			},
+			expectedVal: 1,
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				m.EXPECT().GetInstanceType().Return("d3.8xlarge")
+				m.EXPECT().GetNumBlockDeviceMappings().Return(0)
+				m.EXPECT().GetNumAttachedENIs().Return(1)
+				return m
 			},
 		},
 		{
-			name:       "invalid_volume_path",
-			validVolId: true,
-			validPath:  false,
-			expectedErr: func(dir string) error {
-				return status.Error(codes.InvalidArgument, "NodeGetVolumeStats volume path was empty")
+			name: "nitro_volume_attach_limit",
+			options: &Options{
+				VolumeAttachLimit:         -1,
+				ReservedVolumeAttachments: -1,
+			},
+			expectedVal: 127,
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				m.EXPECT().GetInstanceType().Return("m7i.48xlarge")
+				m.EXPECT().GetNumBlockDeviceMappings().Return(0)
+				return m
 			},
 		},
 		{
-			name:       "path_exists_error",
-			validVolId: true,
-			validPath:  true,
-			mounterMock: func(ctrl *gomock.Controller, dir string) *mounter.MockMounter {
-				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().PathExists(dir).Return(false, errors.New("path exists error"))
+			name: "attached_max_enis",
+			options: &Options{
+				VolumeAttachLimit: -1,
+			},
+			expectedVal: 1,
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				m.EXPECT().GetInstanceType().Return("t3.xlarge")
+				m.EXPECT().GetNumAttachedENIs().Return(40)
 				return m
 			},
-			expectedErr: func(dir string) error {
-				return status.Errorf(codes.Internal, "unknown error when stat on %s: path exists error", dir)
+		},
+		{
+			name: "inf1.24xlarge_volume_attach_limit",
+			options: &Options{
+				VolumeAttachLimit:         -1,
+				ReservedVolumeAttachments: -1,
+			},
+			expectedVal: 9,
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				m.EXPECT().GetInstanceType().Return("inf1.24xlarge")
+				m.EXPECT().GetNumAttachedENIs().Return(1)
+				m.EXPECT().GetNumBlockDeviceMappings().Return(0)
+				return m
 			},
 		},
 		{
-			name:       "path_does_not_exist",
-			validVolId: true,
-			validPath:  true,
-			mounterMock: func(ctrl *gomock.Controller, dir string) *mounter.MockMounter {
-				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().PathExists(dir).Return(false, nil)
+			name: "mac1.metal_volume_attach_limit",
+			options: &Options{
+				VolumeAttachLimit:         -1,
+				ReservedVolumeAttachments: -1,
+			},
+			expectedVal: 14,
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				m.EXPECT().GetInstanceType().Return("mac1.metal")
+				m.EXPECT().GetNumBlockDeviceMappings().Return(0)
+				m.EXPECT().GetNumAttachedENIs().Return(1)
 				return m
 			},
-			expectedErr: func(dir string) error {
-				return status.Errorf(codes.NotFound, "path %s does not exist", dir)
+		},
+		{
+			name: "u-12tb1.metal_volume_attach_limit",
+			options: &Options{
+				VolumeAttachLimit:         -1,
+				ReservedVolumeAttachments: -1,
+			},
+			expectedVal: 17,
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				m.EXPECT().GetInstanceType().Return("u-12tb1.metal")
+				m.EXPECT().GetNumBlockDeviceMappings().Return(0)
+				m.EXPECT().GetNumAttachedENIs().Return(1)
+				return m
 			},
 		},
 		{
-			name:       "is_block_device_error",
-			validVolId: true,
-			validPath:  true,
-			mounterMock: func(ctrl *gomock.Controller, dir string) *mounter.MockMounter {
-				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().PathExists(dir).Return(true, nil)
-				m.EXPECT().IsBlockDevice(gomock.Eq(dir)).Return(false, errors.New("is block device error"))
+			name: "known_instance_type_skips_lookup",
+			options: &Options{
+				VolumeAttachLimit:         -1,
+				ReservedVolumeAttachments: -1,
+				EnableInstanceTypeLookup:  true,
+			},
+			expectedVal: 25,
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				m.EXPECT().GetInstanceType().Return("m5d.large")
+				m.EXPECT().GetNumBlockDeviceMappings().Return(0)
+				m.EXPECT().GetNumAttachedENIs().Return(1)
 				return m
 			},
-			expectedErr: func(dir string) error {
-				return status.Errorf(codes.Internal, "failed to determine whether %s is block device: is block device error", dir)
+			cloudMock: func(ctrl *gomock.Controller) *cloud.MockCloud {
+				return cloud.NewMockCloud(ctrl)
 			},
 		},
 		{
-			name:       "get_block_size_bytes_error",
-			validVolId: true,
-			validPath:  true,
-			mounterMock: func(ctrl *gomock.Controller, dir string) *mounter.MockMounter {
-				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().PathExists(dir).Return(true, nil)
-				m.EXPECT().IsBlockDevice(gomock.Eq(dir)).Return(true, nil)
-				m.EXPECT().GetBlockSizeBytes(dir).Return(int64(0), errors.New("get block size bytes error"))
+			name: "unknown_instance_type_lookup",
+			options: &Options{
+				VolumeAttachLimit:         -1,
+				ReservedVolumeAttachments: -1,
+				EnableInstanceTypeLookup:  true,
+			},
+			expectedVal: 24,
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				m.EXPECT().GetInstanceType().Return("m8gd.large")
+				m.EXPECT().GetNumBlockDeviceMappings().Return(0)
+				m.EXPECT().GetNumAttachedENIs().Return(1)
 				return m
 			},
-			expectedErr: func(dir string) error {
-				return status.Errorf(codes.Internal, "failed to get block capacity on path %s: %v", dir, "get block size bytes error")
+			cloudMock: func(ctrl *gomock.Controller) *cloud.MockCloud {
+				m := cloud.NewMockCloud(ctrl)
+				m.EXPECT().GetInstanceTypeInfo(gomock.Any(), "m8gd.large").Return(&cloud.InstanceTypeInfo{Nitro: true, NVMeInstanceStoreVolumes: 2}, nil)
+				return m
 			},
 		},
 		{
-			name:       "success block device",
-			validVolId: true,
-			validPath:  true,
-			mounterMock: func(ctrl *gomock.Controller, dir string) *mounter.MockMounter {
-				m := mounter.NewMockMounter(ctrl)
-				m.EXPECT().PathExists(dir).Return(true, nil)
-				m.EXPECT().IsBlockDevice(gomock.Eq(dir)).Return(true, nil)
-				m.EXPECT().GetBlockSizeBytes(dir).Return(int64(1024), nil)
+			name: "unknown_instance_type_lookup_non_nitro",
+			options: &Options{
+				VolumeAttachLimit:         -1,
+				ReservedVolumeAttachments: -1,
+				EnableInstanceTypeLookup:  true,
+			},
+			expectedVal: 38,
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				m.EXPECT().GetInstanceType().Return("z9.large")
+				m.EXPECT().GetNumBlockDeviceMappings().Return(0)
 				return m
 			},
-			expectedErr: func(dir string) error {
-				return nil
+			cloudMock: func(ctrl *gomock.Controller) *cloud.MockCloud {
+				m := cloud.NewMockCloud(ctrl)
+				m.EXPECT().GetInstanceTypeInfo(gomock.Any(), "z9.large").Return(&cloud.InstanceTypeInfo{Nitro: false}, nil)
+				return m
+			},
+		},
+		{
+			name: "unknown_instance_type_lookup_error",
+			options: &Options{
+				VolumeAttachLimit:         -1,
+				ReservedVolumeAttachments: -1,
+				EnableInstanceTypeLookup:  true,
+			},
+			expectedVal: 26,
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				m.EXPECT().GetInstanceType().Return("m8gd.large")
+				m.EXPECT().GetNumBlockDeviceMappings().Return(0)
+				m.EXPECT().GetNumAttachedENIs().Return(1)
+				return m
+			},
+			cloudMock: func(ctrl *gomock.Controller) *cloud.MockCloud {
+				m := cloud.NewMockCloud(ctrl)
+				m.EXPECT().GetInstanceTypeInfo(gomock.Any(), "m8gd.large").Return(nil, errors.New("UnauthorizedOperation"))
+				return m
+			},
+		},
+		{
+			name: "unknown_instance_type_lookup_disabled",
+			options: &Options{
+				VolumeAttachLimit:         -1,
+				ReservedVolumeAttachments: -1,
+			},
+			expectedVal: 26,
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				m.EXPECT().GetInstanceType().Return("m8gd.large")
+				m.EXPECT().GetNumBlockDeviceMappings().Return(0)
+				m.EXPECT().GetNumAttachedENIs().Return(1)
+				return m
+			},
+			cloudMock: func(ctrl *gomock.Controller) *cloud.MockCloud {
+				return cloud.NewMockCloud(ctrl)
+			},
+		},
+		{
+			name: "volume_attachment_lookup",
+			options: &Options{
+				VolumeAttachLimit:            -1,
+				ReservedVolumeAttachments:    -1,
+				EnableVolumeAttachmentLookup: true,
+			},
+			expectedVal: 36,
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				m.EXPECT().GetInstanceType().Return("t2.medium")
+				m.EXPECT().GetInstanceID().Return("i-1234567890abcdef0")
+				return m
+			},
+			cloudMock: func(ctrl *gomock.Controller) *cloud.MockCloud {
+				m := cloud.NewMockCloud(ctrl)
+				m.EXPECT().CountNonCSIVolumeAttachments(gomock.Any(), "i-1234567890abcdef0").Return(3, nil)
+				return m
+			},
+		},
+		{
+			name: "volume_attachment_lookup_error",
+			options: &Options{
+				VolumeAttachLimit:            -1,
+				ReservedVolumeAttachments:    -1,
+				EnableVolumeAttachmentLookup: true,
+			},
+			expectedVal: 37,
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				m.EXPECT().GetInstanceType().Return("t2.medium")
+				m.EXPECT().GetInstanceID().Return("i-1234567890abcdef0")
+				m.EXPECT().GetNumBlockDeviceMappings().Return(1)
+				return m
+			},
+			cloudMock: func(ctrl *gomock.Controller) *cloud.MockCloud {
+				m := cloud.NewMockCloud(ctrl)
+				m.EXPECT().CountNonCSIVolumeAttachments(gomock.Any(), "i-1234567890abcdef0").Return(0, errors.New("UnauthorizedOperation"))
+				return m
+			},
+		},
+		{
+			name: "volume_attachment_lookup_ignored_with_reserved_attachments",
+			options: &Options{
+				VolumeAttachLimit:            -1,
+				ReservedVolumeAttachments:    3,
+				EnableVolumeAttachmentLookup: true,
+			},
+			expectedVal: 36,
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				m.EXPECT().GetInstanceType().Return("t2.medium")
+				return m
+			},
+			cloudMock: func(ctrl *gomock.Controller) *cloud.MockCloud {
+				return cloud.NewMockCloud(ctrl)
 			},
 		},
 	}
@@ -2293,65 +2800,2876 @@ func TestNodeGetVolumeStats(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			dir := t.TempDir()
-
 			var mounter *mounter.MockMounter
-			if tc.mounterMock != nil {
-				mounter = tc.mounterMock(ctrl, dir)
-			}
 
 			var metadata *metadata.MockMetadataService
-			driver := &NodeService{
-				mounter:  mounter,
-				metadata: metadata,
+			if tc.metadataMock != nil {
+				metadata = tc.metadataMock(ctrl)
 			}
 
-			req := &csi.NodeGetVolumeStatsRequest{}
-			if tc.validVolId {
-				req.VolumeId = "vol-test"
-			}
-			if tc.validPath {
-				req.VolumePath = dir
+			driver := &NodeService{
+				mounter:        mounter,
+				deviceResolver: mounter,
+				inFlight:       internal.NewInFlight(),
+				staged:         internal.NewStagingRegistry(),
+				options:        tc.options,
+				metadata:       metadata,
 			}
-			if tc.metricsStatErr {
-				req.VolumePath = "fake-path"
+			if tc.cloudMock != nil {
+				driver.cloud = tc.cloudMock(ctrl)
 			}
 
-			_, err := driver.NodeGetVolumeStats(context.TODO(), req)
-
-			if !reflect.DeepEqual(err, tc.expectedErr(dir)) {
-				t.Fatalf("Expected error '%v' but got '%v'", tc.expectedErr(dir), err)
+			value := driver.getVolumesLimit()
+			if value != tc.expectedVal {
+				t.Fatalf("Expected value %v but got %v", tc.expectedVal, value)
 			}
 		})
 	}
 }
 
-func TestRemoveNotReadyTaint(t *testing.T) {
-	nodeName := "test-node-123"
+func TestGetVolumesLimitCachesInstanceTypeLookup(t *testing.T) {
 	testCases := []struct {
-		name      string
-		setup     func(t *testing.T, mockCtl *gomock.Controller) func() (kubernetes.Interface, error)
-		expResult error
+		name        string
+		info        *cloud.InstanceTypeInfo
+		err         error
+		expectedVal int64
 	}{
 		{
-			name: "failed to get node",
-			setup: func(t *testing.T, mockCtl *gomock.Controller) func() (kubernetes.Interface, error) {
-				t.Setenv("CSI_NODE_NAME", nodeName)
-				getNodeMock, _ := getNodeMock(mockCtl, nodeName, nil, fmt.Errorf("Failed to get node!"))
-
-				return func() (kubernetes.Interface, error) {
-					return getNodeMock, nil
-				}
-			},
-			expResult: fmt.Errorf("Failed to get node!"),
+			name:        "lookup_success",
+			info:        &cloud.InstanceTypeInfo{Nitro: true, NVMeInstanceStoreVolumes: 2},
+			expectedVal: 24,
 		},
 		{
-			name: "no taints to remove",
-			setup: func(t *testing.T, mockCtl *gomock.Controller) func() (kubernetes.Interface, error) {
-				t.Setenv("CSI_NODE_NAME", nodeName)
-				getNodeMock, _ := getNodeMock(mockCtl, nodeName, &corev1.Node{}, nil)
+			name:        "lookup_error",
+			err:         errors.New("UnauthorizedOperation"),
+			expectedVal: 26,
+		},
+	}
 
-				storageV1Mock := NewMockStorageV1Interface(mockCtl)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockMetadata := metadata.NewMockMetadataService(ctrl)
+			mockMetadata.EXPECT().GetRegion().Return("us-west-2").AnyTimes()
+			mockMetadata.EXPECT().GetInstanceType().Return("m8gd.large").AnyTimes()
+			mockMetadata.EXPECT().GetNumBlockDeviceMappings().Return(0).AnyTimes()
+			mockMetadata.EXPECT().GetNumAttachedENIs().Return(1).AnyTimes()
+
+			mockCloud := cloud.NewMockCloud(ctrl)
+			mockCloud.EXPECT().GetInstanceTypeInfo(gomock.Any(), "m8gd.large").Return(tc.info, tc.err).Times(1)
+
+			driver := &NodeService{
+				cloud:    mockCloud,
+				metadata: mockMetadata,
+				options: &Options{
+					VolumeAttachLimit:         -1,
+					ReservedVolumeAttachments: -1,
+					EnableInstanceTypeLookup:  true,
+				},
+			}
+
+			for i := 0; i < 3; i++ {
+				if value := driver.getVolumesLimit(); value != tc.expectedVal {
+					t.Fatalf("Expected value %v but got %v on call %d", tc.expectedVal, value, i+1)
+				}
+			}
+		})
+	}
+}
+
+func TestGetVolumesLimitCachesVolumeAttachmentLookup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMetadata := metadata.NewMockMetadataService(ctrl)
+	mockMetadata.EXPECT().GetRegion().Return("us-west-2").AnyTimes()
+	mockMetadata.EXPECT().GetInstanceType().Return("t2.medium").AnyTimes()
+	mockMetadata.EXPECT().GetInstanceID().Return("i-1234567890abcdef0").Times(1)
+
+	mockCloud := cloud.NewMockCloud(ctrl)
+	mockCloud.EXPECT().CountNonCSIVolumeAttachments(gomock.Any(), "i-1234567890abcdef0").Return(2, nil).Times(1)
+
+	driver := &NodeService{
+		cloud:    mockCloud,
+		metadata: mockMetadata,
+		options: &Options{
+			VolumeAttachLimit:            -1,
+			ReservedVolumeAttachments:    -1,
+			EnableVolumeAttachmentLookup: true,
+		},
+	}
+
+	for i := 0; i < 3; i++ {
+		if value := driver.getVolumesLimit(); value != 37 {
+			t.Fatalf("Expected value 37 but got %v on call %d", value, i+1)
+		}
+	}
+}
+
+func TestNodePublishVolume(t *testing.T) {
+	testCases := []struct {
+		name         string
+		req          *csi.NodePublishVolumeRequest
+		mounterMock  func(ctrl *gomock.Controller) *mounter.MockMounter
+		metadataMock func(ctrl *gomock.Controller) *metadata.MockMetadataService
+		expectedErr  error
+		inflight     bool
+	}{
+		{
+			name: "success_block_device",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				TargetPath:        "/target/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Block{
+						Block: &csi.VolumeCapability_BlockVolume{},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
+				m.EXPECT().PathExists(gomock.Any()).Return(true, nil)
+				m.EXPECT().MakeFile(gomock.Any()).Return(nil)
+				m.EXPECT().IsLikelyNotMountPoint(gomock.Any()).Return(true, nil)
+				m.EXPECT().Mount(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				return m
+			},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				return m
+			},
+		},
+		{
+			name: "success_fs",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				TargetPath:        "/target/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().PreparePublishTarget(gomock.Any()).Return(nil)
+				m.EXPECT().IsLikelyNotMountPoint(gomock.Any()).Return(true, nil)
+				m.EXPECT().Mount(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				return m
+			},
+		},
+		{
+			name: "success_fs_xfs_project_id",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				TargetPath:        "/target/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "xfs",
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				VolumeContext: map[string]string{
+					XFSProjectQuotaKey: "true",
+					XFSProjectIDKey:    "42",
+				},
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().PreparePublishTarget(gomock.Eq("/target/path")).Return(nil)
+				m.EXPECT().IsLikelyNotMountPoint(gomock.Eq("/target/path")).Return(true, nil)
+				m.EXPECT().Mount(gomock.Eq("/staging/path"), gomock.Eq("/target/path"), gomock.Eq("xfs"), gomock.Eq([]string{"bind", "nouuid"})).Return(nil)
+				m.EXPECT().SetXFSProjectQuota(gomock.Eq("/target/path"), gomock.Eq(uint32(42))).Return(nil)
+				return m
+			},
+		},
+		{
+			name: "xfs_project_id_set_on_mounted_target",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				TargetPath:        "/target/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "xfs",
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				VolumeContext: map[string]string{
+					XFSProjectQuotaKey: "true",
+					XFSProjectIDKey:    "42",
+				},
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				// The mounted target is not prepared again
+				m.EXPECT().PreparePublishTarget(gomock.Any()).Times(0)
+				m.EXPECT().IsLikelyNotMountPoint(gomock.Eq("/target/path")).Return(false, nil)
+				m.EXPECT().SetXFSProjectQuota(gomock.Eq("/target/path"), gomock.Eq(uint32(42))).Return(errors.New("xfs_quota failed"))
+				return m
+			},
+			expectedErr: status.Error(codes.Internal, "Could not set XFS project 42 on \"/target/path\": xfs_quota failed"),
+		},
+		{
+			name: "invalid_xfs_project_id",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				TargetPath:        "/target/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "xfs",
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				VolumeContext: map[string]string{
+					XFSProjectQuotaKey: "true",
+					XFSProjectIDKey:    "-1",
+				},
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "Invalid xfsprojectid (-1): must be a number between 1 and 4294967295"),
+		},
+		{
+			name: "xfs_project_id_without_project_quota",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				TargetPath:        "/target/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "xfs",
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				VolumeContext: map[string]string{
+					XFSProjectIDKey: "42",
+				},
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "Cannot use xfsprojectid unless xfsprojectquota is true"),
+		},
+		{
+			name: "volume_id_not_provided",
+			req: &csi.NodePublishVolumeRequest{
+				StagingTargetPath: "/staging/path",
+				TargetPath:        "/target/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Block{
+						Block: &csi.VolumeCapability_BlockVolume{},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "Volume ID not provided"),
+		},
+		{
+			name: "staging_target_path_not_provided",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:   "vol-test",
+				TargetPath: "/target/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Block{
+						Block: &csi.VolumeCapability_BlockVolume{},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "Staging target not provided"),
+		},
+		{
+			name: "target_path_not_provided",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Block{
+						Block: &csi.VolumeCapability_BlockVolume{},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "Target path not provided"),
+		},
+		{
+			name: "capability_not_provided",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				TargetPath:        "/target/path",
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "Volume capability not provided"),
+		},
+		{
+			name: "success_block_device",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				TargetPath:        "/target/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Block{
+						Block: &csi.VolumeCapability_BlockVolume{},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
+			},
+			inflight:    true,
+			expectedErr: status.Errorf(codes.Aborted, VolumeOperationAlreadyExists, "vol-test"),
+		},
+		{
+			name: "success_block_device",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				TargetPath:        "/target/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Block{
+						Block: &csi.VolumeCapability_BlockVolume{},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_Mode(csi.ControllerServiceCapability_RPC_UNKNOWN),
+					},
+				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
+			},
+			expectedErr: status.Errorf(codes.InvalidArgument, "Volume capability not supported"),
+		},
+		{
+			name: "read_only_enabled",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				TargetPath:        "/target/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Block{
+						Block: &csi.VolumeCapability_BlockVolume{},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
+				Readonly: true,
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
+				m.EXPECT().PathExists(gomock.Any()).Return(true, nil)
+				m.EXPECT().MakeFile(gomock.Any()).Return(nil)
+				m.EXPECT().IsLikelyNotMountPoint(gomock.Any()).Return(true, nil)
+				m.EXPECT().Mount(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				return m
+			},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				return m
+			},
+		},
+		{
+			name: "nodePublishVolumeForBlock_error",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				TargetPath:        "/target/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Block{
+						Block: &csi.VolumeCapability_BlockVolume{},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+			},
+			expectedErr: status.Errorf(codes.InvalidArgument, "Device path not provided"),
+		},
+		{
+			name: "nodePublishVolumeForBlock_invalid_volume_attribute",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				TargetPath:        "/target/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Block{
+						Block: &csi.VolumeCapability_BlockVolume{},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
+				VolumeContext: map[string]string{
+					VolumeAttributePartition: "invalid-partition",
+				},
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "Volume Attribute is invalid"),
+		},
+		{
+			name: "nodePublishVolumeForBlock_invalid_partition",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				TargetPath:        "/target/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Block{
+						Block: &csi.VolumeCapability_BlockVolume{},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
+				VolumeContext: map[string]string{
+					VolumeAttributePartition: "0",
+				},
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
+				m.EXPECT().PathExists(gomock.Any()).Return(true, nil)
+				m.EXPECT().MakeFile(gomock.Any()).Return(nil)
+				m.EXPECT().IsLikelyNotMountPoint(gomock.Any()).Return(true, nil)
+				m.EXPECT().Mount(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				return m
+			},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				return m
+			},
+		},
+		{
+			name: "nodePublishVolumeForBlock_valid_partition",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				TargetPath:        "/target/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Block{
+						Block: &csi.VolumeCapability_BlockVolume{},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
+				VolumeContext: map[string]string{
+					VolumeAttributePartition: "1",
+				},
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil)
+				m.EXPECT().PathExists(gomock.Any()).Return(true, nil)
+				m.EXPECT().MakeFile(gomock.Any()).Return(nil)
+				m.EXPECT().IsLikelyNotMountPoint(gomock.Any()).Return(true, nil)
+				m.EXPECT().Mount(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				return m
+			},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				return m
+			},
+		},
+		{
+			name: "nodePublishVolumeForBlock_device_path_failure",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				TargetPath:        "/target/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Block{
+						Block: &csi.VolumeCapability_BlockVolume{},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				PublishContext: map[string]string{
+					DevicePathKey: "/dev/xvdba",
+				},
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+
+				m.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("", errors.New("device path error"))
+				return m
+			},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				return m
+			},
+			expectedErr: status.Error(codes.Internal, "Failed to find device path /dev/xvdba. device path error"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var mounter *mounter.MockMounter
+			if tc.mounterMock != nil {
+				mounter = tc.mounterMock(ctrl)
+			}
+
+			var metadata *metadata.MockMetadataService
+			if tc.metadataMock != nil {
+				metadata = tc.metadataMock(ctrl)
+			}
+
+			driver := &NodeService{
+				metadata:       metadata,
+				mounter:        mounter,
+				deviceResolver: mounter,
+				inFlight:       internal.NewInFlight(),
+				staged:         internal.NewStagingRegistry(),
+				options:        &Options{},
+			}
+
+			if tc.inflight {
+				driver.inFlight.Insert("vol-test")
+			}
+
+			_, err := driver.NodePublishVolume(context.Background(), tc.req)
+			expectStatusErr(t, tc.expectedErr, err)
+		})
+	}
+}
+
+func TestNodeUnstageVolume(t *testing.T) {
+	testCases := []struct {
+		name           string
+		req            *csi.NodeUnstageVolumeRequest
+		mounterMock    func(ctrl *gomock.Controller) *mounter.MockMounter
+		expectedErr    error
+		inflight       bool
+		stagedPath     string
+		expectStaged   bool
+		expectMultiRef bool
+		// devicePathHint writes a device path hint for the volume, which NodeUnstageVolume must remove on success
+		devicePathHint bool
+	}{
+		{
+			name: "success",
+			req: &csi.NodeUnstageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+			},
+			stagedPath:     "/staging/path",
+			devicePathHint: true,
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("dev-test", 1, nil)
+				m.EXPECT().Unstage(gomock.Any()).Return(nil)
+				m.EXPECT().LuksClose("ebs-luks-vol-test").Return(nil)
+				return m
+			},
+		},
+		{
+			name: "missing_volume_id",
+			req: &csi.NodeUnstageVolumeRequest{
+				StagingTargetPath: "/staging/path",
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "Volume ID not provided"),
+		},
+		{
+			name: "missing_staging_target",
+			req: &csi.NodeUnstageVolumeRequest{
+				VolumeId: "vol-test",
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "Staging target not provided"),
+		},
+		{
+			name: "unstage_failed",
+			req: &csi.NodeUnstageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("", 1, nil)
+				m.EXPECT().Unstage(gomock.Any()).Return(errors.New("unstage failed"))
+				return m
+			},
+			expectedErr:  status.Errorf(codes.Internal, "Could not unmount target %q: %v", "/staging/path", errors.New("unstage failed")),
+			stagedPath:   "/staging/path",
+			expectStaged: true,
+		},
+		{
+			name: "target_not_mounted",
+			req: &csi.NodeUnstageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("", 0, nil)
+				m.EXPECT().LuksClose("ebs-luks-vol-test").Return(nil)
+				return m
+			},
+			stagedPath:     "/staging/path",
+			devicePathHint: true,
+		},
+		{
+			name: "staged_at_other_path",
+			req: &csi.NodeUnstageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("", 0, nil)
+				m.EXPECT().LuksClose("ebs-luks-vol-test").Return(nil)
+				return m
+			},
+			stagedPath:   "/other/staging/path",
+			expectStaged: true,
+		},
+		{
+			name: "get_device_name_from_mount_failed",
+			req: &csi.NodeUnstageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("", 0, errors.New("failed to get device name"))
+				return m
+			},
+			expectedErr: status.Error(codes.Internal, "failed to check if target \"/staging/path\" is a mount point: failed to get device name"),
+		},
+		{
+			name: "multiple_references",
+			req: &csi.NodeUnstageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("dev-test", 2, nil)
+				m.EXPECT().Unstage(gomock.Any()).Return(nil)
+				m.EXPECT().LuksClose("ebs-luks-vol-test").Return(nil)
+				return m
+			},
+			expectMultiRef: true,
+		},
+		{
+			name: "operation_already_exists",
+			req: &csi.NodeUnstageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+			},
+			expectedErr: status.Error(codes.Aborted, "An operation with the given volume=\"vol-test\" is already in progress"),
+			inflight:    true,
+		},
+	}
+
+	recorder := metrics.InitializeRecorder()
+	multiRefCount := func() float64 {
+		families, err := recorder.Gatherer().Gather()
+		if err != nil {
+			t.Fatalf("failed to gather metrics: %v", err)
+		}
+		var count float64
+		for _, family := range families {
+			if family.GetName() != NodeUnstageMultiRefMetric {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				count += metric.GetCounter().GetValue()
+			}
+		}
+		return count
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var mounter *mounter.MockMounter
+			if tc.mounterMock != nil {
+				mounter = tc.mounterMock(ctrl)
+			}
+
+			driver := &NodeService{
+				mounter:        mounter,
+				deviceResolver: mounter,
+				inFlight:       internal.NewInFlight(),
+				staged:         internal.NewStagingRegistry(),
+				options:        &Options{},
+			}
+
+			if tc.inflight {
+				driver.inFlight.Insert("vol-test")
+			}
+			if tc.stagedPath != "" {
+				driver.staged.Set("vol-test", tc.stagedPath)
+			}
+			var hintFile string
+			if tc.devicePathHint {
+				driver.options.DevicePathHintDir = t.TempDir()
+				if err := writeDevicePathHint(driver.options.DevicePathHintDir, "vol-test", "/dev/nvme1n1"); err != nil {
+					t.Fatalf("failed to write device path hint: %v", err)
+				}
+				hintFile, _ = devicePathHintFile(driver.options.DevicePathHintDir, "vol-test")
+			}
+
+			before := multiRefCount()
+			_, err := driver.NodeUnstageVolume(context.Background(), tc.req)
+			if increased := multiRefCount() > before; increased != tc.expectMultiRef {
+				t.Errorf("unexpected %s increment: got %v, want %v", NodeUnstageMultiRefMetric, increased, tc.expectMultiRef)
+			}
+			if !reflect.DeepEqual(err, tc.expectedErr) {
+				t.Fatalf("Expected error '%v' but got '%v'", tc.expectedErr, err)
+			}
+			if _, staged := driver.staged.Get("vol-test"); staged != tc.expectStaged {
+				t.Errorf("unexpected registry entry: got staged=%v, want %v", staged, tc.expectStaged)
+			}
+			if hintFile != "" {
+				if _, err := os.Stat(hintFile); !os.IsNotExist(err) {
+					t.Errorf("expected device path hint %s to be removed, got %v", hintFile, err)
+				}
+			}
+		})
+	}
+}
+
+func TestNodeGetCapabilities(t *testing.T) {
+	testCases := []struct {
+		name                 string
+		disableNodeExpansion bool
+		expectedCaps         []csi.NodeServiceCapability_RPC_Type
+	}{
+		{
+			name: "default",
+			expectedCaps: []csi.NodeServiceCapability_RPC_Type{
+				csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME,
+				csi.NodeServiceCapability_RPC_EXPAND_VOLUME,
+				csi.NodeServiceCapability_RPC_GET_VOLUME_STATS,
+			},
+		},
+		{
+			name:                 "node expansion disabled",
+			disableNodeExpansion: true,
+			expectedCaps: []csi.NodeServiceCapability_RPC_Type{
+				csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME,
+				csi.NodeServiceCapability_RPC_GET_VOLUME_STATS,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			driver := &NodeService{options: &Options{DisableNodeExpansion: tc.disableNodeExpansion}}
+
+			resp, err := driver.NodeGetCapabilities(context.Background(), &csi.NodeGetCapabilitiesRequest{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(resp.GetCapabilities()) != len(tc.expectedCaps) {
+				t.Fatalf("Expected %d capabilities, but got %d", len(tc.expectedCaps), len(resp.GetCapabilities()))
+			}
+
+			for i, cap := range resp.GetCapabilities() {
+				if cap.GetRpc().GetType() != tc.expectedCaps[i] {
+					t.Fatalf("Expected capability %v, but got %v", tc.expectedCaps[i], cap.GetRpc().GetType())
+				}
+			}
+		})
+	}
+}
+
+func TestNodeExpandVolumeDisabled(t *testing.T) {
+	driver := &NodeService{options: &Options{DisableNodeExpansion: true}}
+
+	_, err := driver.NodeExpandVolume(context.Background(), &csi.NodeExpandVolumeRequest{VolumeId: "vol-test", VolumePath: "/volume/path"})
+	expectStatusErr(t, status.Error(codes.Unimplemented, "NodeExpandVolume is disabled by --disable-node-expansion"), err)
+}
+
+func TestNodeGetInfo(t *testing.T) {
+	testCases := []struct {
+		name                   string
+		enableInstanceTopology bool
+		topologyLabelTags      []string
+		metadataMock           func(ctrl *gomock.Controller) *metadata.MockMetadataService
+		expectedResp           *csi.NodeGetInfoResponse
+	}{
+		{
+			name: "without_outpost_arn",
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetInstanceID().Return("i-1234567890abcdef0")
+				m.EXPECT().GetAvailabilityZone().Return("us-west-2a")
+				m.EXPECT().GetOutpostArn().Return(arn.ARN{})
+				return m
+			},
+			expectedResp: &csi.NodeGetInfoResponse{
+				NodeId: "i-1234567890abcdef0",
+				AccessibleTopology: &csi.Topology{
+					Segments: map[string]string{
+						ZoneTopologyKey:          "us-west-2a",
+						WellKnownZoneTopologyKey: "us-west-2a",
+						OSTopologyKey:            runtime.GOOS,
+					},
+				},
+			},
+		},
+		{
+			name: "with_outpost_arn",
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetInstanceID().Return("i-1234567890abcdef0")
+				m.EXPECT().GetAvailabilityZone().Return("us-west-2a")
+				m.EXPECT().GetOutpostArn().Return(arn.ARN{
+					Partition: "aws",
+					Service:   "outposts",
+					Region:    "us-west-2",
+					AccountID: "123456789012",
+					Resource:  "op-1234567890abcdef0",
+				})
+				m.EXPECT().GetPartition().Return("aws")
+				return m
+			},
+			expectedResp: &csi.NodeGetInfoResponse{
+				NodeId: "i-1234567890abcdef0",
+				AccessibleTopology: &csi.Topology{
+					Segments: map[string]string{
+						ZoneTopologyKey:          "us-west-2a",
+						WellKnownZoneTopologyKey: "us-west-2a",
+						OSTopologyKey:            runtime.GOOS,
+						AwsRegionKey:             "us-west-2",
+						AwsPartitionKey:          "aws",
+						AwsAccountIDKey:          "123456789012",
+						AwsOutpostIDKey:          "op-1234567890abcdef0",
+					},
+				},
+			},
+		},
+		{
+			name:                   "with_instance_topology",
+			enableInstanceTopology: true,
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetInstanceID().Return("i-1234567890abcdef0")
+				m.EXPECT().GetAvailabilityZone().Return("us-west-2a")
+				m.EXPECT().GetOutpostArn().Return(arn.ARN{})
+				m.EXPECT().GetInstanceType().Return("m5.large")
+				return m
+			},
+			expectedResp: &csi.NodeGetInfoResponse{
+				NodeId: "i-1234567890abcdef0",
+				AccessibleTopology: &csi.Topology{
+					Segments: map[string]string{
+						ZoneTopologyKey:          "us-west-2a",
+						WellKnownZoneTopologyKey: "us-west-2a",
+						OSTopologyKey:            runtime.GOOS,
+						InstanceTypeTopologyKey:  "m5.large",
+					},
+				},
+			},
+		},
+		{
+			name:                   "with_instance_topology_and_outpost_arn",
+			enableInstanceTopology: true,
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetInstanceID().Return("i-1234567890abcdef0")
+				m.EXPECT().GetAvailabilityZone().Return("us-west-2a")
+				m.EXPECT().GetOutpostArn().Return(arn.ARN{
+					Partition: "aws",
+					Service:   "outposts",
+					Region:    "us-west-2",
+					AccountID: "123456789012",
+					Resource:  "op-1234567890abcdef0",
+				})
+				m.EXPECT().GetPartition().Return("aws")
+				m.EXPECT().GetInstanceType().Return("m5.large")
+				return m
+			},
+			expectedResp: &csi.NodeGetInfoResponse{
+				NodeId: "i-1234567890abcdef0",
+				AccessibleTopology: &csi.Topology{
+					Segments: map[string]string{
+						ZoneTopologyKey:          "us-west-2a",
+						WellKnownZoneTopologyKey: "us-west-2a",
+						OSTopologyKey:            runtime.GOOS,
+						AwsRegionKey:             "us-west-2",
+						AwsPartitionKey:          "aws",
+						AwsAccountIDKey:          "123456789012",
+						AwsOutpostIDKey:          "op-1234567890abcdef0",
+						InstanceTypeTopologyKey:  "m5.large",
+					},
+				},
+			},
+		},
+		{
+			name:              "with_topology_label_tags",
+			topologyLabelTags: []string{"team", "rack", "datacenter", "owner"},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetInstanceID().Return("i-1234567890abcdef0")
+				m.EXPECT().GetAvailabilityZone().Return("us-west-2a")
+				m.EXPECT().GetOutpostArn().Return(arn.ARN{})
+				m.EXPECT().GetInstanceTags(gomock.Eq([]string{"team", "rack", "datacenter", "owner"})).Return(map[string]string{
+					"team":  "storage",
+					"rack":  "r42",
+					"owner": "not a valid label value",
+				}, nil)
+				return m
+			},
+			expectedResp: &csi.NodeGetInfoResponse{
+				NodeId: "i-1234567890abcdef0",
+				AccessibleTopology: &csi.Topology{
+					Segments: map[string]string{
+						ZoneTopologyKey:                       "us-west-2a",
+						WellKnownZoneTopologyKey:              "us-west-2a",
+						OSTopologyKey:                         runtime.GOOS,
+						InstanceTagTopologyKeyPrefix + "team": "storage",
+						InstanceTagTopologyKeyPrefix + "rack": "r42",
+					},
+				},
+			},
+		},
+		{
+			name:              "with_topology_label_tags_error",
+			topologyLabelTags: []string{"team"},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetInstanceID().Return("i-1234567890abcdef0")
+				m.EXPECT().GetAvailabilityZone().Return("us-west-2a")
+				m.EXPECT().GetOutpostArn().Return(arn.ARN{})
+				m.EXPECT().GetInstanceTags(gomock.Eq([]string{"team"})).Return(nil, errors.New("instance tags are only available from IMDS"))
+				return m
+			},
+			expectedResp: &csi.NodeGetInfoResponse{
+				NodeId: "i-1234567890abcdef0",
+				AccessibleTopology: &csi.Topology{
+					Segments: map[string]string{
+						ZoneTopologyKey:          "us-west-2a",
+						WellKnownZoneTopologyKey: "us-west-2a",
+						OSTopologyKey:            runtime.GOOS,
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			metadataService := tc.metadataMock(ctrl)
+			mounter := mounter.NewMockMounter(ctrl)
+
+			driver := &NodeService{
+				metadata:       metadataService,
+				mounter:        mounter,
+				deviceResolver: mounter,
+				inFlight:       internal.NewInFlight(),
+				staged:         internal.NewStagingRegistry(),
+				options: &Options{
+					EnableInstanceTopology: tc.enableInstanceTopology,
+					TopologyLabelTags:      tc.topologyLabelTags,
+				},
+			}
+
+			resp, err := driver.NodeGetInfo(context.Background(), &csi.NodeGetInfoRequest{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(resp, tc.expectedResp) {
+				t.Fatalf("Expected response %+v, but got %+v", tc.expectedResp, resp)
+			}
+		})
+	}
+}
+
+func TestNodeGetInfoMissingNodeName(t *testing.T) {
+	testCases := []struct {
+		name                string
+		nodeName            string
+		failOnMetadataError bool
+		expectWarning       bool
+		expectedErr         error
+	}{
+		{
+			name:     "node_name_set",
+			nodeName: "test-node",
+		},
+		{
+			name:          "node_name_missing",
+			expectWarning: true,
+		},
+		{
+			name:                "node_name_missing_fail_on_metadata_error",
+			failOnMetadataError: true,
+			expectedErr:         status.Error(codes.FailedPrecondition, "CSI_NODE_NAME environment variable is not set, node taints will not be removed and node events will not be recorded: check that the node plugin is deployed with CSI_NODE_NAME set from spec.nodeName"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			t.Setenv("CSI_NODE_NAME", tc.nodeName)
+
+			var logs bytes.Buffer
+			klog.LogToStderr(false)
+			klog.SetOutput(&logs)
+			defer klog.LogToStderr(true)
+
+			metadataService := metadata.NewMockMetadataService(ctrl)
+			if tc.expectedErr == nil {
+				metadataService.EXPECT().GetInstanceID().Return("i-1234567890abcdef0")
+				metadataService.EXPECT().GetAvailabilityZone().Return("us-west-2a")
+				metadataService.EXPECT().GetOutpostArn().Return(arn.ARN{})
+			}
+
+			driver := &NodeService{
+				metadata: metadataService,
+				inFlight: internal.NewInFlight(),
+				staged:   internal.NewStagingRegistry(),
+				options: &Options{
+					FailOnMetadataError: tc.failOnMetadataError,
+				},
+			}
+
+			_, err := driver.NodeGetInfo(context.Background(), &csi.NodeGetInfoRequest{})
+			expectStatusErr(t, tc.expectedErr, err)
+
+			klog.Flush()
+			if warned := strings.Contains(logs.String(), "CSI_NODE_NAME environment variable is not set"); warned != tc.expectWarning {
+				t.Errorf("unexpected warning: got %v, want %v, logs:\n%s", warned, tc.expectWarning, logs.String())
+			}
+		})
+	}
+}
+
+func TestNodeStageVolumeReattachedDeviceName(t *testing.T) {
+	testCases := []struct {
+		name         string
+		serialMatch  bool
+		serialErr    error
+		expectFormat bool
+	}{
+		{
+			name:        "serial_matches",
+			serialMatch: true,
+		},
+		{
+			name:         "serial_mismatch",
+			expectFormat: true,
+		},
+		{
+			name:         "serial_error",
+			serialErr:    errors.New("permission denied"),
+			expectFormat: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			oldDeviceMatchesVolume := deviceMatchesVolume
+			deviceMatchesVolume = func(devicePath, volumeID string) (bool, error) {
+				if devicePath != "/dev/nvme1n1" || volumeID != "vol-test" {
+					t.Errorf("Unexpected serial check of %q for %q", devicePath, volumeID)
+				}
+				return tc.serialMatch, tc.serialErr
+			}
+			defer func() { deviceMatchesVolume = oldDeviceMatchesVolume }()
+
+			mockMounter := mounter.NewMockMounter(ctrl)
+			mockMounter.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/nvme2n1", nil)
+			mockMounter.EXPECT().PathExists(gomock.Eq("/staging/path")).Return(true, nil)
+			mockMounter.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("/dev/nvme1n1", 1, nil)
+			if tc.expectFormat {
+				mockMounter.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				mockMounter.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Eq("/dev/nvme2n1"), gomock.Eq("/staging/path"), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				mockMounter.EXPECT().NeedResize(gomock.Any(), gomock.Any()).Return(false, nil)
+			}
+
+			mockMetadata := metadata.NewMockMetadataService(ctrl)
+			mockMetadata.EXPECT().GetRegion().Return("us-west-2")
+
+			driver := &NodeService{
+				metadata:       mockMetadata,
+				mounter:        mockMounter,
+				deviceResolver: mockMounter,
+				inFlight:       internal.NewInFlight(),
+				staged:         internal.NewStagingRegistry(),
+				options:        &Options{},
+				clock:          clock.RealClock{},
+			}
+
+			_, err := driver.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				PublishContext: map[string]string{DevicePathKey: "/dev/xvdba"},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if path, ok := driver.staged.Get("vol-test"); !ok || path != "/staging/path" {
+				t.Errorf("unexpected staging path registered: got %q, want %q", path, "/staging/path")
+			}
+		})
+	}
+}
+
+func TestAttachedVolumesMetric(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// mounted tracks the staging paths mounted by the mock mounter
+	mounted := map[string]bool{}
+	mockMounter := mounter.NewMockMounter(ctrl)
+	mockMounter.EXPECT().FindDevicePath(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return("/dev/xvdba", nil).AnyTimes()
+	mockMounter.EXPECT().PathExists(gomock.Any()).Return(true, nil).AnyTimes()
+	mockMounter.EXPECT().GetDeviceNameFromMount(gomock.Any()).DoAndReturn(func(target string) (string, int, error) {
+		if mounted[target] {
+			return "/dev/xvdba", 1, nil
+		}
+		return "", 0, nil
+	}).AnyTimes()
+	mockMounter.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil).AnyTimes()
+	mockMounter.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _, target, _ string, _, _, _ []string) error {
+			mounted[target] = true
+			return nil
+		}).AnyTimes()
+	mockMounter.EXPECT().NeedResize(gomock.Any(), gomock.Any()).Return(false, nil).AnyTimes()
+	mockMounter.EXPECT().LuksClose(gomock.Any()).Return(nil).AnyTimes()
+	mockMounter.EXPECT().Unstage(gomock.Any()).DoAndReturn(func(target string) error {
+		delete(mounted, target)
+		return nil
+	}).AnyTimes()
+	mockMounter.EXPECT().List().DoAndReturn(func() ([]mountutils.MountPoint, error) {
+		mountPoints := []mountutils.MountPoint{}
+		for target := range mounted {
+			mountPoints = append(mountPoints, mountutils.MountPoint{Device: "/dev/xvdba", Path: target})
+		}
+		return mountPoints, nil
+	}).AnyTimes()
+
+	// Kubelet creates the staging paths along with their vol_data.json
+	stagingDir := t.TempDir()
+	stagingPath := func(volumeID string) string {
+		return filepath.Join(stagingDir, volumeID, stagingPathName)
+	}
+	for volumeID, driverName := range map[string]string{"vol-1": DriverName, "vol-2": DriverName, "vol-other": "other.csi.k8s.io"} {
+		if err := os.MkdirAll(stagingPath(volumeID), 0750); err != nil {
+			t.Fatalf("failed to create staging path: %v", err)
+		}
+		volData := fmt.Sprintf(`{"driverName":%q,"volumeHandle":%q}`, driverName, volumeID)
+		if err := os.WriteFile(filepath.Join(stagingDir, volumeID, volDataFileName), []byte(volData), 0640); err != nil {
+			t.Fatalf("failed to write vol_data.json: %v", err)
+		}
+	}
+	// Volumes of other drivers are not counted
+	mounted[stagingPath("vol-other")] = true
+
+	mockMetadata := metadata.NewMockMetadataService(ctrl)
+	mockMetadata.EXPECT().GetRegion().Return("us-west-2").AnyTimes()
+
+	labels := map[string]string{"node_name": "node-attached-volumes", "instance_type": "m5.large"}
+	newDriver := func() *NodeService {
+		return &NodeService{
+			metadata:              mockMetadata,
+			mounter:               mockMounter,
+			deviceResolver:        mockMounter,
+			formatter:             mounter.NewFormatter(mockMounter),
+			inFlight:              internal.NewInFlight(),
+			staged:                internal.NewStagingRegistry(),
+			options:               &Options{},
+			clock:                 clock.RealClock{},
+			attachedVolumesLabels: labels,
+		}
+	}
+	driver := newDriver()
+
+	recorder := metrics.InitializeRecorder()
+	// attachedVolumes returns the value of AttachedVolumesMetric for the labels of driver
+	attachedVolumes := func() float64 {
+		families, err := recorder.Gatherer().Gather()
+		if err != nil {
+			t.Fatalf("failed to gather metrics: %v", err)
+		}
+		for _, family := range families {
+			if family.GetName() != AttachedVolumesMetric {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				matched := 0
+				for _, label := range metric.GetLabel() {
+					if labels[label.GetName()] == label.GetValue() {
+						matched++
+					}
+				}
+				if matched == len(labels) {
+					return metric.GetGauge().GetValue()
+				}
+			}
+		}
+		return 0
+	}
+
+	stage := func(volumeID string) {
+		_, err := driver.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+			VolumeId:          volumeID,
+			StagingTargetPath: stagingPath(volumeID),
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{
+					Mount: &csi.VolumeCapability_MountVolume{
+						FsType: "ext4",
+					},
+				},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+			PublishContext: map[string]string{DevicePathKey: "/dev/xvdba"},
+		})
+		if err != nil {
+			t.Fatalf("NodeStageVolume(%s): unexpected error: %v", volumeID, err)
+		}
+	}
+	unstage := func(volumeID string) {
+		_, err := driver.NodeUnstageVolume(context.Background(), &csi.NodeUnstageVolumeRequest{
+			VolumeId:          volumeID,
+			StagingTargetPath: stagingPath(volumeID),
+		})
+		if err != nil {
+			t.Fatalf("NodeUnstageVolume(%s): unexpected error: %v", volumeID, err)
+		}
+	}
+
+	steps := []struct {
+		name     string
+		exec     func()
+		expected float64
+	}{
+		{name: "stage vol-1", exec: func() { stage("vol-1") }, expected: 1},
+		{name: "stage vol-2", exec: func() { stage("vol-2") }, expected: 2},
+		{name: "restart and stage vol-2 again", exec: func() { driver = newDriver(); stage("vol-2") }, expected: 2},
+		{name: "unstage vol-1", exec: func() { unstage("vol-1") }, expected: 1},
+		{name: "unstage vol-1 again", exec: func() { unstage("vol-1") }, expected: 1},
+		{name: "unstage vol-2", exec: func() { unstage("vol-2") }, expected: 0},
+	}
+	for _, step := range steps {
+		step.exec()
+		if got := attachedVolumes(); got != step.expected {
+			t.Fatalf("after %s: expected %v attached volumes, got %v", step.name, step.expected, got)
+		}
+	}
+}
+
+func TestNodePublishVolumeMemoryBackedTarget(t *testing.T) {
+	testCases := []struct {
+		name         string
+		memoryBacked bool
+		statfsErr    error
+		allowTmpfs   bool
+		expectMount  bool
+		expectedErr  error
+	}{
+		{
+			name:        "ext4_parent",
+			expectMount: true,
+		},
+		{
+			name:         "tmpfs_parent",
+			memoryBacked: true,
+			expectedErr:  status.Error(codes.FailedPrecondition, `target path "/var/lib/kubelet/pods/pod-uid/volumes/kubernetes.io~csi/pv/mount" is on a memory-backed (tmpfs or ramfs) filesystem, data published there would be lost: check that the kubelet root directory is on disk, or set --allow-tmpfs-publish-target`),
+		},
+		{
+			name:         "tmpfs_parent_allowed",
+			memoryBacked: true,
+			allowTmpfs:   true,
+			expectMount:  true,
+		},
+		{
+			name:        "statfs_error",
+			statfsErr:   errors.New("no such file or directory"),
+			expectMount: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var checkedPaths []string
+			oldPathIsMemoryBacked := pathIsMemoryBacked
+			pathIsMemoryBacked = func(path string) (bool, error) {
+				checkedPaths = append(checkedPaths, path)
+				return tc.memoryBacked, tc.statfsErr
+			}
+			defer func() { pathIsMemoryBacked = oldPathIsMemoryBacked }()
+
+			mockMounter := mounter.NewMockMounter(ctrl)
+			if tc.expectMount {
+				mockMounter.EXPECT().PreparePublishTarget(gomock.Any()).Return(nil)
+				mockMounter.EXPECT().IsLikelyNotMountPoint(gomock.Any()).Return(true, nil)
+				mockMounter.EXPECT().Mount(gomock.Eq("/staging/path"), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+			}
+
+			driver := &NodeService{
+				mounter:        mockMounter,
+				deviceResolver: mockMounter,
+				inFlight:       internal.NewInFlight(),
+				staged:         internal.NewStagingRegistry(),
+				options:        &Options{AllowTmpfsPublishTarget: tc.allowTmpfs},
+			}
+
+			_, err := driver.NodePublishVolume(context.Background(), &csi.NodePublishVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				TargetPath:        "/var/lib/kubelet/pods/pod-uid/volumes/kubernetes.io~csi/pv/mount",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+			})
+			expectStatusErr(t, tc.expectedErr, err)
+
+			if tc.allowTmpfs {
+				if len(checkedPaths) != 0 {
+					t.Errorf("Expected no filesystem check when tmpfs targets are allowed, got %v", checkedPaths)
+				}
+			} else if len(checkedPaths) != 1 || checkedPaths[0] != "/var/lib/kubelet/pods/pod-uid/volumes/kubernetes.io~csi/pv" {
+				t.Errorf("Expected the parent of the target path to be checked, got %v", checkedPaths)
+			}
+		})
+	}
+}
+
+func TestNodePublishVolumeReadOnlyStagingFilesystem(t *testing.T) {
+	testCases := []struct {
+		name        string
+		readOnly    bool
+		checkErr    error
+		readonlyReq bool
+		mountFlags  []string
+		expectCheck bool
+		expectMount bool
+		expectedErr error
+	}{
+		{
+			name:        "read_write_staging",
+			expectCheck: true,
+			expectMount: true,
+		},
+		{
+			name:        "read_only_staging",
+			readOnly:    true,
+			expectCheck: true,
+			expectedErr: status.Error(codes.FailedPrecondition, `staging path "/staging/path" is mounted read-only but the volume is published read-write, the kernel likely remounted the filesystem read-only after an error: check the kernel log of the node and repair the filesystem`),
+		},
+		{
+			name:        "read_only_staging_published_read_only",
+			readOnly:    true,
+			readonlyReq: true,
+			expectMount: true,
+		},
+		{
+			name:        "read_only_staging_ro_mount_flag",
+			readOnly:    true,
+			mountFlags:  []string{"ro"},
+			expectMount: true,
+		},
+		{
+			name:        "check_error",
+			checkErr:    errors.New("failed to list mounts"),
+			expectCheck: true,
+			expectMount: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var checkedPaths []string
+			oldMountIsReadOnly := mountIsReadOnly
+			mountIsReadOnly = func(path string) (bool, error) {
+				checkedPaths = append(checkedPaths, path)
+				return tc.readOnly, tc.checkErr
+			}
+			defer func() { mountIsReadOnly = oldMountIsReadOnly }()
+
+			mockMounter := mounter.NewMockMounter(ctrl)
+			if tc.expectMount {
+				mockMounter.EXPECT().PreparePublishTarget(gomock.Any()).Return(nil)
+				mockMounter.EXPECT().IsLikelyNotMountPoint(gomock.Any()).Return(true, nil)
+				mockMounter.EXPECT().Mount(gomock.Eq("/staging/path"), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+			}
+
+			driver := &NodeService{
+				mounter:        mockMounter,
+				deviceResolver: mockMounter,
+				inFlight:       internal.NewInFlight(),
+				staged:         internal.NewStagingRegistry(),
+				options:        &Options{AllowTmpfsPublishTarget: true},
+			}
+
+			_, err := driver.NodePublishVolume(context.Background(), &csi.NodePublishVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				TargetPath:        "/target/path",
+				Readonly:          tc.readonlyReq,
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{MountFlags: tc.mountFlags},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+			})
+			expectStatusErr(t, tc.expectedErr, err)
+
+			if tc.expectCheck != (len(checkedPaths) == 1) || (tc.expectCheck && checkedPaths[0] != "/staging/path") {
+				t.Errorf("Unexpected read-only checks: got %v, expected check %v", checkedPaths, tc.expectCheck)
+			}
+		})
+	}
+}
+
+func TestNodePublishVolumeEphemeral(t *testing.T) {
+	mountCapability := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{
+			Mount: &csi.VolumeCapability_MountVolume{},
+		},
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		},
+	}
+	blockCapability := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Block{
+			Block: &csi.VolumeCapability_BlockVolume{},
+		},
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		},
+	}
+
+	testCases := []struct {
+		name              string
+		volumeContext     map[string]string
+		volumeCapability  *csi.VolumeCapability
+		readOnly          bool
+		stagingTargetPath string
+		alreadyMounted    bool
+		// expectedSource, expectedFsType and expectedOptions are the arguments expected to be passed to Mount
+		expectedSource  string
+		expectedFsType  string
+		expectedOptions []string
+		expectedErr     error
+	}{
+		{
+			name:            "ephemeral",
+			volumeContext:   map[string]string{EphemeralKey: "true", EphemeralSizeKey: "64Mi"},
+			expectedSource:  "tmpfs",
+			expectedFsType:  "tmpfs",
+			expectedOptions: []string{"size=67108864"},
+		},
+		{
+			name:            "ephemeral_read_only",
+			volumeContext:   map[string]string{EphemeralKey: "true", EphemeralSizeKey: "1Gi"},
+			readOnly:        true,
+			expectedSource:  "tmpfs",
+			expectedFsType:  "tmpfs",
+			expectedOptions: []string{"size=1073741824", "ro"},
+		},
+		{
+			name:           "ephemeral_already_mounted",
+			volumeContext:  map[string]string{EphemeralKey: "true", EphemeralSizeKey: "64Mi"},
+			alreadyMounted: true,
+		},
+		{
+			name:          "ephemeral_missing_size",
+			volumeContext: map[string]string{EphemeralKey: "true"},
+			expectedErr:   status.Error(codes.InvalidArgument, "Ephemeral volumes require the size volume attribute"),
+		},
+		{
+			name:          "ephemeral_invalid_size",
+			volumeContext: map[string]string{EphemeralKey: "true", EphemeralSizeKey: "-1Gi"},
+			expectedErr:   status.Error(codes.InvalidArgument, "Invalid size (-1Gi): must be a positive quantity such as 64Mi"),
+		},
+		{
+			name:          "ephemeral_invalid_key",
+			volumeContext: map[string]string{EphemeralKey: "yes", EphemeralSizeKey: "64Mi"},
+			expectedErr:   status.Error(codes.InvalidArgument, "Invalid csi.storage.k8s.io/ephemeral (yes): must be true or false"),
+		},
+		{
+			name:             "ephemeral_block",
+			volumeContext:    map[string]string{EphemeralKey: "true", EphemeralSizeKey: "64Mi"},
+			volumeCapability: blockCapability,
+			expectedErr:      status.Error(codes.InvalidArgument, "Ephemeral volumes only support the mount access type"),
+		},
+		{
+			name:              "not_ephemeral",
+			volumeContext:     map[string]string{EphemeralKey: "false", EphemeralSizeKey: "64Mi"},
+			stagingTargetPath: "/staging/path",
+			expectedSource:    "/staging/path",
+			expectedFsType:    FSTypeExt4,
+			expectedOptions:   []string{"bind"},
+		},
+		{
+			name:          "not_ephemeral_without_staging_path",
+			volumeContext: map[string]string{EphemeralKey: "false"},
+			expectedErr:   status.Error(codes.InvalidArgument, "Staging target not provided"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if runtime.GOOS == "windows" {
+				t.Skip("Ephemeral volumes are not supported on Windows")
+			}
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			oldPathIsMemoryBacked := pathIsMemoryBacked
+			pathIsMemoryBacked = func(string) (bool, error) { return false, nil }
+			defer func() { pathIsMemoryBacked = oldPathIsMemoryBacked }()
+			oldMountIsReadOnly := mountIsReadOnly
+			mountIsReadOnly = func(string) (bool, error) { return false, nil }
+			defer func() { mountIsReadOnly = oldMountIsReadOnly }()
+
+			mockMounter := mounter.NewMockMounter(ctrl)
+			if tc.expectedSource != "" || tc.alreadyMounted {
+				mockMounter.EXPECT().PreparePublishTarget(gomock.Any()).Return(nil)
+				mockMounter.EXPECT().IsLikelyNotMountPoint(gomock.Any()).Return(!tc.alreadyMounted, nil)
+			}
+			if tc.expectedSource != "" {
+				mockMounter.EXPECT().Mount(gomock.Eq(tc.expectedSource), gomock.Any(), gomock.Eq(tc.expectedFsType), gomock.Eq(tc.expectedOptions)).Return(nil)
+			}
+
+			driver := &NodeService{
+				mounter:        mockMounter,
+				deviceResolver: mockMounter,
+				inFlight:       internal.NewInFlight(),
+				staged:         internal.NewStagingRegistry(),
+				options:        &Options{},
+			}
+
+			volumeCapability := tc.volumeCapability
+			if volumeCapability == nil {
+				volumeCapability = mountCapability
+			}
+			_, err := driver.NodePublishVolume(context.Background(), &csi.NodePublishVolumeRequest{
+				VolumeId:          "csi-ephemeral-test",
+				StagingTargetPath: tc.stagingTargetPath,
+				TargetPath:        "/var/lib/kubelet/pods/pod-uid/volumes/kubernetes.io~csi/ephemeral/mount",
+				VolumeCapability:  volumeCapability,
+				VolumeContext:     tc.volumeContext,
+				Readonly:          tc.readOnly,
+			})
+			expectStatusErr(t, tc.expectedErr, err)
+		})
+	}
+}
+
+func TestNodeUnpublishVolumeEphemeral(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// The tmpfs of an ephemeral volume is unmounted like any other target
+	mockMounter := mounter.NewMockMounter(ctrl)
+	mockMounter.EXPECT().Unpublish(gomock.Eq("/var/lib/kubelet/pods/pod-uid/volumes/kubernetes.io~csi/ephemeral/mount")).Return(nil)
+
+	driver := &NodeService{
+		mounter:        mockMounter,
+		deviceResolver: mockMounter,
+		inFlight:       internal.NewInFlight(),
+		staged:         internal.NewStagingRegistry(),
+		options:        &Options{},
+	}
+	_, err := driver.NodeUnpublishVolume(context.Background(), &csi.NodeUnpublishVolumeRequest{
+		VolumeId:   "csi-ephemeral-test",
+		TargetPath: "/var/lib/kubelet/pods/pod-uid/volumes/kubernetes.io~csi/ephemeral/mount",
+	})
+	if err != nil {
+		t.Fatalf("NodeUnpublishVolume() failed: %v", err)
+	}
+}
+
+func TestNodeUnpublishVolume(t *testing.T) {
+	testCases := []struct {
+		name        string
+		req         *csi.NodeUnpublishVolumeRequest
+		mounterMock func(ctrl *gomock.Controller) *mounter.MockMounter
+		expectedErr error
+		inflight    bool
+	}{
+		{
+			name: "success",
+			req: &csi.NodeUnpublishVolumeRequest{
+				VolumeId:   "vol-test",
+				TargetPath: "/target/path",
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().Unpublish(gomock.Eq("/target/path")).Return(nil)
+				return m
+			},
+		},
+		{
+			name: "missing_volume_id",
+			req: &csi.NodeUnpublishVolumeRequest{
+				TargetPath: "/target/path",
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "Volume ID not provided"),
+		},
+		{
+			name: "missing_target_path",
+			req: &csi.NodeUnpublishVolumeRequest{
+				VolumeId: "vol-test",
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "Target path not provided"),
+		},
+		{
+			name: "unpublish_failed",
+			req: &csi.NodeUnpublishVolumeRequest{
+				VolumeId:   "vol-test",
+				TargetPath: "/target/path",
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().Unpublish(gomock.Eq("/target/path")).Return(errors.New("unpublish failed"))
+				return m
+			},
+			expectedErr: status.Errorf(codes.Internal, "Could not unmount %q: %v", "/target/path", errors.New("unpublish failed")),
+		},
+		{
+			name: "operation_already_exists",
+			req: &csi.NodeUnpublishVolumeRequest{
+				VolumeId:   "vol-test",
+				TargetPath: "/target/path",
+			},
+			expectedErr: status.Error(codes.Aborted, "An operation with the given volume=\"vol-test\" is already in progress"),
+			inflight:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var mounter *mounter.MockMounter
+			if tc.mounterMock != nil {
+				mounter = tc.mounterMock(ctrl)
+			}
+
+			driver := &NodeService{
+				mounter:        mounter,
+				deviceResolver: mounter,
+				inFlight:       internal.NewInFlight(),
+				staged:         internal.NewStagingRegistry(),
+			}
+
+			if tc.inflight {
+				driver.inFlight.Insert("vol-test")
+			}
+
+			_, err := driver.NodeUnpublishVolume(context.Background(), tc.req)
+			if !reflect.DeepEqual(err, tc.expectedErr) {
+				t.Fatalf("Expected error '%v' but got '%v'", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestNodeExpandVolume(t *testing.T) {
+	testCases := []struct {
+		name         string
+		req          *csi.NodeExpandVolumeRequest
+		mounterMock  func(ctrl *gomock.Controller) *mounter.MockMounter
+		metadataMock func(ctrl *gomock.Controller) *metadata.MockMetadataService
+		expectedResp *csi.NodeExpandVolumeResponse
+		expectedErr  error
+	}{
+		{
+			name: "success",
+			req: &csi.NodeExpandVolumeRequest{
+				VolumeId:   "vol-test",
+				VolumePath: "/volume/path",
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().IsBlockDevice(gomock.Eq("/volume/path")).Return(false, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/volume/path")).Return("device-name", 1, nil)
+				m.EXPECT().IsDeviceMapper(gomock.Eq("device-name")).Return(false, nil)
+				m.EXPECT().GetPartition(gomock.Eq("device-name")).Return("", "", nil)
+				m.EXPECT().FindDevicePath(gomock.Eq("device-name"), gomock.Eq("vol-test"), gomock.Eq(""), gomock.Eq("us-west-2")).Return("/dev/xvdba", nil)
+				m.EXPECT().GrowPartition(gomock.Eq(""), gomock.Eq("")).Return(false, nil)
+				m.EXPECT().Resize(gomock.Eq("/dev/xvdba"), gomock.Eq("/volume/path")).Return(true, nil)
+				m.EXPECT().GetBlockSizeBytes(gomock.Eq("/dev/xvdba")).Return(int64(1000), nil)
+				return m
+			},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				return m
+			},
+			expectedResp: &csi.NodeExpandVolumeResponse{CapacityBytes: int64(1000)},
+		},
+		{
+			name: "missing_volume_id",
+			req: &csi.NodeExpandVolumeRequest{
+				VolumePath: "/volume/path",
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "Volume ID not provided"),
+		},
+		{
+			name: "missing_volume_path",
+			req: &csi.NodeExpandVolumeRequest{
+				VolumeId: "vol-test",
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "volume path must be provided"),
+		},
+		{
+			name: "zero_required_bytes",
+			req: &csi.NodeExpandVolumeRequest{
+				VolumeId:      "vol-test",
+				VolumePath:    "/volume/path",
+				CapacityRange: &csi.CapacityRange{RequiredBytes: 0},
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "Invalid capacity range: required bytes must be positive, got 0"),
+		},
+		{
+			name: "negative_required_bytes",
+			req: &csi.NodeExpandVolumeRequest{
+				VolumeId:      "vol-test",
+				VolumePath:    "/volume/path",
+				CapacityRange: &csi.CapacityRange{RequiredBytes: -1024},
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "Invalid capacity range: required bytes must be positive, got -1024"),
+		},
+		{
+			name: "valid_required_bytes",
+			req: &csi.NodeExpandVolumeRequest{
+				VolumeId:      "vol-test",
+				VolumePath:    "/volume/path",
+				CapacityRange: &csi.CapacityRange{RequiredBytes: 1000},
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().IsBlockDevice(gomock.Eq("/volume/path")).Return(false, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/volume/path")).Return("device-name", 1, nil)
+				m.EXPECT().IsDeviceMapper(gomock.Eq("device-name")).Return(false, nil)
+				m.EXPECT().GetPartition(gomock.Eq("device-name")).Return("", "", nil)
+				m.EXPECT().FindDevicePath(gomock.Eq("device-name"), gomock.Eq("vol-test"), gomock.Eq(""), gomock.Eq("us-west-2")).Return("/dev/xvdba", nil)
+				m.EXPECT().GrowPartition(gomock.Eq(""), gomock.Eq("")).Return(false, nil)
+				m.EXPECT().Resize(gomock.Eq("/dev/xvdba"), gomock.Eq("/volume/path")).Return(true, nil)
+				m.EXPECT().GetBlockSizeBytes(gomock.Eq("/dev/xvdba")).Return(int64(1000), nil)
+				return m
+			},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				return m
+			},
+			expectedResp: &csi.NodeExpandVolumeResponse{CapacityBytes: int64(1000)},
+		},
+		{
+			name: "invalid_volume_capability",
+			req: &csi.NodeExpandVolumeRequest{
+				VolumeId:   "vol-test",
+				VolumePath: "/volume/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Block{
+						Block: &csi.VolumeCapability_BlockVolume{},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_UNKNOWN,
+					},
+				},
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "VolumeCapability is invalid: block:<> access_mode:<> "),
+		},
+		{
+			name: "block_device",
+			req: &csi.NodeExpandVolumeRequest{
+				VolumeId:   "vol-test",
+				VolumePath: "/volume/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Block{
+						Block: &csi.VolumeCapability_BlockVolume{},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+			},
+			expectedResp: &csi.NodeExpandVolumeResponse{},
+		},
+		{
+			name: "is_block_device_error",
+			req: &csi.NodeExpandVolumeRequest{
+				VolumeId:   "vol-test",
+				VolumePath: "/volume/path",
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().IsBlockDevice(gomock.Eq("/volume/path")).Return(false, errors.New("failed to determine if block device"))
+				return m
+			},
+			expectedErr: status.Error(codes.Internal, "failed to determine if volumePath [/volume/path] is a block device: failed to determine if block device"),
+		},
+		{
+			name: "get_block_size_bytes_error",
+			req: &csi.NodeExpandVolumeRequest{
+				VolumeId:   "vol-test",
+				VolumePath: "/volume/path",
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().IsBlockDevice(gomock.Eq("/volume/path")).Return(true, nil)
+				m.EXPECT().GetBlockSizeBytes(gomock.Eq("/volume/path")).Return(int64(0), errors.New("failed to get block size"))
+				return m
+			},
+			expectedErr: status.Error(codes.Internal, "failed to get block capacity on path /volume/path: failed to get block size"),
+		},
+		{
+			name: "block_device_success",
+			req: &csi.NodeExpandVolumeRequest{
+				VolumeId:   "vol-test",
+				VolumePath: "/volume/path",
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().IsBlockDevice(gomock.Eq("/volume/path")).Return(true, nil)
+				m.EXPECT().GetBlockSizeBytes(gomock.Eq("/volume/path")).Return(int64(1000), nil)
+				return m
+			},
+			expectedResp: &csi.NodeExpandVolumeResponse{CapacityBytes: int64(1000)},
+		},
+		{
+			name: "device_mapper_target",
+			req: &csi.NodeExpandVolumeRequest{
+				VolumeId:   "vol-test",
+				VolumePath: "/volume/path",
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().IsBlockDevice(gomock.Eq("/volume/path")).Return(false, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/volume/path")).Return("/dev/mapper/vg-lv", 1, nil)
+				m.EXPECT().IsDeviceMapper(gomock.Eq("/dev/mapper/vg-lv")).Return(true, nil)
+				return m
+			},
+			expectedErr: status.Error(codes.FailedPrecondition, "device /dev/mapper/vg-lv mounted at /volume/path is a device-mapper target not managed by the driver; grow the underlying physical volume and logical volume (e.g. pvresize and lvextend) before resizing the filesystem"),
+		},
+		{
+			name: "is_device_mapper_error",
+			req: &csi.NodeExpandVolumeRequest{
+				VolumeId:   "vol-test",
+				VolumePath: "/volume/path",
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().IsBlockDevice(gomock.Eq("/volume/path")).Return(false, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/volume/path")).Return("device-name", 1, nil)
+				m.EXPECT().IsDeviceMapper(gomock.Eq("device-name")).Return(false, errors.New("failed to stat"))
+				return m
+			},
+			expectedErr: status.Error(codes.Internal, "failed to determine if device device-name is a device-mapper target: failed to stat"),
+		},
+		{
+			name: "get_device_name_error",
+			req: &csi.NodeExpandVolumeRequest{
+				VolumeId:   "vol-test",
+				VolumePath: "/volume/path",
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().IsBlockDevice(gomock.Eq("/volume/path")).Return(false, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/volume/path")).Return("", 0, errors.New("failed to get device name"))
+				return m
+			},
+			metadataMock: nil,
+			expectedResp: nil,
+			expectedErr:  status.Error(codes.Internal, "failed to get device name from mount /volume/path: failed to get device name"),
+		},
+		{
+			name: "find_device_path_error",
+			req: &csi.NodeExpandVolumeRequest{
+				VolumeId:   "vol-test",
+				VolumePath: "/volume/path",
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().IsBlockDevice(gomock.Eq("/volume/path")).Return(false, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/volume/path")).Return("device-name", 1, nil)
+				m.EXPECT().IsDeviceMapper(gomock.Eq("device-name")).Return(false, nil)
+				m.EXPECT().GetPartition(gomock.Eq("device-name")).Return("", "", nil)
+				m.EXPECT().FindDevicePath(gomock.Eq("device-name"), gomock.Eq("vol-test"), gomock.Eq(""), gomock.Eq("us-west-2")).Return("", errors.New("failed to find device path"))
+				return m
+			},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				return m
+			},
+			expectedResp: nil,
+			expectedErr:  status.Error(codes.Internal, "failed to find device path for device name device-name for mount /volume/path: failed to find device path"),
+		},
+		{
+			name: "partition_grown",
+			req: &csi.NodeExpandVolumeRequest{
+				VolumeId:   "vol-test",
+				VolumePath: "/volume/path",
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().IsBlockDevice(gomock.Eq("/volume/path")).Return(false, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/volume/path")).Return("/dev/nvme1n1p1", 1, nil)
+				m.EXPECT().IsDeviceMapper(gomock.Eq("/dev/nvme1n1p1")).Return(false, nil)
+				m.EXPECT().GetPartition(gomock.Eq("/dev/nvme1n1p1")).Return("/dev/nvme1n1", "1", nil)
+				m.EXPECT().FindDevicePath(gomock.Eq("/dev/nvme1n1p1"), gomock.Eq("vol-test"), gomock.Eq("1"), gomock.Eq("us-west-2")).Return("/dev/nvme1n1p1", nil)
+				m.EXPECT().GrowPartition(gomock.Eq("/dev/nvme1n1"), gomock.Eq("1")).Return(true, nil)
+				m.EXPECT().Resize(gomock.Eq("/dev/nvme1n1p1"), gomock.Eq("/volume/path")).Return(true, nil)
+				m.EXPECT().GetBlockSizeBytes(gomock.Eq("/dev/nvme1n1p1")).Return(int64(2000), nil)
+				return m
+			},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				return m
+			},
+			expectedResp: &csi.NodeExpandVolumeResponse{CapacityBytes: int64(2000)},
+		},
+		{
+			name: "grow_partition_error",
+			req: &csi.NodeExpandVolumeRequest{
+				VolumeId:   "vol-test",
+				VolumePath: "/volume/path",
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().IsBlockDevice(gomock.Eq("/volume/path")).Return(false, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/volume/path")).Return("/dev/xvdba1", 1, nil)
+				m.EXPECT().IsDeviceMapper(gomock.Eq("/dev/xvdba1")).Return(false, nil)
+				m.EXPECT().GetPartition(gomock.Eq("/dev/xvdba1")).Return("/dev/xvdba", "1", nil)
+				m.EXPECT().FindDevicePath(gomock.Eq("/dev/xvdba1"), gomock.Eq("vol-test"), gomock.Eq("1"), gomock.Eq("us-west-2")).Return("/dev/xvdba1", nil)
+				m.EXPECT().GrowPartition(gomock.Eq("/dev/xvdba"), gomock.Eq("1")).Return(false, errors.New("growpart not found"))
+				return m
+			},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				return m
+			},
+			expectedErr: status.Error(codes.Internal, "Could not grow partition 1 of volume \"vol-test\" (\"/dev/xvdba\"): growpart not found"),
+		},
+		{
+			name: "resize_error",
+			req: &csi.NodeExpandVolumeRequest{
+				VolumeId:   "vol-test",
+				VolumePath: "/volume/path",
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().IsBlockDevice(gomock.Eq("/volume/path")).Return(false, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/volume/path")).Return("device-name", 1, nil)
+				m.EXPECT().IsDeviceMapper(gomock.Eq("device-name")).Return(false, nil)
+				m.EXPECT().GetPartition(gomock.Eq("device-name")).Return("", "", nil)
+				m.EXPECT().FindDevicePath(gomock.Eq("device-name"), gomock.Eq("vol-test"), gomock.Eq(""), gomock.Eq("us-west-2")).Return("/dev/xvdba", nil)
+				m.EXPECT().GrowPartition(gomock.Eq(""), gomock.Eq("")).Return(false, nil)
+				m.EXPECT().Resize(gomock.Eq("/dev/xvdba"), gomock.Eq("/volume/path")).Return(false, errors.New("failed to resize volume"))
+				return m
+			},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				return m
+			},
+			expectedResp: nil,
+			expectedErr:  status.Error(codes.Internal, "Could not resize volume \"vol-test\" (\"/dev/xvdba\"): failed to resize volume"),
+		},
+		{
+			name: "get_block_size_bytes_error_after_resize",
+			req: &csi.NodeExpandVolumeRequest{
+				VolumeId:   "vol-test",
+				VolumePath: "/volume/path",
+			},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().IsBlockDevice(gomock.Eq("/volume/path")).Return(false, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/volume/path")).Return("device-name", 1, nil)
+				m.EXPECT().IsDeviceMapper(gomock.Eq("device-name")).Return(false, nil)
+				m.EXPECT().GetPartition(gomock.Eq("device-name")).Return("", "", nil)
+				m.EXPECT().FindDevicePath(gomock.Eq("device-name"), gomock.Eq("vol-test"), gomock.Eq(""), gomock.Eq("us-west-2")).Return("/dev/xvdba", nil)
+				m.EXPECT().GrowPartition(gomock.Eq(""), gomock.Eq("")).Return(false, nil)
+				m.EXPECT().Resize(gomock.Eq("/dev/xvdba"), gomock.Eq("/volume/path")).Return(true, nil)
+				m.EXPECT().GetBlockSizeBytes(gomock.Eq("/dev/xvdba")).Return(int64(0), errors.New("failed to get block size"))
+				return m
+			},
+			metadataMock: func(ctrl *gomock.Controller) *metadata.MockMetadataService {
+				m := metadata.NewMockMetadataService(ctrl)
+				m.EXPECT().GetRegion().Return("us-west-2")
+				return m
+			},
+			expectedResp: nil,
+			expectedErr:  status.Error(codes.Internal, "failed to get block capacity on path /volume/path: failed to get block size"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var mounter *mounter.MockMounter
+			if tc.mounterMock != nil {
+				mounter = tc.mounterMock(ctrl)
+			}
+
+			var metadata *metadata.MockMetadataService
+			if tc.metadataMock != nil {
+				metadata = tc.metadataMock(ctrl)
+			}
+
+			driver := &NodeService{
+				mounter:        mounter,
+				deviceResolver: mounter,
+				metadata:       metadata,
+				inFlight:       internal.NewInFlight(),
+				staged:         internal.NewStagingRegistry(),
+				options:        &Options{},
+			}
+
+			resp, err := driver.NodeExpandVolume(context.Background(), tc.req)
+			if !reflect.DeepEqual(err, tc.expectedErr) {
+				t.Fatalf("Expected error '%v' but got '%v'", tc.expectedErr, err)
+			}
+
+			if !reflect.DeepEqual(resp, tc.expectedResp) {
+				t.Fatalf("Expected response '%v' but got '%v'", tc.expectedResp, resp)
+			}
+		})
+	}
+}
+
+func TestNodeExpandVolumeSnapshotBeforeExpand(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	expectedOptions := &cloud.SnapshotOptions{
+		Description: "pre-expand-vol-test-2147483648-2024-03-01T12:00:00Z",
+		Tags:        map[string]string{CreatedByTag: CreatedByPreExpand, cloud.SnapshotNameTagKey: "pre-expand-vol-test-2147483648"},
+	}
+	testCases := []struct {
+		name          string
+		requiredBytes int64
+		existing      *cloud.Snapshot
+		snapshotErr   error
+		expectedResp  *csi.NodeExpandVolumeResponse
+		expectedErr   error
+	}{
+		{
+			name:          "snapshot created before expanding",
+			requiredBytes: 2147483648,
+			expectedResp:  &csi.NodeExpandVolumeResponse{CapacityBytes: int64(1000)},
+		},
+		{
+			name:         "snapshot named after the device size without a capacity range",
+			expectedResp: &csi.NodeExpandVolumeResponse{CapacityBytes: int64(1000)},
+		},
+		{
+			name:          "snapshot of a previous attempt reused",
+			requiredBytes: 2147483648,
+			existing:      &cloud.Snapshot{SnapshotID: "snap-previous", SourceVolumeID: "vol-test"},
+			expectedResp:  &csi.NodeExpandVolumeResponse{CapacityBytes: int64(1000)},
+		},
+		{
+			name:          "volume not expanded when the snapshot fails",
+			requiredBytes: 2147483648,
+			snapshotErr:   errors.New("SnapshotLimitExceeded"),
+			expectedErr:   status.Error(codes.Internal, "Could not snapshot volume \"vol-test\" before expanding it: SnapshotLimitExceeded"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockMetadata := metadata.NewMockMetadataService(ctrl)
+			mockMetadata.EXPECT().GetRegion().Return("us-west-2")
+
+			mockMounter := mounter.NewMockMounter(ctrl)
+			mockMounter.EXPECT().IsBlockDevice(gomock.Eq("/volume/path")).Return(false, nil)
+			mockMounter.EXPECT().GetDeviceNameFromMount(gomock.Eq("/volume/path")).Return("device-name", 1, nil)
+			mockMounter.EXPECT().IsDeviceMapper(gomock.Eq("device-name")).Return(false, nil)
+			mockMounter.EXPECT().GetPartition(gomock.Eq("device-name")).Return("", "", nil)
+			mockMounter.EXPECT().FindDevicePath(gomock.Eq("device-name"), gomock.Eq("vol-test"), gomock.Eq(""), gomock.Eq("us-west-2")).Return("/dev/xvdba", nil)
+
+			if tc.requiredBytes == 0 {
+				mockMounter.EXPECT().GetBlockSizeBytes(gomock.Eq("/dev/xvdba")).Return(int64(2147483648), nil)
+			}
+
+			mockCloud := cloud.NewMockCloud(ctrl)
+			var snapshotCall *gomock.Call
+			if tc.existing != nil {
+				snapshotCall = mockCloud.EXPECT().GetSnapshotByName(gomock.Any(), gomock.Eq("pre-expand-vol-test-2147483648")).Return(tc.existing, nil)
+			} else {
+				mockCloud.EXPECT().GetSnapshotByName(gomock.Any(), gomock.Eq("pre-expand-vol-test-2147483648")).Return(nil, cloud.ErrNotFound)
+				snapshotCall = mockCloud.EXPECT().CreateSnapshot(gomock.Any(), gomock.Eq("vol-test"), gomock.Eq(expectedOptions))
+			}
+			if tc.snapshotErr != nil {
+				snapshotCall.Return(nil, tc.snapshotErr)
+			} else {
+				if tc.existing == nil {
+					snapshotCall.Return(&cloud.Snapshot{SnapshotID: "snap-test", SourceVolumeID: "vol-test"}, nil)
+				}
+				gomock.InOrder(
+					snapshotCall,
+					mockMounter.EXPECT().GrowPartition(gomock.Eq(""), gomock.Eq("")).Return(false, nil),
+					mockMounter.EXPECT().Resize(gomock.Eq("/dev/xvdba"), gomock.Eq("/volume/path")).Return(true, nil),
+				)
+				mockMounter.EXPECT().GetBlockSizeBytes(gomock.Eq("/dev/xvdba")).Return(int64(1000), nil)
+			}
+
+			driver := &NodeService{
+				cloud:          mockCloud,
+				metadata:       mockMetadata,
+				mounter:        mockMounter,
+				deviceResolver: mockMounter,
+				inFlight:       internal.NewInFlight(),
+				staged:         internal.NewStagingRegistry(),
+				options:        &Options{SnapshotBeforeExpand: true},
+				clock:          testingclock.NewFakeClock(now),
+			}
+
+			req := &csi.NodeExpandVolumeRequest{
+				VolumeId:   "vol-test",
+				VolumePath: "/volume/path",
+			}
+			if tc.requiredBytes != 0 {
+				req.CapacityRange = &csi.CapacityRange{RequiredBytes: tc.requiredBytes}
+			}
+			resp, err := driver.NodeExpandVolume(context.Background(), req)
+			expectStatusErr(t, tc.expectedErr, err)
+			if !reflect.DeepEqual(resp, tc.expectedResp) {
+				t.Fatalf("Expected response %v, got %v", tc.expectedResp, resp)
+			}
+		})
+	}
+}
+
+func TestNodeExpandVolumeExternalFsManagement(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMetadata := metadata.NewMockMetadataService(ctrl)
+	mockMetadata.EXPECT().GetRegion().Return("us-west-2").AnyTimes()
+	mockMounter := mounter.NewMockMounter(ctrl)
+	newDriver := func() *NodeService {
+		return &NodeService{
+			metadata:       mockMetadata,
+			mounter:        mockMounter,
+			deviceResolver: mockMounter,
+			inFlight:       internal.NewInFlight(),
+			staged:         internal.NewStagingRegistry(),
+			options:        &Options{},
+			clock:          clock.RealClock{},
+		}
+	}
+	driver := newDriver()
+	stagingPath := filepath.Join(t.TempDir(), "globalmount")
+	expandReq := &csi.NodeExpandVolumeRequest{VolumeId: "vol-test", VolumePath: "/volume/path", StagingTargetPath: stagingPath}
+
+	// Staged with the key, neither the stage nor the expansion resize the filesystem
+	gomock.InOrder(
+		mockMounter.EXPECT().FindDevicePath("/dev/xvdba", "vol-test", "", "us-west-2").Return("/dev/nvme1n1", nil),
+		mockMounter.EXPECT().PathExists(stagingPath).Return(true, nil),
+		mockMounter.EXPECT().GetDeviceNameFromMount(stagingPath).Return("", 1, nil),
+		mockMounter.EXPECT().GetDiskFormat("/dev/nvme1n1").Return("ext4", nil),
+		mockMounter.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), "/dev/nvme1n1", stagingPath, "ext4", gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
+	)
+	_, err := driver.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+		VolumeId:          "vol-test",
+		StagingTargetPath: stagingPath,
+		VolumeCapability: &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{FsType: "ext4"}},
+			AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+		},
+		PublishContext: map[string]string{DevicePathKey: "/dev/xvdba"},
+		VolumeContext:  map[string]string{ExternalFsManagementKey: "true"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected stage error: %v", err)
+	}
+
+	// The record survives a restart of the node plugin
+	driver = newDriver()
+	gomock.InOrder(
+		mockMounter.EXPECT().IsBlockDevice("/volume/path").Return(false, nil),
+		mockMounter.EXPECT().GetDeviceNameFromMount("/volume/path").Return("/dev/nvme1n1", 1, nil),
+		mockMounter.EXPECT().GetBlockSizeBytes("/dev/nvme1n1").Return(int64(2000), nil),
+	)
+	resp, err := driver.NodeExpandVolume(context.Background(), expandReq)
+	if err != nil {
+		t.Fatalf("Unexpected expand error: %v", err)
+	}
+	if resp.GetCapacityBytes() != 2000 {
+		t.Fatalf("Expected the current size of the device, got %d", resp.GetCapacityBytes())
+	}
+
+	// Once unstaged, the volume is resized again unless it is staged with the key again
+	mockMounter.EXPECT().GetDeviceNameFromMount(stagingPath).Return("", 0, nil)
+	mockMounter.EXPECT().LuksClose("ebs-luks-vol-test").Return(nil)
+	if _, err = driver.NodeUnstageVolume(context.Background(), &csi.NodeUnstageVolumeRequest{VolumeId: "vol-test", StagingTargetPath: stagingPath}); err != nil {
+		t.Fatalf("Unexpected unstage error: %v", err)
+	}
+
+	gomock.InOrder(
+		mockMounter.EXPECT().IsBlockDevice("/volume/path").Return(false, nil),
+		mockMounter.EXPECT().GetDeviceNameFromMount("/volume/path").Return("/dev/nvme1n1", 1, nil),
+		mockMounter.EXPECT().IsDeviceMapper("/dev/nvme1n1").Return(false, nil),
+		mockMounter.EXPECT().GetPartition("/dev/nvme1n1").Return("", "", nil),
+		mockMounter.EXPECT().FindDevicePath("/dev/nvme1n1", "vol-test", "", "us-west-2").Return("/dev/nvme1n1", nil),
+		mockMounter.EXPECT().GrowPartition("", "").Return(false, nil),
+		mockMounter.EXPECT().Resize("/dev/nvme1n1", "/volume/path").Return(true, nil),
+		mockMounter.EXPECT().GetBlockSizeBytes("/dev/nvme1n1").Return(int64(2000), nil),
+	)
+	if _, err = driver.NodeExpandVolume(context.Background(), expandReq); err != nil {
+		t.Fatalf("Unexpected expand error: %v", err)
+	}
+}
+
+func TestNodeGetVolumeStats(t *testing.T) {
+	testCases := []struct {
+		name           string
+		validVolId     bool
+		validPath      bool
+		metricsStatErr bool
+		mounterMock    func(mockCtl *gomock.Controller, dir string) *mounter.MockMounter
+		expectedErr    func(dir string) error
+	}{
+		{
+			name:       "success normal",
+			validVolId: true,
+			validPath:  true,
+			mounterMock: func(ctrl *gomock.Controller, dir string) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().PathExists(dir).Return(true, nil)
+				m.EXPECT().IsBlockDevice(gomock.Eq(dir)).Return(false, nil)
+				return m
+			},
+			expectedErr: func(dir string) error {
+				return nil
+			},
+		},
+		{
+			name:       "invalid_volume_id",
+			validVolId: false,
+			expectedErr: func(dir string) error {
+				return status.Error(codes.InvalidArgument, "NodeGetVolumeStats volume ID was empty")
+			},
+		},
+		{
+			name:       "invalid_volume_path",
+			validVolId: true,
+			validPath:  false,
+			expectedErr: func(dir string) error {
+				return status.Error(codes.InvalidArgument, "NodeGetVolumeStats volume path was empty")
+			},
+		},
+		{
+			name:       "path_exists_error",
+			validVolId: true,
+			validPath:  true,
+			mounterMock: func(ctrl *gomock.Controller, dir string) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().PathExists(dir).Return(false, errors.New("path exists error"))
+				return m
+			},
+			expectedErr: func(dir string) error {
+				return status.Errorf(codes.Internal, "unknown error when stat on %s: path exists error", dir)
+			},
+		},
+		{
+			name:       "path_does_not_exist",
+			validVolId: true,
+			validPath:  true,
+			mounterMock: func(ctrl *gomock.Controller, dir string) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().PathExists(dir).Return(false, nil)
+				return m
+			},
+			expectedErr: func(dir string) error {
+				return status.Errorf(codes.NotFound, "path %s does not exist", dir)
+			},
+		},
+		{
+			name:       "is_block_device_error",
+			validVolId: true,
+			validPath:  true,
+			mounterMock: func(ctrl *gomock.Controller, dir string) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().PathExists(dir).Return(true, nil)
+				m.EXPECT().IsBlockDevice(gomock.Eq(dir)).Return(false, errors.New("is block device error"))
+				return m
+			},
+			expectedErr: func(dir string) error {
+				return status.Errorf(codes.Internal, "failed to determine whether %s is block device: is block device error", dir)
+			},
+		},
+		{
+			name:       "get_block_size_bytes_error",
+			validVolId: true,
+			validPath:  true,
+			mounterMock: func(ctrl *gomock.Controller, dir string) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().PathExists(dir).Return(true, nil)
+				m.EXPECT().IsBlockDevice(gomock.Eq(dir)).Return(true, nil)
+				m.EXPECT().GetBlockSizeBytes(dir).Return(int64(0), errors.New("get block size bytes error"))
+				return m
+			},
+			expectedErr: func(dir string) error {
+				return status.Errorf(codes.Internal, "failed to get block capacity on path %s: %v", dir, "get block size bytes error")
+			},
+		},
+		{
+			name:       "success block device",
+			validVolId: true,
+			validPath:  true,
+			mounterMock: func(ctrl *gomock.Controller, dir string) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().PathExists(dir).Return(true, nil)
+				m.EXPECT().IsBlockDevice(gomock.Eq(dir)).Return(true, nil)
+				m.EXPECT().GetBlockSizeBytes(dir).Return(int64(1024), nil)
+				return m
+			},
+			expectedErr: func(dir string) error {
+				return nil
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			dir := t.TempDir()
+
+			var mounter *mounter.MockMounter
+			if tc.mounterMock != nil {
+				mounter = tc.mounterMock(ctrl, dir)
+			}
+
+			var metadata *metadata.MockMetadataService
+			driver := &NodeService{
+				mounter:        mounter,
+				deviceResolver: mounter,
+				metadata:       metadata,
+				inFlight:       internal.NewInFlight(),
+				options:        &Options{},
+			}
+
+			req := &csi.NodeGetVolumeStatsRequest{}
+			if tc.validVolId {
+				req.VolumeId = "vol-test"
+			}
+			if tc.validPath {
+				req.VolumePath = dir
+			}
+			if tc.metricsStatErr {
+				req.VolumePath = "fake-path"
+			}
+
+			_, err := driver.NodeGetVolumeStats(context.TODO(), req)
+
+			if !reflect.DeepEqual(err, tc.expectedErr(dir)) {
+				t.Fatalf("Expected error '%v' but got '%v'", tc.expectedErr(dir), err)
+			}
+		})
+	}
+}
+
+func TestNodeGetVolumeStatsMountPointPrefix(t *testing.T) {
+	testCases := []struct {
+		name             string
+		mountPointPrefix string
+		volumePath       string
+		expectedErr      error
+	}{
+		{
+			name:             "volume path under the prefix",
+			mountPointPrefix: "/var/lib/kubelet",
+			volumePath:       "/var/lib/kubelet/pods/uid/volumes/kubernetes.io~csi/pv/mount",
+		},
+		{
+			name:             "prefix with a trailing separator",
+			mountPointPrefix: "/var/lib/kubelet/",
+			volumePath:       "/var/lib/kubelet/pods/uid/volumes/kubernetes.io~csi/pv/mount",
+		},
+		{
+			name:       "empty prefix accepts any path",
+			volumePath: "/proc/1/root",
+		},
+		{
+			name:             "prefix mismatch",
+			mountPointPrefix: "/var/lib/kubelet",
+			volumePath:       "/proc/1/root",
+			expectedErr:      status.Error(codes.InvalidArgument, `NodeGetVolumeStats volume path "/proc/1/root" is not under "/var/lib/kubelet"`),
+		},
+		{
+			name:             "sibling of the prefix",
+			mountPointPrefix: "/var/lib/kubelet",
+			volumePath:       "/var/lib/kubelet-other/pods",
+			expectedErr:      status.Error(codes.InvalidArgument, `NodeGetVolumeStats volume path "/var/lib/kubelet-other/pods" is not under "/var/lib/kubelet"`),
+		},
+		{
+			name:             "traversal out of the prefix",
+			mountPointPrefix: "/var/lib/kubelet",
+			volumePath:       "/var/lib/kubelet/pods/../../../../proc/1/root",
+			expectedErr:      status.Error(codes.InvalidArgument, `NodeGetVolumeStats volume path "/var/lib/kubelet/pods/../../../../proc/1/root" is not under "/var/lib/kubelet"`),
+		},
+		{
+			name:             "relative path",
+			mountPointPrefix: "/var/lib/kubelet",
+			volumePath:       "var/lib/kubelet/pods",
+			expectedErr:      status.Error(codes.InvalidArgument, `NodeGetVolumeStats volume path "var/lib/kubelet/pods" is not under "/var/lib/kubelet"`),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mounter := mounter.NewMockMounter(ctrl)
+			if tc.expectedErr == nil {
+				mounter.EXPECT().PathExists(tc.volumePath).Return(true, nil)
+				mounter.EXPECT().IsBlockDevice(tc.volumePath).Return(true, nil)
+				mounter.EXPECT().GetBlockSizeBytes(tc.volumePath).Return(int64(1024), nil)
+			}
+
+			driver := &NodeService{
+				mounter:        mounter,
+				deviceResolver: mounter,
+				inFlight:       internal.NewInFlight(),
+				options:        &Options{CSIMountPointPrefix: tc.mountPointPrefix},
+			}
+
+			_, err := driver.NodeGetVolumeStats(context.TODO(), &csi.NodeGetVolumeStatsRequest{VolumeId: "vol-test", VolumePath: tc.volumePath})
+			expectStatusErr(t, tc.expectedErr, err)
+		})
+	}
+}
+
+func TestNodeVolumeOperationsInFlight(t *testing.T) {
+	testCases := []struct {
+		name        string
+		mounterMock func(ctrl *gomock.Controller, dir string) *mounter.MockMounter
+		call        func(driver *NodeService, dir string) error
+	}{
+		{
+			name: "stats during a mutating operation succeed",
+			mounterMock: func(ctrl *gomock.Controller, dir string) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().PathExists(dir).Return(true, nil)
+				m.EXPECT().IsBlockDevice(dir).Return(true, nil)
+				m.EXPECT().GetBlockSizeBytes(dir).Return(int64(1024), nil)
+				return m
+			},
+			call: func(driver *NodeService, dir string) error {
+				_, err := driver.NodeGetVolumeStats(context.Background(), &csi.NodeGetVolumeStatsRequest{VolumeId: "vol-test", VolumePath: dir})
+				return err
+			},
+		},
+		{
+			name: "expand during a mutating operation succeeds",
+			mounterMock: func(ctrl *gomock.Controller, dir string) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().IsBlockDevice(dir).Return(true, nil)
+				m.EXPECT().GetBlockSizeBytes(dir).Return(int64(1024), nil)
+				return m
+			},
+			call: func(driver *NodeService, dir string) error {
+				_, err := driver.NodeExpandVolume(context.Background(), &csi.NodeExpandVolumeRequest{VolumeId: "vol-test", VolumePath: dir})
+				return err
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			dir := t.TempDir()
+			m := tc.mounterMock(ctrl, dir)
+
+			driver := &NodeService{
+				mounter:        m,
+				deviceResolver: m,
+				inFlight:       internal.NewInFlight(),
+				options:        &Options{},
+			}
+			driver.inFlight.Insert("vol-test")
+
+			if err := tc.call(driver, dir); err != nil {
+				t.Fatalf("Expected no error but got '%v'", err)
+			}
+		})
+	}
+}
+
+func TestRemoveNotReadyTaint(t *testing.T) {
+	nodeName := "test-node-123"
+	csiNodeWithAllocatable := func() *v1.CSINode {
+		count := int32(1)
+		return &v1.CSINode{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: nodeName,
+			},
+			Spec: v1.CSINodeSpec{
+				Drivers: []v1.CSINodeDriver{
+					{
+						Name:   DriverName,
+						NodeID: nodeName,
+						Allocatable: &v1.VolumeNodeResources{
+							Count: &count,
+						},
+					},
+				},
+			},
+		}
+	}
+	// expectTaintPatch expects a single patch replacing the node taints with the given keys
+	expectTaintPatch := func(t *testing.T, mockNode *MockNodeInterface, keptKeys ...string) {
+		t.Helper()
+		mockNode.EXPECT().
+			Patch(gomock.Any(), gomock.Eq(nodeName), gomock.Eq(k8stypes.JSONPatchType), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ string, _ k8stypes.PatchType, data []byte, _ metav1.PatchOptions, _ ...string) (*corev1.Node, error) {
+				var patch []struct {
+					OP    string         `json:"op"`
+					Value []corev1.Taint `json:"value"`
+				}
+				if err := json.Unmarshal(data, &patch); err != nil {
+					t.Fatalf("Failed to decode patch: %v", err)
+				}
+				var kept []string
+				for _, taint := range patch[len(patch)-1].Value {
+					kept = append(kept, taint.Key)
+				}
+				if !reflect.DeepEqual(kept, keptKeys) {
+					t.Errorf("unexpected taints kept: got %v, want %v", kept, keptKeys)
+				}
+				return nil, nil
+			}).
+			Times(1)
+	}
+
+	testCases := []struct {
+		name             string
+		startupTaintKeys []string
+		setup            func(t *testing.T, mockCtl *gomock.Controller) func() (kubernetes.Interface, error)
+		expResult        error
+		// expRetry is whether the removal is expected to be retried later without an error
+		expRetry bool
+		// expEvent is whether the driver ready event is expected to be recorded
+		expEvent bool
+	}{
+		{
+			name:             "custom taint keys removed along with the built-in taint in a single patch",
+			expEvent:         true,
+			startupTaintKeys: []string{AgentNotReadyNodeTaintKey, "company.io/ebs-not-ready", "company.io/absent"},
+			setup: func(t *testing.T, mockCtl *gomock.Controller) func() (kubernetes.Interface, error) {
+				t.Setenv("CSI_NODE_NAME", nodeName)
+				getNodeMock, mockNode := getNodeMock(mockCtl, nodeName, &corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: nodeName,
+					},
+					Spec: corev1.NodeSpec{
+						Taints: []corev1.Taint{
+							{Key: AgentNotReadyNodeTaintKey, Effect: corev1.TaintEffectNoExecute},
+							{Key: "company.io/ebs-not-ready", Effect: corev1.TaintEffectNoSchedule},
+							{Key: "company.io/unrelated", Effect: corev1.TaintEffectNoSchedule},
+						},
+					},
+				}, nil)
+
+				storageV1Mock := NewMockStorageV1Interface(mockCtl)
+				getNodeMock.(*MockKubernetesClient).EXPECT().StorageV1().Return(storageV1Mock).AnyTimes()
+				csiNodesMock := NewMockCSINodeInterface(mockCtl)
+				storageV1Mock.EXPECT().CSINodes().Return(csiNodesMock).Times(1)
+				csiNodesMock.EXPECT().Get(gomock.Any(), gomock.Eq(nodeName), gomock.Any()).Return(csiNodeWithAllocatable(), nil).Times(1)
+
+				expectTaintPatch(t, mockNode, "company.io/unrelated")
+
+				return func() (kubernetes.Interface, error) {
+					return getNodeMock, nil
+				}
+			},
+		},
+		{
+			name:             "custom taint key removed without built-in taint",
+			expEvent:         true,
+			startupTaintKeys: []string{AgentNotReadyNodeTaintKey, "company.io/ebs-not-ready"},
+			setup: func(t *testing.T, mockCtl *gomock.Controller) func() (kubernetes.Interface, error) {
+				t.Setenv("CSI_NODE_NAME", nodeName)
+				getNodeMock, mockNode := getNodeMock(mockCtl, nodeName, &corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: nodeName,
+					},
+					Spec: corev1.NodeSpec{
+						Taints: []corev1.Taint{
+							{Key: "company.io/ebs-not-ready", Effect: corev1.TaintEffectNoSchedule},
+						},
+					},
+				}, nil)
+
+				storageV1Mock := NewMockStorageV1Interface(mockCtl)
+				getNodeMock.(*MockKubernetesClient).EXPECT().StorageV1().Return(storageV1Mock).AnyTimes()
+				csiNodesMock := NewMockCSINodeInterface(mockCtl)
+				storageV1Mock.EXPECT().CSINodes().Return(csiNodesMock).Times(1)
+				csiNodesMock.EXPECT().Get(gomock.Any(), gomock.Eq(nodeName), gomock.Any()).Return(csiNodeWithAllocatable(), nil).Times(1)
+
+				expectTaintPatch(t, mockNode)
+
+				return func() (kubernetes.Interface, error) {
+					return getNodeMock, nil
+				}
+			},
+		},
+		{
+			name:             "multiple startup taint keys removed in a single patch",
+			expEvent:         true,
+			startupTaintKeys: []string{"company.io/ebs-not-ready", "company.io/storage-not-ready"},
+			setup: func(t *testing.T, mockCtl *gomock.Controller) func() (kubernetes.Interface, error) {
+				t.Setenv("CSI_NODE_NAME", nodeName)
+				getNodeMock, mockNode := getNodeMock(mockCtl, nodeName, &corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: nodeName,
+					},
+					Spec: corev1.NodeSpec{
+						Taints: []corev1.Taint{
+							{Key: "company.io/ebs-not-ready", Effect: corev1.TaintEffectNoSchedule},
+							{Key: "company.io/unrelated", Effect: corev1.TaintEffectNoSchedule},
+							{Key: "company.io/storage-not-ready", Effect: corev1.TaintEffectNoExecute},
+						},
+					},
+				}, nil)
+
+				storageV1Mock := NewMockStorageV1Interface(mockCtl)
+				getNodeMock.(*MockKubernetesClient).EXPECT().StorageV1().Return(storageV1Mock).AnyTimes()
+				csiNodesMock := NewMockCSINodeInterface(mockCtl)
+				storageV1Mock.EXPECT().CSINodes().Return(csiNodesMock).Times(1)
+				csiNodesMock.EXPECT().Get(gomock.Any(), gomock.Eq(nodeName), gomock.Any()).Return(csiNodeWithAllocatable(), nil).Times(1)
+
+				expectTaintPatch(t, mockNode, "company.io/unrelated")
+
+				return func() (kubernetes.Interface, error) {
+					return getNodeMock, nil
+				}
+			},
+		},
+		{
+			name:             "startup taint keys partially present",
+			expEvent:         true,
+			startupTaintKeys: []string{"company.io/ebs-not-ready", "company.io/storage-not-ready"},
+			setup: func(t *testing.T, mockCtl *gomock.Controller) func() (kubernetes.Interface, error) {
+				t.Setenv("CSI_NODE_NAME", nodeName)
+				getNodeMock, mockNode := getNodeMock(mockCtl, nodeName, &corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: nodeName,
+					},
+					Spec: corev1.NodeSpec{
+						Taints: []corev1.Taint{
+							{Key: "company.io/storage-not-ready", Effect: corev1.TaintEffectNoExecute},
+						},
+					},
+				}, nil)
+
+				storageV1Mock := NewMockStorageV1Interface(mockCtl)
+				getNodeMock.(*MockKubernetesClient).EXPECT().StorageV1().Return(storageV1Mock).AnyTimes()
+				csiNodesMock := NewMockCSINodeInterface(mockCtl)
+				storageV1Mock.EXPECT().CSINodes().Return(csiNodesMock).Times(1)
+				csiNodesMock.EXPECT().Get(gomock.Any(), gomock.Eq(nodeName), gomock.Any()).Return(csiNodeWithAllocatable(), nil).Times(1)
+
+				expectTaintPatch(t, mockNode)
+
+				return func() (kubernetes.Interface, error) {
+					return getNodeMock, nil
+				}
+			},
+		},
+		{
+			name:             "built-in taint kept when not a startup taint key",
+			expEvent:         true,
+			startupTaintKeys: []string{"company.io/ebs-not-ready", "company.io/storage-not-ready"},
+			setup: func(t *testing.T, mockCtl *gomock.Controller) func() (kubernetes.Interface, error) {
+				t.Setenv("CSI_NODE_NAME", nodeName)
+				getNodeMock, mockNode := getNodeMock(mockCtl, nodeName, &corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: nodeName,
+					},
+					Spec: corev1.NodeSpec{
+						Taints: []corev1.Taint{
+							{Key: AgentNotReadyNodeTaintKey, Effect: corev1.TaintEffectNoExecute},
+							{Key: "company.io/ebs-not-ready", Effect: corev1.TaintEffectNoSchedule},
+						},
+					},
+				}, nil)
+
+				storageV1Mock := NewMockStorageV1Interface(mockCtl)
+				getNodeMock.(*MockKubernetesClient).EXPECT().StorageV1().Return(storageV1Mock).AnyTimes()
+				csiNodesMock := NewMockCSINodeInterface(mockCtl)
+				storageV1Mock.EXPECT().CSINodes().Return(csiNodesMock).Times(1)
+				csiNodesMock.EXPECT().Get(gomock.Any(), gomock.Eq(nodeName), gomock.Any()).Return(csiNodeWithAllocatable(), nil).Times(1)
+
+				expectTaintPatch(t, mockNode, AgentNotReadyNodeTaintKey)
+
+				return func() (kubernetes.Interface, error) {
+					return getNodeMock, nil
+				}
+			},
+		},
+		{
+			name: "custom taint key not removed by default",
+			setup: func(t *testing.T, mockCtl *gomock.Controller) func() (kubernetes.Interface, error) {
+				t.Setenv("CSI_NODE_NAME", nodeName)
+				getNodeMock, _ := getNodeMock(mockCtl, nodeName, &corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: nodeName,
+					},
+					Spec: corev1.NodeSpec{
+						Taints: []corev1.Taint{
+							{Key: "company.io/ebs-not-ready", Effect: corev1.TaintEffectNoSchedule},
+						},
+					},
+				}, nil)
+
+				storageV1Mock := NewMockStorageV1Interface(mockCtl)
+				getNodeMock.(*MockKubernetesClient).EXPECT().StorageV1().Return(storageV1Mock).AnyTimes()
+				csiNodesMock := NewMockCSINodeInterface(mockCtl)
+				storageV1Mock.EXPECT().CSINodes().Return(csiNodesMock).Times(1)
+				csiNodesMock.EXPECT().Get(gomock.Any(), gomock.Eq(nodeName), gomock.Any()).Return(csiNodeWithAllocatable(), nil).Times(1)
+
+				return func() (kubernetes.Interface, error) {
+					return getNodeMock, nil
+				}
+			},
+		},
+		{
+			name: "failed to get node",
+			setup: func(t *testing.T, mockCtl *gomock.Controller) func() (kubernetes.Interface, error) {
+				t.Setenv("CSI_NODE_NAME", nodeName)
+				getNodeMock, _ := getNodeMock(mockCtl, nodeName, nil, fmt.Errorf("Failed to get node!"))
+
+				return func() (kubernetes.Interface, error) {
+					return getNodeMock, nil
+				}
+			},
+			expResult: fmt.Errorf("Failed to get node!"),
+		},
+		{
+			name: "no taints to remove",
+			setup: func(t *testing.T, mockCtl *gomock.Controller) func() (kubernetes.Interface, error) {
+				t.Setenv("CSI_NODE_NAME", nodeName)
+				getNodeMock, _ := getNodeMock(mockCtl, nodeName, &corev1.Node{}, nil)
+
+				storageV1Mock := NewMockStorageV1Interface(mockCtl)
 				getNodeMock.(*MockKubernetesClient).EXPECT().StorageV1().Return(storageV1Mock).AnyTimes()
 
 				csiNodesMock := NewMockCSINodeInterface(mockCtl)
@@ -2376,21 +5694,245 @@ func TestRemoveNotReadyTaint(t *testing.T) {
 				}
 
 				csiNodesMock.EXPECT().
-					Get(gomock.Any(), gomock.Eq("test-node-123"), gomock.Any()).
-					Return(mockCSINode, nil).
+					Get(gomock.Any(), gomock.Eq("test-node-123"), gomock.Any()).
+					Return(mockCSINode, nil).
+					Times(1)
+
+				return func() (kubernetes.Interface, error) {
+					return getNodeMock, nil
+				}
+			},
+			expResult: nil,
+		},
+		{
+			name: "failed to patch node",
+			setup: func(t *testing.T, mockCtl *gomock.Controller) func() (kubernetes.Interface, error) {
+				t.Setenv("CSI_NODE_NAME", nodeName)
+				getNodeMock, mockNode := getNodeMock(mockCtl, nodeName, &corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: nodeName,
+					},
+					Spec: corev1.NodeSpec{
+						Taints: []corev1.Taint{
+							{
+								Key:    AgentNotReadyNodeTaintKey,
+								Effect: corev1.TaintEffectNoExecute,
+							},
+						},
+					},
+				}, nil)
+
+				storageV1Mock := NewMockStorageV1Interface(mockCtl)
+				getNodeMock.(*MockKubernetesClient).EXPECT().StorageV1().Return(storageV1Mock).AnyTimes()
+
+				csiNodesMock := NewMockCSINodeInterface(mockCtl)
+				storageV1Mock.EXPECT().CSINodes().Return(csiNodesMock).Times(1)
+
+				count := int32(1)
+				mockCSINode := &v1.CSINode{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: nodeName,
+					},
+					Spec: v1.CSINodeSpec{
+						Drivers: []v1.CSINodeDriver{
+							{
+								Name:   DriverName,
+								NodeID: nodeName,
+								Allocatable: &v1.VolumeNodeResources{
+									Count: &count,
+								},
+							},
+						},
+					},
+				}
+
+				csiNodesMock.EXPECT().
+					Get(gomock.Any(), gomock.Eq(nodeName), gomock.Any()).
+					Return(mockCSINode, nil).
+					Times(1)
+
+				mockNode.EXPECT().
+					Patch(gomock.Any(), gomock.Eq(nodeName), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(nil, fmt.Errorf("Failed to patch node!")).
+					Times(1)
+
+				return func() (kubernetes.Interface, error) {
+					return getNodeMock, nil
+				}
+			},
+			expResult: fmt.Errorf("Failed to patch node!"),
+		},
+		{
+			name:     "success",
+			expEvent: true,
+			setup: func(t *testing.T, mockCtl *gomock.Controller) func() (kubernetes.Interface, error) {
+				t.Setenv("CSI_NODE_NAME", nodeName)
+				getNodeMock, mockNode := getNodeMock(mockCtl, nodeName, &corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: nodeName,
+					},
+					Spec: corev1.NodeSpec{
+						Taints: []corev1.Taint{
+							{
+								Key:    AgentNotReadyNodeTaintKey,
+								Effect: corev1.TaintEffectNoSchedule,
+							},
+						},
+					},
+				}, nil)
+
+				storageV1Mock := NewMockStorageV1Interface(mockCtl)
+				getNodeMock.(*MockKubernetesClient).EXPECT().StorageV1().Return(storageV1Mock).AnyTimes()
+
+				csiNodesMock := NewMockCSINodeInterface(mockCtl)
+				storageV1Mock.EXPECT().CSINodes().Return(csiNodesMock).Times(1)
+
+				count := int32(1)
+				mockCSINode := &v1.CSINode{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: nodeName,
+					},
+					Spec: v1.CSINodeSpec{
+						Drivers: []v1.CSINodeDriver{
+							{
+								Name:   DriverName,
+								NodeID: nodeName,
+								Allocatable: &v1.VolumeNodeResources{
+									Count: &count,
+								},
+							},
+						},
+					},
+				}
+
+				csiNodesMock.EXPECT().
+					Get(gomock.Any(), gomock.Eq(nodeName), gomock.Any()).
+					Return(mockCSINode, nil).
+					Times(1)
+
+				mockNode.EXPECT().
+					Patch(gomock.Any(), gomock.Eq(nodeName), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(nil, nil).
+					Times(1)
+
+				return func() (kubernetes.Interface, error) {
+					return getNodeMock, nil
+				}
+			},
+			expResult: nil,
+		},
+		{
+			name: "failed to get CSINode",
+			setup: func(t *testing.T, mockCtl *gomock.Controller) func() (kubernetes.Interface, error) {
+				t.Setenv("CSI_NODE_NAME", nodeName)
+				getNodeMock, _ := getNodeMock(mockCtl, nodeName, &corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: nodeName,
+					},
+					Spec: corev1.NodeSpec{
+						Taints: []corev1.Taint{
+							{
+								Key:    AgentNotReadyNodeTaintKey,
+								Effect: corev1.TaintEffectNoSchedule,
+							},
+						},
+					},
+				}, nil)
+
+				storageV1Mock := NewMockStorageV1Interface(mockCtl)
+				getNodeMock.(*MockKubernetesClient).EXPECT().StorageV1().Return(storageV1Mock).AnyTimes()
+
+				csiNodesMock := NewMockCSINodeInterface(mockCtl)
+				storageV1Mock.EXPECT().CSINodes().Return(csiNodesMock).Times(1)
+
+				csiNodesMock.EXPECT().
+					Get(gomock.Any(), gomock.Eq(nodeName), gomock.Any()).
+					Return(nil, fmt.Errorf("Failed to get CSINode")).
+					Times(1)
+
+				return func() (kubernetes.Interface, error) {
+					return getNodeMock, nil
+				}
+			},
+			expResult: fmt.Errorf("isAllocatableSet: failed to get CSINode for %s: Failed to get CSINode", nodeName),
+		},
+		{
+			name: "CSINode not found",
+			setup: func(t *testing.T, mockCtl *gomock.Controller) func() (kubernetes.Interface, error) {
+				t.Setenv("CSI_NODE_NAME", nodeName)
+				getNodeMock, _ := getNodeMock(mockCtl, nodeName, &corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: nodeName,
+					},
+					Spec: corev1.NodeSpec{
+						Taints: []corev1.Taint{
+							{
+								Key:    AgentNotReadyNodeTaintKey,
+								Effect: corev1.TaintEffectNoSchedule,
+							},
+						},
+					},
+				}, nil)
+
+				storageV1Mock := NewMockStorageV1Interface(mockCtl)
+				getNodeMock.(*MockKubernetesClient).EXPECT().StorageV1().Return(storageV1Mock).AnyTimes()
+
+				csiNodesMock := NewMockCSINodeInterface(mockCtl)
+				storageV1Mock.EXPECT().CSINodes().Return(csiNodesMock).Times(1)
+
+				// The node is not patched until the CSINode exists
+				csiNodesMock.EXPECT().
+					Get(gomock.Any(), gomock.Eq(nodeName), gomock.Any()).
+					Return(nil, apierrors.NewNotFound(v1.Resource("csinodes"), nodeName)).
+					Times(1)
+
+				return func() (kubernetes.Interface, error) {
+					return getNodeMock, nil
+				}
+			},
+			expResult: nil,
+			expRetry:  true,
+		},
+		{
+			name: "CSINode API error",
+			setup: func(t *testing.T, mockCtl *gomock.Controller) func() (kubernetes.Interface, error) {
+				t.Setenv("CSI_NODE_NAME", nodeName)
+				getNodeMock, _ := getNodeMock(mockCtl, nodeName, &corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: nodeName,
+					},
+					Spec: corev1.NodeSpec{
+						Taints: []corev1.Taint{
+							{
+								Key:    AgentNotReadyNodeTaintKey,
+								Effect: corev1.TaintEffectNoSchedule,
+							},
+						},
+					},
+				}, nil)
+
+				storageV1Mock := NewMockStorageV1Interface(mockCtl)
+				getNodeMock.(*MockKubernetesClient).EXPECT().StorageV1().Return(storageV1Mock).AnyTimes()
+
+				csiNodesMock := NewMockCSINodeInterface(mockCtl)
+				storageV1Mock.EXPECT().CSINodes().Return(csiNodesMock).Times(1)
+
+				csiNodesMock.EXPECT().
+					Get(gomock.Any(), gomock.Eq(nodeName), gomock.Any()).
+					Return(nil, apierrors.NewForbidden(v1.Resource("csinodes"), nodeName, errors.New("RBAC denied"))).
 					Times(1)
 
 				return func() (kubernetes.Interface, error) {
 					return getNodeMock, nil
 				}
 			},
-			expResult: nil,
+			expResult: fmt.Errorf("isAllocatableSet: failed to get CSINode for %s: csinodes.storage.k8s.io %q is forbidden: RBAC denied", nodeName, nodeName),
 		},
 		{
-			name: "failed to patch node",
+			name: "allocatable value not set for driver on node",
 			setup: func(t *testing.T, mockCtl *gomock.Controller) func() (kubernetes.Interface, error) {
 				t.Setenv("CSI_NODE_NAME", nodeName)
-				getNodeMock, mockNode := getNodeMock(mockCtl, nodeName, &corev1.Node{
+				getNodeMock, _ := getNodeMock(mockCtl, nodeName, &corev1.Node{
 					ObjectMeta: metav1.ObjectMeta{
 						Name: nodeName,
 					},
@@ -2398,7 +5940,7 @@ func TestRemoveNotReadyTaint(t *testing.T) {
 						Taints: []corev1.Taint{
 							{
 								Key:    AgentNotReadyNodeTaintKey,
-								Effect: corev1.TaintEffectNoExecute,
+								Effect: corev1.TaintEffectNoSchedule,
 							},
 						},
 					},
@@ -2410,7 +5952,6 @@ func TestRemoveNotReadyTaint(t *testing.T) {
 				csiNodesMock := NewMockCSINodeInterface(mockCtl)
 				storageV1Mock.EXPECT().CSINodes().Return(csiNodesMock).Times(1)
 
-				count := int32(1)
 				mockCSINode := &v1.CSINode{
 					ObjectMeta: metav1.ObjectMeta{
 						Name: nodeName,
@@ -2420,9 +5961,6 @@ func TestRemoveNotReadyTaint(t *testing.T) {
 							{
 								Name:   DriverName,
 								NodeID: nodeName,
-								Allocatable: &v1.VolumeNodeResources{
-									Count: &count,
-								},
 							},
 						},
 					},
@@ -2433,22 +5971,17 @@ func TestRemoveNotReadyTaint(t *testing.T) {
 					Return(mockCSINode, nil).
 					Times(1)
 
-				mockNode.EXPECT().
-					Patch(gomock.Any(), gomock.Eq(nodeName), gomock.Any(), gomock.Any(), gomock.Any()).
-					Return(nil, fmt.Errorf("Failed to patch node!")).
-					Times(1)
-
 				return func() (kubernetes.Interface, error) {
 					return getNodeMock, nil
 				}
 			},
-			expResult: fmt.Errorf("Failed to patch node!"),
+			expResult: fmt.Errorf("isAllocatableSet: allocatable value not set for driver on node %s", nodeName),
 		},
 		{
-			name: "success",
+			name: "driver not found on node",
 			setup: func(t *testing.T, mockCtl *gomock.Controller) func() (kubernetes.Interface, error) {
 				t.Setenv("CSI_NODE_NAME", nodeName)
-				getNodeMock, mockNode := getNodeMock(mockCtl, nodeName, &corev1.Node{
+				getNodeMock, _ := getNodeMock(mockCtl, nodeName, &corev1.Node{
 					ObjectMeta: metav1.ObjectMeta{
 						Name: nodeName,
 					},
@@ -2468,22 +6001,11 @@ func TestRemoveNotReadyTaint(t *testing.T) {
 				csiNodesMock := NewMockCSINodeInterface(mockCtl)
 				storageV1Mock.EXPECT().CSINodes().Return(csiNodesMock).Times(1)
 
-				count := int32(1)
 				mockCSINode := &v1.CSINode{
 					ObjectMeta: metav1.ObjectMeta{
 						Name: nodeName,
 					},
-					Spec: v1.CSINodeSpec{
-						Drivers: []v1.CSINodeDriver{
-							{
-								Name:   DriverName,
-								NodeID: nodeName,
-								Allocatable: &v1.VolumeNodeResources{
-									Count: &count,
-								},
-							},
-						},
-					},
+					Spec: v1.CSINodeSpec{},
 				}
 
 				csiNodesMock.EXPECT().
@@ -2491,205 +6013,806 @@ func TestRemoveNotReadyTaint(t *testing.T) {
 					Return(mockCSINode, nil).
 					Times(1)
 
-				mockNode.EXPECT().
-					Patch(gomock.Any(), gomock.Eq(nodeName), gomock.Any(), gomock.Any(), gomock.Any()).
-					Return(nil, nil).
-					Times(1)
-
 				return func() (kubernetes.Interface, error) {
 					return getNodeMock, nil
 				}
 			},
-			expResult: nil,
+			expResult: fmt.Errorf("isAllocatableSet: driver not found on node %s", nodeName),
 		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+
+			k8sClientGetter := tc.setup(t, mockCtl)
+			client, err := k8sClientGetter()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			recorder := record.NewFakeRecorder(10)
+			done, result := removeNotReadyTaint(client, recorder, tc.startupTaintKeys)
+			events := drainEvents(recorder)
+			if tc.expEvent && (len(events) != 1 || !strings.HasPrefix(events[0], corev1.EventTypeNormal+" "+DriverReadyEventReason+" ")) {
+				t.Fatalf("expected a driver ready event, got %v", events)
+			} else if !tc.expEvent && len(events) != 0 {
+				t.Fatalf("expected no events, got %v", events)
+			}
+
+			if (result == nil) != (tc.expResult == nil) {
+				t.Fatalf("expected %v, got %v", tc.expResult, result)
+			}
+			if result == nil && done == tc.expRetry {
+				t.Fatalf("expected done to be %v, got %v", !tc.expRetry, done)
+			}
+			if result != nil && tc.expResult != nil {
+				if result.Error() != tc.expResult.Error() {
+					t.Fatalf("Expected error message `%v`, got `%v`", tc.expResult.Error(), result.Error())
+				}
+			}
+		})
+	}
+}
+
+func TestRemoveTaintInBackground(t *testing.T) {
+	t.Run("Successful taint removal", func(t *testing.T) {
+		mockRemovalCount := 0
+		mockRemovalFunc := func(_ kubernetes.Interface) (bool, error) {
+			mockRemovalCount += 1
+			if mockRemovalCount == 3 {
+				return true, nil
+			} else {
+				return false, fmt.Errorf("Taint removal failed!")
+			}
+		}
+		removeTaintInBackground(nil, taintRemovalBackoff, mockRemovalFunc)
+		assert.Equal(t, 3, mockRemovalCount)
+	})
+
+	t.Run("Retried until ready", func(t *testing.T) {
+		mockRemovalCount := 0
+		mockRemovalFunc := func(_ kubernetes.Interface) (bool, error) {
+			mockRemovalCount += 1
+			return mockRemovalCount == 3, nil
+		}
+		removeTaintInBackground(nil, taintRemovalBackoff, mockRemovalFunc)
+		assert.Equal(t, 3, mockRemovalCount)
+	})
+
+	t.Run("Retries exhausted", func(t *testing.T) {
+		mockRemovalCount := 0
+		mockRemovalFunc := func(_ kubernetes.Interface) (bool, error) {
+			mockRemovalCount += 1
+			return false, fmt.Errorf("Taint removal failed!")
+		}
+		removeTaintInBackground(nil, wait.Backoff{
+			Steps:    5,
+			Duration: 1 * time.Millisecond,
+		}, mockRemovalFunc)
+		assert.Equal(t, 5, mockRemovalCount)
+	})
+}
+
+func getNodeMock(mockCtl *gomock.Controller, nodeName string, returnNode *corev1.Node, returnError error) (kubernetes.Interface, *MockNodeInterface) {
+	mockClient := NewMockKubernetesClient(mockCtl)
+	mockCoreV1 := NewMockCoreV1Interface(mockCtl)
+	mockNode := NewMockNodeInterface(mockCtl)
+
+	mockClient.EXPECT().CoreV1().Return(mockCoreV1).MinTimes(1)
+	mockCoreV1.EXPECT().Nodes().Return(mockNode).MinTimes(1)
+	mockNode.EXPECT().Get(gomock.Any(), gomock.Eq(nodeName), gomock.Any()).Return(returnNode, returnError).MinTimes(1)
+
+	return mockClient, mockNode
+}
+
+func TestNodeErrorDetails(t *testing.T) {
+	testCases := []struct {
+		name              string
+		call              func(d *NodeService) error
+		expectedCode      codes.Code
+		expectedReason    string
+		expectedOperation string
+	}{
 		{
-			name: "failed to get CSINode",
-			setup: func(t *testing.T, mockCtl *gomock.Controller) func() (kubernetes.Interface, error) {
-				t.Setenv("CSI_NODE_NAME", nodeName)
-				getNodeMock, _ := getNodeMock(mockCtl, nodeName, &corev1.Node{
-					ObjectMeta: metav1.ObjectMeta{
-						Name: nodeName,
-					},
-					Spec: corev1.NodeSpec{
-						Taints: []corev1.Taint{
-							{
-								Key:    AgentNotReadyNodeTaintKey,
-								Effect: corev1.TaintEffectNoSchedule,
-							},
-						},
+			name: "stage_operation_in_progress",
+			call: func(d *NodeService) error {
+				_, err := d.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+					VolumeId:          "vol-test",
+					StagingTargetPath: "/staging/path",
+					VolumeCapability:  &csi.VolumeCapability{AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}}, AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER}},
+					PublishContext:    map[string]string{DevicePathKey: "/dev/xvdba"},
+				})
+				return err
+			},
+			expectedCode:      codes.Aborted,
+			expectedReason:    ErrorReasonOperationInProgress,
+			expectedOperation: "NodeStageVolume",
+		},
+		{
+			name: "publish_operation_in_progress",
+			call: func(d *NodeService) error {
+				_, err := d.NodePublishVolume(context.Background(), &csi.NodePublishVolumeRequest{
+					VolumeId:          "vol-test",
+					StagingTargetPath: "/staging/path",
+					TargetPath:        "/target/path",
+					VolumeCapability:  &csi.VolumeCapability{AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}}, AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER}},
+				})
+				return err
+			},
+			expectedCode:      codes.Aborted,
+			expectedReason:    ErrorReasonOperationInProgress,
+			expectedOperation: "NodePublishVolume",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			driver := &NodeService{
+				inFlight: internal.NewInFlight(),
+				staged:   internal.NewStagingRegistry(),
+				options:  &Options{},
+				clock:    clock.RealClock{},
+			}
+			driver.inFlight.Insert("vol-test")
+
+			err := tc.call(driver)
+			st, ok := status.FromError(err)
+			if !ok {
+				t.Fatalf("Expected a gRPC status error, got %v", err)
+			}
+			if st.Code() != tc.expectedCode {
+				t.Fatalf("Expected code %v, got %v", tc.expectedCode, st.Code())
+			}
+			if st.Message() != fmt.Sprintf(VolumeOperationAlreadyExists, "vol-test") {
+				t.Fatalf("Unexpected message %q", st.Message())
+			}
+
+			details := st.Details()
+			if len(details) != 1 {
+				t.Fatalf("Expected 1 error detail, got %d", len(details))
+			}
+			info, ok := details[0].(*errdetails.ErrorInfo)
+			if !ok {
+				t.Fatalf("Expected ErrorInfo detail, got %T", details[0])
+			}
+			if info.GetReason() != tc.expectedReason || info.GetDomain() != DriverName {
+				t.Fatalf("Unexpected reason/domain %q/%q", info.GetReason(), info.GetDomain())
+			}
+			if info.GetMetadata()[ErrorInfoOperationKey] != tc.expectedOperation || info.GetMetadata()[ErrorInfoVolumeIDKey] != "vol-test" {
+				t.Fatalf("Unexpected metadata %v", info.GetMetadata())
+			}
+		})
+	}
+}
+
+// expectStatusErr compares gRPC status errors by code and message, ignoring any attached error details
+// fakeDeviceResolver is a DeviceResolver returning a fixed result and recording the requested device paths
+type fakeDeviceResolver struct {
+	source string
+	err    error
+	calls  []string
+}
+
+func (r *fakeDeviceResolver) FindDevicePath(devicePath, _, _, _ string) (string, error) {
+	r.calls = append(r.calls, devicePath)
+	return r.source, r.err
+}
+
+func TestNodeServiceDeviceResolver(t *testing.T) {
+	mountCapability := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{
+			Mount: &csi.VolumeCapability_MountVolume{FsType: "ext4"},
+		},
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		},
+	}
+	blockCapability := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Block{
+			Block: &csi.VolumeCapability_BlockVolume{},
+		},
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		},
+	}
+
+	testCases := []struct {
+		name               string
+		resolver           *fakeDeviceResolver
+		mounterMock        func(ctrl *gomock.Controller) *mounter.MockMounter
+		call               func(d *NodeService) error
+		expectedDevicePath string
+		expectedErr        error
+	}{
+		{
+			name:     "stage_uses_resolved_device",
+			resolver: &fakeDeviceResolver{source: "/dev/nvme1n1"},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().PathExists(gomock.Eq("/staging/path")).Return(true, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("", 1, nil)
+				m.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil)
+				m.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Eq("/dev/nvme1n1"), gomock.Eq("/staging/path"), gomock.Eq("ext4"), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				m.EXPECT().NeedResize(gomock.Eq("/dev/nvme1n1"), gomock.Eq("/staging/path")).Return(false, nil)
+				return m
+			},
+			call: func(d *NodeService) error {
+				_, err := d.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+					VolumeId:          "vol-test",
+					StagingTargetPath: "/staging/path",
+					VolumeCapability:  mountCapability,
+					PublishContext:    map[string]string{DevicePathKey: "/dev/xvdba"},
+				})
+				return err
+			},
+			expectedDevicePath: "/dev/xvdba",
+		},
+		{
+			name:     "stage_resolver_error",
+			resolver: &fakeDeviceResolver{err: errors.New("resolver failure")},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				return mounter.NewMockMounter(ctrl)
+			},
+			call: func(d *NodeService) error {
+				_, err := d.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+					VolumeId:          "vol-test",
+					StagingTargetPath: "/staging/path",
+					VolumeCapability:  mountCapability,
+					PublishContext:    map[string]string{DevicePathKey: "/dev/xvdba"},
+				})
+				return err
+			},
+			expectedDevicePath: "/dev/xvdba",
+			expectedErr:        status.Error(codes.Internal, "Failed to find device path /dev/xvdba. resolver failure"),
+		},
+		{
+			name:     "publish_block_uses_resolved_device",
+			resolver: &fakeDeviceResolver{source: "/dev/nvme1n1"},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().PathExists(gomock.Any()).Return(true, nil)
+				m.EXPECT().MakeFile(gomock.Eq("/target/path")).Return(nil)
+				m.EXPECT().IsLikelyNotMountPoint(gomock.Eq("/target/path")).Return(true, nil)
+				m.EXPECT().Mount(gomock.Eq("/dev/nvme1n1"), gomock.Eq("/target/path"), gomock.Any(), gomock.Any()).Return(nil)
+				return m
+			},
+			call: func(d *NodeService) error {
+				_, err := d.NodePublishVolume(context.Background(), &csi.NodePublishVolumeRequest{
+					VolumeId:          "vol-test",
+					StagingTargetPath: "/staging/path",
+					TargetPath:        "/target/path",
+					VolumeCapability:  blockCapability,
+					PublishContext:    map[string]string{DevicePathKey: "/dev/xvdba"},
+				})
+				return err
+			},
+			expectedDevicePath: "/dev/xvdba",
+		},
+		{
+			name:     "expand_uses_resolved_device",
+			resolver: &fakeDeviceResolver{source: "/dev/nvme1n1"},
+			mounterMock: func(ctrl *gomock.Controller) *mounter.MockMounter {
+				m := mounter.NewMockMounter(ctrl)
+				m.EXPECT().IsBlockDevice(gomock.Eq("/volume/path")).Return(false, nil)
+				m.EXPECT().GetDeviceNameFromMount(gomock.Eq("/volume/path")).Return("device-name", 1, nil)
+				m.EXPECT().IsDeviceMapper(gomock.Eq("device-name")).Return(false, nil)
+				m.EXPECT().GetPartition(gomock.Eq("device-name")).Return("", "", nil)
+				m.EXPECT().GrowPartition(gomock.Eq(""), gomock.Eq("")).Return(false, nil)
+				m.EXPECT().Resize(gomock.Eq("/dev/nvme1n1"), gomock.Eq("/volume/path")).Return(true, nil)
+				m.EXPECT().GetBlockSizeBytes(gomock.Eq("/dev/nvme1n1")).Return(int64(1000), nil)
+				return m
+			},
+			call: func(d *NodeService) error {
+				_, err := d.NodeExpandVolume(context.Background(), &csi.NodeExpandVolumeRequest{
+					VolumeId:   "vol-test",
+					VolumePath: "/volume/path",
+				})
+				return err
+			},
+			expectedDevicePath: "device-name",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockMetadata := metadata.NewMockMetadataService(ctrl)
+			mockMetadata.EXPECT().GetRegion().Return("us-west-2")
+
+			driver := &NodeService{
+				metadata:       mockMetadata,
+				mounter:        tc.mounterMock(ctrl),
+				deviceResolver: tc.resolver,
+				inFlight:       internal.NewInFlight(),
+				staged:         internal.NewStagingRegistry(),
+				options:        &Options{},
+				clock:          clock.RealClock{},
+			}
+
+			err := tc.call(driver)
+			expectStatusErr(t, tc.expectedErr, err)
+
+			if len(tc.resolver.calls) != 1 || tc.resolver.calls[0] != tc.expectedDevicePath {
+				t.Errorf("unexpected resolver calls: got %v, want [%s]", tc.resolver.calls, tc.expectedDevicePath)
+			}
+		})
+	}
+}
+
+type fakeFormatter struct {
+	err error
+	// block makes Format wait until its context is done, like a wedged mkfs
+	block bool
+	calls []fakeFormatterCall
+}
+
+type fakeFormatterCall struct {
+	source, target, fstype      string
+	mountOptions, formatOptions []string
+}
+
+func (f *fakeFormatter) Format(ctx context.Context, source, target, fstype string, mountOptions, formatOptions []string) error {
+	f.calls = append(f.calls, fakeFormatterCall{source, target, fstype, mountOptions, formatOptions})
+	if f.block {
+		<-ctx.Done()
+		return fmt.Errorf("mkfs failed: %w", ctx.Err())
+	}
+	return f.err
+}
+
+func TestNodeServiceFormatter(t *testing.T) {
+	testCases := []struct {
+		name          string
+		formatter     *fakeFormatter
+		formatTimeout time.Duration
+		expectedCode  codes.Code
+	}{
+		{
+			name:      "success",
+			formatter: &fakeFormatter{},
+		},
+		{
+			name:         "format_error",
+			formatter:    &fakeFormatter{err: errors.New("format failure")},
+			expectedCode: codes.Internal,
+		},
+		{
+			name:          "format_timeout",
+			formatter:     &fakeFormatter{block: true},
+			formatTimeout: 10 * time.Millisecond,
+			expectedCode:  codes.DeadlineExceeded,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockMetadata := metadata.NewMockMetadataService(ctrl)
+			mockMetadata.EXPECT().GetRegion().Return("us-west-2")
+
+			// The mounter must not format or mount the volume itself
+			mockMounter := mounter.NewMockMounter(ctrl)
+			mockMounter.EXPECT().PathExists(gomock.Eq("/staging/path")).Return(true, nil)
+			mockMounter.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("", 1, nil)
+			mockMounter.EXPECT().GetDiskFormat(gomock.Eq("/dev/nvme1n1")).Return("", nil)
+			if tc.expectedCode == codes.OK {
+				mockMounter.EXPECT().NeedResize(gomock.Eq("/dev/nvme1n1"), gomock.Eq("/staging/path")).Return(false, nil)
+			}
+
+			driver := &NodeService{
+				metadata:       mockMetadata,
+				mounter:        mockMounter,
+				deviceResolver: &fakeDeviceResolver{source: "/dev/nvme1n1"},
+				formatter:      tc.formatter,
+				inFlight:       internal.NewInFlight(),
+				staged:         internal.NewStagingRegistry(),
+				options:        &Options{FormatTimeout: tc.formatTimeout},
+				clock:          clock.RealClock{},
+			}
+
+			_, err := driver.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{FsType: "ext4", MountFlags: []string{"noatime"}},
 					},
-				}, nil)
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				PublishContext: map[string]string{DevicePathKey: "/dev/xvdba"},
+				VolumeContext:  map[string]string{BlockSizeKey: "4096"},
+			})
+			if code := status.Code(err); code != tc.expectedCode {
+				t.Fatalf("Expected code %v, got %v (%v)", tc.expectedCode, code, err)
+			}
 
-				storageV1Mock := NewMockStorageV1Interface(mockCtl)
-				getNodeMock.(*MockKubernetesClient).EXPECT().StorageV1().Return(storageV1Mock).AnyTimes()
+			expectedCall := fakeFormatterCall{
+				source:        "/dev/nvme1n1",
+				target:        "/staging/path",
+				fstype:        "ext4",
+				mountOptions:  []string{"noatime"},
+				formatOptions: []string{"-b", "4096"},
+			}
+			if len(tc.formatter.calls) != 1 || !reflect.DeepEqual(tc.formatter.calls[0], expectedCall) {
+				t.Errorf("Unexpected formatter calls: got %+v, want [%+v]", tc.formatter.calls, expectedCall)
+			}
+			if !driver.inFlight.Insert("vol-test") {
+				t.Errorf("Expected the in-flight entry of the volume to be released")
+			}
+		})
+	}
+}
 
-				csiNodesMock := NewMockCSINodeInterface(mockCtl)
-				storageV1Mock.EXPECT().CSINodes().Return(csiNodesMock).Times(1)
+// gatedFormatter blocks each Format until it is released, recording the formats running at once
+type gatedFormatter struct {
+	mux       sync.Mutex
+	running   int
+	maxActive int
+	started   chan string
+	release   chan struct{}
+}
 
-				csiNodesMock.EXPECT().
-					Get(gomock.Any(), gomock.Eq(nodeName), gomock.Any()).
-					Return(nil, fmt.Errorf("Failed to get CSINode")).
-					Times(1)
+func (f *gatedFormatter) Format(_ context.Context, _, target, _ string, _, _ []string) error {
+	f.mux.Lock()
+	f.running++
+	f.maxActive = max(f.maxActive, f.running)
+	f.mux.Unlock()
 
-				return func() (kubernetes.Interface, error) {
-					return getNodeMock, nil
-				}
-			},
-			expResult: fmt.Errorf("isAllocatableSet: failed to get CSINode for %s: Failed to get CSINode", nodeName),
-		},
-		{
-			name: "allocatable value not set for driver on node",
-			setup: func(t *testing.T, mockCtl *gomock.Controller) func() (kubernetes.Interface, error) {
-				t.Setenv("CSI_NODE_NAME", nodeName)
-				getNodeMock, _ := getNodeMock(mockCtl, nodeName, &corev1.Node{
-					ObjectMeta: metav1.ObjectMeta{
-						Name: nodeName,
-					},
-					Spec: corev1.NodeSpec{
-						Taints: []corev1.Taint{
-							{
-								Key:    AgentNotReadyNodeTaintKey,
-								Effect: corev1.TaintEffectNoSchedule,
-							},
-						},
-					},
-				}, nil)
+	f.started <- target
+	<-f.release
 
-				storageV1Mock := NewMockStorageV1Interface(mockCtl)
-				getNodeMock.(*MockKubernetesClient).EXPECT().StorageV1().Return(storageV1Mock).AnyTimes()
+	f.mux.Lock()
+	f.running--
+	f.mux.Unlock()
+	return nil
+}
 
-				csiNodesMock := NewMockCSINodeInterface(mockCtl)
-				storageV1Mock.EXPECT().CSINodes().Return(csiNodesMock).Times(1)
+func TestNodeStageVolumeMaxConcurrentFormat(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
 
-				mockCSINode := &v1.CSINode{
-					ObjectMeta: metav1.ObjectMeta{
-						Name: nodeName,
-					},
-					Spec: v1.CSINodeSpec{
-						Drivers: []v1.CSINodeDriver{
-							{
-								Name:   DriverName,
-								NodeID: nodeName,
-							},
-						},
-					},
-				}
+	mockMetadata := metadata.NewMockMetadataService(ctrl)
+	mockMetadata.EXPECT().GetRegion().Return("us-west-2").AnyTimes()
+	mockMounter := mounter.NewMockMounter(ctrl)
+	mockMounter.EXPECT().PathExists(gomock.Any()).Return(true, nil).AnyTimes()
+	mockMounter.EXPECT().GetDeviceNameFromMount(gomock.Any()).Return("", 1, nil).AnyTimes()
+	mockMounter.EXPECT().GetDiskFormat(gomock.Any()).Return("", nil).AnyTimes()
+	mockMounter.EXPECT().NeedResize(gomock.Any(), gomock.Any()).Return(false, nil).Times(2)
 
-				csiNodesMock.EXPECT().
-					Get(gomock.Any(), gomock.Eq(nodeName), gomock.Any()).
-					Return(mockCSINode, nil).
-					Times(1)
+	formatter := &gatedFormatter{started: make(chan string), release: make(chan struct{})}
+	options := &Options{MaxConcurrentFormat: 1}
+	driver := &NodeService{
+		metadata:        mockMetadata,
+		mounter:         mockMounter,
+		deviceResolver:  &fakeDeviceResolver{source: "/dev/nvme1n1"},
+		formatter:       formatter,
+		inFlight:        internal.NewInFlight(),
+		staged:          internal.NewStagingRegistry(),
+		options:         options,
+		clock:           clock.RealClock{},
+		formatSemaphore: semaphore.NewWeighted(options.MaxConcurrentFormat),
+	}
 
-				return func() (kubernetes.Interface, error) {
-					return getNodeMock, nil
-				}
+	stage := func(ctx context.Context, volumeID string) error {
+		_, err := driver.NodeStageVolume(ctx, &csi.NodeStageVolumeRequest{
+			VolumeId:          volumeID,
+			StagingTargetPath: "/staging/" + volumeID,
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{
+					Mount: &csi.VolumeCapability_MountVolume{FsType: "ext4"},
+				},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
 			},
-			expResult: fmt.Errorf("isAllocatableSet: allocatable value not set for driver on node %s", nodeName),
-		},
-		{
-			name: "driver not found on node",
-			setup: func(t *testing.T, mockCtl *gomock.Controller) func() (kubernetes.Interface, error) {
-				t.Setenv("CSI_NODE_NAME", nodeName)
-				getNodeMock, _ := getNodeMock(mockCtl, nodeName, &corev1.Node{
-					ObjectMeta: metav1.ObjectMeta{
-						Name: nodeName,
-					},
-					Spec: corev1.NodeSpec{
-						Taints: []corev1.Taint{
-							{
-								Key:    AgentNotReadyNodeTaintKey,
-								Effect: corev1.TaintEffectNoSchedule,
-							},
-						},
-					},
-				}, nil)
+			PublishContext: map[string]string{DevicePathKey: "/dev/xvdba"},
+		})
+		return err
+	}
 
-				storageV1Mock := NewMockStorageV1Interface(mockCtl)
-				getNodeMock.(*MockKubernetesClient).EXPECT().StorageV1().Return(storageV1Mock).AnyTimes()
+	errs := make(chan error, 2)
+	go func() { errs <- stage(context.Background(), "vol-1") }()
+	if target := <-formatter.started; target != "/staging/vol-1" {
+		t.Fatalf("Expected vol-1 to be formatted first, got %s", target)
+	}
+	go func() { errs <- stage(context.Background(), "vol-2") }()
 
-				csiNodesMock := NewMockCSINodeInterface(mockCtl)
-				storageV1Mock.EXPECT().CSINodes().Return(csiNodesMock).Times(1)
+	// A stage that cannot get a turn before its deadline is aborted
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := stage(ctx, "vol-3"); status.Code(err) != codes.Aborted {
+		t.Fatalf("Expected Aborted while the format of vol-1 is in progress, got %v", err)
+	}
 
-				mockCSINode := &v1.CSINode{
-					ObjectMeta: metav1.ObjectMeta{
-						Name: nodeName,
-					},
-					Spec: v1.CSINodeSpec{},
-				}
+	select {
+	case target := <-formatter.started:
+		t.Fatalf("Expected %s not to be formatted while the format of vol-1 is in progress", target)
+	default:
+	}
 
-				csiNodesMock.EXPECT().
-					Get(gomock.Any(), gomock.Eq(nodeName), gomock.Any()).
-					Return(mockCSINode, nil).
-					Times(1)
+	formatter.release <- struct{}{}
+	if target := <-formatter.started; target != "/staging/vol-2" {
+		t.Fatalf("Expected vol-2 to be formatted once vol-1 was, got %s", target)
+	}
+	formatter.release <- struct{}{}
 
-				return func() (kubernetes.Interface, error) {
-					return getNodeMock, nil
-				}
-			},
-			expResult: fmt.Errorf("isAllocatableSet: driver not found on node %s", nodeName),
+	for range 2 {
+		if err := <-errs; err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if formatter.maxActive != 1 {
+		t.Fatalf("Expected at most 1 format at once, got %d", formatter.maxActive)
+	}
+}
+
+func TestNodeStageVolumeFsTypeMismatch(t *testing.T) {
+	testCases := []struct {
+		name             string
+		fsType           string
+		existingFormat   string
+		formatErr        error
+		expectedErr      error
+		expectedMismatch bool
+	}{
+		{
+			name:           "blank device",
+			existingFormat: "",
+		},
+		{
+			name:           "ext3 filesystem staged as ext4",
+			fsType:         FSTypeExt4,
+			existingFormat: "ext3",
+		},
+		{
+			name:           "ext2 filesystem staged as ext4",
+			fsType:         FSTypeExt4,
+			existingFormat: "ext2",
 		},
+		{
+			name:           "matching filesystem",
+			existingFormat: "xfs",
+		},
+		{
+			name:      "unreadable format",
+			formatErr: errors.New("blkid failure"),
+		},
+		{
+			name:           "mismatched filesystem",
+			existingFormat: "ext4",
+			expectedErr: status.Error(codes.FailedPrecondition, "device /dev/nvme1n1 is already formatted as ext4 but fstype xfs was requested: "+
+				"set the fstype of the PersistentVolume to ext4 to keep its data, or recreate the volume to have it formatted with xfs"),
+			expectedMismatch: true,
+		},
+	}
+
+	recorder := metrics.InitializeRecorder()
+	mismatchCount := func() float64 {
+		families, err := recorder.Gatherer().Gather()
+		if err != nil {
+			t.Fatalf("failed to gather metrics: %v", err)
+		}
+		var count float64
+		for _, family := range families {
+			if family.GetName() != FsTypeMismatchMetric {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				count += metric.GetCounter().GetValue()
+			}
+		}
+		return count
 	}
+
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			mockCtl := gomock.NewController(t)
-			defer mockCtl.Finish()
+			fsType := tc.fsType
+			if fsType == "" {
+				fsType = FSTypeXfs
+			}
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
 
-			k8sClientGetter := tc.setup(t, mockCtl)
-			client, err := k8sClientGetter()
-			if err != nil {
-				t.Fatalf("Unexpected error: %v", err)
+			mockMetadata := metadata.NewMockMetadataService(ctrl)
+			mockMetadata.EXPECT().GetRegion().Return("us-west-2")
+
+			mockMounter := mounter.NewMockMounter(ctrl)
+			mockMounter.EXPECT().PathExists(gomock.Eq("/staging/path")).Return(true, nil)
+			mockMounter.EXPECT().GetDeviceNameFromMount(gomock.Eq("/staging/path")).Return("", 1, nil)
+			mockMounter.EXPECT().GetDiskFormat(gomock.Eq("/dev/nvme1n1")).Return(tc.existingFormat, tc.formatErr)
+			if tc.expectedErr == nil {
+				mockMounter.EXPECT().FormatAndMountSensitiveWithFormatOptions(gomock.Any(), gomock.Eq("/dev/nvme1n1"), gomock.Eq("/staging/path"), gomock.Eq(fsType), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				mockMounter.EXPECT().NeedResize(gomock.Eq("/dev/nvme1n1"), gomock.Eq("/staging/path")).Return(false, nil)
 			}
-			result := removeNotReadyTaint(client)
 
-			if (result == nil) != (tc.expResult == nil) {
-				t.Fatalf("expected %v, got %v", tc.expResult, result)
+			driver := &NodeService{
+				metadata:       mockMetadata,
+				mounter:        mockMounter,
+				deviceResolver: &fakeDeviceResolver{source: "/dev/nvme1n1"},
+				inFlight:       internal.NewInFlight(),
+				staged:         internal.NewStagingRegistry(),
+				options:        &Options{},
+				clock:          clock.RealClock{},
 			}
-			if result != nil && tc.expResult != nil {
-				if result.Error() != tc.expResult.Error() {
-					t.Fatalf("Expected error message `%v`, got `%v`", tc.expResult.Error(), result.Error())
-				}
+
+			before := mismatchCount()
+			_, err := driver.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+				VolumeId:          "vol-test",
+				StagingTargetPath: "/staging/path",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{FsType: fsType},
+					},
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+					},
+				},
+				PublishContext: map[string]string{DevicePathKey: "/dev/xvdba"},
+			})
+			expectStatusErr(t, tc.expectedErr, err)
+
+			if mismatched := mismatchCount() > before; mismatched != tc.expectedMismatch {
+				t.Errorf("unexpected %s increment: got %v, want %v", FsTypeMismatchMetric, mismatched, tc.expectedMismatch)
+			}
+			if _, staged := driver.staged.Get("vol-test"); staged != (tc.expectedErr == nil) {
+				t.Errorf("unexpected staged state: got %v", staged)
 			}
 		})
 	}
 }
 
-func TestRemoveTaintInBackground(t *testing.T) {
-	t.Run("Successful taint removal", func(t *testing.T) {
-		mockRemovalCount := 0
-		mockRemovalFunc := func(_ kubernetes.Interface) error {
-			mockRemovalCount += 1
-			if mockRemovalCount == 3 {
-				return nil
-			} else {
-				return fmt.Errorf("Taint removal failed!")
-			}
-		}
-		removeTaintInBackground(nil, taintRemovalBackoff, mockRemovalFunc)
-		assert.Equal(t, 3, mockRemovalCount)
+func TestNodeServiceDrain(t *testing.T) {
+	driver := &NodeService{
+		inFlight: internal.NewInFlight(),
+		staged:   internal.NewStagingRegistry(),
+		options:  &Options{},
+	}
+	// Simulate a NodeStageVolume in flight
+	if !driver.inFlight.Insert("vol-staging") {
+		t.Fatal("failed to insert in-flight operation")
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- driver.Drain(context.Background())
+	}()
+	for !driver.inFlight.Draining() {
+		time.Sleep(time.Millisecond)
+	}
+
+	_, err := driver.NodeStageVolume(context.Background(), &csi.NodeStageVolumeRequest{
+		VolumeId:          "vol-test",
+		StagingTargetPath: "/staging/path",
+		VolumeCapability: &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{FsType: "ext4"},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			},
+		},
+		PublishContext: map[string]string{DevicePathKey: "/dev/xvdba"},
+	})
+	if code := status.Code(err); code != codes.Unavailable {
+		t.Fatalf("Expected code %v while draining, got %v (%v)", codes.Unavailable, code, err)
+	}
+	_, err = driver.NodeUnpublishVolume(context.Background(), &csi.NodeUnpublishVolumeRequest{
+		VolumeId:   "vol-test",
+		TargetPath: "/target/path",
 	})
+	if code := status.Code(err); code != codes.Unavailable {
+		t.Fatalf("Expected code %v while draining, got %v (%v)", codes.Unavailable, code, err)
+	}
 
-	t.Run("Retries exhausted", func(t *testing.T) {
-		mockRemovalCount := 0
-		mockRemovalFunc := func(_ kubernetes.Interface) error {
-			mockRemovalCount += 1
-			return fmt.Errorf("Taint removal failed!")
+	select {
+	case err := <-done:
+		t.Fatalf("Expected Drain to wait for the in-flight operation, returned %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	driver.inFlight.Delete("vol-staging")
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Expected Drain to succeed, got %v", err)
 		}
-		removeTaintInBackground(nil, wait.Backoff{
-			Steps:    5,
-			Duration: 1 * time.Millisecond,
-		}, mockRemovalFunc)
-		assert.Equal(t, 5, mockRemovalCount)
-	})
+	case <-time.After(5 * time.Second):
+		t.Fatal("Drain did not return after the in-flight operation finished")
+	}
 }
 
-func getNodeMock(mockCtl *gomock.Controller, nodeName string, returnNode *corev1.Node, returnError error) (kubernetes.Interface, *MockNodeInterface) {
-	mockClient := NewMockKubernetesClient(mockCtl)
-	mockCoreV1 := NewMockCoreV1Interface(mockCtl)
-	mockNode := NewMockNodeInterface(mockCtl)
+func expectStatusErr(t *testing.T, expectedErr, err error) {
+	t.Helper()
+	if expectedErr == nil || err == nil {
+		if expectedErr != err {
+			t.Fatalf("Expected error '%v' but got '%v'", expectedErr, err)
+		}
+		return
+	}
+	expected, actual := status.Convert(expectedErr), status.Convert(err)
+	if expected.Code() != actual.Code() || expected.Message() != actual.Message() {
+		t.Fatalf("Expected error '%v' but got '%v'", expectedErr, err)
+	}
+}
 
-	mockClient.EXPECT().CoreV1().Return(mockCoreV1).MinTimes(1)
-	mockCoreV1.EXPECT().Nodes().Return(mockNode).MinTimes(1)
-	mockNode.EXPECT().Get(gomock.Any(), gomock.Eq(nodeName), gomock.Any()).Return(returnNode, returnError).MinTimes(1)
+func TestIsReady(t *testing.T) {
+	testCases := []struct {
+		name        string
+		instanceID  string
+		region      string
+		pathExists  bool
+		pathErr     error
+		expectCheck bool
+		expected    bool
+	}{
+		{
+			name:   "not ready before metadata is loaded",
+			region: "us-west-2",
+		},
+		{
+			name:       "not ready without region",
+			instanceID: "i-1234567890abcdef0",
+		},
+		{
+			name:        "not ready when mounter self-test fails",
+			instanceID:  "i-1234567890abcdef0",
+			region:      "us-west-2",
+			pathErr:     errors.New("permission denied"),
+			expectCheck: true,
+		},
+		{
+			name:        "not ready when known dir is missing",
+			instanceID:  "i-1234567890abcdef0",
+			region:      "us-west-2",
+			expectCheck: true,
+		},
+		{
+			name:        "ready after metadata is loaded",
+			instanceID:  "i-1234567890abcdef0",
+			region:      "us-west-2",
+			pathExists:  true,
+			expectCheck: true,
+			expected:    true,
+		},
+	}
 
-	return mockClient, mockNode
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockMetadata := metadata.NewMockMetadataService(ctrl)
+			mockMetadata.EXPECT().GetInstanceID().Return(tc.instanceID)
+			mockMetadata.EXPECT().GetRegion().Return(tc.region).AnyTimes()
+			mockMounter := mounter.NewMockMounter(ctrl)
+			if tc.expectCheck {
+				mockMounter.EXPECT().PathExists(gomock.Eq(readinessCheckPath)).Return(tc.pathExists, tc.pathErr)
+			}
+
+			driver := &NodeService{
+				metadata: mockMetadata,
+				mounter:  mockMounter,
+			}
+			if ready := driver.IsReady(); ready != tc.expected {
+				t.Fatalf("unexpected IsReady: got %t, want %t", ready, tc.expected)
+			}
+			// Once ready, the checks are not run again
+			if tc.expected && !driver.IsReady() {
+				t.Fatal("expected node service to stay ready")
+			}
+		})
+	}
+}
+
+func TestIsReadyWithoutMetadata(t *testing.T) {
+	driver := &NodeService{}
+	if driver.IsReady() {
+		t.Fatal("expected node service without metadata not to be ready")
+	}
 }
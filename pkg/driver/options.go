@@ -17,52 +17,129 @@ limitations under the License.
 package driver
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud/metadata"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/mounter"
 	flag "github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/util/validation"
 	cliflag "k8s.io/component-base/cli/flag"
+	"k8s.io/klog/v2"
 )
 
 // Options contains options and configuration settings for the driver.
 type Options struct {
-	Mode Mode
+	Mode Mode `yaml:"-"`
+	// ConfigFile is the path of a YAML file of options, keyed by flag name, that flags override
+	ConfigFile string `yaml:"-"`
 
 	// #### Server options ####
 
 	//Endpoint is the endpoint for the CSI driver server
-	Endpoint string
+	Endpoint string `yaml:"endpoint"`
 	// HttpEndpoint is the TCP network address where the HTTP server for metrics will listen
-	HttpEndpoint string
+	HttpEndpoint string `yaml:"http-endpoint"`
 	// MetricsCertFile is the location of the certificate for serving the metrics server over HTTPS
-	MetricsCertFile string
+	MetricsCertFile string `yaml:"metrics-cert-file"`
 	// MetricsKeyFile is the location of the key for serving the metrics server over HTTPS
-	MetricsKeyFile string
+	MetricsKeyFile string `yaml:"metrics-key-file"`
+	// MetricsShutdownTimeout is how long the metrics server waits for in-flight scrapes to finish when the driver stops
+	MetricsShutdownTimeout time.Duration `yaml:"metrics-shutdown-timeout"`
+	// ProbeTimeout is how long Probe waits for the health checks of the node service
+	ProbeTimeout time.Duration `yaml:"probe-timeout"`
+	// MetricsNamespace is an optional prefix prepended to the names of all metrics emitted by the driver
+	MetricsNamespace string `yaml:"metrics-namespace"`
 	// EnableOtelTracing is a flag to enable opentelemetry tracing for the driver
-	EnableOtelTracing bool
+	EnableOtelTracing bool `yaml:"enable-otel-tracing"`
+	// MetadataFile is the path of a JSON file describing the instance, read by the file metadata source
+	MetadataFile string `yaml:"metadata-file"`
+	// MetadataSources are the sources of instance metadata tried in order. When empty, only the file source is used if
+	// MetadataFile is set, and metadata.DefaultMetadataSources otherwise.
+	MetadataSources []string `yaml:"metadata-sources"`
 
 	// #### Controller options ####
 
 	// ExtraTags is a map of tags that will be attached to each dynamically provisioned
 	// resource.
-	ExtraTags map[string]string
+	ExtraTags map[string]string `yaml:"extra-tags"`
+	// ExtraTagsFile is the path of a JSON object of tags added to ExtraTags, reloaded whenever the file changes
+	ExtraTagsFile string `yaml:"extra-tags-file"`
+	// ExtraTagsHeadroom is the number of tags kept free for StorageClass and VolumeSnapshotClass tags when
+	// checking at startup that ExtraTags fit in a resource
+	ExtraTagsHeadroom int `yaml:"extra-tags-headroom"`
 	// ExtraVolumeTags is a map of tags that will be attached to each dynamically provisioned
 	// volume.
 	// DEPRECATED: Use ExtraTags instead.
-	ExtraVolumeTags map[string]string
+	ExtraVolumeTags map[string]string `yaml:"extra-volume-tags"`
 	// ID of the kubernetes cluster.
-	KubernetesClusterID string
+	KubernetesClusterID string `yaml:"k8s-tag-cluster-id"`
 	// flag to enable sdk debug log
-	AwsSdkDebugLog bool
+	AwsSdkDebugLog bool `yaml:"aws-sdk-debug-log"`
 	// flag to warn on invalid tag, instead of returning an error
-	WarnOnInvalidTag bool
+	WarnOnInvalidTag bool `yaml:"warn-on-invalid-tag"`
 	// flag to set user agent
-	UserAgentExtra string
+	UserAgentExtra string `yaml:"user-agent-extra"`
 	// flag to enable batching of API calls
-	Batching bool
+	Batching bool `yaml:"batching"`
+	// DescribeVolumeCacheTTL is how long the volumes described for read-only calls, such as ControllerGetVolume, are cached
+	DescribeVolumeCacheTTL time.Duration `yaml:"describe-volume-cache-ttl"`
 	// flag to set the timeout for volume modification requests to be coalesced into a single
 	// volume modification call to AWS.
-	ModifyVolumeRequestHandlerTimeout time.Duration
+	ModifyVolumeRequestHandlerTimeout time.Duration `yaml:"modify-volume-request-handler-timeout"`
+	// KmsKeyByVolumeType is a map of volume type to the KMS key used to encrypt volumes of that type
+	// when the StorageClass enables encryption without specifying a kmsKeyId.
+	KmsKeyByVolumeType map[string]string `yaml:"kms-key-by-volume-type"`
+	// RpcTimeouts is a map of controller RPC method name to the maximum time a call of that method may run,
+	// regardless of the deadline set by the caller.
+	RpcTimeouts map[string]time.Duration `yaml:"rpc-timeouts"`
+	// ExcludedZones is a list of Availability Zones new volumes are not created in when the topology requirement
+	// of the volume allows another zone
+	ExcludedZones []string `yaml:"excluded-zones"`
+
+	// ParameterDriftCheckInterval is the interval between checks of the type, IOPS and throughput of the volumes
+	// created by the driver against the values recorded in their tags. Disabled when 0.
+	ParameterDriftCheckInterval time.Duration `yaml:"parameter-drift-check-interval"`
+	// HealParameterDrift is how drift found by the parameter drift check is healed, either empty to only report it or
+	// HealParameterDriftTags to update the recorded tags. The volumes themselves are never modified.
+	HealParameterDrift string `yaml:"heal-parameter-drift"`
+	// VolumeStatusCheckInterval is the interval between checks of the volumes of the cluster for IO suspended by EBS,
+	// 0 disables the check
+	VolumeStatusCheckInterval time.Duration `yaml:"volume-status-check-interval"`
+	// AutoEnableVolumeIO enables IO on the volumes found with IO suspended by the volume status check
+	AutoEnableVolumeIO bool `yaml:"auto-enable-volume-io"`
+	// CreateVolumeFairQueueThreshold is the number of CreateVolume calls in flight above which new calls wait and are
+	// admitted round-robin across StorageClasses. Disabled when 0.
+	CreateVolumeFairQueueThreshold int `yaml:"create-volume-fair-queue-threshold"`
+	// CreateVolumeClassInFlight is the number of CreateVolume calls of a StorageClass in flight above which its waiting
+	// calls are skipped while calls of other classes wait. Unlimited when 0.
+	CreateVolumeClassInFlight int `yaml:"create-volume-class-inflight"`
+	// CapacityZoneQuotaGiB is the EBS storage in GiB the volumes of the cluster may use in each Availability Zone, all
+	// volume types combined, from which GetCapacity subtracts the storage of existing volumes. It is a budget of the
+	// driver, not an AWS quota, which applies to the region and to each volume type. GetCapacity is disabled when 0.
+	CapacityZoneQuotaGiB int64 `yaml:"capacity-zone-quota-gib"`
+	// CapacityCacheTTL is how long the storage used by the volumes of the cluster is cached for GetCapacity
+	CapacityCacheTTL time.Duration `yaml:"capacity-cache-ttl"`
+	// AttachAuditTags tags volumes with the namespace of their PVC and the node they are attached to when they are
+	// published, and with the time they are detached when they are unpublished
+	AttachAuditTags bool `yaml:"attach-audit-tags"`
+	// AttachAuditTagsInterval is the minimum time between two updates of the attach audit tags of a volume
+	AttachAuditTagsInterval time.Duration `yaml:"attach-audit-tags-interval"`
+	// EnableSnapshotOnDelete makes DeleteVolume snapshot the volumes tagged with SnapshotOnDeleteTag before deleting them
+	EnableSnapshotOnDelete bool `yaml:"enable-snapshot-on-delete"`
+	// AnnotatePVOnCreate annotates the PVs of the volumes created by CreateVolume with their creation time and settings
+	AnnotatePVOnCreate bool `yaml:"annotate-pv-on-create"`
 
 	// #### Node options #####
 
@@ -74,41 +151,237 @@ type Options struct {
 	// Specifying the volume attach limit via command line is the alternative until a more sophisticated solution presents
 	// itself (dynamically discovering the maximum number of attachable volume per EC2 machine type, see also
 	// https://github.com/kubernetes-sigs/aws-ebs-csi-driver/issues/347).
-	VolumeAttachLimit int64
+	VolumeAttachLimit int64 `yaml:"volume-attach-limit"`
 	// ReservedVolumeAttachments specifies number of volume attachments reserved for system use.
 	// Typically 1 for the root disk, but may be larger when more system disks are attached to nodes.
 	// This option is not used when --volume-attach-limit is specified.
-	// When -1, the amount of reserved attachments is loaded from instance metadata that captured state at node boot
+	// When -1, the EBS volumes attached to the instance outside of the driver are counted with the EC2 API if
+	// EnableVolumeAttachmentLookup is set, falling back to instance metadata that captured state at node boot
 	// and may include not only system disks but also CSI volumes (and therefore it may be wrong).
-	ReservedVolumeAttachments int
+	ReservedVolumeAttachments int `yaml:"reserved-volume-attachments"`
+	// MinVolumeAttachLimit is the lowest volume attach limit reported when it is computed from the instance type.
+	// It is not applied when VolumeAttachLimit is specified. Disabled when 0.
+	MinVolumeAttachLimit int64 `yaml:"min-volume-attach-limit"`
+	// MaxVolumeAttachLimit is the highest volume attach limit reported when it is computed from the instance type.
+	// It is not applied when VolumeAttachLimit is specified. Disabled when 0.
+	MaxVolumeAttachLimit int64 `yaml:"max-volume-attach-limit"`
 	// ALPHA: WindowsHostProcess indicates whether the driver is running in a Windows privileged container
-	WindowsHostProcess bool
+	WindowsHostProcess bool `yaml:"windows-host-process"`
+	// DeviceDiscoveryTimeout is how long NodeStageVolume keeps polling for the attached device to appear on the node.
+	// When zero, the device path lookup is retried DeviceDiscoveryRetries times instead.
+	DeviceDiscoveryTimeout time.Duration `yaml:"device-discovery-timeout"`
+	// DeviceDiscoveryPollInterval is the interval between device path lookups while waiting for the device to appear.
+	DeviceDiscoveryPollInterval time.Duration `yaml:"device-discovery-poll-interval"`
+	// DeviceDiscoveryRetries is how many more times NodeStageVolume looks up the device path when it is not found, to
+	// ride out transient failures while the device is not yet visible to the OS. Not used with DeviceDiscoveryTimeout.
+	DeviceDiscoveryRetries int `yaml:"device-discovery-retries"`
+	// DeviceDiscoveryInterval is the interval between device path lookup retries.
+	DeviceDiscoveryInterval time.Duration `yaml:"device-discovery-interval"`
+	// FormatTimeout is how long NodeStageVolume waits for the volume to be formatted and mounted before the format
+	// command is killed and the request fails with DeadlineExceeded. Disabled when 0.
+	FormatTimeout time.Duration `yaml:"format-timeout"`
+	// MaxConcurrentFormat is the maximum number of volumes NodeStageVolume formats and mounts at once. Unlimited when 0.
+	MaxConcurrentFormat int64 `yaml:"max-concurrent-format"`
+	// DrainTimeout is how long the driver waits for the node volume operations in flight to finish when it is
+	// terminated. New operations are rejected with Unavailable meanwhile.
+	DrainTimeout time.Duration `yaml:"drain-timeout"`
+	// DevicePathHintDir is the directory where the device path of each staged volume is recorded, so later lookups
+	// can skip scanning for the device. Hints are disabled when empty.
+	DevicePathHintDir string `yaml:"device-path-hint-dir"`
+	// EnableInstanceTypeLookup looks up instance types missing from the built-in volume limit tables using the
+	// EC2 DescribeInstanceTypes API when computing the volume attach limit
+	EnableInstanceTypeLookup bool `yaml:"enable-instance-type-lookup"`
+	// EnableVolumeAttachmentLookup counts the EBS volumes attached to the instance outside of the driver using the
+	// EC2 DescribeVolumes API when ReservedVolumeAttachments is not specified
+	EnableVolumeAttachmentLookup bool `yaml:"enable-volume-attachment-lookup"`
+	// SnapshotBeforeExpand takes an EBS snapshot of a volume before NodeExpandVolume grows its partition and filesystem
+	SnapshotBeforeExpand bool `yaml:"snapshot-before-expand"`
+	// DisableNodeExpansion stops advertising the EXPAND_VOLUME node capability and rejects NodeExpandVolume
+	DisableNodeExpansion bool `yaml:"disable-node-expansion"`
+	// ReconcileCSINodeAllocatable patches the allocatable count of the driver in the CSINode when it differs from the
+	// volume attach limit of the node
+	ReconcileCSINodeAllocatable bool `yaml:"reconcile-csinode-allocatable"`
+	// EnableInstanceTopology advertises the instance type as a topology segment in NodeGetInfo
+	EnableInstanceTopology bool `yaml:"enable-instance-topology"`
+	// TopologyLabelTags is a list of EC2 instance tag keys advertised as topology segments in NodeGetInfo
+	TopologyLabelTags []string `yaml:"topology-label-tags"`
+	// FailOnMetadataError fails NodeGetInfo, and so the registration of the node plugin, when the node's metadata is
+	// incomplete instead of logging a warning
+	FailOnMetadataError bool `yaml:"fail-on-metadata-error"`
+	// AuditLogFile is the path of the file to which the node RPCs on volumes are appended as JSON audit entries,
+	// disabled when empty
+	AuditLogFile string `yaml:"audit-log-file"`
+	// FormatDefaultsFile is the path of a YAML file of the default formatting options of each filesystem type, used
+	// for the options not set in the volume context of a volume
+	FormatDefaultsFile string `yaml:"format-defaults-file"`
+	// CSIMountPointPrefix is the path prefix the volume paths of NodeGetVolumeStats requests must start with, such as
+	// the kubelet root directory. Volume paths are not checked when empty.
+	CSIMountPointPrefix string `yaml:"csi-mount-point-prefix"`
+	// DiagnosticMountsDir is the node directory under which the staging path of each filesystem volume is bind mounted
+	// read-only for inspection, disabled when empty
+	DiagnosticMountsDir string `yaml:"diagnostic-mounts-dir"`
+	// CreateDeviceSymlinks creates a /dev/disk/by-id/ebs-<volume ID> symlink to the device of each staged volume
+	CreateDeviceSymlinks bool `yaml:"create-device-symlinks"`
+	// DefaultFsType is the filesystem type of volumes whose capability does not set one, ext4 when empty
+	DefaultFsType string `yaml:"default-fstype"`
+	// MountDirPermissions is the octal mode of the staging and target directories created by the node service,
+	// mounter.DefaultDirMode when empty
+	MountDirPermissions string `yaml:"mount-dir-permissions"`
+	// ChmodExistingMountDirs sets MountDirPermissions on target directories that already exist and are not mounted
+	ChmodExistingMountDirs bool `yaml:"chmod-existing-mount-dirs"`
+	// StartupTaintKeys is the list of node taint keys that mark the driver as not ready and are removed on startup
+	StartupTaintKeys []string `yaml:"startup-taint-keys"`
+	// RemoveTaintKeys is a list of additional node taint keys removed along with the startup taints, merged into
+	// StartupTaintKeys by Validate
+	// DEPRECATED: Use StartupTaintKeys instead.
+	RemoveTaintKeys []string `yaml:"remove-taint-keys"`
+	// WatchInterruptionNotices polls IMDS for a pending stop or termination of the instance and warns about the
+	// volumes still staged on the node when one is found
+	WatchInterruptionNotices bool `yaml:"watch-interruption-notices"`
+	// FlushOnInterruptionNotice flushes the filesystems of all staged volumes once an interruption notice is found
+	FlushOnInterruptionNotice bool `yaml:"flush-on-interruption-notice"`
+	// SpotInterruptionGrace polls IMDS for a pending stop or termination of the instance and rejects NodeStageVolume
+	// once the instance is due to be interrupted within it
+	SpotInterruptionGrace time.Duration `yaml:"spot-interruption-grace"`
+	// AllowTmpfsPublishTarget allows publishing volumes into target paths on tmpfs or ramfs filesystems
+	AllowTmpfsPublishTarget bool `yaml:"allow-tmpfs-publish-target"`
+	// Formatter replaces how NodeStageVolume formats and mounts volumes. It is not settable from the command line and
+	// is meant for programs embedding the driver. When nil, volumes are formatted and mounted by the node's Mounter.
+	Formatter mounter.Formatter `yaml:"-"`
+}
+
+// NewOptions returns the options of the driver running in mode, parsed from args with the flags added to f.
+// The options read from --config-file, if set in args, replace the defaults and are overridden by the flags in args.
+func NewOptions(mode Mode, f *flag.FlagSet, args []string) (*Options, error) {
+	o := &Options{Mode: mode}
+	o.AddFlags(f)
+
+	if path := configFileFromArgs(args); path != "" {
+		config, err := LoadConfig(path)
+		if err != nil {
+			return nil, err
+		}
+		// The flags are bound to the fields of o, so they are replaced in place
+		*o = *config
+		o.Mode = mode
+	}
+
+	if err := f.Parse(args); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// LoadConfig reads the YAML file of options at path. Options are keyed by flag name, and those missing from the file
+// have their flag's default value. Unknown keys are rejected. The mode of the driver is not read from the file.
+func LoadConfig(path string) (*Options, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	o := &Options{Mode: AllMode}
+	o.AddFlags(flag.NewFlagSet("config-file", flag.ContinueOnError))
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(o); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse config file %q: %w", path, err)
+	}
+	return o, nil
+}
+
+// configFileFromArgs returns the value of --config-file in args, which is needed before the other flags are parsed.
+func configFileFromArgs(args []string) string {
+	f := flag.NewFlagSet("config-file", flag.ContinueOnError)
+	f.ParseErrorsWhitelist.UnknownFlags = true
+	f.SetOutput(io.Discard)
+	path := f.String("config-file", "", "")
+	// Errors, such as a malformed flag, are reported when all flags are parsed
+	_ = f.Parse(args)
+	return *path
 }
 
 func (o *Options) AddFlags(f *flag.FlagSet) {
 	// Server options
+	f.StringVar(&o.ConfigFile, "config-file", "", "The path of a YAML file of options keyed by flag name, such as 'extra-tags: {key1: value1}' or 'format-timeout: 5m'. Flags override the options in the file. The default is empty string, which means the file is not used.")
 	f.StringVar(&o.Endpoint, "endpoint", DefaultCSIEndpoint, "Endpoint for the CSI driver server")
 	f.StringVar(&o.HttpEndpoint, "http-endpoint", "", "The TCP network address where the HTTP server for metrics will listen (example: `:8080`). The default is empty string, which means the server is disabled.")
 	f.StringVar(&o.MetricsCertFile, "metrics-cert-file", "", "The path to a certificate to use for serving the metrics server over HTTPS. If the certificate is signed by a certificate authority, this file should be the concatenation of the server's certificate, any intermediates, and the CA's certificate. If this is non-empty, --http-endpoint and --metrics-key-file MUST also be non-empty.")
 	f.StringVar(&o.MetricsKeyFile, "metrics-key-file", "", "The path to a key to use for serving the metrics server over HTTPS. If this is non-empty, --http-endpoint and --metrics-cert-file MUST also be non-empty.")
+	f.DurationVar(&o.MetricsShutdownTimeout, "metrics-shutdown-timeout", DefaultMetricsShutdownTimeout, "Maximum time the metrics server waits for in-flight requests to finish when the driver receives SIGTERM or SIGINT, after which it is closed.")
+	f.DurationVar(&o.ProbeTimeout, "probe-timeout", DefaultProbeTimeout, "Maximum time Probe waits for the health checks of the node service, which read the region from instance metadata and check that the mounter can access /proc/mounts. Probe fails with FailedPrecondition when they fail or time out. Set to 0 to wait for as long as the request deadline allows.")
+	f.StringVar(&o.MetricsNamespace, "metrics-namespace", "", "Optional namespace prepended to the names of all metrics emitted by the driver (example: `ebs_csi`). The default is empty string, which means metric names are not prefixed.")
 	f.BoolVar(&o.EnableOtelTracing, "enable-otel-tracing", false, "To enable opentelemetry tracing for the driver. The tracing is disabled by default. Configure the exporter endpoint with OTEL_EXPORTER_OTLP_ENDPOINT and other env variables, see https://opentelemetry.io/docs/specs/otel/configuration/sdk-environment-variables/#general-sdk-configuration.")
+	f.StringVar(&o.MetadataFile, "metadata-file", "", "The path of a JSON file describing the instance with instanceID, instanceType, region and availabilityZone fields, read by the file metadata source. When set without --metadata-sources, instance metadata is only read from the file. The default is empty string, which means the file is not used.")
+	f.StringSliceVar(&o.MetadataSources, "metadata-sources", nil, "Comma separated list of the sources of instance metadata, tried in order until one succeeds: imds, kubernetes or file. The file source reads --metadata-file. The default is imds,kubernetes, or file when --metadata-file is set.")
 
 	// Controller options
 	if o.Mode == AllMode || o.Mode == ControllerMode {
 		f.Var(cliflag.NewMapStringString(&o.ExtraTags), "extra-tags", "Extra tags to attach to each dynamically provisioned resource. It is a comma separated list of key value pairs like '<key1>=<value1>,<key2>=<value2>'")
+		f.StringVar(&o.ExtraTagsFile, "extra-tags-file", "", "The path of a JSON object of extra tags, such as '{\"team\": \"storage\"}', attached to each dynamically provisioned resource in addition to --extra-tags, which they override. The file is reloaded whenever it changes, such as when a mounted ConfigMap is updated, without restarting the driver. Invalid tags are rejected and the previous tags kept. The default is empty string, which means the file is not used.")
+		f.IntVar(&o.ExtraTagsHeadroom, "extra-tags-headroom", 0, "Number of tags kept free for StorageClass and VolumeSnapshotClass tags when checking at startup that --extra-tags and the tags added by the driver fit in the limit of 50 tags per resource.")
 		f.Var(cliflag.NewMapStringString(&o.ExtraVolumeTags), "extra-volume-tags", "DEPRECATED: Please use --extra-tags instead. Extra volume tags to attach to each dynamically provisioned volume. It is a comma separated list of key value pairs like '<key1>=<value1>,<key2>=<value2>'")
 		f.StringVar(&o.KubernetesClusterID, "k8s-tag-cluster-id", "", "ID of the Kubernetes cluster used for tagging provisioned EBS volumes (optional).")
 		f.BoolVar(&o.AwsSdkDebugLog, "aws-sdk-debug-log", false, "To enable the aws sdk debug log level (default to false).")
 		f.BoolVar(&o.WarnOnInvalidTag, "warn-on-invalid-tag", false, "To warn on invalid tags, instead of returning an error")
 		f.StringVar(&o.UserAgentExtra, "user-agent-extra", "", "Extra string appended to user agent.")
 		f.BoolVar(&o.Batching, "batching", false, "To enable batching of API calls. This is especially helpful for improving performance in workloads that are sensitive to EC2 rate limits.")
+		f.DurationVar(&o.DescribeVolumeCacheTTL, "describe-volume-cache-ttl", 0, "How long the volumes described with the EC2 DescribeVolumes API for ControllerGetVolume and ValidateVolumeCapabilities are cached. Attachment waiters and calls modifying volumes always describe them, and a volume is dropped from the cache when the driver modifies it. The default of 0 disables the cache.")
+		f.Var(cliflag.NewMapStringString(&o.KmsKeyByVolumeType), "kms-key-by-volume-type", "Default KMS key to encrypt volumes of a given type with when encryption is enabled but no kmsKeyId is specified. It is a comma separated list of volume type and KMS key pairs, where keys are key IDs, key ARNs, alias names or alias ARNs, like 'io2=arn:aws:kms:<region>:<account>:key/<id>,gp3=alias/<name>'")
+		f.Var(&mapStringDuration{m: &o.RpcTimeouts}, "rpc-timeouts", "Maximum time each controller RPC may run, regardless of the caller's deadline. It is a comma separated list of method name and duration pairs like 'CreateVolume=5m,ControllerPublishVolume=2m'")
+		f.StringSliceVar(&o.ExcludedZones, "excluded-zones", nil, "Comma separated list of Availability Zones to stop creating new volumes in, for example during a zonal incident. Volumes whose topology requirement allows only excluded zones fail to be created.")
+		f.DurationVar(&o.ParameterDriftCheckInterval, "parameter-drift-check-interval", 0, "Interval between checks of the type, IOPS and throughput of the volumes created by the driver against the values recorded in their tags when they were created or modified. Drift, such as a modification made in the EC2 console, is reported with a metric and a PVC event. The default of 0 disables the check and the tags.")
+		f.StringVar(&o.HealParameterDrift, "heal-parameter-drift", "", "How to heal drift found by --parameter-drift-check-interval. Set to 'tags' to update the recorded tags to match the volume. The volume itself is never modified. The default is empty string, which only reports drift.")
+		f.DurationVar(&o.VolumeStatusCheckInterval, "volume-status-check-interval", 0, "Interval between checks of the volumes of the cluster for IO suspended by EBS because their data is potentially inconsistent. Each volume found is reported once with a warning event on its PVC and the controller_volume_io_suspended_total metric. The default of 0 disables the check.")
+		f.BoolVar(&o.AutoEnableVolumeIO, "auto-enable-volume-io", false, "Enable IO on the volumes found with IO suspended by --volume-status-check-interval, after recording the warning event. Applications may then read or write inconsistent data. PersistentVolumes annotated with "+AutoEnableVolumeIOAnnotation+"=false opt out.")
+		f.IntVar(&o.CreateVolumeFairQueueThreshold, "create-volume-fair-queue-threshold", 0, "Number of CreateVolume calls in flight above which new calls wait and are admitted round-robin across StorageClasses, so that a StorageClass with many pending volumes cannot delay the volumes of other classes. The default of 0 disables queuing.")
+		f.IntVar(&o.CreateVolumeClassInFlight, "create-volume-class-inflight", 0, "Maximum number of CreateVolume calls of a single StorageClass in flight while calls are queued by --create-volume-fair-queue-threshold. The default of 0 does not limit classes.")
+		f.Int64Var(&o.CapacityZoneQuotaGiB, "capacity-zone-quota-gib", 0, "Approximate EBS storage budget in GiB for the volumes of the cluster in each Availability Zone, all volume types combined. This is not an AWS quota: EBS storage quotas apply to the whole region and to each volume type, and are not checked. When set, the GET_CAPACITY capability is advertised for storage capacity tracking, and GetCapacity reports this value minus the storage of the volumes of the cluster in the zone, whatever the type parameter of the StorageClass. The default of 0 disables GetCapacity.")
+		f.DurationVar(&o.CapacityCacheTTL, "capacity-cache-ttl", DefaultCapacityCacheTTL, "How long the storage of the volumes of the cluster, listed with the EC2 DescribeVolumes API, is cached for GetCapacity. Only used when --capacity-zone-quota-gib is set.")
+		f.BoolVar(&o.AttachAuditTags, "attach-audit-tags", false, "Tag volumes with the namespace of their PersistentVolumeClaim, the node they are attached to and the time when ControllerPublishVolume attaches them, and with the time when ControllerUnpublishVolume detaches them, so that their last consumer can be found from EC2 alone. The namespace and node are looked up from the VolumeAttachment, PersistentVolume and CSINode objects. Tagging failures are logged and do not fail the operation.")
+		f.DurationVar(&o.AttachAuditTagsInterval, "attach-audit-tags-interval", DefaultAttachAuditTagsInterval, "Minimum time between two updates of the --attach-audit-tags of a volume. Updates within the interval are skipped.")
+		f.BoolVar(&o.EnableSnapshotOnDelete, "enable-snapshot-on-delete", false, "Accept the snapshotOnDelete StorageClass parameter, and snapshot volumes tagged with ebs.csi.aws.com/snapshot-on-delete=true before DeleteVolume deletes them. The volume is only deleted once the snapshot is cut, failures are retried with the deletion. Each DeleteVolume call describes the volume to read its tags.")
+		f.BoolVar(&o.AnnotatePVOnCreate, "annotate-pv-on-create", false, "Annotate the PersistentVolumes of the volumes created by CreateVolume with the time the volume was created and the type, IOPS, throughput, encryption and Availability Zone EC2 created it with. The PersistentVolume is created by the external-provisioner after CreateVolume returns, so it is annotated in the background once it appears, and left unannotated if it does not appear within 10 minutes.")
 		f.DurationVar(&o.ModifyVolumeRequestHandlerTimeout, "modify-volume-request-handler-timeout", DefaultModifyVolumeRequestHandlerTimeout, "Timeout for the window in which volume modification calls must be received in order for them to coalesce into a single volume modification call to AWS. This must be lower than the csi-resizer and volumemodifier timeouts")
 	}
 	// Node options
 	if o.Mode == AllMode || o.Mode == NodeMode {
 		f.Int64Var(&o.VolumeAttachLimit, "volume-attach-limit", -1, "Value for the maximum number of volumes attachable per node. If specified, the limit applies to all nodes and overrides --reserved-volume-attachments. If not specified, the value is approximated from the instance type.")
-		f.IntVar(&o.ReservedVolumeAttachments, "reserved-volume-attachments", -1, "Number of volume attachments reserved for system use. Not used when --volume-attach-limit is specified. The total amount of volume attachments for a node is computed as: <nr. of attachments for corresponding instance type> - <number of NICs, if relevant to the instance type> - <reserved-volume-attachments value>. When -1, the amount of reserved attachments is loaded from instance metadata that captured state at node boot and may include not only system disks but also CSI volumes.")
+		f.IntVar(&o.ReservedVolumeAttachments, "reserved-volume-attachments", -1, "Number of volume attachments reserved for system use. Not used when --volume-attach-limit is specified. The total amount of volume attachments for a node is computed as: <nr. of attachments for corresponding instance type> - <number of NICs, if relevant to the instance type> - <reserved-volume-attachments value>. When -1, the EBS volumes attached to the instance outside of the driver are counted, see --enable-volume-attachment-lookup.")
+		f.Int64Var(&o.MinVolumeAttachLimit, "min-volume-attach-limit", 0, "Lower bound on the volume attach limit computed from the instance type. Not used when --volume-attach-limit is specified. The default of 0 disables the bound.")
+		f.Int64Var(&o.MaxVolumeAttachLimit, "max-volume-attach-limit", 0, "Upper bound on the volume attach limit computed from the instance type. Not used when --volume-attach-limit is specified. The default of 0 disables the bound.")
 		f.BoolVar(&o.WindowsHostProcess, "windows-host-process", false, "ALPHA: Indicates whether the driver is running in a Windows privileged container")
+		f.DurationVar(&o.DeviceDiscoveryTimeout, "device-discovery-timeout", 0, "Maximum time NodeStageVolume waits for the attached device to appear on the node. Waiting stops early when the request deadline is reached. Cannot be used with --device-discovery-retries or --device-discovery-interval. The default of 0 retries the lookup --device-discovery-retries times instead.")
+		f.DurationVar(&o.DeviceDiscoveryPollInterval, "device-discovery-poll-interval", DefaultDeviceDiscoveryPollInterval, "Interval between device lookups while waiting for the attached device to appear on the node. Only used when --device-discovery-timeout is non-zero.")
+		f.IntVar(&o.DeviceDiscoveryRetries, "device-discovery-retries", DefaultDeviceDiscoveryRetries, "Number of times NodeStageVolume retries the lookup of an attached device that is not yet visible on the node. Retries stop early when the request deadline is reached. Set to 0 to look up the device only once.")
+		f.DurationVar(&o.DeviceDiscoveryInterval, "device-discovery-interval", DefaultDeviceDiscoveryInterval, "Interval between device lookup retries.")
+		f.DurationVar(&o.FormatTimeout, "format-timeout", DefaultFormatTimeout, "Maximum time NodeStageVolume waits for a volume to be formatted and mounted. Once it has elapsed, the format command, such as a mkfs wedged on a degraded volume, is killed and NodeStageVolume fails with DeadlineExceeded. Set to 0 to wait for as long as the request deadline allows.")
+		f.Int64Var(&o.MaxConcurrentFormat, "max-concurrent-format", 0, "Maximum number of volumes NodeStageVolume formats and mounts at once, so that many pods scheduled to the node together do not run as many mkfs processes. Other NodeStageVolume calls wait for their turn, and fail with Aborted once their request deadline has elapsed. Validation and the checks of already staged volumes are not limited. The default of 0 means no limit.")
+		f.DurationVar(&o.DrainTimeout, "drain-timeout", DefaultDrainTimeout, "Maximum time the driver waits for the volume operations in flight, such as NodeStageVolume, to finish when it receives SIGTERM or SIGINT. New volume operations fail with Unavailable meanwhile. Should be lower than the terminationGracePeriodSeconds of the node pods.")
+		f.StringVar(&o.DevicePathHintDir, "device-path-hint-dir", "", "Node-local directory in which the device path of each staged volume is recorded to speed up later device lookups. Hints are only used while the device still reports the volume's serial. The default is empty string, which disables hints.")
+		f.BoolVar(&o.EnableInstanceTypeLookup, "enable-instance-type-lookup", true, "Look up instance types missing from the driver's built-in volume limit tables with the EC2 DescribeInstanceTypes API when computing the volume attach limit. Disable on nodes without EC2 API access.")
+		f.BoolVar(&o.EnableVolumeAttachmentLookup, "enable-volume-attachment-lookup", true, "Count the EBS volumes attached to the instance outside of the driver with the EC2 DescribeVolumes API when --reserved-volume-attachments is not specified. Volumes tagged by the driver or attached at /dev/xvd{a-z}{a-z} device names are not counted. When disabled or the lookup fails, block device mappings from instance metadata are counted instead.")
+		f.BoolVar(&o.SnapshotBeforeExpand, "snapshot-before-expand", false, "Take an EBS snapshot of a volume before NodeExpandVolume grows its partition and filesystem, as a backup should the expansion go wrong. NodeExpandVolume fails if the snapshot cannot be created. The snapshots are named after the volume and its new size, so that retried expansions reuse them, and are tagged ebs.csi.aws.com/created-by=pre-expand. They are not deleted by the driver. Requires the ec2:CreateSnapshot, ec2:CreateTags and ec2:DescribeSnapshots permissions on the node.")
+		f.BoolVar(&o.DisableNodeExpansion, "disable-node-expansion", false, "Do not advertise the EXPAND_VOLUME node capability, so that volumes are only expanded by the controller, and reject NodeExpandVolume with Unimplemented. Use on nodes whose volumes are never expanded on the node, such as read-only block devices.")
+		f.BoolVar(&o.ReconcileCSINodeAllocatable, "reconcile-csinode-allocatable", false, "At startup and whenever NodeGetInfo computes a different volume attach limit, patch the allocatable count of the driver in the CSINode of the node when it is stale, for example after --volume-attach-limit was changed and only the node plugin restarted. By default kubelet owns the CSINode and only updates it when the driver registers. Requires the patch permission on csinodes and the MutableCSINodeAllocatableCount feature gate of the API server (alpha in Kubernetes 1.33), which otherwise rejects the patch as an update of an immutable field.")
+		f.BoolVar(&o.EnableInstanceTopology, "enable-instance-topology", false, "Advertise the instance type as a topology segment in NodeGetInfo, which kubelet adds to the CSINode object and the labels of the node.")
+		f.StringSliceVar(&o.StartupTaintKeys, "startup-taint-keys", []string{AgentNotReadyNodeTaintKey}, "Comma separated list of node taint keys that mark the driver as not ready on the node. All of them are removed in a single patch once the driver is ready.")
+		f.StringSliceVar(&o.RemoveTaintKeys, "remove-taint-keys", nil, "DEPRECATED: Please use --startup-taint-keys instead. Comma separated list of node taint keys removed along with the keys of --startup-taint-keys once the driver is ready.")
+		f.BoolVar(&o.WatchInterruptionNotices, "watch-interruption-notices", false, "Poll instance metadata for a pending stop or termination of the instance. When one is found, the volumes still staged on the node are logged and a warning event is recorded on the node. Requires metadata to be retrieved from IMDS.")
+		f.BoolVar(&o.FlushOnInterruptionNotice, "flush-on-interruption-notice", false, "Flush the filesystems of all staged volumes once an interruption notice is found. Only used when --watch-interruption-notices is set.")
+		f.DurationVar(&o.SpotInterruptionGrace, "spot-interruption-grace", 0, "Poll instance metadata for a pending stop or termination of the instance, and reject NodeStageVolume with Unavailable once the instance is due to be interrupted within this duration. Spot interruption notices are issued two minutes ahead. 0 disables. Requires metadata to be retrieved from IMDS.")
+		f.BoolVar(&o.AllowTmpfsPublishTarget, "allow-tmpfs-publish-target", false, "Allow publishing volumes into target paths on tmpfs or ramfs filesystems. By default NodePublishVolume fails with FailedPrecondition when the parent of the target path is memory-backed, which indicates a misconfigured kubelet root directory.")
+		f.StringSliceVar(&o.TopologyLabelTags, "topology-label-tags", nil, "Comma separated list of EC2 instance tag keys advertised as topology segments (topology.ebs.csi.aws.com/tag-<key>) in NodeGetInfo. Requires access to tags in instance metadata to be enabled on the instance.")
+		f.StringVar(&o.DiagnosticMountsDir, "diagnostic-mounts-dir", "", "Absolute node directory, such as /var/lib/ebs-csi/diag, under which NodeStageVolume bind mounts the staging path of each filesystem volume read-only in a subdirectory named after the volume ID, so that it can be inspected by a sidecar. Diagnostic mounts are removed by NodeUnstageVolume, and leftovers when the driver starts. Not supported on Windows. The default is empty string, which disables diagnostic mounts.")
+		f.BoolVar(&o.CreateDeviceSymlinks, "create-device-symlinks", false, "Create a /dev/disk/by-id/ebs-<volume ID> symlink to the device of each filesystem volume staged by NodeStageVolume, for tooling that expects stable device names on AMIs without the EBS udev rules. The symlink is removed by NodeUnstageVolume. Failures to create or remove it are logged and do not fail the operation. Not supported on Windows.")
+		f.StringVar(&o.DefaultFsType, "default-fstype", "", "Filesystem type of the volumes whose capability does not set one, such as PVs without csi.storage.k8s.io/fstype. One of ext2, ext3, ext4, xfs or ntfs. The default is empty string, which means ext4.")
+		f.StringVar(&o.MountDirPermissions, "mount-dir-permissions", "", "Octal mode, such as 0750, of the staging and target directories created by NodeStageVolume and NodePublishVolume. Not used on Windows. The default is empty string, which means 0755 minus the umask.")
+		f.BoolVar(&o.ChmodExistingMountDirs, "chmod-existing-mount-dirs", false, "Also set --mount-dir-permissions on target directories that already exist, such as those created by the kubelet. Targets that are already mounted are left as is. Only used when --mount-dir-permissions is set.")
+		f.StringVar(&o.AuditLogFile, "audit-log-file", "", "The path of a node file to which each node RPC on a volume, such as NodePublishVolume, is appended as a JSON object with the time, operation, volume ID, node name, target path, request ID and outcome. The request ID is read from the x-request-id gRPC metadata. The default is empty string, which disables the audit log.")
+		f.StringVar(&o.FormatDefaultsFile, "format-defaults-file", "", "The path of a YAML file mapping filesystem types to their default blockSize, inodeSize and bytesPerInode formatting options, such as 'ext4: {blockSize: \"4096\", bytesPerInode: \"16384\"}'. NodeStageVolume uses them for the options not set in the volume context of a volume. The file is validated when the driver starts. The default is empty string, which means the file is not used.")
+		f.StringVar(&o.CSIMountPointPrefix, "csi-mount-point-prefix", "", "Absolute node path, such as /var/lib/kubelet, that the volume path of each NodeGetVolumeStats request must be under. Requests for other paths are rejected with InvalidArgument. The default is empty string, which accepts any volume path.")
+		f.BoolVar(&o.FailOnMetadataError, "fail-on-metadata-error", false, "Fail NodeGetInfo when the node's metadata is incomplete, for example when the CSI_NODE_NAME environment variable is not set, instead of logging a warning.")
 	}
 }
 
@@ -117,6 +390,161 @@ func (o *Options) Validate() error {
 		if o.VolumeAttachLimit != -1 && o.ReservedVolumeAttachments != -1 {
 			return fmt.Errorf("only one of --volume-attach-limit and --reserved-volume-attachments may be specified")
 		}
+		if o.MinVolumeAttachLimit < 0 || o.MaxVolumeAttachLimit < 0 {
+			return fmt.Errorf("--min-volume-attach-limit and --max-volume-attach-limit must not be negative")
+		}
+		if o.MinVolumeAttachLimit > 0 && o.MaxVolumeAttachLimit > 0 && o.MinVolumeAttachLimit > o.MaxVolumeAttachLimit {
+			return fmt.Errorf("--min-volume-attach-limit (%d) must not be greater than --max-volume-attach-limit (%d)", o.MinVolumeAttachLimit, o.MaxVolumeAttachLimit)
+		}
+		if o.DeviceDiscoveryTimeout < 0 {
+			return fmt.Errorf("--device-discovery-timeout must not be negative")
+		}
+		if o.DeviceDiscoveryTimeout > 0 && o.DeviceDiscoveryPollInterval <= 0 {
+			return fmt.Errorf("--device-discovery-poll-interval must be positive when --device-discovery-timeout is set")
+		}
+		if o.DeviceDiscoveryRetries < 0 {
+			return fmt.Errorf("--device-discovery-retries must not be negative")
+		}
+		if o.DeviceDiscoveryRetries > 0 && o.DeviceDiscoveryInterval <= 0 {
+			return fmt.Errorf("--device-discovery-interval must be positive when --device-discovery-retries is set")
+		}
+		// The retries are mapped onto the timeout, see deviceDiscoveryWait, so only one of them may be changed
+		if o.DeviceDiscoveryTimeout > 0 && (o.DeviceDiscoveryRetries != DefaultDeviceDiscoveryRetries || o.DeviceDiscoveryInterval != DefaultDeviceDiscoveryInterval) {
+			return fmt.Errorf("--device-discovery-retries and --device-discovery-interval cannot be used with --device-discovery-timeout")
+		}
+		if o.DrainTimeout < 0 {
+			return fmt.Errorf("--drain-timeout must not be negative")
+		}
+		if o.FormatTimeout < 0 {
+			return fmt.Errorf("--format-timeout must not be negative")
+		}
+		if o.MaxConcurrentFormat < 0 {
+			return fmt.Errorf("--max-concurrent-format must not be negative")
+		}
+		for _, key := range o.StartupTaintKeys {
+			if key == "" {
+				return fmt.Errorf("--startup-taint-keys must not contain empty keys")
+			}
+			if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+				return fmt.Errorf("--startup-taint-keys contains invalid taint key %q: %s", key, strings.Join(errs, "; "))
+			}
+		}
+		for _, key := range o.RemoveTaintKeys {
+			if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+				return fmt.Errorf("--remove-taint-keys contains invalid taint key %q: %s", key, strings.Join(errs, "; "))
+			}
+		}
+		if len(o.RemoveTaintKeys) > 0 {
+			klog.InfoS("--remove-taint-keys is deprecated, add its keys to --startup-taint-keys instead", "keys", o.RemoveTaintKeys)
+			if len(o.StartupTaintKeys) == 0 {
+				o.StartupTaintKeys = []string{AgentNotReadyNodeTaintKey}
+			}
+			o.StartupTaintKeys = append(o.StartupTaintKeys, o.RemoveTaintKeys...)
+			o.RemoveTaintKeys = nil
+		}
+		if o.DiagnosticMountsDir != "" && runtime.GOOS == "windows" {
+			return fmt.Errorf("--diagnostic-mounts-dir is not supported on Windows")
+		}
+		if o.DiagnosticMountsDir != "" && !filepath.IsAbs(o.DiagnosticMountsDir) {
+			return fmt.Errorf("--diagnostic-mounts-dir must be an absolute path, got %q", o.DiagnosticMountsDir)
+		}
+		if o.CSIMountPointPrefix != "" && !filepath.IsAbs(o.CSIMountPointPrefix) {
+			return fmt.Errorf("--csi-mount-point-prefix must be an absolute path, got %q", o.CSIMountPointPrefix)
+		}
+		if o.CreateDeviceSymlinks && runtime.GOOS == "windows" {
+			return fmt.Errorf("--create-device-symlinks is not supported on Windows")
+		}
+		if _, ok := ValidFSTypes[o.DefaultFsType]; o.DefaultFsType != "" && !ok {
+			return fmt.Errorf("--default-fstype must be one of ext2, ext3, ext4, xfs or ntfs, got %q", o.DefaultFsType)
+		}
+		if _, err := o.MountDirMode(); err != nil {
+			return err
+		}
+		if o.ChmodExistingMountDirs && o.MountDirPermissions == "" {
+			return fmt.Errorf("--chmod-existing-mount-dirs requires --mount-dir-permissions")
+		}
+		if o.FlushOnInterruptionNotice && !o.WatchInterruptionNotices {
+			return fmt.Errorf("--flush-on-interruption-notice requires --watch-interruption-notices")
+		}
+		if o.SpotInterruptionGrace < 0 {
+			return fmt.Errorf("--spot-interruption-grace must not be negative")
+		}
+		for _, key := range o.TopologyLabelTags {
+			if errs := validation.IsQualifiedName(InstanceTagTopologyKeyPrefix + key); len(errs) > 0 {
+				return fmt.Errorf("--topology-label-tags contains tag key %q that cannot be used in a topology label: %s", key, strings.Join(errs, "; "))
+			}
+		}
+		// Instance tags and interruption notices are only served by IMDS, which is never tried before the file
+		fileFirst := o.MetadataFile != "" && (len(o.MetadataSources) == 0 || o.MetadataSources[0] == metadata.SourceFile)
+		if fileFirst && (o.WatchInterruptionNotices || o.SpotInterruptionGrace > 0 || len(o.TopologyLabelTags) > 0) {
+			return fmt.Errorf("--watch-interruption-notices, --spot-interruption-grace and --topology-label-tags require metadata from IMDS and cannot be used when metadata is read from --metadata-file first")
+		}
+	}
+
+	if o.Mode == AllMode || o.Mode == ControllerMode {
+		if o.ExtraTagsHeadroom < 0 {
+			return fmt.Errorf("--extra-tags-headroom must not be negative")
+		}
+		if o.ParameterDriftCheckInterval < 0 {
+			return fmt.Errorf("--parameter-drift-check-interval must not be negative")
+		}
+		if o.HealParameterDrift != "" && o.HealParameterDrift != HealParameterDriftTags {
+			return fmt.Errorf("--heal-parameter-drift must be empty or %q, got %q", HealParameterDriftTags, o.HealParameterDrift)
+		}
+		if o.HealParameterDrift != "" && o.ParameterDriftCheckInterval == 0 {
+			return fmt.Errorf("--heal-parameter-drift requires --parameter-drift-check-interval")
+		}
+		if o.VolumeStatusCheckInterval < 0 {
+			return fmt.Errorf("--volume-status-check-interval must not be negative")
+		}
+		if o.AutoEnableVolumeIO && o.VolumeStatusCheckInterval == 0 {
+			return fmt.Errorf("--auto-enable-volume-io requires --volume-status-check-interval")
+		}
+		if o.CreateVolumeFairQueueThreshold < 0 {
+			return fmt.Errorf("--create-volume-fair-queue-threshold must not be negative")
+		}
+		if o.CreateVolumeClassInFlight < 0 {
+			return fmt.Errorf("--create-volume-class-inflight must not be negative")
+		}
+		if o.CreateVolumeClassInFlight > 0 && o.CreateVolumeFairQueueThreshold == 0 {
+			return fmt.Errorf("--create-volume-class-inflight requires --create-volume-fair-queue-threshold")
+		}
+		if o.CapacityZoneQuotaGiB < 0 {
+			return fmt.Errorf("--capacity-zone-quota-gib must not be negative")
+		}
+		if o.CapacityCacheTTL < 0 {
+			return fmt.Errorf("--capacity-cache-ttl must not be negative")
+		}
+		if o.DescribeVolumeCacheTTL < 0 {
+			return fmt.Errorf("--describe-volume-cache-ttl must not be negative")
+		}
+		if o.AttachAuditTagsInterval < 0 {
+			return fmt.Errorf("--attach-audit-tags-interval must not be negative")
+		}
+		for method, timeout := range o.RpcTimeouts {
+			if !controllerMethods.Has(method) {
+				return fmt.Errorf("--rpc-timeouts contains unknown controller method %q", method)
+			}
+			if timeout <= 0 {
+				return fmt.Errorf("--rpc-timeouts must be positive, got %v for %s", timeout, method)
+			}
+		}
+	}
+
+	if o.MetricsShutdownTimeout < 0 {
+		return fmt.Errorf("--metrics-shutdown-timeout must not be negative")
+	}
+	if o.ProbeTimeout < 0 {
+		return fmt.Errorf("--probe-timeout must not be negative")
+	}
+
+	for _, source := range o.MetadataSources {
+		if !slices.Contains(metadata.ValidMetadataSources, source) {
+			return fmt.Errorf("--metadata-sources contains unknown source %q, must be one of %s", source, strings.Join(metadata.ValidMetadataSources, ", "))
+		}
+	}
+	if len(o.MetadataSources) > 0 && slices.Contains(o.MetadataSources, metadata.SourceFile) != (o.MetadataFile != "") {
+		return fmt.Errorf("--metadata-file must be set if and only if --metadata-sources contains %s", metadata.SourceFile)
 	}
 
 	if o.MetricsCertFile != "" || o.MetricsKeyFile != "" {
@@ -131,3 +559,66 @@ func (o *Options) Validate() error {
 
 	return nil
 }
+
+// MountDirMode parses MountDirPermissions, 0 is returned when it is empty.
+func (o *Options) MountDirMode() (os.FileMode, error) {
+	if o.MountDirPermissions == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(o.MountDirPermissions, 8, 32)
+	if err != nil || mode == 0 || mode > 0777 {
+		return 0, fmt.Errorf("--mount-dir-permissions must be an octal mode between 0001 and 0777, got %q", o.MountDirPermissions)
+	}
+	return os.FileMode(mode), nil
+}
+
+// deviceDiscoveryWait returns how long NodeStageVolume waits for the attached device to appear and the interval between
+// its lookups. DeviceDiscoveryRetries retries are a wait of as many intervals when DeviceDiscoveryTimeout is not set.
+func (o *Options) deviceDiscoveryWait() (time.Duration, time.Duration) {
+	if o.DeviceDiscoveryTimeout > 0 {
+		return o.DeviceDiscoveryTimeout, o.DeviceDiscoveryPollInterval
+	}
+	return time.Duration(o.DeviceDiscoveryRetries) * o.DeviceDiscoveryInterval, o.DeviceDiscoveryInterval
+}
+
+// mapStringDuration is a flag value parsing a comma separated list of key and duration pairs like 'key1=1m,key2=30s'
+type mapStringDuration struct {
+	m *map[string]time.Duration
+}
+
+func (v *mapStringDuration) String() string {
+	if v.m == nil || *v.m == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*v.m))
+	for key, d := range *v.m {
+		pairs = append(pairs, key+"="+d.String())
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (v *mapStringDuration) Set(value string) error {
+	if *v.m == nil {
+		*v.m = make(map[string]time.Duration)
+	}
+	for _, pair := range strings.Split(value, ",") {
+		if pair == "" {
+			continue
+		}
+		key, raw, found := strings.Cut(pair, "=")
+		if !found {
+			return fmt.Errorf("malformed pair, expect string=duration: %q", pair)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("invalid duration for %q: %w", key, err)
+		}
+		(*v.m)[strings.TrimSpace(key)] = d
+	}
+	return nil
+}
+
+func (v *mapStringDuration) Type() string {
+	return "mapStringDuration"
+}
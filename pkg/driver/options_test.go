@@ -15,6 +15,10 @@
 package driver
 
 import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -28,6 +32,12 @@ func TestAddFlags(t *testing.T) {
 	f := flag.NewFlagSet("test", flag.ExitOnError)
 	o.AddFlags(f)
 
+	if err := f.Set("audit-log-file", "/var/log/ebs-csi/audit.log"); err != nil {
+		t.Errorf("error setting audit-log-file: %v", err)
+	}
+	if err := f.Set("format-defaults-file", "/etc/ebs-csi/format-defaults.yaml"); err != nil {
+		t.Errorf("error setting format-defaults-file: %v", err)
+	}
 	if err := f.Set("endpoint", "custom-endpoint"); err != nil {
 		t.Errorf("error setting endpoint: %v", err)
 	}
@@ -40,12 +50,33 @@ func TestAddFlags(t *testing.T) {
 	if err := f.Set("metrics-key-file", "/https.key"); err != nil {
 		t.Errorf("error setting metrics-key-file: %v", err)
 	}
+	if err := f.Set("metrics-namespace", "ebs_csi"); err != nil {
+		t.Errorf("error setting metrics-namespace: %v", err)
+	}
+	if err := f.Set("metrics-shutdown-timeout", "10s"); err != nil {
+		t.Errorf("error setting metrics-shutdown-timeout: %v", err)
+	}
+	if err := f.Set("probe-timeout", "5s"); err != nil {
+		t.Errorf("error setting probe-timeout: %v", err)
+	}
 	if err := f.Set("enable-otel-tracing", "true"); err != nil {
 		t.Errorf("error setting enable-otel-tracing: %v", err)
 	}
+	if err := f.Set("metadata-file", "/etc/ebs/metadata.json"); err != nil {
+		t.Errorf("error setting metadata-file: %v", err)
+	}
+	if err := f.Set("metadata-sources", "imds,file"); err != nil {
+		t.Errorf("error setting metadata-sources: %v", err)
+	}
 	if err := f.Set("extra-tags", "key1=value1,key2=value2"); err != nil {
 		t.Errorf("error setting extra-tags: %v", err)
 	}
+	if err := f.Set("extra-tags-file", "/etc/ebs/extra-tags.json"); err != nil {
+		t.Errorf("error setting extra-tags-file: %v", err)
+	}
+	if err := f.Set("extra-tags-headroom", "5"); err != nil {
+		t.Errorf("error setting extra-tags-headroom: %v", err)
+	}
 	if err := f.Set("k8s-tag-cluster-id", "cluster-123"); err != nil {
 		t.Errorf("error setting k8s-tag-cluster-id: %v", err)
 	}
@@ -61,6 +92,18 @@ func TestAddFlags(t *testing.T) {
 	if err := f.Set("batching", "true"); err != nil {
 		t.Errorf("error setting batching: %v", err)
 	}
+	if err := f.Set("describe-volume-cache-ttl", "10s"); err != nil {
+		t.Errorf("error setting describe-volume-cache-ttl: %v", err)
+	}
+	if err := f.Set("kms-key-by-volume-type", "io2=arn:aws:kms:us-east-1:012345678910:key/abcd,gp3=alias/dev"); err != nil {
+		t.Errorf("error setting kms-key-by-volume-type: %v", err)
+	}
+	if err := f.Set("rpc-timeouts", "CreateVolume=5m,ControllerPublishVolume=2m"); err != nil {
+		t.Errorf("error setting rpc-timeouts: %v", err)
+	}
+	if err := f.Set("excluded-zones", "us-east-1c,us-east-1d"); err != nil {
+		t.Errorf("error setting excluded-zones: %v", err)
+	}
 	if err := f.Set("modify-volume-request-handler-timeout", "1m"); err != nil {
 		t.Errorf("error setting modify-volume-request-handler-timeout: %v", err)
 	}
@@ -70,6 +113,102 @@ func TestAddFlags(t *testing.T) {
 	if err := f.Set("reserved-volume-attachments", "5"); err != nil {
 		t.Errorf("error setting reserved-volume-attachments: %v", err)
 	}
+	if err := f.Set("device-discovery-timeout", "30s"); err != nil {
+		t.Errorf("error setting device-discovery-timeout: %v", err)
+	}
+	if err := f.Set("format-timeout", "30m"); err != nil {
+		t.Errorf("error setting format-timeout: %v", err)
+	}
+	if err := f.Set("max-concurrent-format", "2"); err != nil {
+		t.Errorf("error setting max-concurrent-format: %v", err)
+	}
+	if err := f.Set("drain-timeout", "25s"); err != nil {
+		t.Errorf("error setting drain-timeout: %v", err)
+	}
+	if err := f.Set("device-discovery-poll-interval", "2s"); err != nil {
+		t.Errorf("error setting device-discovery-poll-interval: %v", err)
+	}
+	if err := f.Set("device-discovery-retries", "10"); err != nil {
+		t.Errorf("error setting device-discovery-retries: %v", err)
+	}
+	if err := f.Set("device-discovery-interval", "500ms"); err != nil {
+		t.Errorf("error setting device-discovery-interval: %v", err)
+	}
+	if err := f.Set("device-path-hint-dir", "/var/lib/ebs-csi-driver/hints"); err != nil {
+		t.Errorf("error setting device-path-hint-dir: %v", err)
+	}
+	if err := f.Set("enable-instance-type-lookup", "false"); err != nil {
+		t.Errorf("error setting enable-instance-type-lookup: %v", err)
+	}
+	if err := f.Set("min-volume-attach-limit", "16"); err != nil {
+		t.Errorf("error setting min-volume-attach-limit: %v", err)
+	}
+	if err := f.Set("max-volume-attach-limit", "32"); err != nil {
+		t.Errorf("error setting max-volume-attach-limit: %v", err)
+	}
+	if err := f.Set("enable-volume-attachment-lookup", "false"); err != nil {
+		t.Errorf("error setting enable-volume-attachment-lookup: %v", err)
+	}
+	if err := f.Set("snapshot-before-expand", "true"); err != nil {
+		t.Errorf("error setting snapshot-before-expand: %v", err)
+	}
+	if err := f.Set("disable-node-expansion", "true"); err != nil {
+		t.Errorf("error setting disable-node-expansion: %v", err)
+	}
+	if err := f.Set("enable-snapshot-on-delete", "true"); err != nil {
+		t.Errorf("error setting enable-snapshot-on-delete: %v", err)
+	}
+	if err := f.Set("annotate-pv-on-create", "true"); err != nil {
+		t.Errorf("error setting annotate-pv-on-create: %v", err)
+	}
+	if err := f.Set("reconcile-csinode-allocatable", "true"); err != nil {
+		t.Errorf("error setting reconcile-csinode-allocatable: %v", err)
+	}
+	if err := f.Set("enable-instance-topology", "true"); err != nil {
+		t.Errorf("error setting enable-instance-topology: %v", err)
+	}
+	if err := f.Set("startup-taint-keys", "company.io/storage-not-ready,"+AgentNotReadyNodeTaintKey); err != nil {
+		t.Errorf("error setting startup-taint-keys: %v", err)
+	}
+	if err := f.Set("remove-taint-keys", "company.io/ebs-not-ready"); err != nil {
+		t.Errorf("error setting remove-taint-keys: %v", err)
+	}
+	if err := f.Set("watch-interruption-notices", "true"); err != nil {
+		t.Errorf("error setting watch-interruption-notices: %v", err)
+	}
+	if err := f.Set("flush-on-interruption-notice", "true"); err != nil {
+		t.Errorf("error setting flush-on-interruption-notice: %v", err)
+	}
+	if err := f.Set("spot-interruption-grace", "90s"); err != nil {
+		t.Errorf("error setting spot-interruption-grace: %v", err)
+	}
+	if err := f.Set("allow-tmpfs-publish-target", "true"); err != nil {
+		t.Errorf("error setting allow-tmpfs-publish-target: %v", err)
+	}
+	if err := f.Set("topology-label-tags", "team,rack"); err != nil {
+		t.Errorf("error setting topology-label-tags: %v", err)
+	}
+	if err := f.Set("diagnostic-mounts-dir", "/var/lib/ebs-csi/diag"); err != nil {
+		t.Errorf("error setting diagnostic-mounts-dir: %v", err)
+	}
+	if err := f.Set("csi-mount-point-prefix", "/var/lib/kubelet"); err != nil {
+		t.Errorf("error setting csi-mount-point-prefix: %v", err)
+	}
+	if err := f.Set("create-device-symlinks", "true"); err != nil {
+		t.Errorf("error setting create-device-symlinks: %v", err)
+	}
+	if err := f.Set("default-fstype", "xfs"); err != nil {
+		t.Errorf("error setting default-fstype: %v", err)
+	}
+	if err := f.Set("mount-dir-permissions", "0750"); err != nil {
+		t.Errorf("error setting mount-dir-permissions: %v", err)
+	}
+	if err := f.Set("chmod-existing-mount-dirs", "true"); err != nil {
+		t.Errorf("error setting chmod-existing-mount-dirs: %v", err)
+	}
+	if err := f.Set("fail-on-metadata-error", "true"); err != nil {
+		t.Errorf("error setting fail-on-metadata-error: %v", err)
+	}
 
 	if o.Endpoint != "custom-endpoint" {
 		t.Errorf("unexpected Endpoint: got %s, want custom-endpoint", o.Endpoint)
@@ -77,12 +216,33 @@ func TestAddFlags(t *testing.T) {
 	if o.HttpEndpoint != ":8080" {
 		t.Errorf("unexpected HttpEndpoint: got %s, want :8080", o.HttpEndpoint)
 	}
+	if o.MetricsNamespace != "ebs_csi" {
+		t.Errorf("unexpected MetricsNamespace: got %s, want ebs_csi", o.MetricsNamespace)
+	}
+	if o.MetricsShutdownTimeout != 10*time.Second {
+		t.Errorf("unexpected MetricsShutdownTimeout: got %v, want 10s", o.MetricsShutdownTimeout)
+	}
+	if o.ProbeTimeout != 5*time.Second {
+		t.Errorf("unexpected ProbeTimeout: got %v, want 5s", o.ProbeTimeout)
+	}
 	if !o.EnableOtelTracing {
 		t.Error("unexpected EnableOtelTracing: got false, want true")
 	}
+	if o.MetadataFile != "/etc/ebs/metadata.json" {
+		t.Errorf("unexpected MetadataFile: got %s, want /etc/ebs/metadata.json", o.MetadataFile)
+	}
+	if !slices.Equal(o.MetadataSources, []string{"imds", "file"}) {
+		t.Errorf("unexpected MetadataSources: got %v, want [imds file]", o.MetadataSources)
+	}
 	if len(o.ExtraTags) != 2 || o.ExtraTags["key1"] != "value1" || o.ExtraTags["key2"] != "value2" {
 		t.Errorf("unexpected ExtraTags: got %v, want map[key1:value1 key2:value2]", o.ExtraTags)
 	}
+	if o.ExtraTagsFile != "/etc/ebs/extra-tags.json" {
+		t.Errorf("unexpected ExtraTagsFile: got %s, want /etc/ebs/extra-tags.json", o.ExtraTagsFile)
+	}
+	if o.ExtraTagsHeadroom != 5 {
+		t.Errorf("unexpected ExtraTagsHeadroom: got %d, want 5", o.ExtraTagsHeadroom)
+	}
 	if o.KubernetesClusterID != "cluster-123" {
 		t.Errorf("unexpected KubernetesClusterID: got %s, want cluster-123", o.KubernetesClusterID)
 	}
@@ -98,6 +258,18 @@ func TestAddFlags(t *testing.T) {
 	if !o.Batching {
 		t.Error("unexpected Batching: got false, want true")
 	}
+	if o.DescribeVolumeCacheTTL != 10*time.Second {
+		t.Errorf("unexpected DescribeVolumeCacheTTL: got %v, want 10s", o.DescribeVolumeCacheTTL)
+	}
+	if len(o.KmsKeyByVolumeType) != 2 || o.KmsKeyByVolumeType["io2"] != "arn:aws:kms:us-east-1:012345678910:key/abcd" || o.KmsKeyByVolumeType["gp3"] != "alias/dev" {
+		t.Errorf("unexpected KmsKeyByVolumeType: got %v, want map[gp3:alias/dev io2:arn:aws:kms:us-east-1:012345678910:key/abcd]", o.KmsKeyByVolumeType)
+	}
+	if len(o.RpcTimeouts) != 2 || o.RpcTimeouts["CreateVolume"] != 5*time.Minute || o.RpcTimeouts["ControllerPublishVolume"] != 2*time.Minute {
+		t.Errorf("unexpected RpcTimeouts: got %v, want map[ControllerPublishVolume:2m0s CreateVolume:5m0s]", o.RpcTimeouts)
+	}
+	if !slices.Equal(o.ExcludedZones, []string{"us-east-1c", "us-east-1d"}) {
+		t.Errorf("unexpected ExcludedZones: got %v, want [us-east-1c us-east-1d]", o.ExcludedZones)
+	}
 	if o.ModifyVolumeRequestHandlerTimeout != time.Minute {
 		t.Errorf("unexpected ModifyVolumeRequestHandlerTimeout: got %v, want 1m", o.ModifyVolumeRequestHandlerTimeout)
 	}
@@ -107,111 +279,1249 @@ func TestAddFlags(t *testing.T) {
 	if o.ReservedVolumeAttachments != 5 {
 		t.Errorf("unexpected ReservedVolumeAttachments: got %d, want 5", o.ReservedVolumeAttachments)
 	}
+	if o.MinVolumeAttachLimit != 16 {
+		t.Errorf("unexpected MinVolumeAttachLimit: got %d, want 16", o.MinVolumeAttachLimit)
+	}
+	if o.MaxVolumeAttachLimit != 32 {
+		t.Errorf("unexpected MaxVolumeAttachLimit: got %d, want 32", o.MaxVolumeAttachLimit)
+	}
+	if o.DeviceDiscoveryTimeout != 30*time.Second {
+		t.Errorf("unexpected DeviceDiscoveryTimeout: got %v, want 30s", o.DeviceDiscoveryTimeout)
+	}
+	if o.FormatTimeout != 30*time.Minute {
+		t.Errorf("unexpected FormatTimeout: got %v, want 30m", o.FormatTimeout)
+	}
+	if o.MaxConcurrentFormat != 2 {
+		t.Errorf("unexpected MaxConcurrentFormat: got %d, want 2", o.MaxConcurrentFormat)
+	}
+	if o.DrainTimeout != 25*time.Second {
+		t.Errorf("unexpected DrainTimeout: got %v, want 25s", o.DrainTimeout)
+	}
+	if o.DeviceDiscoveryPollInterval != 2*time.Second {
+		t.Errorf("unexpected DeviceDiscoveryPollInterval: got %v, want 2s", o.DeviceDiscoveryPollInterval)
+	}
+	if o.DeviceDiscoveryRetries != 10 {
+		t.Errorf("unexpected DeviceDiscoveryRetries: got %d, want 10", o.DeviceDiscoveryRetries)
+	}
+	if o.DeviceDiscoveryInterval != 500*time.Millisecond {
+		t.Errorf("unexpected DeviceDiscoveryInterval: got %v, want 500ms", o.DeviceDiscoveryInterval)
+	}
+	if o.DevicePathHintDir != "/var/lib/ebs-csi-driver/hints" {
+		t.Errorf("unexpected DevicePathHintDir: got %s, want /var/lib/ebs-csi-driver/hints", o.DevicePathHintDir)
+	}
+	if o.EnableInstanceTypeLookup {
+		t.Error("unexpected EnableInstanceTypeLookup: got true, want false")
+	}
+	if o.EnableVolumeAttachmentLookup {
+		t.Error("unexpected EnableVolumeAttachmentLookup: got true, want false")
+	}
+	if !o.SnapshotBeforeExpand {
+		t.Error("unexpected SnapshotBeforeExpand: got false, want true")
+	}
+	if !o.DisableNodeExpansion {
+		t.Error("unexpected DisableNodeExpansion: got false, want true")
+	}
+	if !o.EnableSnapshotOnDelete {
+		t.Error("unexpected EnableSnapshotOnDelete: got false, want true")
+	}
+	if !o.AnnotatePVOnCreate {
+		t.Error("unexpected AnnotatePVOnCreate: got false, want true")
+	}
+	if !o.ReconcileCSINodeAllocatable {
+		t.Error("unexpected ReconcileCSINodeAllocatable: got false, want true")
+	}
+	if !o.EnableInstanceTopology {
+		t.Error("unexpected EnableInstanceTopology: got false, want true")
+	}
+	if !slices.Equal(o.StartupTaintKeys, []string{"company.io/storage-not-ready", AgentNotReadyNodeTaintKey}) {
+		t.Errorf("unexpected StartupTaintKeys: got %v", o.StartupTaintKeys)
+	}
+	if len(o.RemoveTaintKeys) != 1 || o.RemoveTaintKeys[0] != "company.io/ebs-not-ready" {
+		t.Errorf("unexpected RemoveTaintKeys: got %v, want [company.io/ebs-not-ready]", o.RemoveTaintKeys)
+	}
+	if !o.WatchInterruptionNotices {
+		t.Error("unexpected WatchInterruptionNotices: got false, want true")
+	}
+	if !o.FlushOnInterruptionNotice {
+		t.Error("unexpected FlushOnInterruptionNotice: got false, want true")
+	}
+	if o.SpotInterruptionGrace != 90*time.Second {
+		t.Errorf("unexpected SpotInterruptionGrace: got %v, want 90s", o.SpotInterruptionGrace)
+	}
+	if !o.AllowTmpfsPublishTarget {
+		t.Error("unexpected AllowTmpfsPublishTarget: got false, want true")
+	}
+	if len(o.TopologyLabelTags) != 2 || o.TopologyLabelTags[0] != "team" || o.TopologyLabelTags[1] != "rack" {
+		t.Errorf("unexpected TopologyLabelTags: got %v, want [team rack]", o.TopologyLabelTags)
+	}
+	if o.CSIMountPointPrefix != "/var/lib/kubelet" {
+		t.Errorf("unexpected CSIMountPointPrefix: got %s, want /var/lib/kubelet", o.CSIMountPointPrefix)
+	}
+	if o.DiagnosticMountsDir != "/var/lib/ebs-csi/diag" {
+		t.Errorf("unexpected DiagnosticMountsDir: got %s, want /var/lib/ebs-csi/diag", o.DiagnosticMountsDir)
+	}
+	if !o.CreateDeviceSymlinks {
+		t.Error("unexpected CreateDeviceSymlinks: got false, want true")
+	}
+	if o.DefaultFsType != "xfs" {
+		t.Errorf("unexpected DefaultFsType: got %s, want xfs", o.DefaultFsType)
+	}
+	if o.MountDirPermissions != "0750" {
+		t.Errorf("unexpected MountDirPermissions: got %s, want 0750", o.MountDirPermissions)
+	}
+	if !o.ChmodExistingMountDirs {
+		t.Error("unexpected ChmodExistingMountDirs: got false, want true")
+	}
+	if !o.FailOnMetadataError {
+		t.Error("unexpected FailOnMetadataError: got false, want true")
+	}
+	if o.AuditLogFile != "/var/log/ebs-csi/audit.log" {
+		t.Errorf("unexpected AuditLogFile: got %s, want /var/log/ebs-csi/audit.log", o.AuditLogFile)
+	}
+	if o.FormatDefaultsFile != "/etc/ebs-csi/format-defaults.yaml" {
+		t.Errorf("unexpected FormatDefaultsFile: got %s, want /etc/ebs-csi/format-defaults.yaml", o.FormatDefaultsFile)
+	}
 }
 
-func TestValidateAttachmentLimits(t *testing.T) {
+func TestAddFlagsInvalidKmsKeyByVolumeType(t *testing.T) {
+	o := &Options{}
+	o.Mode = ControllerMode
+
+	f := flag.NewFlagSet("test", flag.ContinueOnError)
+	o.AddFlags(f)
+
+	if err := f.Set("kms-key-by-volume-type", "io2"); err == nil {
+		t.Error("expected error setting kms-key-by-volume-type without a key")
+	}
+}
+
+func TestAddFlagsInvalidRpcTimeouts(t *testing.T) {
+	o := &Options{}
+	o.Mode = ControllerMode
+
+	f := flag.NewFlagSet("test", flag.ContinueOnError)
+	o.AddFlags(f)
+
+	if err := f.Set("rpc-timeouts", "CreateVolume"); err == nil {
+		t.Error("expected error setting rpc-timeouts without a duration")
+	}
+	if err := f.Set("rpc-timeouts", "CreateVolume=soon"); err == nil {
+		t.Error("expected error setting rpc-timeouts with an invalid duration")
+	}
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfigFile(t, `
+endpoint: unix:/csi/csi.sock
+extra-tags:
+  key1: value1
+rpc-timeouts:
+  CreateVolume: 2m
+format-timeout: 5m
+batching: true
+`)
+
+	o, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if o.Endpoint != "unix:/csi/csi.sock" {
+		t.Errorf("unexpected Endpoint: got %s, want unix:/csi/csi.sock", o.Endpoint)
+	}
+	if o.ExtraTags["key1"] != "value1" {
+		t.Errorf("unexpected ExtraTags: got %v, want key1=value1", o.ExtraTags)
+	}
+	if o.RpcTimeouts["CreateVolume"] != 2*time.Minute {
+		t.Errorf("unexpected RpcTimeouts: got %v, want CreateVolume=2m", o.RpcTimeouts)
+	}
+	if o.FormatTimeout != 5*time.Minute {
+		t.Errorf("unexpected FormatTimeout: got %s, want 5m", o.FormatTimeout)
+	}
+	if !o.Batching {
+		t.Error("unexpected Batching: got false, want true")
+	}
+	// Options missing from the file have their flag's default value
+	if o.MetricsShutdownTimeout != DefaultMetricsShutdownTimeout {
+		t.Errorf("unexpected MetricsShutdownTimeout: got %s, want %s", o.MetricsShutdownTimeout, DefaultMetricsShutdownTimeout)
+	}
+	if o.ProbeTimeout != DefaultProbeTimeout {
+		t.Errorf("unexpected ProbeTimeout: got %s, want %s", o.ProbeTimeout, DefaultProbeTimeout)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
 	tests := []struct {
-		name                string
-		volumeAttachLimit   int64
-		reservedAttachments int
-		expectedErr         bool
-		errMsg              string
+		name string
+		path string
 	}{
 		{
-			name:                "both options not set",
-			volumeAttachLimit:   -1,
-			reservedAttachments: -1,
-			expectedErr:         false,
+			name: "missing file",
+			path: filepath.Join(t.TempDir(), "missing.yaml"),
 		},
 		{
-			name:                "volumeAttachLimit set",
-			volumeAttachLimit:   10,
-			reservedAttachments: -1,
-			expectedErr:         false,
+			name: "malformed YAML",
+			path: writeConfigFile(t, "endpoint: [unix:/csi/csi.sock"),
 		},
 		{
-			name:                "reservedVolumeAttachments set",
-			volumeAttachLimit:   -1,
-			reservedAttachments: 2,
-			expectedErr:         false,
+			name: "unknown option",
+			path: writeConfigFile(t, "no-such-option: true"),
 		},
 		{
-			name:                "both options set",
-			volumeAttachLimit:   10,
-			reservedAttachments: 2,
-			expectedErr:         true,
-			errMsg:              "only one of --volume-attach-limit and --reserved-volume-attachments may be specified",
+			name: "wrong type",
+			path: writeConfigFile(t, "format-timeout: soon"),
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			o := &Options{
-				Mode:                      NodeMode,
-				VolumeAttachLimit:         tt.volumeAttachLimit,
-				ReservedVolumeAttachments: tt.reservedAttachments,
+			if _, err := LoadConfig(tt.path); err == nil {
+				t.Error("expected error loading config file")
 			}
+		})
+	}
+}
 
-			err := o.Validate()
-			if (err != nil) != tt.expectedErr {
-				t.Errorf("Options.Validate() error = %v, wantErr %v", err, tt.expectedErr)
+func TestNewOptions(t *testing.T) {
+	path := writeConfigFile(t, `
+endpoint: unix:/csi/file.sock
+http-endpoint: ":8080"
+`)
+
+	f := flag.NewFlagSet("test", flag.ContinueOnError)
+	o, err := NewOptions(NodeMode, f, []string{"--endpoint=unix:/csi/flag.sock", "--config-file", path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if o.Mode != NodeMode {
+		t.Errorf("unexpected Mode: got %s, want %s", o.Mode, NodeMode)
+	}
+	if o.ConfigFile != path {
+		t.Errorf("unexpected ConfigFile: got %s, want %s", o.ConfigFile, path)
+	}
+	// The flag overrides the file
+	if o.Endpoint != "unix:/csi/flag.sock" {
+		t.Errorf("unexpected Endpoint: got %s, want unix:/csi/flag.sock", o.Endpoint)
+	}
+	if o.HttpEndpoint != ":8080" {
+		t.Errorf("unexpected HttpEndpoint: got %s, want :8080", o.HttpEndpoint)
+	}
+}
+
+func TestNewOptionsConfigFileErrors(t *testing.T) {
+	f := flag.NewFlagSet("test", flag.ContinueOnError)
+	if _, err := NewOptions(AllMode, f, []string{"--config-file=" + filepath.Join(t.TempDir(), "missing.yaml")}); err == nil {
+		t.Error("expected error with a missing config file")
+	}
+}
+
+func TestValidateRpcTimeouts(t *testing.T) {
+	tests := []struct {
+		name        string
+		timeouts    map[string]time.Duration
+		expectError bool
+	}{
+		{
+			name: "not set",
+		},
+		{
+			name:     "known methods",
+			timeouts: map[string]time.Duration{"CreateVolume": 5 * time.Minute, "ControllerPublishVolume": 2 * time.Minute},
+		},
+		{
+			name:        "unknown method",
+			timeouts:    map[string]time.Duration{"CreateVolumes": 5 * time.Minute},
+			expectError: true,
+		},
+		{
+			name:        "node method",
+			timeouts:    map[string]time.Duration{"NodeStageVolume": 5 * time.Minute},
+			expectError: true,
+		},
+		{
+			name:        "non-positive timeout",
+			timeouts:    map[string]time.Duration{"CreateVolume": 0},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Options{
+				Mode:        ControllerMode,
+				RpcTimeouts: tt.timeouts,
 			}
 
-			if err != nil && err.Error() != tt.errMsg {
-				t.Errorf("Options.Validate() error message = %v, wantErrMsg %v", err.Error(), tt.errMsg)
+			err := o.Validate()
+			if (err != nil) != tt.expectError {
+				t.Errorf("Options.Validate() error = %v, wantErr %v", err, tt.expectError)
 			}
 		})
 	}
 }
 
-func TestValidateMetricsHTTPS(t *testing.T) {
+func TestValidateParameterDrift(t *testing.T) {
 	tests := []struct {
-		name            string
-		httpEndpoint    string
-		metricsCertFile string
-		metricsKeyFile  string
-		expectError     bool
+		name        string
+		interval    time.Duration
+		heal        string
+		expectError bool
 	}{
 		{
-			name: "disabled",
+			name: "not set",
 		},
 		{
-			name:         "only http",
-			httpEndpoint: ":8080",
+			name:     "check only",
+			interval: time.Hour,
 		},
 		{
-			name:            "https with all",
-			httpEndpoint:    ":443",
-			metricsCertFile: "/https.crt",
-			metricsKeyFile:  "/https.key",
+			name:     "check and heal tags",
+			interval: time.Hour,
+			heal:     HealParameterDriftTags,
 		},
 		{
-			name:            "https with endpoint missing",
-			metricsCertFile: "/https.crt",
-			metricsKeyFile:  "/https.key",
-			expectError:     true,
+			name:        "negative interval",
+			interval:    -time.Hour,
+			expectError: true,
 		},
 		{
-			name:           "https with cert missing",
-			httpEndpoint:   ":443",
-			metricsKeyFile: "/https.key",
-			expectError:    true,
+			name:        "unknown heal mode",
+			interval:    time.Hour,
+			heal:        "volume",
+			expectError: true,
 		},
 		{
-			name:            "https with key missing",
-			httpEndpoint:    ":443",
-			metricsCertFile: "/https.crt",
-			expectError:     true,
+			name:        "heal without check",
+			heal:        HealParameterDriftTags,
+			expectError: true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			o := &Options{
-				Mode:            ControllerMode,
-				HttpEndpoint:    tt.httpEndpoint,
-				MetricsCertFile: tt.metricsCertFile,
-				MetricsKeyFile:  tt.metricsKeyFile,
+				Mode:                        ControllerMode,
+				ParameterDriftCheckInterval: tt.interval,
+				HealParameterDrift:          tt.heal,
+			}
+
+			err := o.Validate()
+			if (err != nil) != tt.expectError {
+				t.Errorf("Options.Validate() error = %v, wantErr %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestValidateVolumeStatusCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		interval    time.Duration
+		autoEnable  bool
+		expectError bool
+	}{
+		{
+			name: "not set",
+		},
+		{
+			name:     "check only",
+			interval: time.Minute,
+		},
+		{
+			name:       "check and auto enable",
+			interval:   time.Minute,
+			autoEnable: true,
+		},
+		{
+			name:        "negative interval",
+			interval:    -time.Minute,
+			expectError: true,
+		},
+		{
+			name:        "auto enable without check",
+			autoEnable:  true,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Options{
+				Mode:                      ControllerMode,
+				VolumeStatusCheckInterval: tt.interval,
+				AutoEnableVolumeIO:        tt.autoEnable,
+			}
+
+			err := o.Validate()
+			if (err != nil) != tt.expectError {
+				t.Errorf("Options.Validate() error = %v, wantErr %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestValidateCreateVolumeFairQueue(t *testing.T) {
+	tests := []struct {
+		name          string
+		threshold     int
+		classInFlight int
+		expectError   bool
+	}{
+		{
+			name: "not set",
+		},
+		{
+			name:      "threshold only",
+			threshold: 20,
+		},
+		{
+			name:          "threshold and class limit",
+			threshold:     20,
+			classInFlight: 10,
+		},
+		{
+			name:        "negative threshold",
+			threshold:   -1,
+			expectError: true,
+		},
+		{
+			name:          "negative class limit",
+			threshold:     20,
+			classInFlight: -1,
+			expectError:   true,
+		},
+		{
+			name:          "class limit without threshold",
+			classInFlight: 10,
+			expectError:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Options{
+				Mode:                           ControllerMode,
+				CreateVolumeFairQueueThreshold: tt.threshold,
+				CreateVolumeClassInFlight:      tt.classInFlight,
+			}
+
+			err := o.Validate()
+			if (err != nil) != tt.expectError {
+				t.Errorf("Options.Validate() error = %v, wantErr %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestValidateCapacity(t *testing.T) {
+	tests := []struct {
+		name        string
+		quota       int64
+		ttl         time.Duration
+		expectError bool
+	}{
+		{
+			name: "not set",
+		},
+		{
+			name:  "quota and TTL",
+			quota: 16384,
+			ttl:   time.Minute,
+		},
+		{
+			name:        "negative quota",
+			quota:       -1,
+			expectError: true,
+		},
+		{
+			name:        "negative TTL",
+			quota:       16384,
+			ttl:         -time.Minute,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Options{
+				Mode:                 ControllerMode,
+				CapacityZoneQuotaGiB: tt.quota,
+				CapacityCacheTTL:     tt.ttl,
+			}
+
+			err := o.Validate()
+			if (err != nil) != tt.expectError {
+				t.Errorf("Options.Validate() error = %v, wantErr %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestValidateDescribeVolumeCacheTTL(t *testing.T) {
+	tests := []struct {
+		name        string
+		ttl         time.Duration
+		expectError bool
+	}{
+		{name: "disabled"},
+		{name: "enabled", ttl: 10 * time.Second},
+		{name: "negative", ttl: -time.Second, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Options{
+				Mode:                   ControllerMode,
+				DescribeVolumeCacheTTL: tt.ttl,
+			}
+
+			err := o.Validate()
+			if (err != nil) != tt.expectError {
+				t.Errorf("Options.Validate() error = %v, wantErr %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestValidateDiagnosticMountsDir(t *testing.T) {
+	tests := []struct {
+		dir         string
+		expectError bool
+	}{
+		{dir: ""},
+		{dir: "/var/lib/ebs-csi/diag"},
+		{dir: "var/lib/ebs-csi/diag", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			o := &Options{
+				Mode:                      NodeMode,
+				VolumeAttachLimit:         -1,
+				ReservedVolumeAttachments: -1,
+				DiagnosticMountsDir:       tt.dir,
+			}
+
+			err := o.Validate()
+			if (err != nil) != tt.expectError {
+				t.Errorf("Options.Validate() error = %v, wantErr %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestValidateCSIMountPointPrefix(t *testing.T) {
+	tests := []struct {
+		prefix      string
+		expectError bool
+	}{
+		{prefix: ""},
+		{prefix: "/var/lib/kubelet"},
+		{prefix: "var/lib/kubelet", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			o := &Options{
+				Mode:                      NodeMode,
+				VolumeAttachLimit:         -1,
+				ReservedVolumeAttachments: -1,
+				CSIMountPointPrefix:       tt.prefix,
+			}
+
+			err := o.Validate()
+			if (err != nil) != tt.expectError {
+				t.Errorf("Options.Validate() error = %v, wantErr %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestValidateDefaultFsType(t *testing.T) {
+	tests := []struct {
+		fsType      string
+		expectError bool
+	}{
+		{fsType: ""},
+		{fsType: FSTypeExt4},
+		{fsType: FSTypeXfs},
+		{fsType: "btrfs", expectError: true},
+		{fsType: "XFS", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fsType, func(t *testing.T) {
+			o := &Options{
+				Mode:                      NodeMode,
+				VolumeAttachLimit:         -1,
+				ReservedVolumeAttachments: -1,
+				DefaultFsType:             tt.fsType,
+			}
+
+			err := o.Validate()
+			if (err != nil) != tt.expectError {
+				t.Errorf("Options.Validate() error = %v, wantErr %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestValidateMountDirPermissions(t *testing.T) {
+	tests := []struct {
+		name         string
+		permissions  string
+		chmod        bool
+		expectedMode os.FileMode
+		expectError  bool
+	}{
+		{
+			name: "not set",
+		},
+		{
+			name:         "valid mode",
+			permissions:  "0750",
+			expectedMode: 0750,
+		},
+		{
+			name:         "valid mode without leading zero",
+			permissions:  "770",
+			chmod:        true,
+			expectedMode: 0770,
+		},
+		{
+			name:        "not octal",
+			permissions: "0789",
+			expectError: true,
+		},
+		{
+			name:        "not a number",
+			permissions: "rwxr-x---",
+			expectError: true,
+		},
+		{
+			name:        "special bits",
+			permissions: "4750",
+			expectError: true,
+		},
+		{
+			name:        "zero",
+			permissions: "0",
+			expectError: true,
+		},
+		{
+			name:        "chmod without mode",
+			chmod:       true,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Options{
+				Mode:                      NodeMode,
+				VolumeAttachLimit:         -1,
+				ReservedVolumeAttachments: -1,
+				MountDirPermissions:       tt.permissions,
+				ChmodExistingMountDirs:    tt.chmod,
+			}
+
+			err := o.Validate()
+			if (err != nil) != tt.expectError {
+				t.Errorf("Options.Validate() error = %v, wantErr %v", err, tt.expectError)
+			}
+			if mode, _ := o.MountDirMode(); !tt.expectError && mode != tt.expectedMode {
+				t.Errorf("Options.MountDirMode() = %#o, want %#o", mode, tt.expectedMode)
+			}
+		})
+	}
+}
+
+func TestValidateExtraTagsHeadroom(t *testing.T) {
+	o := &Options{Mode: ControllerMode, ExtraTagsHeadroom: -1}
+	if err := o.Validate(); err == nil {
+		t.Error("Options.Validate() succeeded with a negative --extra-tags-headroom")
+	}
+}
+
+func TestValidateAttachmentLimits(t *testing.T) {
+	tests := []struct {
+		name                string
+		volumeAttachLimit   int64
+		reservedAttachments int
+		expectedErr         bool
+		errMsg              string
+	}{
+		{
+			name:                "both options not set",
+			volumeAttachLimit:   -1,
+			reservedAttachments: -1,
+			expectedErr:         false,
+		},
+		{
+			name:                "volumeAttachLimit set",
+			volumeAttachLimit:   10,
+			reservedAttachments: -1,
+			expectedErr:         false,
+		},
+		{
+			name:                "reservedVolumeAttachments set",
+			volumeAttachLimit:   -1,
+			reservedAttachments: 2,
+			expectedErr:         false,
+		},
+		{
+			name:                "both options set",
+			volumeAttachLimit:   10,
+			reservedAttachments: 2,
+			expectedErr:         true,
+			errMsg:              "only one of --volume-attach-limit and --reserved-volume-attachments may be specified",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Options{
+				Mode:                      NodeMode,
+				VolumeAttachLimit:         tt.volumeAttachLimit,
+				ReservedVolumeAttachments: tt.reservedAttachments,
+			}
+
+			err := o.Validate()
+			if (err != nil) != tt.expectedErr {
+				t.Errorf("Options.Validate() error = %v, wantErr %v", err, tt.expectedErr)
+			}
+
+			if err != nil && err.Error() != tt.errMsg {
+				t.Errorf("Options.Validate() error message = %v, wantErrMsg %v", err.Error(), tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestValidateTopologyLabelTags(t *testing.T) {
+	tests := []struct {
+		name        string
+		tags        []string
+		expectError bool
+	}{
+		{
+			name: "not set",
+		},
+		{
+			name: "valid tags",
+			tags: []string{"team", "rack", "data-center"},
+		},
+		{
+			name:        "tag with invalid characters",
+			tags:        []string{"team name"},
+			expectError: true,
+		},
+		{
+			name:        "tag too long",
+			tags:        []string{strings.Repeat("a", 60)},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Options{
+				Mode:                      NodeMode,
+				VolumeAttachLimit:         -1,
+				ReservedVolumeAttachments: -1,
+				TopologyLabelTags:         tt.tags,
+			}
+
+			err := o.Validate()
+			if (err != nil) != tt.expectError {
+				t.Errorf("Options.Validate() error = %v, wantErr %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestValidateVolumeAttachLimitClamps(t *testing.T) {
+	tests := []struct {
+		name        string
+		min         int64
+		max         int64
+		expectError bool
+	}{
+		{
+			name: "not set",
+		},
+		{
+			name: "only min",
+			min:  16,
+		},
+		{
+			name: "only max",
+			max:  32,
+		},
+		{
+			name: "min equal to max",
+			min:  16,
+			max:  16,
+		},
+		{
+			name:        "min greater than max",
+			min:         32,
+			max:         16,
+			expectError: true,
+		},
+		{
+			name:        "negative min",
+			min:         -1,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Options{
+				Mode:                      NodeMode,
+				VolumeAttachLimit:         -1,
+				ReservedVolumeAttachments: -1,
+				MinVolumeAttachLimit:      tt.min,
+				MaxVolumeAttachLimit:      tt.max,
+			}
+
+			err := o.Validate()
+			if (err != nil) != tt.expectError {
+				t.Errorf("Options.Validate() error = %v, wantErr %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestValidateRemoveTaintKeys(t *testing.T) {
+	tests := []struct {
+		name           string
+		keys           []string
+		startupKeys    []string
+		expStartupKeys []string
+		expectError    bool
+	}{
+		{
+			name:           "not set",
+			startupKeys:    []string{AgentNotReadyNodeTaintKey},
+			expStartupKeys: []string{AgentNotReadyNodeTaintKey},
+		},
+		{
+			name:           "valid keys merged into the startup taint keys",
+			keys:           []string{"company.io/ebs-not-ready", "storage-not-ready"},
+			startupKeys:    []string{AgentNotReadyNodeTaintKey},
+			expStartupKeys: []string{AgentNotReadyNodeTaintKey, "company.io/ebs-not-ready", "storage-not-ready"},
+		},
+		{
+			name:           "valid keys merged into the default startup taint key",
+			keys:           []string{"company.io/ebs-not-ready"},
+			expStartupKeys: []string{AgentNotReadyNodeTaintKey, "company.io/ebs-not-ready"},
+		},
+		{
+			name:        "invalid key",
+			keys:        []string{"company.io/ebs not ready"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Options{
+				Mode:                      NodeMode,
+				VolumeAttachLimit:         -1,
+				ReservedVolumeAttachments: -1,
+				RemoveTaintKeys:           tt.keys,
+				StartupTaintKeys:          tt.startupKeys,
+			}
+
+			err := o.Validate()
+			if (err != nil) != tt.expectError {
+				t.Errorf("Options.Validate() error = %v, wantErr %v", err, tt.expectError)
+			}
+			if err == nil && !slices.Equal(o.StartupTaintKeys, tt.expStartupKeys) {
+				t.Errorf("unexpected StartupTaintKeys: got %v, want %v", o.StartupTaintKeys, tt.expStartupKeys)
+			}
+		})
+	}
+}
+
+func TestValidateStartupTaintKeys(t *testing.T) {
+	tests := []struct {
+		name        string
+		keys        []string
+		expectError bool
+	}{
+		{
+			name: "not set",
+		},
+		{
+			name: "multiple keys",
+			keys: []string{AgentNotReadyNodeTaintKey, "company.io/ebs-not-ready"},
+		},
+		{
+			name:        "empty key",
+			keys:        []string{AgentNotReadyNodeTaintKey, ""},
+			expectError: true,
+		},
+		{
+			name:        "invalid key",
+			keys:        []string{"company.io/ebs not ready"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Options{
+				Mode:                      NodeMode,
+				VolumeAttachLimit:         -1,
+				ReservedVolumeAttachments: -1,
+				StartupTaintKeys:          tt.keys,
+			}
+
+			err := o.Validate()
+			if (err != nil) != tt.expectError {
+				t.Errorf("Options.Validate() error = %v, wantErr %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestValidateDeviceDiscovery(t *testing.T) {
+	tests := []struct {
+		name          string
+		timeout       time.Duration
+		pollInterval  time.Duration
+		retries       int
+		retryInterval time.Duration
+		expectError   bool
+	}{
+		{
+			name:          "defaults",
+			retries:       DefaultDeviceDiscoveryRetries,
+			retryInterval: DefaultDeviceDiscoveryInterval,
+		},
+		{
+			name:          "retries with interval",
+			retries:       10,
+			retryInterval: 500 * time.Millisecond,
+		},
+		{
+			name:          "negative retries",
+			retries:       -1,
+			retryInterval: time.Second,
+			expectError:   true,
+		},
+		{
+			name:        "retries without interval",
+			retries:     5,
+			expectError: true,
+		},
+		{
+			name:          "timeout with poll interval",
+			timeout:       5 * time.Second,
+			pollInterval:  time.Second,
+			retries:       DefaultDeviceDiscoveryRetries,
+			retryInterval: DefaultDeviceDiscoveryInterval,
+		},
+		{
+			name:          "negative timeout",
+			timeout:       -1,
+			pollInterval:  time.Second,
+			retries:       DefaultDeviceDiscoveryRetries,
+			retryInterval: DefaultDeviceDiscoveryInterval,
+			expectError:   true,
+		},
+		{
+			name:          "timeout without poll interval",
+			timeout:       5 * time.Second,
+			retries:       DefaultDeviceDiscoveryRetries,
+			retryInterval: DefaultDeviceDiscoveryInterval,
+			expectError:   true,
+		},
+		{
+			name:          "timeout with retries",
+			timeout:       5 * time.Second,
+			pollInterval:  time.Second,
+			retries:       10,
+			retryInterval: DefaultDeviceDiscoveryInterval,
+			expectError:   true,
+		},
+		{
+			name:          "timeout with retry interval",
+			timeout:       5 * time.Second,
+			pollInterval:  time.Second,
+			retries:       DefaultDeviceDiscoveryRetries,
+			retryInterval: 500 * time.Millisecond,
+			expectError:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Options{
+				Mode:                        NodeMode,
+				VolumeAttachLimit:           -1,
+				ReservedVolumeAttachments:   -1,
+				DeviceDiscoveryTimeout:      tt.timeout,
+				DeviceDiscoveryPollInterval: tt.pollInterval,
+				DeviceDiscoveryRetries:      tt.retries,
+				DeviceDiscoveryInterval:     tt.retryInterval,
+			}
+
+			err := o.Validate()
+			if (err != nil) != tt.expectError {
+				t.Errorf("Options.Validate() error = %v, wantErr %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestValidateMaxConcurrentFormat(t *testing.T) {
+	o := &Options{Mode: NodeMode, VolumeAttachLimit: -1, ReservedVolumeAttachments: -1, MaxConcurrentFormat: -1}
+	if err := o.Validate(); err == nil {
+		t.Error("Options.Validate() succeeded with a negative --max-concurrent-format")
+	}
+}
+
+func TestValidateInterruptionNotices(t *testing.T) {
+	tests := []struct {
+		name        string
+		watch       bool
+		flush       bool
+		grace       time.Duration
+		expectError bool
+	}{
+		{
+			name: "not set",
+		},
+		{
+			name:  "watch without flush",
+			watch: true,
+		},
+		{
+			name:  "watch with flush",
+			watch: true,
+			flush: true,
+		},
+		{
+			name:        "flush without watch",
+			flush:       true,
+			expectError: true,
+		},
+		{
+			name:  "spot interruption grace",
+			grace: 2 * time.Minute,
+		},
+		{
+			name:        "negative spot interruption grace",
+			grace:       -time.Minute,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Options{
+				Mode:                      NodeMode,
+				VolumeAttachLimit:         -1,
+				ReservedVolumeAttachments: -1,
+				WatchInterruptionNotices:  tt.watch,
+				FlushOnInterruptionNotice: tt.flush,
+				SpotInterruptionGrace:     tt.grace,
+			}
+
+			err := o.Validate()
+			if (err != nil) != tt.expectError {
+				t.Errorf("Options.Validate() error = %v, wantErr %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestValidateMetadataFile(t *testing.T) {
+	tests := []struct {
+		name              string
+		metadataFile      string
+		sources           []string
+		watch             bool
+		grace             time.Duration
+		topologyLabelTags []string
+		expectError       bool
+	}{
+		{
+			name: "not set",
+		},
+		{
+			name:         "metadata file",
+			metadataFile: "/etc/ebs/metadata.json",
+		},
+		{
+			name:         "metadata file with interruption notices",
+			metadataFile: "/etc/ebs/metadata.json",
+			watch:        true,
+			expectError:  true,
+		},
+		{
+			name:         "metadata file after imds with interruption notices",
+			metadataFile: "/etc/ebs/metadata.json",
+			sources:      []string{"imds", "file"},
+			watch:        true,
+		},
+		{
+			name:         "metadata file before imds with interruption notices",
+			metadataFile: "/etc/ebs/metadata.json",
+			sources:      []string{"file", "imds"},
+			watch:        true,
+			expectError:  true,
+		},
+		{
+			name:         "metadata file with spot interruption grace",
+			metadataFile: "/etc/ebs/metadata.json",
+			grace:        2 * time.Minute,
+			expectError:  true,
+		},
+		{
+			name:              "metadata file with topology label tags",
+			metadataFile:      "/etc/ebs/metadata.json",
+			topologyLabelTags: []string{"team"},
+			expectError:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Options{
+				Mode:                      NodeMode,
+				VolumeAttachLimit:         -1,
+				ReservedVolumeAttachments: -1,
+				MetadataFile:              tt.metadataFile,
+				MetadataSources:           tt.sources,
+				WatchInterruptionNotices:  tt.watch,
+				SpotInterruptionGrace:     tt.grace,
+				TopologyLabelTags:         tt.topologyLabelTags,
+			}
+
+			err := o.Validate()
+			if (err != nil) != tt.expectError {
+				t.Errorf("Options.Validate() error = %v, wantErr %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestValidateMetricsHTTPS(t *testing.T) {
+	tests := []struct {
+		name            string
+		httpEndpoint    string
+		metricsCertFile string
+		metricsKeyFile  string
+		expectError     bool
+	}{
+		{
+			name: "disabled",
+		},
+		{
+			name:         "only http",
+			httpEndpoint: ":8080",
+		},
+		{
+			name:            "https with all",
+			httpEndpoint:    ":443",
+			metricsCertFile: "/https.crt",
+			metricsKeyFile:  "/https.key",
+		},
+		{
+			name:            "https with endpoint missing",
+			metricsCertFile: "/https.crt",
+			metricsKeyFile:  "/https.key",
+			expectError:     true,
+		},
+		{
+			name:           "https with cert missing",
+			httpEndpoint:   ":443",
+			metricsKeyFile: "/https.key",
+			expectError:    true,
+		},
+		{
+			name:            "https with key missing",
+			httpEndpoint:    ":443",
+			metricsCertFile: "/https.crt",
+			expectError:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Options{
+				Mode:            ControllerMode,
+				HttpEndpoint:    tt.httpEndpoint,
+				MetricsCertFile: tt.metricsCertFile,
+				MetricsKeyFile:  tt.metricsKeyFile,
+			}
+
+			err := o.Validate()
+			if (err != nil) != tt.expectError {
+				t.Errorf("Options.Validate() error = %v, wantErr %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestValidateMetadataSources(t *testing.T) {
+	tests := []struct {
+		name         string
+		sources      []string
+		metadataFile string
+		expectError  bool
+	}{
+		{
+			name: "not set",
+		},
+		{
+			name:    "imds and kubernetes",
+			sources: []string{"imds", "kubernetes"},
+		},
+		{
+			name:         "file",
+			sources:      []string{"imds", "file"},
+			metadataFile: "/etc/ebs/metadata.json",
+		},
+		{
+			name:        "file without metadata file",
+			sources:     []string{"file"},
+			expectError: true,
+		},
+		{
+			name:         "metadata file without file",
+			sources:      []string{"imds", "kubernetes"},
+			metadataFile: "/etc/ebs/metadata.json",
+			expectError:  true,
+		},
+		{
+			name:        "unknown source",
+			sources:     []string{"imds", "ec2"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Options{
+				Mode:                      NodeMode,
+				VolumeAttachLimit:         -1,
+				ReservedVolumeAttachments: -1,
+				MetadataSources:           tt.sources,
+				MetadataFile:              tt.metadataFile,
 			}
 
 			err := o.Validate()
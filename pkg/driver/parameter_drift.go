@@ -0,0 +1,157 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// parameterDrift is a setting of a volume that no longer matches its provisioned parameter tag
+type parameterDrift struct {
+	// parameter is the name of the setting, used as the label of ParameterDriftMetric
+	parameter string
+	tag       string
+	recorded  string
+	actual    string
+}
+
+// provisionedParameterTags returns the provisioned parameter tags recording the given settings
+// Settings that are not set are not recorded
+func provisionedParameterTags(volumeType string, iops, throughput int32) map[string]string {
+	tags := map[string]string{}
+	if volumeType != "" {
+		tags[ProvisionedVolumeTypeTag] = volumeType
+	}
+	if iops > 0 {
+		tags[ProvisionedIOPSTag] = strconv.Itoa(int(iops))
+	}
+	if throughput > 0 {
+		tags[ProvisionedThroughputTag] = strconv.Itoa(int(throughput))
+	}
+	return tags
+}
+
+// findParameterDrift returns the settings of the volume that no longer match its provisioned parameter tags
+// IOPS are only compared for volume types with provisioned IOPS and throughput only for gp3, as the other types derive
+// them from the size of the volume
+func findParameterDrift(disk *cloud.DiskParameters) []parameterDrift {
+	var drift []parameterDrift
+	compare := func(parameter, tag, actual string) {
+		if recorded, ok := disk.Tags[tag]; ok && recorded != actual {
+			drift = append(drift, parameterDrift{parameter: parameter, tag: tag, recorded: recorded, actual: actual})
+		}
+	}
+
+	compare("type", ProvisionedVolumeTypeTag, disk.VolumeType)
+	switch disk.VolumeType {
+	case cloud.VolumeTypeIO1, cloud.VolumeTypeIO2:
+		compare("iops", ProvisionedIOPSTag, strconv.Itoa(int(disk.IOPS)))
+	case cloud.VolumeTypeGP3:
+		compare("iops", ProvisionedIOPSTag, strconv.Itoa(int(disk.IOPS)))
+		compare("throughput", ProvisionedThroughputTag, strconv.Itoa(int(disk.Throughput)))
+	}
+	return drift
+}
+
+// watchParameterDrift checks the volumes created by the driver for parameter drift at every --parameter-drift-check-interval
+func (d *ControllerService) watchParameterDrift(ctx context.Context, k kubernetes.Interface) {
+	ticker := time.NewTicker(d.options.ParameterDriftCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.checkParameterDrift(ctx, k)
+		}
+	}
+}
+
+// checkParameterDrift reports the volumes whose type, IOPS or throughput no longer match their provisioned parameter
+// tags, for example after the volume was modified outside of Kubernetes, and heals the tags if requested
+// With --k8s-tag-cluster-id, only the volumes owned by the cluster are checked.
+func (d *ControllerService) checkParameterDrift(ctx context.Context, k kubernetes.Interface) {
+	var clusterTags map[string]string
+	if d.options.KubernetesClusterID != "" {
+		clusterTags = map[string]string{ResourceLifecycleTagPrefix + d.options.KubernetesClusterID: ResourceLifecycleOwned}
+	}
+	disks, err := d.cloud.ListDiskParameters(ctx, ProvisionedVolumeTypeTag, clusterTags)
+	if err != nil {
+		klog.ErrorS(err, "Failed to list volumes for the parameter drift check")
+		return
+	}
+
+	for _, disk := range disks {
+		drift := findParameterDrift(disk)
+		if len(drift) == 0 {
+			continue
+		}
+
+		changes := make([]string, 0, len(drift))
+		for _, p := range drift {
+			metrics.Recorder().IncreaseCount(ParameterDriftMetric, map[string]string{"parameter": p.parameter})
+			changes = append(changes, fmt.Sprintf("%s is %s instead of %s", p.parameter, p.actual, p.recorded))
+		}
+		message := fmt.Sprintf("EBS volume %s was modified outside of Kubernetes: %s", disk.VolumeID, strings.Join(changes, ", "))
+		klog.InfoS("Volume parameters drifted from their provisioned values", "volumeID", disk.VolumeID, "drift", changes)
+		if k != nil && d.eventRecorder != nil {
+			d.recordParameterDriftEvent(ctx, k, disk, message)
+		}
+
+		if d.options.HealParameterDrift != HealParameterDriftTags {
+			continue
+		}
+		tags := make(map[string]string, len(drift))
+		for _, p := range drift {
+			tags[p.tag] = p.actual
+		}
+		if err := d.cloud.TagDisk(ctx, disk.VolumeID, tags); err != nil {
+			klog.ErrorS(err, "Failed to heal the provisioned parameter tags of the volume", "volumeID", disk.VolumeID)
+			continue
+		}
+		klog.InfoS("Updated the provisioned parameter tags of the volume to match it", "volumeID", disk.VolumeID, "tags", tags)
+	}
+}
+
+// recordParameterDriftEvent records a warning event on the PVC of the volume
+// Volumes created without --extra-create-metadata do not know their PVC and are only logged
+func (d *ControllerService) recordParameterDriftEvent(ctx context.Context, clientset kubernetes.Interface, disk *cloud.DiskParameters, message string) {
+	name, namespace := disk.Tags[PVCNameTag], disk.Tags[PVCNamespaceTag]
+	if name == "" || namespace == "" {
+		klog.V(4).InfoS("PVC of the volume unknown, skipping parameter drift event", "volumeID", disk.VolumeID)
+		return
+	}
+	pvc, err := clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		klog.ErrorS(err, "Failed to get the PVC of the volume, skipping parameter drift event", "volumeID", disk.VolumeID, "pvc", namespace+"/"+name)
+		return
+	}
+
+	d.eventRecorder.Event(pvc, corev1.EventTypeWarning, ParameterDriftEventReason, message)
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestProvisionedParameterTags(t *testing.T) {
+	testCases := []struct {
+		name       string
+		volumeType string
+		iops       int32
+		throughput int32
+		expected   map[string]string
+	}{
+		{
+			name:     "nothing set",
+			expected: map[string]string{},
+		},
+		{
+			name:       "type only",
+			volumeType: cloud.VolumeTypeGP3,
+			expected:   map[string]string{ProvisionedVolumeTypeTag: cloud.VolumeTypeGP3},
+		},
+		{
+			name:       "type, iops and throughput",
+			volumeType: cloud.VolumeTypeGP3,
+			iops:       4000,
+			throughput: 250,
+			expected: map[string]string{
+				ProvisionedVolumeTypeTag: cloud.VolumeTypeGP3,
+				ProvisionedIOPSTag:       "4000",
+				ProvisionedThroughputTag: "250",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tags := provisionedParameterTags(tc.volumeType, tc.iops, tc.throughput)
+			if !reflect.DeepEqual(tags, tc.expected) {
+				t.Errorf("expected tags %v, got %v", tc.expected, tags)
+			}
+		})
+	}
+}
+
+func TestCheckParameterDrift(t *testing.T) {
+	pvcTags := map[string]string{PVCNameTag: "data", PVCNamespaceTag: "default"}
+	withTags := func(tags ...map[string]string) map[string]string {
+		merged := map[string]string{}
+		for _, t := range tags {
+			for k, v := range t {
+				merged[k] = v
+			}
+		}
+		return merged
+	}
+
+	testCases := []struct {
+		name           string
+		disk           *cloud.DiskParameters
+		heal           string
+		expectedDrift  map[string]float64
+		expectedEvent  bool
+		expectedHealed map[string]string
+	}{
+		{
+			name: "no drift",
+			disk: &cloud.DiskParameters{
+				VolumeID:   "vol-test",
+				VolumeType: cloud.VolumeTypeGP3,
+				IOPS:       4000,
+				Throughput: 250,
+				Tags:       withTags(pvcTags, provisionedParameterTags(cloud.VolumeTypeGP3, 4000, 250)),
+			},
+			heal: HealParameterDriftTags,
+		},
+		{
+			name: "no drift for iops derived from the size",
+			disk: &cloud.DiskParameters{
+				VolumeID:   "vol-test",
+				VolumeType: cloud.VolumeTypeGP2,
+				IOPS:       300,
+				Tags:       withTags(pvcTags, provisionedParameterTags(cloud.VolumeTypeGP2, 0, 0)),
+			},
+		},
+		{
+			name: "drift reported",
+			disk: &cloud.DiskParameters{
+				VolumeID:   "vol-test",
+				VolumeType: cloud.VolumeTypeGP3,
+				IOPS:       3000,
+				Throughput: 125,
+				Tags:       withTags(pvcTags, provisionedParameterTags(cloud.VolumeTypeGP3, 4000, 250)),
+			},
+			expectedDrift: map[string]float64{"iops": 1, "throughput": 1},
+			expectedEvent: true,
+		},
+		{
+			name: "drift reported without pvc",
+			disk: &cloud.DiskParameters{
+				VolumeID:   "vol-test",
+				VolumeType: cloud.VolumeTypeIO2,
+				IOPS:       3000,
+				Tags:       provisionedParameterTags(cloud.VolumeTypeGP3, 4000, 250),
+			},
+			expectedDrift: map[string]float64{"type": 1, "iops": 1},
+		},
+		{
+			name: "drift healed",
+			disk: &cloud.DiskParameters{
+				VolumeID:   "vol-test",
+				VolumeType: cloud.VolumeTypeIO2,
+				IOPS:       3000,
+				Tags:       withTags(pvcTags, provisionedParameterTags(cloud.VolumeTypeGP3, 4000, 250)),
+			},
+			heal:          HealParameterDriftTags,
+			expectedDrift: map[string]float64{"type": 1, "iops": 1},
+			expectedEvent: true,
+			expectedHealed: map[string]string{
+				ProvisionedVolumeTypeTag: cloud.VolumeTypeIO2,
+				ProvisionedIOPSTag:       "3000",
+			},
+		},
+	}
+
+	recorder := metrics.InitializeRecorder()
+	// driftCounts returns the number of drifted volumes recorded in ParameterDriftMetric by parameter
+	driftCounts := func() map[string]float64 {
+		families, err := recorder.Gatherer().Gather()
+		if err != nil {
+			t.Fatalf("failed to gather metrics: %v", err)
+		}
+		counts := map[string]float64{}
+		for _, family := range families {
+			if family.GetName() != ParameterDriftMetric {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				for _, label := range metric.GetLabel() {
+					if label.GetName() == "parameter" {
+						counts[label.GetValue()] += metric.GetCounter().GetValue()
+					}
+				}
+			}
+		}
+		return counts
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+
+			mockCloud := cloud.NewMockCloud(mockCtl)
+			clusterTags := map[string]string{ResourceLifecycleTagPrefix + "cluster": ResourceLifecycleOwned}
+			mockCloud.EXPECT().ListDiskParameters(gomock.Any(), ProvisionedVolumeTypeTag, clusterTags).Return([]*cloud.DiskParameters{tc.disk}, nil)
+			if tc.expectedHealed != nil {
+				mockCloud.EXPECT().TagDisk(gomock.Any(), tc.disk.VolumeID, tc.expectedHealed).Return(nil)
+			}
+
+			clientset := fake.NewSimpleClientset(&corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "default"},
+			})
+
+			recorder := record.NewFakeRecorder(10)
+			driver := &ControllerService{
+				cloud:         mockCloud,
+				options:       &Options{ParameterDriftCheckInterval: 1, HealParameterDrift: tc.heal, KubernetesClusterID: "cluster"},
+				eventRecorder: recorder,
+			}
+
+			before := driftCounts()
+			driver.checkParameterDrift(context.Background(), clientset)
+			after := driftCounts()
+
+			for _, parameter := range []string{"type", "iops", "throughput"} {
+				if after[parameter]-before[parameter] != tc.expectedDrift[parameter] {
+					t.Errorf("expected %v drifted volumes for %q, got %v", tc.expectedDrift[parameter], parameter, after[parameter]-before[parameter])
+				}
+			}
+
+			events := drainEvents(recorder)
+			if tc.expectedEvent {
+				if len(events) != 1 {
+					t.Fatalf("expected 1 event, got %v", events)
+				}
+				if !strings.HasPrefix(events[0], corev1.EventTypeWarning+" "+ParameterDriftEventReason+" ") {
+					t.Errorf("unexpected event: %v", events[0])
+				}
+			} else if len(events) != 0 {
+				t.Errorf("expected no events, got %v", events)
+			}
+		})
+	}
+}
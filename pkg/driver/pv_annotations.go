@@ -0,0 +1,107 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+var (
+	// pvAnnotationTimeout is how long the driver waits for the PV of a created volume to appear to annotate it
+	pvAnnotationTimeout      = 10 * time.Minute
+	pvAnnotationPollInterval = 5 * time.Second
+)
+
+// creationAnnotations returns the annotations recording when the volume was created and its settings at creation
+// IOPS and throughput are only recorded when EC2 returned them, as they are not set for all volume types
+func creationAnnotations(disk *cloud.Disk) map[string]string {
+	annotations := map[string]string{
+		InitialVolumeTypeAnnotation:       disk.VolumeType,
+		InitialEncryptedAnnotation:        strconv.FormatBool(disk.Encrypted),
+		InitialAvailabilityZoneAnnotation: disk.AvailabilityZone,
+	}
+	if !disk.CreationTime.IsZero() {
+		annotations[CreatedAtAnnotation] = disk.CreationTime.UTC().Format(time.RFC3339)
+	}
+	if disk.IOPS > 0 {
+		annotations[InitialIOPSAnnotation] = strconv.Itoa(int(disk.IOPS))
+	}
+	if disk.Throughput > 0 {
+		annotations[InitialThroughputAnnotation] = strconv.Itoa(int(disk.Throughput))
+	}
+	return annotations
+}
+
+// annotatePVInBackground annotates the PV of a volume created by CreateVolume once the external-provisioner creates it,
+// without blocking the CreateVolume call. A single task runs per volume name, as CreateVolume may be retried for it.
+func (d *ControllerService) annotatePVInBackground(pvName string, disk *cloud.Disk) {
+	if _, annotating := d.pvAnnotations.LoadOrStore(pvName, struct{}{}); annotating {
+		return
+	}
+
+	go func() {
+		defer d.pvAnnotations.Delete(pvName)
+		ctx, cancel := context.WithTimeout(context.Background(), pvAnnotationTimeout)
+		defer cancel()
+		if err := d.annotatePV(ctx, pvName, disk); err != nil {
+			klog.V(4).InfoS("PV not annotated with the creation settings of its volume", "pv", pvName, "volumeID", disk.VolumeID, "err", err)
+		}
+	}()
+}
+
+// annotatePV waits for the PV of the volume to appear and patches it with the creationAnnotations of the volume
+func (d *ControllerService) annotatePV(ctx context.Context, pvName string, disk *cloud.Disk) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": creationAnnotations(disk),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return wait.PollUntilContextCancel(ctx, pvAnnotationPollInterval, true, func(ctx context.Context) (bool, error) {
+		pv, err := d.k8sClient.CoreV1().PersistentVolumes().Get(ctx, pvName, metav1.GetOptions{})
+		if err != nil {
+			if !apierrors.IsNotFound(err) {
+				klog.V(4).InfoS("Failed to get PV to annotate, retrying", "pv", pvName, "err", err)
+			}
+			return false, nil
+		}
+		// The name of a volume is only unique within the driver, a PV of another driver is left alone
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != DriverName || pv.Spec.CSI.VolumeHandle != disk.VolumeID {
+			klog.V(4).InfoS("PV does not belong to the created volume, not annotating it", "pv", pvName, "volumeID", disk.VolumeID)
+			return true, nil
+		}
+		if _, err := d.k8sClient.CoreV1().PersistentVolumes().Patch(ctx, pvName, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			klog.V(4).InfoS("Failed to annotate PV, retrying", "pv", pvName, "err", err)
+			return false, nil
+		}
+		klog.V(4).InfoS("Annotated PV with the creation settings of its volume", "pv", pvName, "volumeID", disk.VolumeID)
+		return true, nil
+	})
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var testCreatedDisk = &cloud.Disk{
+	VolumeID:         "vol-test",
+	CapacityGiB:      1,
+	AvailabilityZone: "us-east-1a",
+	VolumeType:       cloud.VolumeTypeGP3,
+	IOPS:             3000,
+	Throughput:       125,
+	Encrypted:        true,
+	CreationTime:     time.Date(2024, 6, 1, 12, 30, 0, 0, time.UTC),
+}
+
+func TestCreationAnnotations(t *testing.T) {
+	testCases := []struct {
+		name     string
+		disk     *cloud.Disk
+		expected map[string]string
+	}{
+		{
+			name: "gp3",
+			disk: testCreatedDisk,
+			expected: map[string]string{
+				CreatedAtAnnotation:               "2024-06-01T12:30:00Z",
+				InitialVolumeTypeAnnotation:       "gp3",
+				InitialIOPSAnnotation:             "3000",
+				InitialThroughputAnnotation:       "125",
+				InitialEncryptedAnnotation:        "true",
+				InitialAvailabilityZoneAnnotation: "us-east-1a",
+			},
+		},
+		{
+			name: "without IOPS, throughput nor creation time",
+			disk: &cloud.Disk{VolumeID: "vol-test", AvailabilityZone: "us-east-1b", VolumeType: cloud.VolumeTypeSC1},
+			expected: map[string]string{
+				InitialVolumeTypeAnnotation:       "sc1",
+				InitialEncryptedAnnotation:        "false",
+				InitialAvailabilityZoneAnnotation: "us-east-1b",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := creationAnnotations(tc.disk); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("creationAnnotations() = %v, expected %v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestAnnotatePV(t *testing.T) {
+	oldPollInterval := pvAnnotationPollInterval
+	pvAnnotationPollInterval = 10 * time.Millisecond
+	defer func() { pvAnnotationPollInterval = oldPollInterval }()
+
+	otherDriverPV := newTestPersistentVolume("pvc-test", "vol-test", "team-a")
+	otherDriverPV.Spec.CSI.Driver = "other.csi.aws.com"
+
+	testCases := []struct {
+		name string
+		// pv is created after the first poll, nil when it never appears
+		pv                  *corev1.PersistentVolume
+		expectedErr         bool
+		expectedAnnotations map[string]string
+	}{
+		{
+			name:                "PV appears later",
+			pv:                  newTestPersistentVolume("pvc-test", "vol-test", "team-a"),
+			expectedAnnotations: creationAnnotations(testCreatedDisk),
+		},
+		{
+			name:        "PV never appears",
+			expectedErr: true,
+		},
+		{
+			name: "PV of another volume",
+			pv:   newTestPersistentVolume("pvc-test", "vol-other", "team-a"),
+		},
+		{
+			name: "PV of another driver",
+			pv:   otherDriverPV,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset()
+			driver := &ControllerService{k8sClient: clientset}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if tc.pv != nil {
+				go func() {
+					time.Sleep(5 * pvAnnotationPollInterval)
+					if _, err := clientset.CoreV1().PersistentVolumes().Create(ctx, tc.pv, metav1.CreateOptions{}); err != nil {
+						t.Errorf("failed to create PV: %v", err)
+					}
+				}()
+			}
+
+			err := driver.annotatePV(ctx, "pvc-test", testCreatedDisk)
+			if tc.expectedErr != (err != nil) {
+				t.Fatalf("annotatePV() error = %v, expected error %v", err, tc.expectedErr)
+			}
+			if tc.pv == nil {
+				return
+			}
+			pv, err := clientset.CoreV1().PersistentVolumes().Get(context.Background(), "pvc-test", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("failed to get PV: %v", err)
+			}
+			if len(tc.expectedAnnotations) == 0 && len(pv.Annotations) != 0 {
+				t.Errorf("expected the PV not to be annotated, got %v", pv.Annotations)
+			} else if len(tc.expectedAnnotations) != 0 && !reflect.DeepEqual(pv.Annotations, tc.expectedAnnotations) {
+				t.Errorf("PV annotations = %v, expected %v", pv.Annotations, tc.expectedAnnotations)
+			}
+		})
+	}
+}
+
+func TestCreateVolumeAnnotatesPV(t *testing.T) {
+	oldPollInterval := pvAnnotationPollInterval
+	pvAnnotationPollInterval = 10 * time.Millisecond
+	defer func() { pvAnnotationPollInterval = oldPollInterval }()
+
+	testCases := []struct {
+		name             string
+		annotatePV       bool
+		expectAnnotation bool
+	}{
+		{
+			name:             "annotate-pv-on-create",
+			annotatePV:       true,
+			expectAnnotation: true,
+		},
+		{
+			name: "disabled",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			awsDriver, mockCtl, mockCloud := createControllerService(t)
+			defer mockCtl.Finish()
+			clientset := fake.NewSimpleClientset()
+			awsDriver.k8sClient = clientset
+			awsDriver.options.AnnotatePVOnCreate = tc.annotatePV
+			mockCloud.EXPECT().CreateDisk(gomock.Any(), "pvc-test", gomock.Any()).Return(testCreatedDisk, nil)
+
+			_, err := awsDriver.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+				Name:          "pvc-test",
+				CapacityRange: &csi.CapacityRange{RequiredBytes: 1 << 30},
+				VolumeCapabilities: []*csi.VolumeCapability{{
+					AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+					AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+				}},
+			})
+			if err != nil {
+				t.Fatalf("CreateVolume() failed: %v", err)
+			}
+
+			// The external-provisioner creates the PV once CreateVolume returns
+			if _, err := clientset.CoreV1().PersistentVolumes().Create(context.Background(), newTestPersistentVolume("pvc-test", "vol-test", "team-a"), metav1.CreateOptions{}); err != nil {
+				t.Fatalf("failed to create PV: %v", err)
+			}
+
+			annotated := func(ctx context.Context) (bool, error) {
+				pv, err := clientset.CoreV1().PersistentVolumes().Get(ctx, "pvc-test", metav1.GetOptions{})
+				if err != nil {
+					return false, err
+				}
+				return pv.Annotations[CreatedAtAnnotation] == "2024-06-01T12:30:00Z", nil
+			}
+			err = wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 500*time.Millisecond, true, annotated)
+			if tc.expectAnnotation && err != nil {
+				t.Fatalf("expected the PV to be annotated: %v", err)
+			}
+			if !tc.expectAnnotation && err == nil {
+				t.Fatal("expected the PV not to be annotated")
+			}
+		})
+	}
+}
@@ -19,7 +19,7 @@ package driver
 import (
 	"context"
 	"fmt"
-
+	"reflect"
 	"sync"
 	"testing"
 	"time"
@@ -81,6 +81,18 @@ func TestVolumeModificationWithCoalescing(t *testing.T) {
 			name:         "timing",
 			testFunction: testResponseReturnTiming,
 		},
+		{
+			name:         "tags only",
+			testFunction: testTagsOnlyModification,
+		},
+		{
+			name:         "volume and tags",
+			testFunction: testMixedModification,
+		},
+		{
+			name:         "conflicting tags",
+			testFunction: testConflictingTagModifications,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -506,3 +518,179 @@ func wrapTimeout(t *testing.T, failMessage string, execFunc func()) {
 	case <-done:
 	}
 }
+
+// testTagsOnlyModification tests that tags are modified without calling ResizeOrModifyDisk when only tags change.
+func testTagsOnlyModification(t *testing.T, executor modifyVolumeExecutor) {
+	volumeID := t.Name()
+
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	mockCloud := cloud.NewMockCloud(mockCtl)
+	mockCloud.EXPECT().ResizeOrModifyDisk(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+	mockCloud.EXPECT().ModifyTags(gomock.Any(), gomock.Eq(volumeID), gomock.Any()).DoAndReturn(func(_ context.Context, volumeID string, tagOptions cloud.ModifyTagsOptions) error {
+		klog.InfoS("ModifyTags called", "volumeID", volumeID, "tagOptions", tagOptions)
+		if !reflect.DeepEqual(tagOptions.TagsToAdd, map[string]string{"billing": "team-a", "env": "prod"}) {
+			t.Errorf("TagsToAdd incorrect: %v", tagOptions.TagsToAdd)
+		}
+		if !reflect.DeepEqual(tagOptions.TagsToDelete, []string{"owner"}) {
+			t.Errorf("TagsToDelete incorrect: %v", tagOptions.TagsToDelete)
+		}
+		return nil
+	})
+
+	options := &Options{
+		ModifyVolumeRequestHandlerTimeout: 2 * time.Second,
+	}
+	awsDriver := ControllerService{
+		cloud:                 mockCloud,
+		inFlight:              internal.NewInFlight(),
+		options:               options,
+		modifyVolumeCoalescer: newModifyVolumeCoalescer(mockCloud, options),
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go wrapTimeout(t, "Modify timed out", func() {
+		err := executor(context.Background(), awsDriver, volumeID, map[string]string{
+			ModificationAddTag + "_1":    "billing=team-a",
+			ModificationDeleteTag + "_1": "owner",
+		})
+		if err != nil {
+			t.Error("Modify returned error")
+		}
+		wg.Done()
+	})
+	go wrapTimeout(t, "Modify timed out", func() {
+		err := executor(context.Background(), awsDriver, volumeID, map[string]string{
+			ModificationAddTag + "_1": "env=prod",
+		})
+		if err != nil {
+			t.Error("Modify returned error")
+		}
+		wg.Done()
+	})
+
+	wg.Wait()
+}
+
+// testMixedModification tests that a volume modification and a tag modification are both executed.
+func testMixedModification(t *testing.T, executor modifyVolumeExecutor) {
+	const NewVolumeType = "gp3"
+	volumeID := t.Name()
+
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	mockCloud := cloud.NewMockCloud(mockCtl)
+	gomock.InOrder(
+		mockCloud.EXPECT().ResizeOrModifyDisk(gomock.Any(), gomock.Eq(volumeID), gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, volumeID string, newSize int64, options *cloud.ModifyDiskOptions) (int64, error) {
+			klog.InfoS("ResizeOrModifyDisk called", "volumeID", volumeID, "newSize", newSize, "options", options)
+			if options.VolumeType != NewVolumeType {
+				t.Errorf("VolumeType incorrect")
+			}
+			return newSize, nil
+		}),
+		mockCloud.EXPECT().ModifyTags(gomock.Any(), gomock.Eq(volumeID), gomock.Eq(cloud.ModifyTagsOptions{TagsToAdd: map[string]string{"billing": "team-a"}})).Return(nil),
+	)
+
+	options := &Options{
+		ModifyVolumeRequestHandlerTimeout: 2 * time.Second,
+	}
+	awsDriver := ControllerService{
+		cloud:                 mockCloud,
+		inFlight:              internal.NewInFlight(),
+		options:               options,
+		modifyVolumeCoalescer: newModifyVolumeCoalescer(mockCloud, options),
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go wrapTimeout(t, "Modify timed out", func() {
+		err := executor(context.Background(), awsDriver, volumeID, map[string]string{
+			ModificationKeyVolumeType: NewVolumeType,
+		})
+		if err != nil {
+			t.Error("Modify returned error")
+		}
+		wg.Done()
+	})
+	go wrapTimeout(t, "Modify timed out", func() {
+		err := executor(context.Background(), awsDriver, volumeID, map[string]string{
+			ModificationAddTag + "_1": "billing=team-a",
+		})
+		if err != nil {
+			t.Error("Modify returned error")
+		}
+		wg.Done()
+	})
+
+	wg.Wait()
+}
+
+// testConflictingTagModifications tests that a request with a tag conflicting with a pending request fails, while
+// the pending request succeeds.
+func testConflictingTagModifications(t *testing.T, executor modifyVolumeExecutor) {
+	volumeID := t.Name()
+
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	var tagsChosen cloud.ModifyTagsOptions
+	mockCloud := cloud.NewMockCloud(mockCtl)
+	mockCloud.EXPECT().ModifyTags(gomock.Any(), gomock.Eq(volumeID), gomock.Any()).DoAndReturn(func(_ context.Context, volumeID string, tagOptions cloud.ModifyTagsOptions) error {
+		klog.InfoS("ModifyTags called", "volumeID", volumeID, "tagOptions", tagOptions)
+		tagsChosen = tagOptions
+		return nil
+	})
+
+	options := &Options{
+		ModifyVolumeRequestHandlerTimeout: 2 * time.Second,
+	}
+	awsDriver := ControllerService{
+		cloud:                 mockCloud,
+		inFlight:              internal.NewInFlight(),
+		options:               options,
+		modifyVolumeCoalescer: newModifyVolumeCoalescer(mockCloud, options),
+	}
+
+	requests := []map[string]string{
+		{ModificationAddTag + "_1": "billing=team-a"},
+		{ModificationAddTag + "_1": "billing=team-b"},
+		{ModificationDeleteTag + "_1": "billing"},
+	}
+	errs := make([]error, len(requests))
+	var wg sync.WaitGroup
+	wg.Add(len(requests))
+	for i, params := range requests {
+		go wrapTimeout(t, "Modify timed out", func() {
+			errs[i] = executor(context.Background(), awsDriver, volumeID, params)
+			wg.Done()
+		})
+	}
+	wg.Wait()
+
+	// Only the first request received by the coalescer succeeds, the others conflict with it
+	succeeded := -1
+	for i, err := range errs {
+		if err != nil {
+			continue
+		}
+		if succeeded != -1 {
+			t.Fatalf("Expected a single request to succeed, requests %d and %d succeeded", succeeded, i)
+		}
+		succeeded = i
+	}
+	if succeeded == -1 {
+		t.Fatal("Expected a request to succeed, all failed")
+	}
+	expected, err := parseModifyVolumeParameters(requests[succeeded])
+	if err != nil {
+		t.Fatalf("parseModifyVolumeParameters() failed: %v", err)
+	}
+	if !reflect.DeepEqual(tagsChosen, expected.modifyTagsOptions) {
+		t.Errorf("Expected the tags of request %d to be modified, got %+v", succeeded, tagsChosen)
+	}
+}
@@ -0,0 +1,238 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/metrics"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+var (
+	// defaultSnapshotCopyTimeout is how long the driver waits for a snapshot to complete and be copied when
+	// CopyCompleteTimeoutKey is not set
+	defaultSnapshotCopyTimeout = 6 * time.Hour
+	snapshotCopyPollInterval   = 30 * time.Second
+	snapshotCopyTagTimeout     = 30 * time.Second
+)
+
+// snapshotCopyParameters are the parameters of a VolumeSnapshotClass that copy its snapshots to other regions
+type snapshotCopyParameters struct {
+	regions      []string
+	timeout      time.Duration
+	deleteCopies bool
+}
+
+// parseSnapshotCopyParameters returns the copy parameters of a CreateSnapshot request, nil when it does not copy the
+// snapshot
+func parseSnapshotCopyParameters(parameters map[string]string) (*snapshotCopyParameters, error) {
+	params := &snapshotCopyParameters{timeout: defaultSnapshotCopyTimeout}
+	var timeoutSet, deleteCopiesSet bool
+	for key, value := range parameters {
+		switch strings.ToLower(key) {
+		case CopyToRegionsKey:
+			for _, region := range strings.Split(value, ",") {
+				region = strings.TrimSpace(region)
+				if region != "" && !slices.Contains(params.regions, region) {
+					params.regions = append(params.regions, region)
+				}
+			}
+			if len(params.regions) == 0 {
+				return nil, fmt.Errorf("%s must list at least one region", key)
+			}
+		case CopyCompleteTimeoutKey:
+			timeout, err := time.ParseDuration(value)
+			if err != nil || timeout <= 0 {
+				return nil, fmt.Errorf("%s must be a positive duration, got %q", key, value)
+			}
+			params.timeout = timeout
+			timeoutSet = true
+		case DeleteCopiesKey:
+			deleteCopies, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be a boolean, got %q", key, value)
+			}
+			params.deleteCopies = deleteCopies
+			deleteCopiesSet = true
+		}
+	}
+
+	if len(params.regions) == 0 {
+		if timeoutSet || deleteCopiesSet {
+			return nil, fmt.Errorf("%s and %s require %s", CopyCompleteTimeoutKey, DeleteCopiesKey, CopyToRegionsKey)
+		}
+		return nil, nil
+	}
+	return params, nil
+}
+
+// copySnapshotInBackground copies a snapshot to the regions of params once it completes, without blocking the
+// CreateSnapshot call, then records whether the copy completed in SnapshotCopyStateTag. Copies already made are found
+// by cloud.SourceSnapshotIDTagKey, so the copy can be started again, by a retried CreateSnapshot call or by
+// resumeSnapshotCopies after a restart of the controller, without copying the snapshot twice.
+func (d *ControllerService) copySnapshotInBackground(snapshotID string, params *snapshotCopyParameters) {
+	if _, copying := d.snapshotCopies.LoadOrStore(snapshotID, struct{}{}); copying {
+		klog.V(4).InfoS("CreateSnapshot: snapshot copy already in progress", "snapshotID", snapshotID)
+		return
+	}
+
+	go func() {
+		defer d.snapshotCopies.Delete(snapshotID)
+		ctx, cancel := context.WithTimeout(context.Background(), params.timeout)
+		defer cancel()
+		state := SnapshotCopyStateCompleted
+		if err := d.copySnapshot(ctx, snapshotID, params.regions); err != nil {
+			klog.ErrorS(err, "Failed to copy snapshot", "snapshotID", snapshotID, "regions", params.regions, "timeout", params.timeout)
+			metrics.Recorder().IncreaseCount(SnapshotCopyFailedMetric, map[string]string{})
+			state = SnapshotCopyStateFailed
+		}
+		d.recordSnapshotCopyState(snapshotID, state)
+	}()
+}
+
+// resumeSnapshotCopies starts again the copies of the snapshots that were still being copied when the controller
+// stopped, which carry SnapshotCopyRegionsTag but no SnapshotCopyStateTag. Each copy is given what remains of its
+// copyCompleteTimeout, counted from the creation of the snapshot.
+func (d *ControllerService) resumeSnapshotCopies(ctx context.Context) {
+	snapshots, err := d.cloud.ListSnapshotsByTag(ctx, SnapshotCopyRegionsTag)
+	if err != nil {
+		klog.ErrorS(err, "Failed to list the snapshots copied to other regions, unfinished copies are not resumed")
+		return
+	}
+
+	for _, snapshot := range snapshots {
+		if snapshot.Tags[SnapshotCopyStateTag] != "" {
+			continue
+		}
+		params, err := parseSnapshotCopyParameters(map[string]string{CopyToRegionsKey: snapshot.Tags[SnapshotCopyRegionsTag]})
+		if err != nil {
+			klog.ErrorS(err, "Invalid copy regions tag, the snapshot copy is not resumed", "snapshotID", snapshot.SnapshotID)
+			continue
+		}
+		if timeout, err := time.ParseDuration(snapshot.Tags[SnapshotCopyTimeoutTag]); err == nil {
+			params.timeout = timeout
+		}
+		params.timeout -= time.Since(snapshot.CreationTime)
+		if params.timeout <= 0 {
+			klog.ErrorS(nil, "Snapshot copy timed out while the controller was stopped", "snapshotID", snapshot.SnapshotID, "regions", params.regions)
+			metrics.Recorder().IncreaseCount(SnapshotCopyFailedMetric, map[string]string{})
+			d.recordSnapshotCopyState(snapshot.SnapshotID, SnapshotCopyStateFailed)
+			continue
+		}
+		klog.InfoS("Resuming snapshot copy", "snapshotID", snapshot.SnapshotID, "regions", params.regions, "timeout", params.timeout)
+		d.copySnapshotInBackground(snapshot.SnapshotID, params)
+	}
+}
+
+// recordSnapshotCopyState tags the snapshot with the state of its copy, failures are logged
+func (d *ControllerService) recordSnapshotCopyState(snapshotID, state string) {
+	ctx, cancel := context.WithTimeout(context.Background(), snapshotCopyTagTimeout)
+	defer cancel()
+	if err := d.cloud.TagSnapshot(ctx, snapshotID, map[string]string{SnapshotCopyStateTag: state}); err != nil {
+		klog.ErrorS(err, "Failed to record the state of the snapshot copy", "snapshotID", snapshotID, "state", state)
+	}
+}
+
+// copySnapshot waits for a snapshot to complete, then copies it to the regions and waits for the copies to complete
+func (d *ControllerService) copySnapshot(ctx context.Context, snapshotID string, regions []string) error {
+	var tags map[string]string
+	completed := map[string]struct{}{}
+
+	err := wait.PollUntilContextCancel(ctx, snapshotCopyPollInterval, true, func(ctx context.Context) (bool, error) {
+		if tags == nil {
+			snapshot, err := d.cloud.GetSnapshotByID(ctx, snapshotID)
+			if err != nil {
+				if errors.Is(err, cloud.ErrNotFound) {
+					return false, fmt.Errorf("snapshot was deleted before it was copied: %w", err)
+				}
+				klog.V(4).InfoS("Failed to get snapshot to copy, retrying", "snapshotID", snapshotID, "err", err)
+				return false, nil
+			}
+			if !snapshot.ReadyToUse {
+				return false, nil
+			}
+			tags = snapshotCopyTags(snapshot.Tags)
+		}
+
+		for _, region := range regions {
+			if _, ok := completed[region]; ok {
+				continue
+			}
+			snapshotCopy, err := d.cloud.CopySnapshotToRegion(ctx, snapshotID, region, tags)
+			if err != nil {
+				klog.ErrorS(err, "Failed to copy snapshot, retrying", "snapshotID", snapshotID, "region", region)
+				continue
+			}
+			if snapshotCopy.ReadyToUse {
+				klog.InfoS("Snapshot copy completed", "snapshotID", snapshotID, "region", region, "copySnapshotID", snapshotCopy.SnapshotID)
+				completed[region] = struct{}{}
+			}
+		}
+		return len(completed) == len(regions), nil
+	})
+	if wait.Interrupted(err) {
+		return fmt.Errorf("timed out waiting for the snapshot to complete and be copied, %d of %d copies completed", len(completed), len(regions))
+	}
+	return err
+}
+
+// snapshotCopyTags returns the tags of the copies of a snapshot, the tags of the snapshot but its name and copy tags
+func snapshotCopyTags(snapshotTags map[string]string) map[string]string {
+	tags := make(map[string]string, len(snapshotTags))
+	for k, v := range snapshotTags {
+		switch k {
+		case cloud.SnapshotNameTagKey, SnapshotCopyRegionsTag, SnapshotDeleteCopiesTag, SnapshotCopyTimeoutTag, SnapshotCopyStateTag:
+		default:
+			tags[k] = v
+		}
+	}
+	return tags
+}
+
+// deleteSnapshotCopies deletes the copies of a snapshot tagged with SnapshotDeleteCopiesTag
+func (d *ControllerService) deleteSnapshotCopies(ctx context.Context, snapshotID string) error {
+	snapshot, err := d.cloud.GetSnapshotByID(ctx, snapshotID)
+	if err != nil {
+		if errors.Is(err, cloud.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if snapshot.Tags[SnapshotDeleteCopiesTag] != "true" {
+		return nil
+	}
+
+	for _, region := range strings.Split(snapshot.Tags[SnapshotCopyRegionsTag], ",") {
+		if region == "" {
+			continue
+		}
+		if err := d.cloud.DeleteSnapshotCopies(ctx, snapshotID, region); err != nil {
+			return err
+		}
+		klog.V(4).InfoS("DeleteSnapshot: deleted snapshot copies", "snapshotID", snapshotID, "region", region)
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud"
+	"google.golang.org/grpc/codes"
+)
+
+func TestParseSnapshotCopyParameters(t *testing.T) {
+	testCases := []struct {
+		name       string
+		parameters map[string]string
+		expected   *snapshotCopyParameters
+		expErr     bool
+	}{
+		{
+			name:       "no copy",
+			parameters: map[string]string{FastSnapshotRestoreAvailabilityZones: "us-east-1a"},
+		},
+		{
+			name:       "defaults",
+			parameters: map[string]string{"copyToRegions": "us-east-1, eu-west-1,us-east-1,"},
+			expected:   &snapshotCopyParameters{regions: []string{"us-east-1", "eu-west-1"}, timeout: defaultSnapshotCopyTimeout},
+		},
+		{
+			name:       "all parameters",
+			parameters: map[string]string{"copyToRegions": "us-east-1", "copyCompleteTimeout": "2h", "deleteCopies": "true"},
+			expected:   &snapshotCopyParameters{regions: []string{"us-east-1"}, timeout: 2 * time.Hour, deleteCopies: true},
+		},
+		{
+			name:       "no region",
+			parameters: map[string]string{"copyToRegions": " , "},
+			expErr:     true,
+		},
+		{
+			name:       "invalid timeout",
+			parameters: map[string]string{"copyToRegions": "us-east-1", "copyCompleteTimeout": "-1h"},
+			expErr:     true,
+		},
+		{
+			name:       "invalid deleteCopies",
+			parameters: map[string]string{"copyToRegions": "us-east-1", "deleteCopies": "sure"},
+			expErr:     true,
+		},
+		{
+			name:       "deleteCopies without regions",
+			parameters: map[string]string{"deleteCopies": "true"},
+			expErr:     true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			params, err := parseSnapshotCopyParameters(tc.parameters)
+			if (err != nil) != tc.expErr {
+				t.Fatalf("Expected error %v, got %v", tc.expErr, err)
+			}
+			if !reflect.DeepEqual(params, tc.expected) {
+				t.Fatalf("Expected %+v, got %+v", tc.expected, params)
+			}
+		})
+	}
+}
+
+func TestCopySnapshot(t *testing.T) {
+	pollInterval := snapshotCopyPollInterval
+	snapshotCopyPollInterval = time.Millisecond
+	defer func() { snapshotCopyPollInterval = pollInterval }()
+
+	sourceTags := map[string]string{
+		cloud.SnapshotNameTagKey: "snapshot-name",
+		SnapshotCopyRegionsTag:   "us-east-1,eu-west-1",
+		"extra":                  "tag",
+	}
+	expectedTags := map[string]string{"extra": "tag"}
+
+	awsDriver, mockCtl, mockCloud := createControllerService(t)
+	defer mockCtl.Finish()
+
+	gomock.InOrder(
+		mockCloud.EXPECT().GetSnapshotByID(gomock.Any(), "snap-test").Return(&cloud.Snapshot{SnapshotID: "snap-test", ReadyToUse: false}, nil),
+		mockCloud.EXPECT().GetSnapshotByID(gomock.Any(), "snap-test").Return(&cloud.Snapshot{SnapshotID: "snap-test", ReadyToUse: true, Tags: sourceTags}, nil),
+	)
+	// The copy of us-east-1 already completed, it is not copied again
+	mockCloud.EXPECT().CopySnapshotToRegion(gomock.Any(), "snap-test", "us-east-1", expectedTags).Return(&cloud.Snapshot{SnapshotID: "snap-east", ReadyToUse: true}, nil)
+	gomock.InOrder(
+		mockCloud.EXPECT().CopySnapshotToRegion(gomock.Any(), "snap-test", "eu-west-1", expectedTags).Return(nil, errors.New("ResourceLimitExceeded")),
+		mockCloud.EXPECT().CopySnapshotToRegion(gomock.Any(), "snap-test", "eu-west-1", expectedTags).Return(&cloud.Snapshot{SnapshotID: "snap-west"}, nil),
+		mockCloud.EXPECT().CopySnapshotToRegion(gomock.Any(), "snap-test", "eu-west-1", expectedTags).Return(&cloud.Snapshot{SnapshotID: "snap-west", ReadyToUse: true}, nil),
+	)
+
+	if err := awsDriver.copySnapshot(context.Background(), "snap-test", []string{"us-east-1", "eu-west-1"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestCopySnapshotTimeout(t *testing.T) {
+	pollInterval := snapshotCopyPollInterval
+	snapshotCopyPollInterval = time.Millisecond
+	defer func() { snapshotCopyPollInterval = pollInterval }()
+
+	awsDriver, mockCtl, mockCloud := createControllerService(t)
+	defer mockCtl.Finish()
+	mockCloud.EXPECT().GetSnapshotByID(gomock.Any(), "snap-test").Return(&cloud.Snapshot{SnapshotID: "snap-test"}, nil).AnyTimes()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := awsDriver.copySnapshot(ctx, "snap-test", []string{"us-east-1"}); err == nil {
+		t.Fatalf("Expected the copy to time out")
+	}
+}
+
+func TestCreateSnapshotCopyToRegions(t *testing.T) {
+	pollInterval := snapshotCopyPollInterval
+	snapshotCopyPollInterval = time.Millisecond
+	defer func() { snapshotCopyPollInterval = pollInterval }()
+
+	req := &csi.CreateSnapshotRequest{
+		Name:           "snapshot-name",
+		SourceVolumeId: "vol-test",
+		Parameters:     map[string]string{"copyToRegions": "us-east-1", "deleteCopies": "true"},
+	}
+	snapshot := &cloud.Snapshot{SnapshotID: "snap-test", SourceVolumeID: "vol-test", CreationTime: time.Now()}
+
+	awsDriver, mockCtl, mockCloud := createControllerService(t)
+	defer mockCtl.Finish()
+
+	copied := make(chan struct{})
+	mockCloud.EXPECT().GetSnapshotByName(gomock.Any(), "snapshot-name").Return(nil, cloud.ErrNotFound)
+	mockCloud.EXPECT().CreateSnapshot(gomock.Any(), "vol-test", gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ string, opts *cloud.SnapshotOptions) (*cloud.Snapshot, error) {
+			if opts.Tags[SnapshotCopyRegionsTag] != "us-east-1" || opts.Tags[SnapshotDeleteCopiesTag] != "true" || opts.Tags[SnapshotCopyTimeoutTag] != "6h0m0s" {
+				t.Errorf("Unexpected snapshot tags %v", opts.Tags)
+			}
+			return snapshot, nil
+		})
+	mockCloud.EXPECT().GetSnapshotByID(gomock.Any(), "snap-test").Return(&cloud.Snapshot{SnapshotID: "snap-test", ReadyToUse: true}, nil)
+	mockCloud.EXPECT().CopySnapshotToRegion(gomock.Any(), "snap-test", "us-east-1", gomock.Any()).DoAndReturn(
+		func(context.Context, string, string, map[string]string) (*cloud.Snapshot, error) {
+			<-copied
+			return &cloud.Snapshot{SnapshotID: "snap-copy", ReadyToUse: true}, nil
+		})
+	mockCloud.EXPECT().TagSnapshot(gomock.Any(), "snap-test", map[string]string{SnapshotCopyStateTag: SnapshotCopyStateCompleted}).Return(nil)
+
+	resp, err := awsDriver.CreateSnapshot(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resp.GetSnapshot().GetReadyToUse() {
+		t.Fatalf("Expected the snapshot not to be ready")
+	}
+
+	// CreateSnapshot is called again while the snapshot is being copied, it is not copied twice
+	mockCloud.EXPECT().GetSnapshotByName(gomock.Any(), "snapshot-name").Return(snapshot, nil)
+	if _, err := awsDriver.CreateSnapshot(context.Background(), req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	close(copied)
+	for i := 0; ; i++ {
+		if _, copying := awsDriver.snapshotCopies.Load("snap-test"); !copying {
+			break
+		}
+		if i > 1000 {
+			t.Fatalf("Snapshot copy did not finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestResumeSnapshotCopies(t *testing.T) {
+	pollInterval := snapshotCopyPollInterval
+	snapshotCopyPollInterval = time.Millisecond
+	defer func() { snapshotCopyPollInterval = pollInterval }()
+
+	now := time.Now()
+	snapshots := []*cloud.Snapshot{
+		{SnapshotID: "snap-copying", CreationTime: now.Add(-time.Hour), Tags: map[string]string{SnapshotCopyRegionsTag: "us-east-1", SnapshotCopyTimeoutTag: "2h"}},
+		{SnapshotID: "snap-expired", CreationTime: now.Add(-7 * time.Hour), Tags: map[string]string{SnapshotCopyRegionsTag: "us-east-1"}},
+		{SnapshotID: "snap-completed", CreationTime: now.Add(-time.Hour), Tags: map[string]string{SnapshotCopyRegionsTag: "us-east-1", SnapshotCopyStateTag: SnapshotCopyStateCompleted}},
+		{SnapshotID: "snap-failed", CreationTime: now.Add(-time.Hour), Tags: map[string]string{SnapshotCopyRegionsTag: "us-east-1", SnapshotCopyStateTag: SnapshotCopyStateFailed}},
+	}
+
+	awsDriver, mockCtl, mockCloud := createControllerService(t)
+	defer mockCtl.Finish()
+
+	mockCloud.EXPECT().ListSnapshotsByTag(gomock.Any(), SnapshotCopyRegionsTag).Return(snapshots, nil)
+	// The copy that timed out while the controller was stopped is only reported
+	mockCloud.EXPECT().TagSnapshot(gomock.Any(), "snap-expired", map[string]string{SnapshotCopyStateTag: SnapshotCopyStateFailed}).Return(nil)
+	// The unfinished copy is resumed
+	mockCloud.EXPECT().GetSnapshotByID(gomock.Any(), "snap-copying").Return(&cloud.Snapshot{SnapshotID: "snap-copying", ReadyToUse: true}, nil)
+	mockCloud.EXPECT().CopySnapshotToRegion(gomock.Any(), "snap-copying", "us-east-1", gomock.Any()).Return(&cloud.Snapshot{SnapshotID: "snap-copy", ReadyToUse: true}, nil)
+	mockCloud.EXPECT().TagSnapshot(gomock.Any(), "snap-copying", map[string]string{SnapshotCopyStateTag: SnapshotCopyStateCompleted}).Return(nil)
+
+	awsDriver.resumeSnapshotCopies(context.Background())
+	for i := 0; ; i++ {
+		if _, copying := awsDriver.snapshotCopies.Load("snap-copying"); !copying {
+			break
+		}
+		if i > 1000 {
+			t.Fatalf("Snapshot copy did not finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDeleteSnapshotCopies(t *testing.T) {
+	testCases := []struct {
+		name         string
+		tags         map[string]string
+		deleteErr    error
+		expectedCode codes.Code
+	}{
+		{
+			name: "delete copies",
+			tags: map[string]string{SnapshotCopyRegionsTag: "us-east-1,eu-west-1", SnapshotDeleteCopiesTag: "true"},
+		},
+		{
+			name: "keep copies",
+			tags: map[string]string{SnapshotCopyRegionsTag: "us-east-1,eu-west-1"},
+		},
+		{
+			name:         "failure blocks the deletion",
+			tags:         map[string]string{SnapshotCopyRegionsTag: "us-east-1,eu-west-1", SnapshotDeleteCopiesTag: "true"},
+			deleteErr:    errors.New("UnauthorizedOperation"),
+			expectedCode: codes.Internal,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			awsDriver, mockCtl, mockCloud := createControllerService(t)
+			defer mockCtl.Finish()
+
+			mockCloud.EXPECT().GetSnapshotByID(gomock.Any(), "snap-test").Return(&cloud.Snapshot{SnapshotID: "snap-test", Tags: tc.tags}, nil)
+			if tc.tags[SnapshotDeleteCopiesTag] == "true" {
+				if tc.deleteErr != nil {
+					mockCloud.EXPECT().DeleteSnapshotCopies(gomock.Any(), "snap-test", "us-east-1").Return(tc.deleteErr)
+				} else {
+					mockCloud.EXPECT().DeleteSnapshotCopies(gomock.Any(), "snap-test", "us-east-1").Return(nil)
+					mockCloud.EXPECT().DeleteSnapshotCopies(gomock.Any(), "snap-test", "eu-west-1").Return(nil)
+				}
+			}
+			if tc.expectedCode == codes.OK {
+				mockCloud.EXPECT().DeleteSnapshot(gomock.Any(), "snap-test").Return(true, nil)
+			}
+
+			_, err := awsDriver.DeleteSnapshot(context.Background(), &csi.DeleteSnapshotRequest{SnapshotId: "snap-test"})
+			if tc.expectedCode == codes.OK {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+			checkExpectedErrorCode(t, err, tc.expectedCode)
+		})
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/util/template"
+	"k8s.io/klog/v2"
+)
+
+// snapshotOnDeleteName is the name of the final snapshot of a volume tagged with SnapshotOnDeleteTag
+func snapshotOnDeleteName(volumeID string) string {
+	return "snapshot-on-delete-" + volumeID
+}
+
+// snapshotOnDelete takes a final snapshot of the volume when it is tagged with SnapshotOnDeleteTag, so that it can be
+// deleted. The snapshot is looked up by name first, so that a retried deletion does not snapshot the volume twice.
+// It returns once the snapshot is cut, without waiting for it to complete. cloud.ErrNotFound is returned when the
+// volume does not exist.
+func (d *ControllerService) snapshotOnDelete(ctx context.Context, volumeID string) error {
+	disk, err := d.cloud.GetDiskByID(ctx, volumeID)
+	if err != nil {
+		return err
+	}
+	if disk.Tags[SnapshotOnDeleteTag] != "true" {
+		return nil
+	}
+
+	snapshotName := snapshotOnDeleteName(volumeID)
+	snapshot, err := d.cloud.GetSnapshotByName(ctx, snapshotName)
+	if err != nil && !errors.Is(err, cloud.ErrNotFound) {
+		return fmt.Errorf("could not look up snapshot %q: %w", snapshotName, err)
+	}
+	if snapshot != nil {
+		if snapshot.SourceVolumeID != volumeID {
+			return fmt.Errorf("snapshot %q already exists for different volume (%s)", snapshotName, snapshot.SourceVolumeID)
+		}
+		klog.V(4).InfoS("DeleteVolume: final snapshot already exists", "volumeID", volumeID, "snapshotID", snapshot.SnapshotID)
+		return nil
+	}
+
+	tags := map[string]string{
+		cloud.SnapshotNameTagKey: snapshotName,
+		CreatedByTag:             CreatedByPreDelete,
+		VolumeDeletionTimeTag:    time.Now().UTC().Format(time.RFC3339),
+	}
+	// The PVC of the volume is only known from the tags the driver added when creating it
+	extraTags, err := d.renderExtraTags(template.ExtraTagProps{PVProps: template.PVProps{
+		PVCName:      disk.Tags[PVCNameTag],
+		PVCNamespace: disk.Tags[PVCNamespaceTag],
+		PVName:       disk.Tags[PVNameTag],
+	}})
+	if err != nil {
+		return err
+	}
+	for k, v := range extraTags {
+		tags[k] = v
+	}
+	snapshot, err = d.cloud.CreateSnapshot(ctx, volumeID, &cloud.SnapshotOptions{
+		Tags:        tags,
+		Description: "Final snapshot of volume " + volumeID + " taken by AWS EBS CSI driver before deleting it",
+	})
+	if err != nil {
+		return fmt.Errorf("could not create snapshot %q: %w", snapshotName, err)
+	}
+	klog.InfoS("DeleteVolume: created final snapshot", "volumeID", volumeID, "snapshotID", snapshot.SnapshotID)
+	return nil
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud"
+	"google.golang.org/grpc/codes"
+)
+
+func TestDeleteVolumeSnapshotOnDelete(t *testing.T) {
+	const volumeID = "vol-test"
+	snapshotName := snapshotOnDeleteName(volumeID)
+	taggedDisk := &cloud.Disk{VolumeID: volumeID, Tags: map[string]string{SnapshotOnDeleteTag: "true"}}
+
+	expectFinalSnapshot := func(t *testing.T, mockCloud *cloud.MockCloud, err error) *gomock.Call {
+		t.Helper()
+		return mockCloud.EXPECT().CreateSnapshot(gomock.Any(), volumeID, gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ string, opts *cloud.SnapshotOptions) (*cloud.Snapshot, error) {
+				if opts.Tags[cloud.SnapshotNameTagKey] != snapshotName || opts.Tags[CreatedByTag] != CreatedByPreDelete || opts.Tags["extra"] != "tag" {
+					t.Errorf("Unexpected snapshot tags %v", opts.Tags)
+				}
+				if _, err := time.Parse(time.RFC3339, opts.Tags[VolumeDeletionTimeTag]); err != nil {
+					t.Errorf("Unexpected deletion time tag %q: %v", opts.Tags[VolumeDeletionTimeTag], err)
+				}
+				if err != nil {
+					return nil, err
+				}
+				return &cloud.Snapshot{SnapshotID: "snap-test", SourceVolumeID: volumeID}, nil
+			})
+	}
+
+	testCases := []struct {
+		name         string
+		disabled     bool
+		setup        func(t *testing.T, mockCloud *cloud.MockCloud)
+		expectedCode codes.Code
+	}{
+		{
+			name: "snapshot before delete",
+			setup: func(t *testing.T, mockCloud *cloud.MockCloud) {
+				gomock.InOrder(
+					mockCloud.EXPECT().GetDiskByID(gomock.Any(), volumeID).Return(taggedDisk, nil),
+					mockCloud.EXPECT().GetSnapshotByName(gomock.Any(), snapshotName).Return(nil, cloud.ErrNotFound),
+					expectFinalSnapshot(t, mockCloud, nil),
+					mockCloud.EXPECT().DeleteDisk(gomock.Any(), volumeID).Return(true, nil),
+				)
+			},
+		},
+		{
+			name: "retry after the snapshot was created",
+			setup: func(t *testing.T, mockCloud *cloud.MockCloud) {
+				mockCloud.EXPECT().GetDiskByID(gomock.Any(), volumeID).Return(taggedDisk, nil)
+				mockCloud.EXPECT().GetSnapshotByName(gomock.Any(), snapshotName).Return(&cloud.Snapshot{SnapshotID: "snap-test", SourceVolumeID: volumeID}, nil)
+				mockCloud.EXPECT().DeleteDisk(gomock.Any(), volumeID).Return(true, nil)
+			},
+		},
+		{
+			name: "snapshot failure blocks the deletion",
+			setup: func(t *testing.T, mockCloud *cloud.MockCloud) {
+				mockCloud.EXPECT().GetDiskByID(gomock.Any(), volumeID).Return(taggedDisk, nil)
+				mockCloud.EXPECT().GetSnapshotByName(gomock.Any(), snapshotName).Return(nil, cloud.ErrNotFound)
+				expectFinalSnapshot(t, mockCloud, errors.New("SnapshotCreationPerVolumeRateExceeded"))
+			},
+			expectedCode: codes.Internal,
+		},
+		{
+			name: "snapshot lookup failure blocks the deletion",
+			setup: func(t *testing.T, mockCloud *cloud.MockCloud) {
+				mockCloud.EXPECT().GetDiskByID(gomock.Any(), volumeID).Return(taggedDisk, nil)
+				mockCloud.EXPECT().GetSnapshotByName(gomock.Any(), snapshotName).Return(nil, errors.New("RequestLimitExceeded"))
+			},
+			expectedCode: codes.Internal,
+		},
+		{
+			name: "volume not tagged",
+			setup: func(t *testing.T, mockCloud *cloud.MockCloud) {
+				mockCloud.EXPECT().GetDiskByID(gomock.Any(), volumeID).Return(&cloud.Disk{VolumeID: volumeID}, nil)
+				mockCloud.EXPECT().DeleteDisk(gomock.Any(), volumeID).Return(true, nil)
+			},
+		},
+		{
+			name: "volume not found",
+			setup: func(t *testing.T, mockCloud *cloud.MockCloud) {
+				mockCloud.EXPECT().GetDiskByID(gomock.Any(), volumeID).Return(nil, cloud.ErrNotFound)
+			},
+		},
+		{
+			name:     "disabled",
+			disabled: true,
+			setup: func(t *testing.T, mockCloud *cloud.MockCloud) {
+				mockCloud.EXPECT().DeleteDisk(gomock.Any(), volumeID).Return(true, nil)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			awsDriver, mockCtl, mockCloud := createControllerService(t)
+			defer mockCtl.Finish()
+			awsDriver.options.EnableSnapshotOnDelete = !tc.disabled
+			awsDriver.options.ExtraTags = map[string]string{"extra": "tag"}
+			tc.setup(t, mockCloud)
+
+			_, err := awsDriver.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: volumeID})
+			if tc.expectedCode == codes.OK {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+			checkExpectedErrorCode(t, err, tc.expectedCode)
+		})
+	}
+}
+
+func TestCreateVolumeSnapshotOnDelete(t *testing.T) {
+	newRequest := func(value string) *csi.CreateVolumeRequest {
+		return &csi.CreateVolumeRequest{
+			Name:          "vol-name",
+			CapacityRange: &csi.CapacityRange{RequiredBytes: 1 << 30},
+			VolumeCapabilities: []*csi.VolumeCapability{{
+				AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+				AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+			}},
+			Parameters: map[string]string{"snapshotOnDelete": value},
+		}
+	}
+
+	t.Run("tagged", func(t *testing.T) {
+		awsDriver, mockCtl, mockCloud := createControllerService(t)
+		defer mockCtl.Finish()
+		awsDriver.options.EnableSnapshotOnDelete = true
+		mockCloud.EXPECT().CreateDisk(gomock.Any(), "vol-name", gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ string, opts *cloud.DiskOptions) (*cloud.Disk, error) {
+				if opts.Tags[SnapshotOnDeleteTag] != "true" {
+					t.Errorf("Expected volume to be tagged with %s, got %v", SnapshotOnDeleteTag, opts.Tags)
+				}
+				return &cloud.Disk{VolumeID: "vol-test", CapacityGiB: 1, AvailabilityZone: "us-west-2a"}, nil
+			})
+
+		if _, err := awsDriver.CreateVolume(context.Background(), newRequest("true")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	})
+
+	t.Run("not tagged when false", func(t *testing.T) {
+		awsDriver, mockCtl, mockCloud := createControllerService(t)
+		defer mockCtl.Finish()
+		mockCloud.EXPECT().CreateDisk(gomock.Any(), "vol-name", gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ string, opts *cloud.DiskOptions) (*cloud.Disk, error) {
+				if _, ok := opts.Tags[SnapshotOnDeleteTag]; ok {
+					t.Errorf("Expected volume not to be tagged with %s, got %v", SnapshotOnDeleteTag, opts.Tags)
+				}
+				return &cloud.Disk{VolumeID: "vol-test", CapacityGiB: 1, AvailabilityZone: "us-west-2a"}, nil
+			})
+
+		if _, err := awsDriver.CreateVolume(context.Background(), newRequest("false")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		awsDriver, mockCtl, _ := createControllerService(t)
+		defer mockCtl.Finish()
+
+		_, err := awsDriver.CreateVolume(context.Background(), newRequest("true"))
+		checkExpectedErrorCode(t, err, codes.InvalidArgument)
+	})
+
+	t.Run("invalid value", func(t *testing.T) {
+		awsDriver, mockCtl, _ := createControllerService(t)
+		defer mockCtl.Finish()
+		awsDriver.options.EnableSnapshotOnDelete = true
+
+		_, err := awsDriver.CreateVolume(context.Background(), newRequest("yes please"))
+		checkExpectedErrorCode(t, err, codes.InvalidArgument)
+	})
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+	"k8s.io/klog/v2"
+)
+
+// TagManager holds the extra tags attached to each dynamically provisioned resource: those of --extra-tags and, when
+// --extra-tags-file is set, those of the file, which are reloaded whenever it changes without restarting the driver
+type TagManager struct {
+	options *Options
+	tags    atomic.Pointer[map[string]string]
+}
+
+// NewTagManager returns a TagManager serving the tags of --extra-tags until Reload is called
+func NewTagManager(o *Options) *TagManager {
+	m := &TagManager{options: o}
+	tags := maps.Clone(o.ExtraTags)
+	m.tags.Store(&tags)
+	return m
+}
+
+// Tags returns the current extra tags, which must not be modified
+func (m *TagManager) Tags() map[string]string {
+	return *m.tags.Load()
+}
+
+// Reload reads --extra-tags-file and swaps in its tags, added to those of --extra-tags
+// Tags that fail the validation of --extra-tags are rejected and the current tags are kept
+func (m *TagManager) Reload() error {
+	tags, err := extraTagsWithFile(m.options)
+	if err != nil {
+		return err
+	}
+	if old := m.tags.Swap(&tags); !maps.Equal(*old, tags) {
+		klog.InfoS("Reloaded extra tags", "path", m.options.ExtraTagsFile, "tags", tags)
+	}
+	return nil
+}
+
+// Watch reloads the tags in the background whenever --extra-tags-file changes, until ctx is done
+func (m *TagManager) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create extra tags file watcher: %w", err)
+	}
+	// The directory is watched rather than the file so that replacing the file, as when a ConfigMap is updated, is seen
+	dir := filepath.Dir(m.options.ExtraTagsFile)
+	if err = watcher.Add(dir); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch extra tags file directory %q: %w", dir, err)
+	}
+
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Has(fsnotify.Chmod) {
+					continue
+				}
+				if err := m.Reload(); err != nil {
+					klog.ErrorS(err, "Failed to reload extra tags, keeping the current tags", "path", m.options.ExtraTagsFile)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				klog.ErrorS(err, "Extra tags file watcher failed", "path", m.options.ExtraTagsFile)
+			}
+		}
+	}()
+	return nil
+}
+
+// extraTagsWithFile returns the tags of --extra-tags with those of --extra-tags-file added, validated like --extra-tags
+func extraTagsWithFile(options *Options) (map[string]string, error) {
+	fileTags, err := readExtraTagsFile(options.ExtraTagsFile)
+	if err != nil {
+		return nil, err
+	}
+	tags := maps.Clone(options.ExtraTags)
+	if tags == nil {
+		tags = make(map[string]string, len(fileTags))
+	}
+	maps.Copy(tags, fileTags)
+
+	merged := *options
+	merged.ExtraTags = tags
+	if err = validateExtraTagsForOptions(&merged); err != nil {
+		return nil, fmt.Errorf("invalid tags in extra tags file %q: %w", options.ExtraTagsFile, err)
+	}
+	return tags, nil
+}
+
+// readExtraTagsFile reads a JSON object of tag keys and values, such as {"team": "storage"}
+func readExtraTagsFile(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read extra tags file: %w", err)
+	}
+	tags := map[string]string{}
+	if len(bytes.TrimSpace(content)) == 0 {
+		return tags, nil
+	}
+	if err = json.Unmarshal(content, &tags); err != nil {
+		return nil, fmt.Errorf("failed to parse extra tags file %q: %w", path, err)
+	}
+	return tags, nil
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeExtraTagsFile(t *testing.T, path, content string) {
+	t.Helper()
+	// The file is replaced rather than rewritten so that readers never see a partial file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write extra tags file: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatalf("failed to replace extra tags file: %v", err)
+	}
+}
+
+func TestTagManagerReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "extra-tags.json")
+	m := NewTagManager(&Options{
+		ExtraTags:     map[string]string{"team": "storage", "env": "dev"},
+		ExtraTagsFile: path,
+	})
+	if tags := m.Tags(); !maps.Equal(tags, map[string]string{"team": "storage", "env": "dev"}) {
+		t.Fatalf("unexpected tags before reload: %v", tags)
+	}
+
+	testCases := []struct {
+		name        string
+		content     string
+		expected    map[string]string
+		expectError bool
+	}{
+		{
+			name:     "file tags added and overriding --extra-tags",
+			content:  `{"env": "prod", "cost-center": "1234"}`,
+			expected: map[string]string{"team": "storage", "env": "prod", "cost-center": "1234"},
+		},
+		{
+			name:     "removed file tag is dropped",
+			content:  `{"env": "prod"}`,
+			expected: map[string]string{"team": "storage", "env": "prod"},
+		},
+		{
+			name:     "empty file",
+			content:  "",
+			expected: map[string]string{"team": "storage", "env": "dev"},
+		},
+		{
+			name:        "malformed JSON keeps current tags",
+			content:     `{"env": "prod"`,
+			expected:    map[string]string{"team": "storage", "env": "dev"},
+			expectError: true,
+		},
+		{
+			name:        "invalid tag keeps current tags",
+			content:     `{"aws:reserved": "value"}`,
+			expected:    map[string]string{"team": "storage", "env": "dev"},
+			expectError: true,
+		},
+		{
+			name:        "reserved tag keeps current tags",
+			content:     `{"` + PVCNameTag + `": "value"}`,
+			expected:    map[string]string{"team": "storage", "env": "dev"},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			writeExtraTagsFile(t, path, tc.content)
+			err := m.Reload()
+			if (err != nil) != tc.expectError {
+				t.Fatalf("Reload() error = %v, wantErr %v", err, tc.expectError)
+			}
+			if tags := m.Tags(); !maps.Equal(tags, tc.expected) {
+				t.Fatalf("unexpected tags: got %v, want %v", tags, tc.expected)
+			}
+		})
+	}
+}
+
+func TestTagManagerReloadMissingFile(t *testing.T) {
+	m := NewTagManager(&Options{
+		ExtraTags:     map[string]string{"team": "storage"},
+		ExtraTagsFile: filepath.Join(t.TempDir(), "missing.json"),
+	})
+	if err := m.Reload(); err == nil {
+		t.Fatal("expected error reloading a missing file")
+	}
+	if tags := m.Tags(); !maps.Equal(tags, map[string]string{"team": "storage"}) {
+		t.Fatalf("unexpected tags: %v", tags)
+	}
+}
+
+func TestTagManagerWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "extra-tags.json")
+	writeExtraTagsFile(t, path, `{"env": "dev"}`)
+	m := NewTagManager(&Options{ExtraTagsFile: path})
+	if err := m.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := m.Watch(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	writeExtraTagsFile(t, path, `{"env": "prod"}`)
+	expected := map[string]string{"env": "prod"}
+	deadline := time.Now().Add(5 * time.Second)
+	for !maps.Equal(m.Tags(), expected) {
+		if time.Now().After(deadline) {
+			t.Fatalf("tags not reloaded: got %v, want %v", m.Tags(), expected)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTagManagerConcurrentAccess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "extra-tags.json")
+	writeExtraTagsFile(t, path, `{"env": "dev"}`)
+	m := NewTagManager(&Options{ExtraTags: map[string]string{"team": "storage"}, ExtraTagsFile: path})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tags := m.Tags()
+				// Readers always see a complete set of tags
+				if tags["team"] != "storage" {
+					t.Errorf("unexpected tags: %v", tags)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		if err := m.Reload(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	wg.Wait()
+}
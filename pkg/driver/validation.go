@@ -20,6 +20,7 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud"
@@ -27,9 +28,18 @@ import (
 )
 
 func ValidateDriverOptions(options *Options) error {
-	if err := validateExtraTags(options.ExtraTags, false); err != nil {
+	if err := validateExtraTagsForOptions(options); err != nil {
 		return fmt.Errorf("Invalid extra tags: %w", err)
 	}
+	if options.ExtraTagsFile != "" {
+		if _, err := extraTagsWithFile(options); err != nil {
+			return fmt.Errorf("Invalid extra tags file: %w", err)
+		}
+	}
+
+	if err := validateKmsKeyByVolumeType(options.KmsKeyByVolumeType); err != nil {
+		return fmt.Errorf("Invalid KMS key by volume type: %w", err)
+	}
 
 	if err := validateMode(options.Mode); err != nil {
 		return fmt.Errorf("Invalid mode: %w", err)
@@ -47,54 +57,139 @@ var (
 	awsTagValidRegex = regexp.MustCompile(`[a-zA-Z0-9_.:=+\-@]*`)
 )
 
+// validateExtraTags fails when tags are not valid, or with warnOnly removes the invalid tags from tags
 func validateExtraTags(tags map[string]string, warnOnly bool) error {
-	if len(tags) > cloud.MaxNumTagsPerResource {
-		return fmt.Errorf("Too many tags (actual: %d, limit: %d)", len(tags), cloud.MaxNumTagsPerResource)
-	}
-
-	validate := func(k, v string) error {
-		if len(k) > cloud.MaxTagKeyLength {
-			return fmt.Errorf("Tag key too long (actual: %d, limit: %d)", len(k), cloud.MaxTagKeyLength)
-		} else if len(k) < cloud.MinTagKeyLength {
-			return fmt.Errorf("Tag key cannot be empty (min: 1)")
-		}
-		if len(v) > cloud.MaxTagValueLength {
-			return fmt.Errorf("Tag value too long (actual: %d, limit: %d)", len(v), cloud.MaxTagValueLength)
-		}
-		if k == cloud.VolumeNameTagKey {
-			return fmt.Errorf("Tag key '%s' is reserved", cloud.VolumeNameTagKey)
-		}
-		if k == cloud.AwsEbsDriverTagKey {
-			return fmt.Errorf("Tag key '%s' is reserved", cloud.AwsEbsDriverTagKey)
-		}
-		if k == cloud.SnapshotNameTagKey {
-			return fmt.Errorf("Tag key '%s' is reserved", cloud.SnapshotNameTagKey)
-		}
-		if strings.HasPrefix(k, cloud.KubernetesTagKeyPrefix) {
-			return fmt.Errorf("Tag key prefix '%s' is reserved", cloud.KubernetesTagKeyPrefix)
-		}
-		if strings.HasPrefix(k, cloud.AWSTagKeyPrefix) {
-			return fmt.Errorf("Tag key prefix '%s' is reserved", cloud.AWSTagKeyPrefix)
-		}
-		if !awsTagValidRegex.MatchString(k) {
-			return fmt.Errorf("Tag key '%s' is not a valid AWS tag key", k)
-		}
-		if !awsTagValidRegex.MatchString(v) {
-			return fmt.Errorf("Tag value '%s' is not a valid AWS tag value", v)
-		}
-		return nil
-	}
-
 	for k, v := range tags {
-		err := validate(k, v)
+		err := validateTag(k, v)
 		if err != nil {
 			if warnOnly {
 				klog.InfoS("Skipping tag: the following key-value pair is not valid", "key", k, "value", v, "err", err)
+				delete(tags, k)
 			} else {
 				return err
 			}
 		}
 	}
+
+	if len(tags) > cloud.MaxNumTagsPerResource {
+		return fmt.Errorf("Too many tags (actual: %d, limit: %d)", len(tags), cloud.MaxNumTagsPerResource)
+	}
+	return nil
+}
+
+func validateTag(k, v string) error {
+	if len(k) > cloud.MaxTagKeyLength {
+		return fmt.Errorf("Tag key too long (actual: %d, limit: %d)", len(k), cloud.MaxTagKeyLength)
+	} else if len(k) < cloud.MinTagKeyLength {
+		return fmt.Errorf("Tag key cannot be empty (min: 1)")
+	}
+	if len(v) > cloud.MaxTagValueLength {
+		return fmt.Errorf("Tag value too long (actual: %d, limit: %d)", len(v), cloud.MaxTagValueLength)
+	}
+	if k == cloud.VolumeNameTagKey {
+		return fmt.Errorf("Tag key '%s' is reserved", cloud.VolumeNameTagKey)
+	}
+	if k == cloud.AwsEbsDriverTagKey {
+		return fmt.Errorf("Tag key '%s' is reserved", cloud.AwsEbsDriverTagKey)
+	}
+	if k == cloud.SnapshotNameTagKey {
+		return fmt.Errorf("Tag key '%s' is reserved", cloud.SnapshotNameTagKey)
+	}
+	if strings.HasPrefix(k, cloud.KubernetesTagKeyPrefix) {
+		return fmt.Errorf("Tag key prefix '%s' is reserved", cloud.KubernetesTagKeyPrefix)
+	}
+	if strings.HasPrefix(k, cloud.AWSTagKeyPrefix) {
+		return fmt.Errorf("Tag key prefix '%s' is reserved", cloud.AWSTagKeyPrefix)
+	}
+	if !awsTagValidRegex.MatchString(k) {
+		return fmt.Errorf("Tag key '%s' is not a valid AWS tag key", k)
+	}
+	if !awsTagValidRegex.MatchString(v) {
+		return fmt.Errorf("Tag value '%s' is not a valid AWS tag value", v)
+	}
+	return nil
+}
+
+// validateExtraTagsForOptions validates --extra-tags against the tags the driver adds automatically with options.
+// All violations are returned, so that they can be fixed at once: invalid tags, keys of automatic tags, and more
+// tags than fit in a resource once the automatic tags and --extra-tags-headroom are counted. With --warn-on-invalid-tag,
+// invalid tags are removed from the extra tags of options instead.
+func validateExtraTagsForOptions(options *Options) error {
+	var errs []error
+	reserved := map[string]bool{}
+	for _, k := range automaticVolumeTagKeys(options) {
+		reserved[k] = true
+	}
+	for _, k := range automaticSnapshotTagKeys(options) {
+		reserved[k] = true
+	}
+
+	keys := make([]string, 0, len(options.ExtraTags))
+	for k := range options.ExtraTags {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		if err := validateTag(k, options.ExtraTags[k]); err != nil {
+			if options.WarnOnInvalidTag {
+				klog.InfoS("Skipping extra tag: the following key-value pair is not valid", "key", k, "value", options.ExtraTags[k], "err", err)
+				delete(options.ExtraTags, k)
+				continue
+			}
+			errs = append(errs, err)
+		} else if reserved[k] {
+			errs = append(errs, fmt.Errorf("Tag key '%s' is reserved", k))
+		}
+	}
+
+	automatic := max(len(automaticVolumeTagKeys(options)), len(automaticSnapshotTagKeys(options)))
+	if total := len(options.ExtraTags) + automatic + options.ExtraTagsHeadroom; total > cloud.MaxNumTagsPerResource {
+		errs = append(errs, fmt.Errorf("Too many tags (extra: %d, automatic: %d, headroom: %d, limit: %d)", len(options.ExtraTags), automatic, options.ExtraTagsHeadroom, cloud.MaxNumTagsPerResource))
+	}
+	return errors.Join(errs...)
+}
+
+// validateTagLimit fails when tags, merged from the automatic, extra and class tags of a request, do not fit in a resource.
+func validateTagLimit(tags map[string]string) error {
+	if len(tags) > cloud.MaxNumTagsPerResource {
+		return fmt.Errorf("Too many tags once the class tags are added (actual: %d, limit: %d)", len(tags), cloud.MaxNumTagsPerResource)
+	}
+	return nil
+}
+
+// automaticVolumeTagKeys returns the keys of the tags the driver may add to the volumes it creates with options.
+func automaticVolumeTagKeys(options *Options) []string {
+	keys := []string{cloud.VolumeNameTagKey, cloud.AwsEbsDriverTagKey, PVCNameTag, PVCNamespaceTag, PVNameTag}
+	if options.KubernetesClusterID != "" {
+		keys = append(keys, ResourceLifecycleTagPrefix+options.KubernetesClusterID, NameTag, KubernetesClusterTag)
+	}
+	if options.ParameterDriftCheckInterval > 0 {
+		keys = append(keys, ProvisionedVolumeTypeTag, ProvisionedIOPSTag, ProvisionedThroughputTag)
+	}
+	if options.AttachAuditTags {
+		keys = append(keys, AttachAuditNamespaceTag, AttachAuditNodeTag, AttachAuditAttachedTimeTag, AttachAuditDetachedTimeTag)
+	}
+	return keys
+}
+
+// automaticSnapshotTagKeys returns the keys of the tags the driver adds to the snapshots it creates with options.
+func automaticSnapshotTagKeys(options *Options) []string {
+	keys := []string{cloud.SnapshotNameTagKey, cloud.AwsEbsDriverTagKey}
+	if options.KubernetesClusterID != "" {
+		keys = append(keys, ResourceLifecycleTagPrefix+options.KubernetesClusterID, NameTag)
+	}
+	return keys
+}
+
+func validateKmsKeyByVolumeType(keys map[string]string) error {
+	for volumeType, keyID := range keys {
+		if volumeType == "" {
+			return fmt.Errorf("Volume type cannot be empty")
+		}
+		if err := cloud.ValidateKMSKeyID(keyID); err != nil {
+			return fmt.Errorf("KMS key for volume type '%s' is not valid: %w", volumeType, err)
+		}
+	}
 	return nil
 }
 
@@ -20,6 +20,8 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"testing"
@@ -118,6 +120,122 @@ func TestValidateExtraVolumeTags(t *testing.T) {
 	}
 }
 
+func TestValidateExtraTagsForOptions(t *testing.T) {
+	// extraTags returns n valid extra tags
+	extraTags := func(n int) map[string]string {
+		tags := map[string]string{}
+		for i := 0; i < n; i++ {
+			tags[fmt.Sprintf("extra-tag-%d", i)] = "value"
+		}
+		return tags
+	}
+	withTags := func(tags map[string]string, extra map[string]string) map[string]string {
+		for k, v := range extra {
+			tags[k] = v
+		}
+		return tags
+	}
+
+	testCases := []struct {
+		name    string
+		options *Options
+		expErr  error
+		// expTags are the extra tags of options once validated, when they differ
+		expTags map[string]string
+	}{
+		{
+			name:    "at the limit",
+			options: &Options{ExtraTags: extraTags(45)},
+		},
+		{
+			name:    "over the limit",
+			options: &Options{ExtraTags: extraTags(46)},
+			expErr:  errors.Join(fmt.Errorf("Too many tags (extra: 46, automatic: 5, headroom: 0, limit: %d)", cloud.MaxNumTagsPerResource)),
+		},
+		{
+			name:    "at the limit with headroom",
+			options: &Options{ExtraTags: extraTags(40), ExtraTagsHeadroom: 5},
+		},
+		{
+			name:    "over the limit with headroom",
+			options: &Options{ExtraTags: extraTags(40), ExtraTagsHeadroom: 6},
+			expErr:  errors.Join(fmt.Errorf("Too many tags (extra: 40, automatic: 5, headroom: 6, limit: %d)", cloud.MaxNumTagsPerResource)),
+		},
+		{
+			name:    "over the limit with cluster ID and parameter drift tags",
+			options: &Options{ExtraTags: extraTags(40), KubernetesClusterID: "cluster", ParameterDriftCheckInterval: time.Hour},
+			expErr:  errors.Join(fmt.Errorf("Too many tags (extra: 40, automatic: 11, headroom: 0, limit: %d)", cloud.MaxNumTagsPerResource)),
+		},
+		{
+			name:    "reserved key without cluster ID",
+			options: &Options{ExtraTags: map[string]string{NameTag: "name"}},
+		},
+		{
+			name:    "reserved key collision",
+			options: &Options{ExtraTags: map[string]string{NameTag: "name", KubernetesClusterTag: "cluster"}, KubernetesClusterID: "cluster"},
+			expErr: errors.Join(
+				fmt.Errorf("Tag key '%s' is reserved", KubernetesClusterTag),
+				fmt.Errorf("Tag key '%s' is reserved", NameTag),
+			),
+		},
+		{
+			name:    "parameter drift tag collision",
+			options: &Options{ExtraTags: map[string]string{ProvisionedIOPSTag: "3000"}, ParameterDriftCheckInterval: time.Hour},
+			expErr:  errors.Join(fmt.Errorf("Tag key '%s' is reserved", ProvisionedIOPSTag)),
+		},
+		{
+			name: "all violations",
+			options: &Options{ExtraTags: withTags(extraTags(44), map[string]string{
+				cloud.VolumeNameTagKey: "name",
+				"extra-tag-value":      randomString(cloud.MaxTagValueLength + 1),
+			})},
+			expErr: errors.Join(
+				fmt.Errorf("Tag key '%s' is reserved", cloud.VolumeNameTagKey),
+				fmt.Errorf("Tag value too long (actual: %d, limit: %d)", cloud.MaxTagValueLength+1, cloud.MaxTagValueLength),
+				fmt.Errorf("Too many tags (extra: 46, automatic: 5, headroom: 0, limit: %d)", cloud.MaxNumTagsPerResource),
+			),
+		},
+		{
+			name: "invalid tags dropped with warn-on-invalid-tag",
+			options: &Options{WarnOnInvalidTag: true, ExtraTags: map[string]string{
+				"team":                                  "storage",
+				randomString(cloud.MaxTagKeyLength + 1): "value",
+				"cost-center":                           randomString(cloud.MaxTagValueLength + 1),
+				"aws:created-by":                        "me",
+				cloud.KubernetesTagKeyPrefix + "test":   "owned",
+			}},
+			expTags: map[string]string{"team": "storage"},
+		},
+		{
+			name:    "automatic tag collision with warn-on-invalid-tag",
+			options: &Options{WarnOnInvalidTag: true, ExtraTags: map[string]string{ProvisionedIOPSTag: "3000"}, ParameterDriftCheckInterval: time.Hour},
+			expErr:  errors.Join(fmt.Errorf("Tag key '%s' is reserved", ProvisionedIOPSTag)),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateExtraTagsForOptions(tc.options)
+			if !reflect.DeepEqual(err, tc.expErr) {
+				t.Fatalf("error not equal\ngot:\n%s\nexpected:\n%s", err, tc.expErr)
+			}
+			if tc.expTags != nil && !reflect.DeepEqual(tc.options.ExtraTags, tc.expTags) {
+				t.Fatalf("extra tags not equal\ngot:\n%v\nexpected:\n%v", tc.options.ExtraTags, tc.expTags)
+			}
+		})
+	}
+}
+
+func TestValidateTagLimit(t *testing.T) {
+	if err := validateTagLimit(randomStringMap(cloud.MaxNumTagsPerResource)); err != nil {
+		t.Fatalf("Unexpected error at the limit: %v", err)
+	}
+	expErr := fmt.Errorf("Too many tags once the class tags are added (actual: %d, limit: %d)", cloud.MaxNumTagsPerResource+1, cloud.MaxNumTagsPerResource)
+	if err := validateTagLimit(randomStringMap(cloud.MaxNumTagsPerResource + 1)); !reflect.DeepEqual(err, expErr) {
+		t.Fatalf("error not equal\ngot:\n%s\nexpected:\n%s", err, expErr)
+	}
+}
+
 func TestValidateMode(t *testing.T) {
 	testCases := []struct {
 		name   string
@@ -161,6 +279,7 @@ func TestValidateDriverOptions(t *testing.T) {
 		name                string
 		mode                Mode
 		extraVolumeTags     map[string]string
+		kmsKeyByVolumeType  map[string]string
 		modifyVolumeTimeout time.Duration
 		expErr              error
 	}{
@@ -183,7 +302,27 @@ func TestValidateDriverOptions(t *testing.T) {
 				randomString(cloud.MaxTagKeyLength + 1): "extra-tag-value",
 			},
 			modifyVolumeTimeout: 5 * time.Second,
-			expErr:              fmt.Errorf("Invalid extra tags: %w", fmt.Errorf("Tag key too long (actual: %d, limit: %d)", cloud.MaxTagKeyLength+1, cloud.MaxTagKeyLength)),
+			expErr:              fmt.Errorf("Invalid extra tags: %w", errors.Join(fmt.Errorf("Tag key too long (actual: %d, limit: %d)", cloud.MaxTagKeyLength+1, cloud.MaxTagKeyLength))),
+		},
+		{
+			name: "success with KMS key by volume type",
+			mode: AllMode,
+			kmsKeyByVolumeType: map[string]string{
+				"io2": "arn:aws:kms:us-east-1:012345678910:key/abcd1234-a123-456a-a12b-a123b4cd56ef",
+				"gp3": "alias/dev",
+				"st1": "mrk-1234abcd12ab34cd56ef1234567890ab",
+			},
+			modifyVolumeTimeout: 5 * time.Second,
+			expErr:              nil,
+		},
+		{
+			name: "fail because KMS key by volume type is invalid",
+			mode: AllMode,
+			kmsKeyByVolumeType: map[string]string{
+				"io2": "abcd1234",
+			},
+			modifyVolumeTimeout: 5 * time.Second,
+			expErr:              fmt.Errorf("Invalid KMS key by volume type: %w", fmt.Errorf("KMS key for volume type 'io2' is not valid: %w", cloud.ValidateKMSKeyID("abcd1234"))),
 		},
 		{
 			name:                "fail because modifyVolumeRequestHandlerTimeout is zero",
@@ -197,6 +336,7 @@ func TestValidateDriverOptions(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			err := ValidateDriverOptions(&Options{
 				ExtraTags:                         tc.extraVolumeTags,
+				KmsKeyByVolumeType:                tc.kmsKeyByVolumeType,
 				Mode:                              tc.mode,
 				ModifyVolumeRequestHandlerTimeout: tc.modifyVolumeTimeout,
 			})
@@ -206,3 +346,43 @@ func TestValidateDriverOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateDriverOptionsExtraTagsFile(t *testing.T) {
+	testCases := []struct {
+		name        string
+		content     string
+		expectError bool
+	}{
+		{
+			name:    "valid tags",
+			content: `{"cost-center": "1234"}`,
+		},
+		{
+			name:        "malformed JSON",
+			content:     `{"cost-center": `,
+			expectError: true,
+		},
+		{
+			name:        "invalid tag",
+			content:     `{"aws:cost-center": "1234"}`,
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "extra-tags.json")
+			if err := os.WriteFile(path, []byte(tc.content), 0600); err != nil {
+				t.Fatalf("failed to write extra tags file: %v", err)
+			}
+			err := ValidateDriverOptions(&Options{
+				Mode:                              ControllerMode,
+				ExtraTagsFile:                     path,
+				ModifyVolumeRequestHandlerTimeout: 5 * time.Second,
+			})
+			if (err != nil) != tc.expectError {
+				t.Fatalf("ValidateDriverOptions() error = %v, wantErr %v", err, tc.expectError)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// watchVolumeStatus checks the status of the volumes of the cluster at every --volume-status-check-interval
+func (d *ControllerService) watchVolumeStatus(ctx context.Context, k kubernetes.Interface) {
+	ticker := time.NewTicker(d.options.VolumeStatusCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.checkVolumeStatus(ctx, k)
+		}
+	}
+}
+
+// checkVolumeStatus finds the volumes of the cluster whose IO was suspended by EBS because their data is potentially
+// inconsistent. Each is reported once with a warning event and VolumeIOSuspendedMetric, and its IO is enabled again when
+// --auto-enable-volume-io is set, unless its PV opts out with AutoEnableVolumeIOAnnotation. Enabling IO is retried at
+// every check until it succeeds, without reporting the volume again.
+func (d *ControllerService) checkVolumeStatus(ctx context.Context, k kubernetes.Interface) {
+	if k == nil {
+		klog.V(4).InfoS("No Kubernetes client, skipping volume status check")
+		return
+	}
+	volumeIDs, err := d.cloud.ListIOSuspendedDisks(ctx)
+	if err != nil {
+		klog.ErrorS(err, "Failed to list volumes with IO suspended for the volume status check")
+		return
+	}
+
+	suspended := make(map[string]struct{}, len(volumeIDs))
+	for _, volumeID := range volumeIDs {
+		suspended[volumeID] = struct{}{}
+	}
+	// Volumes whose IO was enabled since the last check are reported again should their IO be suspended again
+	for volumeID := range d.ioSuspendedVolumes {
+		if _, ok := suspended[volumeID]; !ok {
+			delete(d.ioSuspendedVolumes, volumeID)
+		}
+	}
+	if len(volumeIDs) == 0 {
+		return
+	}
+
+	pvs, err := k.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		klog.ErrorS(err, "Failed to list PersistentVolumes for the volume status check")
+		return
+	}
+	for i := range pvs.Items {
+		pv := &pvs.Items[i]
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != DriverName {
+			continue
+		}
+		volumeID := pv.Spec.CSI.VolumeHandle
+		if _, ok := suspended[volumeID]; !ok {
+			continue
+		}
+		handled, reported := d.ioSuspendedVolumes[volumeID]
+		if handled {
+			continue
+		}
+		d.ioSuspendedVolumes[volumeID] = d.handleIOSuspended(ctx, pv, !reported)
+	}
+}
+
+// handleIOSuspended reports a volume whose IO is suspended if report is set, and enables its IO if requested
+// It returns false when enabling IO failed, so that it is retried at the next check
+func (d *ControllerService) handleIOSuspended(ctx context.Context, pv *corev1.PersistentVolume, report bool) bool {
+	volumeID := pv.Spec.CSI.VolumeHandle
+	message := fmt.Sprintf("EBS suspended IO on volume %s of PersistentVolume %s because its data is potentially inconsistent, pods using it hang until IO is enabled.", volumeID, pv.Name)
+
+	action := VolumeIOSuspendedActionEnabled
+	switch {
+	case !d.options.AutoEnableVolumeIO:
+		action = VolumeIOSuspendedActionReported
+		message += " Check the data of the volume, for example on a volume restored from a snapshot of it, before enabling IO on it."
+	case pv.Annotations[AutoEnableVolumeIOAnnotation] == "false":
+		action = VolumeIOSuspendedActionOptedOut
+		message += fmt.Sprintf(" IO is not enabled automatically because of the %s=false annotation of the PersistentVolume. Check the data of the volume before enabling IO on it.", AutoEnableVolumeIOAnnotation)
+	default:
+		message += " IO is being enabled automatically by --auto-enable-volume-io. Applications may read or write corrupted data, check the filesystem and application data of the volume."
+	}
+
+	if report {
+		klog.InfoS("Volume IO suspended by EBS", "volumeID", volumeID, "pv", pv.Name, "action", action)
+		if d.eventRecorder != nil {
+			d.recordVolumeIOSuspendedEvent(pv, message)
+		}
+	}
+
+	if action == VolumeIOSuspendedActionEnabled {
+		if err := d.cloud.EnableDiskIO(ctx, volumeID); err != nil {
+			klog.ErrorS(err, "Failed to enable IO on the volume, retrying at the next volume status check", "volumeID", volumeID)
+			metrics.Recorder().IncreaseCount(VolumeIOSuspendedMetric, map[string]string{"action": VolumeIOSuspendedActionEnableFailed})
+			return false
+		}
+		klog.InfoS("Enabled IO on the volume", "volumeID", volumeID, "pv", pv.Name)
+	}
+	metrics.Recorder().IncreaseCount(VolumeIOSuspendedMetric, map[string]string{"action": action})
+	return true
+}
+
+// recordVolumeIOSuspendedEvent records a warning event on the PVC bound to the PV, or on the PV when it is not bound
+func (d *ControllerService) recordVolumeIOSuspendedEvent(pv *corev1.PersistentVolume, message string) {
+	var object runtime.Object = pv
+	if claim := pv.Spec.ClaimRef; claim != nil {
+		object = &corev1.ObjectReference{
+			Kind:       "PersistentVolumeClaim",
+			APIVersion: "v1",
+			Name:       claim.Name,
+			Namespace:  claim.Namespace,
+			UID:        claim.UID,
+		}
+	}
+	d.eventRecorder.Event(object, corev1.EventTypeWarning, VolumeIOSuspendedEventReason, message)
+}
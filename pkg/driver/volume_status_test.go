@@ -0,0 +1,205 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/cloud"
+	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestCheckVolumeStatus(t *testing.T) {
+	newPV := func(volumeID string, annotations map[string]string) *corev1.PersistentVolume {
+		pv := newTestPersistentVolume("pv-"+volumeID, volumeID, "team-a")
+		pv.Annotations = annotations
+		return pv
+	}
+	optOut := map[string]string{AutoEnableVolumeIOAnnotation: "false"}
+
+	testCases := []struct {
+		name       string
+		autoEnable bool
+		pv         *corev1.PersistentVolume
+		enableErr  error
+		// expectedEnable is whether EnableDiskIO is expected to be called
+		expectedEnable bool
+		expectedAction string
+		expectedEvent  string
+	}{
+		{
+			name:           "flag off reports only",
+			pv:             newPV("vol-test", nil),
+			expectedAction: VolumeIOSuspendedActionReported,
+			expectedEvent:  "Check the data of the volume",
+		},
+		{
+			name:           "auto enable",
+			autoEnable:     true,
+			pv:             newPV("vol-test", nil),
+			expectedEnable: true,
+			expectedAction: VolumeIOSuspendedActionEnabled,
+			expectedEvent:  "IO is being enabled automatically",
+		},
+		{
+			name:           "opted out",
+			autoEnable:     true,
+			pv:             newPV("vol-test", optOut),
+			expectedAction: VolumeIOSuspendedActionOptedOut,
+			expectedEvent:  AutoEnableVolumeIOAnnotation + "=false",
+		},
+		{
+			name:           "enable failure",
+			autoEnable:     true,
+			pv:             newPV("vol-test", nil),
+			enableErr:      errors.New("UnauthorizedOperation"),
+			expectedEnable: true,
+			expectedAction: VolumeIOSuspendedActionEnableFailed,
+			expectedEvent:  "IO is being enabled automatically",
+		},
+		{
+			name:       "volume of another cluster",
+			autoEnable: true,
+			pv:         newPV("vol-other", nil),
+		},
+	}
+
+	recorder := metrics.InitializeRecorder()
+	// ioSuspendedCounts returns the number of volumes recorded in VolumeIOSuspendedMetric by action
+	ioSuspendedCounts := func() map[string]float64 {
+		families, err := recorder.Gatherer().Gather()
+		if err != nil {
+			t.Fatalf("failed to gather metrics: %v", err)
+		}
+		counts := map[string]float64{}
+		for _, family := range families {
+			if family.GetName() != VolumeIOSuspendedMetric {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				for _, label := range metric.GetLabel() {
+					if label.GetName() == "action" {
+						counts[label.GetValue()] += metric.GetCounter().GetValue()
+					}
+				}
+			}
+		}
+		return counts
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtl := gomock.NewController(t)
+			defer mockCtl.Finish()
+
+			mockCloud := cloud.NewMockCloud(mockCtl)
+			mockCloud.EXPECT().ListIOSuspendedDisks(gomock.Any()).Return([]string{"vol-test"}, nil)
+			if tc.expectedEnable {
+				mockCloud.EXPECT().EnableDiskIO(gomock.Any(), "vol-test").Return(tc.enableErr)
+			}
+			clientset := fake.NewSimpleClientset(tc.pv)
+			recorder := record.NewFakeRecorder(10)
+			recorder.IncludeObject = true
+
+			driver := &ControllerService{
+				cloud:              mockCloud,
+				options:            &Options{VolumeStatusCheckInterval: 1, AutoEnableVolumeIO: tc.autoEnable},
+				eventRecorder:      recorder,
+				ioSuspendedVolumes: map[string]bool{},
+			}
+
+			before := ioSuspendedCounts()
+			driver.checkVolumeStatus(context.Background(), clientset)
+			after := ioSuspendedCounts()
+
+			for _, action := range []string{VolumeIOSuspendedActionReported, VolumeIOSuspendedActionOptedOut, VolumeIOSuspendedActionEnabled, VolumeIOSuspendedActionEnableFailed} {
+				expected := 0.0
+				if action == tc.expectedAction {
+					expected = 1
+				}
+				if after[action]-before[action] != expected {
+					t.Errorf("expected %v volumes counted with action %q, got %v", expected, action, after[action]-before[action])
+				}
+			}
+
+			events := drainEvents(recorder)
+			if tc.expectedEvent == "" {
+				if len(events) != 0 {
+					t.Fatalf("expected no events, got %v", events)
+				}
+				return
+			}
+			if len(events) != 1 {
+				t.Fatalf("expected 1 event, got %v", events)
+			}
+			if !strings.HasPrefix(events[0], corev1.EventTypeWarning+" "+VolumeIOSuspendedEventReason+" ") || !strings.Contains(events[0], "involvedObject{kind=PersistentVolumeClaim,") {
+				t.Errorf("unexpected event: %v", events[0])
+			}
+			if !strings.Contains(events[0], tc.expectedEvent) {
+				t.Errorf("expected event message to contain %q, got %q", tc.expectedEvent, events[0])
+			}
+		})
+	}
+}
+
+func TestCheckVolumeStatusReportsOnce(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	mockCloud := cloud.NewMockCloud(mockCtl)
+	clientset := fake.NewSimpleClientset(newTestPersistentVolume("pv-test", "vol-test", "team-a"))
+	recorder := record.NewFakeRecorder(10)
+	driver := &ControllerService{
+		cloud:              mockCloud,
+		options:            &Options{VolumeStatusCheckInterval: 1, AutoEnableVolumeIO: true},
+		eventRecorder:      recorder,
+		ioSuspendedVolumes: map[string]bool{},
+	}
+	events := 0
+	countEvents := func() int {
+		events += len(drainEvents(recorder))
+		return events
+	}
+
+	// A failure to enable IO is retried at the next check, without reporting the volume again
+	gomock.InOrder(
+		mockCloud.EXPECT().ListIOSuspendedDisks(gomock.Any()).Return([]string{"vol-test"}, nil),
+		mockCloud.EXPECT().EnableDiskIO(gomock.Any(), "vol-test").Return(errors.New("RequestLimitExceeded")),
+		mockCloud.EXPECT().ListIOSuspendedDisks(gomock.Any()).Return([]string{"vol-test"}, nil),
+		mockCloud.EXPECT().EnableDiskIO(gomock.Any(), "vol-test").Return(nil),
+		// IO stays suspended until EBS reports the new status, the volume is not reported again meanwhile
+		mockCloud.EXPECT().ListIOSuspendedDisks(gomock.Any()).Return([]string{"vol-test"}, nil),
+		mockCloud.EXPECT().ListIOSuspendedDisks(gomock.Any()).Return(nil, nil),
+		// Reported again when IO is suspended again
+		mockCloud.EXPECT().ListIOSuspendedDisks(gomock.Any()).Return([]string{"vol-test"}, nil),
+		mockCloud.EXPECT().EnableDiskIO(gomock.Any(), "vol-test").Return(nil),
+	)
+
+	for i, expectedEvents := range []int{1, 1, 1, 1, 2} {
+		driver.checkVolumeStatus(context.Background(), clientset)
+		if events := countEvents(); events != expectedEvents {
+			t.Fatalf("check %d: expected %d events, got %d", i, expectedEvents, events)
+		}
+	}
+}
@@ -15,7 +15,11 @@
 package metrics
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"slices"
 	"sync"
 	"time"
 
@@ -26,11 +30,25 @@ import (
 var (
 	r    *metricRecorder // singleton instance of metricRecorder
 	once sync.Once
+
+	// ErrRecorderNotInitialized is returned when the metrics handler is started before InitializeRecorder.
+	ErrRecorderNotInitialized = errors.New("metric recorder is not initialized")
 )
 
+// InFlightDebugPath is the path of the metrics server listing the keys of the volume operations in flight
+const InFlightDebugPath = "/debug/inflight"
+
 type metricRecorder struct {
 	registry metrics.KubeRegistry
-	metrics  map[string]interface{}
+	// metrics, namespace and histogramBuckets are guarded by mux, as metrics are recorded from concurrent RPCs
+	mux       sync.Mutex
+	metrics   map[string]interface{}
+	namespace string
+	// histogramBuckets are the buckets each histogram in metrics was registered with
+	histogramBuckets map[string][]float64
+	// inFlightKeys returns the keys served at InFlightDebugPath, guarded by inFlightKeysMux
+	inFlightKeys    func() []string
+	inFlightKeysMux sync.Mutex
 }
 
 // Recorder returns the singleton instance of metricRecorder.
@@ -43,53 +61,141 @@ func Recorder() *metricRecorder {
 func InitializeRecorder() *metricRecorder {
 	once.Do(func() {
 		r = &metricRecorder{
-			registry: metrics.NewKubeRegistry(),
-			metrics:  make(map[string]interface{}),
+			registry:         metrics.NewKubeRegistry(),
+			metrics:          make(map[string]interface{}),
+			histogramBuckets: make(map[string][]float64),
 		}
 	})
 	return r
 }
 
+// SetNamespace sets the namespace prepended to the names of all metrics registered afterward.
+// Metrics that are already registered keep their original name.
+func (m *metricRecorder) SetNamespace(namespace string) {
+	if m == nil {
+		return // recorder is not initialized
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.namespace = namespace
+}
+
+// SetInFlightKeys sets the function returning the keys of the volume operations in flight served at InFlightDebugPath.
+func (m *metricRecorder) SetInFlightKeys(keys func() []string) {
+	if m == nil {
+		return // recorder is not initialized
+	}
+	m.inFlightKeysMux.Lock()
+	defer m.inFlightKeysMux.Unlock()
+	m.inFlightKeys = keys
+}
+
+// inFlightHandler serves the keys of the volume operations in flight as a JSON list, to diagnose stuck volumes
+func (m *metricRecorder) inFlightHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		m.inFlightKeysMux.Lock()
+		keysFunc := m.inFlightKeys
+		m.inFlightKeysMux.Unlock()
+
+		keys := []string{}
+		if keysFunc != nil {
+			keys = keysFunc()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(keys); err != nil {
+			klog.ErrorS(err, "Failed to write the keys of the operations in flight")
+		}
+	})
+}
+
 // IncreaseCount increases the counter metric by 1.
 func (m *metricRecorder) IncreaseCount(name string, labels map[string]string) {
 	if m == nil {
 		return // recorder is not initialized
 	}
 
+	m.mux.Lock()
 	metric, ok := m.metrics[name]
-
 	if !ok {
 		klog.V(4).InfoS("Metric not found, registering", "name", name, "labels", labels)
-		m.registerCounterVec(name, "ebs_csi_aws_com metric", getLabelNames(labels))
-		m.IncreaseCount(name, labels)
-		return
+		metric = m.registerCounterVec(name, "ebs_csi_aws_com metric", getLabelNames(labels))
 	}
+	m.mux.Unlock()
 
 	metric.(*metrics.CounterVec).With(metrics.Labels(labels)).Inc()
 }
 
+// SetGauge sets the gauge metric to value.
+func (m *metricRecorder) SetGauge(name string, value float64, labels map[string]string) {
+	if m == nil {
+		return // recorder is not initialized
+	}
+
+	m.mux.Lock()
+	metric, ok := m.metrics[name]
+	if !ok {
+		klog.V(4).InfoS("Metric not found, registering", "name", name, "labels", labels)
+		metric = m.registerGaugeVec(name, "ebs_csi_aws_com metric", getLabelNames(labels))
+	}
+	m.mux.Unlock()
+
+	metric.(*metrics.GaugeVec).With(metrics.Labels(labels)).Set(value)
+}
+
+// RegisterHistogram registers the histogram metric with the given buckets, or the default buckets when nil.
+// Callers should register histograms once at startup, as ObserveHistogram registers unknown histograms with whatever
+// buckets it is called with. A histogram that is already registered is kept as is.
+func (m *metricRecorder) RegisterHistogram(name, help string, labels []string, buckets []float64) {
+	if m == nil {
+		return // recorder is not initialized
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if registered, exists := m.histogramBuckets[name]; exists && !slices.Equal(registered, buckets) {
+		klog.ErrorS(nil, "Histogram is already registered with different buckets, keeping them", "name", name, "registeredBuckets", registered, "buckets", buckets)
+		return
+	}
+	m.registerHistogramVec(name, help, labels, buckets)
+}
+
 // ObserveHistogram records the given value in the histogram metric.
+// Unknown histograms are registered with buckets. Once registered, buckets may be nil; other buckets than the
+// registered ones are logged as an error and the value is recorded with the registered buckets.
 func (m *metricRecorder) ObserveHistogram(name string, value float64, labels map[string]string, buckets []float64) {
 	if m == nil {
 		return // recorder is not initialized
 	}
+	m.mux.Lock()
 	metric, ok := m.metrics[name]
-
 	if !ok {
 		klog.V(4).InfoS("Metric not found, registering", "name", name, "labels", labels, "buckets", buckets)
-		m.registerHistogramVec(name, "ebs_csi_aws_com metric", getLabelNames(labels), buckets)
-		m.ObserveHistogram(name, value, labels, buckets)
-		return
+		metric = m.registerHistogramVec(name, "ebs_csi_aws_com metric", getLabelNames(labels), buckets)
 	}
+	registered := m.histogramBuckets[name]
+	m.mux.Unlock()
 
+	if buckets != nil && !slices.Equal(registered, buckets) {
+		klog.ErrorS(nil, "Histogram observed with different buckets than it was registered with, using the registered buckets", "name", name, "registeredBuckets", registered, "buckets", buckets)
+	}
 	metric.(*metrics.HistogramVec).With(metrics.Labels(labels)).Observe(value)
 }
 
-// InitializeMetricsHandler starts a new HTTP server to expose the metrics.
-func (m *metricRecorder) InitializeMetricsHandler(address, path, certFile, keyFile string) {
+// Gatherer returns the registry backing the recorder so that registered metrics can be collected.
+// nil is returned if the recorder is not initialized.
+func (m *metricRecorder) Gatherer() metrics.Gatherer {
 	if m == nil {
-		klog.InfoS("InitializeMetricsHandler: metric recorder is not initialized")
-		return
+		return nil
+	}
+	return m.registry
+}
+
+// InitializeMetricsHandler starts a new HTTP server to expose the metrics, along with the keys of the volume operations
+// in flight at InFlightDebugPath.
+// The server is shut down once ctx is done, waiting up to shutdownTimeout for in-flight requests to finish.
+// ErrRecorderNotInitialized is returned, and no server is started, if the recorder is not initialized.
+func (m *metricRecorder) InitializeMetricsHandler(ctx context.Context, address, path, certFile, keyFile string, shutdownTimeout time.Duration) error {
+	if m == nil {
+		return ErrRecorderNotInitialized
 	}
 
 	mux := http.NewServeMux()
@@ -98,6 +204,7 @@ func (m *metricRecorder) InitializeMetricsHandler(address, path, certFile, keyFi
 		metrics.HandlerOpts{
 			ErrorHandling: metrics.ContinueOnError,
 		}))
+	mux.Handle(InFlightDebugPath, m.inFlightHandler())
 
 	server := &http.Server{
 		Addr:        address,
@@ -120,28 +227,64 @@ func (m *metricRecorder) InitializeMetricsHandler(address, path, certFile, keyFi
 			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
 		}
 	}()
+
+	go func() {
+		<-ctx.Done()
+		klog.InfoS("Shutting down metric server", "address", address, "timeout", shutdownTimeout)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			klog.ErrorS(err, "Failed to gracefully shut down metric server, closing it", "address", address)
+			server.Close()
+		}
+	}()
+	return nil
 }
 
-func (m *metricRecorder) registerHistogramVec(name, help string, labels []string, buckets []float64) {
-	if _, exists := m.metrics[name]; exists {
-		return
+// registerHistogramVec returns the metric registered under name, registering a new histogram if there is none
+// m.mux must be held.
+func (m *metricRecorder) registerHistogramVec(name, help string, labels []string, buckets []float64) interface{} {
+	if metric, exists := m.metrics[name]; exists {
+		return metric
 	}
-	histogram := createHistogramVec(name, help, labels, buckets)
-	m.metrics[name] = histogram
-	m.registry.MustRegister(histogram)
+	histogram := createHistogramVec(m.namespace, name, help, labels, buckets)
+	m.histogramBuckets[name] = buckets
+	return m.register(name, histogram)
 }
 
-func (m *metricRecorder) registerCounterVec(name, help string, labels []string) {
-	if _, exists := m.metrics[name]; exists {
-		return
+// registerCounterVec returns the metric registered under name, registering a new counter if there is none
+// m.mux must be held.
+func (m *metricRecorder) registerCounterVec(name, help string, labels []string) interface{} {
+	if metric, exists := m.metrics[name]; exists {
+		return metric
+	}
+	return m.register(name, createCounterVec(m.namespace, name, help, labels))
+}
+
+// registerGaugeVec returns the metric registered under name, registering a new gauge if there is none
+// m.mux must be held.
+func (m *metricRecorder) registerGaugeVec(name, help string, labels []string) interface{} {
+	if metric, exists := m.metrics[name]; exists {
+		return metric
+	}
+	return m.register(name, createGaugeVec(m.namespace, name, help, labels))
+}
+
+// register adds the metric to the registry and records it under name
+// A metric the registry rejects, for example because another metric has the same name once namespaced, is still
+// recorded under name so that callers can use it, but it is not exported.
+// m.mux must be held.
+func (m *metricRecorder) register(name string, metric metrics.Registerable) interface{} {
+	if err := m.registry.Register(metric); err != nil {
+		klog.ErrorS(err, "Failed to register metric, it will not be exported", "name", name)
 	}
-	counter := createCounterVec(name, help, labels)
-	m.metrics[name] = counter
-	m.registry.MustRegister(counter)
+	m.metrics[name] = metric
+	return metric
 }
 
-func createHistogramVec(name, help string, labels []string, buckets []float64) *metrics.HistogramVec {
+func createHistogramVec(namespace, name, help string, labels []string, buckets []float64) *metrics.HistogramVec {
 	opts := &metrics.HistogramOpts{
+		Namespace:      namespace,
 		Name:           name,
 		Help:           help,
 		StabilityLevel: metrics.ALPHA,
@@ -150,9 +293,22 @@ func createHistogramVec(name, help string, labels []string, buckets []float64) *
 	return metrics.NewHistogramVec(opts, labels)
 }
 
-func createCounterVec(name, help string, labels []string) *metrics.CounterVec {
+func createCounterVec(namespace, name, help string, labels []string) *metrics.CounterVec {
 	return metrics.NewCounterVec(
 		&metrics.CounterOpts{
+			Namespace:      namespace,
+			Name:           name,
+			Help:           help,
+			StabilityLevel: metrics.ALPHA,
+		},
+		labels,
+	)
+}
+
+func createGaugeVec(namespace, name, help string, labels []string) *metrics.GaugeVec {
+	return metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace:      namespace,
 			Name:           name,
 			Help:           help,
 			StabilityLevel: metrics.ALPHA,
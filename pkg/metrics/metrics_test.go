@@ -15,8 +15,15 @@
 package metrics
 
 import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"k8s.io/component-base/metrics/testutil"
 )
@@ -56,6 +63,19 @@ func TestMetricRecorder(t *testing.T) {
 			`,
 			recorder: true,
 		},
+		{
+			name: "TestMetricRecorder: SetGaugeMetric",
+			exec: func(m *metricRecorder) {
+				m.SetGauge("test_gauge", 3, map[string]string{"key": "value"})
+				m.SetGauge("test_gauge", 2, map[string]string{"key": "value"})
+			},
+			expected: `
+			# HELP test_gauge ebs_csi_aws_com metric
+			# TYPE test_gauge gauge
+			test_gauge{key="value"} 2
+			`,
+			recorder: true,
+		},
 		{
 			name: "TestMetricRecorder: Re-register metric",
 			exec: func(m *metricRecorder) {
@@ -72,6 +92,20 @@ func TestMetricRecorder(t *testing.T) {
 			`,
 			recorder: true,
 		},
+		{
+			name: "TestMetricRecorder: Namespace prefix",
+			exec: func(m *metricRecorder) {
+				m.SetNamespace("ebs_csi")
+				defer m.SetNamespace("")
+				m.IncreaseCount("test_namespaced_counter", map[string]string{"key": "value"})
+			},
+			expected: `
+			# HELP ebs_csi_test_namespaced_counter ebs_csi_aws_com metric
+			# TYPE ebs_csi_test_namespaced_counter counter
+			ebs_csi_test_namespaced_counter{key="value"} 1
+			`,
+			recorder: true,
+		},
 		{
 			name: "TestMetricRecorder: Recorder not initialized",
 			exec: func(m *metricRecorder) {
@@ -98,6 +132,165 @@ func TestMetricRecorder(t *testing.T) {
 	}
 }
 
+func TestRegisterHistogram(t *testing.T) {
+	m := InitializeRecorder()
+
+	m.RegisterHistogram("test_registered_duration_seconds", "Test duration in seconds", []string{"key"}, []float64{0.5, 5})
+	// Neither a second registration nor observations with other buckets re-register the histogram
+	m.RegisterHistogram("test_registered_duration_seconds", "Test duration in seconds", []string{"key"}, []float64{1, 2, 3})
+	m.ObserveHistogram("test_registered_duration_seconds", 0.1, map[string]string{"key": "value"}, nil)
+	m.ObserveHistogram("test_registered_duration_seconds", 1.5, map[string]string{"key": "value"}, []float64{1, 2, 3})
+	m.ObserveHistogram("test_registered_duration_seconds", 10, map[string]string{"key": "value"}, []float64{0.5, 5})
+
+	expected := `
+	# HELP test_registered_duration_seconds [ALPHA] Test duration in seconds
+	# TYPE test_registered_duration_seconds histogram
+	test_registered_duration_seconds_bucket{key="value",le="0.5"} 1
+	test_registered_duration_seconds_bucket{key="value",le="5"} 2
+	test_registered_duration_seconds_bucket{key="value",le="+Inf"} 3
+	test_registered_duration_seconds_sum{key="value"} 11.6
+	test_registered_duration_seconds_count{key="value"} 3
+	`
+	if err := testutil.GatherAndCompare(m.registry, strings.NewReader(expected), "test_registered_duration_seconds"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMetricRecorderConcurrent(t *testing.T) {
+	m := InitializeRecorder()
+
+	// Metrics are registered on first use by concurrent RPCs
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.SetGauge("test_concurrent_gauge", 1, map[string]string{"key": "value"})
+			m.IncreaseCount("test_concurrent_calls_total", map[string]string{"key": "value"})
+			m.RegisterHistogram("test_concurrent_duration_seconds", "Test duration in seconds", []string{"key"}, []float64{1})
+			m.ObserveHistogram("test_concurrent_duration_seconds", 0.5, map[string]string{"key": "value"}, nil)
+		}()
+	}
+	wg.Wait()
+
+	expected := `
+	# HELP test_concurrent_calls_total [ALPHA] ebs_csi_aws_com metric
+	# TYPE test_concurrent_calls_total counter
+	test_concurrent_calls_total{key="value"} 10
+	`
+	if err := testutil.GatherAndCompare(m.registry, strings.NewReader(expected), "test_concurrent_calls_total"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInitializeMetricsHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var m *metricRecorder
+	if err := m.InitializeMetricsHandler(ctx, "127.0.0.1:0", "/metrics", "", "", time.Second); !errors.Is(err, ErrRecorderNotInitialized) {
+		t.Fatalf("expected %v starting the handler without a recorder, got %v", ErrRecorderNotInitialized, err)
+	}
+
+	if err := InitializeRecorder().InitializeMetricsHandler(ctx, "127.0.0.1:0", "/metrics", "", "", time.Second); err != nil {
+		t.Fatalf("unexpected error starting the handler: %v", err)
+	}
+}
+
+func TestInFlightHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     func() []string
+		expected string
+	}{
+		{
+			name:     "keys not set",
+			expected: "[]\n",
+		},
+		{
+			name:     "no operation in flight",
+			keys:     func() []string { return []string{} },
+			expected: "[]\n",
+		},
+		{
+			name:     "operations in flight",
+			keys:     func() []string { return []string{"vol-1", "vol-2/read-only"} },
+			expected: `["vol-1","vol-2/read-only"]` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &metricRecorder{}
+			if tt.keys != nil {
+				m.SetInFlightKeys(tt.keys)
+			}
+
+			w := httptest.NewRecorder()
+			m.inFlightHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, InFlightDebugPath, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("expected application/json content type, got %q", contentType)
+			}
+			if w.Body.String() != tt.expected {
+				t.Errorf("expected body %q, got %q", tt.expected, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestMetricsHandlerShutdown(t *testing.T) {
+	// Reserve a free port for the server
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	// eventually reports whether condition becomes true within a few seconds
+	eventually := func(condition func() bool) bool {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if condition() {
+				return true
+			}
+		}
+		return false
+	}
+	serving := func() bool {
+		resp, err := http.Get("http://" + address + "/metrics")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := InitializeRecorder().InitializeMetricsHandler(ctx, address, "/metrics", "", "", time.Second); err != nil {
+		t.Fatalf("unexpected error starting the handler: %v", err)
+	}
+	if !eventually(serving) {
+		t.Fatalf("metrics server did not start serving on %s", address)
+	}
+
+	cancel()
+	stopped := func() bool {
+		conn, err := net.DialTimeout("tcp", address, time.Second)
+		if err != nil {
+			return true
+		}
+		conn.Close()
+		return false
+	}
+	if !eventually(stopped) {
+		t.Fatalf("metrics server still accepts connections on %s after the context was cancelled", address)
+	}
+}
+
 func getMetricNameFromExpected(expected string) string {
 	lines := strings.Split(expected, "\n")
 	for _, line := range lines {
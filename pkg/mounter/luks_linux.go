@@ -0,0 +1,114 @@
+//go:build linux
+// +build linux
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mounter
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/klog/v2"
+	utilexec "k8s.io/utils/exec"
+)
+
+// luksMapperDir is the directory of the device-mapper devices opened by cryptsetup, overridden in tests
+var luksMapperDir = "/dev/mapper"
+
+// IsLuks checks if the device has a LUKS header using cryptsetup isLuks, which exits with status 1 when it has none
+func (m *NodeMounter) IsLuks(devicePath string) (bool, error) {
+	output, err := m.Exec.Command("cryptsetup", "isLuks", devicePath).CombinedOutput()
+	if err != nil {
+		var exitErr utilexec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitStatus() == 1 {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check if %s is a LUKS device: output: %s, err: %w", devicePath, string(output), err)
+	}
+	return true, nil
+}
+
+// LuksFormat writes a LUKS2 header to the device with cryptsetup luksFormat
+// The passphrase is passed on stdin so that it never appears in the process list
+func (m *NodeMounter) LuksFormat(devicePath, passphrase string) error {
+	existingFormat, err := m.GetDiskFormat(devicePath)
+	if err != nil {
+		return fmt.Errorf("failed to check if %s is blank: %w", devicePath, err)
+	}
+	if existingFormat != "" {
+		return fmt.Errorf("refusing to format %s with LUKS, it already contains %s", devicePath, existingFormat)
+	}
+
+	klog.V(2).InfoS("Formatting device with LUKS", "devicePath", devicePath)
+	cmd := m.Exec.Command("cryptsetup", "luksFormat", "--batch-mode", "--type", "luks2", "--key-file", "-", devicePath)
+	cmd.SetStdin(strings.NewReader(passphrase))
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to format %s with LUKS: output: %s, err: %w", devicePath, string(output), err)
+	}
+	return nil
+}
+
+// LuksOpen opens the LUKS device as /dev/mapper/<name> with cryptsetup luksOpen
+// The volume key is kept in the dm-crypt table rather than the kernel keyring, so that LuksResize needs no passphrase.
+func (m *NodeMounter) LuksOpen(devicePath, name, passphrase string) (string, error) {
+	mapperPath := filepath.Join(luksMapperDir, name)
+	if _, err := os.Stat(mapperPath); err == nil {
+		klog.V(4).InfoS("LUKS device already open", "devicePath", devicePath, "mapperPath", mapperPath)
+		return mapperPath, nil
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to check if %s is open: %w", mapperPath, err)
+	}
+
+	klog.V(4).InfoS("Opening LUKS device", "devicePath", devicePath, "mapperPath", mapperPath)
+	cmd := m.Exec.Command("cryptsetup", "luksOpen", "--disable-keyring", "--key-file", "-", devicePath, name)
+	cmd.SetStdin(strings.NewReader(passphrase))
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to open LUKS device %s as %s: output: %s, err: %w", devicePath, name, string(output), err)
+	}
+	return mapperPath, nil
+}
+
+// LuksClose closes /dev/mapper/<name> with cryptsetup luksClose
+func (m *NodeMounter) LuksClose(name string) error {
+	mapperPath := filepath.Join(luksMapperDir, name)
+	if _, err := os.Stat(mapperPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	klog.V(4).InfoS("Closing LUKS device", "mapperPath", mapperPath)
+	output, err := m.Exec.Command("cryptsetup", "luksClose", name).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to close LUKS device %s: output: %s, err: %w", name, string(output), err)
+	}
+	return nil
+}
+
+// LuksResize grows /dev/mapper/<name> to the size of its underlying device with cryptsetup resize
+func (m *NodeMounter) LuksResize(name string) error {
+	klog.V(4).InfoS("Resizing LUKS device", "name", name)
+	output, err := m.Exec.Command("cryptsetup", "resize", name).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to resize LUKS device %s: output: %s, err: %w", name, string(output), err)
+	}
+	return nil
+}
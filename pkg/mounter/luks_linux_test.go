@@ -0,0 +1,307 @@
+//go:build linux
+// +build linux
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mounter
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/mount-utils"
+
+	utilexec "k8s.io/utils/exec"
+	fakeexec "k8s.io/utils/exec/testing"
+)
+
+// fakeCryptCommand is the scripted result of a command run by the fake crypt backend
+type fakeCryptCommand struct {
+	output string
+	err    error
+}
+
+// newFakeCryptMounter returns a NodeMounter whose commands return the scripted results in order, along with the
+// commands it ran so that their arguments and stdin can be checked
+func newFakeCryptMounter(results ...fakeCryptCommand) (*NodeMounter, *fakeexec.FakeExec, *[]*fakeexec.FakeCmd) {
+	var cmds []*fakeexec.FakeCmd
+	fexec := &fakeexec.FakeExec{}
+	for _, result := range results {
+		fexec.CommandScript = append(fexec.CommandScript, func(cmd string, args ...string) utilexec.Cmd {
+			fcmd := &fakeexec.FakeCmd{
+				CombinedOutputScript: []fakeexec.FakeAction{
+					func() ([]byte, []byte, error) { return []byte(result.output), nil, result.err },
+				},
+			}
+			cmds = append(cmds, fcmd)
+			return fakeexec.InitFakeCmd(fcmd, cmd, args...)
+		})
+	}
+	return &NodeMounter{SafeFormatAndMount: &mount.SafeFormatAndMount{Interface: mount.New(""), Exec: fexec}}, fexec, &cmds
+}
+
+func stdinOf(t *testing.T, fcmd *fakeexec.FakeCmd) string {
+	t.Helper()
+	if fcmd.Stdin == nil {
+		return ""
+	}
+	stdin, err := io.ReadAll(fcmd.Stdin)
+	if err != nil {
+		t.Fatalf("Failed to read stdin: %v", err)
+	}
+	return string(stdin)
+}
+
+func TestIsLuks(t *testing.T) {
+	testCases := []struct {
+		name           string
+		result         fakeCryptCommand
+		expectedResult bool
+		expectErr      bool
+	}{
+		{
+			name:           "LUKS device",
+			expectedResult: true,
+		},
+		{
+			name:   "not a LUKS device",
+			result: fakeCryptCommand{err: &fakeexec.FakeExitError{Status: 1}},
+		},
+		{
+			name:      "cryptsetup failure",
+			result:    fakeCryptCommand{output: "Device /dev/xvdba does not exist or access denied.", err: &fakeexec.FakeExitError{Status: 4}},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, _, cmds := newFakeCryptMounter(tc.result)
+
+			isLuks, err := m.IsLuks("/dev/xvdba")
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedResult, isLuks)
+			assert.Equal(t, []string{"cryptsetup", "isLuks", "/dev/xvdba"}, (*cmds)[0].Argv)
+		})
+	}
+}
+
+func TestLuksFormat(t *testing.T) {
+	testCases := []struct {
+		name           string
+		results        []fakeCryptCommand
+		expectedFormat bool
+		expectErr      bool
+	}{
+		{
+			name: "blank device formatted",
+			results: []fakeCryptCommand{
+				{err: &fakeexec.FakeExitError{Status: 2}},
+				{},
+			},
+			expectedFormat: true,
+		},
+		{
+			name: "device with a filesystem refused",
+			results: []fakeCryptCommand{
+				{output: "DEVNAME=/dev/xvdba\nTYPE=ext4\n"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "blkid failure",
+			results: []fakeCryptCommand{
+				{err: &fakeexec.FakeExitError{Status: 4}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "cryptsetup failure",
+			results: []fakeCryptCommand{
+				{err: &fakeexec.FakeExitError{Status: 2}},
+				{output: "Cannot format device /dev/xvdba in use.", err: &fakeexec.FakeExitError{Status: 5}},
+			},
+			expectedFormat: true,
+			expectErr:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, fexec, cmds := newFakeCryptMounter(tc.results...)
+
+			err := m.LuksFormat("/dev/xvdba", "secret")
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, "blkid", (*cmds)[0].Argv[0])
+			if tc.expectedFormat {
+				assert.Equal(t, 2, fexec.CommandCalls)
+				assert.Equal(t, []string{"cryptsetup", "luksFormat", "--batch-mode", "--type", "luks2", "--key-file", "-", "/dev/xvdba"}, (*cmds)[1].Argv)
+				assert.Equal(t, "secret", stdinOf(t, (*cmds)[1]))
+			} else {
+				assert.Equal(t, 1, fexec.CommandCalls)
+			}
+		})
+	}
+}
+
+func TestLuksOpen(t *testing.T) {
+	testCases := []struct {
+		name         string
+		alreadyOpen  bool
+		result       fakeCryptCommand
+		expectedOpen bool
+		expectErr    bool
+	}{
+		{
+			name:         "device opened",
+			expectedOpen: true,
+		},
+		{
+			name:        "device already open",
+			alreadyOpen: true,
+		},
+		{
+			name:         "wrong passphrase",
+			result:       fakeCryptCommand{output: "No key available with this passphrase.", err: &fakeexec.FakeExitError{Status: 2}},
+			expectedOpen: true,
+			expectErr:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			luksMapperDir = t.TempDir()
+			defer func() { luksMapperDir = "/dev/mapper" }()
+			if tc.alreadyOpen {
+				if err := os.WriteFile(filepath.Join(luksMapperDir, "ebs-luks-vol-test"), nil, 0600); err != nil {
+					t.Fatalf("Failed to create fixture device: %v", err)
+				}
+			}
+			m, fexec, cmds := newFakeCryptMounter(tc.result)
+
+			mapperPath, err := m.LuksOpen("/dev/xvdba", "ebs-luks-vol-test", "secret")
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, filepath.Join(luksMapperDir, "ebs-luks-vol-test"), mapperPath)
+			}
+			if tc.expectedOpen {
+				assert.Equal(t, 1, fexec.CommandCalls)
+				assert.Equal(t, []string{"cryptsetup", "luksOpen", "--disable-keyring", "--key-file", "-", "/dev/xvdba", "ebs-luks-vol-test"}, (*cmds)[0].Argv)
+				assert.Equal(t, "secret", stdinOf(t, (*cmds)[0]))
+			} else {
+				assert.Equal(t, 0, fexec.CommandCalls)
+			}
+		})
+	}
+}
+
+func TestLuksClose(t *testing.T) {
+	testCases := []struct {
+		name          string
+		open          bool
+		result        fakeCryptCommand
+		expectedClose bool
+		expectErr     bool
+	}{
+		{
+			name:          "device closed",
+			open:          true,
+			expectedClose: true,
+		},
+		{
+			name: "device not open",
+		},
+		{
+			name:          "device busy",
+			open:          true,
+			result:        fakeCryptCommand{output: "Device ebs-luks-vol-test is still in use.", err: &fakeexec.FakeExitError{Status: 5}},
+			expectedClose: true,
+			expectErr:     true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			luksMapperDir = t.TempDir()
+			defer func() { luksMapperDir = "/dev/mapper" }()
+			if tc.open {
+				if err := os.WriteFile(filepath.Join(luksMapperDir, "ebs-luks-vol-test"), nil, 0600); err != nil {
+					t.Fatalf("Failed to create fixture device: %v", err)
+				}
+			}
+			m, fexec, cmds := newFakeCryptMounter(tc.result)
+
+			err := m.LuksClose("ebs-luks-vol-test")
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			if tc.expectedClose {
+				assert.Equal(t, 1, fexec.CommandCalls)
+				assert.Equal(t, []string{"cryptsetup", "luksClose", "ebs-luks-vol-test"}, (*cmds)[0].Argv)
+			} else {
+				assert.Equal(t, 0, fexec.CommandCalls)
+			}
+		})
+	}
+}
+
+func TestLuksResize(t *testing.T) {
+	testCases := []struct {
+		name      string
+		result    fakeCryptCommand
+		expectErr bool
+	}{
+		{
+			name: "device resized",
+		},
+		{
+			name:      "resize failure",
+			result:    fakeCryptCommand{output: "Device ebs-luks-vol-test not found", err: &fakeexec.FakeExitError{Status: 4}},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, fexec, cmds := newFakeCryptMounter(tc.result)
+
+			err := m.LuksResize("ebs-luks-vol-test")
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, 1, fexec.CommandCalls)
+			assert.Equal(t, []string{"cryptsetup", "resize", "ebs-luks-vol-test"}, (*cmds)[0].Argv)
+		})
+	}
+}
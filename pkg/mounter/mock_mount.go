@@ -19,6 +19,7 @@
 package mounter
 
 import (
+	context "context"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -77,18 +78,32 @@ func (mr *MockMounterMockRecorder) FindDevicePath(devicePath, volumeID, partitio
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindDevicePath", reflect.TypeOf((*MockMounter)(nil).FindDevicePath), devicePath, volumeID, partition, region)
 }
 
+// ForceUnmount mocks base method.
+func (m *MockMounter) ForceUnmount(path string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ForceUnmount", path)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ForceUnmount indicates an expected call of ForceUnmount.
+func (mr *MockMounterMockRecorder) ForceUnmount(path interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ForceUnmount", reflect.TypeOf((*MockMounter)(nil).ForceUnmount), path)
+}
+
 // FormatAndMountSensitiveWithFormatOptions mocks base method.
-func (m *MockMounter) FormatAndMountSensitiveWithFormatOptions(source, target, fstype string, options, sensitiveOptions, formatOptions []string) error {
+func (m *MockMounter) FormatAndMountSensitiveWithFormatOptions(ctx context.Context, source, target, fstype string, options, sensitiveOptions, formatOptions []string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "FormatAndMountSensitiveWithFormatOptions", source, target, fstype, options, sensitiveOptions, formatOptions)
+	ret := m.ctrl.Call(m, "FormatAndMountSensitiveWithFormatOptions", ctx, source, target, fstype, options, sensitiveOptions, formatOptions)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // FormatAndMountSensitiveWithFormatOptions indicates an expected call of FormatAndMountSensitiveWithFormatOptions.
-func (mr *MockMounterMockRecorder) FormatAndMountSensitiveWithFormatOptions(source, target, fstype, options, sensitiveOptions, formatOptions interface{}) *gomock.Call {
+func (mr *MockMounterMockRecorder) FormatAndMountSensitiveWithFormatOptions(ctx, source, target, fstype, options, sensitiveOptions, formatOptions interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FormatAndMountSensitiveWithFormatOptions", reflect.TypeOf((*MockMounter)(nil).FormatAndMountSensitiveWithFormatOptions), source, target, fstype, options, sensitiveOptions, formatOptions)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FormatAndMountSensitiveWithFormatOptions", reflect.TypeOf((*MockMounter)(nil).FormatAndMountSensitiveWithFormatOptions), ctx, source, target, fstype, options, sensitiveOptions, formatOptions)
 }
 
 // GetBlockSizeBytes mocks base method.
@@ -122,6 +137,21 @@ func (mr *MockMounterMockRecorder) GetDeviceNameFromMount(mountPath interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeviceNameFromMount", reflect.TypeOf((*MockMounter)(nil).GetDeviceNameFromMount), mountPath)
 }
 
+// GetDiskFormat mocks base method.
+func (m *MockMounter) GetDiskFormat(devicePath string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDiskFormat", devicePath)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDiskFormat indicates an expected call of GetDiskFormat.
+func (mr *MockMounterMockRecorder) GetDiskFormat(devicePath interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDiskFormat", reflect.TypeOf((*MockMounter)(nil).GetDiskFormat), devicePath)
+}
+
 // GetMountRefs mocks base method.
 func (m *MockMounter) GetMountRefs(pathname string) ([]string, error) {
 	m.ctrl.T.Helper()
@@ -137,6 +167,37 @@ func (mr *MockMounterMockRecorder) GetMountRefs(pathname interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMountRefs", reflect.TypeOf((*MockMounter)(nil).GetMountRefs), pathname)
 }
 
+// GetPartition mocks base method.
+func (m *MockMounter) GetPartition(devicePath string) (string, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPartition", devicePath)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetPartition indicates an expected call of GetPartition.
+func (mr *MockMounterMockRecorder) GetPartition(devicePath interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPartition", reflect.TypeOf((*MockMounter)(nil).GetPartition), devicePath)
+}
+
+// GrowPartition mocks base method.
+func (m *MockMounter) GrowPartition(diskPath, partition string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GrowPartition", diskPath, partition)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GrowPartition indicates an expected call of GrowPartition.
+func (mr *MockMounterMockRecorder) GrowPartition(diskPath, partition interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GrowPartition", reflect.TypeOf((*MockMounter)(nil).GrowPartition), diskPath, partition)
+}
+
 // IsBlockDevice mocks base method.
 func (m *MockMounter) IsBlockDevice(fullPath string) (bool, error) {
 	m.ctrl.T.Helper()
@@ -166,6 +227,21 @@ func (mr *MockMounterMockRecorder) IsCorruptedMnt(err interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsCorruptedMnt", reflect.TypeOf((*MockMounter)(nil).IsCorruptedMnt), err)
 }
 
+// IsDeviceMapper mocks base method.
+func (m *MockMounter) IsDeviceMapper(devicePath string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsDeviceMapper", devicePath)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsDeviceMapper indicates an expected call of IsDeviceMapper.
+func (mr *MockMounterMockRecorder) IsDeviceMapper(devicePath interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsDeviceMapper", reflect.TypeOf((*MockMounter)(nil).IsDeviceMapper), devicePath)
+}
+
 // IsLikelyNotMountPoint mocks base method.
 func (m *MockMounter) IsLikelyNotMountPoint(file string) (bool, error) {
 	m.ctrl.T.Helper()
@@ -181,6 +257,21 @@ func (mr *MockMounterMockRecorder) IsLikelyNotMountPoint(file interface{}) *gomo
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsLikelyNotMountPoint", reflect.TypeOf((*MockMounter)(nil).IsLikelyNotMountPoint), file)
 }
 
+// IsLuks mocks base method.
+func (m *MockMounter) IsLuks(devicePath string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsLuks", devicePath)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsLuks indicates an expected call of IsLuks.
+func (mr *MockMounterMockRecorder) IsLuks(devicePath interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsLuks", reflect.TypeOf((*MockMounter)(nil).IsLuks), devicePath)
+}
+
 // IsMountPoint mocks base method.
 func (m *MockMounter) IsMountPoint(file string) (bool, error) {
 	m.ctrl.T.Helper()
@@ -211,6 +302,63 @@ func (mr *MockMounterMockRecorder) List() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockMounter)(nil).List))
 }
 
+// LuksClose mocks base method.
+func (m *MockMounter) LuksClose(name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LuksClose", name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LuksClose indicates an expected call of LuksClose.
+func (mr *MockMounterMockRecorder) LuksClose(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LuksClose", reflect.TypeOf((*MockMounter)(nil).LuksClose), name)
+}
+
+// LuksFormat mocks base method.
+func (m *MockMounter) LuksFormat(devicePath, passphrase string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LuksFormat", devicePath, passphrase)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LuksFormat indicates an expected call of LuksFormat.
+func (mr *MockMounterMockRecorder) LuksFormat(devicePath, passphrase interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LuksFormat", reflect.TypeOf((*MockMounter)(nil).LuksFormat), devicePath, passphrase)
+}
+
+// LuksOpen mocks base method.
+func (m *MockMounter) LuksOpen(devicePath, name, passphrase string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LuksOpen", devicePath, name, passphrase)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LuksOpen indicates an expected call of LuksOpen.
+func (mr *MockMounterMockRecorder) LuksOpen(devicePath, name, passphrase interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LuksOpen", reflect.TypeOf((*MockMounter)(nil).LuksOpen), devicePath, name, passphrase)
+}
+
+// LuksResize mocks base method.
+func (m *MockMounter) LuksResize(name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LuksResize", name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LuksResize indicates an expected call of LuksResize.
+func (mr *MockMounterMockRecorder) LuksResize(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LuksResize", reflect.TypeOf((*MockMounter)(nil).LuksResize), name)
+}
+
 // MakeDir mocks base method.
 func (m *MockMounter) MakeDir(path string) error {
 	m.ctrl.T.Helper()
@@ -354,6 +502,34 @@ func (mr *MockMounterMockRecorder) Resize(devicePath, deviceMountPath interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Resize", reflect.TypeOf((*MockMounter)(nil).Resize), devicePath, deviceMountPath)
 }
 
+// SetXFSProjectQuota mocks base method.
+func (m *MockMounter) SetXFSProjectQuota(path string, projectID uint32) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetXFSProjectQuota", path, projectID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetXFSProjectQuota indicates an expected call of SetXFSProjectQuota.
+func (mr *MockMounterMockRecorder) SetXFSProjectQuota(path, projectID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetXFSProjectQuota", reflect.TypeOf((*MockMounter)(nil).SetXFSProjectQuota), path, projectID)
+}
+
+// SyncFilesystem mocks base method.
+func (m *MockMounter) SyncFilesystem(path string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SyncFilesystem", path)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SyncFilesystem indicates an expected call of SyncFilesystem.
+func (mr *MockMounterMockRecorder) SyncFilesystem(path interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SyncFilesystem", reflect.TypeOf((*MockMounter)(nil).SyncFilesystem), path)
+}
+
 // Unmount mocks base method.
 func (m *MockMounter) Unmount(target string) error {
 	m.ctrl.T.Helper()
@@ -395,3 +571,135 @@ func (mr *MockMounterMockRecorder) Unstage(path interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unstage", reflect.TypeOf((*MockMounter)(nil).Unstage), path)
 }
+
+// MockLuksMounter is a mock of LuksMounter interface.
+type MockLuksMounter struct {
+	ctrl     *gomock.Controller
+	recorder *MockLuksMounterMockRecorder
+}
+
+// MockLuksMounterMockRecorder is the mock recorder for MockLuksMounter.
+type MockLuksMounterMockRecorder struct {
+	mock *MockLuksMounter
+}
+
+// NewMockLuksMounter creates a new mock instance.
+func NewMockLuksMounter(ctrl *gomock.Controller) *MockLuksMounter {
+	mock := &MockLuksMounter{ctrl: ctrl}
+	mock.recorder = &MockLuksMounterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLuksMounter) EXPECT() *MockLuksMounterMockRecorder {
+	return m.recorder
+}
+
+// IsLuks mocks base method.
+func (m *MockLuksMounter) IsLuks(devicePath string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsLuks", devicePath)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsLuks indicates an expected call of IsLuks.
+func (mr *MockLuksMounterMockRecorder) IsLuks(devicePath interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsLuks", reflect.TypeOf((*MockLuksMounter)(nil).IsLuks), devicePath)
+}
+
+// LuksClose mocks base method.
+func (m *MockLuksMounter) LuksClose(name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LuksClose", name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LuksClose indicates an expected call of LuksClose.
+func (mr *MockLuksMounterMockRecorder) LuksClose(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LuksClose", reflect.TypeOf((*MockLuksMounter)(nil).LuksClose), name)
+}
+
+// LuksFormat mocks base method.
+func (m *MockLuksMounter) LuksFormat(devicePath, passphrase string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LuksFormat", devicePath, passphrase)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LuksFormat indicates an expected call of LuksFormat.
+func (mr *MockLuksMounterMockRecorder) LuksFormat(devicePath, passphrase interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LuksFormat", reflect.TypeOf((*MockLuksMounter)(nil).LuksFormat), devicePath, passphrase)
+}
+
+// LuksOpen mocks base method.
+func (m *MockLuksMounter) LuksOpen(devicePath, name, passphrase string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LuksOpen", devicePath, name, passphrase)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LuksOpen indicates an expected call of LuksOpen.
+func (mr *MockLuksMounterMockRecorder) LuksOpen(devicePath, name, passphrase interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LuksOpen", reflect.TypeOf((*MockLuksMounter)(nil).LuksOpen), devicePath, name, passphrase)
+}
+
+// LuksResize mocks base method.
+func (m *MockLuksMounter) LuksResize(name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LuksResize", name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LuksResize indicates an expected call of LuksResize.
+func (mr *MockLuksMounterMockRecorder) LuksResize(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LuksResize", reflect.TypeOf((*MockLuksMounter)(nil).LuksResize), name)
+}
+
+// MockFormatter is a mock of Formatter interface.
+type MockFormatter struct {
+	ctrl     *gomock.Controller
+	recorder *MockFormatterMockRecorder
+}
+
+// MockFormatterMockRecorder is the mock recorder for MockFormatter.
+type MockFormatterMockRecorder struct {
+	mock *MockFormatter
+}
+
+// NewMockFormatter creates a new mock instance.
+func NewMockFormatter(ctrl *gomock.Controller) *MockFormatter {
+	mock := &MockFormatter{ctrl: ctrl}
+	mock.recorder = &MockFormatterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockFormatter) EXPECT() *MockFormatterMockRecorder {
+	return m.recorder
+}
+
+// Format mocks base method.
+func (m *MockFormatter) Format(ctx context.Context, source, target, fstype string, mountOptions, formatOptions []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Format", ctx, source, target, fstype, mountOptions, formatOptions)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Format indicates an expected call of Format.
+func (mr *MockFormatterMockRecorder) Format(ctx, source, target, fstype, mountOptions, formatOptions interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Format", reflect.TypeOf((*MockFormatter)(nil).Format), ctx, source, target, fstype, mountOptions, formatOptions)
+}
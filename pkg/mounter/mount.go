@@ -20,6 +20,9 @@ limitations under the License.
 package mounter
 
 import (
+	"context"
+	"os"
+
 	mountutils "k8s.io/mount-utils"
 )
 
@@ -30,8 +33,9 @@ import (
 // insulate from oft-changing upstream interfaces/structs
 type Mounter interface {
 	mountutils.Interface
+	LuksMounter
 
-	FormatAndMountSensitiveWithFormatOptions(source string, target string, fstype string, options []string, sensitiveOptions []string, formatOptions []string) error
+	FormatAndMountSensitiveWithFormatOptions(ctx context.Context, source string, target string, fstype string, options []string, sensitiveOptions []string, formatOptions []string) error
 	IsCorruptedMnt(err error) bool
 	GetDeviceNameFromMount(mountPath string) (string, int, error)
 	MakeFile(path string) error
@@ -40,21 +44,81 @@ type Mounter interface {
 	NeedResize(devicePath string, deviceMountPath string) (bool, error)
 	Unpublish(path string) error
 	Unstage(path string) error
+	ForceUnmount(path string) error
 	Resize(devicePath, deviceMountPath string) (bool, error)
 	FindDevicePath(devicePath, volumeID, partition, region string) (string, error)
 	PreparePublishTarget(target string) error
 	IsBlockDevice(fullPath string) (bool, error)
 	GetBlockSizeBytes(devicePath string) (int64, error)
+	IsDeviceMapper(devicePath string) (bool, error)
+	// GetPartition returns the disk and number of the partition at devicePath, empty if it is a whole disk
+	GetPartition(devicePath string) (string, string, error)
+	GrowPartition(diskPath, partition string) (bool, error)
+	SyncFilesystem(path string) error
+	SetXFSProjectQuota(path string, projectID uint32) error
+	// GetDiskFormat returns the filesystem or partition table on the device, empty if the device is blank
+	GetDiskFormat(devicePath string) (string, error)
+}
+
+// PartitionLabelPrefix marks the partition passed to FindDevicePath as a GPT partition label rather than a partition
+// number, for example "partlabel:data"
+const PartitionLabelPrefix = "partlabel:"
+
+// LuksMounter sets up LUKS encryption of devices, which are then formatted and mounted through their device-mapper
+// device instead of the device itself.
+type LuksMounter interface {
+	// IsLuks checks if the device has a LUKS header
+	IsLuks(devicePath string) (bool, error)
+	// LuksFormat writes a LUKS header protected by passphrase to the device. Devices that are not blank are refused
+	// so that existing data is never overwritten.
+	LuksFormat(devicePath, passphrase string) error
+	// LuksOpen opens the LUKS device as the device-mapper device name and returns the path of the opened device.
+	// Opening a device that is already open returns its path.
+	LuksOpen(devicePath, name, passphrase string) (string, error)
+	// LuksClose closes the device-mapper device name. Closing a device that is not open is not an error.
+	LuksClose(name string) error
+	// LuksResize grows the open device-mapper device name to the size of its underlying device
+	LuksResize(name string) error
 }
 
+// Formatter formats the source device, if it is not formatted yet, and mounts it at target during NodeStageVolume.
+// It can be replaced to change how volumes are formatted, e.g. to set up encryption before the filesystem is mounted.
+// Implementations should stop formatting and return when ctx is done.
+type Formatter interface {
+	Format(ctx context.Context, source, target, fstype string, mountOptions, formatOptions []string) error
+}
+
+// mounterFormatter implements Formatter with the format and mount of a Mounter.
+type mounterFormatter struct {
+	m Mounter
+}
+
+// NewFormatter returns the default Formatter, which formats and mounts with m.
+func NewFormatter(m Mounter) Formatter {
+	return &mounterFormatter{m: m}
+}
+
+func (f *mounterFormatter) Format(ctx context.Context, source, target, fstype string, mountOptions, formatOptions []string) error {
+	return f.m.FormatAndMountSensitiveWithFormatOptions(ctx, source, target, fstype, mountOptions, nil, formatOptions)
+}
+
+// DefaultDirMode is the mode of the directories created by MakeDir when no other mode is configured.
+const DefaultDirMode os.FileMode = 0755
+
 // NodeMounter implements Mounter.
 // A superstruct of SafeFormatAndMount.
 type NodeMounter struct {
 	*mountutils.SafeFormatAndMount
+	// dirMode is the mode of the directories created by MakeDir, DefaultDirMode when 0
+	dirMode os.FileMode
+	// chmodExistingDirs makes MakeDir set dirMode on directories that already exist
+	chmodExistingDirs bool
 }
 
 // NewNodeMounter returns a new intsance of NodeMounter.
-func NewNodeMounter(hostprocess bool) (Mounter, error) {
+// Directories are created by MakeDir with dirMode, or DefaultDirMode when dirMode is 0. Existing directories are only
+// changed to dirMode when chmodExistingDirs is set. The mode is ignored on Windows.
+func NewNodeMounter(hostprocess bool, dirMode os.FileMode, chmodExistingDirs bool) (Mounter, error) {
 	var safeMounter *mountutils.SafeFormatAndMount
 	var err error
 
@@ -67,5 +131,9 @@ func NewNodeMounter(hostprocess bool) (Mounter, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &NodeMounter{safeMounter}, nil
+	return &NodeMounter{
+		SafeFormatAndMount: safeMounter,
+		dirMode:            dirMode,
+		chmodExistingDirs:  chmodExistingDirs,
+	}, nil
 }
@@ -20,11 +20,14 @@ limitations under the License.
 package mounter
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -52,12 +55,22 @@ func NewSafeMounterV2() (*mountutils.SafeFormatAndMount, error) {
 }
 
 // FindDevicePath finds path of device and verifies its existence
+// if an nvme device reports the volume ID as its serial, returns that nvme device path eg. /dev/nvme1n1
 // if the device is not nvme, return the path directly
 // if the device is nvme, finds and returns the nvme device path eg. /dev/nvme1n1
 func (m *NodeMounter) FindDevicePath(devicePath, volumeID, partition, region string) (string, error) {
 	strippedVolumeName := strings.Replace(volumeID, "-", "", -1)
 	canonicalDevicePath := ""
 
+	// On Nitro instances the device path from the controller is only a hint and the /dev/disk/by-id/ symlinks can
+	// race during fast attach/detach cycles, so look the volume up directly by the serial NVMe reports in sysfs first
+	nvmeDevicePath, err := findNvmeVolumeBySerial(sysfsRoot, strippedVolumeName)
+	if err == nil {
+		klog.V(5).InfoS("[Debug] successfully resolved nvme device by serial", "volumeID", volumeID, "nvmeDevicePath", nvmeDevicePath)
+		return m.resolvePartition(nvmeDevicePath, partition)
+	}
+	klog.V(5).InfoS("[Debug] nvme serial lookup failed, falling back to device path", "volumeID", volumeID, "err", err)
+
 	// If the given path exists, the device MAY be nvme. Further, it MAY be a
 	// symlink to the nvme device path like:
 	// | $ stat /dev/xvdba
@@ -88,7 +101,7 @@ func (m *NodeMounter) FindDevicePath(devicePath, volumeID, partition, region str
 		if err = verifyVolumeSerialMatch(canonicalDevicePath, strippedVolumeName, execRunner); err != nil {
 			return "", err
 		}
-		return m.appendPartition(canonicalDevicePath, partition), nil
+		return m.resolvePartition(canonicalDevicePath, partition)
 	}
 
 	klog.V(5).InfoS("[Debug] Falling back to nvme volume ID lookup", "devicePath", devicePath)
@@ -100,17 +113,23 @@ func (m *NodeMounter) FindDevicePath(devicePath, volumeID, partition, region str
 	// vol-0fab1d5e3f72a5e23 creates a symlink at
 	// /dev/disk/by-id/nvme-Amazon_Elastic_Block_Store_vol0fab1d5e3f72a5e23
 	nvmeName := "nvme-Amazon_Elastic_Block_Store_" + strippedVolumeName
-	nvmeDevicePath, err := findNvmeVolume(nvmeName)
+	candidates := []string{devicePath, filepath.Join(devRoot, "disk", "by-id", nvmeName)}
+	nvmeDevicePath, err = findNvmeVolume(nvmeName)
+	if err != nil {
+		klog.V(5).InfoS("[Debug] error searching for nvme path, scanning /dev/disk/by-id/", "nvmeName", nvmeName, "err", err)
+		// Some AMIs name the symlinks differently, for example with a namespace suffix, but still include the volume ID
+		nvmeDevicePath, err = findNvmeVolumeByIDScan(strippedVolumeName)
+	}
 
 	if err == nil {
-		klog.V(5).InfoS("[Debug] successfully resolved", "nvmeName", nvmeName, "nvmeDevicePath", nvmeDevicePath)
+		klog.V(5).InfoS("[Debug] successfully resolved", "volumeID", volumeID, "nvmeDevicePath", nvmeDevicePath)
 		canonicalDevicePath = nvmeDevicePath
 		if err = verifyVolumeSerialMatch(canonicalDevicePath, strippedVolumeName, execRunner); err != nil {
 			return "", err
 		}
-		return m.appendPartition(canonicalDevicePath, partition), nil
+		return m.resolvePartition(canonicalDevicePath, partition)
 	} else {
-		klog.V(5).InfoS("[Debug] error searching for nvme path", "nvmeName", nvmeName, "err", err)
+		klog.V(5).InfoS("[Debug] error scanning /dev/disk/by-id/ for nvme path", "volumeID", volumeID, "err", err)
 	}
 
 	if util.IsSBE(region) {
@@ -123,17 +142,37 @@ func (m *NodeMounter) FindDevicePath(devicePath, volumeID, partition, region str
 	}
 
 	if canonicalDevicePath == "" {
-		return "", fmt.Errorf("no device path for device %q volume %q found", devicePath, volumeID)
+		return "", fmt.Errorf("no device path for device %q volume %q found, checked: %v", devicePath, volumeID, candidates)
 	}
 
-	canonicalDevicePath = m.appendPartition(canonicalDevicePath, partition)
-	return canonicalDevicePath, nil
+	return m.resolvePartition(canonicalDevicePath, partition)
+}
+
+// findNvmeVolumeBySerial looks for the nvme block device whose serial matches the stripped volume ID
+// EBS NVMe controllers report the volume ID without the dash as their serial number, for example
+// /sys/block/nvme1n1/device/serial contains vol0fab1d5e3f72a5e23 (padded with spaces)
+func findNvmeVolumeBySerial(root, strippedVolumeName string) (string, error) {
+	entries, err := filepath.Glob(filepath.Join(root, "block", "nvme*"))
+	if err != nil {
+		return "", fmt.Errorf("failed to list nvme block devices: %w", err)
+	}
+	for _, entry := range entries {
+		serial, err := os.ReadFile(filepath.Join(entry, "device", "serial"))
+		if err != nil {
+			klog.V(6).InfoS("Skipping nvme block device without a readable serial", "path", entry, "err", err)
+			continue
+		}
+		if strings.TrimSpace(string(serial)) == strippedVolumeName {
+			return filepath.Join("/dev", filepath.Base(entry)), nil
+		}
+	}
+	return "", fmt.Errorf("no nvme block device with serial %q found", strippedVolumeName)
 }
 
 // findNvmeVolume looks for the nvme volume with the specified name
 // It follows the symlink (if it exists) and returns the absolute path to the device
 func findNvmeVolume(findName string) (device string, err error) {
-	p := filepath.Join("/dev/disk/by-id/", findName)
+	p := filepath.Join(devRoot, "disk", "by-id", findName)
 	stat, err := os.Lstat(p)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -147,6 +186,34 @@ func findNvmeVolume(findName string) (device string, err error) {
 		klog.InfoS("nvme file found, but was not a symlink", "path", p)
 		return "", fmt.Errorf("nvme file %q found, but was not a symlink", p)
 	}
+	return resolveDiskByIDSymlink(p)
+}
+
+// findNvmeVolumeByIDScan looks for a /dev/disk/by-id/ symlink whose name contains the stripped volume ID
+// Partition symlinks, such as nvme-Amazon_Elastic_Block_Store_vol0fab1d5e3f72a5e23-part1, are skipped
+func findNvmeVolumeByIDScan(strippedVolumeName string) (string, error) {
+	dir := filepath.Join(devRoot, "disk", "by-id")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to list %q: %w", dir, err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.Contains(name, strippedVolumeName) || strings.Contains(name, "-part") || entry.Type()&os.ModeSymlink == 0 {
+			continue
+		}
+		resolved, err := resolveDiskByIDSymlink(filepath.Join(dir, name))
+		if err != nil {
+			klog.V(5).InfoS("[Debug] skipping /dev/disk/by-id/ symlink", "name", name, "err", err)
+			continue
+		}
+		return resolved, nil
+	}
+	return "", fmt.Errorf("no symlink containing %q found in %q", strippedVolumeName, dir)
+}
+
+// resolveDiskByIDSymlink resolves the /dev/disk/by-id/ symlink to the absolute path of the device
+func resolveDiskByIDSymlink(p string) (string, error) {
 	// Find the target, resolving to an absolute path
 	// For example, /dev/disk/by-id/nvme-Amazon_Elastic_Block_Store_vol0fab1d5e3f72a5e23 -> ../../nvme2n1
 	resolved, err := filepath.EvalSymlinks(p)
@@ -154,7 +221,7 @@ func findNvmeVolume(findName string) (device string, err error) {
 		return "", fmt.Errorf("error reading target of symlink %q: %w", p, err)
 	}
 
-	if !strings.HasPrefix(resolved, "/dev") {
+	if !strings.HasPrefix(resolved, devRoot) {
 		return "", fmt.Errorf("resolved symlink for %q was unexpected: %q", p, resolved)
 	}
 
@@ -202,7 +269,14 @@ func (m *NodeMounter) PreparePublishTarget(target string) error {
 	return nil
 }
 
+// devRoot is the directory of the device nodes and of the udev /dev/disk/ symlinks, overridden in tests
+var devRoot = "/dev"
+
+// sysfsRoot is the mount point of sysfs, overridden in tests to point at fixture layouts
+var sysfsRoot = "/sys"
+
 // IsBlockDevice checks if the given path is a block device
+// Device-mapper targets such as LVM logical volumes (/dev/mapper/*, /dev/dm-*) are block devices as well
 func (m *NodeMounter) IsBlockDevice(fullPath string) (bool, error) {
 	var st unix.Stat_t
 	err := unix.Stat(fullPath, &st)
@@ -214,7 +288,18 @@ func (m *NodeMounter) IsBlockDevice(fullPath string) (bool, error) {
 }
 
 // GetBlockSizeBytes gets the size of the disk in bytes
+// The size is read from sysfs (which works for nvme, xvd and device-mapper devices alike), falling back to blockdev
 func (m *NodeMounter) GetBlockSizeBytes(devicePath string) (int64, error) {
+	sysfsPath, err := sysfsBlockDevicePath(sysfsRoot, devicePath)
+	if err == nil {
+		size, sizeErr := sysfsBlockSizeBytes(sysfsPath)
+		if sizeErr == nil {
+			return size, nil
+		}
+		err = sizeErr
+	}
+	klog.V(5).InfoS("[Debug] Could not read block device size from sysfs, falling back to blockdev", "devicePath", devicePath, "err", err)
+
 	output, err := m.Exec.Command("blockdev", "--getsize64", devicePath).Output()
 	if err != nil {
 		return -1, fmt.Errorf("error when getting size of block volume at path %s: output: %s, err: %w", devicePath, string(output), err)
@@ -227,6 +312,172 @@ func (m *NodeMounter) GetBlockSizeBytes(devicePath string) (int64, error) {
 	return gotSizeBytes, nil
 }
 
+// IsDeviceMapper checks if the given device is a device-mapper target (for example an LVM logical volume)
+func (m *NodeMounter) IsDeviceMapper(devicePath string) (bool, error) {
+	sysfsPath, err := sysfsBlockDevicePath(sysfsRoot, devicePath)
+	if err != nil {
+		return false, err
+	}
+	return isSysfsDeviceMapper(sysfsPath)
+}
+
+// GetPartition returns the disk and number of the partition at devicePath
+// Empty strings are returned if the device is a whole disk
+func (m *NodeMounter) GetPartition(devicePath string) (string, string, error) {
+	sysfsPath, err := sysfsBlockDevicePath(sysfsRoot, devicePath)
+	if err != nil {
+		return "", "", err
+	}
+	return sysfsPartitionDevice(sysfsPath)
+}
+
+// GrowPartition grows the given partition of the disk at diskPath to fill the disk using growpart
+// It returns false without error if no partition is given or the partition already fills the disk
+func (m *NodeMounter) GrowPartition(diskPath, partition string) (bool, error) {
+	if partition == "" {
+		return false, nil
+	}
+
+	klog.V(4).InfoS("Growing partition", "disk", diskPath, "partition", partition)
+	output, err := m.Exec.Command("growpart", diskPath, partition).CombinedOutput()
+	if err != nil {
+		// growpart exits with status 1 and reports NOCHANGE when the partition cannot be grown any further
+		if strings.Contains(string(output), "NOCHANGE") {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to grow partition %s of %s: output: %s, err: %w", partition, diskPath, string(output), err)
+	}
+	return true, nil
+}
+
+// sysfsPartitionDevice returns the disk device and partition number of a sysfs block device directory
+func sysfsPartitionDevice(sysfsPath string) (string, string, error) {
+	disk, partition, err := sysfsPartition(sysfsPath)
+	if err != nil || partition == "" {
+		return "", "", err
+	}
+	return filepath.Join("/dev", disk), partition, nil
+}
+
+// sysfsPartition returns the parent disk name and partition number of a sysfs block device directory
+// Partitions are nested under their disk and expose a partition attribute; an empty partition is returned for whole disks
+func sysfsPartition(sysfsPath string) (string, string, error) {
+	output, err := os.ReadFile(filepath.Join(sysfsPath, "partition"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", "", nil
+		}
+		return "", "", fmt.Errorf("failed to read partition of %q: %w", sysfsPath, err)
+	}
+	partition := strings.TrimSpace(string(output))
+	if n, err := strconv.Atoi(partition); err != nil || n <= 0 {
+		return "", "", fmt.Errorf("invalid partition number %q for %q", partition, sysfsPath)
+	}
+	return filepath.Base(filepath.Dir(sysfsPath)), partition, nil
+}
+
+// sysfsBlockDevicePath resolves a block device node to its sysfs directory through /sys/dev/block/<major>:<minor>
+// For example, /dev/nvme1n1 -> /sys/devices/pci0000:00/0000:00:1f.0/nvme/nvme1/nvme1n1 and /dev/mapper/vg-lv -> /sys/devices/virtual/block/dm-0
+func sysfsBlockDevicePath(root, devicePath string) (string, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(devicePath, &st); err != nil {
+		return "", fmt.Errorf("failed to stat %q: %w", devicePath, err)
+	}
+	if (st.Mode & unix.S_IFMT) != unix.S_IFBLK {
+		return "", fmt.Errorf("%q is not a block device", devicePath)
+	}
+
+	//nolint:unconvert // Rdev is not uint64 on all architectures
+	rdev := uint64(st.Rdev)
+	return sysfsBlockDevicePathFromNumber(root, unix.Major(rdev), unix.Minor(rdev))
+}
+
+// sysfsBlockDevicePathFromNumber resolves a device number to its sysfs directory
+func sysfsBlockDevicePathFromNumber(root string, major, minor uint32) (string, error) {
+	p := filepath.Join(root, "dev", "block", fmt.Sprintf("%d:%d", major, minor))
+	resolved, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve sysfs path %q: %w", p, err)
+	}
+	return resolved, nil
+}
+
+// sysfsBlockSizeBytes reads the size of a block device from its sysfs directory
+// The size attribute is always expressed in 512-byte sectors, independent of the logical block size in queue/
+func sysfsBlockSizeBytes(sysfsPath string) (int64, error) {
+	output, err := os.ReadFile(filepath.Join(sysfsPath, "size"))
+	if err != nil {
+		return -1, fmt.Errorf("failed to read size of %q: %w", sysfsPath, err)
+	}
+	strOut := strings.TrimSpace(string(output))
+	sectors, err := strconv.ParseInt(strOut, 10, 64)
+	if err != nil {
+		return -1, fmt.Errorf("failed to parse size %s as int", strOut)
+	}
+	return sectors * 512, nil
+}
+
+// isSysfsDeviceMapper checks if a sysfs block device directory belongs to a device-mapper target
+// Device-mapper devices expose a dm/ subdirectory containing the mapping name and uuid
+func isSysfsDeviceMapper(sysfsPath string) (bool, error) {
+	_, err := os.Stat(filepath.Join(sysfsPath, "dm"))
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// resolvePartition returns the path of the partition of the device, given either as a partition number or as a
+// PartitionLabelPrefix-prefixed GPT partition label
+func (m *NodeMounter) resolvePartition(devicePath, partition string) (string, error) {
+	label, isLabel := strings.CutPrefix(partition, PartitionLabelPrefix)
+	if !isLabel {
+		return m.appendPartition(devicePath, partition), nil
+	}
+
+	// Volumes created from the same image share their partition labels, and udev points the /dev/disk/by-partlabel
+	// symlinks at only one of them, so the label is looked up among the partitions of this device instead. Partitions
+	// are nested under their disk in sysfs, and their uevent reports the GPT partition label as PARTNAME.
+	diskDir := filepath.Join(sysfsRoot, "block", filepath.Base(devicePath))
+	entries, err := os.ReadDir(diskDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to list the partitions of device %q: %w", devicePath, err)
+	}
+	var partitionPaths []string
+	for _, entry := range entries {
+		uevent, err := os.ReadFile(filepath.Join(diskDir, entry.Name(), "uevent"))
+		if err != nil {
+			continue
+		}
+		properties := parseUevent(uevent)
+		if properties["DEVTYPE"] == "partition" && properties["PARTNAME"] == label {
+			partitionPaths = append(partitionPaths, filepath.Join(devRoot, properties["DEVNAME"]))
+		}
+	}
+	switch len(partitionPaths) {
+	case 0:
+		return "", fmt.Errorf("device %q has no partition labeled %q", devicePath, label)
+	case 1:
+		return partitionPaths[0], nil
+	default:
+		return "", fmt.Errorf("device %q has several partitions labeled %q: %v", devicePath, label, partitionPaths)
+	}
+}
+
+// parseUevent returns the KEY=value properties of a sysfs uevent file
+func parseUevent(content []byte) map[string]string {
+	properties := map[string]string{}
+	for _, line := range strings.Split(string(content), "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			properties[key] = value
+		}
+	}
+	return properties
+}
+
 // appendPartition appends the partition to the device path
 func (m *NodeMounter) appendPartition(devicePath, partition string) string {
 	if partition == "" {
@@ -268,12 +519,24 @@ func (m *NodeMounter) MakeFile(path string) error {
 // This function is mirrored in ./sanity_test.go to make sure sanity test covered this block of code
 // Please mirror the change to func MakeFile in ./sanity_test.go
 func (m *NodeMounter) MakeDir(path string) error {
-	err := os.MkdirAll(path, os.FileMode(0755))
+	_, statErr := os.Stat(path)
+	existed := statErr == nil
+	mode := m.dirMode
+	if mode == 0 {
+		mode = DefaultDirMode
+	}
+	err := os.MkdirAll(path, mode)
 	if err != nil {
 		if !os.IsExist(err) {
 			return err
 		}
 	}
+	// MkdirAll applies the umask, so set a configured mode explicitly
+	if m.dirMode != 0 && (!existed || m.chmodExistingDirs) {
+		if err := os.Chmod(path, m.dirMode); err != nil {
+			return fmt.Errorf("could not set mode %#o on dir %q: %w", m.dirMode, path, err)
+		}
+	}
 	return nil
 }
 
@@ -283,6 +546,26 @@ func (m *NodeMounter) PathExists(path string) (bool, error) {
 	return mountutils.PathExists(path)
 }
 
+// FormatAndMountSensitiveWithFormatOptions formats source, if it is not formatted yet, and mounts it at target
+// The commands checking and formatting the device are run with ctx, so a wedged mkfs is killed when ctx is done
+func (m *NodeMounter) FormatAndMountSensitiveWithFormatOptions(ctx context.Context, source string, target string, fstype string, options []string, sensitiveOptions []string, formatOptions []string) error {
+	mounter := &mountutils.SafeFormatAndMount{
+		Interface: m.Interface,
+		Exec:      &contextExec{Interface: m.Exec, ctx: ctx},
+	}
+	return mounter.FormatAndMountSensitiveWithFormatOptions(source, target, fstype, options, sensitiveOptions, formatOptions)
+}
+
+// contextExec runs every command created with Command with ctx
+type contextExec struct {
+	utilexec.Interface
+	ctx context.Context
+}
+
+func (e *contextExec) Command(cmd string, args ...string) utilexec.Cmd {
+	return e.Interface.CommandContext(e.ctx, cmd, args...)
+}
+
 // Resize resizes the filesystem of the given devicePath
 func (m *NodeMounter) Resize(devicePath, deviceMountPath string) (bool, error) {
 	return mountutils.NewResizeFs(m.Exec).Resize(devicePath, deviceMountPath)
@@ -313,3 +596,84 @@ func (m *NodeMounter) Unstage(path string) error {
 		return err
 	}
 }
+
+// ForceUnmount lazily detaches the mount at path, even while it is busy, and removes path.
+// It succeeds when path is not mounted or does not exist.
+func (m *NodeMounter) ForceUnmount(path string) error {
+	if err := unix.Unmount(path, unix.MNT_DETACH); err != nil && !errors.Is(err, unix.EINVAL) && !errors.Is(err, unix.ENOENT) {
+		return fmt.Errorf("failed to detach mount %q: %w", path, err)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %q: %w", path, err)
+	}
+	return nil
+}
+
+// SyncFilesystem flushes the dirty data of the filesystem mounted at path to its device
+func (m *NodeMounter) SyncFilesystem(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %q: %w", path, err)
+	}
+	defer f.Close()
+	if err := unix.Syncfs(int(f.Fd())); err != nil {
+		return fmt.Errorf("failed to sync filesystem mounted at %q: %w", path, err)
+	}
+	return nil
+}
+
+// SetXFSProjectQuota assigns the directory tree at path to the given XFS project using xfs_quota
+// Limits are only enforced when the filesystem is mounted with the pquota option
+func (m *NodeMounter) SetXFSProjectQuota(path string, projectID uint32) error {
+	klog.V(4).InfoS("Setting XFS project", "path", path, "projectID", projectID)
+	output, err := m.Exec.Command("xfs_quota", "-x", "-c", fmt.Sprintf("project -s -p %s %d", path, projectID), path).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to set XFS project %d on %q: output: %s, err: %w", projectID, path, string(output), err)
+	}
+	return nil
+}
+
+// DeviceSerialMatches checks if the nvme block device at devicePath reports the serial of the given volume
+// Devices that do not expose a serial in sysfs (for example non-nvme or already detached devices) never match
+func DeviceSerialMatches(devicePath, volumeID string) (bool, error) {
+	serial, err := os.ReadFile(filepath.Join(sysfsRoot, "block", filepath.Base(devicePath), "device", "serial"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read serial of %q: %w", devicePath, err)
+	}
+	return strings.TrimSpace(string(serial)) == strings.ReplaceAll(volumeID, "-", ""), nil
+}
+
+// statfs is unix.Statfs, overridden in tests
+var statfs = unix.Statfs
+
+// IsMemoryBackedPath checks if path resides on a tmpfs or ramfs filesystem, whose contents are lost on reboot
+func IsMemoryBackedPath(path string) (bool, error) {
+	var st unix.Statfs_t
+	if err := statfs(path, &st); err != nil {
+		return false, fmt.Errorf("failed to statfs %q: %w", path, err)
+	}
+	return st.Type == unix.TMPFS_MAGIC || st.Type == unix.RAMFS_MAGIC, nil
+}
+
+// procMountsPath is the mount table read by IsMountedReadOnly, overridden in tests
+var procMountsPath = "/proc/mounts"
+
+// IsMountedReadOnly checks if the filesystem mounted at path is mounted read-only, for example because the kernel
+// remounted it after an error. Paths that are not mount points are not read-only.
+func IsMountedReadOnly(path string) (bool, error) {
+	mountPoints, err := mountutils.ListProcMounts(procMountsPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to list mounts: %w", err)
+	}
+	// The last mount at path is the one visible there
+	readOnly := false
+	for _, mp := range mountPoints {
+		if mp.Path == path {
+			readOnly = slices.Contains(mp.Opts, "ro")
+		}
+	}
+	return readOnly, nil
+}
@@ -20,12 +20,16 @@ limitations under the License.
 package mounter
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
 	"k8s.io/mount-utils"
 
 	utilexec "k8s.io/utils/exec"
@@ -71,7 +75,7 @@ func TestNeedResize(t *testing.T) {
 				Interface: mount.New(""),
 				Exec:      &fexec,
 			}
-			fakeMounter := NodeMounter{&safe}
+			fakeMounter := NodeMounter{SafeFormatAndMount: &safe}
 
 			needResize, err := fakeMounter.NeedResize(test.devicePath, test.deviceMountPath)
 			if needResize != test.expectResult {
@@ -94,7 +98,7 @@ func TestMakeDir(t *testing.T) {
 
 	targetPath := filepath.Join(dir, "targetdir")
 
-	mountObj, err := NewNodeMounter(false)
+	mountObj, err := NewNodeMounter(false, 0, false)
 	if err != nil {
 		t.Fatalf("error creating mounter %v", err)
 	}
@@ -112,6 +116,94 @@ func TestMakeDir(t *testing.T) {
 	}
 }
 
+func TestMakeDirMode(t *testing.T) {
+	testCases := []struct {
+		name              string
+		dirMode           os.FileMode
+		chmodExistingDirs bool
+		existing          bool
+		expectedMode      os.FileMode
+	}{
+		{
+			name:         "new dir with configured mode",
+			dirMode:      0750,
+			expectedMode: 0750,
+		},
+		{
+			name:         "existing dir is not changed",
+			dirMode:      0750,
+			existing:     true,
+			expectedMode: 0700,
+		},
+		{
+			name:              "existing dir is changed when requested",
+			dirMode:           0750,
+			chmodExistingDirs: true,
+			existing:          true,
+			expectedMode:      0750,
+		},
+		{
+			name:              "existing dir is not changed without configured mode",
+			chmodExistingDirs: true,
+			existing:          true,
+			expectedMode:      0700,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			targetPath := filepath.Join(t.TempDir(), "parent", "targetdir")
+			if tc.existing {
+				if err := os.MkdirAll(targetPath, 0700); err != nil {
+					t.Fatalf("error creating directory %v", err)
+				}
+			}
+
+			mountObj, err := NewNodeMounter(false, tc.dirMode, tc.chmodExistingDirs)
+			if err != nil {
+				t.Fatalf("error creating mounter %v", err)
+			}
+			if err := mountObj.MakeDir(targetPath); err != nil {
+				t.Fatalf("Expect no error but got: %v", err)
+			}
+
+			info, err := os.Stat(targetPath)
+			if err != nil {
+				t.Fatalf("error checking directory %v", err)
+			}
+			if info.Mode().Perm() != tc.expectedMode {
+				t.Fatalf("Expected mode %#o, got %#o", tc.expectedMode, info.Mode().Perm())
+			}
+		})
+	}
+}
+
+func TestForceUnmount(t *testing.T) {
+	dir := t.TempDir()
+	targetPath := filepath.Join(dir, "targetdir")
+	if err := os.Mkdir(targetPath, 0750); err != nil {
+		t.Fatalf("error creating directory %v", err)
+	}
+
+	mountObj, err := NewNodeMounter(false, 0, false)
+	if err != nil {
+		t.Fatalf("error creating mounter %v", err)
+	}
+
+	// The directory is not mounted, it is only removed
+	if err := mountObj.ForceUnmount(targetPath); err != nil {
+		t.Fatalf("Expect no error but got: %v", err)
+	}
+	if _, err := os.Stat(targetPath); !os.IsNotExist(err) {
+		t.Fatalf("Expect %q to be removed, got: %v", targetPath, err)
+	}
+
+	// A missing path is not an error
+	if err := mountObj.ForceUnmount(targetPath); err != nil {
+		t.Fatalf("Expect no error but got: %v", err)
+	}
+}
+
 func TestMakeFile(t *testing.T) {
 	// Setup the full driver and its environment
 	dir, err := os.MkdirTemp("", "mount-ebs-csi")
@@ -122,7 +214,7 @@ func TestMakeFile(t *testing.T) {
 
 	targetPath := filepath.Join(dir, "targetfile")
 
-	mountObj, err := NewNodeMounter(false)
+	mountObj, err := NewNodeMounter(false, 0, false)
 	if err != nil {
 		t.Fatalf("error creating mounter %v", err)
 	}
@@ -151,7 +243,7 @@ func TestPathExists(t *testing.T) {
 
 	targetPath := filepath.Join(dir, "notafile")
 
-	mountObj, err := NewNodeMounter(false)
+	mountObj, err := NewNodeMounter(false, 0, false)
 	if err != nil {
 		t.Fatalf("error creating mounter %v", err)
 	}
@@ -178,7 +270,7 @@ func TestGetDeviceName(t *testing.T) {
 
 	targetPath := filepath.Join(dir, "notafile")
 
-	mountObj, err := NewNodeMounter(false)
+	mountObj, err := NewNodeMounter(false, 0, false)
 	if err != nil {
 		t.Fatalf("error creating mounter %v", err)
 	}
@@ -222,7 +314,7 @@ func TestFindDevicePath(t *testing.T) {
 			verifyErr:       nil,
 			deviceSize:      "1024",
 			cmdOutputFsType: "ext4",
-			expectedErr:     fmt.Errorf("no device path for device %q volume %q found", "/temp/vol-1234567890abcdef0", "vol-1234567890abcdef0"),
+			expectedErr:     fmt.Errorf("no device path for device %q volume %q found, checked: %v", "/temp/vol-1234567890abcdef0", "vol-1234567890abcdef0", []string{"/temp/vol-1234567890abcdef0", "/dev/disk/by-id/nvme-Amazon_Elastic_Block_Store_vol1234567890abcdef0"}),
 		},
 		{
 			name:            "SBE region fallback",
@@ -238,6 +330,10 @@ func TestFindDevicePath(t *testing.T) {
 		},
 	}
 
+	oldSysfsRoot := sysfsRoot
+	sysfsRoot = t.TempDir()
+	defer func() { sysfsRoot = oldSysfsRoot }()
+
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			var tmpDir string
@@ -274,7 +370,7 @@ func TestFindDevicePath(t *testing.T) {
 				Exec:      &fexec,
 			}
 
-			fakeMounter := NodeMounter{&safe}
+			fakeMounter := NodeMounter{SafeFormatAndMount: &safe}
 
 			if tc.createTempDir {
 				if tc.symlink {
@@ -306,3 +402,749 @@ func TestFindDevicePath(t *testing.T) {
 		})
 	}
 }
+
+func TestFindDevicePathBySerial(t *testing.T) {
+	testCases := []struct {
+		name           string
+		serials        map[string]string
+		devicePath     string
+		volumeID       string
+		partition      string
+		expectedResult string
+		expectErr      bool
+	}{
+		{
+			name: "match by serial with incorrect device path hint",
+			serials: map[string]string{
+				"nvme0n1": "vol0000000000000000a",
+				"nvme1n1": "vol1234567890abcdef0   ",
+			},
+			devicePath:     "/dev/xvdzz",
+			volumeID:       "vol-1234567890abcdef0",
+			expectedResult: "/dev/nvme1n1",
+		},
+		{
+			name: "match by serial with partition",
+			serials: map[string]string{
+				"nvme2n1": "vol1234567890abcdef0",
+			},
+			devicePath:     "/dev/xvdba",
+			volumeID:       "vol-1234567890abcdef0",
+			partition:      "1",
+			expectedResult: "/dev/nvme2n1p1",
+		},
+		{
+			name: "no matching serial falls back to device path",
+			serials: map[string]string{
+				"nvme0n1": "vol0000000000000000a",
+			},
+			devicePath: "/dev/xvdzz",
+			volumeID:   "vol-1234567890abcdef0",
+			expectErr:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := t.TempDir()
+			for name, serial := range tc.serials {
+				deviceDir := filepath.Join(root, "block", name, "device")
+				if err := os.MkdirAll(deviceDir, 0755); err != nil {
+					t.Fatalf("Failed to create fixture device directory: %v", err)
+				}
+				if err := os.WriteFile(filepath.Join(deviceDir, "serial"), []byte(serial+"\n"), 0644); err != nil {
+					t.Fatalf("Failed to write fixture serial: %v", err)
+				}
+			}
+			// nvme block devices without a device/serial attribute must be skipped
+			if err := os.MkdirAll(filepath.Join(root, "block", "nvme9n1"), 0755); err != nil {
+				t.Fatalf("Failed to create fixture device directory: %v", err)
+			}
+
+			oldSysfsRoot := sysfsRoot
+			sysfsRoot = root
+			defer func() { sysfsRoot = oldSysfsRoot }()
+
+			fakeMounter := NodeMounter{SafeFormatAndMount: &mount.SafeFormatAndMount{Interface: mount.New(""), Exec: &fakeexec.FakeExec{}}}
+
+			result, err := fakeMounter.FindDevicePath(tc.devicePath, tc.volumeID, tc.partition, "us-west-2")
+			if tc.expectErr {
+				assert.Error(t, err)
+				assert.Empty(t, result)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedResult, result)
+			}
+		})
+	}
+}
+
+func TestFindDevicePathByIDScan(t *testing.T) {
+	testCases := []struct {
+		name string
+		// symlinks maps the names of the /dev/disk/by-id/ symlinks to their targets, relative to the symlink
+		symlinks       map[string]string
+		expectedDevice string
+		expectErr      bool
+	}{
+		{
+			name: "symlink with a namespace suffix",
+			symlinks: map[string]string{
+				"nvme-Amazon_Elastic_Block_Store_vol1234567890abcdef0_1":       "../../nvme1n1",
+				"nvme-Amazon_Elastic_Block_Store_vol1234567890abcdef0_1-part1": "../../nvme1n1p1",
+				"nvme-Amazon_Elastic_Block_Store_vol0000000000000000a_1":       "../../nvme2n1",
+			},
+			expectedDevice: "nvme1n1",
+		},
+		{
+			name: "only partition symlinks",
+			symlinks: map[string]string{
+				"nvme-Amazon_Elastic_Block_Store_vol1234567890abcdef0-part1": "../../nvme1n1p1",
+			},
+			expectErr: true,
+		},
+		{
+			name: "symlink of another volume",
+			symlinks: map[string]string{
+				"nvme-Amazon_Elastic_Block_Store_vol0000000000000000a": "../../nvme2n1",
+			},
+			expectErr: true,
+		},
+		{
+			name: "symlink outside of /dev",
+			symlinks: map[string]string{
+				"nvme-Amazon_Elastic_Block_Store_vol1234567890abcdef0_1": "../../../nvme1n1",
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := t.TempDir()
+			dev := filepath.Join(root, "dev")
+			byID := filepath.Join(dev, "disk", "by-id")
+			if err := os.MkdirAll(byID, 0755); err != nil {
+				t.Fatalf("Failed to create fixture by-id directory: %v", err)
+			}
+			for _, device := range []string{"nvme1n1", "nvme1n1p1", "nvme2n1"} {
+				for _, dir := range []string{dev, root} {
+					if err := os.WriteFile(filepath.Join(dir, device), nil, 0644); err != nil {
+						t.Fatalf("Failed to create fixture device: %v", err)
+					}
+				}
+			}
+			for name, target := range tc.symlinks {
+				if err := os.Symlink(target, filepath.Join(byID, name)); err != nil {
+					t.Fatalf("Failed to create fixture symlink: %v", err)
+				}
+			}
+
+			// No nvme device reports its serial, so the lookup falls back to /dev/disk/by-id/
+			oldSysfsRoot, oldDevRoot := sysfsRoot, devRoot
+			sysfsRoot, devRoot = t.TempDir(), dev
+			defer func() { sysfsRoot, devRoot = oldSysfsRoot, oldDevRoot }()
+
+			fakeMounter := NodeMounter{SafeFormatAndMount: &mount.SafeFormatAndMount{Interface: mount.New(""), Exec: &fakeexec.FakeExec{}}}
+
+			result, err := fakeMounter.FindDevicePath(filepath.Join(dev, "xvdba"), "vol-1234567890abcdef0", "", "us-west-2")
+			if tc.expectErr {
+				assert.Error(t, err)
+				assert.Empty(t, result)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, filepath.Join(dev, tc.expectedDevice), result)
+			}
+		})
+	}
+}
+
+func TestAppendPartition(t *testing.T) {
+	testCases := []struct {
+		name           string
+		devicePath     string
+		partition      string
+		expectedResult string
+	}{
+		{
+			name:           "nvme without partition",
+			devicePath:     "/dev/nvme0n1",
+			expectedResult: "/dev/nvme0n1",
+		},
+		{
+			name:           "nvme with partition",
+			devicePath:     "/dev/nvme0n1",
+			partition:      "1",
+			expectedResult: "/dev/nvme0n1p1",
+		},
+		{
+			name:           "nvme with multi-digit namespace and partition",
+			devicePath:     "/dev/nvme10n12",
+			partition:      "13",
+			expectedResult: "/dev/nvme10n12p13",
+		},
+		{
+			name:           "xvd without partition",
+			devicePath:     "/dev/xvdba",
+			expectedResult: "/dev/xvdba",
+		},
+		{
+			name:           "xvd with partition",
+			devicePath:     "/dev/xvdba",
+			partition:      "1",
+			expectedResult: "/dev/xvdba1",
+		},
+	}
+
+	fakeMounter := NodeMounter{SafeFormatAndMount: &mount.SafeFormatAndMount{Interface: mount.New(""), Exec: &fakeexec.FakeExec{}}}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedResult, fakeMounter.appendPartition(tc.devicePath, tc.partition))
+		})
+	}
+}
+
+func TestResolvePartitionLabel(t *testing.T) {
+	root := t.TempDir()
+	// Both volumes were created from the same image and share the label of their second partition
+	partitions := map[string]string{
+		"block/nvme1n1/nvme1n1p1": "MAJOR=259\nMINOR=1\nDEVNAME=nvme1n1p1\nDEVTYPE=partition\nPARTN=1\nPARTNAME=boot\n",
+		"block/nvme1n1/nvme1n1p2": "MAJOR=259\nMINOR=2\nDEVNAME=nvme1n1p2\nDEVTYPE=partition\nPARTN=2\nPARTNAME=data\n",
+		"block/nvme2n1/nvme2n1p2": "MAJOR=259\nMINOR=5\nDEVNAME=nvme2n1p2\nDEVTYPE=partition\nPARTN=2\nPARTNAME=data\n",
+		"block/nvme3n1/nvme3n1p1": "MAJOR=259\nMINOR=7\nDEVNAME=nvme3n1p1\nDEVTYPE=partition\nPARTN=1\nPARTNAME=data\n",
+		"block/nvme3n1/nvme3n1p2": "MAJOR=259\nMINOR=8\nDEVNAME=nvme3n1p2\nDEVTYPE=partition\nPARTN=2\nPARTNAME=data\n",
+		// The device directory of a disk has a uevent without PARTNAME
+		"block/nvme1n1/device": "MAJOR=241\nMINOR=1\nDEVNAME=nvme1\n",
+	}
+	for dir, uevent := range partitions {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatalf("Failed to create fixture sysfs directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(root, dir, "uevent"), []byte(uevent), 0644); err != nil {
+			t.Fatalf("Failed to write fixture uevent: %v", err)
+		}
+	}
+
+	testCases := []struct {
+		name           string
+		devicePath     string
+		partition      string
+		expectedResult string
+		expectErr      bool
+	}{
+		{
+			name:           "partition number",
+			devicePath:     "/dev/nvme1n1",
+			partition:      "2",
+			expectedResult: "/dev/nvme1n1p2",
+		},
+		{
+			name:           "partition label of the device",
+			devicePath:     "/dev/nvme1n1",
+			partition:      PartitionLabelPrefix + "data",
+			expectedResult: "/dev/nvme1n1p2",
+		},
+		{
+			name:           "partition label shared with another device",
+			devicePath:     "/dev/nvme2n1",
+			partition:      PartitionLabelPrefix + "data",
+			expectedResult: "/dev/nvme2n1p2",
+		},
+		{
+			name:       "partition label not found",
+			devicePath: "/dev/nvme1n1",
+			partition:  PartitionLabelPrefix + "missing",
+			expectErr:  true,
+		},
+		{
+			name:       "partition label used twice on the device",
+			devicePath: "/dev/nvme3n1",
+			partition:  PartitionLabelPrefix + "data",
+			expectErr:  true,
+		},
+		{
+			name:       "device not found",
+			devicePath: "/dev/nvme4n1",
+			partition:  PartitionLabelPrefix + "data",
+			expectErr:  true,
+		},
+	}
+
+	oldSysfsRoot := sysfsRoot
+	sysfsRoot = root
+	defer func() { sysfsRoot = oldSysfsRoot }()
+
+	fakeMounter := NodeMounter{SafeFormatAndMount: &mount.SafeFormatAndMount{Interface: mount.New(""), Exec: &fakeexec.FakeExec{}}}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := fakeMounter.resolvePartition(tc.devicePath, tc.partition)
+			if tc.expectErr {
+				assert.Error(t, err)
+				assert.Empty(t, result)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedResult, result)
+			}
+		})
+	}
+}
+
+func TestDeviceSerialMatches(t *testing.T) {
+	root := t.TempDir()
+	deviceDir := filepath.Join(root, "block", "nvme1n1", "device")
+	if err := os.MkdirAll(deviceDir, 0755); err != nil {
+		t.Fatalf("Failed to create fixture device directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(deviceDir, "serial"), []byte("vol1234567890abcdef0   \n"), 0644); err != nil {
+		t.Fatalf("Failed to write fixture serial: %v", err)
+	}
+
+	oldSysfsRoot := sysfsRoot
+	sysfsRoot = root
+	defer func() { sysfsRoot = oldSysfsRoot }()
+
+	testCases := []struct {
+		name       string
+		devicePath string
+		volumeID   string
+		expected   bool
+	}{
+		{
+			name:       "matching serial",
+			devicePath: "/dev/nvme1n1",
+			volumeID:   "vol-1234567890abcdef0",
+			expected:   true,
+		},
+		{
+			name:       "serial of another volume",
+			devicePath: "/dev/nvme1n1",
+			volumeID:   "vol-0000000000000000a",
+		},
+		{
+			name:       "device without serial",
+			devicePath: "/dev/nvme2n1",
+			volumeID:   "vol-1234567890abcdef0",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			matches, err := DeviceSerialMatches(tc.devicePath, tc.volumeID)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, matches)
+		})
+	}
+}
+
+func TestSysfsBlockDevice(t *testing.T) {
+	testCases := []struct {
+		name                 string
+		devNumber            string
+		devicePath           string
+		sizeSectors          string
+		deviceMapper         bool
+		expectedSize         int64
+		expectedDeviceMapper bool
+	}{
+		{
+			name:         "nvme",
+			devNumber:    "259:1",
+			devicePath:   "devices/pci0000:00/0000:00:1f.0/nvme/nvme1/nvme1n1",
+			sizeSectors:  "2097152",
+			expectedSize: 1073741824,
+		},
+		{
+			name:         "xvd",
+			devNumber:    "202:80",
+			devicePath:   "devices/vbd-51792/block/xvdf",
+			sizeSectors:  "41943040",
+			expectedSize: 21474836480,
+		},
+		{
+			name:                 "dm",
+			devNumber:            "253:0",
+			devicePath:           "devices/virtual/block/dm-0",
+			sizeSectors:          "8388608",
+			deviceMapper:         true,
+			expectedSize:         4294967296,
+			expectedDeviceMapper: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := t.TempDir()
+
+			devDir := filepath.Join(root, tc.devicePath)
+			if err := os.MkdirAll(devDir, 0755); err != nil {
+				t.Fatalf("Failed to create fixture device directory: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(devDir, "size"), []byte(tc.sizeSectors+"\n"), 0644); err != nil {
+				t.Fatalf("Failed to write fixture size: %v", err)
+			}
+			if tc.deviceMapper {
+				if err := os.MkdirAll(filepath.Join(devDir, "dm"), 0755); err != nil {
+					t.Fatalf("Failed to create fixture dm directory: %v", err)
+				}
+			}
+			if err := os.MkdirAll(filepath.Join(root, "dev", "block"), 0755); err != nil {
+				t.Fatalf("Failed to create fixture dev/block directory: %v", err)
+			}
+			if err := os.Symlink(filepath.Join("..", "..", tc.devicePath), filepath.Join(root, "dev", "block", tc.devNumber)); err != nil {
+				t.Fatalf("Failed to create fixture symlink: %v", err)
+			}
+
+			var major, minor uint32
+			if _, err := fmt.Sscanf(tc.devNumber, "%d:%d", &major, &minor); err != nil {
+				t.Fatalf("Failed to parse device number: %v", err)
+			}
+
+			sysfsPath, err := sysfsBlockDevicePathFromNumber(root, major, minor)
+			assert.NoError(t, err)
+			assert.Equal(t, devDir, sysfsPath)
+
+			size, err := sysfsBlockSizeBytes(sysfsPath)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedSize, size)
+
+			isDeviceMapper, err := isSysfsDeviceMapper(sysfsPath)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedDeviceMapper, isDeviceMapper)
+		})
+	}
+}
+
+func TestSysfsBlockDevicePathNotFound(t *testing.T) {
+	root := t.TempDir()
+	if _, err := sysfsBlockDevicePathFromNumber(root, 259, 7); err == nil {
+		t.Fatal("Expected error for missing device number")
+	}
+}
+
+func TestGrowPartition(t *testing.T) {
+	testCases := []struct {
+		name           string
+		sysfsPath      string
+		partition      string
+		growpartOutput string
+		growpartErr    error
+		expectedArgs   []string
+		expectedResult bool
+		expectErr      bool
+	}{
+		{
+			name:           "partition 1 grown",
+			sysfsPath:      "devices/pci0000:00/0000:00:1f.0/nvme/nvme1/nvme1n1/nvme1n1p1",
+			partition:      "1",
+			growpartOutput: "CHANGED: partition=1 start=2048 old: size=2095104 end=2097152 new: size=4192256 end=4194304",
+			expectedArgs:   []string{"/dev/nvme1n1", "1"},
+			expectedResult: true,
+		},
+		{
+			name:           "partition already fills disk",
+			sysfsPath:      "devices/vbd-51792/block/xvdf/xvdf1",
+			partition:      "1",
+			growpartOutput: "NOCHANGE: partition 1 is size 4192256. it cannot be grown",
+			growpartErr:    &fakeexec.FakeExitError{Status: 1},
+			expectedArgs:   []string{"/dev/xvdf", "1"},
+			expectedResult: false,
+		},
+		{
+			name:           "no partition",
+			sysfsPath:      "devices/pci0000:00/0000:00:1f.0/nvme/nvme1/nvme1n1",
+			expectedResult: false,
+		},
+		{
+			name:      "invalid partition number",
+			sysfsPath: "devices/pci0000:00/0000:00:1f.0/nvme/nvme1/nvme1n1/nvme1n1p0",
+			partition: "0",
+			expectErr: true,
+		},
+		{
+			name:           "growpart failure",
+			sysfsPath:      "devices/pci0000:00/0000:00:1f.0/nvme/nvme1/nvme1n1/nvme1n1p2",
+			partition:      "2",
+			growpartOutput: "FAILED: failed to resize",
+			growpartErr:    &fakeexec.FakeExitError{Status: 2},
+			expectedArgs:   []string{"/dev/nvme1n1", "2"},
+			expectErr:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sysfsPath := filepath.Join(t.TempDir(), tc.sysfsPath)
+			if err := os.MkdirAll(sysfsPath, 0755); err != nil {
+				t.Fatalf("Failed to create fixture device directory: %v", err)
+			}
+			if tc.partition != "" {
+				if err := os.WriteFile(filepath.Join(sysfsPath, "partition"), []byte(tc.partition+"\n"), 0644); err != nil {
+					t.Fatalf("Failed to write fixture partition: %v", err)
+				}
+			}
+
+			var gotCmd string
+			var gotArgs []string
+			fcmd := fakeexec.FakeCmd{
+				CombinedOutputScript: []fakeexec.FakeAction{
+					func() ([]byte, []byte, error) { return []byte(tc.growpartOutput), nil, tc.growpartErr },
+				},
+			}
+			fexec := fakeexec.FakeExec{
+				CommandScript: []fakeexec.FakeCommandAction{
+					func(cmd string, args ...string) utilexec.Cmd {
+						gotCmd, gotArgs = cmd, args
+						return fakeexec.InitFakeCmd(&fcmd, cmd, args...)
+					},
+				},
+			}
+			fakeMounter := NodeMounter{SafeFormatAndMount: &mount.SafeFormatAndMount{Interface: mount.New(""), Exec: &fexec}}
+
+			diskPath, partition, err := sysfsPartitionDevice(sysfsPath)
+			grown := false
+			if err == nil {
+				grown, err = fakeMounter.GrowPartition(diskPath, partition)
+			}
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedResult, grown)
+			if tc.expectedArgs != nil {
+				assert.Equal(t, "growpart", gotCmd)
+				assert.Equal(t, tc.expectedArgs, gotArgs)
+			} else {
+				assert.Equal(t, 0, fexec.CommandCalls)
+			}
+		})
+	}
+}
+
+func TestSetXFSProjectQuota(t *testing.T) {
+	testCases := []struct {
+		name      string
+		output    string
+		execErr   error
+		expectErr bool
+	}{
+		{
+			name: "project set",
+		},
+		{
+			name:      "xfs_quota failure",
+			output:    "xfs_quota: cannot setup path for mount /target/path: No such device or address",
+			execErr:   &fakeexec.FakeExitError{Status: 1},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotCmd string
+			var gotArgs []string
+			fcmd := fakeexec.FakeCmd{
+				CombinedOutputScript: []fakeexec.FakeAction{
+					func() ([]byte, []byte, error) { return []byte(tc.output), nil, tc.execErr },
+				},
+			}
+			fexec := fakeexec.FakeExec{
+				CommandScript: []fakeexec.FakeCommandAction{
+					func(cmd string, args ...string) utilexec.Cmd {
+						gotCmd, gotArgs = cmd, args
+						return fakeexec.InitFakeCmd(&fcmd, cmd, args...)
+					},
+				},
+			}
+			fakeMounter := NodeMounter{SafeFormatAndMount: &mount.SafeFormatAndMount{Interface: mount.New(""), Exec: &fexec}}
+
+			err := fakeMounter.SetXFSProjectQuota("/target/path", 42)
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, "xfs_quota", gotCmd)
+			assert.Equal(t, []string{"-x", "-c", "project -s -p /target/path 42", "/target/path"}, gotArgs)
+		})
+	}
+}
+
+func TestIsMemoryBackedPath(t *testing.T) {
+	testCases := []struct {
+		name           string
+		fsType         int64
+		statfsErr      error
+		expectedResult bool
+		expectErr      bool
+	}{
+		{
+			name:           "tmpfs",
+			fsType:         unix.TMPFS_MAGIC,
+			expectedResult: true,
+		},
+		{
+			name:           "ramfs",
+			fsType:         unix.RAMFS_MAGIC,
+			expectedResult: true,
+		},
+		{
+			name:           "ext4",
+			fsType:         unix.EXT4_SUPER_MAGIC,
+			expectedResult: false,
+		},
+		{
+			name:      "statfs error",
+			statfsErr: unix.ENOENT,
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oldStatfs := statfs
+			statfs = func(path string, st *unix.Statfs_t) error {
+				st.Type = tc.fsType
+				return tc.statfsErr
+			}
+			defer func() { statfs = oldStatfs }()
+
+			memoryBacked, err := IsMemoryBackedPath("/var/lib/kubelet/pods")
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedResult, memoryBacked)
+		})
+	}
+}
+
+func TestIsMountedReadOnly(t *testing.T) {
+	mounts := `/dev/nvme0n1p1 / xfs rw,noatime 0 0
+/dev/nvme1n1 /staging/rw ext4 rw,relatime 0 0
+/dev/nvme2n1 /staging/ro ext4 ro,relatime 0 0
+/dev/nvme3n1 /staging/remounted ext4 rw,relatime 0 0
+/dev/nvme3n1 /staging/remounted ext4 ro,relatime 0 0
+`
+	testCases := []struct {
+		name           string
+		path           string
+		expectedResult bool
+	}{
+		{
+			name: "read-write mount",
+			path: "/staging/rw",
+		},
+		{
+			name:           "read-only mount",
+			path:           "/staging/ro",
+			expectedResult: true,
+		},
+		{
+			name:           "read-only mount over read-write mount",
+			path:           "/staging/remounted",
+			expectedResult: true,
+		},
+		{
+			name: "not a mount point",
+			path: "/staging/none",
+		},
+	}
+
+	mountsFile := filepath.Join(t.TempDir(), "mounts")
+	if err := os.WriteFile(mountsFile, []byte(mounts), 0644); err != nil {
+		t.Fatalf("failed to write mounts: %v", err)
+	}
+	oldProcMountsPath := procMountsPath
+	procMountsPath = mountsFile
+	defer func() { procMountsPath = oldProcMountsPath }()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			readOnly, err := IsMountedReadOnly(tc.path)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedResult, readOnly)
+		})
+	}
+
+	t.Run("mount table unreadable", func(t *testing.T) {
+		procMountsPath = filepath.Join(t.TempDir(), "missing")
+		_, err := IsMountedReadOnly("/staging/rw")
+		assert.Error(t, err)
+	})
+}
+
+// blockingExec is a fake exec reporting every device as unformatted, whose mkfs commands block like a wedged mkfs
+// until the context they were created with is done
+type blockingExec struct {
+	fakeexec.FakeExec
+	block bool
+}
+
+func (e *blockingExec) CommandContext(ctx context.Context, cmd string, args ...string) utilexec.Cmd {
+	fcmd := &fakeexec.FakeCmd{
+		CombinedOutputScript: []fakeexec.FakeAction{
+			func() ([]byte, []byte, error) {
+				switch {
+				case cmd == "blkid":
+					return nil, nil, &fakeexec.FakeExitError{Status: 2}
+				case strings.HasPrefix(cmd, "mkfs.") && e.block:
+					<-ctx.Done()
+					return nil, nil, ctx.Err()
+				}
+				return nil, nil, nil
+			},
+		},
+	}
+	return fakeexec.InitFakeCmd(fcmd, cmd, args...)
+}
+
+func TestFormatAndMountSensitiveWithFormatOptions(t *testing.T) {
+	testCases := []struct {
+		name          string
+		block         bool
+		expectErr     bool
+		expectMounted bool
+	}{
+		{
+			name:          "formatted and mounted",
+			expectMounted: true,
+		},
+		{
+			name:      "mkfs killed when the context is done",
+			block:     true,
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fakeMount := mount.NewFakeMounter(nil)
+			fakeMounter := NodeMounter{SafeFormatAndMount: &mount.SafeFormatAndMount{Interface: fakeMount, Exec: &blockingExec{block: tc.block}}}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			done := make(chan error, 1)
+			go func() {
+				done <- fakeMounter.FormatAndMountSensitiveWithFormatOptions(ctx, "/dev/xvdba", "/staging/path", "ext4", nil, nil, nil)
+			}()
+
+			select {
+			case err := <-done:
+				if tc.expectErr {
+					assert.Error(t, err)
+				} else {
+					assert.NoError(t, err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("FormatAndMountSensitiveWithFormatOptions did not return after its context was done")
+			}
+
+			mountPoints, err := fakeMount.List()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectMounted, len(mountPoints) == 1)
+		})
+	}
+}
@@ -20,9 +20,11 @@ limitations under the License.
 package mounter
 
 import (
+	"context"
 	"fmt"
-
+	"os"
 	"regexp"
+	"strconv"
 
 	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/util"
 
@@ -34,6 +36,43 @@ var (
 	ErrUnsupportedMounter = fmt.Errorf("unsupported mounter type")
 )
 
+// physicalDriveRegex matches the path of a disk, which the target of a raw block volume links to
+var physicalDriveRegex = regexp.MustCompile(`(?i)^\\\\\.\\PHYSICALDRIVE(\d+)$`)
+
+// readLink returns the destination of the symbolic link at path, or an empty string if path is not a symbolic link
+var readLink = func(path string) (string, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return "", nil
+	}
+	return os.Readlink(path)
+}
+
+// physicalDrivePath returns the path of the disk with the given number
+func physicalDrivePath(diskNumber int) string {
+	return fmt.Sprintf(`\\.\PHYSICALDRIVE%d`, diskNumber)
+}
+
+// blockDeviceDiskNumber returns the number of the disk that the raw block volume published at path links to
+// The second return value is false if path is not a raw block volume
+func blockDeviceDiskNumber(path string) (string, bool, error) {
+	destination, err := readLink(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("error reading link %q: %w", path, err)
+	}
+	match := physicalDriveRegex.FindStringSubmatch(destination)
+	if match == nil {
+		return "", false, nil
+	}
+	return match[1], true, nil
+}
+
 func (m NodeMounter) FindDevicePath(devicePath, volumeID, _, _ string) (string, error) {
 	switch proxyMounter := m.SafeFormatAndMount.Interface.(type) {
 	case *CSIProxyMounterV2:
@@ -77,24 +116,146 @@ func (m NodeMounter) PreparePublishTarget(target string) error {
 	return nil
 }
 
-// IsBlockDevice checks if the given path is a block device
+// Mount creates a symbolic link at target pointing to source
+// Raw block volumes are published with the disk number found by FindDevicePath as source, see MountBlockDevice
+func (m *NodeMounter) Mount(source string, target string, fstype string, options []string) error {
+	if _, err := strconv.Atoi(source); err != nil {
+		return m.SafeFormatAndMount.Interface.Mount(source, target, fstype, options)
+	}
+	switch proxyMounter := m.SafeFormatAndMount.Interface.(type) {
+	case *CSIProxyMounterV2:
+		return proxyMounter.MountBlockDevice(source, target)
+	case *CSIProxyMounter:
+		return proxyMounter.MountBlockDevice(source, target)
+	default:
+		return ErrUnsupportedMounter
+	}
+}
+
+// IsLikelyNotMountPoint checks if path is not a mount point
+// A raw block volume links to a disk rather than a directory, which csi-proxy cannot inspect, so it is recognized by
+// the destination of its link instead
+func (m *NodeMounter) IsLikelyNotMountPoint(path string) (bool, error) {
+	if _, isBlock, err := blockDeviceDiskNumber(path); err == nil && isBlock {
+		return false, nil
+	}
+	return m.SafeFormatAndMount.Interface.IsLikelyNotMountPoint(path)
+}
+
+// IsBlockDevice checks if the given path is a raw block volume, which is a symbolic link to a disk
 func (m NodeMounter) IsBlockDevice(fullPath string) (bool, error) {
+	_, isBlock, err := blockDeviceDiskNumber(fullPath)
+	return isBlock, err
+}
+
+// IsDeviceMapper checks if the given device is a device-mapper target
+// Device-mapper does not exist on Windows
+func (m NodeMounter) IsDeviceMapper(devicePath string) (bool, error) {
+	return false, nil
+}
+
+// GetPartition returns the disk and number of the partition at devicePath
+// Partitions are not supported on Windows, so devices are always reported as whole disks
+func (m NodeMounter) GetPartition(devicePath string) (string, string, error) {
+	return "", "", nil
+}
+
+// GrowPartition grows the given partition of the disk to fill it
+// On Windows, Resize extends the partition along with the filesystem so this is a no-op
+func (m NodeMounter) GrowPartition(diskPath, partition string) (bool, error) {
+	return false, nil
+}
+
+// SyncFilesystem flushes the dirty data of the filesystem mounted at path to its device
+// Filesystems cannot be flushed through CSI Proxy, so this is a no-op on Windows
+func (m *NodeMounter) SyncFilesystem(path string) error {
+	return nil
+}
+
+// SetXFSProjectQuota assigns the directory tree at path to the given XFS project
+// XFS does not exist on Windows
+func (m *NodeMounter) SetXFSProjectQuota(path string, projectID uint32) error {
+	return fmt.Errorf("XFS project quotas are not supported on Windows")
+}
+
+// GetDiskFormat returns the filesystem on the disk
+// CSI Proxy does not expose the filesystem of unmounted disks, so disks are always reported blank on Windows
+func (m *NodeMounter) GetDiskFormat(devicePath string) (string, error) {
+	return "", nil
+}
+
+// IsLuks checks if the device has a LUKS header
+// LUKS is not supported on Windows, so no device has one
+func (m *NodeMounter) IsLuks(devicePath string) (bool, error) {
+	return false, nil
+}
+
+// LuksFormat writes a LUKS header to the device
+// LUKS is not supported on Windows
+func (m *NodeMounter) LuksFormat(devicePath, passphrase string) error {
+	return fmt.Errorf("LUKS encryption is not supported on Windows")
+}
+
+// LuksOpen opens the LUKS device
+// LUKS is not supported on Windows
+func (m *NodeMounter) LuksOpen(devicePath, name, passphrase string) (string, error) {
+	return "", fmt.Errorf("LUKS encryption is not supported on Windows")
+}
+
+// LuksClose closes the LUKS device
+// LUKS is not supported on Windows, so no device is ever open
+func (m *NodeMounter) LuksClose(name string) error {
+	return nil
+}
+
+// LuksResize resizes the LUKS device
+// LUKS is not supported on Windows
+func (m *NodeMounter) LuksResize(name string) error {
+	return fmt.Errorf("LUKS encryption is not supported on Windows")
+}
+
+// DeviceSerialMatches checks if the device at devicePath reports the serial of the given volume
+// Device serials are not exposed through CSI Proxy, so devices never match on Windows
+func DeviceSerialMatches(devicePath, volumeID string) (bool, error) {
+	return false, nil
+}
+
+// IsMemoryBackedPath checks if path resides on a tmpfs or ramfs filesystem, whose contents are lost on reboot
+// Windows has no memory-backed filesystems that can hold kubelet directories, so paths are never memory-backed
+func IsMemoryBackedPath(path string) (bool, error) {
 	return false, nil
 }
 
-// getBlockSizeBytes gets the size of the disk in bytes
+// IsMountedReadOnly checks if the filesystem mounted at path is mounted read-only
+// CSI Proxy does not expose mount options, so filesystems are never reported read-only on Windows
+func IsMountedReadOnly(path string) (bool, error) {
+	return false, nil
+}
+
+// GetBlockSizeBytes gets the size of the disk in bytes
+// devicePath is either a disk number or the path a raw block volume is published at
 func (m NodeMounter) GetBlockSizeBytes(devicePath string) (int64, error) {
+	if _, err := strconv.Atoi(devicePath); err != nil {
+		diskNumber, isBlock, err := blockDeviceDiskNumber(devicePath)
+		if err != nil {
+			return -1, err
+		}
+		if !isBlock {
+			return -1, fmt.Errorf("%q is neither a disk number nor a raw block volume", devicePath)
+		}
+		devicePath = diskNumber
+	}
 	switch proxyMounter := m.SafeFormatAndMount.Interface.(type) {
 	case *CSIProxyMounterV2:
 		sizeInBytes, err := proxyMounter.GetDeviceSize(devicePath)
 		if err != nil {
-			return -1, err
+			return -1, fmt.Errorf("error getting the size of disk %s: %w", devicePath, err)
 		}
 		return sizeInBytes, nil
 	case *CSIProxyMounter:
 		sizeInBytes, err := proxyMounter.GetDeviceSize(devicePath)
 		if err != nil {
-			return -1, err
+			return -1, fmt.Errorf("error getting the size of disk %s: %w", devicePath, err)
 		}
 		return sizeInBytes, nil
 	default:
@@ -102,12 +263,12 @@ func (m NodeMounter) GetBlockSizeBytes(devicePath string) (int64, error) {
 	}
 }
 
-func (m NodeMounter) FormatAndMountSensitiveWithFormatOptions(source string, target string, fstype string, options []string, sensitiveOptions []string, formatOptions []string) error {
+func (m NodeMounter) FormatAndMountSensitiveWithFormatOptions(ctx context.Context, source string, target string, fstype string, options []string, sensitiveOptions []string, formatOptions []string) error {
 	switch proxyMounter := m.SafeFormatAndMount.Interface.(type) {
 	case *CSIProxyMounterV2:
-		return proxyMounter.FormatAndMountSensitiveWithFormatOptions(source, target, fstype, options, sensitiveOptions, formatOptions)
+		return proxyMounter.FormatAndMountSensitiveWithFormatOptions(ctx, source, target, fstype, options, sensitiveOptions, formatOptions)
 	case *CSIProxyMounter:
-		return proxyMounter.FormatAndMountSensitiveWithFormatOptions(source, target, fstype, options, sensitiveOptions, formatOptions)
+		return proxyMounter.FormatAndMountSensitiveWithFormatOptions(ctx, source, target, fstype, options, sensitiveOptions, formatOptions)
 	default:
 		return ErrUnsupportedMounter
 	}
@@ -165,15 +326,10 @@ func (m NodeMounter) IsCorruptedMnt(err error) bool {
 	return mountutils.IsCorruptedMnt(err)
 }
 
+// MakeFile is called to create the target of a raw block volume before it is bind mounted on Linux
+// On Windows the target is a symbolic link created by Mount, so there is no file to create
 func (m *NodeMounter) MakeFile(path string) error {
-	switch proxyMounter := m.SafeFormatAndMount.Interface.(type) {
-	case *CSIProxyMounterV2:
-		return proxyMounter.MakeFile(path)
-	case *CSIProxyMounter:
-		return proxyMounter.MakeFile(path)
-	default:
-		return ErrUnsupportedMounter
-	}
+	return nil
 }
 
 func (m *NodeMounter) MakeDir(path string) error {
@@ -245,6 +401,8 @@ func (m *NodeMounter) NeedResize(devicePath, deviceMountPath string) (bool, erro
 }
 
 // Unmount volume from target path
+// For raw block volumes this only removes the link to the disk, the disk stays online until the volume is detached
+// because it may still be published at other targets
 func (m *NodeMounter) Unpublish(target string) error {
 	var err error
 	switch proxyMounter := m.SafeFormatAndMount.Interface.(type) {
@@ -263,6 +421,12 @@ func (m *NodeMounter) Unpublish(target string) error {
 	return nil
 }
 
+// ForceUnmount removes the mount at path. Mounts cannot be detached lazily with the CSI proxy, so it is the same as
+// Unstage.
+func (m *NodeMounter) ForceUnmount(path string) error {
+	return m.Unstage(path)
+}
+
 // Unmount volume from staging path
 // usually this staging path is a global directory on the node
 func (m *NodeMounter) Unstage(target string) error {
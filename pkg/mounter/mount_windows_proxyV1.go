@@ -85,6 +85,12 @@ func (mounter *CSIProxyMounter) Mount(source string, target string, fstype strin
 	return nil
 }
 
+// MountBlockDevice publishes a disk as a raw block volume at target
+// Raw block volumes are supported when the driver runs as a HostProcess container, see CSIProxyMounterV2
+func (mounter *CSIProxyMounter) MountBlockDevice(source string, target string) error {
+	return errors.New("raw block volumes not supported on Windows unless the driver runs as a HostProcess container!")
+}
+
 func (mounter *CSIProxyMounter) Unmount(target string) error {
 	// Find the volume id
 	getVolumeIdRequest := &volume.GetVolumeIDFromTargetPathRequest{
@@ -324,15 +330,15 @@ func (mounter *CSIProxyMounter) FindDiskByLun(lun string) (diskNum string, err e
 }
 
 // FormatAndMount - accepts the source disk number, target path to mount, the fstype to format with and options to be used.
-func (mounter *CSIProxyMounter) FormatAndMountSensitiveWithFormatOptions(source string, target string, fstype string, options []string, sensitiveOptions []string, formatOptions []string) error {
+func (mounter *CSIProxyMounter) FormatAndMountSensitiveWithFormatOptions(ctx context.Context, source string, target string, fstype string, options []string, sensitiveOptions []string, formatOptions []string) error {
 	// sensitiveOptions is not supported on Windows because we have no reasonable way to control what the csi-proxy does
 	if len(sensitiveOptions) > 0 {
 		return errors.New("sensitiveOptions not supported on Windows!")
 	}
-	// formatOptions is not supported on Windows because the csi-proxy does not allow supplying format arguments
-	// This limitation will be addressed in the future with privileged Windows containers
+	// formatOptions is not supported with the csi-proxy because it does not allow supplying format arguments
+	// Format options are supported when the driver runs as a HostProcess container, see CSIProxyMounterV2
 	if len(formatOptions) > 0 {
-		return errors.New("formatOptions not supported on Windows!")
+		return errors.New("formatOptions not supported on Windows unless the driver runs as a HostProcess container!")
 	}
 
 	diskNumber, err := strconv.Atoi(source)
@@ -344,7 +350,7 @@ func (mounter *CSIProxyMounter) FormatAndMountSensitiveWithFormatOptions(source
 	partionDiskRequest := &disk.PartitionDiskRequest{
 		DiskNumber: uint32(diskNumber),
 	}
-	_, err = mounter.DiskClient.PartitionDisk(context.Background(), partionDiskRequest)
+	_, err = mounter.DiskClient.PartitionDisk(ctx, partionDiskRequest)
 	if err != nil {
 		return err
 	}
@@ -354,7 +360,7 @@ func (mounter *CSIProxyMounter) FormatAndMountSensitiveWithFormatOptions(source
 		DiskNumber: uint32(diskNumber),
 		IsOnline:   true,
 	}
-	_, err = mounter.DiskClient.SetDiskState(context.Background(), setDiskStateRequest)
+	_, err = mounter.DiskClient.SetDiskState(ctx, setDiskStateRequest)
 	if err != nil {
 		return err
 	}
@@ -363,7 +369,7 @@ func (mounter *CSIProxyMounter) FormatAndMountSensitiveWithFormatOptions(source
 	volumeIDsRequest := &volume.ListVolumesOnDiskRequest{
 		DiskNumber: uint32(diskNumber),
 	}
-	volumeIdResponse, err := mounter.VolumeClient.ListVolumesOnDisk(context.Background(), volumeIDsRequest)
+	volumeIdResponse, err := mounter.VolumeClient.ListVolumesOnDisk(ctx, volumeIDsRequest)
 	if err != nil {
 		return err
 	}
@@ -376,7 +382,7 @@ func (mounter *CSIProxyMounter) FormatAndMountSensitiveWithFormatOptions(source
 	isVolumeFormattedRequest := &volume.IsVolumeFormattedRequest{
 		VolumeId: volumeID,
 	}
-	isVolumeFormattedResponse, err := mounter.VolumeClient.IsVolumeFormatted(context.Background(), isVolumeFormattedRequest)
+	isVolumeFormattedResponse, err := mounter.VolumeClient.IsVolumeFormatted(ctx, isVolumeFormattedRequest)
 	if err != nil {
 		return err
 	}
@@ -387,7 +393,7 @@ func (mounter *CSIProxyMounter) FormatAndMountSensitiveWithFormatOptions(source
 			VolumeId: volumeID,
 			// TODO: Accept the filesystem and other options
 		}
-		_, err = mounter.VolumeClient.FormatVolume(context.Background(), formatVolumeRequest)
+		_, err = mounter.VolumeClient.FormatVolume(ctx, formatVolumeRequest)
 		if err != nil {
 			return err
 		}
@@ -398,7 +404,7 @@ func (mounter *CSIProxyMounter) FormatAndMountSensitiveWithFormatOptions(source
 		VolumeId:   volumeID,
 		TargetPath: util.NormalizeWindowsPath(target),
 	}
-	_, err = mounter.VolumeClient.MountVolume(context.Background(), mountVolumeRequest)
+	_, err = mounter.VolumeClient.MountVolume(ctx, mountVolumeRequest)
 	if err != nil {
 		return err
 	}
@@ -31,6 +31,7 @@ import (
 	diskapiv2 "github.com/kubernetes-csi/csi-proxy/v2/pkg/disk/hostapi"
 	fsv2 "github.com/kubernetes-csi/csi-proxy/v2/pkg/filesystem"
 	fsapiv2 "github.com/kubernetes-csi/csi-proxy/v2/pkg/filesystem/hostapi"
+	"github.com/kubernetes-csi/csi-proxy/v2/pkg/utils"
 	volumev2 "github.com/kubernetes-csi/csi-proxy/v2/pkg/volume"
 	volumeapiv2 "github.com/kubernetes-csi/csi-proxy/v2/pkg/volume/hostapi"
 	"github.com/kubernetes-sigs/aws-ebs-csi-driver/pkg/util"
@@ -39,6 +40,12 @@ import (
 	utilexec "k8s.io/utils/exec"
 )
 
+// runPowershellCmd runs a PowerShell command on the host
+var runPowershellCmd = utils.RunPowershellCmd
+
+// createSymlink creates a symbolic link on the host
+var createSymlink = os.Symlink
+
 type CSIProxyMounterV2 struct {
 	FsClient     fsv2.Interface
 	DiskClient   diskv2.Interface
@@ -84,6 +91,43 @@ func (mounter *CSIProxyMounterV2) Mount(source string, target string, fstype str
 	return nil
 }
 
+// MountBlockDevice publishes a disk as a raw block volume at target. The disk is brought online without being
+// partitioned or formatted, and target is created as a symbolic link to the disk.
+// csi-proxy refuses to link to paths outside of the host filesystem, so the link is created by the driver directly.
+func (mounter *CSIProxyMounterV2) MountBlockDevice(source string, target string) error {
+	diskNumber, err := strconv.Atoi(source)
+	if err != nil {
+		return err
+	}
+
+	setDiskStateRequest := &diskv2.SetDiskStateRequest{
+		DiskNumber: uint32(diskNumber),
+		IsOnline:   true,
+	}
+	_, err = mounter.DiskClient.SetDiskState(context.Background(), setDiskStateRequest)
+	if err != nil {
+		return fmt.Errorf("error bringing disk %d online: %w", diskNumber, err)
+	}
+
+	// The link cannot be created over anything left at target, like a directory created by kubelet
+	exists, err := mounter.ExistsPath(target)
+	if err != nil {
+		return err
+	}
+	if exists {
+		if err = mounter.Rmdir(target); err != nil {
+			return err
+		}
+	}
+
+	devicePath := physicalDrivePath(diskNumber)
+	if err = createSymlink(devicePath, util.NormalizeWindowsPath(target)); err != nil {
+		return fmt.Errorf("error linking %q to %q: %w", target, devicePath, err)
+	}
+	klog.V(4).InfoS("Successfully published raw block volume", "diskNumber", diskNumber, "target", target)
+	return nil
+}
+
 func (mounter *CSIProxyMounterV2) Unmount(target string) error {
 	// Find the volume id
 	getVolumeIdRequest := &volumev2.GetVolumeIDFromTargetPathRequest{
@@ -323,15 +367,16 @@ func (mounter *CSIProxyMounterV2) FindDiskByLun(lun string) (diskNum string, err
 }
 
 // FormatAndMount - accepts the source disk number, target path to mount, the fstype to format with and options to be used.
-func (mounter *CSIProxyMounterV2) FormatAndMountSensitiveWithFormatOptions(source string, target string, fstype string, options []string, sensitiveOptions []string, formatOptions []string) error {
+func (mounter *CSIProxyMounterV2) FormatAndMountSensitiveWithFormatOptions(ctx context.Context, source string, target string, fstype string, options []string, sensitiveOptions []string, formatOptions []string) error {
 	// sensitiveOptions is not supported on Windows because we have no reasonable way to control what the csi-proxy does
 	if len(sensitiveOptions) > 0 {
 		return errors.New("sensitiveOptions not supported on Windows!")
 	}
-	// formatOptions is not supported on Windows because the csi-proxy does not allow supplying format arguments
-	// This limitation will be addressed in the future with privileged Windows containers
-	if len(formatOptions) > 0 {
-		return errors.New("formatOptions not supported on Windows!")
+	// The csi-proxy library does not allow supplying format arguments, so volumes with NTFS format options
+	// are formatted with Format-Volume directly
+	ntfsOptions, err := ParseNTFSFormatOptions(formatOptions)
+	if err != nil {
+		return err
 	}
 
 	diskNumber, err := strconv.Atoi(source)
@@ -343,7 +388,7 @@ func (mounter *CSIProxyMounterV2) FormatAndMountSensitiveWithFormatOptions(sourc
 	partionDiskRequest := &diskv2.PartitionDiskRequest{
 		DiskNumber: uint32(diskNumber),
 	}
-	_, err = mounter.DiskClient.PartitionDisk(context.Background(), partionDiskRequest)
+	_, err = mounter.DiskClient.PartitionDisk(ctx, partionDiskRequest)
 	if err != nil {
 		return err
 	}
@@ -353,7 +398,7 @@ func (mounter *CSIProxyMounterV2) FormatAndMountSensitiveWithFormatOptions(sourc
 		DiskNumber: uint32(diskNumber),
 		IsOnline:   true,
 	}
-	_, err = mounter.DiskClient.SetDiskState(context.Background(), setDiskStateRequest)
+	_, err = mounter.DiskClient.SetDiskState(ctx, setDiskStateRequest)
 	if err != nil {
 		return err
 	}
@@ -362,7 +407,7 @@ func (mounter *CSIProxyMounterV2) FormatAndMountSensitiveWithFormatOptions(sourc
 	volumeIDsRequest := &volumev2.ListVolumesOnDiskRequest{
 		DiskNumber: uint32(diskNumber),
 	}
-	volumeIdResponse, err := mounter.VolumeClient.ListVolumesOnDisk(context.Background(), volumeIDsRequest)
+	volumeIdResponse, err := mounter.VolumeClient.ListVolumesOnDisk(ctx, volumeIDsRequest)
 	if err != nil {
 		return err
 	}
@@ -375,20 +420,27 @@ func (mounter *CSIProxyMounterV2) FormatAndMountSensitiveWithFormatOptions(sourc
 	isVolumeFormattedRequest := &volumev2.IsVolumeFormattedRequest{
 		VolumeID: volumeID,
 	}
-	isVolumeFormattedResponse, err := mounter.VolumeClient.IsVolumeFormatted(context.Background(), isVolumeFormattedRequest)
+	isVolumeFormattedResponse, err := mounter.VolumeClient.IsVolumeFormatted(ctx, isVolumeFormattedRequest)
 	if err != nil {
 		return err
 	}
 
 	// If the volume is not formatted, then format it, else proceed to mount.
 	if !isVolumeFormattedResponse.Formatted {
-		formatVolumeRequest := &volumev2.FormatVolumeRequest{
-			VolumeID: volumeID,
-			// TODO: Accept the filesystem and other options
-		}
-		_, err = mounter.VolumeClient.FormatVolume(context.Background(), formatVolumeRequest)
-		if err != nil {
-			return err
+		if ntfsOptions != (NTFSFormatOptions{}) {
+			cmd, env := ntfsOptions.formatCommand(volumeID)
+			klog.V(4).InfoS("Formatting volume with format options", "volumeID", volumeID, "allocationUnitSize", ntfsOptions.AllocationUnitSize, "label", ntfsOptions.Label)
+			if out, err := runPowershellCmd(cmd, env...); err != nil {
+				return fmt.Errorf("error formatting volume. cmd: %s, output: %s, error: %w", cmd, string(out), err)
+			}
+		} else {
+			formatVolumeRequest := &volumev2.FormatVolumeRequest{
+				VolumeID: volumeID,
+			}
+			_, err = mounter.VolumeClient.FormatVolume(ctx, formatVolumeRequest)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
@@ -397,7 +449,7 @@ func (mounter *CSIProxyMounterV2) FormatAndMountSensitiveWithFormatOptions(sourc
 		VolumeID:   volumeID,
 		TargetPath: util.NormalizeWindowsPath(target),
 	}
-	_, err = mounter.VolumeClient.MountVolume(context.Background(), mountVolumeRequest)
+	_, err = mounter.VolumeClient.MountVolume(ctx, mountVolumeRequest)
 	if err != nil {
 		return err
 	}
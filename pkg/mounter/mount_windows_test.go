@@ -0,0 +1,314 @@
+//go:build windows
+// +build windows
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mounter
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	diskv2 "github.com/kubernetes-csi/csi-proxy/v2/pkg/disk"
+	fsv2 "github.com/kubernetes-csi/csi-proxy/v2/pkg/filesystem"
+	mountutils "k8s.io/mount-utils"
+)
+
+const blockTarget = `c:\var\lib\kubelet\plugins\kubernetes.io\csi\volumeDevices\publish\pvc-1234\pod-1234`
+
+// fakeDiskClient records the disk state changes requested through csi-proxy
+// Calling a method that is not overridden panics
+type fakeDiskClient struct {
+	diskv2.Interface
+	online        map[uint32]bool
+	sizes         map[uint32]int64
+	setStateErr   error
+	setStateCalls int
+}
+
+func (c *fakeDiskClient) SetDiskState(_ context.Context, req *diskv2.SetDiskStateRequest) (*diskv2.SetDiskStateResponse, error) {
+	c.setStateCalls++
+	if c.setStateErr != nil {
+		return nil, c.setStateErr
+	}
+	c.online[req.DiskNumber] = req.IsOnline
+	return &diskv2.SetDiskStateResponse{}, nil
+}
+
+func (c *fakeDiskClient) GetDiskStats(_ context.Context, req *diskv2.GetDiskStatsRequest) (*diskv2.GetDiskStatsResponse, error) {
+	size, ok := c.sizes[req.DiskNumber]
+	if !ok {
+		return nil, errors.New("disk not found")
+	}
+	return &diskv2.GetDiskStatsResponse{TotalBytes: size}, nil
+}
+
+// fakeFsClient tracks the paths that exist on the host and the symbolic links created through csi-proxy
+// Calling a method that is not overridden panics
+type fakeFsClient struct {
+	fsv2.Interface
+	paths    map[string]bool
+	symlinks map[string]string
+	removed  []string
+}
+
+func (c *fakeFsClient) PathExists(_ context.Context, req *fsv2.PathExistsRequest) (*fsv2.PathExistsResponse, error) {
+	return &fsv2.PathExistsResponse{Exists: c.paths[req.Path]}, nil
+}
+
+func (c *fakeFsClient) Rmdir(_ context.Context, req *fsv2.RmdirRequest) (*fsv2.RmdirResponse, error) {
+	delete(c.paths, req.Path)
+	c.removed = append(c.removed, req.Path)
+	return &fsv2.RmdirResponse{}, nil
+}
+
+func (c *fakeFsClient) CreateSymlink(_ context.Context, req *fsv2.CreateSymlinkRequest) (*fsv2.CreateSymlinkResponse, error) {
+	c.paths[req.TargetPath] = true
+	c.symlinks[req.TargetPath] = req.SourcePath
+	return &fsv2.CreateSymlinkResponse{}, nil
+}
+
+func newFakeNodeMounter(fsClient *fakeFsClient, diskClient *fakeDiskClient) *NodeMounter {
+	return &NodeMounter{SafeFormatAndMount: &mountutils.SafeFormatAndMount{
+		Interface: &CSIProxyMounterV2{
+			FsClient:   fsClient,
+			DiskClient: diskClient,
+		},
+	}}
+}
+
+// setLinks replaces readLink and createSymlink with a fake host filesystem holding the given symbolic links
+func setLinks(t *testing.T, links map[string]string) {
+	t.Helper()
+	oldReadLink, oldCreateSymlink := readLink, createSymlink
+	t.Cleanup(func() {
+		readLink, createSymlink = oldReadLink, oldCreateSymlink
+	})
+	readLink = func(path string) (string, error) {
+		destination, ok := links[path]
+		if !ok {
+			return "", os.ErrNotExist
+		}
+		return destination, nil
+	}
+	createSymlink = func(oldname, newname string) error {
+		links[newname] = oldname
+		return nil
+	}
+}
+
+func TestMountBlockDevice(t *testing.T) {
+	testCases := []struct {
+		name            string
+		source          string
+		existingPaths   map[string]bool
+		setStateErr     error
+		expectedLinks   map[string]string
+		expectedRemoved []string
+		expectedOnline  map[uint32]bool
+		expectErr       bool
+	}{
+		{
+			name:           "disk is brought online and linked",
+			source:         "3",
+			expectedLinks:  map[string]string{blockTarget: `\\.\PHYSICALDRIVE3`},
+			expectedOnline: map[uint32]bool{3: true},
+		},
+		{
+			name:            "leftover target is removed before linking",
+			source:          "3",
+			existingPaths:   map[string]bool{blockTarget: true},
+			expectedLinks:   map[string]string{blockTarget: `\\.\PHYSICALDRIVE3`},
+			expectedRemoved: []string{blockTarget},
+			expectedOnline:  map[uint32]bool{3: true},
+		},
+		{
+			name:           "disk cannot be brought online",
+			source:         "3",
+			setStateErr:    errors.New("access denied"),
+			expectedLinks:  map[string]string{},
+			expectedOnline: map[uint32]bool{},
+			expectErr:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			links := map[string]string{}
+			setLinks(t, links)
+			if tc.existingPaths == nil {
+				tc.existingPaths = map[string]bool{}
+			}
+			fsClient := &fakeFsClient{paths: tc.existingPaths, symlinks: map[string]string{}}
+			diskClient := &fakeDiskClient{online: map[uint32]bool{}, setStateErr: tc.setStateErr}
+			m := newFakeNodeMounter(fsClient, diskClient)
+
+			err := m.Mount(tc.source, blockTarget, "", []string{"bind"})
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(links, tc.expectedLinks) {
+				t.Errorf("Unexpected links: got %v, want %v", links, tc.expectedLinks)
+			}
+			if !reflect.DeepEqual(fsClient.removed, tc.expectedRemoved) {
+				t.Errorf("Unexpected removed paths: got %v, want %v", fsClient.removed, tc.expectedRemoved)
+			}
+			if !reflect.DeepEqual(diskClient.online, tc.expectedOnline) {
+				t.Errorf("Unexpected disk states: got %v, want %v", diskClient.online, tc.expectedOnline)
+			}
+			if len(fsClient.symlinks) != 0 {
+				t.Errorf("Expected no links created through csi-proxy, got %v", fsClient.symlinks)
+			}
+		})
+	}
+}
+
+func TestMountFileSystemVolume(t *testing.T) {
+	setLinks(t, map[string]string{})
+	fsClient := &fakeFsClient{paths: map[string]bool{}, symlinks: map[string]string{}}
+	diskClient := &fakeDiskClient{online: map[uint32]bool{}}
+	m := newFakeNodeMounter(fsClient, diskClient)
+
+	source := `c:\var\lib\kubelet\plugins\kubernetes.io\csi\ebs.csi.aws.com\1234\globalmount`
+	target := `c:\var\lib\kubelet\pods\1234\volumes\kubernetes.io~csi\pvc-1234\mount`
+	if err := m.Mount(source, target, "", []string{"bind"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fsClient.symlinks[target] != source {
+		t.Errorf("Expected %q to link to %q through csi-proxy, got links %v", target, source, fsClient.symlinks)
+	}
+	if diskClient.setStateCalls != 0 {
+		t.Errorf("Expected no disk state changes, got %d", diskClient.setStateCalls)
+	}
+}
+
+func TestBlockVolumeLinks(t *testing.T) {
+	fsTarget := `c:\var\lib\kubelet\pods\1234\volumes\kubernetes.io~csi\pvc-5678\mount`
+	setLinks(t, map[string]string{
+		blockTarget: `\\.\PHYSICALDRIVE3`,
+		fsTarget:    `c:\var\lib\kubelet\plugins\kubernetes.io\csi\ebs.csi.aws.com\5678\globalmount`,
+	})
+	fsClient := &fakeFsClient{paths: map[string]bool{blockTarget: true}, symlinks: map[string]string{}}
+	diskClient := &fakeDiskClient{online: map[uint32]bool{}, sizes: map[uint32]int64{3: 10 * 1024 * 1024 * 1024}}
+	m := newFakeNodeMounter(fsClient, diskClient)
+
+	isBlock, err := m.IsBlockDevice(blockTarget)
+	if err != nil || !isBlock {
+		t.Errorf("Expected %q to be a block device, got %v, %v", blockTarget, isBlock, err)
+	}
+	isBlock, err = m.IsBlockDevice(fsTarget)
+	if err != nil || isBlock {
+		t.Errorf("Expected %q not to be a block device, got %v, %v", fsTarget, isBlock, err)
+	}
+	isBlock, err = m.IsBlockDevice(`c:\does\not\exist`)
+	if err != nil || isBlock {
+		t.Errorf("Expected a missing path not to be a block device, got %v, %v", isBlock, err)
+	}
+
+	notMnt, err := m.IsLikelyNotMountPoint(blockTarget)
+	if err != nil || notMnt {
+		t.Errorf("Expected %q to be a mount point, got %v, %v", blockTarget, notMnt, err)
+	}
+
+	for _, devicePath := range []string{blockTarget, "3"} {
+		size, err := m.GetBlockSizeBytes(devicePath)
+		if err != nil {
+			t.Errorf("Unexpected error getting the size of %q: %v", devicePath, err)
+		}
+		if size != 10*1024*1024*1024 {
+			t.Errorf("Unexpected size of %q: %d", devicePath, size)
+		}
+	}
+	if _, err := m.GetBlockSizeBytes(fsTarget); err == nil {
+		t.Errorf("Expected error getting the block size of %q", fsTarget)
+	}
+
+	if err := m.Unpublish(blockTarget); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(fsClient.removed, []string{blockTarget}) {
+		t.Errorf("Expected %q to be removed, got %v", blockTarget, fsClient.removed)
+	}
+	if diskClient.setStateCalls != 0 {
+		t.Errorf("Expected the disk to stay online, got %d disk state changes", diskClient.setStateCalls)
+	}
+}
+
+func TestGetBlockSizeBytes(t *testing.T) {
+	fsTarget := `c:\var\lib\kubelet\pods\1234\volumes\kubernetes.io~csi\pvc-5678\mount`
+	testCases := []struct {
+		name          string
+		devicePath    string
+		links         map[string]string
+		expectedSize  int64
+		expectedError string
+	}{
+		{
+			name:         "disk number",
+			devicePath:   "3",
+			expectedSize: 10 * 1024 * 1024 * 1024,
+		},
+		{
+			name:         "published raw block volume",
+			devicePath:   blockTarget,
+			links:        map[string]string{blockTarget: `\\.\PHYSICALDRIVE3`},
+			expectedSize: 10 * 1024 * 1024 * 1024,
+		},
+		{
+			name:          "disk not found",
+			devicePath:    blockTarget,
+			links:         map[string]string{blockTarget: `\\.\PHYSICALDRIVE4`},
+			expectedError: "error getting the size of disk 4: disk not found",
+		},
+		{
+			name:          "not a raw block volume",
+			devicePath:    fsTarget,
+			links:         map[string]string{fsTarget: `c:\var\lib\kubelet\plugins\kubernetes.io\csi\ebs.csi.aws.com\5678\globalmount`},
+			expectedError: "is neither a disk number nor a raw block volume",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.links == nil {
+				tc.links = map[string]string{}
+			}
+			setLinks(t, tc.links)
+			fsClient := &fakeFsClient{paths: map[string]bool{}, symlinks: map[string]string{}}
+			diskClient := &fakeDiskClient{online: map[uint32]bool{}, sizes: map[uint32]int64{3: 10 * 1024 * 1024 * 1024}}
+			m := newFakeNodeMounter(fsClient, diskClient)
+
+			size, err := m.GetBlockSizeBytes(tc.devicePath)
+			if tc.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+					t.Fatalf("Expected error containing %q, got %v", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if size != tc.expectedSize {
+				t.Errorf("Unexpected size: got %d, want %d", size, tc.expectedSize)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mounter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// NTFSAllocationUnitSizeOption is the format option setting the allocation unit (cluster) size of an NTFS volume in bytes
+	NTFSAllocationUnitSizeOption = "-AllocationUnitSize"
+	// NTFSLabelOption is the format option setting the label of an NTFS volume
+	NTFSLabelOption = "-NewFileSystemLabel"
+
+	ntfsMinAllocationUnitSize = 512
+	ntfsMaxAllocationUnitSize = 2 * 1024 * 1024
+	ntfsMaxLabelLength        = 32
+	ntfsInvalidLabelChars     = `*?/\|.,;:+=[]<>"`
+)
+
+// NTFSFormatOptions are the parameters of Format-Volume that can be set when formatting an NTFS volume on Windows
+type NTFSFormatOptions struct {
+	// AllocationUnitSize is the cluster size in bytes, 0 uses the Windows default
+	AllocationUnitSize uint32
+	// Label is the volume label, empty leaves the volume unlabeled
+	Label string
+}
+
+// ParseNTFSAllocationUnitSize parses an NTFS allocation unit size in bytes
+// Windows only supports powers of two between 512 bytes and 2 MiB
+func ParseNTFSAllocationUnitSize(size string) (uint32, error) {
+	n, err := strconv.ParseUint(size, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("allocation unit size %q is not a number of bytes", size)
+	}
+	if n < ntfsMinAllocationUnitSize || n > ntfsMaxAllocationUnitSize || n&(n-1) != 0 {
+		return 0, fmt.Errorf("allocation unit size %d must be a power of two between %d and %d bytes", n, ntfsMinAllocationUnitSize, ntfsMaxAllocationUnitSize)
+	}
+	return uint32(n), nil
+}
+
+// ValidateNTFSLabel checks that label can be used as the label of an NTFS volume
+func ValidateNTFSLabel(label string) error {
+	if len(label) == 0 || len(label) > ntfsMaxLabelLength {
+		return fmt.Errorf("volume label %q must be between 1 and %d characters", label, ntfsMaxLabelLength)
+	}
+	if i := strings.IndexAny(label, ntfsInvalidLabelChars); i >= 0 {
+		return fmt.Errorf("volume label %q must not contain %q", label, label[i])
+	}
+	for _, r := range label {
+		if r < ' ' {
+			return fmt.Errorf("volume label %q must not contain control characters", label)
+		}
+	}
+	return nil
+}
+
+// Args returns the format options requesting o, to be passed to FormatAndMountSensitiveWithFormatOptions
+func (o NTFSFormatOptions) Args() []string {
+	var args []string
+	if o.AllocationUnitSize > 0 {
+		args = append(args, NTFSAllocationUnitSizeOption, strconv.FormatUint(uint64(o.AllocationUnitSize), 10))
+	}
+	if o.Label != "" {
+		args = append(args, NTFSLabelOption, o.Label)
+	}
+	return args
+}
+
+// ParseNTFSFormatOptions parses format options created by NTFSFormatOptions.Args
+func ParseNTFSFormatOptions(formatOptions []string) (NTFSFormatOptions, error) {
+	var o NTFSFormatOptions
+	if len(formatOptions)%2 != 0 {
+		return o, fmt.Errorf("format options %v are not option and value pairs", formatOptions)
+	}
+	for i := 0; i < len(formatOptions); i += 2 {
+		option, value := formatOptions[i], formatOptions[i+1]
+		switch option {
+		case NTFSAllocationUnitSizeOption:
+			size, err := ParseNTFSAllocationUnitSize(value)
+			if err != nil {
+				return o, err
+			}
+			o.AllocationUnitSize = size
+		case NTFSLabelOption:
+			if err := ValidateNTFSLabel(value); err != nil {
+				return o, err
+			}
+			o.Label = value
+		default:
+			return o, fmt.Errorf("format option %q is not supported for ntfs", option)
+		}
+	}
+	return o, nil
+}
+
+// formatCommand returns the PowerShell command formatting the volume with o, and the environment variables it reads
+// Values are passed through the environment rather than the command so that they are never interpreted by PowerShell
+func (o NTFSFormatOptions) formatCommand(volumeID string) (string, []string) {
+	cmd := `Get-Volume -UniqueId "$Env:volumeID" | Format-Volume -FileSystem ntfs`
+	env := []string{"volumeID=" + volumeID}
+	if o.AllocationUnitSize > 0 {
+		cmd += ` -AllocationUnitSize $Env:allocationUnitSize`
+		env = append(env, fmt.Sprintf("allocationUnitSize=%d", o.AllocationUnitSize))
+	}
+	if o.Label != "" {
+		cmd += ` -NewFileSystemLabel "$Env:volumeLabel"`
+		env = append(env, "volumeLabel="+o.Label)
+	}
+	return cmd + ` -Confirm:$false`, env
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mounter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNTFSFormatOptions(t *testing.T) {
+	testCases := []struct {
+		name          string
+		formatOptions []string
+		expected      NTFSFormatOptions
+		expectErr     bool
+	}{
+		{
+			name: "no options",
+		},
+		{
+			name:          "allocation unit size and label",
+			formatOptions: NTFSFormatOptions{AllocationUnitSize: 65536, Label: "SQL Data"}.Args(),
+			expected:      NTFSFormatOptions{AllocationUnitSize: 65536, Label: "SQL Data"},
+		},
+		{
+			name:          "label only",
+			formatOptions: []string{NTFSLabelOption, "logs"},
+			expected:      NTFSFormatOptions{Label: "logs"},
+		},
+		{
+			name:          "allocation unit size not a power of two",
+			formatOptions: []string{NTFSAllocationUnitSizeOption, "65535"},
+			expectErr:     true,
+		},
+		{
+			name:          "allocation unit size too large",
+			formatOptions: []string{NTFSAllocationUnitSizeOption, "4194304"},
+			expectErr:     true,
+		},
+		{
+			name:          "allocation unit size with unit",
+			formatOptions: []string{NTFSAllocationUnitSizeOption, "64K"},
+			expectErr:     true,
+		},
+		{
+			name:          "label with invalid character",
+			formatOptions: []string{NTFSLabelOption, `data"; Remove-Item C:\`},
+			expectErr:     true,
+		},
+		{
+			name:          "label too long",
+			formatOptions: []string{NTFSLabelOption, "abcdefghijklmnopqrstuvwxyz0123456789"},
+			expectErr:     true,
+		},
+		{
+			name:          "unsupported option",
+			formatOptions: []string{"-b", "4096"},
+			expectErr:     true,
+		},
+		{
+			name:          "missing value",
+			formatOptions: []string{NTFSLabelOption},
+			expectErr:     true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			o, err := ParseNTFSFormatOptions(tc.formatOptions)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("Expected error, got options %+v", o)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if o != tc.expected {
+				t.Errorf("Unexpected options: got %+v, want %+v", o, tc.expected)
+			}
+		})
+	}
+}
+
+func TestNTFSFormatCommand(t *testing.T) {
+	testCases := []struct {
+		name        string
+		options     NTFSFormatOptions
+		expectedCmd string
+		expectedEnv []string
+	}{
+		{
+			name:        "allocation unit size",
+			options:     NTFSFormatOptions{AllocationUnitSize: 65536},
+			expectedCmd: `Get-Volume -UniqueId "$Env:volumeID" | Format-Volume -FileSystem ntfs -AllocationUnitSize $Env:allocationUnitSize -Confirm:$false`,
+			expectedEnv: []string{`volumeID=\\?\Volume{1234}\`, "allocationUnitSize=65536"},
+		},
+		{
+			name:        "label",
+			options:     NTFSFormatOptions{Label: "SQL Data"},
+			expectedCmd: `Get-Volume -UniqueId "$Env:volumeID" | Format-Volume -FileSystem ntfs -NewFileSystemLabel "$Env:volumeLabel" -Confirm:$false`,
+			expectedEnv: []string{`volumeID=\\?\Volume{1234}\`, "volumeLabel=SQL Data"},
+		},
+		{
+			name:        "allocation unit size and label",
+			options:     NTFSFormatOptions{AllocationUnitSize: 8192, Label: "logs"},
+			expectedCmd: `Get-Volume -UniqueId "$Env:volumeID" | Format-Volume -FileSystem ntfs -AllocationUnitSize $Env:allocationUnitSize -NewFileSystemLabel "$Env:volumeLabel" -Confirm:$false`,
+			expectedEnv: []string{`volumeID=\\?\Volume{1234}\`, "allocationUnitSize=8192", "volumeLabel=logs"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd, env := tc.options.formatCommand(`\\?\Volume{1234}\`)
+			if cmd != tc.expectedCmd {
+				t.Errorf("Unexpected command:\ngot  %s\nwant %s", cmd, tc.expectedCmd)
+			}
+			if !reflect.DeepEqual(env, tc.expectedEnv) {
+				t.Errorf("Unexpected environment: got %v, want %v", env, tc.expectedEnv)
+			}
+		})
+	}
+}
@@ -34,6 +34,13 @@ type VolumeSnapshotProps struct {
 	VolumeSnapshotContentName string
 }
 
+// ExtraTagProps are the variables of --extra-tags, which are added to both volumes and snapshots. The variables of the
+// other kind of resource are empty.
+type ExtraTagProps struct {
+	PVProps
+	VolumeSnapshotProps
+}
+
 func Evaluate(tm []string, props interface{}, warnOnly bool) (map[string]string, error) {
 	md := make(map[string]string)
 	for _, s := range tm {
@@ -59,6 +66,24 @@ func Evaluate(tm []string, props interface{}, warnOnly bool) (map[string]string,
 	return md, nil
 }
 
+// EvaluateTags interpolates the values of tags like Evaluate, for tags that are already split into keys and values
+func EvaluateTags(tags map[string]string, props interface{}, warnOnly bool) (map[string]string, error) {
+	md := make(map[string]string, len(tags))
+	for key, value := range tags {
+		t := template.New("tmpl").Funcs(template.FuncMap(newFuncMap()))
+		val, err := execTemplate(value, props, t)
+		if err != nil {
+			if warnOnly {
+				klog.InfoS("Unable to interpolate value", "key", key, "value", value, "err", err)
+				continue
+			}
+			return nil, fmt.Errorf("could not interpolate the value of tag %s: %w", key, err)
+		}
+		md[key] = val
+	}
+	return md, nil
+}
+
 func execTemplate(value string, props interface{}, t *template.Template) (string, error) {
 	tmpl, err := t.Parse(value)
 	if err != nil {
@@ -367,3 +367,82 @@ func TestEvaluateVolumeSnapshotTemplate(t *testing.T) {
 		})
 	}
 }
+
+func TestEvaluateTags(t *testing.T) {
+	testCases := []struct {
+		name         string
+		tags         map[string]string
+		props        ExtraTagProps
+		warnOnly     bool
+		expectErr    bool
+		expectedTags map[string]string
+	}{
+		{
+			name:         "no interpolation",
+			tags:         map[string]string{"key1": "value1", "key=2": "a=b"},
+			expectedTags: map[string]string{"key1": "value1", "key=2": "a=b"},
+		},
+		{
+			name: "volume substitution",
+			tags: map[string]string{
+				"team": "{{ .PVCNamespace }}",
+				"pvc":  "{{ .PVCName }}",
+				"pv":   "{{ .PVName }}",
+			},
+			props: ExtraTagProps{PVProps: PVProps{PVCName: "ebs-claim", PVCNamespace: "team-a", PVName: "pvc-012345"}},
+			expectedTags: map[string]string{
+				"team": "team-a",
+				"pvc":  "ebs-claim",
+				"pv":   "pvc-012345",
+			},
+		},
+		{
+			name: "snapshot substitution",
+			tags: map[string]string{
+				"team":     "{{ .VolumeSnapshotNamespace }}",
+				"snapshot": "{{ .VolumeSnapshotName }}",
+				"pvc":      "{{ .PVCName }}",
+			},
+			props: ExtraTagProps{VolumeSnapshotProps: VolumeSnapshotProps{VolumeSnapshotName: "ebs-vs", VolumeSnapshotNamespace: "team-a"}},
+			expectedTags: map[string]string{
+				"team":     "team-a",
+				"snapshot": "ebs-vs",
+				"pvc":      "",
+			},
+		},
+		{
+			name:      "unknown variable",
+			tags:      map[string]string{"team": "{{ .Namespace }}"},
+			expectErr: true,
+		},
+		{
+			name:      "template parsing error",
+			tags:      map[string]string{"team": "{{ .PVCNamespace }"},
+			expectErr: true,
+		},
+		{
+			name:         "unknown variable warn only",
+			tags:         map[string]string{"team": "{{ .Namespace }}", "key1": "value1"},
+			warnOnly:     true,
+			expectedTags: map[string]string{"key1": "value1"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tags, err := EvaluateTags(tc.tags, tc.props, tc.warnOnly)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error; got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err is not nil; err = %v", err)
+			}
+			if diff := cmp.Diff(tc.expectedTags, tags); diff != "" {
+				t.Fatalf("tags are different; diff = %v", diff)
+			}
+		})
+	}
+}
@@ -155,18 +155,30 @@ func NormalizeWindowsPath(path string) string {
 }
 
 // SanitizeRequest takes a request object and returns a copy of the request with
-// the "Secrets" field cleared.
+// the "Secrets" field cleared. The request itself is left untouched so that its
+// secrets remain available to the caller.
 func SanitizeRequest(req interface{}) interface{} {
-	v := reflect.ValueOf(&req).Elem()
-	e := reflect.New(v.Elem().Type()).Elem()
-
-	e.Set(v.Elem())
-
-	f := reflect.Indirect(e).FieldByName("Secrets")
+	v := reflect.ValueOf(req)
+	isPtr := v.Kind() == reflect.Ptr
+	if isPtr {
+		if v.IsNil() {
+			return req
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return req
+	}
+	f := v.FieldByName("Secrets")
+	if !f.IsValid() || f.Kind() != reflect.Map {
+		return req
+	}
 
-	if f.IsValid() && f.CanSet() && f.Kind() == reflect.Map {
-		f.Set(reflect.MakeMap(f.Type()))
-		v.Set(e)
+	sanitized := reflect.New(v.Type()).Elem()
+	sanitized.Set(v)
+	sanitized.FieldByName("Secrets").Set(reflect.MakeMap(f.Type()))
+	if isPtr {
+		return sanitized.Addr().Interface()
 	}
-	return req
+	return sanitized.Interface()
 }
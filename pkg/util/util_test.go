@@ -250,14 +250,34 @@ func TestSanitizeRequest(t *testing.T) {
 				Secrets: map[string]string{},
 			},
 		},
+		{
+			name: "Request value with Secrets",
+			req: TestRequest{
+				Name:    "Test",
+				Secrets: map[string]string{"key1": "value1"},
+			},
+			expected: TestRequest{
+				Name:    "Test",
+				Secrets: map[string]string{},
+			},
+		},
+		{
+			name:     "Request without Secrets",
+			req:      &struct{ Name string }{Name: "Test"},
+			expected: &struct{ Name string }{Name: "Test"},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			original := fmt.Sprint(tt.req)
 			result := SanitizeRequest(tt.req)
 			if !reflect.DeepEqual(result, tt.expected) {
 				t.Errorf("SanitizeRequest() = %v, expected %v", result, tt.expected)
 			}
+			if fmt.Sprint(tt.req) != original {
+				t.Errorf("SanitizeRequest() modified the request: got %v, want %v", tt.req, original)
+			}
 		})
 	}
 }
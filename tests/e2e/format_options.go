@@ -86,6 +86,19 @@ var _ = Describe("[ebs-csi-e2e] [single-az] [format-options] Formatting a volume
 					ebscsidriver.FSTypeKey:          fsType,
 				},
 			},
+			ebscsidriver.Ext4StripeWidthKey: {
+				CreateVolumeParameters: map[string]string{
+					ebscsidriver.Ext4StrideKey:      "16",
+					ebscsidriver.Ext4StripeWidthKey: "64",
+					ebscsidriver.FSTypeKey:          fsType,
+				},
+			},
+			ebscsidriver.Ext4LazyInitKey: {
+				CreateVolumeParameters: map[string]string{
+					ebscsidriver.Ext4LazyInitKey: "false",
+					ebscsidriver.FSTypeKey:       fsType,
+				},
+			},
 		}
 
 		Context(fmt.Sprintf("using an %s filesystem", fsType), func() {